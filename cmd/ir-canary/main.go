@@ -0,0 +1,85 @@
+// Command ir-canary turns the end-to-end flow test into an always-on monitor: on a schedule it
+// injects a tagged synthetic finding into a deployed stack, checks that the pipeline stores its
+// evidence and completes its IR execution within the SLO, and emits the ThreatDetectionIR
+// CanaryHealthy and CanaryLatency metrics. Canary findings never page. They are published under the
+// ir.canary source, which only reaches triage in stacks deployed with enable_canary_findings.
+//
+// Exit codes: 0 healthy, 1 error, 2 unhealthy (single run only; with -interval it runs until killed).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/canary"
+)
+
+func main() {
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	stateMachineARN := flag.String("state-machine-arn", "", "IR state machine ARN (terraform output stepfn_ir_state_machine_arn)")
+	evidenceBucket := flag.String("evidence-bucket", "", "Evidence bucket name (terraform output s3_evidence_bucket_name)")
+	stack := flag.String("stack", "default", "Stack name reported as the Stack dimension of the health metric")
+	severity := flag.Float64("severity", 7.0, "Canary severity; must meet the stack's finding_severity_threshold")
+	slo := flag.Duration("slo", 5*time.Minute, "Time from injection to a succeeded IR execution")
+	interval := flag.Duration("interval", 0, "Run every interval until killed (default: run once)")
+	noMetrics := flag.Bool("no-metrics", false, "Do not emit health metrics")
+	flag.Parse()
+
+	if *stateMachineARN == "" || *evidenceBucket == "" {
+		fail(fmt.Errorf("-state-machine-arn and -evidence-bucket are required"))
+	}
+	if *interval > 0 && *interval < *slo {
+		fail(fmt.Errorf("-interval must not be shorter than -slo"))
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	c := canary.Canary{
+		Session:         sess,
+		StateMachineArn: *stateMachineARN,
+		EvidenceBucket:  *evidenceBucket,
+		Stack:           *stack,
+		Severity:        *severity,
+		SLO:             *slo,
+	}
+
+	run := func() canary.Result {
+		result := c.RunOnce()
+		fmt.Println(result)
+		if !*noMetrics {
+			if err := c.Emit(result); err != nil {
+				fmt.Fprintf(os.Stderr, "ir-canary: %v\n", err)
+			}
+		}
+		return result
+	}
+
+	if *interval == 0 {
+		if !run().Healthy() {
+			os.Exit(2)
+		}
+		return
+	}
+
+	for {
+		started := time.Now()
+		run()
+		time.Sleep(time.Until(started.Add(*interval)))
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-canary: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,47 @@
+// Command ir-drift plans a deployed threat-detection-ir workspace and prints a
+// categorized drift report (security-impacting, functional, cosmetic).
+//
+// Exit codes: 0 no drift, 1 error, 2 security-impacting drift, 3 other drift only.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tfplan"
+)
+
+type varFiles []string
+
+func (v *varFiles) String() string     { return strings.Join(*v, ",") }
+func (v *varFiles) Set(s string) error { *v = append(*v, s); return nil }
+
+func main() {
+	dir := flag.String("dir", ".", "Terraform workspace directory of the deployed stack")
+	var files varFiles
+	flag.Var(&files, "var-file", "Terraform var file used for the deployment (repeatable)")
+	flag.Parse()
+
+	var args []string
+	for _, file := range files {
+		args = append(args, "-var-file="+file)
+	}
+
+	plan, _, err := tfplan.Run(*dir, args...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ir-drift: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := tfplan.BuildReport(plan)
+	fmt.Print(report)
+
+	switch {
+	case len(report.Security) > 0:
+		os.Exit(2)
+	case report.HasDrift():
+		os.Exit(3)
+	}
+}
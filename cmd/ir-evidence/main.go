@@ -0,0 +1,165 @@
+// Command ir-evidence answers responder questions about an evidence bucket with Athena: which
+// findings reached a severity, arrived in a time window, or named a resource. It creates a temporary
+// workgroup and table for the query and removes them before it exits.
+//
+// "ir-evidence timeline -finding <id>" instead prints what happened to one finding, oldest first:
+// its EventBridge event, the triage log lines, the steps of its IR executions, its evidence and
+// its notification.
+//
+// Exit codes: 0 success, 1 error.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/athena"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/timeline"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "timeline" {
+		runTimeline(os.Args[2:])
+		return
+	}
+
+	region := flag.String("region", "us-east-1", "AWS region of the evidence bucket")
+	bucket := flag.String("bucket", "", "Evidence bucket to query (required)")
+	minSeverity := flag.String("min-severity", "0", "Only findings at or above this GuardDuty severity, a 0-10 score or a label such as HIGH")
+	since := flag.Duration("since", 0, "Only findings from this long ago until now, e.g. 24h")
+	resource := flag.String("resource", "", "Only findings naming this instance ID or access key ID")
+	asJSON := flag.Bool("json", false, "Print the findings as JSON instead of a table")
+	flag.Parse()
+
+	if *bucket == "" {
+		fail(fmt.Errorf("-bucket is required"))
+	}
+	threshold, err := severity.Parse(*minSeverity)
+	if err != nil {
+		fail(fmt.Errorf("-min-severity: %w", err))
+	}
+
+	sess, err := newSession(*region)
+	if err != nil {
+		fail(err)
+	}
+
+	evidence, err := athena.Open(sess, *bucket, "cli-"+strconv.FormatInt(time.Now().Unix(), 36))
+	if err != nil {
+		fail(err)
+	}
+
+	findings, err := query(evidence, threshold, *since, *resource)
+	if closeErr := evidence.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "ir-evidence: %v\n", closeErr)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TIME\tSEVERITY\tFINDING\tTYPE\tRESOURCE")
+	for _, finding := range findings {
+		fmt.Fprintf(table, "%s\t%.1f\t%s\t%s\t%s %s\n", finding.Time.Format(time.RFC3339), finding.Severity,
+			finding.ID, finding.Type, finding.ResourceType, finding.ResourceID)
+	}
+	table.Flush()
+}
+
+// runTimeline prints the timeline of one finding
+func runTimeline(args []string) {
+	flags := flag.NewFlagSet("timeline", flag.ExitOnError)
+	region := flags.String("region", "us-east-1", "AWS region of the deployment")
+	findingID := flags.String("finding", "", "Finding to reconstruct (required)")
+	bucket := flags.String("bucket", "", "Evidence bucket the finding's evidence is stored in")
+	stateMachine := flags.String("state-machine", "", "ARN of the IR state machine")
+	function := flags.String("function", "", "Name of the triage Lambda function")
+	lead := flags.Duration("lead", 0, "How long before the first event to read triage logs from, 15m when zero")
+	lag := flags.Duration("lag", 0, "How long after the last event to read triage logs until, 15m when zero")
+	asJSON := flags.Bool("json", false, "Print the timeline as JSON instead of a table")
+	flags.Parse(args)
+
+	if *findingID == "" {
+		fail(fmt.Errorf("-finding is required"))
+	}
+
+	sess, err := newSession(*region)
+	if err != nil {
+		fail(err)
+	}
+
+	target := timeline.Target{Session: sess, EvidenceBucket: *bucket, StateMachineArn: *stateMachine, TriageFunction: *function}
+	reconstructed, err := timeline.Build(target, *findingID, timeline.Options{Lead: *lead, Lag: *lag})
+	if err != nil {
+		fail(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reconstructed); err != nil {
+			fail(err)
+		}
+		return
+	}
+	fmt.Print(reconstructed)
+}
+
+func newSession(region string) (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// query runs the narrowest query the flags ask for and applies the remaining flags to its rows
+func query(evidence *athena.Evidence, minSeverity severity.Score, since time.Duration, resource string) ([]athena.Finding, error) {
+	var findings []athena.Finding
+	var err error
+	switch {
+	case resource != "":
+		findings, err = evidence.FindingsByResource(resource)
+	case since > 0:
+		findings, err = evidence.FindingsBetween(time.Now().Add(-since), time.Now())
+	default:
+		findings, err = evidence.FindingsBySeverity(minSeverity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []athena.Finding
+	for _, finding := range findings {
+		if severity.Compare(severity.FromGuardDuty(finding.Severity), minSeverity) < 0 {
+			continue
+		}
+		if since > 0 && finding.Time.Before(time.Now().Add(-since)) {
+			continue
+		}
+		matched = append(matched, finding)
+	}
+	return matched, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-evidence: %v\n", err)
+	os.Exit(1)
+}
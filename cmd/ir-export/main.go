@@ -0,0 +1,154 @@
+// Command ir-export packages everything a deployment recorded about a finding into a tar.gz for
+// handoff to external forensics or legal: evidence, IR execution histories, a CloudTrail slice, a
+// triage log excerpt and snapshot IDs, with a manifest and SHA-256 checksums. Artifacts that could
+// not be collected are listed on the manifest and on stderr. -verify checks a received bundle
+// against its manifest instead, and -legal-hold places, releases or shows the S3 Object Lock legal
+// hold on the finding's evidence, with an audit record of every change.
+//
+// Exit codes: 0 success, 1 error, 2 the bundle failed verification.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/export"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/legalhold"
+)
+
+func main() {
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	findingID := flag.String("finding", "", "Finding to export (required)")
+	bucket := flag.String("evidence-bucket", "", "Evidence bucket name (terraform output s3_evidence_bucket_name, required)")
+	stateMachineARN := flag.String("state-machine-arn", "", "IR state machine ARN (terraform output stepfn_ir_state_machine_arn)")
+	triageFunction := flag.String("triage-function", "", "Triage Lambda name (terraform output lambda_triage_function_name)")
+	lead := flag.Duration("lead", 0, "How long before triage the CloudTrail slice and log excerpt start (default 1h)")
+	lag := flag.Duration("lag", 0, "How long after the last execution they run on (default 15m)")
+	out := flag.String("out", "", "Bundle to write (default <finding>.tar.gz)")
+	verify := flag.String("verify", "", "Verify this bundle against its manifest and exit")
+	legalHold := flag.String("legal-hold", "", "Instead of exporting, place, release or show (status) the legal hold on the finding's evidence")
+	matter := flag.String("matter", "", "Case or ticket the legal hold is placed or released for (required with -legal-hold place|release)")
+	flag.Parse()
+
+	if *verify != "" {
+		os.Exit(verifyBundle(*verify))
+	}
+
+	if *findingID == "" || *bucket == "" {
+		fail(fmt.Errorf("-finding and -evidence-bucket are required"))
+	}
+	if *out == "" {
+		*out = *findingID + ".tar.gz"
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	if *legalHold != "" {
+		changeLegalHold(sess, *bucket, *findingID, *legalHold, *matter)
+		return
+	}
+
+	bundle, err := export.Collect(export.Target{
+		Session:         sess,
+		EvidenceBucket:  *bucket,
+		StateMachineArn: *stateMachineARN,
+		TriageFunction:  *triageFunction,
+	}, *findingID, export.Options{Lead: *lead, Lag: *lag})
+	if err != nil {
+		fail(err)
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		fail(err)
+	}
+	if err := bundle.Write(file); err != nil {
+		file.Close()
+		fail(err)
+	}
+	if err := file.Close(); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("%s: %d artifacts, %d executions, %d snapshots\n", *out,
+		len(bundle.Manifest.Artifacts), len(bundle.Manifest.Executions), len(bundle.Manifest.Snapshots))
+	for _, gap := range bundle.Manifest.Gaps {
+		fmt.Fprintf(os.Stderr, "ir-export: %s not collected: %s\n", gap.Kind, gap.Reason)
+	}
+}
+
+func changeLegalHold(sess *session.Session, bucket, findingID, action, matter string) {
+	var record *legalhold.Record
+	var err error
+	switch action {
+	case legalhold.ActionPlace:
+		record, err = legalhold.Place(sess, bucket, findingID, matter)
+	case legalhold.ActionRelease:
+		record, err = legalhold.Release(sess, bucket, findingID, matter)
+	case "status":
+	default:
+		err = fmt.Errorf("-legal-hold must be place, release or status, not %q", action)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if record != nil {
+		fmt.Printf("legal hold %sd on %d versions of %s for %s, recorded at s3://%s/%s\n",
+			record.Action, len(record.Versions), findingID, record.Matter, bucket, record.Key)
+		return
+	}
+
+	holds, err := legalhold.Status(sess, bucket, findingID)
+	if err != nil {
+		fail(err)
+	}
+	for _, hold := range holds {
+		status := "off"
+		if hold.On {
+			status = "on"
+		}
+		fmt.Printf("%s@%s: %s\n", hold.Key, hold.VersionID, status)
+	}
+	records, err := legalhold.Records(sess, bucket, findingID)
+	if err != nil {
+		fail(err)
+	}
+	for _, record := range records {
+		fmt.Printf("%s %s %s for %s\n", record.Time.Format(time.RFC3339), record.Actor, record.Action, record.Matter)
+	}
+}
+
+func verifyBundle(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		fail(err)
+	}
+	defer file.Close()
+
+	bundle, err := export.Read(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ir-export: %v\n", err)
+		return 2
+	}
+	fmt.Printf("%s: %s verified, %d artifacts\n", path, bundle.Manifest.FindingID, len(bundle.Manifest.Artifacts))
+	for _, gap := range bundle.Manifest.Gaps {
+		fmt.Printf("  %s not collected: %s\n", gap.Kind, gap.Reason)
+	}
+	return 0
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-export: %v\n", err)
+	os.Exit(1)
+}
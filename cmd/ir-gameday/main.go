@@ -0,0 +1,108 @@
+// Command ir-gameday runs a curated sequence of IR scenarios against a deployed, production-like
+// stack as a game-day exercise. A facilitator paces every step from the console, announcements go
+// to Slack (or stdout), responder acknowledgments are timestamped, and an after-action report is
+// written at the end.
+//
+// Exit codes: 0 every step behaved as expected, 1 error, 2 at least one step failed or was not
+// acknowledged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/gameday"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+func main() {
+	planPath := flag.String("plan", "test/gameday/tabletop.yaml", "Exercise plan")
+	scenarioDir := flag.String("scenarios", "test/scenarios", "Directory the plan's scenarios are loaded from")
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	stateMachineARN := flag.String("state-machine-arn", "", "IR state machine ARN (terraform output stepfn_ir_state_machine_arn)")
+	evidenceBucket := flag.String("evidence-bucket", "", "Evidence bucket name (terraform output s3_evidence_bucket_name)")
+	slackWebhook := flag.String("slack-webhook", os.Getenv("GAMEDAY_SLACK_WEBHOOK"), "Slack incoming webhook for announcements (default: stdout)")
+	reportPath := flag.String("report", "", "Write the after-action report to this file as well as stdout")
+	flag.Parse()
+
+	if *stateMachineARN == "" || *evidenceBucket == "" {
+		fail(fmt.Errorf("-state-machine-arn and -evidence-bucket are required"))
+	}
+
+	plan, scenarios, err := gameday.LoadPlan(*planPath, *scenarioDir)
+	if err != nil {
+		fail(err)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	var announcer gameday.Announcer = gameday.WriterAnnouncer{Out: os.Stdout}
+	if *slackWebhook != "" {
+		announcer = gameday.SlackAnnouncer{WebhookURL: *slackWebhook}
+	}
+
+	runID := "gameday-" + time.Now().UTC().Format("20060102-150405")
+	// Steps expecting isolation name victims, which are torn down once the exercise is over
+	set := victims.New(sess, runID)
+
+	exercise := &gameday.Exercise{
+		Plan:      plan,
+		Scenarios: scenarios,
+		Target: scenario.Target{
+			Session:         sess,
+			StateMachineArn: *stateMachineARN,
+			EvidenceBucket:  *evidenceBucket,
+			Victims:         set,
+		},
+		Announcer: announcer,
+		Console:   os.Stdout,
+		Input:     os.Stdin,
+		RunID:     runID,
+	}
+
+	report, err := exercise.Run()
+	if cleanupErr := set.Cleanup(); cleanupErr != nil {
+		fmt.Fprintf(os.Stderr, "ir-gameday: failed to clean up victims: %v\n", cleanupErr)
+	}
+	if report != nil && len(report.Steps) > 0 {
+		writeReport(report, *reportPath)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	for _, step := range report.Steps {
+		if !step.Passed() || !step.Acknowledged() {
+			os.Exit(2)
+		}
+	}
+}
+
+func writeReport(report *gameday.Report, path string) {
+	markdown := report.Markdown()
+	fmt.Print("\n" + markdown)
+
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, []byte(markdown), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "ir-gameday: failed to write report: %v\n", err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-gameday: %v\n", err)
+	os.Exit(1)
+}
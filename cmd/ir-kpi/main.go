@@ -0,0 +1,57 @@
+// Command ir-kpi reports how the incident KPIs recorded by scenario runs trend over time: per
+// scenario and source, the latest time to evidence, to containment and to notification against the
+// median of the runs before it. The store is named by KPI_TIMESTREAM_DATABASE and
+// KPI_TIMESTREAM_TABLE, or by KPI_S3_BUCKET and KPI_S3_PREFIX, as for the runs that record it.
+//
+// Exit codes: 0 success, 1 error, 2 a KPI is slower than its baseline by more than -max-change.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/kpi"
+)
+
+func main() {
+	region := flag.String("region", "us-east-1", "AWS region of the KPI store")
+	since := flag.Duration("since", 30*24*time.Hour, "Report on the runs from this long ago until now")
+	window := flag.Int("window", 10, "Runs before the latest that make up the baseline")
+	maxChange := flag.Float64("max-change", 0, "Exit 2 when a KPI is this many percent slower than its baseline (0 never fails)")
+	flag.Parse()
+
+	if os.Getenv("KPI_TIMESTREAM_DATABASE") == "" && os.Getenv("KPI_S3_BUCKET") == "" {
+		fail(fmt.Errorf("no KPI store: set KPI_TIMESTREAM_DATABASE and KPI_TIMESTREAM_TABLE, or KPI_S3_BUCKET"))
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	from := time.Now().Add(-*since)
+	samples, err := kpi.FromEnv(sess).Samples(from)
+	if err != nil {
+		fail(err)
+	}
+
+	report := kpi.BuildReport(samples, from, *window)
+	fmt.Print(report)
+
+	if *maxChange > 0 && len(report.Regressions(*maxChange)) > 0 {
+		os.Exit(2)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-kpi: %v\n", err)
+	os.Exit(1)
+}
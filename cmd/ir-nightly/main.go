@@ -0,0 +1,82 @@
+// Command ir-nightly runs the scheduled suite against one deployment as stages: deploy, validate,
+// scenarios, chaos and destroy. Stages are picked with -stages or IR_STAGES (comma-separated, or
+// "all"). Progress and the stack's outputs are checkpointed, so after a failure
+//
+//	ir-nightly -stages scenarios
+//
+// re-runs only the scenario runs that failed against the existing deployment, without re-applying
+// Terraform. A failed run leaves the stack up; destroy it with -stages destroy. The KPIs of passed
+// scenario runs are recorded in the store named by KPI_TIMESTREAM_DATABASE/KPI_TIMESTREAM_TABLE or
+// KPI_S3_BUCKET; see ir-kpi for the report.
+//
+// Exit codes: 0 every selected stage passed, 1 error or failed stage.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/kpi"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/nightly"
+)
+
+func main() {
+	stagesSpec := flag.String("stages", os.Getenv(nightly.StagesEnv), "Stages to run, comma-separated or all (default: $IR_STAGES, else all)")
+	checkpointPath := flag.String("checkpoint", ".ir-nightly/checkpoint.json", "Checkpoint file kept between runs")
+	terraformDir := flag.String("terraform-dir", ".", "Root module to deploy")
+	varFile := flag.String("var-file", "", "Terraform variables file for the nightly stack")
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	scenarioDir := flag.String("scenarios", "test/scenarios", "Directory of YAML scenarios")
+	outage := flag.Duration("chaos-outage", 2*time.Minute, "How long the chaos stage throttles the triage function")
+	slo := flag.Duration("chaos-slo", 15*time.Minute, "Time allowed for the pipeline to recover a finding after the outage")
+	retainLogGroups := flag.Bool("retain-log-groups", false, "The stack sets retain_log_groups, so destroy must keep its log groups")
+	redeploy := flag.Bool("redeploy", false, "Apply Terraform even when the checkpoint already holds a deployment")
+	flag.Parse()
+
+	stages, err := nightly.ParseStages(*stagesSpec)
+	if err != nil {
+		fail(err)
+	}
+
+	checkpoint, err := nightly.LoadCheckpoint(*checkpointPath, "nightly-"+time.Now().UTC().Format("20060102-150405"))
+	if err != nil {
+		fail(err)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	tf := nightly.Terraform{Dir: *terraformDir, VarFile: *varFile}
+	runner := &nightly.Runner{
+		Checkpoint: checkpoint,
+		Path:       *checkpointPath,
+		Stages: map[nightly.Stage]nightly.StageFunc{
+			nightly.Deploy:    nightly.DeployStage(tf),
+			nightly.Validate:  nightly.ValidateStage(sess),
+			nightly.Scenarios: nightly.ScenariosStage(sess, *scenarioDir, kpi.FromEnv(sess), os.Stdout),
+			nightly.Chaos:     nightly.ChaosStage(sess, *outage, *slo),
+			nightly.Destroy:   nightly.DestroyStage(tf, sess, *retainLogGroups),
+		},
+		Redeploy: *redeploy,
+		Log:      os.Stdout,
+	}
+
+	if err := runner.Run(stages); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-nightly: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,81 @@
+// Command ir-preflight plans a threat-detection-ir workspace and simulates the API calls the
+// deployment and the running pipeline will make against the target account's IAM policies,
+// permissions boundary and SCPs, reporting which calls would be blocked before anything is deployed.
+// The workspace must already be initialized.
+//
+// Exit codes: 0 nothing blocked, 1 error, 2 blocked by an SCP or permissions boundary,
+// 3 blocked by the deploying principal's identity policies only.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tfplan"
+)
+
+type varFiles []string
+
+func (v *varFiles) String() string     { return strings.Join(*v, ",") }
+func (v *varFiles) Set(s string) error { *v = append(*v, s); return nil }
+
+func main() {
+	dir := flag.String("dir", ".", "Terraform workspace directory of the stack")
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	principal := flag.String("principal", "", "IAM role or user ARN that will deploy the stack (default: the caller)")
+	var files varFiles
+	flag.Var(&files, "var-file", "Terraform var file for the deployment (repeatable)")
+	flag.Parse()
+
+	var args []string
+	for _, file := range files {
+		args = append(args, "-var-file="+file)
+	}
+
+	plan, _, err := tfplan.Run(*dir, args...)
+	if err != nil {
+		fail(err)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	principalARN := *principal
+	if principalARN == "" {
+		if principalARN, err = helpers.CallerPrincipalARN(sess); err != nil {
+			fail(err)
+		}
+	}
+
+	calls, unmapped := helpers.PlannedCalls(plan)
+	calls = append(calls, helpers.PipelineRuntimeCalls...)
+
+	report, err := helpers.RunPreflight(sess, principalARN, calls, unmapped)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Print(report)
+
+	switch {
+	case report.BlockedByGuardrails():
+		os.Exit(2)
+	case len(report.Blocked) > 0:
+		os.Exit(3)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-preflight: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+// Command ir-victims keeps victim resources from outliving the tests and game days that created
+// them. By default it removes the victims in a region whose TTL has passed; run it on a schedule.
+// -kill engages the account-wide kill switch, so no further victims can be provisioned, and removes
+// every victim at once; -release lifts the switch again.
+//
+// Exit codes: 0 success, 1 error.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+func main() {
+	region := flag.String("region", "us-east-1", "AWS region to reap victims in")
+	kill := flag.Bool("kill", false, "Engage the kill switch and remove every victim regardless of TTL")
+	release := flag.Bool("release", false, "Release the kill switch and exit")
+	flag.Parse()
+
+	if *kill && *release {
+		fail(fmt.Errorf("-kill and -release are mutually exclusive"))
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(*region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	if *release {
+		if err := victims.SetKillSwitch(sess, false); err != nil {
+			fail(err)
+		}
+		fmt.Printf("kill switch %s released\n", victims.KillSwitchParameter)
+		return
+	}
+
+	if *kill {
+		if err := victims.SetKillSwitch(sess, true); err != nil {
+			fail(err)
+		}
+		fmt.Printf("kill switch %s engaged\n", victims.KillSwitchParameter)
+	}
+
+	removed, err := victims.Reap(sess, *kill)
+	for _, victim := range removed {
+		fmt.Printf("removed %s\n", victim)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ir-victims: %v\n", err)
+	os.Exit(1)
+}
@@ -2,32 +2,53 @@
 module "iam_roles" {
   source = "./modules/iam_roles"
 
-  tags = var.tags
+  evidence_bucket_arn     = module.s3_evidence.bucket_arn
+  evidence_kms_key_arn    = module.s3_evidence.kms_key_arn
+  integration_secret_arns = values(var.integration_secret_arns)
+  name_prefix             = var.name_prefix
+  tags                    = var.tags
 }
 
 # S3 Evidence bucket
 module "s3_evidence" {
   source = "./modules/s3_evidence"
 
-  bucket_name = var.evidence_bucket_name
-  kms_alias   = var.kms_alias
-  tags        = var.tags
+  bucket_name                  = var.evidence_bucket_name
+  kms_alias                    = var.kms_alias
+  retention_days               = var.evidence_retention_days
+  glacier_transition_days      = var.evidence_glacier_transition_days
+  deep_archive_transition_days = var.evidence_deep_archive_transition_days
+  object_lock_enabled          = var.evidence_object_lock_enabled
+  retention_matrix             = var.evidence_retention_matrix
+  restricted_reader_arns       = var.pii_raw_reader_arns
+  replica_bucket_arn           = var.evidence_replica_bucket_arn
+  replica_kms_key_arn          = var.evidence_replica_kms_key_arn
+  name_prefix                  = var.name_prefix
+  tags                         = var.tags
 }
 
 # SNS Alerts topic
 module "sns_alerts" {
   source = "./modules/sns_alerts"
 
-  subscriptions = var.sns_subscriptions
-  tags          = var.tags
+  subscriptions        = var.sns_subscriptions
+  urgent_subscriptions = var.sns_urgent_subscriptions
+  ops_subscriptions    = var.sns_ops_subscriptions
+  publisher_role_arns  = [module.iam_roles.lambda_role_arn, module.iam_roles.stepfn_role_arn]
+  name_prefix          = var.name_prefix
+  tags                 = var.tags
 }
 
 # Network Quarantine security group
 module "network_quarantine" {
   source = "./modules/network_quarantine"
 
-  sg_name = var.quarantine_sg_name
-  tags    = var.tags
+  sg_name                 = var.quarantine_sg_name
+  vpc_id                  = var.quarantine_vpc_id
+  additional_vpc_ids      = var.quarantine_additional_vpc_ids
+  create_quarantine_nacls = var.isolation_strategy == "NACL-based"
+  allow_ssm_endpoints     = var.quarantine_allow_ssm_endpoints
+  tags                    = var.tags
 }
 
 # GuardDuty setup
@@ -52,40 +73,95 @@ module "securityhub" {
 module "cloudwatch" {
   source = "./modules/cloudwatch"
 
-  tags = var.tags
+  lambda_function_name = module.lambda_triage.function_name
+  state_machine_arn    = module.stepfn_ir.state_machine_arn
+  dlq_name             = module.eventbridge.dlq_name
+  deferred_dlq_name    = module.lambda_triage.deferred_dlq_name
+  remediation_dlq_name = module.stepfn_ir.remediation_dlq_name
+  buffer_dlq_name      = module.lambda_triage.buffer_dlq_name
+  alarm_actions        = [module.sns_alerts.ops_topic_arn]
+  retain_log_groups    = var.retain_log_groups
+  name_prefix          = var.name_prefix
+  tags                 = var.tags
 }
 
 # Lambda Triage function
 module "lambda_triage" {
   source = "./modules/lambda_triage"
 
-  evidence_bucket_name     = module.s3_evidence.bucket_name
-  sns_topic_arn            = module.sns_alerts.topic_arn
-  state_machine_arn        = module.stepfn_ir.state_machine_arn
-  quarantine_sg_id         = module.network_quarantine.quarantine_sg_id
-  iam_role_arn             = module.iam_roles.lambda_role_arn
-  cloudwatch_log_group_arn = module.cloudwatch.lambda_log_group_arn
-  tags                     = var.tags
+  evidence_bucket_name         = module.s3_evidence.bucket_name
+  evidence_kms_key_arn         = module.s3_evidence.kms_key_arn
+  sns_topic_arn                = module.sns_alerts.topic_arn
+  urgent_sns_topic_arn         = module.sns_alerts.urgent_topic_arn
+  state_machine_arn            = module.stepfn_ir.state_machine_arn
+  quarantine_sg_id             = module.network_quarantine.quarantine_sg_id
+  iam_role_arn                 = module.iam_roles.lambda_role_arn
+  cloudwatch_log_group_arn     = module.cloudwatch.lambda_log_group_arn
+  memory_size                  = var.lambda_memory_size
+  reserved_concurrency         = var.lambda_reserved_concurrency
+  code_signing_config_arn      = var.lambda_code_signing_config_arn
+  dedup_window_minutes         = var.finding_dedup_window_minutes
+  exemption_tag                = var.isolation_exemption_tag
+  drain_interval_minutes       = var.deferred_drain_interval_minutes
+  integration_secret_arns      = var.integration_secret_arns
+  enable_flow_logs             = var.enable_quarantine_flow_logs
+  flow_logs_log_group_name     = module.cloudwatch.quarantine_flow_logs_log_group_name
+  flow_logs_role_arn           = module.iam_roles.flow_logs_role_arn
+  enable_sqs_buffer            = var.enable_sqs_buffer
+  buffer_batch_size            = var.sqs_buffer_batch_size
+  enable_incident_index        = var.enable_incident_index
+  recurrence_window_minutes    = var.recurrence_escalation_window_minutes
+  account_classification       = var.account_classification
+  use_fips_endpoints           = var.use_fips_endpoints
+  threat_intel_endpoint        = var.threat_intel_endpoint
+  threat_intel_provider        = var.threat_intel_provider
+  threat_intel_timeout_seconds = var.threat_intel_timeout_seconds
+  data_classifications         = keys(var.evidence_retention_matrix)
+  data_classification_tag      = var.data_classification_tag
+  pii_scrub_fields             = var.pii_scrubbing_enabled ? var.pii_scrub_fields : []
+  name_prefix                  = var.name_prefix
+  tags                         = var.tags
 }
 
 # Step Functions IR state machine
 module "stepfn_ir" {
   source = "./modules/stepfn_ir"
 
-  evidence_bucket_name     = module.s3_evidence.bucket_name
-  sns_topic_arn            = module.sns_alerts.topic_arn
-  quarantine_sg_id         = module.network_quarantine.quarantine_sg_id
-  iam_role_arn             = module.iam_roles.stepfn_role_arn
-  cloudwatch_log_group_arn = module.cloudwatch.stepfn_log_group_arn
-  tags                     = var.tags
+  evidence_bucket_name         = module.s3_evidence.bucket_name
+  sns_topic_arn                = module.sns_alerts.topic_arn
+  quarantine_sg_id             = module.network_quarantine.quarantine_sg_id
+  additional_quarantine_sg_ids = module.network_quarantine.additional_quarantine_sg_ids
+  isolation_strategy           = var.isolation_strategy
+  quarantine_nacl_ids          = module.network_quarantine.quarantine_nacl_ids
+  iam_role_arn                 = module.iam_roles.stepfn_role_arn
+  cloudwatch_log_group_arn     = module.cloudwatch.stepfn_log_group_arn
+  name_prefix                  = var.name_prefix
+  tags                         = var.tags
 }
 
 # EventBridge rules
 module "eventbridge" {
   source = "./modules/eventbridge"
 
-  lambda_function_arn        = module.lambda_triage.function_arn
-  state_machine_arn          = module.stepfn_ir.state_machine_arn
-  finding_severity_threshold = var.finding_severity_threshold
-  tags                       = var.tags
+  lambda_function_arn                = module.lambda_triage.function_arn
+  state_machine_arn                  = module.stepfn_ir.state_machine_arn
+  finding_severity_threshold         = var.finding_severity_threshold
+  enable_securityhub_custom_findings = var.enable_securityhub_custom_findings
+  enable_canary_findings             = var.enable_canary_findings
+  enable_sqs_buffer                  = var.enable_sqs_buffer
+  buffer_queue_arn                   = module.lambda_triage.buffer_queue_arn
+  buffer_queue_url                   = module.lambda_triage.buffer_queue_url
+  name_prefix                        = var.name_prefix
+  tags                               = var.tags
+}
+
+# Firehose export of findings to an analytics bucket
+module "finding_export" {
+  source = "./modules/finding_export"
+  count  = var.enable_finding_export ? 1 : 0
+
+  bucket_name = "${var.evidence_bucket_name}-analytics"
+  format      = var.finding_export_format
+  name_prefix = var.name_prefix
+  tags        = var.tags
 }
\ No newline at end of file
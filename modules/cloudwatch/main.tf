@@ -1,13 +1,165 @@
-# CloudWatch Log Group for Lambda Triage
+data "aws_region" "current" {}
+
+# CloudWatch Log Group for Lambda Triage. The name must match the function's, or Lambda creates an
+# unmanaged group on first invocation that outlives the stack.
 resource "aws_cloudwatch_log_group" "lambda_triage" {
-  name              = "/aws/lambda/triage"
+  name              = "/aws/lambda/${var.name_prefix}guardduty-triage"
   retention_in_days = 90
+  skip_destroy      = var.retain_log_groups
   tags              = var.tags
 }
 
 # CloudWatch Log Group for Step Functions IR
 resource "aws_cloudwatch_log_group" "stepfn_ir" {
-  name              = "/aws/states/stepfn-ir"
+  name              = "/aws/states/${var.name_prefix}stepfn-ir"
+  retention_in_days = 90
+  skip_destroy      = var.retain_log_groups
+  tags              = var.tags
+}
+
+# CloudWatch Log Group for flow logs enabled on quarantined instances
+resource "aws_cloudwatch_log_group" "quarantine_flow_logs" {
+  name              = "/aws/vpc/${var.name_prefix}quarantine-flow-logs"
   retention_in_days = 90
+  skip_destroy      = var.retain_log_groups
   tags              = var.tags
-}
\ No newline at end of file
+}
+
+# Alarms on the metrics that show the pipeline is failing to respond to findings. Every alarm treats
+# missing data as healthy, since an idle pipeline publishes nothing.
+locals {
+  alarms = {
+    lambda-errors = {
+      description = "Triage invocations failed"
+      namespace   = "AWS/Lambda"
+      metric_name = "Errors"
+      statistic   = "Sum"
+      dimensions  = { FunctionName = var.lambda_function_name }
+    }
+    lambda-throttles = {
+      description = "Triage invocations were throttled"
+      namespace   = "AWS/Lambda"
+      metric_name = "Throttles"
+      statistic   = "Sum"
+      dimensions  = { FunctionName = var.lambda_function_name }
+    }
+    stepfn-failures = {
+      description = "IR state machine executions failed"
+      namespace   = "AWS/States"
+      metric_name = "ExecutionsFailed"
+      statistic   = "Sum"
+      dimensions  = { StateMachineArn = var.state_machine_arn }
+    }
+    dlq-depth = {
+      description = "Findings EventBridge could not deliver are waiting in the dead-letter queue"
+      namespace   = "AWS/SQS"
+      metric_name = "ApproximateNumberOfMessagesVisible"
+      statistic   = "Maximum"
+      dimensions  = { QueueName = var.dlq_name }
+    }
+    deferred-dlq-depth = {
+      description = "Findings deferred during a containment pause repeatedly failed triage"
+      namespace   = "AWS/SQS"
+      metric_name = "ApproximateNumberOfMessagesVisible"
+      statistic   = "Maximum"
+      dimensions  = { QueueName = var.deferred_dlq_name }
+    }
+    remediation-dlq-depth = {
+      description = "Findings whose containment partially failed are waiting for manual remediation"
+      namespace   = "AWS/SQS"
+      metric_name = "ApproximateNumberOfMessagesVisible"
+      statistic   = "Maximum"
+      dimensions  = { QueueName = var.remediation_dlq_name }
+    }
+    evidence-write-errors = {
+      description = "Triage failed to write finding evidence to S3"
+      namespace   = "ThreatDetectionIR"
+      metric_name = "EvidenceWriteErrors"
+      statistic   = "Sum"
+      dimensions  = { FunctionName = var.lambda_function_name }
+    }
+    unresolved-resources = {
+      description = "Findings named a resource type triage cannot resolve, so nothing was contained"
+      namespace   = "ThreatDetectionIR"
+      metric_name = "UnresolvedResources"
+      statistic   = "Sum"
+      dimensions  = { FunctionName = var.lambda_function_name }
+    }
+  }
+
+  # The buffer only exists with enable_sqs_buffer
+  buffer_alarms = var.buffer_dlq_name == "" ? {} : {
+    buffer-dlq-depth = {
+      description = "Buffered findings repeatedly failed triage"
+      namespace   = "AWS/SQS"
+      metric_name = "ApproximateNumberOfMessagesVisible"
+      statistic   = "Maximum"
+      dimensions  = { QueueName = var.buffer_dlq_name }
+    }
+  }
+
+  all_alarms = merge(local.alarms, local.buffer_alarms)
+}
+
+resource "aws_cloudwatch_metric_alarm" "pipeline" {
+  for_each = local.all_alarms
+
+  alarm_name          = "${var.name_prefix}ir-${each.key}"
+  alarm_description   = each.value.description
+  namespace           = each.value.namespace
+  metric_name         = each.value.metric_name
+  statistic           = each.value.statistic
+  dimensions          = each.value.dimensions
+  period              = 300
+  evaluation_periods  = 1
+  threshold           = 1
+  comparison_operator = "GreaterThanOrEqualToThreshold"
+  treat_missing_data  = "notBreaching"
+  alarm_actions       = var.alarm_actions
+
+  tags = var.tags
+}
+
+# Operations dashboard showing the alarmed metrics side by side with triage volume
+resource "aws_cloudwatch_dashboard" "operations" {
+  dashboard_name = "${var.name_prefix}ir-operations"
+
+  dashboard_body = jsonencode({
+    widgets = concat(
+      [
+        {
+          type   = "metric"
+          width  = 12
+          height = 6
+          properties = {
+            title  = "Triage invocations"
+            region = data.aws_region.current.name
+            stat   = "Sum"
+            period = 300
+            metrics = [
+              ["AWS/Lambda", "Invocations", "FunctionName", var.lambda_function_name],
+              ["AWS/Lambda", "Duration", "FunctionName", var.lambda_function_name, { stat = "p99", yAxis = "right" }]
+            ]
+          }
+        }
+      ],
+      [
+        for name, alarm in local.all_alarms : {
+          type   = "metric"
+          width  = 12
+          height = 6
+          properties = {
+            title   = alarm.description
+            region  = data.aws_region.current.name
+            stat    = alarm.statistic
+            period  = 300
+            metrics = [concat([alarm.namespace, alarm.metric_name], flatten([for key, value in alarm.dimensions : [key, value]]))]
+            annotations = {
+              alarms = [aws_cloudwatch_metric_alarm.pipeline[name].arn]
+            }
+          }
+        }
+      ]
+    )
+  })
+}
@@ -6,4 +6,34 @@ output "lambda_log_group_arn" {
 output "stepfn_log_group_arn" {
   description = "ARN of the CloudWatch log group for Step Functions IR"
   value       = aws_cloudwatch_log_group.stepfn_ir.arn
-}
\ No newline at end of file
+}
+
+output "lambda_log_group_name" {
+  description = "Name of the CloudWatch log group for Lambda triage"
+  value       = aws_cloudwatch_log_group.lambda_triage.name
+}
+
+output "stepfn_log_group_name" {
+  description = "Name of the CloudWatch log group for Step Functions IR"
+  value       = aws_cloudwatch_log_group.stepfn_ir.name
+}
+
+output "quarantine_flow_logs_log_group_arn" {
+  description = "ARN of the CloudWatch log group for quarantine flow logs"
+  value       = aws_cloudwatch_log_group.quarantine_flow_logs.arn
+}
+
+output "quarantine_flow_logs_log_group_name" {
+  description = "Name of the CloudWatch log group for quarantine flow logs"
+  value       = aws_cloudwatch_log_group.quarantine_flow_logs.name
+}
+
+output "alarm_names" {
+  description = "Names of the pipeline alarms"
+  value       = [for alarm in aws_cloudwatch_metric_alarm.pipeline : alarm.alarm_name]
+}
+
+output "dashboard_name" {
+  description = "Name of the operations dashboard"
+  value       = aws_cloudwatch_dashboard.operations.dashboard_name
+}
@@ -1,3 +1,52 @@
+variable "lambda_function_name" {
+  description = "Name of the Lambda triage function to alarm on"
+  type        = string
+}
+
+variable "state_machine_arn" {
+  description = "ARN of the IR state machine to alarm on"
+  type        = string
+}
+
+variable "dlq_name" {
+  description = "Name of the EventBridge dead-letter queue to alarm on"
+  type        = string
+}
+
+variable "deferred_dlq_name" {
+  description = "Name of the dead-letter queue for deferred findings to alarm on"
+  type        = string
+}
+
+variable "remediation_dlq_name" {
+  description = "Name of the remediation queue for partially contained findings to alarm on"
+  type        = string
+}
+
+variable "buffer_dlq_name" {
+  description = "Name of the SQS buffer's dead-letter queue to alarm on (empty without the buffer)"
+  type        = string
+  default     = ""
+}
+
+variable "alarm_actions" {
+  description = "ARNs notified when a pipeline alarm fires, e.g. the ops SNS topic"
+  type        = list(string)
+  default     = []
+}
+
+variable "retain_log_groups" {
+  description = "Keep the log groups when the stack is destroyed, e.g. to preserve an investigation's logs"
+  type        = bool
+  default     = false
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for CloudWatch resources"
   type        = map(string)
@@ -5,11 +5,25 @@ locals {
     "HIGH"     = 7
     "CRITICAL" = 9
   }
+
+  # Security Hub labels at or above the threshold
+  severity_labels = ["LOW", "MEDIUM", "HIGH", "CRITICAL"]
+  labels_at_or_above_threshold = slice(
+    local.severity_labels,
+    index(local.severity_labels, var.finding_severity_threshold),
+    length(local.severity_labels)
+  )
+
+  # With the SQS buffer, findings for triage go to the queue and the function polls it
+  triage_target_arn = var.enable_sqs_buffer ? var.buffer_queue_arn : var.lambda_function_arn
+
+  # Event source ir-canary publishes its synthetic findings under
+  canary_source = "ir.canary"
 }
 
 # Dead-letter queue for failed events
 resource "aws_sqs_queue" "dlq" {
-  name = "guardduty-finding-dlq"
+  name = "${var.name_prefix}guardduty-finding-dlq"
 
   # Enable server-side encryption
   sqs_managed_sse_enabled = true
@@ -19,7 +33,7 @@ resource "aws_sqs_queue" "dlq" {
 
 # EventBridge rule for GuardDuty findings
 resource "aws_cloudwatch_event_rule" "guardduty_findings" {
-  name        = "guardduty-finding-rule"
+  name        = "${var.name_prefix}guardduty-finding-rule"
   description = "Rule for GuardDuty findings above severity threshold"
 
   event_pattern = jsonencode({
@@ -33,10 +47,10 @@ resource "aws_cloudwatch_event_rule" "guardduty_findings" {
   tags = var.tags
 }
 
-# Target: Lambda triage function
+# Target: Lambda triage function, or the SQS buffer in front of it
 resource "aws_cloudwatch_event_target" "lambda_triage" {
   rule = aws_cloudwatch_event_rule.guardduty_findings.name
-  arn  = var.lambda_function_arn
+  arn  = local.triage_target_arn
 
   dead_letter_config {
     arn = aws_sqs_queue.dlq.arn
@@ -62,9 +76,133 @@ resource "aws_lambda_permission" "eventbridge_invoke" {
   source_arn    = aws_cloudwatch_event_rule.guardduty_findings.arn
 }
 
+# EventBridge rule for custom findings imported into Security Hub by partners or custom detectors.
+# GuardDuty findings are excluded since they already arrive through the GuardDuty rule.
+resource "aws_cloudwatch_event_rule" "securityhub_custom_findings" {
+  count = var.enable_securityhub_custom_findings ? 1 : 0
+
+  name        = "${var.name_prefix}securityhub-custom-finding-rule"
+  description = "Rule for custom Security Hub findings above severity threshold"
+
+  event_pattern = jsonencode({
+    source      = ["aws.securityhub"]
+    detail-type = ["Security Hub Findings - Imported"]
+    detail = {
+      findings = {
+        ProductName = [{ "anything-but" : "GuardDuty" }]
+        Severity = {
+          Label = local.labels_at_or_above_threshold
+        }
+        # Updating a finding's workflow status re-imports it; closed findings are not responded to again
+        Workflow = {
+          Status = ["NEW", "NOTIFIED"]
+        }
+      }
+    }
+  })
+
+  tags = var.tags
+}
+
+# Target: Lambda triage function, which normalizes ASFF and starts the IR state machine
+resource "aws_cloudwatch_event_target" "securityhub_lambda_triage" {
+  count = var.enable_securityhub_custom_findings ? 1 : 0
+
+  rule = aws_cloudwatch_event_rule.securityhub_custom_findings[0].name
+  arn  = local.triage_target_arn
+
+  dead_letter_config {
+    arn = aws_sqs_queue.dlq.arn
+  }
+}
+
+resource "aws_lambda_permission" "securityhub_invoke" {
+  count = var.enable_securityhub_custom_findings ? 1 : 0
+
+  statement_id  = "AllowEventBridgeInvokeSecurityHub"
+  action        = "lambda:InvokeFunction"
+  function_name = var.lambda_function_arn
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.securityhub_custom_findings[0].arn
+}
+
+# EventBridge rule for synthetic findings injected by ir-canary. PutEvents refuses aws.* sources, so
+# the canary publishes under its own source, and only findings marked as canary are matched.
+resource "aws_cloudwatch_event_rule" "canary_findings" {
+  count = var.enable_canary_findings ? 1 : 0
+
+  name        = "${var.name_prefix}ir-canary-finding-rule"
+  description = "Rule for ir-canary synthetic findings above severity threshold"
+
+  event_pattern = jsonencode({
+    source      = [local.canary_source]
+    detail-type = ["GuardDuty Finding"]
+    detail = {
+      severity = [{ "numeric": [">=", local.severity_numeric[var.finding_severity_threshold]] }]
+      details = {
+        canary = [true]
+      }
+    }
+  })
+
+  tags = var.tags
+}
+
+# Target: Lambda triage function, or the SQS buffer in front of it, as for GuardDuty findings
+resource "aws_cloudwatch_event_target" "canary_lambda_triage" {
+  count = var.enable_canary_findings ? 1 : 0
+
+  rule = aws_cloudwatch_event_rule.canary_findings[0].name
+  arn  = local.triage_target_arn
+
+  dead_letter_config {
+    arn = aws_sqs_queue.dlq.arn
+  }
+}
+
+resource "aws_lambda_permission" "canary_invoke" {
+  count = var.enable_canary_findings ? 1 : 0
+
+  statement_id  = "AllowEventBridgeInvokeCanary"
+  action        = "lambda:InvokeFunction"
+  function_name = var.lambda_function_arn
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.canary_findings[0].arn
+}
+
+# Permission for EventBridge to send findings to the SQS buffer
+resource "aws_sqs_queue_policy" "buffer" {
+  count = var.enable_sqs_buffer ? 1 : 0
+
+  queue_url = var.buffer_queue_url
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Principal = {
+          Service = "events.amazonaws.com"
+        }
+        Action   = "sqs:SendMessage"
+        Resource = var.buffer_queue_arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = concat(
+              [aws_cloudwatch_event_rule.guardduty_findings.arn],
+              aws_cloudwatch_event_rule.securityhub_custom_findings[*].arn,
+              aws_cloudwatch_event_rule.canary_findings[*].arn
+            )
+          }
+        }
+      }
+    ]
+  })
+}
+
 # Permission for EventBridge to start Step Functions execution
 resource "aws_iam_role_policy" "eventbridge_stepfn" {
-  name = "eventbridge-stepfn-policy"
+  name = "${var.name_prefix}eventbridge-stepfn-policy"
   role = aws_iam_role.eventbridge_stepfn.id
 
   policy = jsonencode({
@@ -80,7 +218,7 @@ resource "aws_iam_role_policy" "eventbridge_stepfn" {
 }
 
 resource "aws_iam_role" "eventbridge_stepfn" {
-  name = "eventbridge-stepfn-role"
+  name = "${var.name_prefix}eventbridge-stepfn-role"
 
   assume_role_policy = jsonencode({
     Version = "2012-10-17"
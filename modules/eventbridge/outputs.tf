@@ -1,9 +1,23 @@
 output "rule_names" {
   description = "List of EventBridge rule names"
-  value       = [aws_cloudwatch_event_rule.guardduty_findings.name]
+  value = concat(
+    [aws_cloudwatch_event_rule.guardduty_findings.name],
+    aws_cloudwatch_event_rule.securityhub_custom_findings[*].name,
+    aws_cloudwatch_event_rule.canary_findings[*].name
+  )
 }
 
 output "target_arns" {
   description = "List of target ARNs"
   value       = [var.lambda_function_arn, var.state_machine_arn]
-}
\ No newline at end of file
+}
+
+output "dlq_url" {
+  description = "URL of the dead-letter queue for failed events"
+  value       = aws_sqs_queue.dlq.url
+}
+
+output "dlq_name" {
+  description = "Name of the dead-letter queue for failed events"
+  value       = aws_sqs_queue.dlq.name
+}
@@ -13,6 +13,42 @@ variable "finding_severity_threshold" {
   type        = string
 }
 
+variable "enable_securityhub_custom_findings" {
+  description = "Route custom (non-GuardDuty) Security Hub findings above the threshold into the IR pipeline"
+  type        = bool
+  default     = true
+}
+
+variable "enable_canary_findings" {
+  description = "Route synthetic findings published by ir-canary under the ir.canary source into triage"
+  type        = bool
+  default     = false
+}
+
+variable "enable_sqs_buffer" {
+  description = "Send findings for triage to the SQS buffer instead of invoking the Lambda function directly"
+  type        = bool
+  default     = false
+}
+
+variable "buffer_queue_arn" {
+  description = "ARN of the SQS buffer in front of the Lambda triage function (required with enable_sqs_buffer)"
+  type        = string
+  default     = ""
+}
+
+variable "buffer_queue_url" {
+  description = "URL of the SQS buffer in front of the Lambda triage function (required with enable_sqs_buffer)"
+  type        = string
+  default     = ""
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for EventBridge resources"
   type        = map(string)
@@ -0,0 +1,396 @@
+data "aws_caller_identity" "current" {}
+
+data "aws_region" "current" {}
+
+data "aws_partition" "current" {}
+
+locals {
+  # Glue and Athena names may not contain hyphens
+  glue_database_name = replace("${var.name_prefix}ir_findings", "-", "_")
+
+  partition_path = "!{timestamp:yyyy}/!{timestamp:MM}/!{timestamp:dd}/!{timestamp:HH}/"
+
+  # Table formats Firehose can deliver; Parquet is converted from JSON using the table schema
+  storage_formats = {
+    JSON = {
+      input_format  = "org.apache.hadoop.mapred.TextInputFormat"
+      output_format = "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat"
+      serde         = "org.openx.data.jsonserde.JsonSerDe"
+    }
+    PARQUET = {
+      input_format  = "org.apache.hadoop.hive.ql.io.parquet.MapredParquetInputFormat"
+      output_format = "org.apache.hadoop.hive.ql.io.parquet.MapredParquetOutputFormat"
+      serde         = "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe"
+    }
+  }
+}
+
+# Analytics bucket receiving every GuardDuty finding, partitioned by delivery hour
+resource "aws_s3_bucket" "analytics" {
+  bucket = var.bucket_name
+  tags   = var.tags
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "analytics" {
+  bucket = aws_s3_bucket.analytics.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "aws:kms"
+    }
+  }
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "analytics" {
+  bucket = aws_s3_bucket.analytics.id
+
+  rule {
+    id     = "export-retention"
+    status = "Enabled"
+
+    filter {}
+
+    expiration {
+      days = var.retention_days
+    }
+  }
+}
+
+resource "aws_s3_bucket_policy" "analytics" {
+  bucket = aws_s3_bucket.analytics.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Sid       = "DenyInsecureTransport"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = "s3:*"
+        Resource = [
+          aws_s3_bucket.analytics.arn,
+          "${aws_s3_bucket.analytics.arn}/*"
+        ]
+        Condition = {
+          Bool = {
+            "aws:SecureTransport" = "false"
+          }
+        }
+      },
+      {
+        Sid       = "DenyOutdatedTLS"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = "s3:*"
+        Resource = [
+          aws_s3_bucket.analytics.arn,
+          "${aws_s3_bucket.analytics.arn}/*"
+        ]
+        Condition = {
+          NumericLessThan = {
+            "s3:TlsVersion" = "1.2"
+          }
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_s3_bucket_ownership_controls" "analytics" {
+  bucket = aws_s3_bucket.analytics.id
+
+  rule {
+    object_ownership = "BucketOwnerEnforced"
+  }
+}
+
+# Public access block for analytics bucket
+resource "aws_s3_bucket_public_access_block" "analytics" {
+  bucket = aws_s3_bucket.analytics.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_glue_catalog_database" "findings" {
+  name        = local.glue_database_name
+  description = "GuardDuty findings exported by Firehose"
+}
+
+# Partition projection lets Athena query new hours without a crawler or MSCK REPAIR
+resource "aws_glue_catalog_table" "findings" {
+  name          = "findings"
+  database_name = aws_glue_catalog_database.findings.name
+  table_type    = "EXTERNAL_TABLE"
+
+  parameters = {
+    "classification"            = lower(var.format)
+    "projection.enabled"        = "true"
+    "projection.year.type"      = "integer"
+    "projection.year.range"     = "2024,2099"
+    "projection.month.type"     = "integer"
+    "projection.month.range"    = "1,12"
+    "projection.month.digits"   = "2"
+    "projection.day.type"       = "integer"
+    "projection.day.range"      = "1,31"
+    "projection.day.digits"     = "2"
+    "projection.hour.type"      = "integer"
+    "projection.hour.range"     = "0,23"
+    "projection.hour.digits"    = "2"
+    "storage.location.template" = "s3://${aws_s3_bucket.analytics.bucket}/findings/$${year}/$${month}/$${day}/$${hour}/"
+  }
+
+  partition_keys {
+    name = "year"
+    type = "string"
+  }
+
+  partition_keys {
+    name = "month"
+    type = "string"
+  }
+
+  partition_keys {
+    name = "day"
+    type = "string"
+  }
+
+  partition_keys {
+    name = "hour"
+    type = "string"
+  }
+
+  storage_descriptor {
+    location      = "s3://${aws_s3_bucket.analytics.bucket}/findings/"
+    input_format  = local.storage_formats[var.format].input_format
+    output_format = local.storage_formats[var.format].output_format
+
+    ser_de_info {
+      serialization_library = local.storage_formats[var.format].serde
+    }
+
+    # The EventBridge envelope; detail holds the GuardDuty finding
+    columns {
+      name = "id"
+      type = "string"
+    }
+
+    columns {
+      name = "account"
+      type = "string"
+    }
+
+    columns {
+      name = "region"
+      type = "string"
+    }
+
+    columns {
+      name = "time"
+      type = "string"
+    }
+
+    columns {
+      name = "detail"
+      type = "struct<id:string,arn:string,type:string,severity:double,title:string,accountid:string,resource:struct<resourcetype:string>>"
+    }
+  }
+}
+
+resource "aws_kinesis_firehose_delivery_stream" "findings" {
+  name        = "${var.name_prefix}ir-finding-export"
+  destination = "extended_s3"
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  extended_s3_configuration {
+    role_arn            = aws_iam_role.firehose.arn
+    bucket_arn          = aws_s3_bucket.analytics.arn
+    prefix              = "findings/${local.partition_path}"
+    error_output_prefix = "errors/!{firehose:error-output-type}/${local.partition_path}"
+
+    # Parquet conversion needs a buffer of at least 64 MiB
+    buffering_size     = 64
+    buffering_interval = var.buffer_interval_seconds
+
+    # EventBridge delivers events without a separator, which the JSON SerDe needs between records
+    processing_configuration {
+      enabled = var.format == "JSON"
+
+      processors {
+        type = "AppendDelimiterToRecord"
+      }
+    }
+
+    dynamic "data_format_conversion_configuration" {
+      for_each = var.format == "PARQUET" ? [1] : []
+
+      content {
+        input_format_configuration {
+          deserializer {
+            open_x_json_ser_de {}
+          }
+        }
+
+        output_format_configuration {
+          serializer {
+            parquet_ser_de {}
+          }
+        }
+
+        schema_configuration {
+          database_name = aws_glue_catalog_table.findings.database_name
+          table_name    = aws_glue_catalog_table.findings.name
+          role_arn      = aws_iam_role.firehose.arn
+        }
+      }
+    }
+  }
+
+  tags = var.tags
+}
+
+resource "aws_iam_role" "firehose" {
+  name = "${var.name_prefix}ir-finding-export-firehose-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "firehose.amazonaws.com"
+        }
+        Condition = {
+          StringEquals = {
+            "sts:ExternalId" = data.aws_caller_identity.current.account_id
+          }
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "firehose" {
+  name = "${var.name_prefix}ir-finding-export-firehose-policy"
+  role = aws_iam_role.firehose.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:AbortMultipartUpload",
+          "s3:GetBucketLocation",
+          "s3:GetObject",
+          "s3:ListBucket",
+          "s3:ListBucketMultipartUploads",
+          "s3:PutObject"
+        ]
+        Resource = [
+          aws_s3_bucket.analytics.arn,
+          "${aws_s3_bucket.analytics.arn}/*"
+        ]
+      },
+      {
+        # Read the table schema for Parquet conversion
+        Effect = "Allow"
+        Action = [
+          "glue:GetTable",
+          "glue:GetTableVersion",
+          "glue:GetTableVersions"
+        ]
+        Resource = [
+          "arn:${data.aws_partition.current.partition}:glue:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:catalog",
+          "arn:${data.aws_partition.current.partition}:glue:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:database/${aws_glue_catalog_database.findings.name}",
+          "arn:${data.aws_partition.current.partition}:glue:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:table/${aws_glue_catalog_database.findings.name}/*"
+        ]
+      }
+    ]
+  })
+}
+
+# Every GuardDuty finding is exported, not only those above the triage threshold
+resource "aws_cloudwatch_event_rule" "export" {
+  name        = "${var.name_prefix}guardduty-finding-export-rule"
+  description = "Rule exporting all GuardDuty findings to Firehose"
+
+  event_pattern = jsonencode({
+    source      = ["aws.guardduty"]
+    detail-type = ["GuardDuty Finding"]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "firehose" {
+  rule     = aws_cloudwatch_event_rule.export.name
+  arn      = aws_kinesis_firehose_delivery_stream.findings.arn
+  role_arn = aws_iam_role.eventbridge_firehose.arn
+}
+
+resource "aws_iam_role" "eventbridge_firehose" {
+  name = "${var.name_prefix}eventbridge-firehose-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "events.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "eventbridge_firehose" {
+  name = "${var.name_prefix}eventbridge-firehose-policy"
+  role = aws_iam_role.eventbridge_firehose.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "firehose:PutRecord",
+          "firehose:PutRecordBatch"
+        ]
+        Resource = aws_kinesis_firehose_delivery_stream.findings.arn
+      }
+    ]
+  })
+}
+
+# Workgroup for responders and tests querying the exported findings
+resource "aws_athena_workgroup" "findings" {
+  name          = "${var.name_prefix}ir-finding-export"
+  force_destroy = true
+
+  configuration {
+    enforce_workgroup_configuration = true
+
+    result_configuration {
+      output_location = "s3://${aws_s3_bucket.analytics.bucket}/athena-results/"
+
+      encryption_configuration {
+        encryption_option = "SSE_S3"
+      }
+    }
+  }
+
+  tags = var.tags
+}
@@ -0,0 +1,34 @@
+output "bucket_name" {
+  description = "Name of the S3 analytics bucket receiving exported findings"
+  value       = aws_s3_bucket.analytics.bucket
+}
+
+output "delivery_stream_name" {
+  description = "Name of the Firehose delivery stream exporting findings"
+  value       = aws_kinesis_firehose_delivery_stream.findings.name
+}
+
+output "glue_database_name" {
+  description = "Name of the Glue database holding the exported findings table"
+  value       = aws_glue_catalog_database.findings.name
+}
+
+output "glue_table_name" {
+  description = "Name of the Glue table over the exported findings"
+  value       = aws_glue_catalog_table.findings.name
+}
+
+output "athena_workgroup_name" {
+  description = "Name of the Athena workgroup for querying exported findings"
+  value       = aws_athena_workgroup.findings.name
+}
+
+output "rule_name" {
+  description = "Name of the EventBridge rule sending findings to Firehose"
+  value       = aws_cloudwatch_event_rule.export.name
+}
+
+output "role_names" {
+  description = "Names of the roles used by Firehose and EventBridge for the export"
+  value       = [aws_iam_role.firehose.name, aws_iam_role.eventbridge_firehose.name]
+}
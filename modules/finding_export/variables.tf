@@ -0,0 +1,44 @@
+variable "bucket_name" {
+  description = "Name of the S3 analytics bucket receiving exported findings"
+  type        = string
+}
+
+variable "format" {
+  description = "Format of the exported records: JSON, or PARQUET converted by Firehose"
+  type        = string
+  default     = "JSON"
+
+  validation {
+    condition     = contains(["JSON", "PARQUET"], var.format)
+    error_message = "format must be JSON or PARQUET"
+  }
+}
+
+variable "buffer_interval_seconds" {
+  description = "Seconds Firehose buffers findings before writing an object"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.buffer_interval_seconds >= 60 && var.buffer_interval_seconds <= 900
+    error_message = "buffer_interval_seconds must be between 60 and 900"
+  }
+}
+
+variable "retention_days" {
+  description = "Days after creation when exported findings expire"
+  type        = number
+  default     = 365
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
+variable "tags" {
+  description = "Tags for finding export resources"
+  type        = map(string)
+  default     = {}
+}
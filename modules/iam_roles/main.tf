@@ -1,6 +1,25 @@
+data "aws_partition" "current" {}
+
+# Blast-radius contract for the IR roles: containment never destroys resources, in this account or
+# any member account, whatever other statements are added later
+locals {
+  destructive_actions = [
+    "ec2:TerminateInstances",
+    "s3:DeleteBucket",
+    "kms:ScheduleKeyDeletion"
+  ]
+
+  deny_destructive_actions = {
+    Sid      = "DenyDestructiveActions"
+    Effect   = "Deny"
+    Action   = local.destructive_actions
+    Resource = "*"
+  }
+}
+
 # Lambda Triage Role
 resource "aws_iam_role" "lambda_triage" {
-  name = "lambda-triage-role"
+  name = "${var.name_prefix}lambda-triage-role"
 
   assume_role_policy = jsonencode({
     Version = "2012-10-17"
@@ -19,7 +38,7 @@ resource "aws_iam_role" "lambda_triage" {
 }
 
 resource "aws_iam_policy" "lambda_triage" {
-  name = "lambda-triage-policy"
+  name = "${var.name_prefix}lambda-triage-policy"
 
   policy = jsonencode({
     Version = "2012-10-17"
@@ -29,12 +48,66 @@ resource "aws_iam_policy" "lambda_triage" {
         Action = [
           "s3:GetObject",
           "s3:PutObject",
-          "s3:PutObjectAcl"
+          "s3:PutObjectAcl",
+          # Without it HeadObject answers 403 instead of 404 for findings not triaged yet
+          "s3:ListBucket"
         ]
         Resource = [
-          "arn:aws:s3:::ir-evidence-bucket/*",
-          "arn:aws:s3:::ir-evidence-bucket"
+          "${var.evidence_bucket_arn}/*",
+          var.evidence_bucket_arn
+        ]
+      },
+      {
+        # Containment pause: read the switch and queue findings until it is lifted
+        Effect   = "Allow"
+        Action   = "ssm:GetParameter"
+        Resource = "arn:${data.aws_partition.current.partition}:ssm:*:*:parameter/ir/*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:SendMessage",
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:ChangeMessageVisibility"
+        ]
+        Resource = "arn:${data.aws_partition.current.partition}:sqs:*:*:*ir-deferred-findings"
+      },
+      {
+        # Polled by the event source mapping when findings are buffered in SQS
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = "arn:${data.aws_partition.current.partition}:sqs:*:*:*ir-finding-buffer"
+      },
+      {
+        # Incident index items are created once per finding and updated on every triage after
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem"
         ]
+        Resource = "arn:${data.aws_partition.current.partition}:dynamodb:*:*:table/*ir-incidents"
+      },
+      {
+        # Recurrences are found among the earlier findings on the same resource
+        Effect   = "Allow"
+        Action   = "dynamodb:Query"
+        Resource = "arn:${data.aws_partition.current.partition}:dynamodb:*:*:table/*ir-incidents/index/by-resource"
+      },
+      {
+        # Evidence write failures and unresolved resources are counted for the pipeline alarms
+        Effect   = "Allow"
+        Action   = "cloudwatch:PutMetricData"
+        Resource = "*"
+        Condition = {
+          StringEquals = {
+            "cloudwatch:namespace" = "ThreatDetectionIR"
+          }
+        }
       },
       {
         Effect = "Allow"
@@ -44,7 +117,7 @@ resource "aws_iam_policy" "lambda_triage" {
           "logs:PutLogEvents",
           "logs:DescribeLogGroups"
         ]
-        Resource = "arn:aws:logs:*:*:log-group:/aws/lambda/*"
+        Resource = "arn:${data.aws_partition.current.partition}:logs:*:*:log-group:/aws/lambda/*"
       },
       {
         Effect = "Allow"
@@ -62,17 +135,62 @@ resource "aws_iam_policy" "lambda_triage" {
           "ec2:DescribeInstances",
           "ec2:DescribeNetworkInterfaces",
           "ec2:CreateTags",
-          "ec2:DeleteTags"
+          "ec2:DeleteTags",
+          "ec2:CreateFlowLogs",
+          "ec2:DescribeFlowLogs"
+        ]
+        Resource = "*"
+      },
+      # Instances in an Auto Scaling group are detached before they are isolated, so the group replaces
+      # them instead of terminating them on a failed health check
+      {
+        Effect = "Allow"
+        Action = [
+          "autoscaling:DescribeAutoScalingInstances",
+          "autoscaling:DetachInstances"
         ]
         Resource = "*"
       },
+      # ECS task findings snapshot the task, its definition and its host into the evidence
+      {
+        Effect = "Allow"
+        Action = [
+          "ecs:DescribeTasks",
+          "ecs:DescribeTaskDefinition",
+          "ecs:DescribeContainerInstances"
+        ]
+        Resource = "*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = "iam:PassRole"
+        Resource = aws_iam_role.flow_logs.arn
+      },
+      {
+        # Evidence writes must bind the finding and account into the KMS encryption context
+        Effect = "Allow"
+        Action = [
+          "kms:GenerateDataKey",
+          "kms:Decrypt"
+        ]
+        Resource = var.evidence_kms_key_arn != "" ? var.evidence_kms_key_arn : "*"
+        Condition = {
+          StringLike = {
+            "kms:ViaService" = "s3.*.amazonaws.com"
+          }
+          Null = {
+            "kms:EncryptionContext:finding_id" = "false"
+            "kms:EncryptionContext:account"    = "false"
+          }
+        }
+      },
       {
         Effect = "Allow"
         Action = [
           "states:StartExecution",
           "states:DescribeExecution"
         ]
-        Resource = "arn:aws:states:*:*:stateMachine:guardduty-ir"
+        Resource = "arn:${data.aws_partition.current.partition}:states:*:*:stateMachine:${var.name_prefix}guardduty-ir"
       },
       {
         Effect = "Allow"
@@ -80,7 +198,10 @@ resource "aws_iam_policy" "lambda_triage" {
           "sns:Publish",
           "sns:GetTopicAttributes"
         ]
-        Resource = "arn:aws:sns:*:*:ir-alerts-topic"
+        Resource = [
+          "arn:${data.aws_partition.current.partition}:sns:*:*:${var.name_prefix}ir-alerts-topic",
+          "arn:${data.aws_partition.current.partition}:sns:*:*:${var.name_prefix}ir-urgent-topic"
+        ]
       },
       {
         Effect = "Allow"
@@ -89,7 +210,8 @@ resource "aws_iam_policy" "lambda_triage" {
           "xray:PutTelemetryRecords"
         ]
         Resource = "*"
-      }
+      },
+      local.deny_destructive_actions
     ]
   })
 }
@@ -101,7 +223,7 @@ resource "aws_iam_role_policy_attachment" "lambda_triage" {
 
 # Step Functions IR Role
 resource "aws_iam_role" "stepfn_ir" {
-  name = "stepfn-ir-role"
+  name = "${var.name_prefix}stepfn-ir-role"
 
   assume_role_policy = jsonencode({
     Version = "2012-10-17"
@@ -120,7 +242,7 @@ resource "aws_iam_role" "stepfn_ir" {
 }
 
 resource "aws_iam_policy" "stepfn_ir" {
-  name = "stepfn-ir-policy"
+  name = "${var.name_prefix}stepfn-ir-policy"
 
   policy = jsonencode({
     Version = "2012-10-17"
@@ -133,8 +255,8 @@ resource "aws_iam_policy" "stepfn_ir" {
           "s3:PutObjectAcl"
         ]
         Resource = [
-          "arn:aws:s3:::ir-evidence-bucket/*",
-          "arn:aws:s3:::ir-evidence-bucket"
+          "${var.evidence_bucket_arn}/*",
+          var.evidence_bucket_arn
         ]
       },
       {
@@ -143,7 +265,7 @@ resource "aws_iam_policy" "stepfn_ir" {
           "lambda:InvokeFunction",
           "lambda:GetFunction"
         ]
-        Resource = "arn:aws:lambda:*:*:function:guardduty-triage"
+        Resource = "arn:${data.aws_partition.current.partition}:lambda:*:*:function:${var.name_prefix}guardduty-triage"
       },
       {
         Effect = "Allow"
@@ -153,7 +275,7 @@ resource "aws_iam_policy" "stepfn_ir" {
           "logs:PutLogEvents",
           "logs:DescribeLogGroups"
         ]
-        Resource = "arn:aws:logs:*:*:log-group:/aws/states/*"
+        Resource = "arn:${data.aws_partition.current.partition}:logs:*:*:log-group:/aws/states/*"
       },
       {
         Effect = "Allow"
@@ -163,26 +285,50 @@ resource "aws_iam_policy" "stepfn_ir" {
         ]
         Resource = "*"
       },
+      # Contained findings are archived in GuardDuty once resolved in Security Hub
+      {
+        Effect   = "Allow"
+        Action   = "guardduty:ArchiveFindings"
+        Resource = "arn:${data.aws_partition.current.partition}:guardduty:*:*:detector/*"
+      },
       {
         Effect = "Allow"
         Action = [
-          "ec2:ModifyNetworkInterface",
+          "ec2:ModifyNetworkInterfaceAttribute",
           "ec2:DescribeSecurityGroups",
           "ec2:DescribeInstances",
           "ec2:DescribeNetworkInterfaces",
+          "ec2:DescribeNetworkAcls",
+          "ec2:ReplaceNetworkAclAssociation",
           "ec2:CreateTags",
           "ec2:DeleteTags"
         ]
         Resource = "*"
       },
+      # ECS tasks are stopped after their host is drained, so the scheduler relaunches them elsewhere
+      {
+        Effect = "Allow"
+        Action = [
+          "ecs:DescribeTasks",
+          "ecs:UpdateContainerInstancesState",
+          "ecs:StopTask"
+        ]
+        Resource = "*"
+      },
       {
         Effect = "Allow"
         Action = [
           "sns:Publish",
           "sns:GetTopicAttributes"
         ]
-        Resource = "arn:aws:sns:*:*:ir-alerts-topic"
-      }
+        Resource = "arn:${data.aws_partition.current.partition}:sns:*:*:${var.name_prefix}ir-alerts-topic"
+      },
+      {
+        Effect   = "Allow"
+        Action   = "sqs:SendMessage"
+        Resource = "arn:${data.aws_partition.current.partition}:sqs:*:*:${var.name_prefix}ir-remediation-dlq"
+      },
+      local.deny_destructive_actions
     ]
   })
 }
@@ -190,4 +336,74 @@ resource "aws_iam_policy" "stepfn_ir" {
 resource "aws_iam_role_policy_attachment" "stepfn_ir" {
   role       = aws_iam_role.stepfn_ir.name
   policy_arn = aws_iam_policy.stepfn_ir.arn
-}
\ No newline at end of file
+}
+
+# VPC Flow Logs delivery role, passed by the triage Lambda when it enables flow logs on quarantined instances
+resource "aws_iam_role" "flow_logs" {
+  name = "${var.name_prefix}quarantine-flow-logs-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "vpc-flow-logs.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "flow_logs" {
+  name = "${var.name_prefix}quarantine-flow-logs-policy"
+  role = aws_iam_role.flow_logs.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogStream",
+          "logs:PutLogEvents",
+          "logs:DescribeLogGroups",
+          "logs:DescribeLogStreams"
+        ]
+        Resource = "arn:${data.aws_partition.current.partition}:logs:*:*:log-group:/aws/vpc/${var.name_prefix}quarantine-flow-logs:*"
+      }
+    ]
+  })
+}
+
+# Read access to the third-party integration secrets (Slack, Jira, ...) the triage Lambda references
+resource "aws_iam_role_policy" "lambda_integration_secrets" {
+  count = length(var.integration_secret_arns) > 0 ? 1 : 0
+
+  name = "${var.name_prefix}lambda-integration-secrets-policy"
+  role = aws_iam_role.lambda_triage.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = "secretsmanager:GetSecretValue"
+        Resource = var.integration_secret_arns
+      },
+      {
+        Effect   = "Allow"
+        Action   = "kms:Decrypt"
+        Resource = var.evidence_kms_key_arn != "" ? var.evidence_kms_key_arn : "*"
+        Condition = {
+          StringLike = {
+            "kms:ViaService" = "secretsmanager.*.amazonaws.com"
+          }
+        }
+      }
+    ]
+  })
+}
@@ -3,7 +3,22 @@ output "lambda_role_arn" {
   value       = aws_iam_role.lambda_triage.arn
 }
 
+output "lambda_role_name" {
+  description = "Name of the IAM role for Lambda triage function"
+  value       = aws_iam_role.lambda_triage.name
+}
+
 output "stepfn_role_arn" {
   description = "ARN of the IAM role for Step Functions IR state machine"
   value       = aws_iam_role.stepfn_ir.arn
-}
\ No newline at end of file
+}
+
+output "stepfn_role_name" {
+  description = "Name of the IAM role for Step Functions IR state machine"
+  value       = aws_iam_role.stepfn_ir.name
+}
+
+output "flow_logs_role_arn" {
+  description = "ARN of the VPC Flow Logs delivery role"
+  value       = aws_iam_role.flow_logs.arn
+}
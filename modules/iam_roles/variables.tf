@@ -1,3 +1,26 @@
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
+variable "evidence_bucket_arn" {
+  description = "ARN of the evidence bucket the triage Lambda and the IR workflow read and write evidence in"
+  type        = string
+}
+
+variable "evidence_kms_key_arn" {
+  description = "ARN of the evidence bucket KMS key the triage Lambda encrypts with"
+  type        = string
+  default     = ""
+}
+
+variable "integration_secret_arns" {
+  description = "Secrets Manager ARNs of third-party integration credentials the triage Lambda may read"
+  type        = list(string)
+  default     = []
+}
+
 variable "tags" {
   description = "Tags for IAM resources"
   type        = map(string)
@@ -1,17 +1,977 @@
+import base64
+import hashlib
+import http.client
 import json
+import re
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
 import boto3
 import os
+from botocore.exceptions import ClientError
 
-def lambda_handler(event, context):
+# Source of the scheduled event that drains deferred findings
+DRAIN_EVENT_SOURCE = 'ir.containment-resume'
+
+# Namespace of the pipeline's own metrics, alarmed on by the cloudwatch module
+METRICS_NAMESPACE = 'ThreatDetectionIR'
+
+def normalize_securityhub_event(event):
+    """
+    Map a Security Hub "Findings - Imported" event for a custom finding onto the
+    GuardDuty finding shape used by the rest of the pipeline. The ASFF finding is
+    kept under detail.asff. Other events are returned unchanged.
+    """
+    if event.get('source') != 'aws.securityhub':
+        return event
+
+    findings = event.get('detail', {}).get('findings', [])
+    if not findings:
+        raise ValueError('Security Hub event has no findings')
+    finding = findings[0]
+
+    # ASFF normalized severity is 0-100; GuardDuty severity is 0-10
+    severity = finding.get('Severity', {}).get('Normalized', 0) / 10.0
+
+    finding_type = (finding.get('Types') or ['Unknown'])[0]
+    if finding_type.startswith('TTPs/'):
+        finding_type = finding_type[len('TTPs/'):]
+
+    resource = {}
+    asff_resources = finding.get('Resources', [])
+    if asff_resources:
+        first = asff_resources[0]
+        resource_id = first.get('Id', '')
+        if first.get('Type') == 'AwsEc2Instance' or resource_id.startswith('i-'):
+            resource = {
+                'resourceType': 'Instance',
+                'instanceDetails': {'instanceId': resource_id.split('/')[-1]}
+            }
+        else:
+            resource = {'resourceType': first.get('Type', 'Other'), 'resourceId': resource_id}
+
+    normalized = dict(event)
+    normalized['detail'] = {
+        'id': finding.get('Id', 'unknown'),
+        'accountId': finding.get('AwsAccountId', event.get('account', '')),
+        'severity': severity,
+        'type': finding_type,
+        'resource': resource,
+        'asff': finding
+    }
+    return normalized
+
+# Security Hub workflow statuses of findings closed by an analyst or the pipeline
+CLOSED_WORKFLOW_STATUSES = ('RESOLVED', 'SUPPRESSED')
+
+def closed_reason(detail):
+    """
+    Why a finding is closed to response: archived in GuardDuty, or resolved or
+    suppressed in Security Hub. Empty for open findings.
+    """
+    if (detail.get('service') or {}).get('archived') is True:
+        return 'archived in GuardDuty'
+    status = ((detail.get('asff') or {}).get('Workflow') or {}).get('Status')
+    if status in CLOSED_WORKFLOW_STATUSES:
+        return f'{status.lower()} in Security Hub'
+    return ''
+
+def evidence_encryption_context(finding_id, account):
+    """
+    KMS encryption context bound to an evidence object. The Lambda role may only
+    use the evidence key with finding_id and account present, and the context
+    shows up in CloudTrail for every GenerateDataKey/Decrypt on the object.
+    """
+    context = {'finding_id': finding_id, 'account': account}
+    return base64.b64encode(json.dumps(context).encode('utf-8')).decode('utf-8')
+
+def store_evidence(s3_client, bucket, key, event, finding_id, account, metadata, context):
+    """
+    Write a finding's evidence object. A failed write is counted in the
+    EvidenceWriteErrors metric before the error is raised, so it alarms even
+    when the retried invocation later succeeds.
+    """
+    try:
+        s3_client.put_object(
+            Bucket=bucket,
+            Key=key,
+            Body=json.dumps(event),
+            ContentType='application/json',
+            ServerSideEncryption='aws:kms',
+            SSEKMSKeyId=os.environ['EVIDENCE_KMS_KEY'],
+            SSEKMSEncryptionContext=evidence_encryption_context(finding_id, account),
+            Metadata=metadata
+        )
+    except ClientError:
+        boto3.client('cloudwatch').put_metric_data(
+            Namespace=METRICS_NAMESPACE,
+            MetricData=[{
+                'MetricName': 'EvidenceWriteErrors',
+                'Dimensions': [{'Name': 'FunctionName', 'Value': context.function_name}],
+                'Value': 1,
+                'Unit': 'Count'
+            }]
+        )
+        raise
+
+# With PII scrubbing on, the raw evidence is kept under this prefix, followed by
+# the key of the scrubbed evidence
+RESTRICTED_PREFIX = 'restricted/'
+REDACTED = '[REDACTED]'
+
+# Resource kinds whose identifier is a finding field PII scrubbing may redact
+SCRUBBED_RESOURCE_KINDS = {'access-key': 'accessKeyId'}
+
+def pii_scrub_fields():
+    """The finding fields PII_SCRUB_FIELDS redacts; empty when scrubbing is off."""
+    return set(json.loads(os.environ.get('PII_SCRUB_FIELDS') or '[]'))
+
+def scrub_pii(value, fields):
+    """
+    A copy of value with the value of every key named in fields redacted, at
+    any depth, so a field is scrubbed wherever the finding format nests it.
+    """
+    if isinstance(value, dict):
+        return {
+            key: REDACTED if key in fields and item is not None else scrub_pii(item, fields)
+            for key, item in value.items()
+        }
+    if isinstance(value, list):
+        return [scrub_pii(item, fields) for item in value]
+    return value
+
+def scrubbed_kind(target, fields):
+    """The kind of target if PII scrubbing covers its identifier, else None."""
+    kind = target.split(':', 1)[0]
+    return kind if SCRUBBED_RESOURCE_KINDS.get(kind) in fields else None
+
+def redact_targets(targets, fields):
+    """The targets with every identifier PII scrubbing covers redacted."""
+    return [
+        f'{scrubbed_kind(target, fields)}:{REDACTED}' if scrubbed_kind(target, fields) else target
+        for target in targets
+    ]
+
+def index_target(target, fields):
+    """
+    A target as the incident index records it. An identifier PII scrubbing
+    covers is replaced by a hash of it rather than redacted, so the index still
+    links findings on the same resource without holding the identifier.
+    """
+    kind = scrubbed_kind(target, fields)
+    if not kind:
+        return target
+    return f"{kind}:sha256-{hashlib.sha256(target.encode('utf-8')).hexdigest()[:16]}"
+
+def store_finding_evidence(s3_client, bucket, key, evidence, finding_id, account, metadata, context):
+    """
+    Write a finding's evidence, scrubbed of PII_SCRUB_FIELDS when scrubbing is
+    on. The raw evidence is then written first, under RESTRICTED_PREFIX, which
+    the evidence bucket policy can limit to a few readers.
+    """
+    fields = pii_scrub_fields()
+    if fields:
+        raw_key = f'{RESTRICTED_PREFIX}{key}'
+        store_evidence(s3_client, bucket, raw_key, evidence, finding_id, account, metadata, context)
+        evidence = scrub_pii(evidence, fields)
+        metadata = dict(metadata, **{'pii-scrubbed': 'true', 'raw-evidence': raw_key})
+        if metadata.get('resources'):
+            metadata['resources'] = ','.join(redact_targets(metadata['resources'].split(','), fields))
+    store_evidence(s3_client, bucket, key, evidence, finding_id, account, metadata, context)
+
+# ASFF resource types kept as-is by normalize_securityhub_event, and the kind
+# of identifier their Id holds
+ASFF_RESOURCE_KINDS = {
+    'AwsEc2NetworkInterface': 'eni',
+    'AwsS3Bucket': 'bucket',
+    'AwsIamAccessKey': 'access-key',
+    'AwsEksCluster': 'eks-cluster',
+    'AwsEc2Volume': 'volume',
+    'AwsEcsTask': 'ecs-task',
+}
+
+def arn_partition(region):
+    """The ARN partition of a region; GovCloud and China regions are not in "aws"."""
+    if region.startswith('us-gov-'):
+        return 'aws-us-gov'
+    if region.startswith('cn-'):
+        return 'aws-cn'
+    return 'aws'
+
+class UnresolvedResourceError(ValueError):
+    """A finding names a resource type triage does not know how to resolve."""
+
+def resolve_resources(resource):
+    """
+    Resolve the resources a finding implicates to "kind:identifier" strings,
+    across the GuardDuty and normalized ASFF resource formats. Raises
+    UnresolvedResourceError for a resource type it does not know, rather than
+    leaving a new type silently uncontained.
+    """
+    resource_type = resource.get('resourceType')
+
+    if resource_type == 'Instance':
+        details = resource.get('instanceDetails') or {}
+        resolved = [f"instance:{details['instanceId']}"] if details.get('instanceId') else []
+        resolved += [
+            f"eni:{eni['networkInterfaceId']}"
+            for eni in details.get('networkInterfaces') or []
+            if eni.get('networkInterfaceId')
+        ]
+        # Malware Protection findings add the EBS volumes that were scanned
+        scanned = (resource.get('ebsVolumeDetails') or {}).get('scannedVolumeDetails') or []
+        resolved += [
+            f"volume:{volume['volumeArn']}"
+            for volume in scanned
+            if volume.get('volumeArn')
+        ]
+        return resolved
+
+    if resource_type == 'S3Bucket':
+        buckets = resource.get('s3BucketDetails') or []
+        # Older exports carry a single bucket keyed by bucketName
+        if isinstance(buckets, dict):
+            buckets = [{'name': buckets.get('bucketName')}]
+        partition = arn_partition(os.environ.get('AWS_REGION', ''))
+        return [
+            f"bucket:{bucket.get('arn') or f'arn:{partition}:s3:::' + bucket['name']}"
+            for bucket in buckets
+            if bucket.get('arn') or bucket.get('name')
+        ]
+
+    if resource_type == 'AccessKey':
+        key_id = (resource.get('accessKeyDetails') or {}).get('accessKeyId')
+        return [f"access-key:{key_id}"] if key_id else []
+
+    if resource_type == 'EKSCluster':
+        arn = (resource.get('eksClusterDetails') or {}).get('arn')
+        return [f"eks-cluster:{arn}"] if arn else []
+
+    if resource_type == 'ECSCluster':
+        task_arn = ((resource.get('ecsClusterDetails') or {}).get('taskDetails') or {}).get('arn')
+        return [f"ecs-task:{task_arn}"] if task_arn else []
+
+    if resource_type in ASFF_RESOURCE_KINDS:
+        resource_id = resource.get('resourceId')
+        return [f"{ASFF_RESOURCE_KINDS[resource_type]}:{resource_id}"] if resource_id else []
+
+    raise UnresolvedResourceError(f"Unknown resource type {resource_type!r}")
+
+def kubernetes_context(resource):
+    """
+    The EKS context of a finding: the cluster, the namespace, name and type of
+    the workload, and the worker node of runtime findings. EKS findings are
+    not contained automatically, so responders act on this context. Empty for
+    other resource types.
+    """
+    if resource.get('resourceType') != 'EKSCluster':
+        return {}
+    workload = (resource.get('kubernetesDetails') or {}).get('kubernetesWorkloadDetails') or {}
+    context = {
+        'cluster': (resource.get('eksClusterDetails') or {}).get('name'),
+        'namespace': workload.get('namespace'),
+        'workload': workload.get('name'),
+        'workload-type': workload.get('type'),
+        'node': (resource.get('instanceDetails') or {}).get('instanceId'),
+    }
+    return {key: value for key, value in context.items() if value}
+
+def data_classification(resource):
+    """
+    The data classification of a finding's resource: the value of its
+    DATA_CLASSIFICATION_TAG, as GuardDuty reports the resource's tags. Empty
+    when the resource is untagged.
+    """
+    tag_key = os.environ.get('DATA_CLASSIFICATION_TAG', '')
+    if not tag_key:
+        return ''
+    # Tags sit in the resource type's details block, e.g. instanceDetails, or
+    # in each entry of a list of them, e.g. s3BucketDetails
+    blocks = []
+    for value in resource.values():
+        blocks += value if isinstance(value, list) else [value]
+    for block in blocks:
+        if not isinstance(block, dict):
+            continue
+        for tag in block.get('tags') or []:
+            if tag.get('key') == tag_key and tag.get('value'):
+                return tag['value'].lower()
+    return ''
+
+def evidence_key(finding_id, classification):
+    """
+    Where a finding's evidence is stored. Classes in DATA_CLASSIFICATIONS get
+    a prefix of their own, which the evidence bucket's retention matrix gives
+    its own lifecycle; everything else goes under findings/.
+    """
+    if classification in json.loads(os.environ.get('DATA_CLASSIFICATIONS') or '[]'):
+        return f'classified/{classification}/{finding_id}.json'
+    return f'findings/{finding_id}.json'
+
+def ecs_task_snapshot(resource):
+    """
+    Snapshot the ECS task a finding names before the workflow stops it: the
+    task with its containers' images, digests and runtime IDs, its task
+    definition, and the EC2 instance it runs on (none on Fargate). None for
+    other resource types or a task that cannot be described, e.g. one that
+    is already gone; the finding is still triaged.
+    """
+    if resource.get('resourceType') != 'ECSCluster':
+        return None
+    cluster = resource.get('ecsClusterDetails') or {}
+    task_arn = (cluster.get('taskDetails') or {}).get('arn')
+    if not task_arn:
+        return None
+
+    ecs_client = boto3.client('ecs')
+    try:
+        # Task ARNs are arn:...:task/<cluster>/<id>
+        tasks = ecs_client.describe_tasks(
+            cluster=cluster.get('arn') or task_arn.split('/')[1],
+            tasks=[task_arn]
+        ).get('tasks', [])
+        if not tasks:
+            print(f"ECS task {task_arn} not found, no snapshot taken")
+            return None
+        task = tasks[0]
+        definition = ecs_client.describe_task_definition(
+            taskDefinition=task['taskDefinitionArn']
+        )['taskDefinition']
+        host = None
+        if task.get('containerInstanceArn'):
+            instances = ecs_client.describe_container_instances(
+                cluster=task['clusterArn'],
+                containerInstances=[task['containerInstanceArn']]
+            ).get('containerInstances', [])
+            if instances:
+                host = instances[0].get('ec2InstanceId')
+    except ClientError as e:
+        print(f"Failed to snapshot ECS task {task_arn}: {e}")
+        return None
+
+    # Timestamps come back as datetimes, which the evidence JSON cannot hold
+    return json.loads(json.dumps({
+        'task': task,
+        'taskDefinition': definition,
+        'host': host
+    }, default=str))
+
+# Reputations a threat intel endpoint may report, from least to most severe
+REPUTATIONS = ['clean', 'unknown', 'suspicious', 'malicious']
+
+def remote_ip_details(detail):
+    """
+    The remote IPs a finding's action involves, each with the GeoIP and ASN
+    details GuardDuty attached to it.
+    """
+    action = (detail.get('service') or {}).get('action') or {}
+    blocks = [
+        (action.get(key) or {}).get('remoteIpDetails')
+        for key in ('networkConnectionAction', 'awsApiCallAction',
+                    'kubernetesApiCallAction', 'rdsLoginAttemptAction')
+    ]
+    blocks += [
+        probe.get('remoteIpDetails')
+        for probe in (action.get('portProbeAction') or {}).get('portProbeDetails') or []
+    ]
+
+    details = {}
+    for block in blocks:
+        ip = (block or {}).get('ipAddressV4') or (block or {}).get('ipAddressV6')
+        if not ip or ip in details:
+            continue
+        organization = block.get('organization') or {}
+        details[ip] = {key: value for key, value in {
+            'ip': ip,
+            'country': (block.get('country') or {}).get('countryName'),
+            'city': (block.get('city') or {}).get('cityName'),
+            'asn': organization.get('asn'),
+            'asn_org': organization.get('asnOrg'),
+            'isp': organization.get('isp'),
+        }.items() if value}
+    return list(details.values())
+
+def parse_virustotal(answer):
+    """Map a VirusTotal v3 IP address report onto a reputation."""
+    attributes = (answer.get('data') or {}).get('attributes') or {}
+    stats = attributes.get('last_analysis_stats') or {}
+    if stats.get('malicious'):
+        reputation = 'malicious'
+    elif stats.get('suspicious'):
+        reputation = 'suspicious'
+    elif stats.get('harmless'):
+        reputation = 'clean'
+    else:
+        reputation = 'unknown'
+    return {
+        'reputation': reputation,
+        'score': stats.get('malicious', 0),
+        'country': attributes.get('country'),
+        'asn': attributes.get('asn'),
+        'asn_org': attributes.get('as_owner'),
+    }
+
+# OTX pulses are community threat reports; this many make an IP malicious
+OTX_MALICIOUS_PULSES = 3
+
+def parse_otx(answer):
+    """Map an AlienVault OTX general indicator report onto a reputation."""
+    pulses = (answer.get('pulse_info') or {}).get('count') or 0
+    if pulses >= OTX_MALICIOUS_PULSES:
+        reputation = 'malicious'
+    elif pulses:
+        reputation = 'suspicious'
+    else:
+        # OTX knows every address; no pulses says nothing either way
+        reputation = 'unknown'
+    # e.g. "AS64496 Example Networks"
+    asn, _, asn_org = (answer.get('asn') or '').partition(' ')
+    return {
+        'reputation': reputation,
+        'score': pulses,
+        'country': answer.get('country_name'),
+        'asn': asn.removeprefix('AS') or None,
+        'asn_org': asn_org or None,
+    }
+
+# How each threat_intel_provider is asked about an IP: the path under the
+# endpoint, the header carrying the API key, and how its answer is read
+THREAT_INTEL_PROVIDERS = {
+    'generic': ('/ip/{ip}', None, lambda answer: answer),
+    'virustotal': ('/api/v3/ip_addresses/{ip}', 'x-apikey', parse_virustotal),
+    'otx': ('/api/v1/indicators/{family}/{ip}/general', 'X-OTX-API-KEY', parse_otx),
+}
+
+class ThreatIntelRateLimited(Exception):
+    """The threat intel endpoint kept answering 429 Too Many Requests."""
+
+def integration_secret(name):
+    """The value of an integration's secret in INTEGRATION_SECRET_ARNS, or None."""
+    arn = json.loads(os.environ.get('INTEGRATION_SECRET_ARNS') or '{}').get(name)
+    if not arn:
+        return None
+    return boto3.client('secretsmanager').get_secret_value(SecretId=arn)['SecretString']
+
+def lookup_reputation(endpoint, provider, api_key, ip, timeout):
+    """
+    Ask the threat intel endpoint about an IP. A 429 is retried once after
+    its Retry-After, if that fits in the timeout, and raises
+    ThreatIntelRateLimited otherwise; any other failure raises as is.
+    """
+    path, key_header, parse = THREAT_INTEL_PROVIDERS[provider]
+    family = 'IPv6' if ':' in ip else 'IPv4'
+    request = urllib.request.Request(
+        endpoint.rstrip('/') + path.format(ip=urllib.parse.quote(ip), family=family)
+    )
+    if key_header and api_key:
+        request.add_header(key_header, api_key)
+
+    for attempt in range(2):
+        try:
+            with urllib.request.urlopen(request, timeout=timeout) as response:
+                return parse(json.loads(response.read()))
+        except urllib.error.HTTPError as e:
+            # An IP the endpoint has never seen is an answer, not a failure
+            if e.code == 404:
+                return {'reputation': 'unknown'}
+            if e.code != 429:
+                raise
+            try:
+                retry_after = float(e.headers.get('Retry-After', timeout))
+            except ValueError:
+                retry_after = timeout
+            if attempt or retry_after > timeout:
+                raise ThreatIntelRateLimited(f"rate limited, retry after {retry_after:g}s") from e
+            time.sleep(retry_after)
+
+def enrich_finding(detail, context):
+    """
+    Enrich a finding with the GeoIP and ASN details of its remote IPs and,
+    when THREAT_INTEL_ENDPOINT is set, their reputation from the
+    THREAT_INTEL_PROVIDER. A lookup that fails or times out leaves its IP
+    without a reputation, and once the endpoint rate limits no more IPs are
+    looked up. Either marks the enrichment degraded and is counted in
+    EnrichmentErrors; the finding is triaged either way. None for findings
+    without remote IPs.
+    """
+    ips = remote_ip_details(detail)
+    if not ips:
+        return None
+    enrichment = {'status': 'enriched', 'ips': ips}
+
+    endpoint = os.environ.get('THREAT_INTEL_ENDPOINT', '')
+    if not endpoint:
+        return enrichment
+    provider = os.environ.get('THREAT_INTEL_PROVIDER', 'generic')
+    timeout = float(os.environ.get('THREAT_INTEL_TIMEOUT_SECONDS', '3'))
+    # The function's timeout only covers this many lookups
+    max_lookups = int(os.environ.get('THREAT_INTEL_MAX_LOOKUPS', '5'))
+
+    try:
+        api_key = integration_secret(provider)
+    except ClientError as e:
+        print(f"Failed to read the {provider} API key: {e}")
+        errors = [{'ip': ip['ip'], 'error': f"no {provider} API key"} for ip in ips]
+    else:
+        errors = []
+        looked_up = min(len(ips), max_lookups)
+        for i, ip in enumerate(ips[:looked_up]):
+            try:
+                intel = lookup_reputation(endpoint, provider, api_key, ip['ip'], timeout)
+            except ThreatIntelRateLimited as e:
+                # Hammering a rate limited endpoint only extends the limit
+                print(f"Threat intel lookups stopped at {ip['ip']}: {e}")
+                errors.append({'ip': ip['ip'], 'error': str(e)})
+                looked_up = i + 1
+                break
+            except (OSError, ValueError, http.client.HTTPException) as e:
+                print(f"Threat intel lookup of {ip['ip']} failed: {e}")
+                errors.append({'ip': ip['ip'], 'error': str(e)})
+                continue
+            reputation = intel.get('reputation')
+            ip['reputation'] = reputation if reputation in REPUTATIONS else 'unknown'
+            if intel.get('score') is not None:
+                ip['score'] = intel['score']
+            # The endpoint fills in what GuardDuty left out, never overrides it
+            for key in ('country', 'asn', 'asn_org'):
+                if intel.get(key) and key not in ip:
+                    ip[key] = str(intel[key])
+        errors += [{'ip': ip['ip'], 'error': 'not looked up'} for ip in ips[looked_up:]]
+
+    reputations = [ip['reputation'] for ip in ips if ip.get('reputation')]
+    if reputations:
+        enrichment['reputation'] = max(reputations, key=REPUTATIONS.index)
+    if errors:
+        enrichment['status'] = 'degraded'
+        enrichment['errors'] = errors
+        boto3.client('cloudwatch').put_metric_data(
+            Namespace=METRICS_NAMESPACE,
+            MetricData=[{
+                'MetricName': 'EnrichmentErrors',
+                'Dimensions': [{'Name': 'FunctionName', 'Value': context.function_name}],
+                'Value': len(errors),
+                'Unit': 'Count'
+            }]
+        )
+    return enrichment
+
+def is_canary(detail):
+    """
+    Synthetic findings injected by ir-canary carry details.canary. They go through
+    the whole pipeline but never page anyone.
+    """
+    return (detail.get('details') or {}).get('canary') is True
+
+def severity_label(severity):
+    """
+    Map a GuardDuty numeric severity onto the labels used for routing, with the
+    same bounds as the EventBridge severity threshold.
+    """
+    if severity >= 9:
+        return 'CRITICAL'
+    if severity >= 7:
+        return 'HIGH'
+    if severity >= 4:
+        return 'MEDIUM'
+    return 'LOW'
+
+def previous_triage(s3_client, bucket, key):
+    """
+    Return the dedup metadata (severity, triaged-at) stored on the evidence
+    object of an earlier triage of the finding, or None for a new finding.
+    """
+    try:
+        return s3_client.head_object(Bucket=bucket, Key=key).get('Metadata', {})
+    except ClientError as e:
+        if e.response.get('Error', {}).get('Code') in ('404', 'NoSuchKey', 'NotFound'):
+            return None
+        raise
+
+def dedup_decision(previous, severity, now, window_minutes):
+    """
+    Decide whether an update of a finding is triaged again. Escalations always
+    are; updates at the same or lower severity are suppressed while the last
+    triage is younger than the window. A deferral counts as a triage, so
+    updates during a pause are not queued again. Returns 'new', 'escalated',
+    'expired' or 'duplicate'.
+    """
+    if previous is None:
+        return 'new'
+    if severity > float(previous.get('severity', 0)):
+        return 'escalated'
+    last = previous.get('triaged-at') or previous.get('deferred-at') or 0
+    if now - int(last) >= window_minutes * 60:
+        return 'expired'
+    return 'duplicate'
+
+EXECUTION_ID_LENGTH = 66
+SNS_SUBJECT_LENGTH = 100
+
+def execution_prefix(finding_id):
+    """
+    The name prefix of every execution triage starts for a finding, the
+    finding ID being the correlation ID. Execution names only take letters,
+    digits, '-' and '_', and Security Hub finding IDs are ARNs, so any other
+    character becomes '-'. An ID too long for the name is cut and suffixed
+    with a hash of the whole ID, so findings sharing a long ARN prefix still
+    get distinct names.
+    """
+    name = re.sub(r'[^A-Za-z0-9_-]', '-', finding_id)
+    if len(name) > EXECUTION_ID_LENGTH:
+        digest = hashlib.sha256(finding_id.encode('utf-8')).hexdigest()[:8]
+        name = f"{name[:EXECUTION_ID_LENGTH - len(digest) - 1]}-{digest}"
+    return f'IR-{name}-'
+
+def notification_subject(finding_id):
+    """The SNS subject for a finding, cut to the 100 characters SNS accepts"""
+    subject = f'GuardDuty Finding Triage: {finding_id}'
+    if len(subject) > SNS_SUBJECT_LENGTH:
+        subject = subject[:SNS_SUBJECT_LENGTH - 3] + '...'
+    return subject
+
+def account_class(event, detail):
+    """
+    Classify the account a finding is about per the account classification
+    map. In org mode the finding's accountId is the member account; accounts
+    not in the map are production and get the full response.
+    """
+    account_id = detail.get('accountId') or event.get('account', '')
+    classes = json.loads(os.environ.get('ACCOUNT_CLASSIFICATION') or '{}')
+    return account_id, classes.get(account_id, 'production')
+
+def is_exempt(ec2_client, instance_id, exemption_tag):
+    """
+    Report whether an instance carries the exemption tag (key=value), e.g. a
+    honeypot that must keep running exposed. An empty tag disables exemptions.
+    """
+    if not exemption_tag or not instance_id:
+        return False
+    key, _, value = exemption_tag.partition('=')
+    try:
+        reservations = ec2_client.describe_instances(InstanceIds=[instance_id]).get('Reservations', [])
+    except ClientError as e:
+        # A finding about an instance that is already gone leaves nothing to exempt
+        if e.response.get('Error', {}).get('Code', '').startswith('InvalidInstanceID'):
+            return False
+        raise
+    for reservation in reservations:
+        for instance in reservation.get('Instances', []):
+            for tag in instance.get('Tags', []):
+                if tag.get('Key') == key and tag.get('Value') == value:
+                    return True
+    return False
+
+def containment_paused():
+    """
+    Read the containment pause flag operators set during change freezes. A
+    missing parameter means containment is not paused.
+    """
+    name = os.environ.get('CONTAINMENT_PAUSE_PARAMETER', '')
+    if not name:
+        return False
+    try:
+        value = boto3.client('ssm').get_parameter(Name=name)['Parameter']['Value']
+    except ClientError as e:
+        if e.response.get('Error', {}).get('Code') == 'ParameterNotFound':
+            return False
+        raise
+    return value.strip().lower() == 'true'
+
+# Time a drain keeps in hand to triage one more finding before the function times out
+DRAIN_RESERVE_MS = 60000
+
+def drain_deferred(context):
+    """
+    Triage the findings queued while containment was paused, once the pause is
+    lifted. Invoked on a schedule; a finding that fails to triage stays queued,
+    hidden until this run is over, for the next run, and moves to the deferred
+    dead-letter queue after repeated failures. Stops receiving while there is
+    still time to finish the findings in hand.
+    """
+    if containment_paused():
+        print("Containment still paused, deferred findings stay queued")
+        return {'statusCode': 200, 'body': json.dumps({'message': 'Containment paused', 'drained': 0})}
+
+    sqs_client = boto3.client('sqs')
+    queue_url = os.environ['DEFERRED_QUEUE_URL']
+
+    drained = 0
+    failed = 0
+    while context.get_remaining_time_in_millis() > DRAIN_RESERVE_MS:
+        messages = sqs_client.receive_message(
+            QueueUrl=queue_url,
+            MaxNumberOfMessages=10,
+            MessageAttributeNames=['deferred-at'],
+            # Failed findings must not come back within this run
+            VisibilityTimeout=context.get_remaining_time_in_millis() // 1000 + 1
+        ).get('Messages', [])
+        if not messages:
+            break
+        for message in messages:
+            if context.get_remaining_time_in_millis() <= DRAIN_RESERVE_MS:
+                # Released for the next run rather than left hidden until the visibility timeout
+                sqs_client.change_message_visibility(
+                    QueueUrl=queue_url, ReceiptHandle=message['ReceiptHandle'], VisibilityTimeout=0
+                )
+                continue
+            try:
+                deferred_at = message.get('MessageAttributes', {}).get('deferred-at', {}).get('StringValue', '')
+                lambda_handler(json.loads(message['Body']), context, deferred_at=deferred_at)
+            except Exception as e:
+                print(f"ERROR: deferred message {message['MessageId']} failed: {e}")
+                failed += 1
+                continue
+            sqs_client.delete_message(QueueUrl=queue_url, ReceiptHandle=message['ReceiptHandle'])
+            drained += 1
+
+    print(f"Drained {drained} deferred findings, {failed} failed")
+    return {
+        'statusCode': 200,
+        'body': json.dumps({'message': 'Deferred findings drained', 'drained': drained, 'failed': failed})
+    }
+
+def index_incident(finding_id, finding_type, targets, severity, status, now, recurrence_of=''):
+    """
+    Record the finding in the incident index when the stack keeps one. The item
+    is only created if the finding has none, so a redelivered or re-triaged
+    finding updates its one item instead of adding another. Identifiers PII
+    scrubbing covers are recorded as hashes.
+    """
+    table = os.environ.get('INCIDENT_TABLE', '')
+    if not table:
+        return
+    fields = pii_scrub_fields()
+    targets = [index_target(target, fields) for target in targets]
+    dynamodb = boto3.client('dynamodb')
+    expires_at = now + int(os.environ.get('INCIDENT_TTL_DAYS', '365')) * 86400
+    # A deferred finding is recorded before its resources are resolved
+    resource_id = targets[0] if targets else 'unresolved'
+    try:
+        item = {
+            'finding_id': {'S': finding_id},
+            'finding_type': {'S': finding_type},
+            'resource_id': {'S': resource_id},
+            'resources': {'S': ','.join(targets)},
+            'status': {'S': status},
+            'severity': {'N': str(severity)},
+            'created_at': {'N': str(now)},
+            'updated_at': {'N': str(now)},
+            'expires_at': {'N': str(expires_at)},
+            'triage_count': {'N': '1'}
+        }
+        if recurrence_of:
+            item['recurrence_of'] = {'S': recurrence_of}
+        dynamodb.put_item(
+            TableName=table,
+            Item=item,
+            ConditionExpression='attribute_not_exists(finding_id)'
+        )
+    except ClientError as e:
+        if e.response.get('Error', {}).get('Code') != 'ConditionalCheckFailedException':
+            raise
+        update = (
+            'SET #status = :status, severity = :severity, finding_type = :type, resource_id = :resource, '
+            'resources = :resources, updated_at = :now, expires_at = :expires'
+        )
+        values = {
+            ':status': {'S': status},
+            ':severity': {'N': str(severity)},
+            ':type': {'S': finding_type},
+            ':resource': {'S': resource_id},
+            ':resources': {'S': ','.join(targets)},
+            ':now': {'N': str(now)},
+            ':expires': {'N': str(expires_at)},
+            ':one': {'N': '1'}
+        }
+        if recurrence_of:
+            update += ', recurrence_of = :recurrence'
+            values[':recurrence'] = {'S': recurrence_of}
+        dynamodb.update_item(
+            TableName=table,
+            Key={'finding_id': {'S': finding_id}},
+            UpdateExpression=update + ' ADD triage_count :one',
+            ExpressionAttributeNames={'#status': 'status'},
+            ExpressionAttributeValues=values
+        )
+
+# Incident statuses of findings the workflow was started for
+RESPONDED_STATUSES = ('open', 'escalated')
+
+def find_recurrence(finding_id, finding_type, resource, classification, now):
+    """
+    Find the latest other finding of the same type on the finding's first
+    resource triaged within the recurrence window. The workflow was started
+    for every such finding, so a match means the threat came back after it was
+    responded to. Returns what links the two, or None.
+    """
+    window_minutes = int(os.environ.get('RECURRENCE_WINDOW_MINUTES', '0'))
+    table = os.environ.get('INCIDENT_TABLE', '')
+    if not window_minutes or not table:
+        return None
+    try:
+        targets = resolve_resources(resource)
+    except UnresolvedResourceError:
+        return None
+    if not targets:
+        return None
+
+    items = boto3.client('dynamodb').query(
+        TableName=table,
+        IndexName='by-resource',
+        KeyConditionExpression='resource_id = :resource AND updated_at >= :since',
+        FilterExpression='finding_type = :type AND finding_id <> :finding AND #status IN (:open, :escalated)',
+        ExpressionAttributeNames={'#status': 'status'},
+        ExpressionAttributeValues={
+            ':resource': {'S': index_target(targets[0], pii_scrub_fields())},
+            ':since': {'N': str(now - window_minutes * 60)},
+            ':type': {'S': finding_type},
+            ':finding': {'S': finding_id},
+            ':open': {'S': RESPONDED_STATUSES[0]},
+            ':escalated': {'S': RESPONDED_STATUSES[1]}
+        },
+        ScanIndexForward=False
+    ).get('Items', [])
+    if not items:
+        return None
+
+    previous = items[0]['finding_id']['S']
+    return {
+        'previous_finding_id': previous,
+        'previous_triaged_at': int(items[0]['updated_at']['N']),
+        'previous_evidence': evidence_key(previous, classification)
+    }
+
+def is_buffered_batch(event):
+    """
+    Findings buffered in the SQS queue between EventBridge and triage arrive as
+    a batch of SQS records, each holding one EventBridge event.
+    """
+    records = event.get('Records') or []
+    return bool(records) and records[0].get('eventSource') == 'aws:sqs'
+
+def triage_buffered_batch(event, context):
+    """
+    Triage each buffered finding on its own. Only the findings that fail are
+    reported back, so SQS redelivers those and deletes the rest of the batch.
+    """
+    failures = []
+    for record in event['Records']:
+        try:
+            lambda_handler(json.loads(record['body']), context)
+        except Exception as e:
+            print(f"ERROR: buffered message {record['messageId']} failed: {e}")
+            failures.append({'itemIdentifier': record['messageId']})
+
+    print(f"Triaged {len(event['Records']) - len(failures)} of {len(event['Records'])} buffered findings")
+    return {'batchItemFailures': failures}
+
+def enable_flow_logs(ec2_client, instance_id, finding_id):
+    """
+    Enable VPC flow logs on every network interface of an instance being
+    quarantined so its traffic is captured for forensics. Interfaces that
+    already deliver to the quarantine log group are left alone. Returns the
+    IDs of the interfaces covered.
+    """
+    log_group = os.environ.get('FLOW_LOGS_LOG_GROUP', '')
+    role_arn = os.environ.get('FLOW_LOGS_ROLE_ARN', '')
+    if os.environ.get('ENABLE_FLOW_LOGS', 'false') != 'true' or not log_group or not role_arn:
+        return []
+
+    reservations = ec2_client.describe_instances(InstanceIds=[instance_id])['Reservations']
+    eni_ids = [
+        eni['NetworkInterfaceId']
+        for reservation in reservations
+        for instance in reservation['Instances']
+        for eni in instance.get('NetworkInterfaces', [])
+    ]
+    if not eni_ids:
+        return []
+
+    existing = ec2_client.describe_flow_logs(
+        Filters=[
+            {'Name': 'resource-id', 'Values': eni_ids},
+            {'Name': 'log-group-name', 'Values': [log_group]}
+        ]
+    )['FlowLogs']
+    covered = {flow_log['ResourceId'] for flow_log in existing}
+    missing = [eni_id for eni_id in eni_ids if eni_id not in covered]
+
+    if missing:
+        response = ec2_client.create_flow_logs(
+            ResourceIds=missing,
+            ResourceType='NetworkInterface',
+            TrafficType='ALL',
+            LogDestinationType='cloud-watch-logs',
+            LogGroupName=log_group,
+            DeliverLogsPermissionArn=role_arn,
+            MaxAggregationInterval=60,
+            TagSpecifications=[{
+                'ResourceType': 'vpc-flow-log',
+                'Tags': [{'Key': 'GuardDutyFinding', 'Value': finding_id}]
+            }]
+        )
+        if response.get('Unsuccessful'):
+            raise RuntimeError(f"Failed to enable flow logs: {response['Unsuccessful']}")
+        print(f"Enabled flow logs on {missing} for instance {instance_id}")
+
+    return eni_ids
+
+def detach_from_auto_scaling(instance_id):
+    """
+    Detach an instance being quarantined from its Auto Scaling group, so the
+    group launches a replacement rather than terminating the forensic target
+    once it fails health checks in isolation. The group's desired capacity is
+    kept. Returns the group's name, or None if the instance is not in one.
+    """
+    autoscaling_client = boto3.client('autoscaling')
+    instances = autoscaling_client.describe_auto_scaling_instances(
+        InstanceIds=[instance_id]
+    )['AutoScalingInstances']
+    if not instances:
+        return None
+
+    group_name = instances[0]['AutoScalingGroupName']
+    autoscaling_client.detach_instances(
+        InstanceIds=[instance_id],
+        AutoScalingGroupName=group_name,
+        ShouldDecrementDesiredCapacity=False
+    )
+    print(f"Detached instance {instance_id} from Auto Scaling group {group_name}")
+    return group_name
+
+def lambda_handler(event, context, deferred_at=None):
     """
     Lambda function to triage GuardDuty findings.
     - Parses the event
+    - Ignores findings archived in GuardDuty or closed in Security Hub
+    - Escalates findings that recur on a resource within the recurrence window
+    - Records and notifies about findings from sandbox accounts without
+      containing them or paging
+    - Defers containment while it is paused, and drains deferred findings
+      when invoked by the resume schedule
+    - Triages batches from the SQS buffer one finding at a time
     - Tags implicated resources
-    - Stores evidence in S3
+    - Detaches instances being quarantined from their Auto Scaling group
+    - Enables flow logs on instances being quarantined
+    - Enriches findings with the location, ASN and reputation of remote IPs
+    - Snapshots ECS tasks into the evidence before they are stopped
+    - Stores evidence in S3, scrubbed of PII when configured, and records the
+      finding in the incident index
     - Triggers Step Functions for remediation
     - Publishes notification to SNS
     """
     try:
+        if event.get('source') == DRAIN_EVENT_SOURCE:
+            return drain_deferred(context)
+        if is_buffered_batch(event):
+            return triage_buffered_batch(event, context)
+
+        # Custom findings from Security Hub are handled exactly like GuardDuty ones;
+        # the raw event is kept for the deferral queue
+        raw_event = event
+        event = normalize_securityhub_event(event)
+
         # Parse the GuardDuty finding event
         detail = event.get('detail', {})
         finding_id = detail.get('id', 'unknown')
@@ -19,24 +979,158 @@ def lambda_handler(event, context):
 
         print(f"Processing finding: {finding_id} with severity: {severity}")
 
-        # Store raw event in S3 evidence bucket
+        # Findings closed by an analyst, or by the workflow itself, raise events
+        # of their own; they are not responded to again
+        closed = closed_reason(detail)
+        if closed:
+            print(f"Finding {finding_id} is {closed}, not responded to")
+            return {
+                'statusCode': 200,
+                'body': json.dumps({
+                    'message': f'Finding {closed}, no response',
+                    'finding_id': finding_id
+                })
+            }
+
         s3_client = boto3.client('s3')
         evidence_bucket = os.environ['EVIDENCE_BUCKET']
-        s3_key = f'findings/{finding_id}.json'
+        resource = detail.get('resource', {})
+        classification = data_classification(resource)
+        s3_key = evidence_key(finding_id, classification)
 
-        s3_client.put_object(
-            Bucket=evidence_bucket,
-            Key=s3_key,
-            Body=json.dumps(event),
-            ContentType='application/json'
-        )
+        # GuardDuty re-publishes a finding on every update; only escalations and
+        # updates after the dedup window are triaged again
+        triaged_at = int(time.time())
+        window_minutes = int(os.environ.get('DEDUP_WINDOW_MINUTES', '0'))
+        previous = previous_triage(s3_client, evidence_bucket, s3_key)
+        # A drained finding is the deferred triage itself, so only an earlier
+        # full triage makes it a duplicate
+        if deferred_at is not None and previous is not None:
+            previous = {key: value for key, value in previous.items() if key != 'deferred-at'}
+        decision = dedup_decision(previous, severity, triaged_at, window_minutes)
+        if decision == 'duplicate':
+            print(f"Suppressed duplicate of finding {finding_id} within {window_minutes} minutes")
+            return {
+                'statusCode': 200,
+                'body': json.dumps({
+                    'message': 'Duplicate finding suppressed',
+                    'finding_id': finding_id
+                })
+            }
+        print(f"Triaging finding {finding_id}: {decision}")
+
+        account = context.invoked_function_arn.split(':')[4]
+        finding_type = detail.get('type', '')
+
+        # Findings from sandbox accounts take the low-priority path: recorded and
+        # notified, but neither contained nor paged about
+        finding_account, account_classification = account_class(event, detail)
+        sandbox = account_classification == 'sandbox'
+
+        # A finding that recurs on a resource soon after an earlier one was dealt
+        # with is escalated: contained regardless of a pause and paged as CRITICAL
+        recurrence = None if sandbox else find_recurrence(finding_id, finding_type, resource, classification, triaged_at)
+        if recurrence:
+            print(f"Finding {finding_id} recurs {recurrence['previous_finding_id']}, escalating")
+
+        instance_id = None
+        if resource.get('resourceType') == 'Instance':
+            instance_id = resource.get('instanceDetails', {}).get('instanceId')
+        exempt = is_exempt(boto3.client('ec2'), instance_id, os.environ.get('EXEMPTION_TAG', ''))
+
+        # During a change freeze the finding is recorded and queued; it is triaged
+        # when the pause is lifted. Updates arriving before the dedup window is
+        # over are taken for duplicates of the deferral.
+        if not exempt and not sandbox and deferred_at is None and not recurrence and containment_paused():
+            store_finding_evidence(s3_client, evidence_bucket, s3_key, event, finding_id, account,
+                                   {'severity': str(severity), 'deferred-at': str(triaged_at)}, context)
+            boto3.client('sqs').send_message(
+                QueueUrl=os.environ['DEFERRED_QUEUE_URL'],
+                MessageBody=json.dumps(raw_event),
+                MessageAttributes={'deferred-at': {'DataType': 'Number', 'StringValue': str(triaged_at)}}
+            )
+            index_incident(finding_id, finding_type, [], severity, 'deferred', triaged_at)
+            print(f"Containment paused: finding {finding_id} recorded and deferred")
+            return {
+                'statusCode': 200,
+                'body': json.dumps({
+                    'message': 'Containment paused, finding deferred',
+                    'finding_id': finding_id
+                })
+            }
+
+        # Store raw event in S3 evidence bucket, keeping the dedup state with it
+        metadata = {'severity': str(severity), 'triaged-at': str(triaged_at)}
+        if classification:
+            metadata['data-classification'] = classification
+        if exempt:
+            metadata['exempt'] = 'true'
+        if sandbox:
+            metadata['account-class'] = account_classification
+        if deferred_at:
+            metadata['deferred-at'] = deferred_at
+        canary = is_canary(detail)
+        if canary:
+            metadata['canary'] = 'true'
+        if recurrence:
+            metadata['recurrence-of'] = recurrence['previous_finding_id']
+        # An unknown resource type keeps its evidence but is flagged on it and
+        # counted, so the gap in containment alarms instead of going unnoticed
+        targets = []
+        try:
+            targets = resolve_resources(resource)
+            metadata['resources'] = ','.join(targets)
+        except UnresolvedResourceError as e:
+            print(f"ERROR: finding {finding_id}: {e}")
+            metadata['unresolved-resource-type'] = str(resource.get('resourceType'))
+            boto3.client('cloudwatch').put_metric_data(
+                Namespace=METRICS_NAMESPACE,
+                MetricData=[{
+                    'MetricName': 'UnresolvedResources',
+                    'Dimensions': [{'Name': 'FunctionName', 'Value': context.function_name}],
+                    'Value': 1,
+                    'Unit': 'Count'
+                }]
+            )
+        kubernetes = kubernetes_context(resource)
+        metadata.update({f'kubernetes-{key}': value for key, value in kubernetes.items()})
+        evidence = event
+        if recurrence:
+            evidence = dict(evidence, recurrence=recurrence)
+        enrichment = enrich_finding(detail, context)
+        if enrichment:
+            evidence = dict(evidence, enrichment=enrichment)
+            metadata['enrichment'] = enrichment['status']
+            metadata['remote-ips'] = ','.join(ip['ip'] for ip in enrichment['ips'])
+            if enrichment.get('reputation'):
+                metadata['reputation'] = enrichment['reputation']
+        # A stopped task cannot be described for long, so it is snapshotted with the finding
+        ecs_task = ecs_task_snapshot(resource)
+        if ecs_task:
+            evidence = dict(evidence, ecsTask=ecs_task)
+            metadata['ecs-task'] = ecs_task['task']['taskArn']
+            metadata['ecs-task-definition'] = ecs_task['taskDefinition']['taskDefinitionArn']
+            if ecs_task['host']:
+                metadata['ecs-host'] = ecs_task['host']
+        store_finding_evidence(s3_client, evidence_bucket, s3_key, evidence, finding_id, account, metadata, context)
         print(f"Stored evidence in s3://{evidence_bucket}/{s3_key}")
+        status = 'exempt' if exempt else 'sandbox' if sandbox else 'escalated' if recurrence else 'open'
+        index_incident(finding_id, finding_type, targets, severity, status, triaged_at,
+                       recurrence['previous_finding_id'] if recurrence else '')
+
+        # Exempt instances are on record but are neither isolated nor paged about
+        if exempt:
+            print(f"Exempt instance {instance_id}: finding {finding_id} recorded, not isolated or paged")
+            return {
+                'statusCode': 200,
+                'body': json.dumps({
+                    'message': 'Exempt resource, evidence recorded',
+                    'finding_id': finding_id
+                })
+            }
 
         # Tag implicated resource if it's an EC2 instance
-        resource = detail.get('resource', {})
-        if resource.get('resourceType') == 'Instance':
-            instance_details = resource.get('instanceDetails', {})
-            instance_id = instance_details.get('instanceId')
+        if resource.get('resourceType') == 'Instance' and not sandbox:
             if instance_id:
                 ec2_client = boto3.client('ec2')
                 ec2_client.create_tags(
@@ -48,35 +1142,99 @@ def lambda_handler(event, context):
                 )
                 print(f"Tagged instance {instance_id} with finding {finding_id}")
 
+                # Detach before the workflow isolates the instance; the group
+                # would otherwise replace it by terminating it
+                group_name = detach_from_auto_scaling(instance_id)
+                if group_name:
+                    ec2_client.create_tags(
+                        Resources=[instance_id],
+                        Tags=[{'Key': 'DetachedFromAutoScalingGroup', 'Value': group_name}]
+                    )
+
+                # Capture the instance's traffic from the moment it is quarantined
+                enable_flow_logs(ec2_client, instance_id, finding_id)
+
+        # Recurrences are handled as CRITICAL whatever their own severity
+        label = 'CRITICAL' if recurrence else severity_label(severity)
+
         # Trigger Step Functions state machine for remediation
-        state_machine_arn = os.environ['STATE_MACHINE_ARN']
-        sfn_client = boto3.client('stepfunctions')
-        execution_name = f'IR-{finding_id.replace("/", "-")}'
-
-        sfn_client.start_execution(
-            stateMachineArn=state_machine_arn,
-            name=execution_name,
-            input=json.dumps(event)
-        )
-        print(f"Started Step Functions execution: {execution_name}")
+        if sandbox:
+            print(f"Sandbox account {finding_account}: finding {finding_id} recorded, not contained")
+        else:
+            state_machine_arn = os.environ['STATE_MACHINE_ARN']
+            sfn_client = boto3.client('stepfunctions')
+            # The finding ID is the correlation ID; each triage of it gets its own execution
+            execution_name = f'{execution_prefix(finding_id)}{triaged_at}'
+
+            # The workflow contains each resolved resource in its own Map iteration; the severity label
+            # and finding account let it notify about containment failures with the attributes
+            # subscriptions filter on.
+            # Execution data is logged and queued for remediation, so it is scrubbed like the evidence;
+            # no containment branch acts on the identifiers scrubbing covers.
+            fields = pii_scrub_fields()
+            execution_input = dict(scrub_pii(event, fields), targets=redact_targets(targets, fields),
+                                   severity_label=label, finding_account=finding_account)
+            if recurrence:
+                execution_input['recurrence'] = recurrence
+            sfn_client.start_execution(
+                stateMachineArn=state_machine_arn,
+                name=execution_name,
+                input=json.dumps(execution_input)
+            )
+            print(f"Started Step Functions execution: {execution_name}")
+
+        if canary:
+            print(f"Canary finding {finding_id} triaged, notification suppressed")
+            return {
+                'statusCode': 200,
+                'body': json.dumps({
+                    'message': 'Canary triaged, notification suppressed',
+                    'finding_id': finding_id
+                })
+            }
 
-        # Publish notification to SNS
+        # Publish notification to SNS; CRITICAL findings page through the urgent topic,
+        # except from sandbox accounts
         sns_topic_arn = os.environ['SNS_TOPIC_ARN']
+        if label == 'CRITICAL' and not sandbox and os.environ.get('URGENT_SNS_TOPIC_ARN'):
+            sns_topic_arn = os.environ['URGENT_SNS_TOPIC_ARN']
         sns_client = boto3.client('sns')
 
         message = {
             'finding_id': finding_id,
             'severity': severity,
             'resource_type': resource.get('resourceType'),
+            'resource': resource,
             'action': 'Triage completed, remediation initiated'
         }
+        if recurrence:
+            message['action'] = 'Recurring finding escalated, remediation initiated'
+            message['recurrence'] = recurrence
+        if sandbox:
+            message['action'] = 'Sandbox account finding recorded, no containment'
+            message['account_id'] = finding_account
+        if kubernetes:
+            message['kubernetes'] = kubernetes
+        if enrichment:
+            message['enrichment'] = enrichment
+        fields = pii_scrub_fields()
+        if fields:
+            message = scrub_pii(message, fields)
 
         sns_client.publish(
             TopicArn=sns_topic_arn,
             Message=json.dumps(message),
-            Subject=f'GuardDuty Finding Triage: {finding_id}'
+            Subject=notification_subject(finding_id),
+            # Subscription filter policies match on these attributes
+            MessageAttributes={
+                'severity': {'DataType': 'String', 'StringValue': label},
+                'resource_type': {'DataType': 'String', 'StringValue': resource.get('resourceType') or 'Unknown'},
+                # The account the finding is about, a member account in org mode, not the stack's
+                'account_id': {'DataType': 'String', 'StringValue': finding_account or account},
+                'account_class': {'DataType': 'String', 'StringValue': account_classification}
+            }
         )
-        print(f"Published notification to SNS topic")
+        print(f"Published {label} notification for finding {finding_id} to SNS topic {sns_topic_arn}")
 
         return {
             'statusCode': 200,
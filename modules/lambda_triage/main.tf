@@ -1,3 +1,8 @@
+locals {
+  # Remote IPs looked up per finding, bounding how long lookups that time out hold up triage
+  threat_intel_max_lookups = 5
+}
+
 data "archive_file" "triage" {
   type        = "zip"
   source_file = "${path.module}/lambda-src/triage.py"
@@ -5,22 +10,239 @@ data "archive_file" "triage" {
 }
 
 resource "aws_lambda_function" "triage" {
-  function_name = "guardduty-triage"
-  runtime       = "python3.9"
+  function_name = "${var.name_prefix}guardduty-triage"
+  runtime       = "python3.12"
   handler       = "triage.lambda_handler"
   role          = var.iam_role_arn
+  memory_size   = var.memory_size
+  timeout       = 300
+
+  reserved_concurrent_executions = var.reserved_concurrency
+  code_signing_config_arn        = var.code_signing_config_arn
 
   filename         = data.archive_file.triage.output_path
   source_code_hash = data.archive_file.triage.output_base64sha256
 
   environment {
     variables = {
-      EVIDENCE_BUCKET   = var.evidence_bucket_name
-      SNS_TOPIC_ARN     = var.sns_topic_arn
-      STATE_MACHINE_ARN = var.state_machine_arn
-      QUARANTINE_SG_ID  = var.quarantine_sg_id
+      EVIDENCE_BUCKET      = var.evidence_bucket_name
+      EVIDENCE_KMS_KEY     = var.evidence_kms_key_arn
+      SNS_TOPIC_ARN        = var.sns_topic_arn
+      URGENT_SNS_TOPIC_ARN = var.urgent_sns_topic_arn
+      STATE_MACHINE_ARN    = var.state_machine_arn
+      QUARANTINE_SG_ID     = var.quarantine_sg_id
+
+      DEDUP_WINDOW_MINUTES = tostring(var.dedup_window_minutes)
+      EXEMPTION_TAG        = var.exemption_tag
+
+      CONTAINMENT_PAUSE_PARAMETER = aws_ssm_parameter.containment_paused.name
+      DEFERRED_QUEUE_URL          = aws_sqs_queue.deferred.url
+
+      # ARNs only; secret values are fetched at runtime and never placed in the environment
+      INTEGRATION_SECRET_ARNS = jsonencode(var.integration_secret_arns)
+
+      ENABLE_FLOW_LOGS    = tostring(var.enable_flow_logs)
+      FLOW_LOGS_LOG_GROUP = var.flow_logs_log_group_name
+      FLOW_LOGS_ROLE_ARN  = var.flow_logs_role_arn
+
+      INCIDENT_TABLE    = try(aws_dynamodb_table.incidents[0].name, "")
+      INCIDENT_TTL_DAYS = tostring(var.incident_ttl_days)
+
+      RECURRENCE_WINDOW_MINUTES = tostring(var.recurrence_window_minutes)
+      ACCOUNT_CLASSIFICATION    = jsonencode(var.account_classification)
+
+      THREAT_INTEL_ENDPOINT        = var.threat_intel_endpoint
+      THREAT_INTEL_PROVIDER        = var.threat_intel_provider
+      THREAT_INTEL_TIMEOUT_SECONDS = tostring(var.threat_intel_timeout_seconds)
+      THREAT_INTEL_MAX_LOOKUPS     = tostring(local.threat_intel_max_lookups)
+
+      DATA_CLASSIFICATIONS    = jsonencode(var.data_classifications)
+      DATA_CLASSIFICATION_TAG = var.data_classification_tag
+
+      PII_SCRUB_FIELDS = jsonencode(var.pii_scrub_fields)
+
+      # Read by boto3 itself
+      AWS_USE_FIPS_ENDPOINT = tostring(var.use_fips_endpoints)
+    }
+  }
+
+  lifecycle {
+    # Earlier findings on a resource are looked up in the incident index
+    precondition {
+      condition     = var.recurrence_window_minutes == 0 || var.enable_incident_index
+      error_message = "recurrence_window_minutes needs enable_incident_index."
     }
   }
 
   tags = var.tags
-}
\ No newline at end of file
+}
+
+# Change-freeze switch: while "true", findings are recorded and queued instead of contained.
+# Operators flip it with put-parameter, so Terraform only creates it.
+resource "aws_ssm_parameter" "containment_paused" {
+  name        = "/ir/${var.name_prefix}containment-paused"
+  description = "Set to true to defer containment of new findings until it is set back to false"
+  type        = "String"
+  value       = "false"
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+
+  tags = var.tags
+}
+
+# Findings that arrive during a pause wait here; their evidence is already stored
+resource "aws_sqs_queue" "deferred" {
+  name                      = "${var.name_prefix}ir-deferred-findings"
+  message_retention_seconds = 1209600
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.deferred_dlq.arn
+    maxReceiveCount     = var.deferred_max_receive_count
+  })
+
+  # Enable server-side encryption
+  sqs_managed_sse_enabled = true
+
+  tags = var.tags
+}
+
+# Deferred findings that failed triage deferred_max_receive_count times
+resource "aws_sqs_queue" "deferred_dlq" {
+  name                      = "${var.name_prefix}ir-deferred-findings-dlq"
+  message_retention_seconds = 1209600
+
+  # Enable server-side encryption
+  sqs_managed_sse_enabled = true
+
+  tags = var.tags
+}
+
+# Drains deferred findings once the pause is lifted
+resource "aws_cloudwatch_event_rule" "drain_deferred" {
+  name                = "${var.name_prefix}ir-drain-deferred-findings"
+  description         = "Triage findings deferred while containment was paused"
+  schedule_expression = var.drain_interval_minutes == 1 ? "rate(1 minute)" : "rate(${var.drain_interval_minutes} minutes)"
+
+  tags = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "drain_deferred" {
+  rule  = aws_cloudwatch_event_rule.drain_deferred.name
+  arn   = aws_lambda_function.triage.arn
+  input = jsonencode({ source = "ir.containment-resume" })
+}
+
+resource "aws_lambda_permission" "drain_deferred" {
+  statement_id  = "AllowDrainScheduleInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.triage.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.drain_deferred.arn
+}
+
+# Optional buffer between EventBridge and triage, so bursts of findings are absorbed by the queue
+# instead of throttling the function
+resource "aws_sqs_queue" "buffer" {
+  count = var.enable_sqs_buffer ? 1 : 0
+
+  name = "${var.name_prefix}ir-finding-buffer"
+  # Lambda needs the visibility timeout to cover the function timeout; six times leaves room for retries
+  visibility_timeout_seconds = 6 * aws_lambda_function.triage.timeout
+  message_retention_seconds  = 1209600
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.buffer_dlq[0].arn
+    maxReceiveCount     = var.buffer_max_receive_count
+  })
+
+  # Enable server-side encryption
+  sqs_managed_sse_enabled = true
+
+  tags = var.tags
+}
+
+# Buffered findings that failed triage buffer_max_receive_count times
+resource "aws_sqs_queue" "buffer_dlq" {
+  count = var.enable_sqs_buffer ? 1 : 0
+
+  name                      = "${var.name_prefix}ir-finding-buffer-dlq"
+  message_retention_seconds = 1209600
+
+  # Enable server-side encryption
+  sqs_managed_sse_enabled = true
+
+  tags = var.tags
+}
+
+resource "aws_lambda_event_source_mapping" "buffer" {
+  count = var.enable_sqs_buffer ? 1 : 0
+
+  event_source_arn                   = aws_sqs_queue.buffer[0].arn
+  function_name                      = aws_lambda_function.triage.arn
+  batch_size                         = var.buffer_batch_size
+  maximum_batching_window_in_seconds = var.buffer_batching_window_seconds
+
+  # Only the failed findings of a batch are redelivered
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+# Optional incident index: one item per finding, queryable by resource and by status
+resource "aws_dynamodb_table" "incidents" {
+  count = var.enable_incident_index ? 1 : 0
+
+  name         = "${var.name_prefix}ir-incidents"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "finding_id"
+
+  attribute {
+    name = "finding_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "resource_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "updated_at"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "by-resource"
+    hash_key        = "resource_id"
+    range_key       = "updated_at"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "by-status"
+    hash_key        = "status"
+    range_key       = "updated_at"
+    projection_type = "ALL"
+  }
+
+  # Items expire incident_ttl_days after the finding was last triaged
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = var.tags
+}
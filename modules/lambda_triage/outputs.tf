@@ -6,4 +6,44 @@ output "function_name" {
 output "function_arn" {
   description = "ARN of the Lambda triage function"
   value       = aws_lambda_function.triage.arn
-}
\ No newline at end of file
+}
+
+output "containment_pause_parameter_name" {
+  description = "SSM parameter that pauses containment while set to true"
+  value       = aws_ssm_parameter.containment_paused.name
+}
+
+output "buffer_queue_arn" {
+  description = "ARN of the SQS buffer in front of the function (empty without the buffer)"
+  value       = try(aws_sqs_queue.buffer[0].arn, "")
+}
+
+output "buffer_queue_url" {
+  description = "URL of the SQS buffer in front of the function (empty without the buffer)"
+  value       = try(aws_sqs_queue.buffer[0].url, "")
+}
+
+output "buffer_dlq_url" {
+  description = "URL of the dead-letter queue for buffered findings that failed triage (empty without the buffer)"
+  value       = try(aws_sqs_queue.buffer_dlq[0].url, "")
+}
+
+output "buffer_dlq_name" {
+  description = "Name of the dead-letter queue for buffered findings that failed triage (empty without the buffer)"
+  value       = try(aws_sqs_queue.buffer_dlq[0].name, "")
+}
+
+output "deferred_dlq_url" {
+  description = "URL of the dead-letter queue for deferred findings that repeatedly failed triage"
+  value       = aws_sqs_queue.deferred_dlq.url
+}
+
+output "deferred_dlq_name" {
+  description = "Name of the dead-letter queue for deferred findings that repeatedly failed triage"
+  value       = aws_sqs_queue.deferred_dlq.name
+}
+
+output "incident_table_name" {
+  description = "Name of the DynamoDB incident index (empty without enable_incident_index)"
+  value       = try(aws_dynamodb_table.incidents[0].name, "")
+}
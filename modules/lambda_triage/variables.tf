@@ -3,11 +3,22 @@ variable "evidence_bucket_name" {
   type        = string
 }
 
+variable "evidence_kms_key_arn" {
+  description = "ARN of the KMS key evidence objects are encrypted with"
+  type        = string
+}
+
 variable "sns_topic_arn" {
   description = "ARN of the SNS topic for notifications"
   type        = string
 }
 
+variable "urgent_sns_topic_arn" {
+  description = "ARN of the SNS topic CRITICAL findings are published to instead of sns_topic_arn (empty sends everything to sns_topic_arn)"
+  type        = string
+  default     = ""
+}
+
 variable "state_machine_arn" {
   description = "ARN of the Step Functions state machine"
   type        = string
@@ -28,6 +39,218 @@ variable "cloudwatch_log_group_arn" {
   type        = string
 }
 
+variable "memory_size" {
+  description = "Memory size in MB for the Lambda function (128 is the Lambda default)"
+  type        = number
+  default     = 128
+}
+
+variable "reserved_concurrency" {
+  description = "Reserved concurrent executions for the Lambda function (null leaves it unreserved)"
+  type        = number
+  default     = null
+}
+
+variable "code_signing_config_arn" {
+  description = "Code signing config for the Lambda function (null disables code signing)"
+  type        = string
+  default     = null
+}
+
+variable "enable_flow_logs" {
+  description = "Enable VPC flow logs on the network interfaces of instances being quarantined"
+  type        = bool
+  default     = true
+}
+
+variable "flow_logs_log_group_name" {
+  description = "Name of the CloudWatch log group receiving quarantine flow logs"
+  type        = string
+  default     = ""
+}
+
+variable "flow_logs_role_arn" {
+  description = "ARN of the role VPC Flow Logs uses to deliver to the log group"
+  type        = string
+  default     = ""
+}
+
+variable "dedup_window_minutes" {
+  description = "Minutes during which updates of an already triaged finding at the same or lower severity are suppressed (0 disables deduplication)"
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.dedup_window_minutes >= 0
+    error_message = "dedup_window_minutes must not be negative"
+  }
+}
+
+variable "exemption_tag" {
+  description = "Instance tag (key=value) that exempts an instance from isolation and paging; findings are still recorded as evidence. Empty disables exemptions"
+  type        = string
+  default     = "ir:exempt=true"
+
+  validation {
+    condition     = var.exemption_tag == "" || can(regex("^[^=]+=.*$", var.exemption_tag))
+    error_message = "exemption_tag must be empty or of the form key=value"
+  }
+}
+
+variable "drain_interval_minutes" {
+  description = "Minutes between checks for findings to triage after a containment pause is lifted"
+  type        = number
+  default     = 5
+
+  validation {
+    condition     = var.drain_interval_minutes >= 1
+    error_message = "drain_interval_minutes must be at least 1"
+  }
+}
+
+variable "integration_secret_arns" {
+  description = "Secrets Manager ARNs of third-party integration credentials, keyed by integration (e.g. slack, jira)"
+  type        = map(string)
+  default     = {}
+}
+
+variable "enable_sqs_buffer" {
+  description = "Buffer findings in an SQS queue between EventBridge and the function instead of invoking it directly"
+  type        = bool
+  default     = false
+}
+
+variable "buffer_batch_size" {
+  description = "Maximum number of buffered findings triaged per invocation"
+  type        = number
+  default     = 10
+
+  validation {
+    condition     = var.buffer_batch_size >= 1 && var.buffer_batch_size <= 10000
+    error_message = "buffer_batch_size must be between 1 and 10000"
+  }
+}
+
+variable "buffer_batching_window_seconds" {
+  description = "Seconds to gather buffered findings into a batch before invoking the function"
+  type        = number
+  default     = 0
+}
+
+variable "deferred_max_receive_count" {
+  description = "Drains that may fail to triage a deferred finding before it moves to the deferred dead-letter queue"
+  type        = number
+  default     = 5
+}
+
+variable "buffer_max_receive_count" {
+  description = "Deliveries of a buffered finding before it moves to the buffer dead-letter queue"
+  type        = number
+  default     = 5
+}
+
+variable "enable_incident_index" {
+  description = "Record each triaged finding in a DynamoDB incident table indexed by resource and status"
+  type        = bool
+  default     = false
+}
+
+variable "incident_ttl_days" {
+  description = "Days after its last triage when an incident item expires"
+  type        = number
+  default     = 365
+
+  validation {
+    condition     = var.incident_ttl_days >= 1
+    error_message = "incident_ttl_days must be at least 1"
+  }
+}
+
+variable "recurrence_window_minutes" {
+  description = "Minutes after a finding is triaged during which a new finding of the same type on the same resource is escalated as a recurrence: paged as CRITICAL, contained even while containment is paused, and linked to the earlier finding's evidence. Needs enable_incident_index (0 disables escalation)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.recurrence_window_minutes >= 0
+    error_message = "recurrence_window_minutes must not be negative"
+  }
+}
+
+variable "account_classification" {
+  description = "Class of each account ID whose findings triage handles, production or sandbox. Findings from sandbox accounts are recorded and notified on the standard topic but neither contained nor paged about; unlisted accounts are production"
+  type        = map(string)
+  default     = {}
+
+  validation {
+    condition     = alltrue([for id, class in var.account_classification : can(regex("^[0-9]{12}$", id)) && contains(["production", "sandbox"], class)])
+    error_message = "account_classification must map 12-digit account IDs to production or sandbox"
+  }
+}
+
+variable "threat_intel_endpoint" {
+  description = "HTTPS endpoint queried through the threat_intel_provider API for the reputation of remote IPs in findings (empty disables the lookups)"
+  type        = string
+  default     = ""
+
+  validation {
+    condition     = var.threat_intel_endpoint == "" || startswith(var.threat_intel_endpoint, "https://")
+    error_message = "threat_intel_endpoint must be an https:// URL"
+  }
+}
+
+variable "threat_intel_provider" {
+  description = "API the threat intel endpoint speaks: generic (<endpoint>/ip/<address>), virustotal (v3) or otx (AlienVault OTX); the API key is read from the integration_secret_arns entry of the same name"
+  type        = string
+  default     = "generic"
+
+  validation {
+    condition     = contains(["generic", "virustotal", "otx"], var.threat_intel_provider)
+    error_message = "threat_intel_provider must be generic, virustotal or otx"
+  }
+}
+
+variable "threat_intel_timeout_seconds" {
+  description = "Seconds a threat intel lookup may take before the IP is left without a reputation"
+  type        = number
+  default     = 3
+
+  validation {
+    condition     = var.threat_intel_timeout_seconds >= 1 && var.threat_intel_timeout_seconds <= 10
+    error_message = "threat_intel_timeout_seconds must be between 1 and 10"
+  }
+}
+
+variable "data_classifications" {
+  description = "Data classifications with a retention class of their own; evidence of resources tagged with one is stored under classified/<class>/"
+  type        = list(string)
+  default     = []
+}
+
+variable "data_classification_tag" {
+  description = "Resource tag whose value, lowercased, is the resource's data classification"
+  type        = string
+  default     = "DataClassification"
+}
+
+variable "pii_scrub_fields" {
+  description = "Finding fields redacted from stored evidence and notifications, with the raw finding kept under restricted/ in the evidence bucket (empty disables scrubbing)"
+  type        = list(string)
+  default     = []
+}
+
+variable "use_fips_endpoints" {
+  description = "Have boto3 use FIPS endpoints for every AWS call the function makes"
+  type        = bool
+  default     = false
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for Lambda resources"
   type        = map(string)
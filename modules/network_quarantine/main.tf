@@ -2,9 +2,115 @@
 resource "aws_security_group" "quarantine" {
   name        = var.sg_name
   description = "Security group for quarantining compromised resources - denies all inbound and outbound traffic"
+  vpc_id      = var.vpc_id
 
   tags = var.tags
 
   # No ingress rules - deny all inbound traffic
-  # No egress rules - deny all outbound traffic
-}
\ No newline at end of file
+  # No egress rules - deny all outbound traffic, except HTTPS to the SSM endpoints when allow_ssm_endpoints is set
+}
+
+# A security group can only be attached to interfaces in its own VPC, so every other VPC holding
+# resources that may be isolated gets a group of its own, under the same name and fully isolated
+resource "aws_security_group" "quarantine_additional" {
+  for_each = toset(var.additional_vpc_ids)
+
+  name        = var.sg_name
+  description = "Security group for quarantining compromised resources - denies all inbound and outbound traffic"
+  vpc_id      = each.key
+
+  tags = var.tags
+}
+
+# Deny-all network ACLs for NACL-based isolation, one per VPC. A network ACL without rules denies
+# everything; subnets are only associated with it when a resource in them is isolated.
+resource "aws_network_acl" "quarantine" {
+  count = var.create_quarantine_nacls ? 1 : 0
+
+  vpc_id = aws_security_group.quarantine.vpc_id
+
+  tags = merge(var.tags, { Name = var.sg_name })
+}
+
+resource "aws_network_acl" "quarantine_additional" {
+  for_each = var.create_quarantine_nacls ? toset(var.additional_vpc_ids) : toset([])
+
+  vpc_id = each.key
+
+  tags = merge(var.tags, { Name = var.sg_name })
+}
+
+# Optional Session Manager access for responders: interface endpoints for SSM in the quarantine VPC, reachable
+# from the quarantine group on 443 only, so isolated hosts stay manageable without any route to the internet
+data "aws_region" "current" {}
+
+data "aws_vpc" "quarantine" {
+  count = var.allow_ssm_endpoints ? 1 : 0
+
+  id      = var.vpc_id
+  default = var.vpc_id == null ? true : null
+}
+
+data "aws_subnets" "endpoints" {
+  count = var.allow_ssm_endpoints && length(var.endpoint_subnet_ids) == 0 ? 1 : 0
+
+  filter {
+    name   = "vpc-id"
+    values = [data.aws_vpc.quarantine[0].id]
+  }
+
+  filter {
+    name   = "default-for-az"
+    values = ["true"]
+  }
+}
+
+locals {
+  ssm_endpoint_services = var.allow_ssm_endpoints ? toset(["ssm", "ssmmessages", "ec2messages"]) : toset([])
+  endpoint_subnet_ids   = length(var.endpoint_subnet_ids) > 0 ? var.endpoint_subnet_ids : try(data.aws_subnets.endpoints[0].ids, [])
+}
+
+resource "aws_security_group" "ssm_endpoints" {
+  count = var.allow_ssm_endpoints ? 1 : 0
+
+  name        = "${var.sg_name}-ssm-endpoints"
+  description = "SSM interface endpoints reachable from quarantined resources"
+  vpc_id      = data.aws_vpc.quarantine[0].id
+
+  tags = var.tags
+}
+
+resource "aws_vpc_security_group_ingress_rule" "ssm_endpoints_from_quarantine" {
+  count = var.allow_ssm_endpoints ? 1 : 0
+
+  security_group_id            = aws_security_group.ssm_endpoints[0].id
+  referenced_security_group_id = aws_security_group.quarantine.id
+  ip_protocol                  = "tcp"
+  from_port                    = 443
+  to_port                      = 443
+  description                  = "HTTPS from quarantined resources"
+}
+
+resource "aws_vpc_security_group_egress_rule" "quarantine_to_ssm_endpoints" {
+  count = var.allow_ssm_endpoints ? 1 : 0
+
+  security_group_id            = aws_security_group.quarantine.id
+  referenced_security_group_id = aws_security_group.ssm_endpoints[0].id
+  ip_protocol                  = "tcp"
+  from_port                    = 443
+  to_port                      = 443
+  description                  = "HTTPS to the SSM endpoints for Session Manager"
+}
+
+resource "aws_vpc_endpoint" "ssm" {
+  for_each = local.ssm_endpoint_services
+
+  vpc_id              = data.aws_vpc.quarantine[0].id
+  service_name        = "com.amazonaws.${data.aws_region.current.name}.${each.key}"
+  vpc_endpoint_type   = "Interface"
+  subnet_ids          = local.endpoint_subnet_ids
+  security_group_ids  = [aws_security_group.ssm_endpoints[0].id]
+  private_dns_enabled = true
+
+  tags = var.tags
+}
@@ -1,4 +1,32 @@
 output "quarantine_sg_id" {
   description = "ID of the quarantine security group"
   value       = aws_security_group.quarantine.id
-}
\ No newline at end of file
+}
+
+output "additional_quarantine_sg_ids" {
+  description = "IDs of the quarantine security groups in the additional VPCs"
+  value       = [for group in aws_security_group.quarantine_additional : group.id]
+}
+
+output "quarantine_sg_ids_by_vpc" {
+  description = "Quarantine security group of every VPC, keyed by VPC ID"
+  value = merge(
+    { (aws_security_group.quarantine.vpc_id) = aws_security_group.quarantine.id },
+    { for vpc_id, group in aws_security_group.quarantine_additional : vpc_id => group.id },
+  )
+}
+
+output "quarantine_nacl_ids" {
+  description = "IDs of the deny-all quarantine network ACLs (empty unless create_quarantine_nacls is set)"
+  value       = concat(aws_network_acl.quarantine[*].id, [for acl in aws_network_acl.quarantine_additional : acl.id])
+}
+
+output "ssm_endpoint_network_interface_ids" {
+  description = "Network interfaces of the SSM endpoints reachable from the quarantine group (empty under full isolation)"
+  value       = flatten([for endpoint in aws_vpc_endpoint.ssm : endpoint.network_interface_ids])
+}
+
+output "ssm_endpoints_sg_id" {
+  description = "ID of the SSM endpoints security group (empty under full isolation)"
+  value       = try(aws_security_group.ssm_endpoints[0].id, "")
+}
@@ -3,6 +3,36 @@ variable "sg_name" {
   type        = string
 }
 
+variable "vpc_id" {
+  description = "VPC for the quarantine security group (null uses the default VPC)"
+  type        = string
+  default     = null
+}
+
+variable "additional_vpc_ids" {
+  description = "Other VPCs that get a quarantine security group of their own (full isolation, no SSM endpoints)"
+  type        = list(string)
+  default     = []
+}
+
+variable "create_quarantine_nacls" {
+  description = "Create a deny-all network ACL in every VPC for NACL-based isolation"
+  type        = bool
+  default     = false
+}
+
+variable "allow_ssm_endpoints" {
+  description = "Let quarantined resources reach SSM interface endpoints so responders keep Session Manager access"
+  type        = bool
+  default     = false
+}
+
+variable "endpoint_subnet_ids" {
+  description = "Subnets for the SSM endpoints, one per AZ (empty uses the VPC's default subnets)"
+  type        = list(string)
+  default     = []
+}
+
 variable "tags" {
   description = "Tags for the security group"
   type        = map(string)
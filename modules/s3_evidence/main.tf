@@ -1,3 +1,5 @@
+data "aws_caller_identity" "current" {}
+
 # KMS Key for S3 encryption
 resource "aws_kms_key" "evidence" {
   description             = "KMS key for S3 evidence bucket encryption"
@@ -24,10 +26,74 @@ resource "aws_s3_bucket_versioning" "logs" {
   }
 }
 
+# Server access logs are delivered by the logging service principal, which needs an explicit grant
+# because ACLs are disabled on new buckets
+resource "aws_s3_bucket_policy" "logs" {
+  bucket = aws_s3_bucket.logs.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Sid    = "AllowServerAccessLogDelivery"
+        Effect = "Allow"
+        Principal = {
+          Service = "logging.s3.amazonaws.com"
+        }
+        Action   = "s3:PutObject"
+        Resource = "${aws_s3_bucket.logs.arn}/access-logs/*"
+        Condition = {
+          ArnLike = {
+            "aws:SourceArn" = aws_s3_bucket.evidence.arn
+          }
+          StringEquals = {
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+        }
+      },
+      {
+        Sid       = "DenyInsecureTransport"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = "s3:*"
+        Resource = [
+          aws_s3_bucket.logs.arn,
+          "${aws_s3_bucket.logs.arn}/*"
+        ]
+        Condition = {
+          Bool = {
+            "aws:SecureTransport" = "false"
+          }
+        }
+      },
+      {
+        Sid       = "DenyOutdatedTLS"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = "s3:*"
+        Resource = [
+          aws_s3_bucket.logs.arn,
+          "${aws_s3_bucket.logs.arn}/*"
+        ]
+        Condition = {
+          NumericLessThan = {
+            "s3:TlsVersion" = "1.2"
+          }
+        }
+      }
+    ]
+  })
+}
+
 # Evidence bucket
 resource "aws_s3_bucket" "evidence" {
   bucket = var.bucket_name
-  tags   = var.tags
+
+  # Lets evidence be put under legal hold; no default retention is set, so nothing is locked until
+  # a hold is placed
+  object_lock_enabled = var.object_lock_enabled
+
+  tags = var.tags
 }
 
 resource "aws_s3_bucket_versioning" "evidence" {
@@ -48,12 +114,95 @@ resource "aws_s3_bucket_server_side_encryption_configuration" "evidence" {
   }
 }
 
+locals {
+  default_retention = {
+    retention_days               = var.retention_days
+    glacier_transition_days      = var.glacier_transition_days
+    deep_archive_transition_days = var.deep_archive_transition_days
+  }
+
+  # Rules may not overlap on expiration, or the earliest wins, so with a
+  # retention matrix the default rule covers findings/ only and each class its
+  # own prefix. Raw copies kept under restricted/ by PII scrubbing follow the
+  # retention of the evidence they were scrubbed into.
+  retention_rules = merge(
+    {
+      "evidence-retention" = merge(local.default_retention, { prefix = length(var.retention_matrix) > 0 ? "findings/" : "" })
+    },
+    {
+      for id, prefix in { "raw-evidence-retention" = "restricted/findings/" } :
+      id => merge(local.default_retention, { prefix = prefix }) if length(var.retention_matrix) > 0
+    },
+    { for class, rules in var.retention_matrix : "evidence-retention-${class}" => merge(rules, { prefix = "classified/${class}/" }) },
+    { for class, rules in var.retention_matrix : "raw-evidence-retention-${class}" => merge(rules, { prefix = "restricted/classified/${class}/" }) },
+  )
+}
+
+# Evidence is archived in two tiers and expires at the end of the retention period
+resource "aws_s3_bucket_lifecycle_configuration" "evidence" {
+  bucket = aws_s3_bucket.evidence.id
+
+  dynamic "rule" {
+    for_each = local.retention_rules
+
+    content {
+      id     = rule.key
+      status = "Enabled"
+
+      filter {
+        prefix = rule.value.prefix
+      }
+
+      dynamic "transition" {
+        for_each = rule.value.glacier_transition_days == null ? [] : [rule.value.glacier_transition_days]
+
+        content {
+          days          = transition.value
+          storage_class = "GLACIER"
+        }
+      }
+
+      dynamic "transition" {
+        for_each = rule.value.deep_archive_transition_days == null ? [] : [rule.value.deep_archive_transition_days]
+
+        content {
+          days          = transition.value
+          storage_class = "DEEP_ARCHIVE"
+        }
+      }
+
+      expiration {
+        days = rule.value.retention_days
+      }
+
+      noncurrent_version_expiration {
+        noncurrent_days = rule.value.retention_days
+      }
+    }
+  }
+
+  depends_on = [aws_s3_bucket_versioning.evidence]
+
+  lifecycle {
+    # Glacier and Deep Archive bill a minimum of 90 and 180 days
+    precondition {
+      condition     = var.deep_archive_transition_days >= var.glacier_transition_days + 90
+      error_message = "deep_archive_transition_days must be at least 90 days after glacier_transition_days."
+    }
+
+    precondition {
+      condition     = var.retention_days >= var.deep_archive_transition_days + 180
+      error_message = "retention_days must be at least 180 days after deep_archive_transition_days."
+    }
+  }
+}
+
 resource "aws_s3_bucket_policy" "evidence" {
   bucket = aws_s3_bucket.evidence.id
 
   policy = jsonencode({
     Version = "2012-10-17"
-    Statement = [
+    Statement = concat([
       {
         Sid       = "DenyInsecureTransport"
         Effect    = "Deny"
@@ -80,8 +229,37 @@ resource "aws_s3_bucket_policy" "evidence" {
             "s3:x-amz-server-side-encryption" = "aws:kms"
           }
         }
+      },
+      {
+        Sid       = "DenyOutdatedTLS"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = "s3:*"
+        Resource = [
+          aws_s3_bucket.evidence.arn,
+          "${aws_s3_bucket.evidence.arn}/*"
+        ]
+        Condition = {
+          NumericLessThan = {
+            "s3:TlsVersion" = "1.2"
+          }
+        }
       }
-    ]
+      ], [
+      # Raw findings kept by PII scrubbing may only be read by the listed principals
+      for readers in [var.restricted_reader_arns] : {
+        Sid       = "DenyRestrictedReads"
+        Effect    = "Deny"
+        Principal = "*"
+        Action    = ["s3:GetObject", "s3:GetObjectVersion"]
+        Resource  = "${aws_s3_bucket.evidence.arn}/restricted/*"
+        Condition = {
+          ArnNotLike = {
+            "aws:PrincipalArn" = readers
+          }
+        }
+      } if length(readers) > 0
+    ])
   })
 }
 
@@ -118,4 +296,122 @@ resource "aws_s3_bucket_public_access_block" "logs" {
   block_public_policy     = true
   ignore_public_acls      = true
   restrict_public_buckets = true
-}
\ No newline at end of file
+}
+# Cross-region replication of evidence to a standby bucket, e.g. the evidence bucket of the stack in
+# the recovery region, so responders can still read it when this region is lost
+resource "aws_iam_role" "replication" {
+  count = var.replica_bucket_arn != "" ? 1 : 0
+
+  name = "${var.name_prefix}ir-evidence-replication-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "s3.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "replication" {
+  count = var.replica_bucket_arn != "" ? 1 : 0
+
+  name = "${var.name_prefix}ir-evidence-replication-policy"
+  role = aws_iam_role.replication[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:GetReplicationConfiguration",
+          "s3:ListBucket"
+        ]
+        Resource = aws_s3_bucket.evidence.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:GetObjectVersionForReplication",
+          "s3:GetObjectVersionAcl",
+          "s3:GetObjectVersionTagging"
+        ]
+        Resource = "${aws_s3_bucket.evidence.arn}/*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:ReplicateObject",
+          "s3:ReplicateTags"
+        ]
+        Resource = "${var.replica_bucket_arn}/*"
+      },
+      {
+        # Evidence is decrypted with this bucket's key and re-encrypted with the replica's
+        Effect   = "Allow"
+        Action   = "kms:Decrypt"
+        Resource = aws_kms_key.evidence.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "kms:Encrypt",
+          "kms:GenerateDataKey"
+        ]
+        Resource = var.replica_kms_key_arn
+      }
+    ]
+  })
+}
+
+resource "aws_s3_bucket_replication_configuration" "evidence" {
+  count = var.replica_bucket_arn != "" ? 1 : 0
+
+  bucket = aws_s3_bucket.evidence.id
+  role   = aws_iam_role.replication[0].arn
+
+  rule {
+    id     = "evidence-replica"
+    status = "Enabled"
+
+    filter {}
+
+    # Evidence is never deleted by the pipeline; deletions stay local to this region
+    delete_marker_replication {
+      status = "Disabled"
+    }
+
+    source_selection_criteria {
+      sse_kms_encrypted_objects {
+        status = "Enabled"
+      }
+    }
+
+    destination {
+      bucket        = var.replica_bucket_arn
+      storage_class = "STANDARD"
+
+      encryption_configuration {
+        replica_kms_key_id = var.replica_kms_key_arn
+      }
+    }
+  }
+
+  depends_on = [aws_s3_bucket_versioning.evidence, aws_iam_role_policy.replication]
+
+  lifecycle {
+    # The evidence bucket only holds KMS-encrypted objects, so replicas must be re-encrypted too
+    precondition {
+      condition     = var.replica_kms_key_arn != ""
+      error_message = "replica_kms_key_arn is required with replica_bucket_arn."
+    }
+  }
+}
@@ -3,7 +3,22 @@ output "bucket_name" {
   value       = aws_s3_bucket.evidence.bucket
 }
 
+output "bucket_arn" {
+  description = "ARN of the S3 evidence bucket"
+  value       = aws_s3_bucket.evidence.arn
+}
+
 output "kms_key_arn" {
   description = "ARN of the KMS key for S3 encryption"
   value       = aws_kms_key.evidence.arn
-}
\ No newline at end of file
+}
+
+output "logs_bucket_name" {
+  description = "Name of the bucket receiving the evidence bucket's server access logs"
+  value       = aws_s3_bucket.logs.bucket
+}
+
+output "replication_role_arn" {
+  description = "ARN of the role replicating evidence to the replica bucket (empty without replication)"
+  value       = try(aws_iam_role.replication[0].arn, "")
+}
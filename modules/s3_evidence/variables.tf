@@ -8,6 +8,77 @@ variable "kms_alias" {
   type        = string
 }
 
+variable "glacier_transition_days" {
+  description = "Days after creation when evidence moves to S3 Glacier Flexible Retrieval"
+  type        = number
+  default     = 90
+}
+
+variable "deep_archive_transition_days" {
+  description = "Days after creation when evidence moves to S3 Glacier Deep Archive"
+  type        = number
+  default     = 180
+}
+
+variable "retention_days" {
+  description = "Days after creation when evidence expires"
+  type        = number
+  default     = 365
+}
+
+variable "retention_matrix" {
+  description = "Lifecycle per data classification, applied to evidence under classified/<class>/; when set, the bucket-wide glacier_transition_days, deep_archive_transition_days and retention_days cover findings/ only"
+  type = map(object({
+    retention_days               = number
+    glacier_transition_days      = optional(number)
+    deep_archive_transition_days = optional(number)
+  }))
+  default = {}
+
+  validation {
+    condition     = alltrue([for class in keys(var.retention_matrix) : can(regex("^[a-z0-9-]+$", class))])
+    error_message = "retention_matrix classes must be lowercase letters, digits and hyphens"
+  }
+
+  validation {
+    condition = alltrue([for rules in values(var.retention_matrix) : rules.retention_days > max(
+      coalesce(rules.glacier_transition_days, 0),
+      coalesce(rules.deep_archive_transition_days, 0)
+    )])
+    error_message = "retention_matrix retention_days must come after the class's transitions"
+  }
+}
+
+variable "restricted_reader_arns" {
+  description = "IAM principals allowed to read the raw findings PII scrubbing keeps under restricted/; empty leaves them to IAM like the rest of the evidence"
+  type        = list(string)
+  default     = []
+}
+
+variable "object_lock_enabled" {
+  description = "Enable S3 Object Lock on the evidence bucket so evidence can be put under legal hold (changing it replaces the bucket)"
+  type        = bool
+  default     = false
+}
+
+variable "replica_bucket_arn" {
+  description = "ARN of a versioned bucket in another region that evidence is replicated to; empty disables replication"
+  type        = string
+  default     = ""
+}
+
+variable "replica_kms_key_arn" {
+  description = "ARN of the KMS key replicas are encrypted with in the replica bucket's region; required with replica_bucket_arn"
+  type        = string
+  default     = ""
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for S3 resources"
   type        = map(string)
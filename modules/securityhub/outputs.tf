@@ -1,7 +1,7 @@
 output "hub_arns" {
   description = "List of Security Hub hub ARNs"
   value = [
-    "arn:aws:securityhub:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:hub/default"
+    "arn:${data.aws_partition.current.partition}:securityhub:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:hub/default"
   ]
 }
 
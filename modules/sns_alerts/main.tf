@@ -1,40 +1,179 @@
 data "aws_caller_identity" "current" {}
 
+data "aws_partition" "current" {}
+
 # KMS Key for SNS encryption
 resource "aws_kms_key" "alerts" {
   description = "KMS key for SNS topic encryption"
-  tags        = var.tags
-}
-
-# SNS Topic
-resource "aws_sns_topic" "alerts" {
-  name              = "ir-alerts-topic"
-  kms_master_key_id = aws_kms_key.alerts.id
-  tags              = var.tags
-}
-
-# SNS Topic Policy
-resource "aws_sns_topic_policy" "alerts" {
-  arn = aws_sns_topic.alerts.arn
 
+  # Publishing to an encrypted topic needs the key, so publishers are granted it here
   policy = jsonencode({
     Version = "2012-10-17"
-    Statement = [
+    Statement = concat([
       {
+        Sid    = "AccountAdministration"
         Effect = "Allow"
         Principal = {
-          AWS = "*"
+          AWS = "arn:${data.aws_partition.current.partition}:iam::${data.aws_caller_identity.current.account_id}:root"
         }
-        Action = "sns:Publish"
-        Resource = aws_sns_topic.alerts.arn
+        Action   = "kms:*"
+        Resource = "*"
+      }
+      ], length(var.publisher_role_arns) > 0 ? [
+      {
+        Sid    = "AllowPublishersToEncrypt"
+        Effect = "Allow"
+        Principal = {
+          AWS = var.publisher_role_arns
+        }
+        Action = [
+          "kms:GenerateDataKey*",
+          "kms:Decrypt"
+        ]
+        Resource = "*"
+      }
+      ] : [], [
+      {
+        # Alarm notifications to the ops topic are encrypted by CloudWatch itself
+        Sid    = "AllowCloudWatchAlarmsToEncrypt"
+        Effect = "Allow"
+        Principal = {
+          Service = "cloudwatch.amazonaws.com"
+        }
+        Action = [
+          "kms:GenerateDataKey*",
+          "kms:Decrypt"
+        ]
+        Resource = "*"
         Condition = {
           StringEquals = {
-            "AWS:SourceAccount" = data.aws_caller_identity.current.account_id
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
           }
         }
       }
-    ]
+    ])
   })
+
+  tags = var.tags
+}
+
+# SNS Topic
+resource "aws_sns_topic" "alerts" {
+  name              = "${var.name_prefix}ir-alerts-topic"
+  kms_master_key_id = aws_kms_key.alerts.id
+  tags              = var.tags
+}
+
+# Urgent topic for CRITICAL findings, meant for paging subscriptions
+resource "aws_sns_topic" "urgent" {
+  name              = "${var.name_prefix}ir-urgent-topic"
+  kms_master_key_id = aws_kms_key.alerts.id
+  tags              = var.tags
+}
+
+# Ops topic for CloudWatch alarms on the pipeline itself, kept apart from finding notifications
+resource "aws_sns_topic" "ops" {
+  name              = "${var.name_prefix}ir-ops-topic"
+  kms_master_key_id = aws_kms_key.alerts.id
+  tags              = var.tags
+}
+
+# All topics share one policy: only the pipeline's roles publish, over TLS. The ops topic also
+# takes alarm notifications from CloudWatch in this account.
+locals {
+  topic_policies = {
+    for name, topic_arn in {
+      alerts = aws_sns_topic.alerts.arn
+      urgent = aws_sns_topic.urgent.arn
+      ops    = aws_sns_topic.ops.arn
+    } : name => jsonencode({
+      Version = "2012-10-17"
+      Statement = concat([
+        {
+          Effect = "Allow"
+          Principal = {
+            AWS = "*"
+          }
+          Action   = "sns:Publish"
+          Resource = topic_arn
+          Condition = {
+            StringEquals = {
+              "AWS:SourceAccount" = data.aws_caller_identity.current.account_id
+            }
+          }
+        },
+        {
+          Sid       = "DenyInsecureTransport"
+          Effect    = "Deny"
+          Principal = "*"
+          Action    = "sns:Publish"
+          Resource  = topic_arn
+          Condition = {
+            Bool = {
+              "aws:SecureTransport" = "false"
+            }
+          }
+        }
+        ], length(var.publisher_role_arns) > 0 ? [
+        {
+          Sid    = "AllowPublisherRoles"
+          Effect = "Allow"
+          Principal = {
+            AWS = var.publisher_role_arns
+          }
+          Action   = "sns:Publish"
+          Resource = topic_arn
+        },
+        {
+          # Identity policies in the account cannot widen who may publish
+          Sid       = "DenyOtherPrincipals"
+          Effect    = "Deny"
+          Principal = "*"
+          Action    = "sns:Publish"
+          Resource  = topic_arn
+          Condition = {
+            ArnNotEquals = {
+              "aws:PrincipalArn" = var.publisher_role_arns
+            }
+            Bool = {
+              "aws:PrincipalIsAWSService" = "false"
+            }
+          }
+        }
+        ] : [], name == "ops" ? [
+        {
+          Sid    = "AllowCloudWatchAlarms"
+          Effect = "Allow"
+          Principal = {
+            Service = "cloudwatch.amazonaws.com"
+          }
+          Action   = "sns:Publish"
+          Resource = topic_arn
+          Condition = {
+            ArnLike = {
+              "aws:SourceArn" = "arn:${data.aws_partition.current.partition}:cloudwatch:*:${data.aws_caller_identity.current.account_id}:alarm:*"
+            }
+          }
+        }
+      ] : [])
+    })
+  }
+}
+
+# SNS Topic Policy
+resource "aws_sns_topic_policy" "alerts" {
+  arn    = aws_sns_topic.alerts.arn
+  policy = local.topic_policies["alerts"]
+}
+
+resource "aws_sns_topic_policy" "urgent" {
+  arn    = aws_sns_topic.urgent.arn
+  policy = local.topic_policies["urgent"]
+}
+
+resource "aws_sns_topic_policy" "ops" {
+  arn    = aws_sns_topic.ops.arn
+  policy = local.topic_policies["ops"]
 }
 
 # SNS Subscriptions
@@ -44,4 +183,24 @@ resource "aws_sns_topic_subscription" "alerts" {
   topic_arn = aws_sns_topic.alerts.arn
   protocol  = each.value.protocol
   endpoint  = each.value.endpoint
-}
\ No newline at end of file
+
+  filter_policy = each.value.filter_policy
+}
+
+resource "aws_sns_topic_subscription" "urgent" {
+  for_each = { for idx, sub in var.urgent_subscriptions : idx => sub }
+
+  topic_arn = aws_sns_topic.urgent.arn
+  protocol  = each.value.protocol
+  endpoint  = each.value.endpoint
+
+  filter_policy = each.value.filter_policy
+}
+
+resource "aws_sns_topic_subscription" "ops" {
+  for_each = { for idx, sub in var.ops_subscriptions : idx => sub }
+
+  topic_arn = aws_sns_topic.ops.arn
+  protocol  = each.value.protocol
+  endpoint  = each.value.endpoint
+}
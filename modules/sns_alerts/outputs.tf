@@ -1,4 +1,14 @@
 output "topic_arn" {
   description = "ARN of the SNS topic for IR alerts"
   value       = aws_sns_topic.alerts.arn
-}
\ No newline at end of file
+}
+
+output "urgent_topic_arn" {
+  description = "ARN of the SNS topic for CRITICAL findings"
+  value       = aws_sns_topic.urgent.arn
+}
+
+output "ops_topic_arn" {
+  description = "ARN of the SNS topic for alarms on the pipeline"
+  value       = aws_sns_topic.ops.arn
+}
@@ -1,5 +1,27 @@
 variable "subscriptions" {
   description = "List of SNS subscriptions"
+  # filter_policy is an SNS filter policy (JSON) on the message attributes severity, resource_type and account_id
+  type = list(object({
+    protocol      = string
+    endpoint      = string
+    filter_policy = optional(string)
+  }))
+  default = []
+}
+
+variable "urgent_subscriptions" {
+  description = "Subscriptions to the urgent topic, which receives CRITICAL findings only (e.g. paging integrations)"
+  # filter_policy is an SNS filter policy (JSON) on the message attributes severity, resource_type and account_id
+  type = list(object({
+    protocol      = string
+    endpoint      = string
+    filter_policy = optional(string)
+  }))
+  default = []
+}
+
+variable "ops_subscriptions" {
+  description = "Subscriptions to the ops topic, which receives CloudWatch alarms on the pipeline itself"
   type = list(object({
     protocol = string
     endpoint = string
@@ -7,6 +29,18 @@ variable "subscriptions" {
   default = []
 }
 
+variable "publisher_role_arns" {
+  description = "IAM role ARNs allowed to publish to the topic; when set, every other principal except AWS services is denied"
+  type        = list(string)
+  default     = []
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for SNS resources"
   type        = map(string)
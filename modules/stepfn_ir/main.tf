@@ -1,35 +1,871 @@
+data "aws_region" "current" {}
+
+data "aws_partition" "current" {}
+
+locals {
+  ec2_task = "arn:${data.aws_partition.current.partition}:states:::aws-sdk:ec2"
+  ecs_task = "arn:${data.aws_partition.current.partition}:states:::aws-sdk:ecs"
+
+  # ECS task targets are ecs-task:arn:...:task/<cluster>/<id>
+  ecs_task_cluster = "States.ArrayGetItem(States.StringSplit($.target, '/'), 1)"
+  ecs_task_id      = "States.ArrayGetItem(States.StringSplit($.target, '/'), 2)"
+
+  task_retry = [
+    {
+      ErrorEquals     = ["States.TaskFailed"]
+      IntervalSeconds = 2
+      MaxAttempts     = 3
+      BackoffRate     = 2
+    }
+  ]
+
+  isolation_start = {
+    "replace-all-SGs"                = "FindQuarantineGroup"
+    "attach-quarantine-additionally" = "FindQuarantineGroup"
+    "NACL-based"                     = "FindQuarantineAcl"
+  }
+
+  # A group from another VPC would be rejected as not found, so the group is looked up in the interface's VPC
+  quarantine_group_states = {
+    FindQuarantineGroup = {
+      Type     = "Task"
+      Resource = "${local.ec2_task}:describeSecurityGroups"
+      Parameters = {
+        Filters = [
+          {
+            Name       = "vpc-id"
+            "Values.$" = "States.Array($.interface.vpc)"
+          },
+          {
+            Name   = "group-id"
+            Values = concat([var.quarantine_sg_id], var.additional_quarantine_sg_ids)
+          }
+        ]
+      }
+      ResultSelector = {
+        "groups.$" = "$.SecurityGroups[*].GroupId"
+      }
+      ResultPath = "$.quarantine"
+      Retry      = local.task_retry
+      Catch = [
+        {
+          ErrorEquals = ["States.ALL"]
+          ResultPath  = "$.error"
+          Next        = "ContainmentFailed"
+        }
+      ]
+      Next = "CheckQuarantineGroup"
+    }
+    # The stack was not given this VPC in quarantine_additional_vpc_ids
+    NoQuarantineGroup = {
+      Type = "Pass"
+      Parameters = {
+        "target.$"  = "$.target"
+        "finding.$" = "$.finding"
+        status      = "failed"
+        error       = "IR.NoQuarantineGroup"
+        "cause.$"   = "States.Format('no quarantine security group in {}', $.interface.vpc)"
+      }
+      End = true
+    }
+  }
+
+  isolate_interface = {
+    Type     = "Task"
+    Resource = "${local.ec2_task}:modifyNetworkInterfaceAttribute"
+    Parameters = {
+      "NetworkInterfaceId.$" = "States.ArrayGetItem(States.StringSplit($.target, ':'), 1)"
+      "Groups.$"             = var.isolation_strategy == "attach-quarantine-additionally" ? "$.groups" : "States.Array($.quarantine.groups[0])"
+    }
+    ResultPath = null
+    Retry      = local.task_retry
+    Catch = [
+      {
+        ErrorEquals = ["States.ALL"]
+        ResultPath  = "$.error"
+        Next        = "ClassifyFailure"
+      }
+    ]
+    Next = "ContainTarget"
+  }
+
+  # What containing an interface means under each isolation_strategy
+  isolation_states = {
+    # The quarantine group replaces every group of the interface, cutting all of its traffic
+    "replace-all-SGs" = merge(local.quarantine_group_states, {
+      CheckQuarantineGroup = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.quarantine.groups[0]"
+            IsPresent = true
+            Next      = "IsolateInterface"
+          }
+        ]
+        Default = "NoQuarantineGroup"
+      }
+      IsolateInterface = local.isolate_interface
+    })
+
+    # The quarantine group is added next to the interface's groups. Security groups only ever allow
+    # traffic, so this marks the interface without cutting what its own groups allow.
+    "attach-quarantine-additionally" = merge(local.quarantine_group_states, {
+      CheckQuarantineGroup = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.quarantine.groups[0]"
+            IsPresent = true
+            Next      = "AddQuarantineGroup"
+          }
+        ]
+        Default = "NoQuarantineGroup"
+      }
+      # JSONPath has no way to append to an array
+      AddQuarantineGroup = {
+        Type          = "Pass"
+        QueryLanguage = "JSONata"
+        Output        = "{% $merge([$states.input, {'groups': $distinct($append($states.input.interface.groups, $states.input.quarantine.groups[0]))}]) %}"
+        Next          = "IsolateInterface"
+      }
+      IsolateInterface = local.isolate_interface
+    })
+
+    # The interface's subnet is moved to the deny-all quarantine network ACL of its VPC. Its groups are
+    # left alone, and every other resource in the subnet is cut off with it.
+    "NACL-based" = {
+      FindQuarantineAcl = {
+        Type     = "Task"
+        Resource = "${local.ec2_task}:describeNetworkAcls"
+        Parameters = {
+          Filters = [
+            {
+              Name       = "vpc-id"
+              "Values.$" = "States.Array($.interface.vpc)"
+            },
+            {
+              Name   = "network-acl-id"
+              Values = var.quarantine_nacl_ids
+            }
+          ]
+        }
+        ResultSelector = {
+          "acls.$" = "$.NetworkAcls[*].NetworkAclId"
+        }
+        ResultPath = "$.quarantine"
+        Retry      = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            ResultPath  = "$.error"
+            Next        = "ContainmentFailed"
+          }
+        ]
+        Next = "CheckQuarantineAcl"
+      }
+      CheckQuarantineAcl = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.quarantine.acls[0]"
+            IsPresent = true
+            Next      = "LocateSubnetAssociation"
+          }
+        ]
+        Default = "NoQuarantineAcl"
+      }
+      NoQuarantineAcl = {
+        Type = "Pass"
+        Parameters = {
+          "target.$"  = "$.target"
+          "finding.$" = "$.finding"
+          status      = "failed"
+          error       = "IR.NoQuarantineAcl"
+          "cause.$"   = "States.Format('no quarantine network ACL in {}', $.interface.vpc)"
+        }
+        End = true
+      }
+      # The network ACL of a subnet is swapped through its association, which JSONPath cannot pick out
+      # of the ACL's associations by a subnet only known at run time
+      LocateSubnetAssociation = {
+        Type          = "Task"
+        QueryLanguage = "JSONata"
+        Resource      = "${local.ec2_task}:describeNetworkAcls"
+        Arguments = {
+          Filters = [
+            {
+              Name   = "association.subnet-id"
+              Values = ["{% $states.input.interface.subnet %}"]
+            }
+          ]
+        }
+        Output = "{% $merge([$states.input, {'association': $states.result.NetworkAcls.Associations[SubnetId = $states.input.interface.subnet].NetworkAclAssociationId}]) %}"
+        Retry  = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            Output      = "{% $merge([$states.input, {'error': $states.errorOutput}]) %}"
+            Next        = "ContainmentFailed"
+          }
+        ]
+        Next = "IsolateSubnet"
+      }
+      IsolateSubnet = {
+        Type     = "Task"
+        Resource = "${local.ec2_task}:replaceNetworkAclAssociation"
+        Parameters = {
+          "AssociationId.$" = "$.association"
+          "NetworkAclId.$"  = "$.quarantine.acls[0]"
+        }
+        ResultPath = null
+        Retry      = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            ResultPath  = "$.error"
+            Next        = "ContainmentFailed"
+          }
+        ]
+        Next = "ContainTarget"
+      }
+    }
+  }
+}
+
 resource "aws_sfn_state_machine" "ir" {
-  name     = "guardduty-ir"
+  name     = "${var.name_prefix}guardduty-ir"
   role_arn = var.iam_role_arn
 
   definition = jsonencode({
     Comment = "State machine for GuardDuty Incident Response"
-    StartAt = "StoreEvidence"
+    StartAt = "CheckArchived"
     States = {
+      # GuardDuty publishes updates of archived findings too; a finding an analyst or this workflow
+      # archived is not responded to again
+      CheckArchived = {
+        Type = "Choice"
+        Choices = [
+          {
+            And = [
+              {
+                Variable  = "$.detail.service.archived"
+                IsPresent = true
+              },
+              {
+                Variable      = "$.detail.service.archived"
+                BooleanEquals = true
+              }
+            ]
+            Next = "FindingArchived"
+          }
+        ]
+        Default = "StoreEvidence"
+      }
+      FindingArchived = {
+        Type    = "Succeed"
+        Comment = "Archived findings are not responded to"
+      }
       StoreEvidence = {
         Type       = "Pass"
         Result     = "Evidence stored in S3"
         ResultPath = "$.evidence"
-        Next       = "IsolateResource"
+        Next       = "CheckTargets"
       }
+      # Triage passes the resolved resources as targets; executions started without them contain nothing
+      CheckTargets = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.targets"
+            IsPresent = true
+            Next      = "IsolateResource"
+          }
+        ]
+        Default = "NoTargets"
+      }
+      # Nothing was contained, so the finding is left open for responders rather than resolved or archived
+      NoTargets = {
+        Type    = "Succeed"
+        Comment = "No targets to contain"
+      }
+      # One containment branch per resource, aggregated into $.containment. Network interfaces are contained
+      # in their own VPC as isolation_strategy says; a branch that cannot contain its target reports failed
+      # instead of failing the whole Map, so the other targets are still contained.
       IsolateResource = {
+        Type      = "Map"
+        ItemsPath = "$.targets"
+        ItemSelector = {
+          "target.$"  = "$$.Map.Item.Value"
+          "finding.$" = "$.detail.id"
+        }
+        ItemProcessor = {
+          ProcessorConfig = {
+            Mode = "INLINE"
+          }
+          StartAt = "ClassifyTarget"
+          States = merge({
+            ClassifyTarget = {
+              Type = "Choice"
+              Choices = [
+                {
+                  Variable      = "$.target"
+                  StringMatches = "eni:*"
+                  Next          = "LocateInterface"
+                },
+                {
+                  Variable      = "$.target"
+                  StringMatches = "eks-cluster:*"
+                  Next          = "NotifyOnly"
+                },
+                {
+                  Variable      = "$.target"
+                  StringMatches = "ecs-task:*"
+                  Next          = "LocateTask"
+                }
+              ]
+              # Instances, volumes, buckets and access keys have no containment branch; their interfaces
+              # are contained through their own eni: targets
+              Default = "RecordTarget"
+            }
+            # Cordoning a node or isolating a pod needs access to the cluster's API, which the stack does
+            # not have; responders act on the Kubernetes context in the evidence and notification
+            NotifyOnly = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "notify-only"
+              }
+              End = true
+            }
+            # The host of an EC2-backed task is drained before the task is stopped, so the service
+            # scheduler relaunches it elsewhere rather than on the compromised host
+            LocateTask = {
+              Type     = "Task"
+              Resource = "${local.ecs_task}:describeTasks"
+              Parameters = {
+                "Cluster.$" = local.ecs_task_cluster
+                "Tasks.$"   = "States.Array(${local.ecs_task_id})"
+              }
+              ResultSelector = {
+                "found.$" = "States.ArrayLength($.Tasks)"
+                "hosts.$" = "$.Tasks[*].ContainerInstanceArn"
+              }
+              ResultPath = "$.task"
+              Retry      = local.task_retry
+              Catch = [
+                {
+                  ErrorEquals = ["States.ALL"]
+                  ResultPath  = "$.error"
+                  Next        = "ClassifyFailure"
+                }
+              ]
+              Next = "CheckTask"
+            }
+            CheckTask = {
+              Type = "Choice"
+              Choices = [
+                {
+                  Variable      = "$.task.found"
+                  NumericEquals = 0
+                  Next          = "TargetNotFound"
+                },
+                {
+                  Variable  = "$.task.hosts[0]"
+                  IsPresent = true
+                  Next      = "DrainHost"
+                }
+              ]
+              # Fargate tasks have no host of their own
+              Default = "StopTask"
+            }
+            DrainHost = {
+              Type     = "Task"
+              Resource = "${local.ecs_task}:updateContainerInstancesState"
+              Parameters = {
+                "Cluster.$"            = local.ecs_task_cluster
+                "ContainerInstances.$" = "$.task.hosts"
+                Status                 = "DRAINING"
+              }
+              ResultPath = null
+              Retry      = local.task_retry
+              Catch = [
+                {
+                  ErrorEquals = ["States.ALL"]
+                  ResultPath  = "$.error"
+                  Next        = "ContainmentFailed"
+                }
+              ]
+              Next = "StopTask"
+            }
+            StopTask = {
+              Type     = "Task"
+              Resource = "${local.ecs_task}:stopTask"
+              Parameters = {
+                "Cluster.$" = local.ecs_task_cluster
+                "Task.$"    = local.ecs_task_id
+                "Reason.$"  = "States.Format('Stopped by incident response for finding {}', $.finding)"
+              }
+              ResultPath = null
+              Retry      = local.task_retry
+              Catch = [
+                {
+                  ErrorEquals = ["States.ALL"]
+                  ResultPath  = "$.error"
+                  Next        = "ClassifyFailure"
+                }
+              ]
+              Next = "ContainTask"
+            }
+            # The drained hosts are on record with the result
+            ContainTask = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "isolated"
+                "hosts.$"   = "$.task.hosts"
+              }
+              End = true
+            }
+            # The quarantine group or network ACL must be in the interface's VPC, and a strategy may
+            # keep the interface's groups or isolate its subnet, so look the interface up first
+            LocateInterface = {
+              Type     = "Task"
+              Resource = "${local.ec2_task}:describeNetworkInterfaces"
+              Parameters = {
+                "NetworkInterfaceIds.$" = "States.Array(States.ArrayGetItem(States.StringSplit($.target, ':'), 1))"
+              }
+              ResultSelector = {
+                "vpc.$"    = "$.NetworkInterfaces[0].VpcId"
+                "subnet.$" = "$.NetworkInterfaces[0].SubnetId"
+                "groups.$" = "$.NetworkInterfaces[0].Groups[*].GroupId"
+              }
+              ResultPath = "$.interface"
+              Retry      = local.task_retry
+              Catch = [
+                {
+                  ErrorEquals = ["States.ALL"]
+                  ResultPath  = "$.error"
+                  Next        = "ClassifyFailure"
+                }
+              ]
+              Next = local.isolation_start[var.isolation_strategy]
+            }
+            # An interface or task cluster that no longer exists has nothing left to contain
+            ClassifyFailure = {
+              Type = "Choice"
+              Choices = [
+                {
+                  Variable      = "$.error.Cause"
+                  StringMatches = "*InvalidNetworkInterfaceID.NotFound*"
+                  Next          = "TargetNotFound"
+                },
+                {
+                  Variable      = "$.error.Cause"
+                  StringMatches = "*ClusterNotFoundException*"
+                  Next          = "TargetNotFound"
+                }
+              ]
+              Default = "ContainmentFailed"
+            }
+            TargetNotFound = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "not-found"
+              }
+              End = true
+            }
+            ContainmentFailed = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "failed"
+                "error.$"   = "$.error.Error"
+                "cause.$"   = "$.error.Cause"
+              }
+              End = true
+            }
+            ContainTarget = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "isolated"
+              }
+              End = true
+            }
+            # Reported as recorded rather than isolated, so a target no branch acted on never counts as contained
+            RecordTarget = {
+              Type = "Pass"
+              Parameters = {
+                "target.$"  = "$.target"
+                "finding.$" = "$.finding"
+                status      = "recorded"
+              }
+              End = true
+            }
+          }, local.isolation_states[var.isolation_strategy])
+        }
+        ResultSelector = {
+          "targets.$"     = "$"
+          "failed.$"      = "$[?(@.status == 'failed')]"
+          "isolated.$"    = "$[?(@.status == 'isolated')]"
+          "recorded.$"    = "$[?(@.status == 'recorded')]"
+          "notify_only.$" = "$[?(@.status == 'notify-only')]"
+        }
+        ResultPath = "$.containment"
+        Next       = "SummarizeContainment"
+      }
+      # Only the targets a containment branch isolated count, whatever the isolation strategy
+      SummarizeContainment = {
+        Type = "Pass"
+        Parameters = {
+          "targets.$"     = "$.containment.targets"
+          "failed.$"      = "$.containment.failed"
+          "isolated.$"    = "$.containment.isolated"
+          "recorded.$"    = "$.containment.recorded"
+          "notify_only.$" = "$.containment.notify_only"
+          "summary.$"     = "States.Format('{} of {} resources isolated', States.ArrayLength($.containment.isolated), States.ArrayLength($.containment.targets))"
+        }
+        ResultPath = "$.containment"
+        Next       = "CheckContainment"
+      }
+      # Evidence is kept either way, but a finding with uncontained resources is never reported as handled
+      CheckContainment = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.containment.failed[0]"
+            IsPresent = true
+            Next      = "DescribeContainmentFailure"
+          }
+        ]
+        Default = "SummarizeIsolation"
+      }
+      SummarizeIsolation = {
         Type       = "Pass"
-        Result     = "Resource isolated with quarantine security group"
+        InputPath  = "$.containment.summary"
         ResultPath = "$.isolation"
         Next       = "Notify"
       }
+      DescribeContainmentFailure = {
+        Type = "Pass"
+        Parameters = {
+          "finding_id.$"    = "$.detail.id"
+          "severity.$"      = "$.detail.severity"
+          "resource_type.$" = "$.detail.resource.resourceType"
+          action            = "Containment partially failed"
+          "failures.$"      = "$.containment.failed"
+        }
+        ResultPath = "$.failure"
+        Next       = "NotifyContainmentFailure"
+      }
+      NotifyContainmentFailure = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::sns:publish"
+        Parameters = {
+          TopicArn    = var.sns_topic_arn
+          "Message.$" = "States.JsonToString($.failure)"
+          MessageAttributes = {
+            severity = {
+              DataType        = "String"
+              "StringValue.$" = "$.severity_label"
+            }
+            resource_type = {
+              DataType        = "String"
+              "StringValue.$" = "$.detail.resource.resourceType"
+            }
+            account_id = {
+              DataType        = "String"
+              "StringValue.$" = "$.finding_account"
+            }
+          }
+        }
+        ResultSelector = {
+          "message_id.$" = "$.MessageId"
+        }
+        ResultPath = "$.failure.notification"
+        Retry      = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            ResultPath  = "$.failure.notification_error"
+            Next        = "QueueForRemediation"
+          }
+        ]
+        Next = "QueueForRemediation"
+      }
+      QueueForRemediation = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::sqs:sendMessage"
+        Parameters = {
+          QueueUrl        = aws_sqs_queue.remediation_dlq.url
+          "MessageBody.$" = "$"
+        }
+        ResultPath = null
+        Retry      = local.task_retry
+        Next       = "ContainmentPartiallyFailed"
+      }
+      ContainmentPartiallyFailed = {
+        Type  = "Fail"
+        Error = "IR.PartialFailure"
+        Cause = "Evidence was stored but some resources could not be contained; the failures are in the remediation DLQ"
+      }
       Notify = {
         Type       = "Pass"
         Result     = "Notification sent via SNS"
         ResultPath = "$.notification"
-        Next       = "UpdateSecurityHub"
+        Next       = "CheckContained"
       }
+      # A finding is only resolved and archived once a branch isolated something and no target was merely
+      # recorded or handed to responders; otherwise it stays open in Security Hub and GuardDuty
+      CheckContained = {
+        Type = "Choice"
+        Choices = [
+          {
+            And = [
+              {
+                Variable  = "$.containment.isolated[0]"
+                IsPresent = true
+              },
+              {
+                Variable  = "$.containment.recorded[0]"
+                IsPresent = false
+              },
+              {
+                Variable  = "$.containment.notify_only[0]"
+                IsPresent = false
+              }
+            ]
+            Next = "UpdateSecurityHub"
+          }
+        ]
+        Default = "FindingLeftOpen"
+      }
+      FindingLeftOpen = {
+        Type       = "Pass"
+        Result     = "Finding left open for responders: not every resource was isolated"
+        ResultPath = "$.resolution"
+        End        = true
+      }
+      # Only findings that carry their ARN exist in Security Hub to be resolved
       UpdateSecurityHub = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.detail.arn"
+            IsPresent = true
+            Next      = "StartSecurityHubUpdate"
+          }
+        ]
+        Default = "NoSecurityHubFinding"
+      }
+      StartSecurityHubUpdate = {
+        Type       = "Pass"
+        Result     = { attempt = 1 }
+        ResultPath = "$.securityhub_attempts"
+        Next       = "ResolveSecurityHubFinding"
+      }
+      NoSecurityHubFinding = {
+        Type       = "Pass"
+        Result     = "No Security Hub finding to resolve"
+        ResultPath = "$.securityhub"
+        Next       = "UpdateGuardDuty"
+      }
+      ResolveSecurityHubFinding = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::aws-sdk:securityhub:batchUpdateFindings"
+        Parameters = {
+          FindingIdentifiers = [
+            {
+              "Id.$"     = "$.detail.arn"
+              ProductArn = "arn:${data.aws_partition.current.partition}:securityhub:${data.aws_region.current.name}::product/aws/guardduty"
+            }
+          ]
+          Workflow = {
+            Status = "RESOLVED"
+          }
+          Note = {
+            Text      = "Contained by the GuardDuty IR workflow"
+            UpdatedBy = "${var.name_prefix}guardduty-ir"
+          }
+        }
+        ResultSelector = {
+          "unprocessed.$" = "$.UnprocessedFindings"
+        }
+        ResultPath = "$.securityhub_update"
+        Retry      = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            ResultPath  = "$.securityhub_error"
+            Next        = "RecordCompensation"
+          }
+        ]
+        Next = "CheckSecurityHubResolved"
+      }
+      # Security Hub imports GuardDuty findings minutes after GuardDuty publishes them, and leaves a
+      # finding it has not imported yet unprocessed instead of failing; the update is retried until
+      # the import has had time to happen
+      CheckSecurityHubResolved = {
+        Type = "Choice"
+        Choices = [
+          {
+            And = [
+              {
+                Variable  = "$.securityhub_update.unprocessed[0]"
+                IsPresent = true
+              },
+              {
+                Variable                 = "$.securityhub_attempts.attempt"
+                NumericGreaterThanEquals = var.securityhub_update_attempts
+              }
+            ]
+            Next = "SecurityHubNotImported"
+          },
+          {
+            Variable  = "$.securityhub_update.unprocessed[0]"
+            IsPresent = true
+            Next      = "AwaitSecurityHubImport"
+          }
+        ]
+        Default = "SecurityHubResolved"
+      }
+      AwaitSecurityHubImport = {
+        Type    = "Wait"
+        Seconds = 60
+        Next    = "CountSecurityHubAttempt"
+      }
+      CountSecurityHubAttempt = {
+        Type = "Pass"
+        Parameters = {
+          "attempt.$" = "States.MathAdd($.securityhub_attempts.attempt, 1)"
+        }
+        ResultPath = "$.securityhub_attempts"
+        Next       = "ResolveSecurityHubFinding"
+      }
+      SecurityHubNotImported = {
+        Type = "Pass"
+        Parameters = {
+          Error     = "IR.SecurityHubNotImported"
+          "Cause.$" = "States.JsonToString($.securityhub_update.unprocessed)"
+        }
+        ResultPath = "$.securityhub_error"
+        Next       = "RecordCompensation"
+      }
+      SecurityHubResolved = {
         Type       = "Pass"
         Result     = "Finding marked as resolved in Security Hub"
         ResultPath = "$.securityhub"
+        Next       = "UpdateGuardDuty"
+      }
+      # Only findings that carry their detector came from GuardDuty to be archived there
+      UpdateGuardDuty = {
+        Type = "Choice"
+        Choices = [
+          {
+            Variable  = "$.detail.service.detectorId"
+            IsPresent = true
+            Next      = "ArchiveGuardDutyFinding"
+          }
+        ]
+        Default = "NoGuardDutyFinding"
+      }
+      NoGuardDutyFinding = {
+        Type       = "Pass"
+        Result     = "No GuardDuty finding to archive"
+        ResultPath = "$.guardduty"
         End        = true
       }
+      ArchiveGuardDutyFinding = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::aws-sdk:guardduty:archiveFindings"
+        Parameters = {
+          "DetectorId.$" = "$.detail.service.detectorId"
+          "FindingIds.$" = "States.Array($.detail.id)"
+        }
+        ResultPath = null
+        Retry      = local.task_retry
+        Catch = [
+          {
+            ErrorEquals = ["States.ALL"]
+            ResultPath  = "$.guardduty_error"
+            Next        = "RecordArchiveCompensation"
+          }
+        ]
+        Next = "GuardDutyArchived"
+      }
+      GuardDutyArchived = {
+        Type       = "Pass"
+        Result     = "Finding archived in GuardDuty"
+        ResultPath = "$.guardduty"
+        End        = true
+      }
+      # As with Security Hub, nothing is rolled back when archiving fails; the finding stays active in
+      # GuardDuty and the record goes to the remediation DLQ as the work item
+      RecordArchiveCompensation = {
+        Type = "Pass"
+        Parameters = {
+          failed_state = "UpdateGuardDuty"
+          "error.$"    = "$.guardduty_error.Error"
+          "cause.$"    = "$.guardduty_error.Cause"
+          retained     = ["evidence", "isolation", "notification", "securityhub"]
+          rolled_back  = []
+        }
+        ResultPath = "$.compensation"
+        Next       = "QueueArchiveCompensation"
+      }
+      QueueArchiveCompensation = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::sqs:sendMessage"
+        Parameters = {
+          QueueUrl        = aws_sqs_queue.remediation_dlq.url
+          "MessageBody.$" = "$"
+        }
+        ResultPath = null
+        Retry      = local.task_retry
+        Next       = "GuardDutyArchiveFailed"
+      }
+      GuardDutyArchiveFailed = {
+        Type  = "Fail"
+        Error = "IR.GuardDutyArchiveFailed"
+        Cause = "The finding was contained but could not be archived in GuardDuty; the compensation record is in the remediation DLQ"
+      }
+      # By design nothing is rolled back when the Security Hub update fails: the evidence, the isolation
+      # and the notification all stand, since undoing containment over a bookkeeping failure would put
+      # the resource back in reach. The record says so and goes to the remediation DLQ as the work item.
+      RecordCompensation = {
+        Type = "Pass"
+        Parameters = {
+          failed_state = "UpdateSecurityHub"
+          "error.$"    = "$.securityhub_error.Error"
+          "cause.$"    = "$.securityhub_error.Cause"
+          retained     = ["evidence", "isolation", "notification"]
+          rolled_back  = []
+        }
+        ResultPath = "$.compensation"
+        Next       = "QueueCompensation"
+      }
+      QueueCompensation = {
+        Type     = "Task"
+        Resource = "arn:${data.aws_partition.current.partition}:states:::sqs:sendMessage"
+        Parameters = {
+          QueueUrl        = aws_sqs_queue.remediation_dlq.url
+          "MessageBody.$" = "$"
+        }
+        ResultPath = null
+        Retry      = local.task_retry
+        Next       = "SecurityHubUpdateFailed"
+      }
+      SecurityHubUpdateFailed = {
+        Type  = "Fail"
+        Error = "IR.SecurityHubUpdateFailed"
+        Cause = "The finding was contained but could not be resolved in Security Hub; the compensation record is in the remediation DLQ"
+      }
     }
   })
 
@@ -39,5 +875,17 @@ resource "aws_sfn_state_machine" "ir" {
     level                  = "ALL"
   }
 
+  tags = var.tags
+}
+
+# Findings whose containment partially failed, or that were compensated after a later step failed,
+# for manual remediation
+resource "aws_sqs_queue" "remediation_dlq" {
+  name = "${var.name_prefix}ir-remediation-dlq"
+
+  # Kept for the SQS maximum of 14 days
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
   tags = var.tags
 }
\ No newline at end of file
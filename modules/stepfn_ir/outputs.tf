@@ -1,4 +1,14 @@
 output "state_machine_arn" {
   description = "ARN of the Step Functions IR state machine"
   value       = aws_sfn_state_machine.ir.arn
-}
\ No newline at end of file
+}
+
+output "remediation_dlq_url" {
+  description = "URL of the queue receiving findings whose containment partially failed"
+  value       = aws_sqs_queue.remediation_dlq.url
+}
+
+output "remediation_dlq_name" {
+  description = "Name of the queue receiving findings whose containment partially failed"
+  value       = aws_sqs_queue.remediation_dlq.name
+}
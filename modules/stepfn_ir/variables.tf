@@ -13,6 +13,29 @@ variable "quarantine_sg_id" {
   type        = string
 }
 
+variable "additional_quarantine_sg_ids" {
+  description = "Quarantine security groups in other VPCs; each interface is moved into the group of its own VPC"
+  type        = list(string)
+  default     = []
+}
+
+variable "isolation_strategy" {
+  description = "How interfaces are contained: replace-all-SGs, attach-quarantine-additionally or NACL-based"
+  type        = string
+  default     = "replace-all-SGs"
+
+  validation {
+    condition     = contains(["replace-all-SGs", "attach-quarantine-additionally", "NACL-based"], var.isolation_strategy)
+    error_message = "isolation_strategy must be replace-all-SGs, attach-quarantine-additionally or NACL-based"
+  }
+}
+
+variable "quarantine_nacl_ids" {
+  description = "Deny-all network ACLs, one per VPC, that subnets are moved to under NACL-based isolation"
+  type        = list(string)
+  default     = []
+}
+
 variable "iam_role_arn" {
   description = "ARN of the IAM role for Step Functions"
   type        = string
@@ -23,6 +46,23 @@ variable "cloudwatch_log_group_arn" {
   type        = string
 }
 
+variable "securityhub_update_attempts" {
+  description = "Times a finding Security Hub has not imported yet is tried again, a minute apart, before the update counts as failed"
+  type        = number
+  default     = 10
+
+  validation {
+    condition     = var.securityhub_update_attempts >= 1 && var.securityhub_update_attempts <= 30
+    error_message = "securityhub_update_attempts must be between 1 and 30"
+  }
+}
+
+variable "name_prefix" {
+  description = "Prefix applied to resource names"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Tags for Step Functions resources"
   type        = map(string)
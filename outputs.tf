@@ -13,16 +13,91 @@ output "s3_evidence_bucket_name" {
   value       = try(module.s3_evidence.bucket_name, "")
 }
 
+output "s3_evidence_bucket_arn" {
+  description = "S3 evidence bucket ARN"
+  value       = try(module.s3_evidence.bucket_arn, "")
+}
+
 output "sns_topic_arn" {
   description = "SNS topic ARN for alerts"
   value       = try(module.sns_alerts.topic_arn, "")
 }
 
+output "sns_urgent_topic_arn" {
+  description = "SNS topic ARN for CRITICAL findings"
+  value       = try(module.sns_alerts.urgent_topic_arn, "")
+}
+
+output "sns_ops_topic_arn" {
+  description = "SNS topic ARN for alarms on the IR pipeline"
+  value       = try(module.sns_alerts.ops_topic_arn, "")
+}
+
 output "eventbridge_rule_names" {
   description = "EventBridge rule names"
   value       = try(module.eventbridge.rule_names, [])
 }
 
+output "eventbridge_dlq_url" {
+  description = "EventBridge dead-letter queue URL"
+  value       = try(module.eventbridge.dlq_url, "")
+}
+
+output "lambda_triage_buffer_queue_url" {
+  description = "SQS buffer in front of the triage function (empty without enable_sqs_buffer)"
+  value       = try(module.lambda_triage.buffer_queue_url, "")
+}
+
+output "lambda_triage_buffer_dlq_url" {
+  description = "Dead-letter queue for buffered findings that failed triage (empty without enable_sqs_buffer)"
+  value       = try(module.lambda_triage.buffer_dlq_url, "")
+}
+
+output "lambda_triage_deferred_dlq_url" {
+  description = "Dead-letter queue for findings deferred by a containment pause that repeatedly failed triage"
+  value       = module.lambda_triage.deferred_dlq_url
+}
+
+output "finding_export_bucket_name" {
+  description = "Analytics bucket receiving exported findings (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].bucket_name, "")
+}
+
+output "finding_export_delivery_stream_name" {
+  description = "Firehose delivery stream exporting findings (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].delivery_stream_name, "")
+}
+
+output "finding_export_glue_database_name" {
+  description = "Glue database of the exported findings table (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].glue_database_name, "")
+}
+
+output "finding_export_glue_table_name" {
+  description = "Glue table over the exported findings (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].glue_table_name, "")
+}
+
+output "finding_export_athena_workgroup_name" {
+  description = "Athena workgroup for querying exported findings (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].athena_workgroup_name, "")
+}
+
+output "finding_export_rule_name" {
+  description = "EventBridge rule sending findings to Firehose (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].rule_name, "")
+}
+
+output "finding_export_role_names" {
+  description = "Roles used by the finding export (empty without enable_finding_export)"
+  value       = try(module.finding_export[0].role_names, [])
+}
+
+output "lambda_triage_incident_table_name" {
+  description = "DynamoDB incident index (empty without enable_incident_index)"
+  value       = try(module.lambda_triage.incident_table_name, "")
+}
+
 output "lambda_triage_function_name" {
   description = "Lambda triage function name"
   value       = try(module.lambda_triage.function_name, "")
@@ -33,11 +108,31 @@ output "stepfn_ir_state_machine_arn" {
   value       = try(module.stepfn_ir.state_machine_arn, "")
 }
 
+output "stepfn_ir_remediation_dlq_url" {
+  description = "Queue receiving findings whose containment partially failed"
+  value       = try(module.stepfn_ir.remediation_dlq_url, "")
+}
+
 output "network_quarantine_sg_id" {
   description = "Quarantine security group ID"
   value       = try(module.network_quarantine.quarantine_sg_id, "")
 }
 
+output "network_quarantine_sg_ids_by_vpc" {
+  description = "Quarantine security group of every VPC, keyed by VPC ID"
+  value       = try(module.network_quarantine.quarantine_sg_ids_by_vpc, {})
+}
+
+output "network_quarantine_additional_sg_ids" {
+  description = "Quarantine security groups in the additional VPCs"
+  value       = try(module.network_quarantine.additional_quarantine_sg_ids, [])
+}
+
+output "network_quarantine_nacl_ids" {
+  description = "Deny-all network ACLs used by NACL-based isolation"
+  value       = try(module.network_quarantine.quarantine_nacl_ids, [])
+}
+
 output "iam_lambda_role_arn" {
   description = "IAM role ARN for Lambda"
   value       = try(module.iam_roles.lambda_role_arn, "")
@@ -46,4 +141,64 @@ output "iam_lambda_role_arn" {
 output "iam_stepfn_role_arn" {
   description = "IAM role ARN for Step Functions"
   value       = try(module.iam_roles.stepfn_role_arn, "")
-}
\ No newline at end of file
+}
+
+output "iam_lambda_role_name" {
+  description = "IAM role name for Lambda"
+  value       = try(module.iam_roles.lambda_role_name, "")
+}
+
+output "iam_stepfn_role_name" {
+  description = "IAM role name for Step Functions"
+  value       = try(module.iam_roles.stepfn_role_name, "")
+}
+
+output "lambda_log_group_name" {
+  description = "CloudWatch log group name for the Lambda triage function"
+  value       = try(module.cloudwatch.lambda_log_group_name, "")
+}
+
+output "stepfn_log_group_name" {
+  description = "CloudWatch log group name for the Step Functions IR state machine"
+  value       = try(module.cloudwatch.stepfn_log_group_name, "")
+}
+
+output "cloudwatch_alarm_names" {
+  description = "Names of the CloudWatch alarms on the IR pipeline"
+  value       = try(module.cloudwatch.alarm_names, [])
+}
+
+output "cloudwatch_dashboard_name" {
+  description = "Name of the IR operations dashboard"
+  value       = try(module.cloudwatch.dashboard_name, "")
+}
+
+output "quarantine_flow_logs_log_group_name" {
+  description = "CloudWatch log group name for flow logs from quarantined instances"
+  value       = try(module.cloudwatch.quarantine_flow_logs_log_group_name, "")
+}
+
+output "quarantine_ssm_endpoint_eni_ids" {
+  description = "Network interfaces of the SSM endpoints reachable from quarantined instances"
+  value       = try(module.network_quarantine.ssm_endpoint_network_interface_ids, [])
+}
+
+output "quarantine_ssm_endpoints_sg_id" {
+  description = "Security group of the SSM endpoints reachable from quarantined instances"
+  value       = try(module.network_quarantine.ssm_endpoints_sg_id, "")
+}
+
+output "s3_evidence_kms_key_arn" {
+  description = "KMS key ARN for evidence bucket encryption"
+  value       = try(module.s3_evidence.kms_key_arn, "")
+}
+
+output "s3_evidence_logs_bucket_name" {
+  description = "S3 bucket receiving server access logs for the evidence bucket"
+  value       = try(module.s3_evidence.logs_bucket_name, "")
+}
+
+output "containment_pause_parameter_name" {
+  description = "SSM parameter that defers containment while set to true"
+  value       = try(module.lambda_triage.containment_pause_parameter_name, "")
+}
@@ -1,5 +1,8 @@
 provider "aws" {
   region = var.region
 
+  # FedRAMP deployments send every Terraform call to FIPS 140 validated endpoints
+  use_fips_endpoint = var.use_fips_endpoints
+
   # Add profile or assume role if needed
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// TestEvidenceAccessLogs writes and reads an evidence object and waits for both operations to show
+// up in the server access logs. Delivery is best effort and can take tens of minutes, so the
+// tolerance window is set with ACCESS_LOG_TOLERANCE (default 30m).
+func TestEvidenceAccessLogs(t *testing.T) {
+	if os.Getenv("RUN_ACCESS_LOG_TESTS") == "" {
+		t.Skip("set RUN_ACCESS_LOG_TESTS=1 to wait for server access log delivery")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	tolerance := 30 * time.Minute
+	if raw := os.Getenv("ACCESS_LOG_TOLERANCE"); raw != "" {
+		var err error
+		tolerance, err = time.ParseDuration(raw)
+		require.NoError(t, err, "ACCESS_LOG_TOLERANCE must be a duration such as 45m")
+	}
+
+	suite := helpers.NewSuite(t, awsRegion, "accesslogs")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	logsBucket := terraform.Output(t, terraformOptions, "s3_evidence_logs_bucket_name")
+
+	targetBucket, prefix, err := helpers.BucketAccessLogTarget(sess, evidenceBucket)
+	require.NoError(t, err)
+	require.Equal(t, logsBucket, targetBucket, "evidence access logs must go to the stack's logs bucket")
+
+	// Access log timestamps have second precision, well within the clock skew tolerance
+	since := clock.Anchor().Start
+	key := fmt.Sprintf("findings/access-log-probe-%s.json", ns.RunID)
+
+	s3Client := s3.New(sess)
+	_, err = s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(evidenceBucket),
+		Key:                  aws.String(key),
+		Body:                 strings.NewReader(`{"probe":true}`),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+	})
+	require.NoError(t, err)
+
+	object, err := s3Client.GetObject(&s3.GetObjectInput{Bucket: aws.String(evidenceBucket), Key: aws.String(key)})
+	require.NoError(t, err)
+	object.Body.Close()
+
+	assert.NoError(t, helpers.WaitForAccessLogRecords(sess, logsBucket, prefix, evidenceBucket, []helpers.AccessLogRecord{
+		{Operation: "REST.PUT.OBJECT", Key: key},
+		{Operation: "REST.GET.OBJECT", Key: key},
+	}, since, tolerance))
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestAlarmActionWiring checks that the pipeline alarms notify the ops topic and that a forced
+// alarm reaches an SQS queue subscribed to it through sns_ops_subscriptions
+func TestAlarmActionWiring(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "alarms")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	// The queue needs the topic ARN for its policy, so Terraform subscribes it on a second apply
+	opsTopic := terraform.Output(t, terraformOptions, "sns_ops_topic_arn")
+	queue, err := helpers.CreateTestQueue(sess, opsTopic, ns.Name("ops"))
+	if queue != nil {
+		defer func() {
+			assert.NoError(t, queue.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	terraformOptions.Vars["sns_ops_subscriptions"] = []map[string]interface{}{
+		{"protocol": "sqs", "endpoint": queue.QueueARN},
+	}
+	terraform.Apply(t, terraformOptions)
+
+	alarmNames := terraform.OutputList(t, terraformOptions, "cloudwatch_alarm_names")
+	require.NotEmpty(t, alarmNames)
+
+	t.Run("AlarmsNotifyOpsTopic", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertAlarmActions(sess, ns.NamePrefix()+"ir-", opsTopic))
+	})
+
+	t.Run("OpsTopicHasConfirmedSubscription", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertConfirmedSubscription(sess, opsTopic))
+	})
+
+	t.Run("ForcedAlarmDelivered", func(t *testing.T) {
+		require.NoError(t, helpers.TriggerAlarm(sess, alarmNames[0]))
+		assert.NoError(t, helpers.WaitForAlarmNotification(sess, queue.QueueURL, alarmNames[0], 5*time.Minute))
+	})
+}
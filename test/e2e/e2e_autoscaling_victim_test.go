@@ -0,0 +1,86 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestAutoScalingVictim reports an instance of an Auto Scaling group. Triage must detach it before it
+// is isolated, so the group launches a replacement instead of terminating the forensic target on a
+// failed health check, and the replacement must come up outside quarantine.
+func TestAutoScalingVictim(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "asg")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	quarantineSGID := terraform.Output(t, terraformOptions, "network_quarantine_sg_id")
+
+	// Cleaned up before the destroy, since the isolated instance holds the quarantine group
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	group, err := set.AutoScalingGroup()
+	require.NoError(t, err)
+	target := group.Instance
+
+	finding := victims.Finding(target, ns.Name("asg-victim"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	t.Run("DetachedFromGroup", func(t *testing.T) {
+		detachedFrom, err := helpers.WaitForInstanceTag(sess, target.ID, "DetachedFromAutoScalingGroup", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, group.Name, detachedFrom)
+
+		member, err := victims.GroupOf(sess, target.ID)
+		require.NoError(t, err)
+		assert.Empty(t, member, "the quarantined instance is still in its Auto Scaling group")
+	})
+
+	t.Run("ForensicTargetKept", func(t *testing.T) {
+		execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+		require.NoError(t, err)
+		assert.Contains(t, output.ContainedTargets(), "eni:"+target.NetworkInterface)
+
+		// Failed health checks would have the group terminate it within a few minutes
+		time.Sleep(3 * time.Minute)
+		instances, err := ec2.New(sess).DescribeInstances(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{aws.String(target.ID)},
+		})
+		require.NoError(t, err)
+		require.Len(t, instances.Reservations, 1)
+		assert.Equal(t, ec2.InstanceStateNameRunning, aws.StringValue(instances.Reservations[0].Instances[0].State.Name))
+	})
+
+	t.Run("ReplacementNotQuarantined", func(t *testing.T) {
+		replacement, err := set.InServiceInstance(group, target.ID, 10*time.Minute)
+		require.NoError(t, err)
+		assert.NoError(t, helpers.AssertNotQuarantined(sess, replacement, quarantineSGID))
+	})
+}
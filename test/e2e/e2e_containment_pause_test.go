@@ -0,0 +1,73 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestContainmentPause raises a finding during a change freeze and checks that it is recorded but
+// not triaged until the pause is lifted, and that the evidence notes the deferral
+func TestContainmentPause(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "pause")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	// Draining every minute keeps the wait after the pause short
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"deferred_drain_interval_minutes": 1,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	pauseParameter := terraform.Output(t, terraformOptions, "containment_pause_parameter_name")
+
+	require.NoError(t, helpers.SetContainmentPaused(sess, pauseParameter, true))
+
+	// Not an instance, so triage does not depend on a live EC2 target
+	finding := helpers.GuardDutyFinding{
+		ID:       "test-pause-" + ns.RunID,
+		Severity: 8.5,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey"},
+	}
+	_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	t.Run("DeferredDuringPause", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, metadata["deferred-at"], "evidence must note the deferral")
+
+		// Several drain runs pass while paused without triaging the finding
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 0, 0, 3*time.Minute))
+	})
+
+	require.NoError(t, helpers.SetContainmentPaused(sess, pauseParameter, false))
+
+	t.Run("TriagedAfterPauseLifted", func(t *testing.T) {
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 1, 5*time.Minute, 0))
+
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, time.Minute)
+		require.NoError(t, err)
+		deferredAt, err := strconv.ParseInt(metadata["deferred-at"], 10, 64)
+		require.NoError(t, err, "triaged evidence must keep the deferral")
+		triagedAt, err := strconv.ParseInt(metadata["triaged-at"], 10, 64)
+		require.NoError(t, err)
+		assert.Greater(t, triagedAt, deferredAt)
+	})
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+func TestFindingDedupWindow(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	dedupWindow := 2 * time.Minute
+
+	suite := helpers.NewSuite(t, awsRegion, "dedup")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	// A short window keeps the expiry case within the test's time budget
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"finding_dedup_window_minutes": int(dedupWindow.Minutes()),
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	source := helpers.NewEventBridgeSource(sess)
+
+	// Every update carries the same finding ID, which correlates the triage executions. The
+	// resource is not an instance, so triage does not depend on a live EC2 target.
+	findingID := "test-dedup-" + ns.RunID
+	update := func(severity float64) {
+		_, err := source.Inject([]helpers.GuardDutyFinding{{
+			ID:       findingID,
+			Severity: severity,
+			Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+			Resource: map[string]interface{}{"resourceType": "AccessKey"},
+		}})
+		require.NoError(t, err)
+	}
+
+	// The subtests run in order against the same finding; each builds on the previous count
+	t.Run("NewFindingTriaged", func(t *testing.T) {
+		update(7.5)
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, findingID, 1, 5*time.Minute, 0))
+	})
+
+	t.Run("IdenticalUpdateInsideWindowSuppressed", func(t *testing.T) {
+		update(7.5)
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, findingID, 1, 0, time.Minute))
+	})
+
+	t.Run("EscalatedUpdateInsideWindowRetriaged", func(t *testing.T) {
+		update(8.5)
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, findingID, 2, 5*time.Minute, 0))
+	})
+
+	t.Run("UpdateAfterWindowRetriaged", func(t *testing.T) {
+		time.Sleep(dedupWindow + 30*time.Second)
+		update(8.5)
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, findingID, 3, 5*time.Minute, 0))
+	})
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestDualStackQuarantine reports a dual-stack victim that keeps sending IPv6 traffic and checks
+// that the quarantine group cuts IPv6 as well as IPv4, and that the flow logs triage enables
+// record the rejected IPv6 traffic for the investigation
+func TestDualStackQuarantine(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "dualstack")
+	sess, ns := suite.Session, suite.Namespace
+
+	// Deferred first so the victim VPC is deleted after the stack's quarantine group in it
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	network, err := set.DualStackNetwork()
+	require.NoError(t, err)
+
+	// The quarantine group has to live in the victim's VPC to be attached to its interface
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"quarantine_vpc_id":           network.VPCID,
+		"enable_quarantine_flow_logs": true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	quarantineSGID := terraform.Output(t, terraformOptions, "network_quarantine_sg_id")
+	names, err := helpers.ResolveStackNames(t, terraformOptions, sess)
+	require.NoError(t, err)
+	require.NotEmpty(t, names.FlowLogsLogGroupName)
+
+	instance, err := set.DualStackInstance(network)
+	require.NoError(t, err)
+	require.NotEmpty(t, instance.IPv6Address, "the victim was launched without an IPv6 address")
+	// The quarantine group cannot be destroyed while the instance still uses it
+	defer func() {
+		assert.NoError(t, helpers.TerminateTestInstance(sess, instance.ID))
+	}()
+
+	finding := victims.Finding(instance, ns.Name("dualstack-victim"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5)
+	defer func() {
+		assert.NoError(t, helpers.DeleteFlowLogsForFinding(sess, finding.ID))
+	}()
+
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	t.Run("InstanceTaggedForQuarantine", func(t *testing.T) {
+		value, err := helpers.WaitForInstanceTag(sess, instance.ID, "GuardDutyFinding", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, finding.ID, value)
+	})
+
+	// Rejected IPv6 records only count from the moment the group was swapped in
+	var quarantinedAt time.Time
+
+	t.Run("IPv6Isolated", func(t *testing.T) {
+		require.NoError(t, helpers.AssertQuarantinePolicy(sess, quarantineSGID, helpers.FullIsolation, helpers.PolicyTargets{}))
+
+		// The tag and the group change come from separate states of the IR execution
+		deadline := time.Now().Add(5 * time.Minute)
+		for {
+			err = helpers.AssertDualStackIsolated(sess, instance.ID, quarantineSGID)
+			if err == nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(15 * time.Second)
+		}
+		require.NoError(t, err)
+		quarantinedAt = time.Now()
+	})
+
+	t.Run("FlowLogsEnabled", func(t *testing.T) {
+		require.NoError(t, helpers.WaitForFlowLogsEnabled(sess, instance.ID, names.FlowLogsLogGroupName, 5*time.Minute))
+	})
+
+	t.Run("IPv6TrafficRejectedAndCaptured", func(t *testing.T) {
+		if quarantinedAt.IsZero() {
+			t.Skip("the victim was never isolated")
+		}
+		// The victim keeps pinging over IPv6; once quarantined every attempt must be logged as rejected
+		records, err := helpers.WaitForFlowRecords(sess, names.FlowLogsLogGroupName, instance.NetworkInterface,
+			instance.IPv6Address, "REJECT", quarantinedAt, 15*time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, records)
+
+		accepted, err := helpers.WaitForFlowRecords(sess, names.FlowLogsLogGroupName, instance.NetworkInterface,
+			instance.IPv6Address, "ACCEPT", quarantinedAt.Add(time.Minute), 0)
+		if err == nil {
+			t.Errorf("IPv6 traffic of %s was accepted after quarantine: %d records, first at %s", instance.ID, len(accepted), accepted[0].Start)
+		}
+	})
+}
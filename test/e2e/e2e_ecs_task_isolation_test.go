@@ -0,0 +1,104 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestECSTaskIsolation reports a task of an ECS service running on two container instances. Triage
+// must snapshot the task, its definition and its host into the evidence before the workflow drains
+// the host and stops the task, and the service's replacement task must come up on the other host,
+// with the drained one on record.
+func TestECSTaskIsolation(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "ecs")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	service, err := set.ECSService(2)
+	require.NoError(t, err)
+	task := service.Task
+	require.NotEmpty(t, task.HostID, "the victim task must run on an EC2 container instance")
+
+	finding := victims.Finding(task, ns.Name("ecs-task"), "Execution:Runtime/NewBinaryExecuted", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	t.Run("EvidenceSnapshotsTask", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, task.ARN, metadata["ecs-task"])
+		assert.Equal(t, service.TaskDefinitionARN, metadata["ecs-task-definition"])
+		assert.Equal(t, task.HostID, metadata["ecs-host"])
+
+		snapshot, err := helpers.ReadEvidenceECSTask(sess, evidenceBucket, finding.ID)
+		require.NoError(t, err)
+		assert.Equal(t, task.ARN, snapshot.Task.TaskArn)
+		assert.Equal(t, task.ContainerInstanceARN, snapshot.Task.ContainerInstanceArn)
+		require.Len(t, snapshot.Task.Containers, len(task.Containers))
+		for i, container := range snapshot.Task.Containers {
+			assert.Equal(t, aws.StringValue(task.Containers[i].Image), container.Image)
+			assert.NotEmpty(t, container.RuntimeID, "container %s has no runtime ID", container.Name)
+		}
+		assert.Equal(t, service.TaskDefinitionARN, snapshot.TaskDefinition.TaskDefinitionArn)
+		assert.NotEmpty(t, snapshot.TaskDefinition.ContainerDefinitions)
+		assert.Equal(t, task.HostID, snapshot.Host)
+	})
+
+	t.Run("TaskStoppedAndHostDrained", func(t *testing.T) {
+		execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+		require.NoError(t, err)
+		require.NotNil(t, output.Containment)
+
+		require.Len(t, output.Containment.Targets, 1)
+		result := output.Containment.Targets[0]
+		assert.Equal(t, "ecs-task:"+task.ARN, result.Target)
+		assert.Equalf(t, helpers.ContainmentIsolated, result.Status, "%s %s", result.Error, result.Cause)
+		assert.Equal(t, []string{task.ContainerInstanceARN}, result.Hosts, "the drained host must be on record")
+
+		desired, reason, err := victims.TaskStopReason(sess, task.ClusterARN, task.ARN)
+		require.NoError(t, err)
+		assert.Equal(t, ecs.DesiredStatusStopped, desired)
+		assert.Contains(t, reason, finding.ID)
+
+		status, err := victims.ContainerInstanceStatus(sess, task.ClusterARN, task.ContainerInstanceARN)
+		require.NoError(t, err)
+		assert.Equal(t, ecs.ContainerInstanceStatusDraining, status)
+	})
+
+	t.Run("NotRelaunchedOnCompromisedHost", func(t *testing.T) {
+		replacement, err := set.RunningTask(service, task.ARN, 10*time.Minute)
+		require.NoError(t, err)
+		assert.NotEqual(t, task.HostID, replacement.HostID, "the scheduler relaunched the task on the compromised host")
+	})
+}
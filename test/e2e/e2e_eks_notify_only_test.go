@@ -0,0 +1,107 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestEKSFindingNotifyOnly reports a runtime finding on a pod of an EKS cluster. The stack has no
+// access to the cluster's API, so it must not cordon or quarantine the worker node: the finding is
+// contained as notify-only, and the evidence and notification carry the pod's namespace, workload
+// and node for responders to act on.
+func TestEKSFindingNotifyOnly(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "eks")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+	quarantineSGID := terraform.Output(t, terraformOptions, "network_quarantine_sg_id")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("eks"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	// A real instance stands in for the worker node, so a wrongly isolated node would show
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+	node, err := set.Instance()
+	require.NoError(t, err)
+
+	clusterName := ns.Name("cluster")
+	workload := &victims.KubernetesWorkload{
+		ClusterARN: helpers.PartitionFor(awsRegion).Scope(awsRegion, "123456789012").EKSCluster(clusterName),
+		Namespace:  "payments",
+		Name:       "checkout-7d9f8b6c5-x2x4q",
+		Type:       "pods",
+		Node:       node,
+	}
+	finding := victims.Finding(workload, ns.Name("eks-runtime"), "Execution:Runtime/ReverseShell", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	expectedContext := map[string]string{
+		"cluster":       clusterName,
+		"namespace":     workload.Namespace,
+		"workload":      workload.Name,
+		"workload-type": workload.Type,
+		"node":          node.ID,
+	}
+
+	t.Run("EvidenceCarriesPodContext", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		for key, value := range expectedContext {
+			assert.Equal(t, value, metadata["kubernetes-"+key], key)
+		}
+	})
+
+	t.Run("ContainedAsNotifyOnly", func(t *testing.T) {
+		execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+		require.NoError(t, err)
+		require.NotNil(t, output.Containment)
+
+		require.Len(t, output.Containment.Targets, 1)
+		assert.Equal(t, "eks-cluster:"+workload.ClusterARN, output.Containment.Targets[0].Target)
+		assert.Equal(t, helpers.ContainmentNotifyOnly, output.Containment.Targets[0].Status)
+	})
+
+	t.Run("NotifiedWithPodContext", func(t *testing.T) {
+		notifications, err := helpers.WaitForNotifications(sess, subscription.QueueURL, []string{finding.ID}, 5*time.Minute, 0)
+		require.NoError(t, err)
+		assert.Equal(t, expectedContext, notifications[finding.ID].Kubernetes)
+	})
+
+	t.Run("NodeNotQuarantined", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertNotQuarantined(sess, node.ID, quarantineSGID))
+	})
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/athena"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// TestEvidenceQuery triages findings of different severities and resources and checks that Athena
+// returns each of them from the evidence by severity, time range and resource
+func TestEvidenceQuery(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "evidence")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+
+	// Access keys rather than instances, so triage does not depend on live EC2 targets
+	keyID := "AKIA" + ns.RunID
+	findings := []helpers.GuardDutyFinding{
+		{
+			ID:       "test-query-high-" + ns.RunID,
+			Severity: 7.2,
+			Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+			Resource: map[string]interface{}{"resourceType": "AccessKey", "accessKeyDetails": map[string]interface{}{"accessKeyId": keyID}},
+		},
+		{
+			ID:       "test-query-critical-" + ns.RunID,
+			Severity: 8.9,
+			Type:     "CredentialAccess:IAMUser/AnomalousBehavior",
+			Resource: map[string]interface{}{"resourceType": "AccessKey", "accessKeyDetails": map[string]interface{}{"accessKeyId": keyID}},
+		},
+		{
+			ID:       "test-query-other-" + ns.RunID,
+			Severity: 7.0,
+			Type:     "Discovery:IAMUser/AnomalousBehavior",
+			Resource: map[string]interface{}{"resourceType": "AccessKey", "accessKeyDetails": map[string]interface{}{"accessKeyId": "AKIA-OTHER-" + ns.RunID}},
+		},
+	}
+
+	_, err := helpers.CalibrateClockSkew(sess)
+	require.NoError(t, err)
+	injection := clock.Anchor()
+	ids, err := helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+	require.NoError(t, helpers.WaitForEvidenceFindingIDs(sess, evidenceBucket, ids, 5*time.Minute))
+
+	evidence, err := athena.Open(sess, evidenceBucket, ns.RunID)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, evidence.Close())
+	}()
+
+	t.Run("BySeverity", func(t *testing.T) {
+		found, err := evidence.FindingsBySeverity(8.5)
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, findings[1].ID, found[0].ID)
+		assert.Equal(t, "findings/"+findings[1].ID+".json", found[0].Key)
+	})
+
+	t.Run("ByTime", func(t *testing.T) {
+		found, err := evidence.FindingsBetween(injection.Bounds())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, ids, queriedIDs(found))
+	})
+
+	t.Run("ByResource", func(t *testing.T) {
+		found, err := evidence.FindingsByResource(keyID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{findings[0].ID, findings[1].ID}, queriedIDs(found))
+		for _, finding := range found {
+			assert.Equal(t, "AccessKey", finding.ResourceType)
+		}
+	})
+}
+
+func queriedIDs(findings []athena.Finding) []string {
+	var ids []string
+	for _, finding := range findings {
+		ids = append(ids, finding.ID)
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/actions"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestExpectedActions deploys the stack with its defaults, injects findings across resource types
+// and severities, and checks that each got exactly the actions the default-stack matrix expects
+// for it: no missing action and none beyond them
+func TestExpectedActions(t *testing.T) {
+	t.Parallel()
+
+	matrix, err := actions.Load("../actions/default-stack.yaml")
+	require.NoError(t, err)
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "actions")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+
+	// CRITICAL findings page through the urgent topic, so both are subscribed
+	subscriptions := map[string]*helpers.TestSubscription{}
+	for name, output := range map[string]string{"standard": "sns_topic_arn", "urgent": "sns_urgent_topic_arn"} {
+		subscription, err := helpers.SubscribeTestQueue(sess, terraform.Output(t, terraformOptions, output), ns.Name("actions-"+name), "")
+		if subscription != nil {
+			defer func() {
+				assert.NoError(t, subscription.Delete(sess))
+			}()
+		}
+		require.NoError(t, err)
+		subscriptions[name] = subscription
+	}
+
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+	instance, err := set.Instance()
+	require.NoError(t, err)
+	bucket, err := set.Bucket()
+	require.NoError(t, err)
+	key, err := set.AccessKey()
+	require.NoError(t, err)
+
+	// Pod findings are notify-only, so the cluster can be fictitious
+	workload := &victims.KubernetesWorkload{
+		ClusterARN: helpers.PartitionFor(awsRegion).Scope(awsRegion, "123456789012").EKSCluster(ns.Name("cluster")),
+		Namespace:  "payments",
+		Name:       "checkout-7d9f8b6c5-x2x4q",
+		Type:       "pods",
+	}
+
+	findings := []helpers.GuardDutyFinding{
+		victims.Finding(instance, ns.Name("instance-high"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5),
+		victims.Finding(instance, ns.Name("instance-medium"), "Recon:EC2/PortProbeUnprotectedPort", 5.0),
+		victims.Finding(bucket, ns.Name("bucket-critical"), "Exfiltration:S3/AnomalousBehavior", 9.5),
+		victims.Finding(key, ns.Name("key-high"), "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS", 8.0),
+		victims.Finding(workload, ns.Name("pod-high"), "Execution:Runtime/ReverseShell", 8.0),
+	}
+
+	// Every finding must be covered by the matrix before anything is injected
+	expected := map[string][]actions.Action{}
+	for _, finding := range findings {
+		expected[finding.ID], err = matrix.Expected(finding)
+		require.NoError(t, err)
+	}
+
+	_, err = helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+
+	for _, finding := range findings {
+		if len(expected[finding.ID]) == 0 {
+			continue
+		}
+		_, err := helpers.WaitForTriageExecution(sess, stateMachineArn, finding.ID, 10*time.Minute)
+		require.NoError(t, err)
+	}
+
+	// The executions have finished, so every notification is on its way; settling catches those
+	// that should not have been sent
+	notifications := map[string]helpers.Notification{}
+	for _, subscription := range subscriptions {
+		received, err := helpers.WaitForNotifications(sess, subscription.QueueURL, nil, 0, 2*time.Minute)
+		require.NoError(t, err)
+		for id, notification := range received {
+			notifications[id] = notification
+		}
+	}
+
+	target := actions.Target{
+		Session:         sess,
+		EvidenceBucket:  terraform.Output(t, terraformOptions, "s3_evidence_bucket_name"),
+		StateMachineArn: stateMachineArn,
+		Notifications:   notifications,
+	}
+
+	for _, finding := range findings {
+		finding := finding
+		t.Run(finding.ID, func(t *testing.T) {
+			observed, err := actions.Observe(target, finding.ID)
+			require.NoError(t, err)
+			assert.NoError(t, actions.Verify(expected[finding.ID], observed))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestFindingArchiveSync covers the feedback loop between the pipeline and the finding sources in
+// both directions. A GuardDuty finding the pipeline responded to but could not isolate must stay open
+// in Security Hub and GuardDuty for responders. Findings an analyst archived in GuardDuty or
+// suppressed in Security Hub must not trigger a response.
+func TestFindingArchiveSync(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	harness := helpers.NewHarness(t, awsRegion)
+	sess := harness.Session
+
+	// The stack is deployed and destroyed in stages, so with SKIP_deploy and SKIP_destroy set the
+	// checks below run against a stack kept from an earlier run
+	stack := helpers.DeployStagedStack(t, sess, "archive", awsRegion, map[string]interface{}{
+		// The Kubernetes sample finding below is MEDIUM
+		"finding_severity_threshold":         "MEDIUM",
+		"enable_securityhub_custom_findings": true,
+		// Without deduplication, only the archive check keeps a finding from being triaged again
+		"finding_dedup_window_minutes": 0,
+	})
+	defer stack.Destroy(t)
+
+	stack.Validate(t, func() {
+		validateFindingArchiveSync(t, sess, awsRegion, stack)
+	})
+}
+
+// validateFindingArchiveSync is the validate stage of TestFindingArchiveSync
+func validateFindingArchiveSync(t *testing.T, sess *session.Session, awsRegion string, stack *helpers.StagedStack) {
+	ns := stack.Namespace
+	evidenceBucket := stack.Output(t, "s3_evidence_bucket_name")
+	stateMachineArn := stack.Output(t, "stepfn_ir_state_machine_arn")
+
+	detectorID, err := helpers.GuardDutyDetectorID(sess)
+	require.NoError(t, err)
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	// A kept stack is validated more than once, so the findings are named for this validation
+	validation := random.UniqueId()
+
+	t.Run("NotifyOnlyFindingLeftOpen", func(t *testing.T) {
+		// Kubernetes findings are notify-only: nothing is isolated, so the finding must stay open for
+		// responders instead of being resolved in Security Hub and archived in GuardDuty
+		ids, err := helpers.NewGuardDutySampleSource(sess).Inject([]helpers.GuardDutyFinding{
+			{Type: "Execution:Kubernetes/ExecInKubeSystemPod"},
+		})
+		require.NoError(t, err)
+		findingID := ids[0]
+
+		execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, findingID, 20*time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, "SUCCEEDED", aws.StringValue(execution.Status))
+		output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+		require.NoError(t, err)
+		assert.False(t, output.Containment.Contained())
+		assert.NotEmpty(t, output.Resolution)
+		assert.Empty(t, output.SecurityHub, "a finding that was not contained must not be resolved")
+		assert.Empty(t, output.GuardDuty, "a finding that was not contained must not be archived")
+
+		finding, err := helpers.GetGuardDutyFinding(sess, detectorID, findingID)
+		require.NoError(t, err)
+		assert.False(t, finding.Service != nil && aws.BoolValue(finding.Service.Archived), "GuardDuty finding %s was archived", findingID)
+		imported, err := helpers.GetSecurityHubFinding(sess, aws.StringValue(finding.Arn))
+		require.NoError(t, err)
+		if imported != nil && imported.Workflow != nil {
+			assert.NotEqual(t, securityhub.WorkflowStatusResolved, aws.StringValue(imported.Workflow.Status))
+		}
+
+		assert.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, findingID, 1, time.Minute, 5*time.Minute))
+	})
+
+	t.Run("ArchivedFindingIgnored", func(t *testing.T) {
+		finding := victims.Finding(bucket, ns.Name("archived-"+validation), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+		finding.Service = map[string]interface{}{"detectorId": detectorID, "archived": true}
+		_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+		require.NoError(t, err)
+
+		assert.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 0, time.Minute, 3*time.Minute))
+		_, err = s3.New(sess).HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(evidenceBucket),
+			Key:    aws.String(helpers.EvidenceKey(finding.ID, "")),
+		})
+		assert.Error(t, err, "an archived finding must not have evidence stored")
+	})
+
+	t.Run("SuppressedFindingIgnored", func(t *testing.T) {
+		finding := victims.Finding(bucket, ns.Name("suppressed-"+validation), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+		_, err := helpers.NewSecurityHubSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+		require.NoError(t, err)
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 1, 5*time.Minute, 0))
+
+		productArn := helpers.PartitionFor(awsRegion).Scope(awsRegion, aws.StringValue(identity.Account)).DefaultProduct()
+		require.NoError(t, helpers.SetSecurityHubWorkflowStatus(sess, finding.ID, productArn, securityhub.WorkflowStatusSuppressed))
+
+		assert.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 1, time.Minute, 5*time.Minute))
+	})
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestFindingExport deploys the stack with the Firehose finding export in each format and checks that
+// an injected finding lands in the analytics bucket under its hourly partition and is returned by
+// Athena from the Glue table
+func TestFindingExport(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{helpers.ExportFormatJSON, helpers.ExportFormatParquet} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			awsRegion := helpers.TestRegion()
+
+			suite := helpers.NewSuite(t, awsRegion, "export")
+			sess, ns := suite.Session, suite.Namespace
+			// Fail before the apply when the account cannot take the stack
+			require.NoError(t, suite.AssertAccountBaseline())
+
+			terraformOptions := suite.StackOptions(map[string]interface{}{
+				"enable_finding_export": true,
+				"finding_export_format": format,
+			})
+
+			defer terraform.Destroy(t, terraformOptions)
+			terraform.InitAndApply(t, terraformOptions)
+
+			analyticsBucket := terraform.Output(t, terraformOptions, "finding_export_bucket_name")
+			workgroup := terraform.Output(t, terraformOptions, "finding_export_athena_workgroup_name")
+			database := terraform.Output(t, terraformOptions, "finding_export_glue_database_name")
+			table := terraform.Output(t, terraformOptions, "finding_export_glue_table_name")
+
+			// Firehose writes objects terraform destroy cannot delete from a non-empty bucket
+			defer func() {
+				assert.NoError(t, helpers.EmptyTestBucket(sess, analyticsBucket))
+			}()
+
+			// Below the triage threshold, since every finding is exported regardless of severity
+			finding := helpers.GuardDutyFinding{
+				ID:       "test-export-" + strings.ToLower(format) + "-" + ns.RunID,
+				Severity: 4.0,
+				Type:     "Recon:EC2/PortProbeUnprotectedPort",
+				Resource: map[string]interface{}{"resourceType": "AccessKey"},
+			}
+			injectedAt := time.Now()
+			_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+			require.NoError(t, err)
+
+			var object *helpers.ExportedObject
+			t.Run("DeliveredToPartition", func(t *testing.T) {
+				object, err = helpers.WaitForExportedFinding(sess, analyticsBucket, finding.ID, format, injectedAt, 10*time.Minute)
+				require.NoError(t, err)
+				assert.WithinDuration(t, injectedAt.UTC().Truncate(time.Hour), object.Partition, time.Hour)
+			})
+
+			t.Run("QueryableWithAthena", func(t *testing.T) {
+				exported, err := helpers.QueryExportedFinding(sess, workgroup, database, table, finding.ID, 10*time.Minute)
+				require.NoError(t, err)
+				assert.Equal(t, finding.Type, exported.Type)
+				assert.Equal(t, finding.Severity, exported.Severity)
+				if object != nil && format == helpers.ExportFormatJSON {
+					assert.Equal(t, object.Partition, exported.Partition, "Athena must read the finding from the partition it was delivered to")
+				}
+			})
+		})
+	}
+}
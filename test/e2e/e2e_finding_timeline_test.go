@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/timeline"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// Latency SLOs of the pipeline, from the finding reaching EventBridge
+const (
+	triageStartSLO  = time.Minute
+	evidenceSLO     = 2 * time.Minute
+	notificationSLO = 3 * time.Minute
+)
+
+// TestFindingTimeline injects one finding, reconstructs its timeline from EventBridge, the triage
+// logs, the IR execution, the evidence bucket and the notification delivered to a test queue, and
+// checks the pipeline's latency SLOs against it
+func TestFindingTimeline(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "timeline")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	target := timeline.TargetFromOutputs(sess, terraform.OutputAll(t, terraformOptions))
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("timeline"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	finding := victims.Finding(bucket, ns.Name("timeline"), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	notifications, err := helpers.WaitForNotifications(sess, subscription.QueueURL, []string{finding.ID}, 5*time.Minute, 0)
+	require.NoError(t, err)
+	_, err = helpers.WaitForTriageExecution(sess, target.StateMachineArn, finding.ID, 10*time.Minute)
+	require.NoError(t, err)
+
+	// Triage logs reach CloudWatch Logs shortly after the execution ends
+	var findingTimeline *timeline.Timeline
+	require.True(t, helpers.EventuallyAssert(t, func(c require.TestingT) {
+		built, err := timeline.Build(target, finding.ID, timeline.Options{})
+		require.NoError(c, err)
+		require.Empty(c, built.Gaps)
+		_, ok := built.Milestone(timeline.NotificationPublished)
+		require.True(c, ok, "no notification log line yet")
+		findingTimeline = built
+	}, 3*time.Minute))
+	findingTimeline.AddNotification(notifications[finding.ID])
+	t.Log(findingTimeline)
+
+	t.Run("MilestonesInOrder", func(t *testing.T) {
+		assert.NoError(t, findingTimeline.AssertOrder(timeline.EventReceived, timeline.TriageStarted,
+			timeline.ExecutionStarted, timeline.ExecutionFinished))
+		assert.NoError(t, findingTimeline.AssertOrder(timeline.NotificationPublished, timeline.NotificationDelivered))
+	})
+
+	t.Run("WithinSLOs", func(t *testing.T) {
+		assert.NoError(t, findingTimeline.AssertWithin(timeline.EventReceived, timeline.TriageStarted, triageStartSLO))
+		assert.NoError(t, findingTimeline.AssertWithin(timeline.EventReceived, timeline.EvidenceStored, evidenceSLO))
+		assert.NoError(t, findingTimeline.AssertWithin(timeline.EventReceived, timeline.NotificationDelivered, notificationSLO))
+	})
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestIncidentIndex deploys the stack with the DynamoDB incident index and checks that a finding
+// produces exactly one item, findable by resource and by status, and that triaging an update of it
+// changes that item instead of writing a second one
+func TestIncidentIndex(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	// The lambda_triage module's incident_ttl_days default
+	incidentTTL := 365 * 24 * time.Hour
+
+	suite := helpers.NewSuite(t, awsRegion, "incidents")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"enable_incident_index": true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	table := terraform.Output(t, terraformOptions, "lambda_triage_incident_table_name")
+	source := helpers.NewEventBridgeSource(sess)
+
+	// Not an instance, so triage does not depend on a live EC2 target
+	keyID := "AKIA" + ns.RunID
+	finding := helpers.GuardDutyFinding{
+		ID:       "test-incident-" + ns.RunID,
+		Severity: 7.5,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey", "accessKeyDetails": map[string]interface{}{"accessKeyId": keyID}},
+	}
+
+	t.Run("TableConfigured", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertIncidentTable(sess, table))
+	})
+
+	var first *helpers.Incident
+	t.Run("OneItemPerFinding", func(t *testing.T) {
+		_, err := source.Inject([]helpers.GuardDutyFinding{finding})
+		require.NoError(t, err)
+
+		first, err = helpers.WaitForIncident(sess, table, finding.ID, 1, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "access-key:"+keyID, first.ResourceID)
+		assert.Equal(t, helpers.IncidentOpen, first.Status)
+		assert.NoError(t, helpers.AssertSingleIncident(sess, table, *first, incidentTTL, time.Minute))
+	})
+
+	t.Run("UpdateIsIdempotent", func(t *testing.T) {
+		require.NotNil(t, first)
+
+		// Only an escalation is triaged again inside the dedup window
+		escalated := finding
+		escalated.Severity = 8.5
+		_, err := source.Inject([]helpers.GuardDutyFinding{escalated})
+		require.NoError(t, err)
+
+		updated, err := helpers.WaitForIncident(sess, table, finding.ID, 2, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, first.CreatedAt, updated.CreatedAt, "the conditional put must not replace the existing item")
+		assert.Equal(t, escalated.Severity, updated.Severity)
+		assert.NoError(t, helpers.AssertSingleIncident(sess, table, *updated, incidentTTL, time.Minute))
+	})
+}
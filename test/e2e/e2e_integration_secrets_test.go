@@ -0,0 +1,94 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestIntegrationSecrets wires Slack and Jira secrets into the stack and checks that they are
+// encrypted with the IR key, rotate, and never surface in the Lambda's environment or logs. Secrets
+// Manager only accepts a rotation schedule with a rotation function, which the harness does not own.
+func TestIntegrationSecrets(t *testing.T) {
+	rotationLambdaARN := os.Getenv("SECRET_ROTATION_LAMBDA_ARN")
+	if rotationLambdaARN == "" {
+		t.Skip("set SECRET_ROTATION_LAMBDA_ARN to a Secrets Manager rotation function to run integration secret tests")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "secrets")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	// The secrets need the stack's key, so the stack is applied again once they exist
+	kmsKeyARN := terraform.Output(t, terraformOptions, "s3_evidence_kms_key_arn")
+	values := map[string]string{
+		"slack": fmt.Sprintf(`{"bot_token":"xoxb-%s-%s"}`, ns.RunID, random.UniqueId()),
+		"jira":  fmt.Sprintf(`{"user":"ir-bot","api_key":"%s%s"}`, random.UniqueId(), random.UniqueId()),
+	}
+	secretARNs := map[string]string{}
+	for name, value := range values {
+		arn, err := helpers.CreateTestSecret(sess, ns.Name(name+"-credentials"), value, kmsKeyARN, rotationLambdaARN)
+		if arn != "" {
+			defer func() {
+				assert.NoError(t, helpers.DeleteTestSecret(sess, arn))
+			}()
+		}
+		require.NoError(t, err)
+		secretARNs[name] = arn
+	}
+
+	terraformOptions.Vars["integration_secret_arns"] = secretARNs
+	terraform.Apply(t, terraformOptions)
+
+	lambdaFunctionName := terraform.Output(t, terraformOptions, "lambda_triage_function_name")
+
+	// Put the Lambda through a triage so there is log output to scan
+	start := time.Now()
+	finding := helpers.GuardDutyFinding{
+		ID:       "test-secrets-" + ns.RunID,
+		Severity: 8.5,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey"},
+	}
+	_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	material, err := helpers.SecretMaterial(sess, secretARNs)
+	require.NoError(t, err)
+
+	t.Run("SecretsEncryptedAndRotated", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertIntegrationSecrets(sess, secretARNs, kmsKeyARN))
+	})
+
+	t.Run("SecretsNotInLambdaEnvironment", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertSecretsNotInLambdaEnvironment(sess, lambdaFunctionName, material))
+	})
+
+	t.Run("SecretsNotInLogs", func(t *testing.T) {
+		logGroupName := "/aws/lambda/" + lambdaFunctionName
+		found, err := helpers.PollCloudWatchLogsForPattern(sess, logGroupName, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		require.True(t, found, "triage never logged the finding")
+
+		assert.NoError(t, helpers.AssertNoSensitiveLogs(sess, helpers.LogScanOptions{
+			LogGroups: []string{logGroupName},
+			Since:     start,
+			Secrets:   material,
+		}))
+	})
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestIsolationExemption reports a real instance carrying the exemption tag, as a honeypot would,
+// and checks that the finding is recorded as evidence but the instance is neither isolated nor paged about
+func TestIsolationExemption(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	exemptionTag := "ir:honeypot=true"
+
+	suite := helpers.NewSuite(t, awsRegion, "exempt")
+	sess, ns := suite.Session, suite.Namespace
+
+	// A non-default tag proves the stack honors the variable rather than a hard-coded tag
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"isolation_exemption_tag": exemptionTag,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	quarantineSGID := terraform.Output(t, terraformOptions, "network_quarantine_sg_id")
+	lambdaFunctionName := terraform.Output(t, terraformOptions, "lambda_triage_function_name")
+
+	tagKey, tagValue, err := helpers.ParseExemptionTag(exemptionTag)
+	require.NoError(t, err)
+
+	instanceID, err := helpers.LaunchTestInstance(sess, helpers.TestInstanceOptions{
+		Tags: map[string]string{"Name": ns.Name("honeypot"), "TestID": ns.RunID, tagKey: tagValue},
+	})
+	if instanceID != "" {
+		defer func() {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, instanceID))
+		}()
+	}
+	require.NoError(t, err)
+
+	finding := helpers.GuardDutyFinding{
+		ID:       fmt.Sprintf("test-exempt-%s", ns.RunID),
+		Severity: 8.5,
+		Type:     "UnauthorizedAccess:EC2/SSHBruteForce",
+		Resource: map[string]interface{}{
+			"resourceType":    "Instance",
+			"instanceDetails": map[string]interface{}{"instanceId": instanceID},
+		},
+	}
+	require.NoError(t, helpers.PutGuardDutyFindings(sess, []helpers.GuardDutyFinding{finding}))
+
+	t.Run("FindingRecordedAsEvidence", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "true", metadata["exempt"], "evidence must record that the instance was exempt")
+	})
+
+	t.Run("NotPaged", func(t *testing.T) {
+		// Triage returns before starting the IR execution and before publishing to SNS
+		found, err := helpers.PollCloudWatchLogsForPattern(sess, "/aws/lambda/"+lambdaFunctionName, "not isolated or paged", 2*time.Minute)
+		require.NoError(t, err)
+		assert.True(t, found, "triage did not log the exemption")
+
+		require.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 0, 0, time.Minute))
+	})
+
+	t.Run("NotIsolated", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertNotQuarantined(sess, instanceID, quarantineSGID))
+	})
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestIsolationStrategies deploys the stack once per isolation_strategy and isolates a victim with
+// each, pinning the exact security groups and subnet network ACL every strategy leaves behind. Victims
+// get a VPC of their own, since NACL-based isolation cuts off their whole subnet.
+func TestIsolationStrategies(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	for _, strategy := range helpers.IsolationStrategies {
+		strategy := strategy
+		t.Run(string(strategy), func(t *testing.T) {
+			t.Parallel()
+
+			suite := helpers.NewSuite(t, awsRegion, "strategy")
+			sess, ns := suite.Session, suite.Namespace
+
+			// Deferred first so the victim VPC is deleted after the quarantine group and ACL in it
+			set := victims.New(sess, ns.RunID)
+			defer func() {
+				assert.NoError(t, set.Cleanup())
+			}()
+
+			network, err := set.Network()
+			require.NoError(t, err)
+
+			terraformOptions := suite.StackOptions(map[string]interface{}{
+				"quarantine_vpc_id":  network.VPCID,
+				"isolation_strategy": string(strategy),
+			})
+
+			defer terraform.Destroy(t, terraformOptions)
+			terraform.InitAndApply(t, terraformOptions)
+
+			stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+			quarantineSGID := terraform.Output(t, terraformOptions, "network_quarantine_sg_id")
+			quarantineACLID := ""
+			if aclIDs := terraform.OutputList(t, terraformOptions, "network_quarantine_nacl_ids"); len(aclIDs) > 0 {
+				quarantineACLID = aclIDs[0]
+			}
+
+			instance, err := set.InstanceIn(network)
+			require.NoError(t, err)
+			// The quarantine group cannot be destroyed while the instance still uses it
+			defer func() {
+				assert.NoError(t, helpers.TerminateTestInstance(sess, instance.ID))
+			}()
+
+			before, err := helpers.CaptureInterfaceState(sess, instance.NetworkInterface)
+			require.NoError(t, err)
+			// Nor the quarantine ACL while the subnet is still associated with it
+			defer func() {
+				assert.NoError(t, helpers.RestoreSubnetACL(sess, before.SubnetID, before.NetworkACLID))
+			}()
+
+			expected, err := helpers.ExpectedInterfaceState(strategy, before, quarantineSGID, quarantineACLID)
+			require.NoError(t, err)
+
+			finding := victims.Finding(instance, ns.Name("strategy-victim"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5)
+			_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+			require.NoError(t, err)
+
+			execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+			require.NoError(t, err)
+			output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+			require.NoError(t, err)
+			require.NotNil(t, output.Containment)
+
+			eniTarget := "eni:" + instance.NetworkInterface
+			for _, result := range output.Containment.Targets {
+				if result.Target == eniTarget {
+					assert.Equalf(t, helpers.ContainmentIsolated, result.Status, "%s %s", result.Error, result.Cause)
+				}
+			}
+
+			assert.NoError(t, helpers.AssertInterfaceState(sess, instance.NetworkInterface, expected))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/benchmark"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/perfbaseline"
+)
+
+func TestLambdaMemoryBenchmark(t *testing.T) {
+	if os.Getenv("RUN_LAMBDA_BENCHMARK") == "" {
+		t.Skip("set RUN_LAMBDA_BENCHMARK=1 to run the Lambda memory-size benchmark")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "bench")
+	sess := suite.Session
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	lambdaFunctionName := terraform.Output(t, terraformOptions, "lambda_triage_function_name")
+
+	finding, err := helpers.GetSampleEventBySeverity("HIGH")
+	require.NoError(t, err)
+	payload, err := helpers.GenerateEventBridgeEventJSON(finding)
+	require.NoError(t, err)
+
+	report, err := benchmark.Run(sess, benchmark.Config{
+		FunctionName:   lambdaFunctionName,
+		MemorySizes:    benchmarkMemorySizes(t),
+		ColdIterations: 3,
+		WarmIterations: 10,
+		Payload:        []byte(payload),
+	})
+	require.NoError(t, err)
+
+	t.Log("\n" + report.String())
+
+	for _, stat := range report.Stats() {
+		assert.Equal(t, 3, stat.ColdCount, "every cold iteration should report an init duration at %d MB", stat.MemorySize)
+		assert.Less(t, stat.MaxMemoryUsedMB, stat.MemorySize, "function should not exhaust memory at %d MB", stat.MemorySize)
+	}
+
+	// With PERF_BASELINE_BUCKET set the run is compared against, then added to, the per-commit baseline
+	bucket := os.Getenv("PERF_BASELINE_BUCKET")
+	if bucket == "" {
+		return
+	}
+
+	maxPercent := 20.0
+	if raw := os.Getenv("PERF_REGRESSION_PERCENT"); raw != "" {
+		maxPercent, err = strconv.ParseFloat(raw, 64)
+		require.NoError(t, err, "invalid PERF_REGRESSION_PERCENT")
+	}
+
+	sha, err := perfbaseline.CurrentSHA()
+	require.NoError(t, err)
+
+	run := perfbaseline.Run{SHA: sha, Suite: "lambda-benchmark", Timestamp: time.Now().UTC(), Metrics: map[string]float64{}}
+	for _, stat := range report.Stats() {
+		run.Metrics[fmt.Sprintf("%dmb.init_avg_ms", stat.MemorySize)] = float64(stat.AvgInitDuration.Milliseconds())
+		run.Metrics[fmt.Sprintf("%dmb.warm_p50_ms", stat.MemorySize)] = float64(stat.P50Duration.Milliseconds())
+		run.Metrics[fmt.Sprintf("%dmb.warm_p95_ms", stat.MemorySize)] = float64(stat.P95Duration.Milliseconds())
+	}
+
+	store := perfbaseline.Store{Session: sess, Bucket: bucket, Prefix: "perf-baselines"}
+	assert.NoError(t, store.AssertNoRegression(run, 5, maxPercent))
+}
+
+// benchmarkMemorySizes reads BENCHMARK_MEMORY_SIZES (comma separated MB values) or falls back to a default matrix
+func benchmarkMemorySizes(t *testing.T) []int64 {
+	raw := os.Getenv("BENCHMARK_MEMORY_SIZES")
+	if raw == "" {
+		return []int64{128, 256, 512, 1024}
+	}
+
+	var sizes []int64
+	for _, part := range strings.Split(raw, ",") {
+		size, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		require.NoError(t, err, "invalid BENCHMARK_MEMORY_SIZES entry %q", part)
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/legalhold"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestLegalHold deploys the stack with Object Lock and puts one of two findings' evidence under
+// legal hold. While held, its versions and the hold's audit record must refuse deletion, and the
+// other finding's evidence must stay deletable; once released, the evidence can be deleted again
+// while the audit trail of both changes remains.
+func TestLegalHold(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "hold")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"evidence_object_lock_enabled": true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	// The audit records stay held, so destroy needs the bucket emptied first
+	defer func() {
+		assert.NoError(t, helpers.EmptyTestBucket(sess, evidenceBucket))
+	}()
+
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	held := victims.Finding(bucket, ns.Name("held"), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+	other := victims.Finding(bucket, ns.Name("other"), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{held, other})
+	require.NoError(t, err)
+	for _, finding := range []helpers.GuardDutyFinding{held, other} {
+		_, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+	}
+
+	const matter = "LEGAL-1234"
+	s3Client := s3.New(sess)
+	deleteVersion := func(key, versionID string) error {
+		_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket:    aws.String(evidenceBucket),
+			Key:       aws.String(key),
+			VersionId: aws.String(versionID),
+		})
+		return err
+	}
+
+	placed, err := legalhold.Place(sess, evidenceBucket, held.ID, matter)
+	require.NoError(t, err)
+
+	t.Run("HoldSticks", func(t *testing.T) {
+		holds, err := legalhold.Status(sess, evidenceBucket, held.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, holds)
+		for _, hold := range holds {
+			assert.True(t, hold.On, "%s@%s is not held", hold.Key, hold.VersionID)
+		}
+
+		records, err := legalhold.Records(sess, evidenceBucket, held.ID)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, legalhold.ActionPlace, records[0].Action)
+		assert.Equal(t, matter, records[0].Matter)
+		assert.Equal(t, aws.StringValue(identity.Arn), records[0].Actor)
+		assert.Equal(t, placed.Versions, records[0].Versions)
+	})
+
+	t.Run("DeletionRefusedWhileHeld", func(t *testing.T) {
+		for _, version := range placed.Versions {
+			assert.Error(t, deleteVersion(version.Key, version.VersionID), "held version %s was deleted", version.VersionID)
+		}
+
+		// A plain delete only hides the evidence behind a delete marker; the held version stays
+		_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(evidenceBucket),
+			Key:    aws.String(placed.Versions[0].Key),
+		})
+		require.NoError(t, err)
+		_, err = s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket:    aws.String(evidenceBucket),
+			Key:       aws.String(placed.Versions[0].Key),
+			VersionId: aws.String(placed.Versions[0].VersionID),
+		})
+		assert.NoError(t, err, "the held version is gone")
+
+		versions, err := s3Client.ListObjectVersions(&s3.ListObjectVersionsInput{
+			Bucket: aws.String(evidenceBucket),
+			Prefix: aws.String(placed.Key),
+		})
+		require.NoError(t, err)
+		require.Len(t, versions.Versions, 1)
+		assert.Error(t, deleteVersion(placed.Key, aws.StringValue(versions.Versions[0].VersionId)), "the audit record was deleted")
+	})
+
+	t.Run("OtherEvidenceNotHeld", func(t *testing.T) {
+		holds, err := legalhold.Status(sess, evidenceBucket, other.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, holds)
+		for _, hold := range holds {
+			assert.False(t, hold.On, "%s@%s is held", hold.Key, hold.VersionID)
+			assert.NoError(t, deleteVersion(hold.Key, hold.VersionID))
+		}
+	})
+
+	t.Run("ReleaseRecorded", func(t *testing.T) {
+		released, err := legalhold.Release(sess, evidenceBucket, held.ID, matter)
+		require.NoError(t, err)
+		assert.Equal(t, placed.Versions, released.Versions)
+
+		holds, err := legalhold.Status(sess, evidenceBucket, held.ID)
+		require.NoError(t, err)
+		for _, hold := range holds {
+			assert.False(t, hold.On, "%s@%s is still held", hold.Key, hold.VersionID)
+		}
+
+		records, err := legalhold.Records(sess, evidenceBucket, held.ID)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, legalhold.ActionPlace, records[0].Action)
+		assert.Equal(t, legalhold.ActionRelease, records[1].Action)
+
+		for _, version := range released.Versions {
+			assert.NoError(t, deleteVersion(version.Key, version.VersionID))
+		}
+	})
+}
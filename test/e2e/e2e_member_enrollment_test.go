@@ -0,0 +1,34 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestMemberEnrollment checks an org-mode deployment for onboarding gaps: every active account of
+// the organization must be an Enabled GuardDuty and Security Hub member. It does not deploy anything
+// and must run with credentials for the delegated administrator account.
+func TestMemberEnrollment(t *testing.T) {
+	if os.Getenv("RUN_ORG_ENROLLMENT_CHECK") == "" {
+		t.Skip("set RUN_ORG_ENROLLMENT_CHECK=1 with delegated administrator credentials to check member enrollment")
+	}
+
+	awsRegion := helpers.TestRegion()
+
+	harness := helpers.NewHarness(t, awsRegion)
+	sess := harness.Session
+
+	reports, err := helpers.CheckMemberEnrollment(sess)
+	require.NoError(t, err)
+
+	for _, report := range reports {
+		t.Log(report)
+		if !report.Complete() {
+			t.Errorf("%s enrollment gaps in %s:\n%s", report.Service, awsRegion, report)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestMultiVPCQuarantine deploys the stack over two VPCs and reports a victim in each. Every VPC
+// must get its own quarantine group and every victim must end up in the group of its VPC, since
+// attaching the primary group to an interface elsewhere fails as "security group not found".
+func TestMultiVPCQuarantine(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "multivpc")
+	sess, ns := suite.Session, suite.Namespace
+
+	// Deferred first so the victim VPCs are deleted after the quarantine groups in them
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	primary, err := set.Network()
+	require.NoError(t, err)
+	secondary, err := set.Network()
+	require.NoError(t, err)
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"quarantine_vpc_id":             primary.VPCID,
+		"quarantine_additional_vpc_ids": []string{secondary.VPCID},
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	groupsByVPC := terraform.OutputMap(t, terraformOptions, "network_quarantine_sg_ids_by_vpc")
+
+	var instances []*victims.Instance
+	for _, network := range []*victims.Network{primary, secondary} {
+		instance, err := set.InstanceIn(network)
+		require.NoError(t, err)
+		require.Equal(t, network.VPCID, instance.VPCID)
+		instances = append(instances, instance)
+	}
+	// The quarantine groups cannot be destroyed while the instances still use them
+	defer func() {
+		for _, instance := range instances {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, instance.ID))
+		}
+	}()
+
+	findings := []helpers.GuardDutyFinding{
+		victims.Finding(instances[0], ns.Name("primary-vpc"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5),
+		victims.Finding(instances[1], ns.Name("secondary-vpc"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5),
+	}
+	_, err = helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+
+	t.Run("QuarantineGroupPerVPC", func(t *testing.T) {
+		require.Len(t, groupsByVPC, 2)
+		assert.NoError(t, helpers.AssertQuarantineGroupPerVPC(sess, groupsByVPC, []string{primary.VPCID, secondary.VPCID}))
+		assert.NotEqual(t, groupsByVPC[primary.VPCID], groupsByVPC[secondary.VPCID])
+	})
+
+	for i, instance := range instances {
+		instance, finding := instance, findings[i]
+		t.Run("ContainedIn_"+instance.VPCID, func(t *testing.T) {
+			execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+			require.NoError(t, err)
+
+			output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+			require.NoError(t, err)
+			require.NotNil(t, output.Containment)
+			for _, result := range output.Containment.Targets {
+				assert.Falsef(t, strings.Contains(result.Cause, "InvalidGroup.NotFound"),
+					"%s was given a group from another VPC: %s", result.Target, result.Cause)
+				// Interfaces are contained; the instance itself is only on record
+				want := helpers.ContainmentIsolated
+				if !strings.HasPrefix(result.Target, "eni:") {
+					want = helpers.ContainmentRecorded
+				}
+				assert.Equalf(t, want, result.Status, "%s: %s %s", result.Target, result.Error, result.Cause)
+			}
+			assert.Equal(t, sfn.ExecutionStatusSucceeded, aws.StringValue(execution.Status))
+
+			assert.NoError(t, helpers.AssertIsolatedInOwnVPC(sess, instance.ID, groupsByVPC))
+		})
+	}
+}
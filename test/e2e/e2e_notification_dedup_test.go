@@ -0,0 +1,95 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestNotificationDedup enables the chat and page channels together, subscribed through Terraform
+// the way real endpoints are, and injects a HIGH and a CRITICAL finding twice each, as GuardDuty
+// re-publishes findings it updates. Each finding must reach its own channel exactly once and the
+// other channel not at all. The stack has no ticketing integration, so tickets are not captured.
+func TestNotificationDedup(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "notifydup")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+
+	// The queues need the topic ARNs for their policies, so Terraform subscribes them on a second apply
+	queueURLs := map[string]string{}
+	channelVars := map[string]string{}
+	for _, channel := range []struct{ name, topicOutput, variable string }{
+		{helpers.ChannelChat, "sns_topic_arn", "sns_subscriptions"},
+		{helpers.ChannelPage, "sns_urgent_topic_arn", "sns_urgent_subscriptions"},
+	} {
+		queue, err := helpers.CreateTestQueue(sess, terraform.Output(t, terraformOptions, channel.topicOutput), ns.Name("dup-"+channel.name))
+		if queue != nil {
+			defer func() {
+				assert.NoError(t, queue.Delete(sess))
+			}()
+		}
+		require.NoError(t, err)
+		queueURLs[channel.name] = queue.QueueURL
+		channelVars[channel.variable] = queue.QueueARN
+	}
+	for variable, queueARN := range channelVars {
+		terraformOptions.Vars[variable] = []map[string]interface{}{
+			{"protocol": "sqs", "endpoint": queueARN},
+		}
+	}
+	terraform.Apply(t, terraformOptions)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	high := victims.Finding(bucket, ns.Name("dup-high"), "Exfiltration:S3/AnomalousBehavior", 8.0)
+	critical := victims.Finding(bucket, ns.Name("dup-critical"), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 9.5)
+	findings := []helpers.GuardDutyFinding{high, critical}
+	source := helpers.NewEventBridgeSource(sess)
+
+	_, err := source.Inject(findings)
+	require.NoError(t, err)
+	for _, finding := range findings {
+		_, err := helpers.WaitForTriageExecution(sess, stateMachineArn, finding.ID, 10*time.Minute)
+		require.NoError(t, err)
+	}
+
+	// The same findings again, within the dedup window
+	_, err = source.Inject(findings)
+	require.NoError(t, err)
+
+	t.Run("TriagedOnce", func(t *testing.T) {
+		for _, finding := range findings {
+			assert.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, finding.ID, 1, time.Minute, 2*time.Minute))
+		}
+	})
+
+	capture, err := helpers.CaptureChannels(sess, queueURLs, 2*time.Minute)
+	require.NoError(t, err)
+
+	t.Run("AtMostOncePerChannel", func(t *testing.T) {
+		assert.NoError(t, capture.AssertAtMostOnce(high.ID, critical.ID))
+	})
+
+	t.Run("RoutedToOneChannel", func(t *testing.T) {
+		assert.Equal(t, 1, capture.Count(helpers.ChannelChat, high.ID), "HIGH finding must reach chat")
+		assert.Zero(t, capture.Count(helpers.ChannelPage, high.ID), "HIGH finding must not page")
+		assert.Equal(t, 1, capture.Count(helpers.ChannelPage, critical.ID), "CRITICAL finding must page")
+		assert.Zero(t, capture.Count(helpers.ChannelChat, critical.ID), "CRITICAL finding must page instead of reaching chat")
+	})
+}
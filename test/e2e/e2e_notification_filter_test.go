@@ -0,0 +1,92 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	terratestaws "github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestNotificationFilterPolicies subscribes an SQS queue to the standard topic through
+// sns_subscriptions with a filter policy, and checks that notifications carry the attributes the
+// policy matches on and that the policy lets through exactly what it should
+func TestNotificationFilterPolicies(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	filterPolicy := `{"severity":["HIGH"],"resource_type":["AccessKey"]}`
+
+	suite := helpers.NewSuite(t, awsRegion, "filter")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	// The queue needs the topic ARN for its policy, so Terraform subscribes it on a second apply
+	standardTopic := terraform.Output(t, terraformOptions, "sns_topic_arn")
+	queue, err := helpers.CreateTestQueue(sess, standardTopic, ns.Name("filtered"))
+	if queue != nil {
+		defer func() {
+			assert.NoError(t, queue.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	terraformOptions.Vars["sns_subscriptions"] = []map[string]interface{}{
+		{"protocol": "sqs", "endpoint": queue.QueueARN, "filter_policy": filterPolicy},
+	}
+	terraform.Apply(t, terraformOptions)
+
+	t.Run("FilterPolicyApplied", func(t *testing.T) {
+		applied, err := helpers.SubscriptionFilterPolicy(sess, standardTopic, queue.QueueARN)
+		require.NoError(t, err)
+		assert.JSONEq(t, filterPolicy, applied)
+	})
+
+	// Not instances, so triage does not depend on live EC2 targets
+	matching := helpers.GuardDutyFinding{
+		ID:       "test-filter-match-" + ns.RunID,
+		Severity: 7.5,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey"},
+	}
+	filtered := matching
+	filtered.ID = "test-filter-other-" + ns.RunID
+	filtered.Resource = map[string]interface{}{"resourceType": "S3Bucket"}
+
+	// Filter policies take up to a minute to apply after the subscription changes
+	time.Sleep(time.Minute)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{matching, filtered})
+	require.NoError(t, err)
+
+	t.Run("NotificationsCarryAttributes", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, queue.QueueURL, []string{matching.ID}, 5*time.Minute, time.Minute)
+		require.NoError(t, err)
+		assert.NoError(t, helpers.ValidateNotificationAttributes(received[matching.ID], terratestaws.GetAccountId(t)))
+		assert.NotContains(t, received, filtered.ID, "S3Bucket finding must not pass the AccessKey filter")
+	})
+
+	t.Run("PermutationsProbed", func(t *testing.T) {
+		permutations := helpers.AttributePermutations(map[string][]string{
+			"severity":      {"LOW", "MEDIUM", "HIGH", "CRITICAL"},
+			"resource_type": {"AccessKey", "Instance", "S3Bucket"},
+			"account_id":    {terratestaws.GetAccountId(t)},
+		})
+		delivered, err := helpers.ProbeFilterPolicy(sess, ns.Name("filter-probe"), filterPolicy, permutations)
+		require.NoError(t, err)
+
+		for i, permutation := range permutations {
+			want := permutation["severity"] == "HIGH" && permutation["resource_type"] == "AccessKey"
+			assert.Equal(t, want, delivered[i], "delivery of %v", permutation)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestContainmentPartialFailure denies the IR workflow the call that moves an interface into the
+// quarantine group and checks that a finding whose evidence was stored but whose isolation failed is
+// reported as partially failed, notified with the failure and routed to the remediation DLQ
+func TestContainmentPartialFailure(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "partial")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+	remediationDLQ := terraform.Output(t, terraformOptions, "stepfn_ir_remediation_dlq_url")
+	stepfnRole := terraform.Output(t, terraformOptions, "iam_stepfn_role_name")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("partial-failure"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	// A real interface, so isolation fails on the deny rather than on a missing resource
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+	instance, err := set.Instance()
+	require.NoError(t, err)
+
+	restore, err := helpers.DenyRoleActions(sess, stepfnRole, "ec2:ModifyNetworkInterfaceAttribute")
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, restore())
+	}()
+	// Give IAM time to enforce the deny before the workflow runs
+	time.Sleep(30 * time.Second)
+
+	finding := victims.Finding(instance, ns.Name("partial-failure"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+
+	eniTarget := "eni:" + instance.NetworkInterface
+
+	t.Run("EvidenceStored", func(t *testing.T) {
+		_, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		assert.NoError(t, err)
+	})
+
+	t.Run("ExecutionPartiallyFailed", func(t *testing.T) {
+		execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.NoError(t, helpers.AssertPartialFailure(execution))
+	})
+
+	t.Run("NotifiedWithFailureDetails", func(t *testing.T) {
+		notification, err := helpers.WaitForFailureNotification(sess, subscription.QueueURL, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		require.Len(t, notification.Failures, 1)
+		assert.Equal(t, eniTarget, notification.Failures[0].Target)
+		assert.NotEmpty(t, notification.Failures[0].Cause)
+		assert.Equal(t, "HIGH", notification.Attributes["severity"])
+	})
+
+	t.Run("RoutedToRemediationDLQ", func(t *testing.T) {
+		failure, err := helpers.ReceiveRemediationFailure(sess, remediationDLQ, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+		require.NotNil(t, failure.Containment)
+
+		// Only the denied interface failed; the instance target is still on record
+		statuses := map[string]string{}
+		for _, result := range failure.Containment.Targets {
+			statuses[result.Target] = result.Status
+		}
+		assert.Equal(t, helpers.ContainmentFailed, statuses[eniTarget])
+		assert.Equal(t, helpers.ContainmentRecorded, statuses["instance:"+instance.ID])
+		assert.NotEmpty(t, failure.Evidence, "the evidence step must have completed before isolation failed")
+	})
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestPartitionSupport checks the harness's partition table against the SDK's endpoint metadata
+// for the standard, GovCloud and China partitions, and the ARNs helpers build in each. It does not
+// deploy anything or need credentials.
+func TestPartitionSupport(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		region      string
+		partition   string
+		bucketARN   string
+		instanceARN string
+	}{
+		{"us-east-1", "aws", "arn:aws:s3:::evidence", "arn:aws:ec2:us-east-1:123456789012:instance/i-0abc"},
+		{"eu-west-1", "aws", "arn:aws:s3:::evidence", "arn:aws:ec2:eu-west-1:123456789012:instance/i-0abc"},
+		{"us-gov-west-1", "aws-us-gov", "arn:aws-us-gov:s3:::evidence", "arn:aws-us-gov:ec2:us-gov-west-1:123456789012:instance/i-0abc"},
+		{"us-gov-east-1", "aws-us-gov", "arn:aws-us-gov:s3:::evidence", "arn:aws-us-gov:ec2:us-gov-east-1:123456789012:instance/i-0abc"},
+		{"cn-north-1", "aws-cn", "arn:aws-cn:s3:::evidence", "arn:aws-cn:ec2:cn-north-1:123456789012:instance/i-0abc"},
+		{"cn-northwest-1", "aws-cn", "arn:aws-cn:s3:::evidence", "arn:aws-cn:ec2:cn-northwest-1:123456789012:instance/i-0abc"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.region, func(t *testing.T) {
+			partition := helpers.PartitionFor(c.region)
+			require.Equal(t, c.partition, partition.ID)
+
+			assert.Equal(t, c.bucketARN, partition.ARN("s3", "", "", "evidence"))
+			assert.Equal(t, c.instanceARN, partition.ARN("ec2", c.region, "123456789012", "instance/i-0abc"))
+			assert.True(t, strings.HasSuffix(partition.Endpoint("securityhub", c.region), "."+partition.DNSSuffix))
+
+			// Security Hub and the other services are checked against the SDK; a service missing in
+			// a partition is reported so its part of the suite can be switched off there
+			unavailable, err := helpers.AssertPartitionSupport(c.region)
+			assert.NoError(t, err)
+			if len(unavailable) > 0 {
+				t.Logf("services not offered in %s: %s", c.region, strings.Join(unavailable, ", "))
+			}
+		})
+	}
+
+	// The region the suite deploys to must be one the harness knows the partition of
+	t.Run("TestRegion", func(t *testing.T) {
+		_, err := helpers.AssertPartitionSupport(helpers.TestRegion())
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// redacted is what triage puts in place of a scrubbed field
+const redacted = "[REDACTED]"
+
+// TestPIIScrubbing deploys the stack with PII scrubbing of private IPs, user names and access key
+// IDs, and injects an access key finding and a pod finding on a node with a private IP. The stored
+// evidence, the notifications, the IR execution input and the incident index must carry none of
+// those values, while fields off the list, such as the principal ID, are kept, and the raw finding
+// must be kept whole, KMS-encrypted, under the restricted/ prefix.
+func TestPIIScrubbing(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "pii")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"pii_scrubbing_enabled": true,
+		"pii_scrub_fields":      []string{"privateIpAddress", "userName", "accessKeyId"},
+		"enable_incident_index": true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	kmsKeyArn := terraform.Output(t, terraformOptions, "s3_evidence_kms_key_arn")
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	incidentTable := terraform.Output(t, terraformOptions, "lambda_triage_incident_table_name")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("pii"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+	key, err := set.AccessKey()
+	require.NoError(t, err)
+
+	// Pod findings are notify-only, so the node can be fictitious; it only carries the private IP
+	node := &victims.Instance{ID: "i-0123456789abcdef0", NetworkInterface: "eni-0123456789abcdef0", PrivateIP: "10.20.30.40"}
+	workload := &victims.KubernetesWorkload{
+		ClusterARN: helpers.PartitionFor(awsRegion).Scope(awsRegion, "123456789012").EKSCluster(ns.Name("cluster")),
+		Namespace:  "payments",
+		Name:       "checkout-7d9f8b6c5-x2x4q",
+		Type:       "pods",
+		Node:       node,
+	}
+
+	keyFinding := victims.Finding(key, ns.Name("key"), "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS", 8.0)
+	podFinding := victims.Finding(workload, ns.Name("pod"), "Execution:Runtime/ReverseShell", 8.0)
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{keyFinding, podFinding})
+	require.NoError(t, err)
+
+	// The values that must not leave the restricted prefix, per finding
+	scrubbed := map[string][]string{
+		keyFinding.ID: {key.AccessKeyID, key.UserName},
+		podFinding.ID: {node.PrivateIP},
+	}
+
+	s3Client := s3.New(sess)
+	getEvidence := func(t *testing.T, objectKey string) (*s3.GetObjectOutput, []byte) {
+		object, err := s3Client.GetObject(&s3.GetObjectInput{Bucket: aws.String(evidenceBucket), Key: aws.String(objectKey)})
+		require.NoError(t, err)
+		defer object.Body.Close()
+		body, err := io.ReadAll(object.Body)
+		require.NoError(t, err)
+		return object, body
+	}
+
+	for _, finding := range []helpers.GuardDutyFinding{keyFinding, podFinding} {
+		_, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+		require.NoError(t, err)
+	}
+
+	t.Run("EvidenceRedacted", func(t *testing.T) {
+		for _, finding := range []helpers.GuardDutyFinding{keyFinding, podFinding} {
+			metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, "true", metadata["pii-scrubbed"])
+			assert.Equal(t, "restricted/"+helpers.EvidenceKey(finding.ID, ""), metadata["raw-evidence"])
+
+			_, body := getEvidence(t, helpers.EvidenceKey(finding.ID, ""))
+			for _, value := range scrubbed[finding.ID] {
+				assert.NotContains(t, string(body), value, "evidence of %s", finding.ID)
+			}
+			assert.Contains(t, string(body), redacted)
+		}
+
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, keyFinding.ID, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "access-key:"+redacted, metadata["resources"], "key IDs must not leak through the resources metadata")
+	})
+
+	t.Run("UnlistedFieldsKept", func(t *testing.T) {
+		_, body := getEvidence(t, helpers.EvidenceKey(keyFinding.ID, ""))
+		assert.Contains(t, string(body), key.PrincipalID, "principalId is not on the field list")
+
+		_, body = getEvidence(t, helpers.EvidenceKey(podFinding.ID, ""))
+		assert.Contains(t, string(body), node.ID)
+		assert.Contains(t, string(body), node.NetworkInterface)
+	})
+
+	t.Run("RawRetainedEncrypted", func(t *testing.T) {
+		for _, finding := range []helpers.GuardDutyFinding{keyFinding, podFinding} {
+			object, body := getEvidence(t, "restricted/"+helpers.EvidenceKey(finding.ID, ""))
+			assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(object.ServerSideEncryption))
+			assert.Equal(t, kmsKeyArn, aws.StringValue(object.SSEKMSKeyId))
+			for _, value := range scrubbed[finding.ID] {
+				assert.Contains(t, string(body), value, "raw evidence of %s", finding.ID)
+			}
+			assert.NotContains(t, string(body), redacted)
+		}
+	})
+
+	// The execution input is logged with the execution data and queued for remediation on failure
+	t.Run("ExecutionInputRedacted", func(t *testing.T) {
+		for _, finding := range []helpers.GuardDutyFinding{keyFinding, podFinding} {
+			execution, err := helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 10*time.Minute)
+			require.NoError(t, err)
+			for _, value := range scrubbed[finding.ID] {
+				assert.NotContains(t, aws.StringValue(execution.Input), value, "execution input of %s", finding.ID)
+			}
+		}
+	})
+
+	t.Run("IncidentIndexRedacted", func(t *testing.T) {
+		incident, err := helpers.WaitForIncident(sess, incidentTable, keyFinding.ID, 1, 5*time.Minute)
+		require.NoError(t, err)
+		assert.NotContains(t, incident.ResourceID, key.AccessKeyID)
+		assert.NotContains(t, incident.Resources, key.AccessKeyID)
+		assert.Regexp(t, `^access-key:sha256-[0-9a-f]{16}$`, incident.ResourceID, "findings on the same key must still share a resource ID")
+	})
+
+	t.Run("NotificationsRedacted", func(t *testing.T) {
+		notifications, err := helpers.WaitForNotifications(sess, subscription.QueueURL,
+			[]string{keyFinding.ID, podFinding.ID}, 5*time.Minute, 0)
+		require.NoError(t, err)
+
+		for id, notification := range notifications {
+			raw, err := json.Marshal(notification)
+			require.NoError(t, err)
+			for _, value := range scrubbed[id] {
+				assert.NotContains(t, string(raw), value, "notification for %s", id)
+			}
+		}
+
+		details, ok := notifications[keyFinding.ID].Resource["accessKeyDetails"].(map[string]interface{})
+		require.True(t, ok, "the notification must carry the resource block")
+		assert.Equal(t, redacted, details["accessKeyId"])
+		assert.Equal(t, redacted, details["userName"])
+		assert.Equal(t, key.PrincipalID, details["principalId"])
+	})
+}
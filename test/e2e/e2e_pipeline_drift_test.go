@@ -0,0 +1,40 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestPipelineDrift checks an existing deployment for out-of-band changes to the IR pipeline.
+// It does not deploy anything and is intended to run on a schedule against a live workspace.
+func TestPipelineDrift(t *testing.T) {
+	terraformDir := os.Getenv("DRIFT_CHECK_TERRAFORM_DIR")
+	if terraformDir == "" {
+		t.Skip("set DRIFT_CHECK_TERRAFORM_DIR to the deployed workspace to run the drift check")
+	}
+
+	awsRegion := helpers.TestRegion()
+
+	terraformOptions := &terraform.Options{
+		TerraformDir: terraformDir,
+	}
+
+	expected, err := helpers.PipelineExpectationFromState(terraform.Show(t, terraformOptions))
+	require.NoError(t, err)
+	require.NotEmpty(t, expected.Rules, "no EventBridge rules found in terraform state")
+
+	harness := helpers.NewHarness(t, awsRegion)
+	sess := harness.Session
+
+	drifts, err := helpers.CheckPipelineDrift(sess, expected)
+	require.NoError(t, err)
+
+	for _, drift := range drifts {
+		t.Errorf("out-of-band change detected: %s", drift)
+	}
+}
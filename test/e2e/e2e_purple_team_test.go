@@ -0,0 +1,103 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestPurpleTeam runs benign attack emulations from a harness-owned instance instead of injecting
+// synthetic events, and checks that GuardDuty really detects them and the pipeline responds. The
+// attacker and the victim share the default VPC's default security group, so SSH between them is allowed.
+func TestPurpleTeam(t *testing.T) {
+	if os.Getenv("RUN_PURPLE_TEAM_TESTS") == "" {
+		t.Skip("set RUN_PURPLE_TEAM_TESTS=1 to run attack emulations against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "purple")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+
+	profileName := ns.Name("purple-attacker")
+	require.NoError(t, helpers.CreateSSMInstanceProfile(sess, profileName))
+	defer func() {
+		assert.NoError(t, helpers.DeleteSSMInstanceProfile(sess, profileName))
+	}()
+
+	attackerID, err := helpers.LaunchTestInstance(sess, helpers.TestInstanceOptions{
+		InstanceProfile: profileName,
+		Tags:            map[string]string{"Name": ns.Name("purple-attacker"), "TestID": ns.RunID},
+	})
+	if attackerID != "" {
+		defer func() {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, attackerID))
+		}()
+	}
+	require.NoError(t, err)
+
+	victimID, err := helpers.LaunchTestInstance(sess, helpers.TestInstanceOptions{
+		Tags: map[string]string{"Name": ns.Name("purple-victim"), "TestID": ns.RunID},
+	})
+	if victimID != "" {
+		defer func() {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, victimID))
+		}()
+	}
+	require.NoError(t, err)
+
+	victimIP, err := helpers.InstancePrivateIP(sess, victimID)
+	require.NoError(t, err)
+	require.NoError(t, helpers.WaitForSSMManaged(sess, attackerID, 10*time.Minute))
+
+	// Emulations run one after the other so each finding can be attributed to its own run
+	for _, name := range purpleTeamEmulations(t) {
+		emulation := helpers.Emulations[name]
+
+		t.Run(name, func(t *testing.T) {
+			started := time.Now()
+			require.NoError(t, helpers.RunEmulation(sess, attackerID, victimIP, emulation))
+
+			findingID, err := helpers.WaitForGuardDutyFinding(sess, emulation.FindingType, attackerID, started, 60*time.Minute)
+			require.NoError(t, err, "GuardDuty did not detect the %s emulation", name)
+			t.Logf("%s detected as %s (%s) after %s", name, findingID, emulation.FindingType, time.Since(started).Round(time.Second))
+
+			assert.NoError(t, helpers.WaitForPipelineResponse(sess, stateMachineArn, evidenceBucket, findingID, 10*time.Minute))
+		})
+	}
+}
+
+// purpleTeamEmulations reads PURPLE_TEAM_EMULATIONS (comma separated names) or falls back to the
+// emulations that detect quickly
+func purpleTeamEmulations(t *testing.T) []string {
+	raw := os.Getenv("PURPLE_TEAM_EMULATIONS")
+	if raw == "" {
+		return []string{"c2-dns", "ssh-brute-force"}
+	}
+
+	var names []string
+	for _, part := range strings.Split(raw, ",") {
+		name := strings.TrimSpace(part)
+		_, ok := helpers.Emulations[name]
+		require.True(t, ok, "unknown emulation %q in PURPLE_TEAM_EMULATIONS", name)
+		names = append(names, name)
+	}
+
+	return names
+}
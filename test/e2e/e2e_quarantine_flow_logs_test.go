@@ -0,0 +1,99 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestQuarantineFlowLogs launches a real instance, reports it in a finding and checks that triage
+// enables flow logs on its network interfaces and that records start arriving
+func TestQuarantineFlowLogs(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "flowlogs")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"enable_quarantine_flow_logs": true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	names, err := helpers.ResolveStackNames(t, terraformOptions, sess)
+	require.NoError(t, err)
+	require.NotEmpty(t, names.FlowLogsLogGroupName)
+
+	instanceID, err := helpers.LaunchTestInstance(sess, helpers.TestInstanceOptions{
+		Tags: map[string]string{"Name": ns.Name("flowlogs-victim"), "TestID": ns.RunID},
+	})
+	if instanceID != "" {
+		defer func() {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, instanceID))
+		}()
+	}
+	require.NoError(t, err)
+
+	finding := helpers.GuardDutyFinding{
+		ID:       fmt.Sprintf("test-flowlogs-%s", ns.RunID),
+		Severity: 8.5,
+		Type:     "UnauthorizedAccess:EC2/SSHBruteForce",
+		Resource: map[string]interface{}{
+			"resourceType":    "Instance",
+			"instanceDetails": map[string]interface{}{"instanceId": instanceID},
+		},
+	}
+	defer func() {
+		assert.NoError(t, helpers.DeleteFlowLogsForFinding(sess, finding.ID))
+	}()
+
+	start := time.Now()
+	require.NoError(t, helpers.PutGuardDutyFindings(sess, []helpers.GuardDutyFinding{finding}))
+
+	t.Run("InstanceTaggedForQuarantine", func(t *testing.T) {
+		value, err := helpers.WaitForInstanceTag(sess, instanceID, "GuardDutyFinding", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, finding.ID, value)
+	})
+
+	t.Run("FlowLogsEnabled", func(t *testing.T) {
+		require.NoError(t, helpers.WaitForFlowLogsEnabled(sess, instanceID, names.FlowLogsLogGroupName, 5*time.Minute))
+	})
+
+	t.Run("FlowLogDeliveryBegins", func(t *testing.T) {
+		interfaces, err := helpers.InstanceNetworkInterfaces(sess, instanceID)
+		require.NoError(t, err)
+
+		var eniIDs []string
+		for _, eni := range interfaces {
+			eniIDs = append(eniIDs, aws.StringValue(eni.NetworkInterfaceId))
+
+			// Connection attempts from the runner give the flow log something to record, even if rejected
+			if eni.Association != nil && eni.Association.PublicIp != nil {
+				for i := 0; i < 3; i++ {
+					if conn, err := net.DialTimeout("tcp", net.JoinHostPort(*eni.Association.PublicIp, "22"), 3*time.Second); err == nil {
+						conn.Close()
+					}
+				}
+			}
+		}
+
+		// Aggregation is one minute, but delivery to CloudWatch Logs can lag by several more
+		assert.NoError(t, helpers.WaitForFlowLogDelivery(sess, names.FlowLogsLogGroupName, eniIDs, start, 15*time.Minute))
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestQuarantineSSMAccess checks the documented isolation posture for responders: with
+// quarantine_allow_ssm_endpoints (QUARANTINE_ALLOW_SSM_ENDPOINTS=true) a quarantined instance stays
+// reachable through Session Manager, otherwise it must be unreachable
+func TestQuarantineSSMAccess(t *testing.T) {
+	if os.Getenv("RUN_ISOLATION_TESTS") == "" {
+		t.Skip("set RUN_ISOLATION_TESTS=1 to run isolation tests against real instances")
+	}
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	allowSSM := false
+	if raw := os.Getenv("QUARANTINE_ALLOW_SSM_ENDPOINTS"); raw != "" {
+		var err error
+		allowSSM, err = strconv.ParseBool(raw)
+		require.NoError(t, err, "QUARANTINE_ALLOW_SSM_ENDPOINTS must be true or false")
+	}
+
+	suite := helpers.NewSuite(t, awsRegion, "ssm")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"quarantine_allow_ssm_endpoints": allowSSM,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	names, err := helpers.ResolveStackNames(t, terraformOptions, sess)
+	require.NoError(t, err)
+	endpointENIs := terraform.OutputList(t, terraformOptions, "quarantine_ssm_endpoint_eni_ids")
+
+	policy, targets := helpers.FullIsolation, helpers.PolicyTargets{}
+	if allowSSM {
+		policy = helpers.SSMOnly
+		targets.SSMEndpointSGID = terraform.Output(t, terraformOptions, "quarantine_ssm_endpoints_sg_id")
+	}
+	t.Run("QuarantineSGRulesMatchPolicy", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertQuarantinePolicy(sess, names.QuarantineSGID, policy, targets))
+	})
+
+	profileName := ns.Name("ssm-victim")
+	require.NoError(t, helpers.CreateSSMInstanceProfile(sess, profileName))
+	defer func() {
+		assert.NoError(t, helpers.DeleteSSMInstanceProfile(sess, profileName))
+	}()
+
+	instanceID, err := helpers.LaunchTestInstance(sess, helpers.TestInstanceOptions{
+		InstanceProfile: profileName,
+		Tags:            map[string]string{"Name": ns.Name("ssm-victim"), "TestID": ns.RunID},
+	})
+	if instanceID != "" {
+		defer func() {
+			assert.NoError(t, helpers.TerminateTestInstance(sess, instanceID))
+		}()
+	}
+	require.NoError(t, err)
+
+	// The instance must be manageable before isolation, or an unreachable result proves nothing
+	require.NoError(t, helpers.WaitForSSMManaged(sess, instanceID, 10*time.Minute))
+	require.NoError(t, helpers.AssertSSMReachable(sess, instanceID, 2*time.Minute))
+
+	require.NoError(t, helpers.IsolateInstance(sess, instanceID, names.QuarantineSGID))
+	require.NoError(t, helpers.RebootTestInstance(sess, instanceID))
+
+	if allowSSM {
+		t.Run("EndpointPathOpen", func(t *testing.T) {
+			require.NotEmpty(t, endpointENIs, "SSM access is enabled but the stack created no endpoints")
+
+			result, err := helpers.AnalyzeReachability(sess, instanceID, endpointENIs[0], "tcp", 443, 5*time.Minute)
+			require.NoError(t, err)
+			t.Log(result)
+			assert.True(t, result.Reachable, "quarantined instance must reach the SSM endpoints on 443")
+		})
+
+		t.Run("SessionManagerReachable", func(t *testing.T) {
+			assert.NoError(t, helpers.AssertSSMReachable(sess, instanceID, 10*time.Minute))
+		})
+	} else {
+		t.Run("NoEndpointsDeployed", func(t *testing.T) {
+			assert.Empty(t, endpointENIs, "full isolation must not deploy SSM endpoints")
+		})
+
+		t.Run("SessionManagerUnreachable", func(t *testing.T) {
+			assert.NoError(t, helpers.AssertSSMUnreachable(sess, instanceID, 3*time.Minute))
+		})
+	}
+}
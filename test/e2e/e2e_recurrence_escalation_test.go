@@ -0,0 +1,152 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestRecurrenceEscalation deploys the stack with the incident index and a recurrence window, lets
+// a HIGH finding on a bucket be responded to, and then injects a new finding of the same type on the
+// same bucket while containment is paused. The recurrence must page through the urgent topic as
+// CRITICAL, be contained despite the pause, and link its evidence, execution, notification and
+// incident item to the first finding, while a finding of another type on the bucket is handled as
+// usual.
+func TestRecurrenceEscalation(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "recur")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"enable_incident_index":                true,
+		"recurrence_escalation_window_minutes": 60,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	table := terraform.Output(t, terraformOptions, "lambda_triage_incident_table_name")
+	pauseParameter := terraform.Output(t, terraformOptions, "containment_pause_parameter_name")
+
+	subscriptions := map[string]*helpers.TestSubscription{}
+	for name, output := range map[string]string{"standard": "sns_topic_arn", "urgent": "sns_urgent_topic_arn"} {
+		subscription, err := helpers.SubscribeTestQueue(sess, terraform.Output(t, terraformOptions, output), ns.Name("recur-"+name), "")
+		if subscription != nil {
+			defer func() {
+				assert.NoError(t, subscription.Delete(sess))
+			}()
+		}
+		require.NoError(t, err)
+		subscriptions[name] = subscription
+	}
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	const findingType = "UnauthorizedAccess:S3/MaliciousIPCaller.Custom"
+	first := victims.Finding(bucket, ns.Name("first"), findingType, 7.5)
+	other := victims.Finding(bucket, ns.Name("other"), "Discovery:S3/MaliciousIPCaller.Custom", 7.5)
+	source := helpers.NewEventBridgeSource(sess)
+
+	// The first finding is responded to and resolved before it recurs
+	_, err := source.Inject([]helpers.GuardDutyFinding{first})
+	require.NoError(t, err)
+	execution, err := helpers.WaitForTriageExecution(sess, stateMachineArn, first.ID, 10*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, sfn.ExecutionStatusSucceeded, aws.StringValue(execution.Status))
+
+	_, err = source.Inject([]helpers.GuardDutyFinding{other})
+	require.NoError(t, err)
+	_, err = helpers.WaitForTriageExecution(sess, stateMachineArn, other.ID, 10*time.Minute)
+	require.NoError(t, err)
+
+	// A recurrence is contained even during a change freeze
+	require.NoError(t, helpers.SetContainmentPaused(sess, pauseParameter, true))
+	defer func() {
+		assert.NoError(t, helpers.SetContainmentPaused(sess, pauseParameter, false))
+	}()
+	recurrence := victims.Finding(bucket, ns.Name("recurrence"), findingType, 7.5)
+	_, err = source.Inject([]helpers.GuardDutyFinding{recurrence})
+	require.NoError(t, err)
+
+	t.Run("ContainedDespitePause", func(t *testing.T) {
+		execution, err := helpers.WaitForTriageExecution(sess, stateMachineArn, recurrence.ID, 10*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, sfn.ExecutionStatusSucceeded, aws.StringValue(execution.Status))
+
+		input, err := helpers.ParseExecutionInput(aws.StringValue(execution.Input))
+		require.NoError(t, err)
+		assert.Equal(t, "CRITICAL", input.SeverityLabel)
+		require.NotNil(t, input.Recurrence)
+		assert.Equal(t, first.ID, input.Recurrence.PreviousFindingID)
+
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, recurrence.ID, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, metadata["deferred-at"], "a recurrence must not be deferred")
+	})
+
+	t.Run("EvidenceLinked", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, recurrence.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, metadata["recurrence-of"])
+
+		link, err := helpers.GetEvidenceRecurrence(sess, evidenceBucket, helpers.EvidenceKey(recurrence.ID, ""))
+		require.NoError(t, err)
+		require.NotNil(t, link, "the evidence must link the earlier occurrence")
+		assert.Equal(t, first.ID, link.PreviousFindingID)
+		assert.Equal(t, helpers.EvidenceKey(first.ID, ""), link.PreviousEvidence)
+		_, err = helpers.WaitForEvidenceObject(sess, evidenceBucket, link.PreviousEvidence, time.Minute)
+		assert.NoError(t, err, "the linked evidence must exist")
+
+		firstMetadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, first.ID, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, firstMetadata["triaged-at"], strconv.FormatInt(link.PreviousTriagedAt, 10))
+	})
+
+	t.Run("PagedAsCritical", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, subscriptions["urgent"].QueueURL, []string{recurrence.ID}, 5*time.Minute, time.Minute)
+		require.NoError(t, err)
+		notification := received[recurrence.ID]
+		assert.Equal(t, "CRITICAL", notification.Attributes["severity"])
+		require.NotNil(t, notification.Recurrence)
+		assert.Equal(t, first.ID, notification.Recurrence.PreviousFindingID)
+		assert.NotContains(t, received, first.ID, "the first occurrence is not paged")
+	})
+
+	t.Run("OtherTypeNotEscalated", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, subscriptions["standard"].QueueURL, []string{first.ID, other.ID}, 5*time.Minute, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "HIGH", received[other.ID].Attributes["severity"])
+		assert.Nil(t, received[other.ID].Recurrence)
+
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, other.ID, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, metadata["recurrence-of"])
+	})
+
+	t.Run("IncidentEscalated", func(t *testing.T) {
+		incident, err := helpers.WaitForIncident(sess, table, recurrence.ID, 1, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, helpers.IncidentEscalated, incident.Status)
+		assert.Equal(t, first.ID, incident.RecurrenceOf)
+		assert.Equal(t, findingType, incident.FindingType)
+
+		original, err := helpers.WaitForIncident(sess, table, first.ID, 1, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, helpers.IncidentOpen, original.Status)
+		assert.Equal(t, original.ResourceID, incident.ResourceID)
+	})
+}
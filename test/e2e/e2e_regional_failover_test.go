@@ -0,0 +1,144 @@
+package test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/athena"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/timeline"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestRegionalFailover simulates the loss of the primary region. A stack is deployed to the
+// secondary region (DR_SECONDARY_REGION, default us-west-2) and another to the primary region,
+// replicating its evidence into the secondary's bucket with S3 Cross-Region Replication. Once a
+// finding has been triaged in the primary, every call the test makes to the primary region is
+// refused: the secondary pipeline must still triage findings, and the responder tooling behind
+// ir-evidence must read the primary's finding from the replicated evidence.
+func TestRegionalFailover(t *testing.T) {
+	if os.Getenv("RUN_DR_TESTS") == "" {
+		t.Skip("set RUN_DR_TESTS=1 to run the regional failover suite")
+	}
+	t.Parallel()
+
+	primaryRegion := helpers.TestRegion()
+	secondaryRegion := os.Getenv("DR_SECONDARY_REGION")
+	if secondaryRegion == "" {
+		secondaryRegion = "us-west-2"
+	}
+	require.NotEqual(t, primaryRegion, secondaryRegion, "DR_SECONDARY_REGION must differ from the primary region")
+
+	// The secondary is deployed first, since the primary replicates into its evidence bucket. Both
+	// stacks are applied from their own copy of the configuration, so each keeps its own state.
+	secondary := helpers.NewSuite(t, secondaryRegion, "drsec")
+	secondaryOptions := secondary.StackOptions(nil)
+	secondaryOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../../", ".")
+
+	defer terraform.Destroy(t, secondaryOptions)
+	terraform.InitAndApply(t, secondaryOptions)
+
+	secondaryBucket := terraform.Output(t, secondaryOptions, "s3_evidence_bucket_name")
+
+	primary := helpers.NewSuite(t, primaryRegion, "dr")
+	primaryOptions := primary.StackOptions(map[string]interface{}{
+		"evidence_replica_bucket_arn":  terraform.Output(t, secondaryOptions, "s3_evidence_bucket_arn"),
+		"evidence_replica_kms_key_arn": terraform.Output(t, secondaryOptions, "s3_evidence_kms_key_arn"),
+	})
+	primaryOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../../", ".")
+
+	defer terraform.Destroy(t, primaryOptions)
+	terraform.InitAndApply(t, primaryOptions)
+
+	// A finding triaged in the primary before it is lost; its evidence is what must survive
+	bucket := victims.TestBucket(t, primary.Session, primary.Namespace.RunID)
+
+	finding := victims.Finding(bucket, primary.Namespace.Name("replicated"), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+	_, err := helpers.NewEventBridgeSource(primary.Session).Inject([]helpers.GuardDutyFinding{finding})
+	require.NoError(t, err)
+	_, err = helpers.WaitForTriageExecution(primary.Session, terraform.Output(t, primaryOptions, "stepfn_ir_state_machine_arn"), finding.ID, 10*time.Minute)
+	require.NoError(t, err)
+
+	// From here on the primary region is gone
+	sess, ns := secondary.Session, secondary.Namespace
+	fence := helpers.FenceRegion(sess, primaryRegion)
+
+	t.Run("SecondaryTriagesFindings", func(t *testing.T) {
+		set := victims.New(sess, ns.RunID)
+		defer func() {
+			assert.NoError(t, set.Cleanup())
+		}()
+		target := scenario.Target{
+			Session:         sess,
+			StateMachineArn: terraform.Output(t, secondaryOptions, "stepfn_ir_state_machine_arn"),
+			EvidenceBucket:  secondaryBucket,
+			Victims:         set,
+		}
+
+		sc, err := scenario.Load("../scenarios/ssh-brute-force-high.yaml")
+		require.NoError(t, err)
+
+		result, err := scenario.Run(target, sc, helpers.NewEventBridgeSource(sess), ns.RunID)
+		require.NoError(t, err)
+
+		t.Log("\n" + result.String())
+		assert.True(t, result.Passed(), "%s: %v", sc.Description, result.Failures)
+	})
+
+	replicated := t.Run("PrimaryEvidenceReplicated", func(t *testing.T) {
+		// Replication is asynchronous; S3 replicates most objects within 15 minutes
+		require.True(t, helpers.EventuallyAssert(t, func(c require.TestingT) {
+			object, err := s3.New(sess).HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String(secondaryBucket),
+				Key:    aws.String(helpers.EvidenceKey(finding.ID, "")),
+			})
+			require.NoError(c, err)
+			require.Equal(c, s3.ReplicationStatusReplica, aws.StringValue(object.ReplicationStatus))
+		}, 15*time.Minute))
+	})
+
+	// ir-evidence reads the replica the way a responder would run it against the secondary region
+	t.Run("TimelineFromReplica", func(t *testing.T) {
+		if !replicated {
+			t.Skip("the primary's evidence was not replicated")
+		}
+
+		// Only the evidence survives the primary: its executions and triage logs are recorded as gaps
+		reconstructed, err := timeline.Build(timeline.Target{Session: sess, EvidenceBucket: secondaryBucket}, finding.ID, timeline.Options{})
+		require.NoError(t, err)
+		t.Log(reconstructed)
+
+		_, ok := reconstructed.Milestone(timeline.EvidenceStored)
+		assert.True(t, ok, "the timeline has no evidence of finding %s", finding.ID)
+	})
+
+	t.Run("QueryReplica", func(t *testing.T) {
+		if !replicated {
+			t.Skip("the primary's evidence was not replicated")
+		}
+
+		evidence, err := athena.Open(sess, secondaryBucket, ns.RunID)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, evidence.Close())
+		}()
+
+		queried, err := evidence.FindingByID(finding.ID)
+		require.NoError(t, err)
+		require.NotNil(t, queried, "the replica has no evidence of finding %s", finding.ID)
+		assert.Equal(t, primaryRegion, queried.Region, "the replicated evidence must record the region it was triaged in")
+	})
+
+	t.Run("NoPrimaryRegionCalls", func(t *testing.T) {
+		assert.Empty(t, fence.Blocked(), "calls still depended on %s", primaryRegion)
+	})
+}
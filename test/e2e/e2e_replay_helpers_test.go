@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/vcr"
+)
+
+// TestReplayStepFunctionWait replays recorded DescribeExecution polls through
+// WaitForStepFunctionExecution, so its completion and timeout handling are checked offline in
+// milliseconds. It needs no credentials and does not run in parallel, since replay swaps the
+// helpers' clock.
+func TestReplayStepFunctionWait(t *testing.T) {
+	const executionArn = "arn:aws:states:us-east-1:123456789012:execution:ir-replay-state-machine:IR-test-replay-001"
+
+	t.Run("Succeeded", func(t *testing.T) {
+		sess, err := vcr.NewReplaySession("us-east-1")
+		require.NoError(t, err)
+		vcr.ReplayCassette(t, sess, t.Name())
+
+		execution, err := helpers.WaitForStepFunctionExecution(sess, executionArn, 10*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, sfn.ExecutionStatusSucceeded, aws.StringValue(execution.Status))
+		assert.Equal(t, `{"status":"completed"}`, aws.StringValue(execution.Output))
+	})
+
+	t.Run("TimesOut", func(t *testing.T) {
+		sess, err := vcr.NewReplaySession("us-east-1")
+		require.NoError(t, err)
+		vcr.ReplayCassette(t, sess, t.Name())
+
+		// Three polls two seconds apart fit in the timeout; the recording holds exactly those
+		_, err = helpers.WaitForStepFunctionExecution(sess, executionArn, 6*time.Second)
+		assert.Error(t, err)
+	})
+}
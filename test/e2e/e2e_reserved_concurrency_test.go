@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// TestReservedConcurrencyExhaustion floods a function limited to one concurrent execution. The
+// throttled invocations must wait in Lambda's asynchronous event queue and be retried from there,
+// so every finding is processed or dead-lettered.
+func TestReservedConcurrencyExhaustion(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	floodSize := 50
+
+	suite := helpers.NewSuite(t, awsRegion, "throttle")
+	sess, ns := suite.Session, suite.Namespace
+
+	// A single reserved execution guarantees the flood is throttled
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"lambda_reserved_concurrency": 1,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	lambdaFunctionName := terraform.Output(t, terraformOptions, "lambda_triage_function_name")
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	dlqURL := terraform.Output(t, terraformOptions, "eventbridge_dlq_url")
+
+	// Failed eventual assertions report the triage logs, the latest execution and the DLQs
+	helpers.RegisterFailureContext(t, helpers.FailureContextFromOutputs(sess, suite.Log, terraform.OutputAll(t, terraformOptions)))
+
+	findings, err := helpers.GenerateBulkEvents(floodSize, "HIGH")
+	require.NoError(t, err)
+	for i := range findings {
+		findings[i].ID = fmt.Sprintf("test-throttle-%s-%d", ns.RunID, i)
+	}
+
+	// The metric waits widen the window by the clock skew tolerance
+	floodStart := clock.Anchor().Start
+	require.NoError(t, helpers.PutGuardDutyFindings(sess, findings))
+
+	t.Run("InvocationsThrottled", func(t *testing.T) {
+		throttles, err := helpers.WaitForMetricSum(sess, "AWS/Lambda", "Throttles", map[string]string{"FunctionName": lambdaFunctionName}, floodStart, 1, 10*time.Minute)
+		require.NoError(t, err)
+		assert.Greater(t, throttles, 0.0)
+	})
+
+	// EventBridge invokes the function asynchronously, so Lambda accepts every event into its own
+	// queue and retries the throttled ones itself; EventBridge never sees a throttle to retry
+	t.Run("ThrottledInvocationsQueuedByLambda", func(t *testing.T) {
+		received, err := helpers.WaitForMetricSum(sess, "AWS/Lambda", "AsyncEventsReceived", map[string]string{"FunctionName": lambdaFunctionName}, floodStart, float64(floodSize), 10*time.Minute)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, received, float64(floodSize))
+
+		dropped, err := helpers.GetLambdaMetricSum(sess, lambdaFunctionName, "AsyncEventsDropped", clock.Tolerant(floodStart), clock.Default.Now().Add(clock.Skew()))
+		require.NoError(t, err)
+		assert.Zero(t, dropped, "throttled events must be retried from the async queue, not dropped")
+	})
+
+	t.Run("NoSilentDrops", func(t *testing.T) {
+		// Received messages stay hidden until their visibility timeout expires, so a retry would not
+		// see those an earlier attempt received; the IDs are accumulated across attempts instead
+		deadLettered := map[string]bool{}
+		helpers.EventuallyAssert(t, func(c require.TestingT) {
+			processed, err := helpers.ListEvidenceFindingIDs(sess, evidenceBucket)
+			require.NoError(c, err)
+
+			received, err := helpers.ReceiveDLQFindingIDs(sess, dlqURL, 30*time.Second)
+			require.NoError(c, err)
+			for id := range received {
+				deadLettered[id] = true
+			}
+
+			var missing []string
+			for _, finding := range findings {
+				if !processed[finding.ID] && !deadLettered[finding.ID] {
+					missing = append(missing, finding.ID)
+				}
+			}
+			assert.Empty(c, missing, "every flooded finding should be processed or land in the DLQ")
+		}, 20*time.Minute)
+	})
+
+	// Report how hard the flood pushed the suite's own API calls
+	t.Log("\n" + helpers.DefaultRateLimiter.String())
+}
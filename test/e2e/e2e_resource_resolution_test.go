@@ -0,0 +1,57 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestResourceResolution injects a finding for every resource block in the resolution table and
+// checks the identifiers triage resolved from it, including that unknown types are flagged
+func TestResourceResolution(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	cases, err := helpers.LoadResolutionCases("../helpers/resource-blocks.json")
+	require.NoError(t, err)
+
+	suite := helpers.NewSuite(t, awsRegion, "resolve")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+
+	// Evidence is written before any containment, so the made-up identifiers of the table still show
+	// what triage resolved even though acting on them fails
+	findings := make([]helpers.GuardDutyFinding, len(cases))
+	for i, c := range cases {
+		findings[i] = helpers.GuardDutyFinding{
+			ID:       fmt.Sprintf("resolve-%s-%s", c.Name, ns.RunID),
+			Severity: 7.5,
+			Type:     "UnauthorizedAccess:EC2/MaliciousIPCaller.Custom",
+			Resource: c.Resource,
+		}
+	}
+	_, err = helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+
+	for i, c := range cases {
+		c, findingID := c, findings[i].ID
+		t.Run(c.Name, func(t *testing.T) {
+			assert.NoError(t, helpers.AssertResourceResolution(sess, evidenceBucket, findingID, c, 5*time.Minute))
+		})
+	}
+}
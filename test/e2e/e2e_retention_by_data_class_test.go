@@ -0,0 +1,133 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestRetentionByDataClass deploys the stack with a retention matrix and injects findings on
+// resources tagged with each data classification, one with a class the matrix does not know and one
+// untagged. Each classified finding's evidence must be stored under its class's prefix only and
+// expire on its class's schedule, while the others keep the default prefix and retention.
+func TestRetentionByDataClass(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "retain")
+	sess, ns := suite.Session, suite.Namespace
+
+	const defaultRetentionDays = 365
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"evidence_retention_days": defaultRetentionDays,
+		"evidence_retention_matrix": map[string]interface{}{
+			"restricted": map[string]interface{}{
+				"retention_days":               2555,
+				"glacier_transition_days":      90,
+				"deep_archive_transition_days": 180,
+			},
+			"internal": map[string]interface{}{
+				"retention_days": 400,
+			},
+		},
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	classified := func(class string) victims.Victim {
+		return victims.Tagged(bucket, map[string]string{"DataClassification": class})
+	}
+	cases := []struct {
+		name   string
+		victim victims.Victim
+		// classification is the one triage records; prefix is empty for the default findings/ prefix
+		classification string
+		prefix         string
+		ruleID         string
+		retentionDays  int
+	}{
+		{"Restricted", classified("restricted"), "restricted", "restricted", "evidence-retention-restricted", 2555},
+		// Tag values are matched case-insensitively
+		{"Internal", classified("Internal"), "internal", "internal", "evidence-retention-internal", 400},
+		{"UnknownClass", classified("public"), "public", "", "evidence-retention", defaultRetentionDays},
+		{"Untagged", bucket, "", "", "evidence-retention", defaultRetentionDays},
+	}
+
+	findings := make([]helpers.GuardDutyFinding, len(cases))
+	for i, tc := range cases {
+		findings[i] = victims.Finding(tc.victim, ns.Name(tc.name), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+	}
+	_, err := helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+
+	s3Client := s3.New(sess)
+	for i, tc := range cases {
+		tc, finding := tc, findings[i]
+		t.Run(tc.name, func(t *testing.T) {
+			key := helpers.EvidenceKey(finding.ID, tc.prefix)
+			object, err := helpers.WaitForEvidenceObject(sess, evidenceBucket, key, 5*time.Minute)
+			require.NoError(t, err)
+			var classification string
+			for name, value := range object.Metadata {
+				if strings.EqualFold(name, "data-classification") {
+					classification = aws.StringValue(value)
+				}
+			}
+			assert.Equal(t, tc.classification, classification)
+
+			if tc.prefix != "" {
+				_, err := s3Client.HeadObject(&s3.HeadObjectInput{
+					Bucket: aws.String(evidenceBucket),
+					Key:    aws.String(helpers.EvidenceKey(finding.ID, "")),
+				})
+				assert.Error(t, err, "classified evidence must not also be stored under findings/")
+			}
+
+			expiration, err := helpers.ParseObjectExpiration(object.Expiration)
+			require.NoError(t, err)
+			require.NotNil(t, expiration, "%s has no lifecycle expiration", key)
+			assert.Equal(t, tc.ruleID, expiration.RuleID)
+
+			// S3 expires objects at the first midnight UTC after their retention has run out
+			due := aws.TimeValue(object.LastModified).AddDate(0, 0, tc.retentionDays)
+			assert.False(t, expiration.Date.Before(due), "%s expires %s, before %s", key, expiration.Date, due)
+			assert.True(t, expiration.Date.Before(due.Add(48*time.Hour)), "%s expires %s, long after %s", key, expiration.Date, due)
+		})
+	}
+
+	t.Run("LifecycleRules", func(t *testing.T) {
+		defaultRule, err := helpers.GetLifecycleRule(sess, evidenceBucket, "evidence-retention")
+		require.NoError(t, err)
+		assert.Equal(t, "findings/", aws.StringValue(defaultRule.Filter.Prefix), "the default rule must not overlap the classified prefixes")
+
+		restricted, err := helpers.GetLifecycleRule(sess, evidenceBucket, "evidence-retention-restricted")
+		require.NoError(t, err)
+		assert.Equal(t, "classified/restricted/", aws.StringValue(restricted.Filter.Prefix))
+		assert.EqualValues(t, 2555, aws.Int64Value(restricted.NoncurrentVersionExpiration.NoncurrentDays))
+		transitions := map[string]int64{}
+		for _, transition := range restricted.Transitions {
+			transitions[aws.StringValue(transition.StorageClass)] = aws.Int64Value(transition.Days)
+		}
+		assert.Equal(t, map[string]int64{"GLACIER": 90, "DEEP_ARCHIVE": 180}, transitions)
+
+		internal, err := helpers.GetLifecycleRule(sess, evidenceBucket, "evidence-retention-internal")
+		require.NoError(t, err)
+		assert.Equal(t, "classified/internal/", aws.StringValue(internal.Filter.Prefix))
+		assert.Empty(t, internal.Transitions, "a class without transitions must stay in S3 Standard")
+	})
+}
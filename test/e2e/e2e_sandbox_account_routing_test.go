@@ -0,0 +1,123 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// Member accounts named in the account classification; findings only carry their IDs, so the
+// accounts do not have to exist
+const (
+	sandboxAccountID    = "111122223333"
+	productionAccountID = "444455556666"
+)
+
+// TestSandboxAccountRouting deploys the stack with an account classification and injects CRITICAL
+// findings carrying member account IDs, as the delegated administrator receives them in org mode. The
+// sandbox account's finding must take the low-priority path, recorded and notified on the standard
+// topic without a workflow execution or a page, while the production account's finding and one from
+// an unlisted account get the full response.
+func TestSandboxAccountRouting(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "sandbox")
+	sess, ns := suite.Session, suite.Namespace
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"account_classification": map[string]string{
+			sandboxAccountID:    "sandbox",
+			productionAccountID: "production",
+		},
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+
+	subscriptions := map[string]*helpers.TestSubscription{}
+	for name, output := range map[string]string{"standard": "sns_topic_arn", "urgent": "sns_urgent_topic_arn"} {
+		subscription, err := helpers.SubscribeTestQueue(sess, terraform.Output(t, terraformOptions, output), ns.Name("sandbox-"+name), "")
+		if subscription != nil {
+			defer func() {
+				assert.NoError(t, subscription.Delete(sess))
+			}()
+		}
+		require.NoError(t, err)
+		subscriptions[name] = subscription
+	}
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	const findingType = "UnauthorizedAccess:S3/MaliciousIPCaller.Custom"
+	sandbox := victims.Finding(bucket, ns.Name("sandbox"), findingType, 9.5)
+	sandbox.AccountID = sandboxAccountID
+	production := victims.Finding(bucket, ns.Name("production"), findingType, 9.5)
+	production.AccountID = productionAccountID
+	// Without an accountId the event's own account is used, which the classification does not list
+	unlisted := victims.Finding(bucket, ns.Name("unlisted"), findingType, 9.5)
+
+	_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{sandbox, production, unlisted})
+	require.NoError(t, err)
+
+	t.Run("SandboxLowPriority", func(t *testing.T) {
+		metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, sandbox.ID, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "sandbox", metadata["account-class"])
+
+		// No execution means nothing was isolated
+		assert.NoError(t, helpers.AssertTriageExecutionCount(sess, stateMachineArn, sandbox.ID, 0, time.Minute, 2*time.Minute))
+
+		received, err := helpers.WaitForNotifications(sess, subscriptions["standard"].QueueURL, []string{sandbox.ID}, 5*time.Minute, 0)
+		require.NoError(t, err)
+		notification := received[sandbox.ID]
+		assert.Equal(t, "sandbox", notification.Attributes["account_class"])
+		assert.Equal(t, "CRITICAL", notification.Attributes["severity"], "the severity is kept for filtering")
+		assert.Equal(t, sandboxAccountID, notification.AccountID)
+		assert.Equal(t, sandboxAccountID, notification.Attributes["account_id"], "subscriptions filter on the finding's account")
+	})
+
+	t.Run("FullResponse", func(t *testing.T) {
+		for _, finding := range []helpers.GuardDutyFinding{production, unlisted} {
+			execution, err := helpers.WaitForTriageExecution(sess, stateMachineArn, finding.ID, 10*time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, sfn.ExecutionStatusSucceeded, aws.StringValue(execution.Status), finding.ID)
+
+			output, err := helpers.ParseExecutionOutput(aws.StringValue(execution.Output))
+			require.NoError(t, err)
+			require.NotNil(t, output.Containment)
+			assert.NotEmpty(t, output.Containment.Targets, finding.ID)
+			assert.Empty(t, output.Containment.Failed, finding.ID)
+			for _, target := range output.Containment.Targets {
+				// No containment branch acts on buckets; they are on record for responders
+				assert.Equal(t, helpers.ContainmentRecorded, target.Status, "%s: %s", finding.ID, target.Target)
+			}
+
+			metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, time.Minute)
+			require.NoError(t, err)
+			assert.Empty(t, metadata["account-class"], finding.ID)
+		}
+	})
+
+	t.Run("OnlyProductionPaged", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, subscriptions["urgent"].QueueURL, []string{production.ID, unlisted.ID}, 5*time.Minute, time.Minute)
+		require.NoError(t, err)
+		for _, id := range []string{production.ID, unlisted.ID} {
+			assert.Equal(t, "production", received[id].Attributes["account_class"], id)
+		}
+		assert.Equal(t, productionAccountID, received[production.ID].Attributes["account_id"], "subscriptions filter on the finding's account")
+		assert.NotContains(t, received, sandbox.ID, "sandbox findings must not page")
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/kpi"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestScenarios runs every YAML scenario in SCENARIO_DIR (default test/scenarios) against one deployment
+func TestScenarios(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	scenarioDir := os.Getenv("SCENARIO_DIR")
+	if scenarioDir == "" {
+		scenarioDir = "../scenarios"
+	}
+
+	scenarios, err := scenario.LoadDir(scenarioDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, scenarios, "no scenarios found in %s", scenarioDir)
+
+	suite := helpers.NewSuite(t, awsRegion, "scenario")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	// Scenarios expecting isolation name victims; fictitious resources are never contained
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	target := scenario.Target{
+		Session:         sess,
+		StateMachineArn: terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn"),
+		EvidenceBucket:  terraform.Output(t, terraformOptions, "s3_evidence_bucket_name"),
+		// Compensation scenarios deny the role actions, so they fail a later step on purpose
+		StateMachineRole: terraform.Output(t, terraformOptions, "iam_stepfn_role_name"),
+		Victims:          set,
+	}
+	// Passed runs feed the KPI trend when KPI_TIMESTREAM_* or KPI_S3_BUCKET name a store
+	kpis := kpi.FromEnv(sess)
+
+	for _, sc := range scenarios {
+		sc := sc
+		results := map[string]*scenario.Result{}
+
+		for i, sourceName := range sc.Sources {
+			// Each source gets its own finding IDs so effects from one run cannot satisfy another
+			runID := fmt.Sprintf("%s-%d", ns.RunID, i)
+
+			t.Run(sc.Name+"/"+sourceName, func(t *testing.T) {
+				source, err := helpers.NewFindingSource(sess, sourceName)
+				require.NoError(t, err)
+				// Detonated Stratus techniques stay up for containment until the scenario is done
+				if stratus, ok := source.(*helpers.StratusSource); ok {
+					defer func() {
+						assert.NoError(t, stratus.Cleanup())
+					}()
+				}
+
+				result, err := scenario.Run(target, sc, source, runID)
+				require.NoError(t, err)
+
+				t.Log("\n" + result.String())
+				assert.True(t, result.Passed(), "%s: %v", sc.Description, result.Failures)
+				assert.NoError(t, kpi.Record(kpis, target, result, sourceName, runID))
+
+				// Security Hub evidence must keep the original ASFF finding alongside the normalized detail
+				if sourceName == helpers.SourceSecurityHub {
+					for id, effects := range result.Observed {
+						if effects["evidence"] {
+							assert.NoError(t, helpers.AssertEvidenceASFF(sess, target.EvidenceBucket, id))
+						}
+					}
+				}
+
+				results[sourceName] = result
+			})
+		}
+
+		// Every ingestion path must lead to the same pipeline behaviour
+		if len(results) > 1 {
+			assert.NoError(t, scenario.CompareSources(results), sc.Name)
+		}
+	}
+}
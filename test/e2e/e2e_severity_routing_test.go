@@ -0,0 +1,77 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// TestSeverityRouting checks that CRITICAL findings page through the urgent topic and HIGH findings
+// go to the standard topic, by capturing both topics on SQS test subscriptions
+func TestSeverityRouting(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "routing")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	standardTopic := terraform.Output(t, terraformOptions, "sns_topic_arn")
+	urgentTopic := terraform.Output(t, terraformOptions, "sns_urgent_topic_arn")
+
+	subscriptions := map[string]*helpers.TestSubscription{}
+	for name, topic := range map[string]string{"standard": standardTopic, "urgent": urgentTopic} {
+		subscription, err := helpers.SubscribeTestQueue(sess, topic, ns.Name("routing-"+name), "")
+		if subscription != nil {
+			defer func() {
+				assert.NoError(t, subscription.Delete(sess))
+			}()
+		}
+		require.NoError(t, err)
+		subscriptions[name] = subscription
+	}
+
+	// Not instances, so triage does not depend on live EC2 targets
+	high := helpers.GuardDutyFinding{
+		ID:       "test-routing-high-" + ns.RunID,
+		Severity: 7.5,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey"},
+	}
+	critical := high
+	critical.ID = "test-routing-critical-" + ns.RunID
+	critical.Severity = 9.5
+	require.Equal(t, severity.High, severity.FromGuardDuty(high.Severity).Label())
+	require.Equal(t, severity.Critical, severity.FromGuardDuty(critical.Severity).Label())
+
+	_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{high, critical})
+	require.NoError(t, err)
+
+	// The settle period gives a misrouted notification time to land on the wrong topic too
+	t.Run("HighToStandardTopic", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, subscriptions["standard"].QueueURL, []string{high.ID}, 5*time.Minute, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, severity.High.String(), received[high.ID].Attributes["severity"])
+		assert.NotContains(t, received, critical.ID, "CRITICAL finding must not go to the standard topic")
+	})
+
+	t.Run("CriticalToUrgentTopic", func(t *testing.T) {
+		received, err := helpers.WaitForNotifications(sess, subscriptions["urgent"].QueueURL, []string{critical.ID}, 5*time.Minute, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, severity.Critical.String(), received[critical.ID].Attributes["severity"])
+		assert.NotContains(t, received, high.ID, "HIGH finding must not page through the urgent topic")
+	})
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// TestSQSBufferedTriage deploys the stack with the SQS buffer between EventBridge and triage and
+// checks the buffer's configuration, that a poison message only fails itself, and that a burst of
+// 500 findings is triaged completely
+func TestSQSBufferedTriage(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+	batchSize := int64(10)
+
+	suite := helpers.NewSuite(t, awsRegion, "buffer")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"enable_sqs_buffer":     true,
+		"sqs_buffer_batch_size": batchSize,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	functionName := terraform.Output(t, terraformOptions, "lambda_triage_function_name")
+	bufferURL := terraform.Output(t, terraformOptions, "lambda_triage_buffer_queue_url")
+	bufferDLQ := terraform.Output(t, terraformOptions, "lambda_triage_buffer_dlq_url")
+
+	t.Run("BufferConfigured", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertBufferConfiguration(sess, bufferURL, functionName, batchSize))
+	})
+
+	t.Run("PartialBatchFailure", func(t *testing.T) {
+		// Not instances, so triage does not depend on a live EC2 target
+		var findings []helpers.GuardDutyFinding
+		for i := 0; i < 4; i++ {
+			findings = append(findings, helpers.GuardDutyFinding{
+				ID:       fmt.Sprintf("test-batch-%s-%d", ns.RunID, i),
+				Severity: 7.5,
+				Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+				Resource: map[string]interface{}{"resourceType": "AccessKey"},
+			})
+		}
+		// The poison message is redelivered until it exhausts the buffer's receive count
+		assert.NoError(t, helpers.AssertPartialBatchHandling(sess, bufferURL, bufferDLQ, evidenceBucket, findings, 15*time.Minute))
+	})
+
+	t.Run("BurstTriaged", func(t *testing.T) {
+		assert.NoError(t, helpers.AssertBurstTriaged(sess, evidenceBucket, bufferDLQ, ns.RunID, 500, 20*time.Minute))
+	})
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/canary"
+)
+
+// TestTeardownLeavesNoResidue deploys a stack, stores evidence in it, empties its buckets and checks
+// that destroy then removes every resource, instead of trusting terraform destroy to fail loudly
+func TestTeardownLeavesNoResidue(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "teardown")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"retain_log_groups": false,
+	})
+
+	terraform.InitAndApply(t, terraformOptions)
+	targets := helpers.TeardownTargetsFromOutputs(terraform.OutputAll(t, terraformOptions), false)
+
+	// Invoke the triage function once so evidence and its log streams exist, as after any real use
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	finding := canary.Finding(ns.RunID, 7.0)
+	_, err := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+	assert.NoError(t, err)
+	_, err = helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+	assert.NoError(t, err)
+
+	// Versioned buckets keep every version, which terraform destroy cannot delete
+	for _, bucket := range targets.Buckets {
+		assert.NoError(t, helpers.EmptyTestBucket(sess, bucket))
+	}
+
+	// Residue is the finding whether or not destroy reports an error
+	if _, err := terraform.DestroyE(t, terraformOptions); err != nil {
+		t.Logf("terraform destroy failed: %v", err)
+	}
+
+	assert.NoError(t, helpers.AssertTeardownComplete(sess, targets))
+}
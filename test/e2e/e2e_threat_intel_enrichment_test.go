@@ -0,0 +1,121 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/intelmock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestThreatIntelEnrichment points the stack at a mock threat intel endpoint and reports findings
+// whose remote IP the endpoint knows, does not know, fails on and answers too late for. Evidence
+// and notifications must carry GuardDuty's GeoIP and ASN details and the endpoint's reputation, and
+// a failed lookup must leave the finding triaged and contained, only without a reputation.
+func TestThreatIntelEnrichment(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "intel")
+	sess, ns := suite.Session, suite.Namespace
+
+	const lookupTimeout = 2
+	mock, err := intelmock.Deploy(sess, ns.Name("intel-mock"), "", map[string]intelmock.Verdict{
+		"203.0.113.10": {Reputation: "malicious", Score: 95},
+		"203.0.113.20": {Status: 500},
+		"203.0.113.30": {Reputation: "malicious", DelaySeconds: 3 * lookupTimeout},
+	})
+	defer func() {
+		assert.NoError(t, mock.Delete(sess))
+	}()
+	require.NoError(t, err)
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"threat_intel_endpoint":        mock.URL,
+		"threat_intel_timeout_seconds": lookupTimeout,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("intel"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	cases := []struct {
+		name       string
+		ip         string
+		status     string
+		reputation string
+	}{
+		{"KnownMalicious", "203.0.113.10", "enriched", "malicious"},
+		{"NegativeLookup", "203.0.113.40", "enriched", "unknown"},
+		{"EndpointError", "203.0.113.20", "degraded", ""},
+		{"EndpointTimeout", "203.0.113.30", "degraded", ""},
+	}
+
+	findings := make([]helpers.GuardDutyFinding, len(cases))
+	findingIDs := make([]string, len(cases))
+	for i, c := range cases {
+		findings[i] = victims.Finding(bucket, ns.Name("intel-"+c.name), "UnauthorizedAccess:S3/MaliciousIPCaller.Custom", 8.0)
+		findings[i].Service = helpers.RemoteIPService(c.ip, "Exampleland", "64496", "Example Networks")
+		findingIDs[i] = findings[i].ID
+	}
+	_, err = helpers.NewEventBridgeSource(sess).Inject(findings)
+	require.NoError(t, err)
+
+	notifications, err := helpers.WaitForNotifications(sess, subscription.QueueURL, findingIDs, 10*time.Minute, 0)
+	require.NoError(t, err)
+
+	for i, c := range cases {
+		c, finding := c, findings[i]
+		t.Run(c.name, func(t *testing.T) {
+			metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, c.status, metadata["enrichment"])
+			assert.Equal(t, c.ip, metadata["remote-ips"])
+			assert.Equal(t, c.reputation, metadata["reputation"])
+
+			enrichment, err := helpers.ReadEvidenceEnrichment(sess, evidenceBucket, finding.ID)
+			require.NoError(t, err)
+			ip := enrichment.IP(c.ip)
+			require.NotNil(t, ip, "evidence has no enrichment for %s", c.ip)
+			// GuardDuty's own GeoIP and ASN details survive a failed lookup
+			assert.Equal(t, "Exampleland", ip.Country)
+			assert.Equal(t, "64496", ip.ASN)
+			assert.Equal(t, "Example Networks", ip.ASNOrg)
+			assert.Equal(t, c.reputation, ip.Reputation)
+			if c.status == "degraded" {
+				require.Len(t, enrichment.Errors, 1)
+				assert.Equal(t, c.ip, enrichment.Errors[0].IP)
+			} else {
+				assert.Empty(t, enrichment.Errors)
+			}
+
+			notification := notifications[finding.ID]
+			require.NotNil(t, notification.Enrichment, "notification is not enriched")
+			assert.Equal(t, c.status, notification.Enrichment.Status)
+			assert.Equal(t, c.reputation, notification.Enrichment.Reputation)
+
+			// Enrichment never holds up containment
+			_, err = helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+			assert.NoError(t, err)
+		})
+	}
+}
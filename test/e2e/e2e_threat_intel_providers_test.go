@@ -0,0 +1,190 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/intelmock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestThreatIntelProviders points the stack at a mock speaking the VirusTotal and AlienVault OTX
+// APIs, one after the other, with the API key in an integration secret. Each provider must be
+// asked with the key and have its answer read into a reputation; a 429 must be retried once after
+// its Retry-After, and only if that fits the lookup timeout; a lasting rate limit must stop the
+// remaining lookups of the finding; and timeouts and negative lookups must leave the finding
+// triaged without a reputation.
+func TestThreatIntelProviders(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "intelapi")
+	sess, ns := suite.Session, suite.Namespace
+
+	// Each provider asks about its own addresses, so their request counts stay apart
+	providers := []struct {
+		name   string
+		prefix string
+	}{
+		{"virustotal", "198.51.100"},
+		{"otx", "192.0.2"},
+	}
+
+	const lookupTimeout = 2
+	apiKey := random.UniqueId() + random.UniqueId()
+	verdicts := map[string]intelmock.Verdict{}
+	for _, p := range providers {
+		verdicts[p.prefix+".10"] = intelmock.Verdict{Reputation: "malicious", Score: 12, Country: "Exampleland", ASN: "64496", ASNOrg: "Example Networks"}
+		verdicts[p.prefix+".20"] = intelmock.Verdict{Reputation: "suspicious", RateLimited: 1, RetryAfter: 1}
+		verdicts[p.prefix+".30"] = intelmock.Verdict{Reputation: "malicious", RateLimited: 100, RetryAfter: 1}
+		verdicts[p.prefix+".40"] = intelmock.Verdict{Reputation: "malicious", RateLimited: 1, RetryAfter: 30 * lookupTimeout}
+		verdicts[p.prefix+".50"] = intelmock.Verdict{Reputation: "malicious", DelaySeconds: 3 * lookupTimeout}
+		verdicts[p.prefix+".61"] = intelmock.Verdict{Reputation: "malicious", RateLimited: 100, RetryAfter: 1}
+		verdicts[p.prefix+".62"] = intelmock.Verdict{Reputation: "malicious"}
+	}
+	mock, err := intelmock.Deploy(sess, ns.Name("intel-mock"), apiKey, verdicts)
+	defer func() {
+		assert.NoError(t, mock.Delete(sess))
+	}()
+	require.NoError(t, err)
+
+	terraformOptions := suite.StackOptions(map[string]interface{}{
+		"threat_intel_endpoint":        mock.URL,
+		"threat_intel_timeout_seconds": lookupTimeout,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	// The API keys are encrypted with the stack's key, so they only exist after the first apply
+	kmsKeyARN := terraform.Output(t, terraformOptions, "s3_evidence_kms_key_arn")
+	secretARNs := map[string]string{}
+	for _, p := range providers {
+		arn, err := helpers.CreateTestSecret(sess, ns.Name(p.name+"-api-key"), apiKey, kmsKeyARN, "")
+		if arn != "" {
+			defer func() {
+				assert.NoError(t, helpers.DeleteTestSecret(sess, arn))
+			}()
+		}
+		require.NoError(t, err)
+		secretARNs[p.name] = arn
+	}
+	terraformOptions.Vars["integration_secret_arns"] = secretARNs
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+	stateMachineArn := terraform.Output(t, terraformOptions, "stepfn_ir_state_machine_arn")
+	topicArn := terraform.Output(t, terraformOptions, "sns_topic_arn")
+
+	subscription, err := helpers.SubscribeTestQueue(sess, topicArn, ns.Name("intelapi"), "")
+	if subscription != nil {
+		defer func() {
+			assert.NoError(t, subscription.Delete(sess))
+		}()
+	}
+	require.NoError(t, err)
+
+	bucket := victims.TestBucket(t, sess, ns.RunID)
+
+	cases := []struct {
+		name       string
+		hosts      []string
+		status     string
+		reputation string
+		// requests is how often the mock must have been asked about each host
+		requests []int
+		// failed are the hosts whose lookup must be on record as failed, with what the error says
+		failed map[string]string
+	}{
+		{"KnownMalicious", []string{"10"}, "enriched", "malicious", []int{1}, nil},
+		{"RateLimitedThenAnswered", []string{"20"}, "enriched", "suspicious", []int{2}, nil},
+		{"RateLimitExhausted", []string{"30"}, "degraded", "", []int{2}, map[string]string{"30": "rate limited"}},
+		{"RetryAfterPastTimeout", []string{"40"}, "degraded", "", []int{1}, map[string]string{"40": "rate limited"}},
+		{"EndpointTimeout", []string{"50"}, "degraded", "", []int{1}, map[string]string{"50": "timed out"}},
+		{"NegativeLookup", []string{"70"}, "enriched", "unknown", []int{1}, nil},
+		{"RateLimitStopsLookups", []string{"61", "62"}, "degraded", "", []int{2, 0}, map[string]string{"61": "rate limited", "62": "not looked up"}},
+	}
+
+	for _, p := range providers {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			terraformOptions.Vars["threat_intel_provider"] = p.name
+			terraform.Apply(t, terraformOptions)
+
+			ip := func(host string) string { return p.prefix + "." + host }
+
+			findings := make([]helpers.GuardDutyFinding, len(cases))
+			findingIDs := make([]string, len(cases))
+			for i, c := range cases {
+				findings[i] = victims.Finding(bucket, ns.Name(p.name+"-"+c.name), "Recon:EC2/PortProbeUnprotectedPort", 8.0)
+				ips := make([]string, len(c.hosts))
+				for j, host := range c.hosts {
+					ips[j] = ip(host)
+				}
+				findings[i].Service = helpers.PortProbeService("", "", "", ips...)
+				findingIDs[i] = findings[i].ID
+			}
+			_, err := helpers.NewEventBridgeSource(sess).Inject(findings)
+			require.NoError(t, err)
+
+			notifications, err := helpers.WaitForNotifications(sess, subscription.QueueURL, findingIDs, 10*time.Minute, 0)
+			require.NoError(t, err)
+
+			for i, c := range cases {
+				c, finding := c, findings[i]
+				t.Run(c.name, func(t *testing.T) {
+					metadata, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+					require.NoError(t, err)
+					assert.Equal(t, c.status, metadata["enrichment"])
+					assert.Equal(t, c.reputation, metadata["reputation"])
+
+					enrichment, err := helpers.ReadEvidenceEnrichment(sess, evidenceBucket, finding.ID)
+					require.NoError(t, err)
+					assert.Equal(t, c.status, enrichment.Status)
+					assert.Len(t, enrichment.Errors, len(c.failed))
+					for _, failure := range enrichment.Errors {
+						host := failure.IP[len(p.prefix)+1:]
+						if assert.Contains(t, c.failed, host, "lookup of %s failed: %s", failure.IP, failure.Error) {
+							assert.Contains(t, failure.Error, c.failed[host])
+						}
+					}
+
+					for j, host := range c.hosts {
+						requests, err := mock.Requests(sess, ip(host))
+						require.NoError(t, err)
+						assert.Equal(t, c.requests[j], requests.Total, "requests about %s", ip(host))
+						assert.Equal(t, requests.Total, requests.Keyed, "%s was asked without the API key", p.name)
+					}
+
+					notification := notifications[finding.ID]
+					require.NotNil(t, notification.Enrichment, "notification is not enriched")
+					assert.Equal(t, c.status, notification.Enrichment.Status)
+					assert.Equal(t, c.reputation, notification.Enrichment.Reputation)
+
+					// Rate limits never hold up containment
+					_, err = helpers.WaitForFindingExecution(sess, stateMachineArn, finding.ID, 5*time.Minute)
+					assert.NoError(t, err)
+				})
+			}
+
+			// The provider's answer fills in the GeoIP and ASN details GuardDuty left out
+			t.Run("ProviderDetails", func(t *testing.T) {
+				enrichment, err := helpers.ReadEvidenceEnrichment(sess, evidenceBucket, findings[0].ID)
+				require.NoError(t, err)
+				known := enrichment.IP(ip("10"))
+				require.NotNil(t, known)
+				assert.Equal(t, "malicious", known.Reputation)
+				assert.Equal(t, 12, known.Score)
+				assert.Equal(t, "64496", known.ASN)
+				assert.Equal(t, "Example Networks", known.ASNOrg)
+				assert.Equal(t, "Exampleland", known.Country)
+			})
+		})
+	}
+}
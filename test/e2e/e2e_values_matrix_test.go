@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/matrix"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/namespace"
+)
+
+// valuesMatrixPath is the values matrix of the root stack
+const valuesMatrixPath = "../matrix/stack-values.yaml"
+
+// TestValuesMatrix expands the stack's values matrix and plans every combination, then applies a
+// sample covering every pair of values and checks that a second plan shows no security drift.
+// Each combination runs in its own copy of the root module, so plans and applies do not share
+// state. MATRIX_APPLIES overrides the number of applies and MATRIX_SEED reproduces a run's sample.
+func TestValuesMatrix(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	harness := helpers.NewHarness(t, awsRegion)
+	sess := harness.Session
+
+	values, err := matrix.Load(valuesMatrixPath)
+	require.NoError(t, err)
+	combinations := values.Expand()
+
+	samples, err := values.SamplesFromEnv()
+	require.NoError(t, err)
+	seed, err := matrix.SeedFromEnv()
+	require.NoError(t, err)
+	sample := matrix.Sample(values.Applicable(combinations), samples, seed)
+	t.Logf("planning %d combinations and applying %d with %s=%d", len(combinations), len(sample), matrix.SeedEnv, seed)
+
+	// Plans create nothing, so they share one namespace
+	planNamespace, err := namespace.New("matrix", random.UniqueId())
+	require.NoError(t, err)
+	require.NoError(t, planNamespace.Claim(t.Name()))
+	defer planNamespace.Release()
+
+	t.Run("Plan", func(t *testing.T) {
+		for _, combination := range combinations {
+			combination := combination
+			t.Run(combination.Name(), func(t *testing.T) {
+				t.Parallel()
+
+				terraformOptions := helpers.StackOptions(planNamespace, awsRegion, combination.Vars)
+				terraformOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../../", ".")
+				terraform.InitAndPlan(t, terraformOptions)
+			})
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		for i, combination := range sample {
+			i, combination := i, combination
+			t.Run(combination.Name(), func(t *testing.T) {
+				t.Parallel()
+
+				ns, err := namespace.New("matrix", random.UniqueId())
+				require.NoError(t, err)
+				require.NoError(t, ns.Claim(t.Name()))
+				defer ns.Release()
+				require.NoError(t, ns.CheckCollisions(sess))
+
+				terraformOptions := helpers.StackOptions(ns, awsRegion, combination.Vars)
+				terraformOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../../", ".")
+
+				defer terraform.Destroy(t, terraformOptions)
+				terraform.InitAndApply(t, terraformOptions)
+				t.Logf("applied sample %d of %d: %s", i+1, len(sample), combination.Name())
+
+				// A combination whose settings fight each other shows up as a perpetual diff
+				assert.NoError(t, helpers.AssertNoSecurityDrift(terraformOptions))
+			})
+		}
+	})
+}
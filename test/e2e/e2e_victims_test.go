@@ -0,0 +1,66 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// TestVictimResources injects findings against real victims, so triage acts on resources that exist
+// rather than no-oping on made-up IDs
+func TestVictimResources(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := helpers.TestRegion()
+
+	suite := helpers.NewSuite(t, awsRegion, "victims")
+	sess, ns := suite.Session, suite.Namespace
+	// Fail before the apply when the account cannot take the stack
+	require.NoError(t, suite.AssertAccountBaseline())
+
+	terraformOptions := suite.StackOptions(nil)
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	evidenceBucket := terraform.Output(t, terraformOptions, "s3_evidence_bucket_name")
+
+	set := victims.New(sess, ns.RunID)
+	defer func() {
+		assert.NoError(t, set.Cleanup())
+	}()
+
+	instance, err := set.Instance()
+	require.NoError(t, err)
+	bucket, err := set.Bucket()
+	require.NoError(t, err)
+	key, err := set.AccessKey()
+	require.NoError(t, err)
+
+	instanceFinding := victims.Finding(instance, ns.Name("victim-instance"), "UnauthorizedAccess:EC2/SSHBruteForce", 8.5)
+	bucketFinding := victims.Finding(bucket, ns.Name("victim-bucket"), "Exfiltration:S3/AnomalousBehavior", 8.0)
+	keyFinding := victims.Finding(key, ns.Name("victim-key"), "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS", 8.0)
+
+	_, err = helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{instanceFinding, bucketFinding, keyFinding})
+	require.NoError(t, err)
+
+	t.Run("InstanceTagged", func(t *testing.T) {
+		tagged, err := helpers.WaitForInstanceTag(sess, instance.ID, "GuardDutyFinding", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, instanceFinding.ID, tagged)
+	})
+
+	for _, finding := range []helpers.GuardDutyFinding{bucketFinding, keyFinding} {
+		finding := finding
+		t.Run("EvidenceFor_"+finding.Resource["resourceType"].(string), func(t *testing.T) {
+			_, err := helpers.WaitForEvidenceMetadata(sess, evidenceBucket, finding.ID, 5*time.Minute)
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package helpers
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// accessLogTimeLayout is the timestamp format of S3 server access log records
+const accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogRecord is one S3 server access log entry, reduced to the fields tests match on
+type AccessLogRecord struct {
+	Bucket    string
+	Time      time.Time
+	Requester string
+	Operation string
+	Key       string
+	Status    string
+}
+
+// ParseAccessLogLine parses a server access log line. Fields are space separated, with the time in
+// brackets and the request URI, referrer and user agent in quotes.
+func ParseAccessLogLine(line string) (AccessLogRecord, error) {
+	var fields []string
+	for rest := strings.TrimSpace(line); rest != ""; rest = strings.TrimLeft(rest, " ") {
+		end := " "
+		switch rest[0] {
+		case '[':
+			end, rest = "]", rest[1:]
+		case '"':
+			end, rest = `"`, rest[1:]
+		}
+
+		i := strings.Index(rest, end)
+		if i < 0 {
+			if end != " " {
+				return AccessLogRecord{}, fmt.Errorf("unterminated field in access log line %q", line)
+			}
+			i = len(rest)
+		}
+		fields = append(fields, rest[:i])
+		rest = rest[i:]
+		if end != " " {
+			rest = rest[1:]
+		}
+	}
+
+	if len(fields) < 10 {
+		return AccessLogRecord{}, fmt.Errorf("access log line has %d fields, expected at least 10: %q", len(fields), line)
+	}
+
+	at, err := time.Parse(accessLogTimeLayout, fields[2])
+	if err != nil {
+		return AccessLogRecord{}, fmt.Errorf("failed to parse access log time %q: %w", fields[2], err)
+	}
+
+	return AccessLogRecord{
+		Bucket:    fields[1],
+		Time:      at,
+		Requester: fields[4],
+		Operation: fields[6],
+		Key:       fields[7],
+		Status:    fields[9],
+	}, nil
+}
+
+// BucketAccessLogTarget returns where the bucket's server access logs are delivered
+func BucketAccessLogTarget(sess *session.Session, bucket string) (targetBucket, prefix string, err error) {
+	logging, err := s3.New(sess).GetBucketLogging(&s3.GetBucketLoggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get logging configuration of %s: %w", bucket, err)
+	}
+	if logging.LoggingEnabled == nil {
+		return "", "", fmt.Errorf("server access logging is not enabled on %s", bucket)
+	}
+
+	return aws.StringValue(logging.LoggingEnabled.TargetBucket), aws.StringValue(logging.LoggingEnabled.TargetPrefix), nil
+}
+
+// CloudTrailDataEventsEnabled reports whether any trail in the region records S3 object data events
+// for the bucket, through either basic or advanced event selectors
+func CloudTrailDataEventsEnabled(sess *session.Session, bucket string) (bool, error) {
+	ctClient := cloudtrail.New(sess)
+	s3ARN := SessionPartition(sess).ARN("s3", "", "", "")
+	bucketARN := s3ARN + bucket
+
+	trails, err := ctClient.DescribeTrails(&cloudtrail.DescribeTrailsInput{})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe trails: %w", err)
+	}
+
+	for _, trail := range trails.TrailList {
+		selectors, err := ctClient.GetEventSelectors(&cloudtrail.GetEventSelectorsInput{TrailName: trail.TrailARN})
+		if err != nil {
+			return false, fmt.Errorf("failed to get event selectors of %s: %w", aws.StringValue(trail.Name), err)
+		}
+
+		for _, selector := range selectors.EventSelectors {
+			for _, resource := range selector.DataResources {
+				if aws.StringValue(resource.Type) != "AWS::S3::Object" {
+					continue
+				}
+				for _, value := range aws.StringValueSlice(resource.Values) {
+					if value == strings.TrimSuffix(s3ARN, ":::") || strings.HasPrefix(value, bucketARN+"/") {
+						return true, nil
+					}
+				}
+			}
+		}
+
+		for _, selector := range selectors.AdvancedEventSelectors {
+			if advancedSelectorCoversBucket(selector, bucketARN) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// advancedSelectorCoversBucket checks for a data event selector on S3 objects whose ARN filter, if
+// any, includes the bucket
+func advancedSelectorCoversBucket(selector *cloudtrail.AdvancedEventSelector, bucketARN string) bool {
+	var isData, isS3Object, arnMatches = false, false, true
+	for _, field := range selector.FieldSelectors {
+		switch aws.StringValue(field.Field) {
+		case "eventCategory":
+			isData = contains(aws.StringValueSlice(field.Equals), "Data")
+		case "resources.type":
+			isS3Object = contains(aws.StringValueSlice(field.Equals), "AWS::S3::Object")
+		case "resources.ARN":
+			arnMatches = false
+			for _, prefix := range aws.StringValueSlice(field.StartsWith) {
+				if strings.HasPrefix(bucketARN+"/", prefix) {
+					arnMatches = true
+				}
+			}
+			for _, arn := range aws.StringValueSlice(field.Equals) {
+				if strings.HasPrefix(arn, bucketARN+"/") {
+					arnMatches = true
+				}
+			}
+		}
+	}
+
+	return isData && isS3Object && arnMatches
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertBucketAccessAudited asserts that object access to the bucket is recorded, by server access
+// logging or by CloudTrail data events
+func AssertBucketAccessAudited(sess *session.Session, bucket string) error {
+	if _, _, err := BucketAccessLogTarget(sess, bucket); err == nil {
+		return nil
+	}
+
+	dataEvents, err := CloudTrailDataEventsEnabled(sess, bucket)
+	if err != nil {
+		return err
+	}
+	if !dataEvents {
+		return fmt.Errorf("object access to %s is audited neither by server access logs nor by CloudTrail data events", bucket)
+	}
+
+	return nil
+}
+
+// ReadAccessLogs returns the records for the bucket in log objects delivered under the prefix since a time
+func ReadAccessLogs(sess *session.Session, logBucket, prefix, bucket string, since time.Time) ([]AccessLogRecord, error) {
+	s3Client := s3.New(sess)
+
+	// Log object keys start with the UTC delivery time, so older objects can be skipped by key
+	var keys []string
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:     aws.String(logBucket),
+		Prefix:     aws.String(prefix),
+		StartAfter: aws.String(prefix + since.UTC().Add(-time.Hour).Format("2006-01-02-15-04-05")),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access logs in %s/%s: %w", logBucket, prefix, err)
+	}
+
+	var records []AccessLogRecord
+	for _, key := range keys {
+		object, err := s3Client.GetObject(&s3.GetObjectInput{Bucket: aws.String(logBucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read access log %s: %w", key, err)
+		}
+
+		scanner := bufio.NewScanner(object.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			record, err := ParseAccessLogLine(scanner.Text())
+			if err != nil {
+				object.Body.Close()
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if record.Bucket == bucket && !record.Time.Before(clock.Tolerant(since)) {
+				records = append(records, record)
+			}
+		}
+		object.Body.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read access log %s: %w", key, err)
+		}
+	}
+
+	return records, nil
+}
+
+// WaitForAccessLogRecords waits until the access logs record each expected operation on its key,
+// e.g. {"REST.PUT.OBJECT", "findings/x.json"}. Server access logs are delivered on a best-effort
+// basis, usually within minutes, so the timeout is the tolerance window.
+func WaitForAccessLogRecords(sess *session.Session, logBucket, prefix, bucket string, expected []AccessLogRecord, since time.Time, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+
+	for {
+		records, err := ReadAccessLogs(sess, logBucket, prefix, bucket, since)
+		if err != nil {
+			return err
+		}
+
+		seen := map[string]bool{}
+		for _, record := range records {
+			seen[record.Operation+" "+record.Key] = true
+		}
+
+		var missing []string
+		for _, want := range expected {
+			if !seen[want.Operation+" "+want.Key] {
+				missing = append(missing, want.Operation+" "+want.Key)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		if clock.Default.Now().After(deadline) {
+			sort.Strings(missing)
+			return fmt.Errorf("access logs for %s did not record %s within %s", bucket, strings.Join(missing, ", "), timeout)
+		}
+		clock.Default.Sleep(time.Minute)
+	}
+}
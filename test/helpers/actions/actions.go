@@ -0,0 +1,243 @@
+// Package actions declares which response actions the pipeline takes for which findings, as a
+// matrix loaded from YAML, and verifies that a finding got exactly those actions. A rule maps a
+// finding type pattern, resource type and severity labels to the actions expected; any action the
+// pipeline took beyond them fails verification as much as a missing one, so a change to routing
+// has to be reflected in the matrix.
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// Action is a response action the pipeline takes for a finding
+type Action string
+
+// Actions a rule can expect, in pipeline order
+const (
+	// Store is the finding's evidence being stored in the evidence bucket
+	Store Action = "store"
+	// Isolate is a containment branch of the workflow running for at least one of the finding's
+	// resources, whether or not containing it succeeded
+	Isolate Action = "isolate"
+	// Snapshot is triage snapshotting the finding's ECS task into its evidence
+	Snapshot Action = "snapshot"
+	// Notify is a notification about the finding being delivered to a test subscription
+	Notify Action = "notify"
+	// UpdateHub is the workflow resolving the finding in Security Hub
+	UpdateHub Action = "update-hub"
+	// Ticket is a ticket being opened for the finding. The stack opens none, so no observer
+	// exists and a rule expecting it cannot be verified.
+	Ticket Action = "ticket"
+)
+
+// All is every action, in pipeline order
+var All = []Action{Store, Isolate, Snapshot, Notify, UpdateHub, Ticket}
+
+// Known reports whether the action is one of All
+func (a Action) Known() bool {
+	for _, known := range All {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Matrix is the ordered rules deciding which actions a finding gets. The first rule a finding
+// matches applies.
+type Matrix struct {
+	Rules []Rule `yaml:"rules"`
+
+	// Path is the file the matrix was loaded from
+	Path string `yaml:"-"`
+}
+
+// Rule expects actions for the findings it matches. Keys left empty match every finding.
+type Rule struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// FindingType is a path.Match pattern on the finding type, e.g. "UnauthorizedAccess:EC2/*"
+	FindingType string `yaml:"finding_type"`
+	// ResourceType is the resourceType of the finding's resource block, e.g. "Instance"
+	ResourceType string `yaml:"resource_type"`
+	// Severity lists the labels the rule matches, e.g. [HIGH, CRITICAL]
+	Severity []string `yaml:"severity"`
+	// Expect is exactly the actions the findings get; empty for none
+	Expect []Action `yaml:"expect"`
+}
+
+// Load reads and validates a matrix file
+func Load(path string) (*Matrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read actions matrix: %w", err)
+	}
+
+	var m Matrix
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse actions matrix %s: %w", path, err)
+	}
+	m.Path = path
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("actions matrix %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that every rule has a unique name, valid patterns and labels, and expects only
+// known actions, each once
+func (m *Matrix) Validate() error {
+	if len(m.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+
+	names := map[string]bool{}
+	for i, rule := range m.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %s is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if _, err := path.Match(rule.FindingType, ""); err != nil {
+			return fmt.Errorf("rule %s: invalid finding_type pattern %q: %w", rule.Name, rule.FindingType, err)
+		}
+		for _, label := range rule.Severity {
+			if _, err := severity.ParseLabel(label); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+
+		expected := map[Action]bool{}
+		for _, action := range rule.Expect {
+			if !action.Known() {
+				return fmt.Errorf("rule %s expects unknown action %q, expected one of %s", rule.Name, action, Join(All))
+			}
+			if expected[action] {
+				return fmt.Errorf("rule %s expects %s more than once", rule.Name, action)
+			}
+			expected[action] = true
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to the finding
+func (r Rule) Matches(finding helpers.GuardDutyFinding) bool {
+	if r.FindingType != "" {
+		if matched, _ := path.Match(r.FindingType, finding.Type); !matched {
+			return false
+		}
+	}
+	if r.ResourceType != "" && r.ResourceType != resourceType(finding) {
+		return false
+	}
+	if len(r.Severity) > 0 {
+		label := severity.FromGuardDuty(finding.Severity).Label()
+		matched := false
+		for _, name := range r.Severity {
+			if parsed, err := severity.ParseLabel(name); err == nil && parsed == label {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Rule returns the first rule matching the finding. A finding no rule matches is an error rather
+// than expecting nothing, so a new kind of finding has to be added to the matrix.
+func (m *Matrix) Rule(finding helpers.GuardDutyFinding) (Rule, error) {
+	for _, rule := range m.Rules {
+		if rule.Matches(finding) {
+			return rule, nil
+		}
+	}
+	return Rule{}, fmt.Errorf("no rule of %s matches finding %s (%s on %s, severity %s)", m.Path, finding.ID,
+		finding.Type, resourceType(finding), severity.FromGuardDuty(finding.Severity).Label())
+}
+
+// Expected returns the actions the finding must get
+func (m *Matrix) Expected(finding helpers.GuardDutyFinding) ([]Action, error) {
+	rule, err := m.Rule(finding)
+	if err != nil {
+		return nil, err
+	}
+	return Sorted(rule.Expect), nil
+}
+
+// Verify checks that the observed actions are exactly the expected ones, naming the missing and
+// the unexpected
+func Verify(expected, observed []Action) error {
+	want, got := map[Action]bool{}, map[Action]bool{}
+	for _, action := range expected {
+		want[action] = true
+	}
+	for _, action := range observed {
+		got[action] = true
+	}
+
+	var missing, unexpected []Action
+	for _, action := range All {
+		switch {
+		case want[action] && !got[action]:
+			missing = append(missing, action)
+		case got[action] && !want[action]:
+			unexpected = append(unexpected, action)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return nil
+	}
+
+	var problems []string
+	if len(unexpected) > 0 {
+		problems = append(problems, "unexpected: "+Join(unexpected))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, "missing: "+Join(missing))
+	}
+	return fmt.Errorf("actions [%s], expected [%s] (%s)", Join(Sorted(observed)), Join(Sorted(expected)), strings.Join(problems, "; "))
+}
+
+// Sorted returns the actions in pipeline order
+func Sorted(actions []Action) []Action {
+	order := map[Action]int{}
+	for i, action := range All {
+		order[action] = i
+	}
+	sorted := append([]Action{}, actions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return order[sorted[i]] < order[sorted[j]] })
+	return sorted
+}
+
+// Join renders actions separated by commas
+func Join(actions []Action) string {
+	names := make([]string, 0, len(actions))
+	for _, action := range actions {
+		names = append(names, string(action))
+	}
+	return strings.Join(names, ", ")
+}
+
+// resourceType returns the resourceType of the finding's resource block
+func resourceType(finding helpers.GuardDutyFinding) string {
+	resourceType, _ := finding.Resource["resourceType"].(string)
+	return resourceType
+}
@@ -0,0 +1,166 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// Target is the deployment actions are observed on
+type Target struct {
+	Session         *session.Session
+	EvidenceBucket  string
+	StateMachineArn string
+	// Notifications are those received on the test subscriptions, keyed by finding ID, as
+	// helpers.WaitForNotifications returns them. Wait with a settle period so notifications that
+	// should not arrive get the chance to.
+	Notifications map[string]helpers.Notification
+}
+
+// States of the IR workflow the observers read from the execution history
+const (
+	isolateState            = "IsolateResource"
+	resolveSecurityHubState = "ResolveSecurityHubFinding"
+)
+
+// Observe returns the actions the pipeline took for the finding, in pipeline order. Ticket is
+// never observed: the stack opens no tickets.
+func Observe(target Target, findingID string) ([]Action, error) {
+	observed := map[Action]bool{}
+
+	metadata, err := evidenceMetadata(target, findingID)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		observed[Store] = true
+		// Triage records the snapshotted task on the evidence
+		observed[Snapshot] = metadata["ecs-task"] != ""
+	}
+
+	histories, err := executionHistories(target, findingID)
+	if err != nil {
+		return nil, err
+	}
+	for _, history := range histories {
+		isolated, err := routedToContainment(history)
+		if err != nil {
+			return nil, err
+		}
+		observed[Isolate] = observed[Isolate] || isolated
+		observed[UpdateHub] = observed[UpdateHub] || enteredState(history, resolveSecurityHubState)
+	}
+
+	_, observed[Notify] = target.Notifications[findingID]
+
+	var actions []Action
+	for _, action := range All {
+		if observed[action] {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// evidenceMetadata returns the metadata of the finding's evidence object, lower-cased, or nil when
+// none was stored
+func evidenceMetadata(target Target, findingID string) (map[string]string, error) {
+	key := helpers.EvidenceKey(findingID, "")
+	object, err := s3.New(target.Session).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(target.EvidenceBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == 404 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to head evidence %s: %w", key, err)
+	}
+
+	metadata := map[string]string{}
+	for name, value := range object.Metadata {
+		metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	return metadata, nil
+}
+
+// executionHistories returns the history of every IR execution triage started for the finding
+func executionHistories(target Target, findingID string) ([]*sfn.GetExecutionHistoryOutput, error) {
+	listed, err := helpers.ListExecutions(target.Session, target.StateMachineArn, "", helpers.PageOptions{MaxPages: 20})
+	if err != nil {
+		return nil, err
+	}
+
+	sfnClient := sfn.New(target.Session)
+	prefix := helpers.TriageExecutionPrefix(findingID)
+	var histories []*sfn.GetExecutionHistoryOutput
+	for _, execution := range listed {
+		name := aws.StringValue(execution.Name)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: execution.ExecutionArn})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe execution %s: %w", name, err)
+		}
+		input, err := helpers.ParseExecutionInput(aws.StringValue(described.Input))
+		if err != nil || input.Detail.ID != findingID {
+			// A truncated prefix can match another finding's executions
+			continue
+		}
+
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, aws.StringValue(execution.ExecutionArn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the history of %s: %w", name, err)
+		}
+		histories = append(histories, history)
+	}
+	return histories, nil
+}
+
+// routedToContainment reports whether a containment branch of the execution's IsolateResource Map
+// ran for at least one target, rather than every target only being recorded or left to responders.
+// It reads the Map's own output, so executions that failed afterwards, e.g. with
+// helpers.PartialFailureError, are observed too.
+func routedToContainment(history *sfn.GetExecutionHistoryOutput) (bool, error) {
+	for _, event := range history.Events {
+		details := event.StateExitedEventDetails
+		if details == nil || aws.StringValue(details.Name) != isolateState {
+			continue
+		}
+
+		var state struct {
+			Containment *helpers.Containment `json:"containment"`
+		}
+		if err := json.Unmarshal([]byte(aws.StringValue(details.Output)), &state); err != nil {
+			return false, fmt.Errorf("unexpected %s output: %w", isolateState, err)
+		}
+		if state.Containment == nil {
+			continue
+		}
+		for _, result := range state.Containment.Targets {
+			if result.Status != helpers.ContainmentNotifyOnly && result.Status != helpers.ContainmentRecorded {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// enteredState reports whether the execution entered the state
+func enteredState(history *sfn.GetExecutionHistoryOutput, state string) bool {
+	for _, event := range history.Events {
+		if details := event.StateEnteredEventDetails; details != nil && aws.StringValue(details.Name) == state {
+			return true
+		}
+	}
+	return false
+}
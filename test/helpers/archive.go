@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// GuardDutyDetectorID returns the ID of the region's GuardDuty detector
+func GuardDutyDetectorID(sess *session.Session) (string, error) {
+	detectors, err := guardduty.New(sess).ListDetectors(&guardduty.ListDetectorsInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return "", fmt.Errorf("no GuardDuty detector in this region")
+	}
+	return aws.StringValue(detectors.DetectorIds[0]), nil
+}
+
+// GetGuardDutyFinding returns a finding as GuardDuty holds it
+func GetGuardDutyFinding(sess *session.Session, detectorID, findingID string) (*guardduty.Finding, error) {
+	output, err := guardduty.New(sess).GetFindings(&guardduty.GetFindingsInput{
+		DetectorId: aws.String(detectorID),
+		FindingIds: []*string{aws.String(findingID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GuardDuty finding %s: %w", findingID, err)
+	}
+	if len(output.Findings) == 0 {
+		return nil, fmt.Errorf("GuardDuty has no finding %s", findingID)
+	}
+	return output.Findings[0], nil
+}
+
+// WaitForGuardDutyArchived polls until GuardDuty reports the finding archived
+func WaitForGuardDutyArchived(sess *session.Session, detectorID, findingID string, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		finding, err := GetGuardDutyFinding(sess, detectorID, findingID)
+		if err != nil {
+			return err
+		}
+		if finding.Service != nil && aws.BoolValue(finding.Service.Archived) {
+			return nil
+		}
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("GuardDuty finding %s was not archived within %s", findingID, timeout)
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+}
+
+// ArchiveGuardDutyFindings archives findings the way an analyst would in the console
+func ArchiveGuardDutyFindings(sess *session.Session, detectorID string, findingIDs ...string) error {
+	if _, err := guardduty.New(sess).ArchiveFindings(&guardduty.ArchiveFindingsInput{
+		DetectorId: aws.String(detectorID),
+		FindingIds: aws.StringSlice(findingIDs),
+	}); err != nil {
+		return fmt.Errorf("failed to archive GuardDuty findings: %w", err)
+	}
+	return nil
+}
+
+// GetSecurityHubFinding returns the Security Hub finding with the ID, or nil while Security Hub has
+// not imported it
+func GetSecurityHubFinding(sess *session.Session, findingID string) (*securityhub.AwsSecurityFinding, error) {
+	output, err := securityhub.New(sess).GetFindings(&securityhub.GetFindingsInput{
+		Filters: &securityhub.AwsSecurityFindingFilters{
+			Id: []*securityhub.StringFilter{{Value: aws.String(findingID), Comparison: aws.String(securityhub.StringFilterComparisonEquals)}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Security Hub finding %s: %w", findingID, err)
+	}
+	if len(output.Findings) == 0 {
+		return nil, nil
+	}
+	return output.Findings[0], nil
+}
+
+// WaitForSecurityHubWorkflowStatus polls until Security Hub has imported the finding and its
+// workflow status is the one given, e.g. securityhub.WorkflowStatusResolved
+func WaitForSecurityHubWorkflowStatus(sess *session.Session, findingID, status string, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+	current := "not imported"
+	for {
+		finding, err := GetSecurityHubFinding(sess, findingID)
+		if err != nil {
+			return err
+		}
+		if finding != nil && finding.Workflow != nil {
+			current = aws.StringValue(finding.Workflow.Status)
+			if current == status {
+				return nil
+			}
+		}
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("Security Hub finding %s is %s after %s, expected %s", findingID, current, timeout, status)
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+}
+
+// SetSecurityHubWorkflowStatus changes a finding's workflow status the way an analyst would in the
+// console
+func SetSecurityHubWorkflowStatus(sess *session.Session, findingID, productARN, status string) error {
+	output, err := securityhub.New(sess).BatchUpdateFindings(&securityhub.BatchUpdateFindingsInput{
+		FindingIdentifiers: []*securityhub.AwsSecurityFindingIdentifier{
+			{Id: aws.String(findingID), ProductArn: aws.String(productARN)},
+		},
+		Workflow: &securityhub.WorkflowUpdate{Status: aws.String(status)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the workflow status of %s: %w", findingID, err)
+	}
+	if len(output.UnprocessedFindings) > 0 {
+		return fmt.Errorf("Security Hub did not update %s: %s", findingID, aws.StringValue(output.UnprocessedFindings[0].ErrorMessage))
+	}
+	return nil
+}
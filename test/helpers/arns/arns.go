@@ -0,0 +1,200 @@
+// Package arns builds, parses and validates the ARNs of the resources the IR pipeline works with.
+// It wraps the SDK's arn package with constructors for state machines, executions, log groups,
+// GuardDuty detectors and findings, so tests neither format ARNs by hand nor check them by
+// searching for substrings such as "execution".
+package arns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// Scope is where a resource lives: its partition, region and account. Region and account are
+// empty for global resources such as IAM roles.
+type Scope struct {
+	Partition string
+	Region    string
+	Account   string
+}
+
+// ScopeOf returns the scope of a parsed ARN
+func ScopeOf(parsed arn.ARN) Scope {
+	return Scope{Partition: parsed.Partition, Region: parsed.Region, Account: parsed.AccountID}
+}
+
+// build returns the ARN of a resource of the service in the scope
+func (s Scope) build(service, region, account, resource string) string {
+	return arn.ARN{Partition: s.Partition, Service: service, Region: region, AccountID: account, Resource: resource}.String()
+}
+
+// StateMachine returns the ARN of a Step Functions state machine
+func (s Scope) StateMachine(name string) string {
+	return s.build("states", s.Region, s.Account, "stateMachine:"+name)
+}
+
+// Execution returns the ARN of an execution of the named state machine
+func (s Scope) Execution(stateMachine, name string) string {
+	return s.build("states", s.Region, s.Account, "execution:"+stateMachine+":"+name)
+}
+
+// LogGroup returns the ARN of a CloudWatch Logs log group, without the ":*" suffix some APIs add
+func (s Scope) LogGroup(name string) string {
+	return s.build("logs", s.Region, s.Account, "log-group:"+name)
+}
+
+// Detector returns the ARN of a GuardDuty detector
+func (s Scope) Detector(detectorID string) string {
+	return s.build("guardduty", s.Region, s.Account, "detector/"+detectorID)
+}
+
+// Finding returns the ARN of a GuardDuty finding of a detector
+func (s Scope) Finding(detectorID, findingID string) string {
+	return s.build("guardduty", s.Region, s.Account, "detector/"+detectorID+"/finding/"+findingID)
+}
+
+// Role returns the ARN of an IAM role. IAM is global, so the scope's region is left out.
+func (s Scope) Role(name string) string {
+	return s.build("iam", "", s.Account, "role/"+name)
+}
+
+// EKSCluster returns the ARN of an EKS cluster
+func (s Scope) EKSCluster(name string) string {
+	return s.build("eks", s.Region, s.Account, "cluster/"+name)
+}
+
+// DefaultProduct returns the ARN of the account's default Security Hub product, the product
+// findings imported by custom integrations belong to
+func (s Scope) DefaultProduct() string {
+	return s.build("securityhub", s.Region, s.Account, fmt.Sprintf("product/%s/default", s.Account))
+}
+
+// ExecutionOf returns the ARN of the named execution of a state machine given by its ARN
+func ExecutionOf(stateMachineARN, name string) (string, error) {
+	parsed, err := Expect(stateMachineARN, StateMachine)
+	if err != nil {
+		return "", err
+	}
+	return ScopeOf(parsed).Execution(Name(parsed), name), nil
+}
+
+// Kind is a kind of resource, identified by its service and the type prefix of its resource
+type Kind struct {
+	Service string
+	// Type is the resource type, e.g. "stateMachine" or "log-group"; empty for resources such as
+	// S3 buckets and SNS topics whose resource is only a name
+	Type string
+}
+
+// Kinds of the resources the pipeline works with. A GuardDuty finding ARN is of the Detector kind,
+// since it names its detector first; ParseFinding tells the two apart.
+var (
+	StateMachine = Kind{Service: "states", Type: "stateMachine"}
+	Execution    = Kind{Service: "states", Type: "execution"}
+	LogGroup     = Kind{Service: "logs", Type: "log-group"}
+	Detector     = Kind{Service: "guardduty", Type: "detector"}
+	Role         = Kind{Service: "iam", Type: "role"}
+	EKSCluster   = Kind{Service: "eks", Type: "cluster"}
+	Topic        = Kind{Service: "sns"}
+	Bucket       = Kind{Service: "s3"}
+)
+
+// String renders the kind as the Resource Groups Tagging API names resource types, e.g.
+// "states:stateMachine" or "sns"
+func (k Kind) String() string {
+	if k.Type == "" {
+		return k.Service
+	}
+	return k.Service + ":" + k.Type
+}
+
+// Parse parses an ARN, naming it in the error
+func Parse(s string) (arn.ARN, error) {
+	parsed, err := arn.Parse(s)
+	if err != nil {
+		return arn.ARN{}, fmt.Errorf("invalid ARN %q: %w", s, err)
+	}
+	return parsed, nil
+}
+
+// KindOf returns the kind of a parsed ARN: its service, and the resource type when the resource
+// has one before a ":" or "/"
+func KindOf(parsed arn.ARN) Kind {
+	kind := Kind{Service: parsed.Service}
+	if i := strings.IndexAny(parsed.Resource, ":/"); i > 0 {
+		kind.Type = parsed.Resource[:i]
+	}
+	return kind
+}
+
+// Name returns the name of the resource without its type prefix and without the ":*" suffix of
+// log group ARNs, e.g. "/aws/lambda/triage" for a log group or "ir-dev:run-1" for an execution
+func Name(parsed arn.ARN) string {
+	name := parsed.Resource
+	if i := strings.IndexAny(name, ":/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ":*")
+}
+
+// Expect parses an ARN and checks that it is of the kind, so a finding or execution ARN passed
+// where a state machine is expected fails with both named
+func Expect(s string, kind Kind) (arn.ARN, error) {
+	parsed, err := Parse(s)
+	if err != nil {
+		return arn.ARN{}, err
+	}
+	if got := KindOf(parsed); got != kind {
+		return arn.ARN{}, fmt.Errorf("ARN %s is a %s, expected a %s", s, got, kind)
+	}
+	if kind.Type != "" && Name(parsed) == "" {
+		return arn.ARN{}, fmt.Errorf("ARN %s has no %s name", s, kind.Type)
+	}
+	return parsed, nil
+}
+
+// Is reports whether s is a valid ARN of the kind
+func Is(s string, kind Kind) bool {
+	_, err := Expect(s, kind)
+	return err == nil
+}
+
+// ParsedExecution is an execution ARN split into its state machine and execution name
+type ParsedExecution struct {
+	// StateMachineARN is the ARN of the state machine the execution ran on
+	StateMachineARN string
+	Name            string
+}
+
+// ParseExecution parses a Step Functions execution ARN
+func ParseExecution(s string) (ParsedExecution, error) {
+	parsed, err := Expect(s, Execution)
+	if err != nil {
+		return ParsedExecution{}, err
+	}
+	parts := strings.SplitN(Name(parsed), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ParsedExecution{}, fmt.Errorf("execution ARN %s does not name a state machine and an execution", s)
+	}
+	return ParsedExecution{StateMachineARN: ScopeOf(parsed).StateMachine(parts[0]), Name: parts[1]}, nil
+}
+
+// ParsedFinding is a GuardDuty finding ARN split into its detector and finding ID
+type ParsedFinding struct {
+	DetectorID string
+	FindingID  string
+}
+
+// ParseFinding parses a GuardDuty finding ARN
+func ParseFinding(s string) (ParsedFinding, error) {
+	parsed, err := Expect(s, Detector)
+	if err != nil {
+		return ParsedFinding{}, err
+	}
+	parts := strings.Split(Name(parsed), "/")
+	if len(parts) != 3 || parts[1] != "finding" || parts[0] == "" || parts[2] == "" {
+		return ParsedFinding{}, fmt.Errorf("ARN %s is not a GuardDuty finding", s)
+	}
+	return ParsedFinding{DetectorID: parts[0], FindingID: parts[2]}, nil
+}
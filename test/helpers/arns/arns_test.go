@@ -0,0 +1,130 @@
+package arns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var partitions = []Scope{
+	{Partition: "aws", Region: "us-east-1", Account: "111122223333"},
+	{Partition: "aws-us-gov", Region: "us-gov-west-1", Account: "111122223333"},
+	{Partition: "aws-cn", Region: "cn-north-1", Account: "111122223333"},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, scope := range partitions {
+		t.Run(scope.Partition, func(t *testing.T) {
+			tests := []struct {
+				arn  string
+				kind Kind
+				name string
+			}{
+				{scope.StateMachine("ir-guardduty-ir"), StateMachine, "ir-guardduty-ir"},
+				{scope.Execution("ir-guardduty-ir", "triage-abc"), Execution, "ir-guardduty-ir:triage-abc"},
+				{scope.LogGroup("/aws/lambda/ir-triage"), LogGroup, "/aws/lambda/ir-triage"},
+				{scope.LogGroup("/aws/lambda/ir-triage") + ":*", LogGroup, "/aws/lambda/ir-triage"},
+				{scope.Detector("12abc"), Detector, "12abc"},
+				{scope.Finding("12abc", "f-1"), Detector, "12abc/finding/f-1"},
+				{scope.Role("ir-triage-role"), Role, "ir-triage-role"},
+				{scope.EKSCluster("payments"), EKSCluster, "payments"},
+			}
+			for _, test := range tests {
+				parsed, err := Expect(test.arn, test.kind)
+				require.NoError(t, err, test.arn)
+				assert.Equal(t, test.arn, parsed.String())
+				assert.Equal(t, test.name, Name(parsed), test.arn)
+				assert.Equal(t, scope.Partition, ScopeOf(parsed).Partition, test.arn)
+				assert.True(t, Is(test.arn, test.kind), test.arn)
+			}
+		})
+	}
+}
+
+func TestScopeFormat(t *testing.T) {
+	scope := partitions[1]
+	assert.Equal(t, "arn:aws-us-gov:states:us-gov-west-1:111122223333:stateMachine:ir", scope.StateMachine("ir"))
+	assert.Equal(t, "arn:aws-us-gov:states:us-gov-west-1:111122223333:execution:ir:run-1", scope.Execution("ir", "run-1"))
+	assert.Equal(t, "arn:aws-us-gov:logs:us-gov-west-1:111122223333:log-group:/aws/lambda/triage", scope.LogGroup("/aws/lambda/triage"))
+	assert.Equal(t, "arn:aws-us-gov:guardduty:us-gov-west-1:111122223333:detector/d1/finding/f1", scope.Finding("d1", "f1"))
+	// IAM is global, so role ARNs have no region
+	assert.Equal(t, "arn:aws-us-gov:iam::111122223333:role/triage", scope.Role("triage"))
+	assert.Equal(t, "arn:aws-us-gov:securityhub:us-gov-west-1:111122223333:product/111122223333/default", scope.DefaultProduct())
+}
+
+func TestExpect(t *testing.T) {
+	scope := partitions[0]
+	tests := []struct {
+		name    string
+		arn     string
+		kind    Kind
+		wantErr string
+	}{
+		{name: "not an ARN", arn: "ir-guardduty-ir", kind: StateMachine, wantErr: `invalid ARN "ir-guardduty-ir"`},
+		{name: "execution for a state machine", arn: scope.Execution("ir", "run"), kind: StateMachine, wantErr: "is a states:execution, expected a states:stateMachine"},
+		{name: "other service", arn: scope.LogGroup("ir"), kind: StateMachine, wantErr: "is a logs:log-group, expected a states:stateMachine"},
+		{name: "no name", arn: "arn:aws:states:us-east-1:111122223333:stateMachine:", kind: StateMachine, wantErr: "has no stateMachine name"},
+		{name: "topic", arn: "arn:aws:sns:us-east-1:111122223333:ir-alerts", kind: Topic},
+		{name: "bucket", arn: "arn:aws:s3:::ir-evidence", kind: Bucket},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Expect(test.arn, test.kind)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+			assert.False(t, Is(test.arn, test.kind))
+		})
+	}
+}
+
+func TestKindString(t *testing.T) {
+	assert.Equal(t, "states:stateMachine", StateMachine.String())
+	assert.Equal(t, "sns", Topic.String())
+}
+
+func TestParseExecution(t *testing.T) {
+	for _, scope := range partitions {
+		execution, err := ParseExecution(scope.Execution("ir-guardduty-ir", "triage-abc"))
+		require.NoError(t, err, scope.Partition)
+		assert.Equal(t, ParsedExecution{StateMachineARN: scope.StateMachine("ir-guardduty-ir"), Name: "triage-abc"}, execution)
+
+		stateMachine, err := ExecutionOf(scope.StateMachine("ir-guardduty-ir"), "triage-abc")
+		require.NoError(t, err, scope.Partition)
+		assert.Equal(t, scope.Execution("ir-guardduty-ir", "triage-abc"), stateMachine)
+	}
+
+	for _, invalid := range []string{
+		"arn:aws:states:us-east-1:111122223333:execution:ir",
+		"arn:aws:states:us-east-1:111122223333:execution::run",
+		"arn:aws:states:us-east-1:111122223333:stateMachine:ir",
+	} {
+		_, err := ParseExecution(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	_, err := ExecutionOf("arn:aws:states:us-east-1:111122223333:execution:ir:run", "again")
+	assert.Error(t, err, "an execution ARN is not a state machine")
+}
+
+func TestParseFinding(t *testing.T) {
+	for _, scope := range partitions {
+		finding, err := ParseFinding(scope.Finding("12abc", "f-1"))
+		require.NoError(t, err, scope.Partition)
+		assert.Equal(t, ParsedFinding{DetectorID: "12abc", FindingID: "f-1"}, finding)
+	}
+
+	for _, invalid := range []string{
+		partitions[0].Detector("12abc"),
+		"arn:aws:guardduty:us-east-1:111122223333:detector/12abc/filter/f-1",
+		"arn:aws:guardduty:us-east-1:111122223333:detector/12abc/finding/",
+		partitions[0].StateMachine("ir"),
+	} {
+		_, err := ParseFinding(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,130 @@
+package asff
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/securityhub"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// SchemaVersion is the only ASFF schema version Security Hub accepts
+const SchemaVersion = "2018-10-08"
+
+// Finding is an AWS Security Finding Format document. Field names match ASFF so a Finding
+// round-trips through JSON unchanged.
+type Finding struct {
+	SchemaVersion     string            `json:"SchemaVersion"`
+	Id                string            `json:"Id"`
+	ProductArn        string            `json:"ProductArn"`
+	ProductName       string            `json:"ProductName,omitempty"`
+	CompanyName       string            `json:"CompanyName,omitempty"`
+	Region            string            `json:"Region,omitempty"`
+	GeneratorId       string            `json:"GeneratorId"`
+	AwsAccountId      string            `json:"AwsAccountId"`
+	Types             []string          `json:"Types"`
+	FirstObservedAt   string            `json:"FirstObservedAt,omitempty"`
+	LastObservedAt    string            `json:"LastObservedAt,omitempty"`
+	CreatedAt         string            `json:"CreatedAt"`
+	UpdatedAt         string            `json:"UpdatedAt"`
+	Severity          Severity          `json:"Severity"`
+	Confidence        int64             `json:"Confidence,omitempty"`
+	Criticality       int64             `json:"Criticality,omitempty"`
+	Title             string            `json:"Title"`
+	Description       string            `json:"Description"`
+	Remediation       *Remediation      `json:"Remediation,omitempty"`
+	SourceUrl         string            `json:"SourceUrl,omitempty"`
+	ProductFields     map[string]string `json:"ProductFields,omitempty"`
+	UserDefinedFields map[string]string `json:"UserDefinedFields,omitempty"`
+	Resources         []Resource        `json:"Resources"`
+	Compliance        *Compliance       `json:"Compliance,omitempty"`
+	Workflow          *Workflow         `json:"Workflow,omitempty"`
+	RecordState       string            `json:"RecordState,omitempty"`
+}
+
+// Severity carries the label and the 0-100 normalized score; Original is the provider's own value
+type Severity struct {
+	Label      string `json:"Label,omitempty"`
+	Normalized int64  `json:"Normalized,omitempty"`
+	Original   string `json:"Original,omitempty"`
+}
+
+// Resource is a resource implicated by a finding
+type Resource struct {
+	Type      string                 `json:"Type"`
+	Id        string                 `json:"Id"`
+	Partition string                 `json:"Partition,omitempty"`
+	Region    string                 `json:"Region,omitempty"`
+	Tags      map[string]string      `json:"Tags,omitempty"`
+	Details   map[string]interface{} `json:"Details,omitempty"`
+}
+
+// Remediation points responders at a fix
+type Remediation struct {
+	Recommendation *Recommendation `json:"Recommendation,omitempty"`
+}
+
+// Recommendation is free text with an optional link
+type Recommendation struct {
+	Text string `json:"Text,omitempty"`
+	Url  string `json:"Url,omitempty"`
+}
+
+// Compliance is the control status for compliance findings
+type Compliance struct {
+	Status string `json:"Status,omitempty"`
+}
+
+// Workflow is the investigation status
+type Workflow struct {
+	Status string `json:"Status,omitempty"`
+}
+
+// Severity labels in ascending order
+const (
+	SeverityInformational = "INFORMATIONAL"
+	SeverityLow           = "LOW"
+	SeverityMedium        = "MEDIUM"
+	SeverityHigh          = "HIGH"
+	SeverityCritical      = "CRITICAL"
+)
+
+// LabelForNormalized maps a 0-100 normalized score to its Security Hub label
+func LabelForNormalized(normalized int64) string {
+	return severity.FromNormalized(normalized).SecurityHubLabel().String()
+}
+
+// Parse decodes a single ASFF finding
+func Parse(data []byte) (*Finding, error) {
+	var finding Finding
+	if err := json.Unmarshal(data, &finding); err != nil {
+		return nil, fmt.Errorf("failed to parse ASFF finding: %w", err)
+	}
+	return &finding, nil
+}
+
+// ToSDK converts the finding to the Security Hub API type used by BatchImportFindings
+func (f Finding) ToSDK() (*securityhub.AwsSecurityFinding, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var finding securityhub.AwsSecurityFinding
+	if err := json.Unmarshal(data, &finding); err != nil {
+		return nil, fmt.Errorf("failed to convert finding %s to the Security Hub API type: %w", f.Id, err)
+	}
+
+	return &finding, nil
+}
+
+// FromSDK converts a finding returned by the Security Hub API
+func FromSDK(finding *securityhub.AwsSecurityFinding) (*Finding, error) {
+	data, err := json.Marshal(finding)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
@@ -0,0 +1,106 @@
+package asff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	accountPattern = regexp.MustCompile(`^\d{12}$`)
+
+	// typeNamespaces are the allowed first segments of a finding type
+	typeNamespaces = map[string]bool{
+		"Software and Configuration Checks": true,
+		"TTPs":                              true,
+		"Effects":                           true,
+		"Unusual Behaviors":                 true,
+		"Sensitive Data Identifications":    true,
+	}
+)
+
+// Validate checks a finding against the ASFF rules Security Hub enforces on import and
+// returns every violation found
+func (f Finding) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if f.SchemaVersion != SchemaVersion {
+		problem("SchemaVersion must be %s, got %q", SchemaVersion, f.SchemaVersion)
+	}
+	for field, value := range map[string]string{
+		"Id":          f.Id,
+		"ProductArn":  f.ProductArn,
+		"GeneratorId": f.GeneratorId,
+		"Title":       f.Title,
+		"Description": f.Description,
+	} {
+		if value == "" {
+			problem("%s is required", field)
+		}
+	}
+	if !accountPattern.MatchString(f.AwsAccountId) {
+		problem("AwsAccountId must be 12 digits, got %q", f.AwsAccountId)
+	}
+	if len(f.Title) > 256 {
+		problem("Title is %d characters, limit is 256", len(f.Title))
+	}
+	if len(f.Description) > 1024 {
+		problem("Description is %d characters, limit is 1024", len(f.Description))
+	}
+
+	if len(f.Types) == 0 || len(f.Types) > 50 {
+		problem("Types must have 1-50 entries, got %d", len(f.Types))
+	}
+	for _, findingType := range f.Types {
+		namespace, _, _ := strings.Cut(findingType, "/")
+		if !typeNamespaces[namespace] {
+			problem("type %q has unknown namespace %q", findingType, namespace)
+		}
+	}
+
+	for field, value := range map[string]string{
+		"CreatedAt":       f.CreatedAt,
+		"UpdatedAt":       f.UpdatedAt,
+		"FirstObservedAt": f.FirstObservedAt,
+		"LastObservedAt":  f.LastObservedAt,
+	} {
+		if value == "" {
+			if field == "CreatedAt" || field == "UpdatedAt" {
+				problem("%s is required", field)
+			}
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			problem("%s is not RFC 3339: %q", field, value)
+		}
+	}
+
+	if f.Severity.Label == "" && f.Severity.Normalized == 0 {
+		problem("Severity needs a Label or Normalized score")
+	}
+	if f.Severity.Normalized < 0 || f.Severity.Normalized > 100 {
+		problem("Severity.Normalized must be 0-100, got %d", f.Severity.Normalized)
+	}
+	if f.Severity.Label != "" && f.Severity.Normalized != 0 && f.Severity.Label != LabelForNormalized(f.Severity.Normalized) {
+		problem("Severity.Label %s does not match Normalized %d (%s)", f.Severity.Label, f.Severity.Normalized, LabelForNormalized(f.Severity.Normalized))
+	}
+
+	if len(f.Resources) == 0 || len(f.Resources) > 32 {
+		problem("Resources must have 1-32 entries, got %d", len(f.Resources))
+	}
+	for i, resource := range f.Resources {
+		if resource.Type == "" || resource.Id == "" {
+			problem("Resources[%d] needs a Type and Id", i)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid ASFF finding %s: %s", f.Id, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
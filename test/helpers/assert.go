@@ -1,17 +1,24 @@
 package helpers
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sfn"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/arns"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/asff"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/iamdoc"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
 )
 
 // AssertStepFunctionExecutionSuccess asserts that a Step Functions execution completed successfully
@@ -92,8 +99,10 @@ func AssertStepFunctionStateTransitions(sess *session.Session, executionArn stri
 }
 
 // AssertS3EvidenceStructure asserts that evidence objects follow the expected naming convention
-func AssertS3EvidenceStructure(sess *session.Session, bucketName string) error {
-	err := ValidateS3ObjectNaming(sess, bucketName, "findings/")
+func AssertS3EvidenceStructure(sess *session.Session, bucketName string) (err error) {
+	defer tracing.Step(sess, "assert-evidence")(&err)
+
+	err = ValidateS3ObjectNaming(sess, bucketName, "findings/")
 	if err != nil {
 		return fmt.Errorf("evidence structure validation failed: %w", err)
 	}
@@ -101,6 +110,50 @@ func AssertS3EvidenceStructure(sess *session.Session, bucketName string) error {
 	return nil
 }
 
+// AssertEvidenceASFF asserts that the evidence for a Security Hub finding keeps a valid ASFF copy
+// that maps back onto the stored GuardDuty-shaped detail
+func AssertEvidenceASFF(sess *session.Session, bucketName, findingID string) (err error) {
+	defer tracing.Step(sess, "assert-evidence")(&err)
+
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String("findings/" + findingID + ".json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read evidence for %s: %w", findingID, err)
+	}
+	defer object.Body.Close()
+
+	var evidence struct {
+		Detail struct {
+			GuardDutyFinding
+			ASFF json.RawMessage `json:"asff"`
+		} `json:"detail"`
+	}
+	if err := json.NewDecoder(object.Body).Decode(&evidence); err != nil {
+		return fmt.Errorf("failed to parse evidence for %s: %w", findingID, err)
+	}
+	if len(evidence.Detail.ASFF) == 0 {
+		return fmt.Errorf("evidence for %s has no ASFF finding", findingID)
+	}
+
+	finding, err := asff.Parse(evidence.Detail.ASFF)
+	if err != nil {
+		return err
+	}
+	if err := finding.Validate(); err != nil {
+		return err
+	}
+
+	converted := FromASFF(*finding)
+	if converted.ID != evidence.Detail.ID || converted.Type != evidence.Detail.Type || converted.Severity != evidence.Detail.Severity {
+		return fmt.Errorf("evidence detail for %s (%s, %.1f) does not match its ASFF finding (%s, %.1f)",
+			findingID, evidence.Detail.Type, evidence.Detail.Severity, converted.Type, converted.Severity)
+	}
+
+	return nil
+}
+
 // AssertSecurityControlsEnforced asserts that security controls are properly enforced
 func AssertSecurityControlsEnforced(sess *session.Session, bucketName string) error {
 	s3Client := s3.New(sess)
@@ -113,8 +166,11 @@ func AssertSecurityControlsEnforced(sess *session.Session, bucketName string) er
 		return fmt.Errorf("failed to get bucket policy: %w", err)
 	}
 
-	policyStr := *bucketPolicy.Policy
-	if !strings.Contains(policyStr, "aws:SecureTransport") {
+	policy, err := iamdoc.Parse(aws.StringValue(bucketPolicy.Policy))
+	if err != nil {
+		return fmt.Errorf("failed to parse bucket policy: %w", err)
+	}
+	if !policy.ConditionRequires("aws:SecureTransport") {
 		return fmt.Errorf("bucket policy does not enforce secure transport")
 	}
 
@@ -153,6 +209,10 @@ func AssertPerformanceWithinBudget(sess *session.Session, executionArn string, m
 
 	duration := execution.StopDate.Sub(*execution.StartDate)
 	if duration > maxDuration {
+		// Name the states that regressed so the failure points at a step, not just the total
+		if _, stateErr := AssertStateBudgets(sess, executionArn, DefaultStateBudgets); stateErr != nil {
+			return fmt.Errorf("execution took %v, exceeding budget of %v: %w", duration, maxDuration, stateErr)
+		}
 		return fmt.Errorf("execution took %v, exceeding budget of %v", duration, maxDuration)
 	}
 
@@ -163,9 +223,9 @@ func AssertPerformanceWithinBudget(sess *session.Session, executionArn string, m
 func AssertCloudWatchAlarmsTriggered(sess *session.Session, alarmNames []string, timeout time.Duration) error {
 	cloudwatchClient := cloudwatch.New(sess)
 
-	deadline := time.Now().Add(timeout)
+	deadline := clock.Default.Now().Add(timeout)
 
-	for time.Now().Before(deadline) {
+	for clock.Default.Now().Before(deadline) {
 		for _, alarmName := range alarmNames {
 			alarm, err := cloudwatchClient.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
 				AlarmNames: []*string{aws.String(alarmName)},
@@ -182,23 +242,94 @@ func AssertCloudWatchAlarmsTriggered(sess *session.Session, alarmNames []string,
 			}
 		}
 
-		time.Sleep(5 * time.Second)
+		clock.Default.Sleep(5 * time.Second)
 	}
 
 	return fmt.Errorf("no CloudWatch alarms were triggered within timeout")
 }
 
-// AssertResourceTagging asserts that resources have proper tags
-func AssertResourceTagging(sess *session.Session, resourceType, resourceIdentifier string, requiredTags map[string]string) error {
-	// This is a generic function that could be extended for different resource types
-	// For now, it's a placeholder for the tagging validation logic
+// MandatoryTags are the tags every resource the stack creates must carry
+var MandatoryTags = []string{"Project", "Environment", "Owner", "DataClassification"}
+
+// RequiredStackResourceTypes are the resource types the default stack always creates, as
+// ResourceType names them. A type missing from the audit means its resources lost the TestID tag
+// altogether, which checking the tags of the resources that have it would not show.
+var RequiredStackResourceTypes = []string{
+	"events:rule",
+	"kms:key",
+	"lambda:function",
+	"logs:log-group",
+	"s3",
+	"sns",
+	"sqs",
+	"states:stateMachine",
+}
 
-	for key, expectedValue := range requiredTags {
-		if expectedValue == "" {
-			return fmt.Errorf("required tag '%s' is empty", key)
+// ResourceType returns the type of a resource as the Resource Groups Tagging API filters on it:
+// the service, then the resource type when the ARN has one, e.g. "lambda:function" or "sqs"
+func ResourceType(resourceARN string) string {
+	parsed, err := arns.Parse(resourceARN)
+	if err != nil {
+		return resourceARN
+	}
+	return arns.KindOf(parsed).String()
+}
+
+// AssertResourceTagging finds every resource tagged with the run's TestID through the Resource
+// Groups Tagging API and checks that each carries the mandatory tags with the values in
+// requiredTags, and that every expected resource type was found. IAM resources are not covered by
+// the API and are not audited.
+func AssertResourceTagging(sess *session.Session, testID string, requiredTags map[string]string, expectedTypes []string) error {
+	for _, key := range MandatoryTags {
+		if requiredTags[key] == "" {
+			return fmt.Errorf("no expected value for mandatory tag %s", key)
 		}
 	}
 
+	var resources []*resourcegroupstaggingapi.ResourceTagMapping
+	err := resourcegroupstaggingapi.New(sess).GetResourcesPages(&resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{
+			{Key: aws.String(TestResourceTag), Values: []*string{aws.String(testID)}},
+		},
+	}, func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
+		resources = append(resources, page.ResourceTagMappingList...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list resources tagged %s=%s: %w", TestResourceTag, testID, err)
+	}
+
+	var problems []string
+	found := map[string]bool{}
+	for _, resource := range resources {
+		resourceARN := aws.StringValue(resource.ResourceARN)
+		found[ResourceType(resourceARN)] = true
+
+		tags := map[string]string{}
+		for _, tag := range resource.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		for key := range requiredTags {
+			value, ok := tags[key]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s: missing tag %s", resourceARN, key))
+			case value != requiredTags[key]:
+				problems = append(problems, fmt.Sprintf("%s: tag %s is %q, expected %q", resourceARN, key, value, requiredTags[key]))
+			}
+		}
+	}
+
+	for _, resourceType := range expectedTypes {
+		if !found[resourceType] {
+			problems = append(problems, fmt.Sprintf("no %s resource is tagged %s=%s", resourceType, TestResourceTag, testID))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("resources tagged %s=%s fail the tagging policy:\n  %s", TestResourceTag, testID, strings.Join(problems, "\n  "))
+	}
 	return nil
 }
 
@@ -0,0 +1,226 @@
+// Package athena queries evidence with Athena. Open creates a temporary workgroup, database and table
+// over the evidence bucket's findings/ prefix, so responders and tests can ask which findings match a
+// severity, time range or resource without downloading every object; Close removes them again.
+package athena
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsathena "github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// QueryTimeout bounds a single query, including the DDL run by Open and Close
+var QueryTimeout = 5 * time.Minute
+
+var unsafeName = regexp.MustCompile(`[^a-z0-9_]`)
+
+// Evidence is a temporary Athena view of an evidence bucket
+type Evidence struct {
+	Workgroup string
+	Database  string
+	Table     string
+
+	client *awsathena.Athena
+}
+
+// Open creates the workgroup and table for an evidence bucket. The suffix keeps concurrent users
+// apart, e.g. a test's run ID. Query results are written to athena-results/ in the same bucket with
+// its KMS key, since the bucket only accepts KMS-encrypted objects.
+func Open(sess *session.Session, evidenceBucket, suffix string) (*Evidence, error) {
+	suffix = unsafeName.ReplaceAllString(strings.ToLower(suffix), "_")
+	e := &Evidence{
+		Workgroup: "ir-evidence-" + strings.ReplaceAll(suffix, "_", "-"),
+		Database:  "ir_evidence_" + suffix,
+		Table:     "findings",
+		client:    awsathena.New(sess),
+	}
+
+	keyARN, err := bucketKMSKey(sess, evidenceBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = e.client.CreateWorkGroup(&awsathena.CreateWorkGroupInput{
+		Name:        aws.String(e.Workgroup),
+		Description: aws.String("Temporary workgroup for querying evidence in " + evidenceBucket),
+		Configuration: &awsathena.WorkGroupConfiguration{
+			EnforceWorkGroupConfiguration: aws.Bool(true),
+			ResultConfiguration: &awsathena.ResultConfiguration{
+				OutputLocation: aws.String(fmt.Sprintf("s3://%s/athena-results/%s/", evidenceBucket, suffix)),
+				EncryptionConfiguration: &awsathena.EncryptionConfiguration{
+					EncryptionOption: aws.String(awsathena.EncryptionOptionSseKms),
+					KmsKey:           aws.String(keyARN),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workgroup %s: %w", e.Workgroup, err)
+	}
+
+	ddl := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", e.Database),
+		fmt.Sprintf(createTable, e.Database, e.Table, evidenceBucket),
+	}
+	for _, statement := range ddl {
+		if _, err := e.Query(statement); err != nil {
+			return nil, errorsWithClose(err, e.Close())
+		}
+	}
+
+	return e, nil
+}
+
+// createTable maps the EventBridge events triage stores as evidence. Only the GuardDuty fields the
+// queries need are declared; the JSON SerDe ignores the rest.
+const createTable = `CREATE EXTERNAL TABLE IF NOT EXISTS %s.%s (
+  id string,
+  account string,
+  region string,
+  time string,
+  detail struct<
+    id:string,
+    arn:string,
+    type:string,
+    severity:double,
+    title:string,
+    resource:struct<
+      resourcetype:string,
+      instancedetails:struct<instanceid:string>,
+      accesskeydetails:struct<accesskeyid:string,username:string>
+    >
+  >
+)
+ROW FORMAT SERDE 'org.openx.data.jsonserde.JsonSerDe'
+WITH SERDEPROPERTIES ('ignore.malformed.json' = 'true')
+LOCATION 's3://%s/findings/'`
+
+// Close drops the table and database and deletes the workgroup with its query history
+func (e *Evidence) Close() error {
+	var problems []string
+
+	if _, err := e.Query(fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", e.Database)); err != nil {
+		problems = append(problems, err.Error())
+	}
+	_, err := e.client.DeleteWorkGroup(&awsathena.DeleteWorkGroupInput{
+		WorkGroup:             aws.String(e.Workgroup),
+		RecursiveDeleteOption: aws.Bool(true),
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to delete workgroup %s: %v", e.Workgroup, err))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("failed to close evidence view %s:\n  %s", e.Workgroup, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Query runs a statement in the workgroup and returns its data rows. Each parameter replaces a ?
+// in order and must be a SQL literal; String and Timestamp quote values for that.
+func (e *Evidence) Query(query string, params ...string) ([][]string, error) {
+	return Run(e.client, e.Workgroup, query, params, clock.Default.Now().Add(QueryTimeout))
+}
+
+// Run starts a query in a workgroup and waits until the deadline for its data rows, without the
+// header row
+func Run(client *awsathena.Athena, workgroup, query string, params []string, deadline time.Time) ([][]string, error) {
+	input := &awsathena.StartQueryExecutionInput{
+		QueryString: aws.String(query),
+		WorkGroup:   aws.String(workgroup),
+	}
+	if len(params) > 0 {
+		input.ExecutionParameters = aws.StringSlice(params)
+	}
+	started, err := client.StartQueryExecution(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start query in %s: %w", workgroup, err)
+	}
+	queryID := aws.StringValue(started.QueryExecutionId)
+
+	for {
+		execution, err := client.GetQueryExecution(&awsathena.GetQueryExecutionInput{QueryExecutionId: aws.String(queryID)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query %s: %w", queryID, err)
+		}
+
+		status := execution.QueryExecution.Status
+		switch aws.StringValue(status.State) {
+		case awsathena.QueryExecutionStateSucceeded:
+			return results(client, queryID, aws.StringValue(execution.QueryExecution.StatementType))
+
+		case awsathena.QueryExecutionStateFailed, awsathena.QueryExecutionStateCancelled:
+			return nil, fmt.Errorf("query %s %s: %s", queryID, strings.ToLower(aws.StringValue(status.State)), aws.StringValue(status.StateChangeReason))
+		}
+
+		if clock.Default.Now().After(deadline) {
+			return nil, fmt.Errorf("query %s did not finish in time", queryID)
+		}
+		clock.Default.Sleep(2 * time.Second)
+	}
+}
+
+// results reads every page of a finished query's results
+func results(client *awsathena.Athena, queryID, statementType string) ([][]string, error) {
+	var rows [][]string
+	err := client.GetQueryResultsPages(&awsathena.GetQueryResultsInput{QueryExecutionId: aws.String(queryID)},
+		func(page *awsathena.GetQueryResultsOutput, lastPage bool) bool {
+			for _, row := range page.ResultSet.Rows {
+				var values []string
+				for _, datum := range row.Data {
+					values = append(values, aws.StringValue(datum.VarCharValue))
+				}
+				rows = append(rows, values)
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get results of query %s: %w", queryID, err)
+	}
+
+	// Only query results start with a header; DDL results do not
+	if statementType == awsathena.StatementTypeDml && len(rows) > 0 {
+		rows = rows[1:]
+	}
+	return rows, nil
+}
+
+// String quotes a value as a SQL string literal for a query parameter
+func String(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Timestamp formats a time as a SQL timestamp literal for a query parameter
+func Timestamp(t time.Time) string {
+	return "TIMESTAMP '" + t.UTC().Format("2006-01-02 15:04:05.000") + "'"
+}
+
+// bucketKMSKey returns the KMS key a bucket encrypts new objects with
+func bucketKMSKey(sess *session.Session, bucket string) (string, error) {
+	encryption, err := s3.New(sess).GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get encryption of %s: %w", bucket, err)
+	}
+	for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault != nil && aws.StringValue(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID) != "" {
+			return aws.StringValue(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no default KMS key", bucket)
+}
+
+// errorsWithClose adds a failed cleanup to the error that caused it
+func errorsWithClose(err, closeErr error) error {
+	if closeErr != nil {
+		return fmt.Errorf("%w (cleanup also failed: %v)", err, closeErr)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package athena
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// Finding is an evidence object as the findings queries return it
+type Finding struct {
+	ID           string
+	Type         string
+	Severity     float64
+	Account      string
+	Region       string
+	Time         time.Time
+	ResourceType string
+	// ResourceID is the instance ID or access key ID, whichever the finding names
+	ResourceID string
+	// Key is the evidence object the finding was read from
+	Key string
+}
+
+// findingColumns is the select list parseFinding reads, in order
+const findingColumns = `detail.id, detail.type, detail.severity, account, region, time, detail.resource.resourcetype,
+  coalesce(detail.resource.instancedetails.instanceid, detail.resource.accesskeydetails.accesskeyid, ''), "$path"`
+
+// FindingsBySeverity returns the findings at or above a GuardDuty severity, most severe first
+func (e *Evidence) FindingsBySeverity(minSeverity severity.Score) ([]Finding, error) {
+	return e.findings("detail.severity >= ?", "detail.severity DESC", strconv.FormatFloat(minSeverity.Float(), 'f', -1, 64))
+}
+
+// FindingsBetween returns the findings whose event time is in [from, to), oldest first
+func (e *Evidence) FindingsBetween(from, to time.Time) ([]Finding, error) {
+	return e.findings("from_iso8601_timestamp(time) >= ? AND from_iso8601_timestamp(time) < ?", "time",
+		Timestamp(from), Timestamp(to))
+}
+
+// FindingsByResource returns the findings naming an instance ID or access key ID, oldest first
+func (e *Evidence) FindingsByResource(resourceID string) ([]Finding, error) {
+	return e.findings("(detail.resource.instancedetails.instanceid = ? OR detail.resource.accesskeydetails.accesskeyid = ?)", "time",
+		String(resourceID), String(resourceID))
+}
+
+// FindingByID returns a single finding, or nil when there is no evidence for it
+func (e *Evidence) FindingByID(findingID string) (*Finding, error) {
+	findings, err := e.findings("detail.id = ?", "time", String(findingID))
+	if err != nil || len(findings) == 0 {
+		return nil, err
+	}
+	return &findings[0], nil
+}
+
+// findings selects the GuardDuty findings matching a condition; evidence of other event types has no
+// detail.id and is skipped
+func (e *Evidence) findings(condition, order string, params ...string) ([]Finding, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s.%s WHERE detail.id IS NOT NULL AND %s ORDER BY %s",
+		findingColumns, e.Database, e.Table, condition, order)
+
+	rows, err := e.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]Finding, 0, len(rows))
+	for _, row := range rows {
+		finding, err := parseFinding(row)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+func parseFinding(row []string) (Finding, error) {
+	if len(row) != 9 {
+		return Finding{}, fmt.Errorf("expected 9 columns, got %d", len(row))
+	}
+	severity, err := strconv.ParseFloat(row[2], 64)
+	if err != nil {
+		return Finding{}, fmt.Errorf("failed to parse severity %q of %s: %w", row[2], row[0], err)
+	}
+	// Events sent to triage other than through EventBridge carry no time
+	var eventTime time.Time
+	if row[5] != "" {
+		eventTime, err = time.Parse(time.RFC3339, row[5])
+		if err != nil {
+			return Finding{}, fmt.Errorf("failed to parse time %q of %s: %w", row[5], row[0], err)
+		}
+	}
+
+	return Finding{
+		ID:           row[0],
+		Type:         row[1],
+		Severity:     severity,
+		Account:      row[3],
+		Region:       row[4],
+		Time:         eventTime,
+		ResourceType: row[6],
+		ResourceID:   row[7],
+		Key:          keyFromPath(row[8]),
+	}, nil
+}
+
+// keyFromPath turns Athena's "$path" (s3://bucket/key) into the object key
+func keyFromPath(path string) string {
+	path = strings.TrimPrefix(path, "s3://")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
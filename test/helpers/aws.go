@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -8,17 +9,22 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
 )
 
 // WaitForStepFunctionExecution waits for a Step Functions execution to complete
-func WaitForStepFunctionExecution(sess *session.Session, executionArn string, timeout time.Duration) (*sfn.DescribeExecutionOutput, error) {
+func WaitForStepFunctionExecution(sess *session.Session, executionArn string, timeout time.Duration) (_ *sfn.DescribeExecutionOutput, err error) {
+	defer tracing.Step(sess, "wait-for-execution")(&err)
+
 	sfnClient := sfn.New(sess)
 
-	deadline := time.Now().Add(timeout)
+	deadline := clock.Default.Now().Add(timeout)
 
-	for time.Now().Before(deadline) {
+	for clock.Default.Now().Before(deadline) {
 		execution, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
 			ExecutionArn: aws.String(executionArn),
 		})
@@ -30,7 +36,7 @@ func WaitForStepFunctionExecution(sess *session.Session, executionArn string, ti
 			return execution, nil
 		}
 
-		time.Sleep(2 * time.Second)
+		clock.Default.Sleep(2 * time.Second)
 	}
 
 	return nil, fmt.Errorf("timeout waiting for Step Functions execution to complete")
@@ -40,21 +46,16 @@ func WaitForStepFunctionExecution(sess *session.Session, executionArn string, ti
 func PollCloudWatchLogsForPattern(sess *session.Session, logGroupName, pattern string, timeout time.Duration) (bool, error) {
 	logsClient := cloudwatchlogs.New(sess)
 
-	deadline := time.Now().Add(timeout)
+	deadline := clock.Default.Now().Add(timeout)
 
-	// Get log streams
-	logStreams, err := logsClient.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
-		LogGroupName:  aws.String(logGroupName),
-		OrderBy:       aws.String("LastEventTime"),
-		Descending:    aws.String("true"),
-		MaxResults:    aws.Int64(5),
-	})
+	// Get the most recent log streams
+	logStreams, err := ListLogStreams(sess, logGroupName, PageOptions{MaxItems: 5})
 	if err != nil {
 		return false, err
 	}
 
-	for time.Now().Before(deadline) {
-		for _, logStream := range logStreams.LogStreams {
+	for clock.Default.Now().Before(deadline) {
+		for _, logStream := range logStreams {
 			// Get log events
 			logEvents, err := logsClient.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
 				LogGroupName:  aws.String(logGroupName),
@@ -74,7 +75,7 @@ func PollCloudWatchLogsForPattern(sess *session.Session, logGroupName, pattern s
 			}
 		}
 
-		time.Sleep(3 * time.Second)
+		clock.Default.Sleep(3 * time.Second)
 	}
 
 	return false, nil
@@ -82,18 +83,13 @@ func PollCloudWatchLogsForPattern(sess *session.Session, logGroupName, pattern s
 
 // ValidateS3ObjectNaming validates S3 object naming convention
 func ValidateS3ObjectNaming(sess *session.Session, bucketName, prefix string) error {
-	s3Client := s3.New(sess)
-
-	objects, err := s3Client.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket: aws.String(bucketName),
-		Prefix: aws.String(prefix),
-	})
+	objects, err := ListObjects(sess, bucketName, prefix, PageOptions{}, nil)
 	if err != nil {
 		return err
 	}
 
 	expectedPattern := "findings/"
-	for _, obj := range objects.Contents {
+	for _, obj := range objects {
 		if obj.Key != nil {
 			if !strings.Contains(*obj.Key, expectedPattern) {
 				return fmt.Errorf("object key %s does not match expected pattern %s", *obj.Key, expectedPattern)
@@ -108,8 +104,22 @@ func ValidateS3ObjectNaming(sess *session.Session, bucketName, prefix string) er
 func GetStepFunctionExecutionHistory(sess *session.Session, executionArn string) (*sfn.GetExecutionHistoryOutput, error) {
 	sfnClient := sfn.New(sess)
 
-	history, err := sfnClient.GetExecutionHistory(&sfn.GetExecutionHistoryInput{
+	input := &sfn.GetExecutionHistoryInput{
 		ExecutionArn: aws.String(executionArn),
+	}
+
+	// Busy executions span several pages; merge them so analyzers see every event
+	history := &sfn.GetExecutionHistoryOutput{}
+	err := ForEachPage(func(token *string) (*sfn.GetExecutionHistoryOutput, *string, error) {
+		input.NextToken = token
+		page, err := sfnClient.GetExecutionHistory(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, page.NextToken, nil
+	}, PageOptions{}, func(page *sfn.GetExecutionHistoryOutput) bool {
+		history.Events = append(history.Events, page.Events...)
+		return true
 	})
 	if err != nil {
 		return nil, err
@@ -137,4 +147,70 @@ func ValidateStepFunctionStateTransitions(history *sfn.GetExecutionHistoryOutput
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// ReceiveDLQFindingIDs reads the EventBridge dead-letter queue without deleting messages
+// and returns the finding IDs of the events it contains
+func ReceiveDLQFindingIDs(sess *session.Session, queueURL string, timeout time.Duration) (map[string]bool, error) {
+	sqsClient := sqs.New(sess)
+
+	findingIDs := map[string]bool{}
+	deadline := clock.Default.Now().Add(timeout)
+
+	for clock.Default.Now().Before(deadline) {
+		messages, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(5),
+			VisibilityTimeout:   aws.Int64(int64(timeout.Seconds()) + 30),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages.Messages) == 0 {
+			break
+		}
+
+		for _, message := range messages.Messages {
+			var event struct {
+				Detail struct {
+					ID string `json:"id"`
+				} `json:"detail"`
+			}
+			if message.Body == nil || json.Unmarshal([]byte(*message.Body), &event) != nil {
+				continue
+			}
+			if event.Detail.ID != "" {
+				findingIDs[event.Detail.ID] = true
+			}
+		}
+	}
+
+	return findingIDs, nil
+}
+
+// ListEvidenceFindingIDs returns the finding IDs that have an evidence object under findings/
+func ListEvidenceFindingIDs(sess *session.Session, bucketName string) (map[string]bool, error) {
+	objects, err := ListObjects(sess, bucketName, "findings/", PageOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	findingIDs := map[string]bool{}
+	for _, obj := range objects {
+		if obj.Key == nil {
+			continue
+		}
+		findingID := strings.TrimSuffix(strings.TrimPrefix(*obj.Key, "findings/"), ".json")
+		findingIDs[findingID] = true
+	}
+
+	return findingIDs, nil
+}
+
+// PutGuardDutyFindings sends findings to the default event bus as GuardDuty events, batching to the PutEvents limit
+func PutGuardDutyFindings(sess *session.Session, findings []GuardDutyFinding) error {
+	_, err := NewEventBridgeSource(sess).Inject(findings)
+	return err
+}
@@ -0,0 +1,182 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+)
+
+// ServiceLinkedRole is a service-linked role the stack relies on
+type ServiceLinkedRole struct {
+	Name    string
+	Service string
+}
+
+// RequiredServiceLinkedRoles are created by the first CreateDetector and EnableSecurityHub calls,
+// which fails when the deploying principal may not create them
+var RequiredServiceLinkedRoles = []ServiceLinkedRole{
+	{Name: "AWSServiceRoleForAmazonGuardDuty", Service: "guardduty.amazonaws.com"},
+	{Name: "AWSServiceRoleForSecurityHub", Service: "securityhub.amazonaws.com"},
+}
+
+// BaselineProblem is an account prerequisite that would make the deployment fail
+type BaselineProblem struct {
+	Check string
+	// Message says what is wrong and how to fix it
+	Message string
+}
+
+// String renders the problem as "check: message"
+func (p BaselineProblem) String() string {
+	return p.Check + ": " + p.Message
+}
+
+// CheckAccountBaseline verifies the account and region can take the stack: GuardDuty and Security
+// Hub are not administered by another account, the service-linked roles exist, and none of the
+// buckets the stack creates already exist
+func CheckAccountBaseline(sess *session.Session, bucketNames ...string) ([]BaselineProblem, error) {
+	var problems []BaselineProblem
+
+	checks := []func(*session.Session) ([]BaselineProblem, error){
+		checkGuardDutyAdministrator,
+		checkSecurityHubAdministrator,
+		checkServiceLinkedRoles,
+		func(sess *session.Session) ([]BaselineProblem, error) {
+			return checkBucketsAvailable(sess, bucketNames)
+		},
+	}
+	for _, check := range checks {
+		found, err := check(sess)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, found...)
+	}
+
+	return problems, nil
+}
+
+// AssertAccountBaseline fails with every baseline problem at once, so they can be fixed in one go
+func AssertAccountBaseline(sess *session.Session, bucketNames ...string) error {
+	problems, err := CheckAccountBaseline(sess, bucketNames...)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = "  " + problem.String()
+	}
+	return fmt.Errorf("account is not ready for the stack:\n%s", strings.Join(lines, "\n"))
+}
+
+func checkGuardDutyAdministrator(sess *session.Session) ([]BaselineProblem, error) {
+	gdClient := guardduty.New(sess)
+
+	detectors, err := gdClient.ListDetectors(&guardduty.ListDetectorsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return nil, nil
+	}
+
+	admin, err := gdClient.GetAdministratorAccount(&guardduty.GetAdministratorAccountInput{
+		DetectorId: detectors.DetectorIds[0],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GuardDuty administrator: %w", err)
+	}
+	if admin.Administrator == nil || aws.StringValue(admin.Administrator.RelationshipStatus) != MemberStatusEnabled {
+		return nil, nil
+	}
+
+	return []BaselineProblem{{
+		Check: "guardduty-administrator",
+		Message: fmt.Sprintf("GuardDuty detector %s is managed by administrator account %s; deploy from that account or disassociate this member first",
+			aws.StringValue(detectors.DetectorIds[0]), aws.StringValue(admin.Administrator.AccountId)),
+	}}, nil
+}
+
+func checkSecurityHubAdministrator(sess *session.Session) ([]BaselineProblem, error) {
+	admin, err := securityhub.New(sess).GetAdministratorAccount(&securityhub.GetAdministratorAccountInput{})
+	if err != nil {
+		// Security Hub not enabled yet is the expected state before the first deployment
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == securityhub.ErrCodeInvalidAccessException {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Security Hub administrator: %w", err)
+	}
+	if admin.Administrator == nil || aws.StringValue(admin.Administrator.AccountId) == "" {
+		return nil, nil
+	}
+
+	return []BaselineProblem{{
+		Check: "securityhub-administrator",
+		Message: fmt.Sprintf("Security Hub is administered by account %s (status %s); deploy from that account or have it disassociate this member",
+			aws.StringValue(admin.Administrator.AccountId), aws.StringValue(admin.Administrator.MemberStatus)),
+	}}, nil
+}
+
+func checkServiceLinkedRoles(sess *session.Session) ([]BaselineProblem, error) {
+	iamClient := iam.New(sess)
+
+	var problems []BaselineProblem
+	for _, role := range RequiredServiceLinkedRoles {
+		_, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(role.Name)})
+		if err == nil {
+			continue
+		}
+		if !isIAMNotFound(err) {
+			return nil, fmt.Errorf("failed to get service-linked role %s: %w", role.Name, err)
+		}
+
+		problems = append(problems, BaselineProblem{
+			Check: "service-linked-role",
+			Message: fmt.Sprintf("%s is missing; create it with `aws iam create-service-linked-role --aws-service-name %s` or allow iam:CreateServiceLinkedRole for the deploying principal",
+				role.Name, role.Service),
+		})
+	}
+
+	return problems, nil
+}
+
+func checkBucketsAvailable(sess *session.Session, bucketNames []string) ([]BaselineProblem, error) {
+	s3Client := s3.New(sess)
+
+	var problems []BaselineProblem
+	for _, bucket := range bucketNames {
+		_, err := s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err == nil {
+			problems = append(problems, BaselineProblem{
+				Check:   "bucket-conflict",
+				Message: fmt.Sprintf("bucket %s already exists in this account; import it into the state or choose another name", bucket),
+			})
+			continue
+		}
+
+		awsErr, ok := err.(awserr.RequestFailure)
+		switch {
+		case ok && awsErr.StatusCode() == 404:
+		case ok && awsErr.StatusCode() == 403:
+			problems = append(problems, BaselineProblem{
+				Check:   "bucket-conflict",
+				Message: fmt.Sprintf("bucket %s is owned by another account; choose another name", bucket),
+			})
+		default:
+			return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+		}
+	}
+
+	return problems, nil
+}
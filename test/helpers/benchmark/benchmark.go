@@ -0,0 +1,176 @@
+package benchmark
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// Config describes a memory-size benchmark run against a Lambda function
+type Config struct {
+	FunctionName   string
+	MemorySizes    []int64
+	ColdIterations int
+	WarmIterations int
+	Payload        []byte
+}
+
+// Sample is a single invocation measurement parsed from a REPORT log line
+type Sample struct {
+	MemorySize      int64
+	Cold            bool
+	Duration        time.Duration
+	BilledDuration  time.Duration
+	InitDuration    time.Duration
+	MaxMemoryUsedMB int64
+}
+
+var reportLinePattern = regexp.MustCompile(`REPORT RequestId: \S+\s+Duration: ([\d.]+) ms\s+Billed Duration: ([\d.]+) ms\s+Memory Size: (\d+) MB\s+Max Memory Used: (\d+) MB(?:\s+Init Duration: ([\d.]+) ms)?`)
+
+// ParseReportLine parses the REPORT line Lambda writes at the end of every invocation
+func ParseReportLine(logs string) (Sample, error) {
+	match := reportLinePattern.FindStringSubmatch(logs)
+	if match == nil {
+		return Sample{}, fmt.Errorf("no REPORT line found in invocation logs")
+	}
+
+	sample := Sample{
+		Duration:       parseMillis(match[1]),
+		BilledDuration: parseMillis(match[2]),
+	}
+	sample.MemorySize, _ = strconv.ParseInt(match[3], 10, 64)
+	sample.MaxMemoryUsedMB, _ = strconv.ParseInt(match[4], 10, 64)
+
+	if match[5] != "" {
+		sample.Cold = true
+		sample.InitDuration = parseMillis(match[5])
+	}
+
+	return sample, nil
+}
+
+func parseMillis(value string) time.Duration {
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Run invokes the function across the configured memory sizes and returns the collected samples.
+// The function's original memory size and environment are restored before returning.
+func Run(sess *session.Session, cfg Config) (*Report, error) {
+	lambdaClient := lambda.New(sess)
+
+	original, err := lambdaClient.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(cfg.FunctionName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function configuration: %w", err)
+	}
+
+	originalVars := map[string]*string{}
+	if original.Environment != nil {
+		originalVars = original.Environment.Variables
+	}
+
+	defer func() {
+		updateFunction(lambdaClient, cfg.FunctionName, *original.MemorySize, originalVars)
+	}()
+
+	report := &Report{FunctionName: cfg.FunctionName}
+
+	for _, memorySize := range cfg.MemorySizes {
+		for i := 0; i < cfg.ColdIterations; i++ {
+			// Changing the environment forces Lambda to discard warm execution environments
+			vars := copyVars(originalVars)
+			vars["BENCHMARK_NONCE"] = aws.String(fmt.Sprintf("%d-%d-%d", memorySize, i, time.Now().UnixNano()))
+
+			if err := updateFunction(lambdaClient, cfg.FunctionName, memorySize, vars); err != nil {
+				return nil, err
+			}
+
+			sample, err := invoke(lambdaClient, cfg.FunctionName, cfg.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("cold invocation %d at %d MB failed: %w", i+1, memorySize, err)
+			}
+			report.Samples = append(report.Samples, sample)
+		}
+
+		for i := 0; i < cfg.WarmIterations; i++ {
+			sample, err := invoke(lambdaClient, cfg.FunctionName, cfg.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("warm invocation %d at %d MB failed: %w", i+1, memorySize, err)
+			}
+			report.Samples = append(report.Samples, sample)
+		}
+	}
+
+	return report, nil
+}
+
+func updateFunction(lambdaClient *lambda.Lambda, functionName string, memorySize int64, vars map[string]*string) error {
+	_, err := lambdaClient.UpdateFunctionConfiguration(&lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+		MemorySize:   aws.Int64(memorySize),
+		Environment:  &lambda.Environment{Variables: vars},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update function to %d MB: %w", memorySize, err)
+	}
+
+	err = lambdaClient.WaitUntilFunctionUpdated(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("function update to %d MB did not complete: %w", memorySize, err)
+	}
+
+	return nil
+}
+
+func invoke(lambdaClient *lambda.Lambda, functionName string, payload []byte) (Sample, error) {
+	output, err := lambdaClient.Invoke(&lambda.InvokeInput{
+		FunctionName: aws.String(functionName),
+		LogType:      aws.String(lambda.LogTypeTail),
+		Payload:      payload,
+	})
+	if err != nil {
+		return Sample{}, err
+	}
+
+	if output.LogResult == nil {
+		return Sample{}, fmt.Errorf("invocation returned no log tail")
+	}
+
+	logs, err := base64.StdEncoding.DecodeString(*output.LogResult)
+	if err != nil {
+		return Sample{}, fmt.Errorf("failed to decode log tail: %w", err)
+	}
+
+	return ParseReportLine(string(logs))
+}
+
+func copyVars(vars map[string]*string) map[string]*string {
+	copied := make(map[string]*string, len(vars)+1)
+	for key, value := range vars {
+		copied[key] = value
+	}
+	return copied
+}
+
+// FormatMemorySizes renders memory sizes for log output, e.g. "128,256,512"
+func FormatMemorySizes(sizes []int64) string {
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = strconv.FormatInt(size, 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,138 @@
+package benchmark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pricePerGBSecond is the on-demand x86_64 Lambda compute price used for cost estimates
+const pricePerGBSecond = 0.0000166667
+
+// Report holds all benchmark samples for a function
+type Report struct {
+	FunctionName string
+	Samples      []Sample
+}
+
+// MemoryStats summarizes the samples collected at a single memory size
+type MemoryStats struct {
+	MemorySize      int64
+	ColdCount       int
+	WarmCount       int
+	AvgInitDuration time.Duration
+	P50Duration     time.Duration
+	P95Duration     time.Duration
+	MaxMemoryUsedMB int64
+	CostPerMillion  float64
+}
+
+// Stats returns per-memory-size statistics ordered by memory size
+func (r *Report) Stats() []MemoryStats {
+	byMemory := map[int64][]Sample{}
+	for _, sample := range r.Samples {
+		byMemory[sample.MemorySize] = append(byMemory[sample.MemorySize], sample)
+	}
+
+	var stats []MemoryStats
+	for memorySize, samples := range byMemory {
+		stat := MemoryStats{MemorySize: memorySize}
+
+		var warmDurations []time.Duration
+		var totalInit, totalBilled time.Duration
+		for _, sample := range samples {
+			if sample.Cold {
+				stat.ColdCount++
+				totalInit += sample.InitDuration
+			} else {
+				stat.WarmCount++
+				warmDurations = append(warmDurations, sample.Duration)
+			}
+			totalBilled += sample.BilledDuration
+			if sample.MaxMemoryUsedMB > stat.MaxMemoryUsedMB {
+				stat.MaxMemoryUsedMB = sample.MaxMemoryUsedMB
+			}
+		}
+
+		if stat.ColdCount > 0 {
+			stat.AvgInitDuration = totalInit / time.Duration(stat.ColdCount)
+		}
+		stat.P50Duration = percentile(warmDurations, 0.50)
+		stat.P95Duration = percentile(warmDurations, 0.95)
+
+		avgBilledSeconds := (totalBilled / time.Duration(len(samples))).Seconds()
+		stat.CostPerMillion = float64(memorySize) / 1024 * avgBilledSeconds * pricePerGBSecond * 1e6
+
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].MemorySize < stats[j].MemorySize })
+	return stats
+}
+
+// Recommend returns the cheapest memory size whose warm p95 is within tolerance of the fastest one
+func (r *Report) Recommend(tolerance float64) (MemoryStats, error) {
+	stats := r.Stats()
+	if len(stats) == 0 {
+		return MemoryStats{}, fmt.Errorf("no benchmark samples recorded")
+	}
+
+	fastest := stats[0].P95Duration
+	for _, stat := range stats {
+		if stat.P95Duration < fastest {
+			fastest = stat.P95Duration
+		}
+	}
+
+	limit := time.Duration(float64(fastest) * (1 + tolerance))
+	var best *MemoryStats
+	for i := range stats {
+		if stats[i].P95Duration > limit {
+			continue
+		}
+		if best == nil || stats[i].CostPerMillion < best.CostPerMillion {
+			best = &stats[i]
+		}
+	}
+
+	return *best, nil
+}
+
+// String renders the report as a table followed by a lambda_memory_size recommendation
+func (r *Report) String() string {
+	var b strings.Builder
+
+	stats := r.Stats()
+	sizes := make([]int64, len(stats))
+	for i, stat := range stats {
+		sizes[i] = stat.MemorySize
+	}
+
+	fmt.Fprintf(&b, "Lambda benchmark for %s (memory sizes: %s MB)\n", r.FunctionName, FormatMemorySizes(sizes))
+	fmt.Fprintf(&b, "%-8s %-6s %-6s %-12s %-12s %-12s %-10s %s\n", "MEMORY", "COLD", "WARM", "AVG INIT", "P50", "P95", "MAX USED", "$/1M INVOKES")
+	for _, stat := range stats {
+		fmt.Fprintf(&b, "%-8d %-6d %-6d %-12v %-12v %-12v %-10d %.4f\n",
+			stat.MemorySize, stat.ColdCount, stat.WarmCount,
+			stat.AvgInitDuration.Round(time.Millisecond), stat.P50Duration.Round(time.Millisecond), stat.P95Duration.Round(time.Millisecond),
+			stat.MaxMemoryUsedMB, stat.CostPerMillion)
+	}
+
+	if best, err := r.Recommend(0.10); err == nil {
+		fmt.Fprintf(&b, "Recommendation: lambda_memory_size = %d\n", best.MemorySize)
+	}
+
+	return b.String()
+}
+
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(float64(len(sorted)-1) * p)
+	return sorted[index]
+}
@@ -0,0 +1,247 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// BufferVisibilityMultiple is how many function timeouts the buffer's visibility timeout must cover,
+// so a message is not redelivered while a slow batch is still being triaged
+const BufferVisibilityMultiple = 6
+
+// AssertBufferConfiguration checks the SQS buffer in front of the triage function: the event source
+// mapping polls it with the expected batch size and reports partial batch failures, the visibility
+// timeout covers BufferVisibilityMultiple function timeouts, and failed findings are redriven to a
+// dead-letter queue
+func AssertBufferConfiguration(sess *session.Session, queueURL, functionName string, batchSize int64) error {
+	sqsClient := sqs.New(sess)
+	lambdaClient := lambda.New(sess)
+
+	attributes, err := sqsClient.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{
+			sqs.QueueAttributeNameQueueArn,
+			sqs.QueueAttributeNameVisibilityTimeout,
+			sqs.QueueAttributeNameRedrivePolicy,
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get attributes of %s: %w", queueURL, err)
+	}
+	function, err := lambdaClient.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+
+	var problems []string
+
+	visibility, _ := strconv.ParseInt(aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameVisibilityTimeout]), 10, 64)
+	if timeout := aws.Int64Value(function.Timeout); visibility < BufferVisibilityMultiple*timeout {
+		problems = append(problems, fmt.Sprintf("visibility timeout %ds is less than %d times the function timeout of %ds",
+			visibility, BufferVisibilityMultiple, timeout))
+	}
+
+	var redrive struct {
+		DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+	}
+	if policy := aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameRedrivePolicy]); policy == "" {
+		problems = append(problems, "no redrive policy, so a finding that always fails is retried until it expires")
+	} else if err := json.Unmarshal([]byte(policy), &redrive); err != nil || redrive.DeadLetterTargetArn == "" {
+		problems = append(problems, fmt.Sprintf("unreadable redrive policy %s", policy))
+	}
+
+	queueARN := aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameQueueArn])
+	mappings, err := lambdaClient.ListEventSourceMappings(&lambda.ListEventSourceMappingsInput{
+		FunctionName:   aws.String(functionName),
+		EventSourceArn: aws.String(queueARN),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list event source mappings of %s: %w", functionName, err)
+	}
+	if len(mappings.EventSourceMappings) != 1 {
+		problems = append(problems, fmt.Sprintf("expected one event source mapping from %s, found %d", queueARN, len(mappings.EventSourceMappings)))
+	} else {
+		mapping := mappings.EventSourceMappings[0]
+		if size := aws.Int64Value(mapping.BatchSize); size != batchSize {
+			problems = append(problems, fmt.Sprintf("batch size is %d, expected %d", size, batchSize))
+		}
+		if !contains(aws.StringValueSlice(mapping.FunctionResponseTypes), lambda.FunctionResponseTypeReportBatchItemFailures) {
+			problems = append(problems, "partial batch responses are not enabled, so one failed finding redelivers the whole batch")
+		}
+		if state := aws.StringValue(mapping.State); state != "Enabled" {
+			problems = append(problems, fmt.Sprintf("event source mapping is %s", state))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("SQS buffer %s is misconfigured:\n  %s", queueURL, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// AssertPartialBatchHandling sends the findings to the buffer in one batch together with a message
+// triage cannot parse, and checks that the findings are triaged while only the poison message is
+// redelivered until it lands in the dead-letter queue
+func AssertPartialBatchHandling(sess *session.Session, queueURL, dlqURL, evidenceBucket string, findings []GuardDutyFinding, timeout time.Duration) error {
+	if len(findings) > 9 {
+		return fmt.Errorf("at most 9 findings fit in a batch with the poison message, got %d", len(findings))
+	}
+	sqsClient := sqs.New(sess)
+
+	poisonID := fmt.Sprintf("ir-poison-%d", time.Now().UnixNano())
+	entries := []*sqs.SendMessageBatchRequestEntry{{
+		Id:          aws.String("poison"),
+		MessageBody: aws.String(`{"ir-poison": "` + poisonID + `"`),
+	}}
+	var ids []string
+	for i, finding := range findings {
+		body, err := GenerateEventBridgeEventJSON(finding)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:          aws.String(fmt.Sprintf("finding-%d", i)),
+			MessageBody: aws.String(body),
+		})
+		ids = append(ids, finding.ID)
+	}
+
+	sent, err := sqsClient.SendMessageBatch(&sqs.SendMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries})
+	if err != nil {
+		return fmt.Errorf("failed to send batch to %s: %w", queueURL, err)
+	}
+	if len(sent.Failed) > 0 {
+		return fmt.Errorf("%d of %d messages were rejected by %s", len(sent.Failed), len(entries), queueURL)
+	}
+
+	if err := WaitForEvidenceFindingIDs(sess, evidenceBucket, ids, timeout); err != nil {
+		return fmt.Errorf("a poison message held back the rest of its batch: %w", err)
+	}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		bodies, err := peekMessageBodies(sess, dlqURL)
+		if err != nil {
+			return err
+		}
+		var poisoned bool
+		for _, body := range bodies {
+			for _, id := range ids {
+				if strings.Contains(body, id) {
+					return fmt.Errorf("triaged finding %s was also sent to the dead-letter queue", id)
+				}
+			}
+			poisoned = poisoned || strings.Contains(body, poisonID)
+		}
+		if poisoned {
+			return nil
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+	return fmt.Errorf("poison message %s did not reach %s within %s", poisonID, dlqURL, timeout)
+}
+
+// WaitForEvidenceFindingIDs waits until every finding has an evidence object, in whatever order
+// they were triaged
+func WaitForEvidenceFindingIDs(sess *session.Session, bucketName string, findingIDs []string, timeout time.Duration) error {
+	var missing []string
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		evidence, err := ListEvidenceFindingIDs(sess, bucketName)
+		if err != nil {
+			return err
+		}
+		missing = nil
+		for _, id := range findingIDs {
+			if !evidence[id] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	if len(missing) > 5 {
+		return fmt.Errorf("%d of %d findings have no evidence after %s, e.g. %s", len(missing), len(findingIDs), timeout, strings.Join(missing[:5], ", "))
+	}
+	return fmt.Errorf("no evidence for %s after %s", strings.Join(missing, ", "), timeout)
+}
+
+// AssertBurstTriaged injects a burst of findings through EventBridge and checks that the buffer
+// delivers every one of them to triage exactly once and lets none fall into the dead-letter queue,
+// regardless of the order they are processed in
+func AssertBurstTriaged(sess *session.Session, evidenceBucket, dlqURL, runID string, size int, timeout time.Duration) error {
+	findings := make([]GuardDutyFinding, 0, size)
+	for i := 0; i < size; i++ {
+		findings = append(findings, GuardDutyFinding{
+			ID:       fmt.Sprintf("burst-%s-%04d", runID, i),
+			Severity: 7.5,
+			Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+			// Not instances, so the burst does not depend on live EC2 targets
+			Resource: map[string]interface{}{"resourceType": "AccessKey"},
+		})
+	}
+
+	ids, err := NewEventBridgeSource(sess).Inject(findings)
+	if err != nil {
+		return err
+	}
+	if err := WaitForEvidenceFindingIDs(sess, evidenceBucket, ids, timeout); err != nil {
+		return err
+	}
+
+	bodies, err := peekMessageBodies(sess, dlqURL)
+	if err != nil {
+		return err
+	}
+	var dropped int
+	for _, body := range bodies {
+		if strings.Contains(body, "burst-"+runID) {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d of %d burst findings ended in the dead-letter queue", dropped, size)
+	}
+	return nil
+}
+
+// peekMessageBodies receives what is currently visible in a queue without deleting it
+func peekMessageBodies(sess *session.Session, queueURL string) ([]string, error) {
+	sqsClient := sqs.New(sess)
+
+	var bodies []string
+	for {
+		messages, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(1),
+			VisibilityTimeout:   aws.Int64(30),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive from %s: %w", queueURL, err)
+		}
+		if len(messages.Messages) == 0 {
+			return bodies, nil
+		}
+		for _, message := range messages.Messages {
+			bodies = append(bodies, aws.StringValue(message.Body))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package canary runs the end-to-end pipeline check continuously against a deployed stack: it
+// injects a tagged, low-impact synthetic finding, verifies triage within an SLO and reports the
+// outcome as a CloudWatch health metric.
+package canary
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// MetricsNamespace is the namespace of the pipeline's own metrics, shared with the triage Lambda
+const MetricsNamespace = "ThreatDetectionIR"
+
+// FindingIDPrefix marks canary findings in the evidence bucket and execution history
+const FindingIDPrefix = "ir-canary-"
+
+// EventSource is the source canary findings are published under. PutEvents refuses aws.* sources,
+// so the stack routes this one to triage when enable_canary_findings is set.
+const EventSource = "ir.canary"
+
+// Canary checks one deployed stack
+type Canary struct {
+	Session         *session.Session
+	StateMachineArn string
+	EvidenceBucket  string
+	// Stack is the metric dimension the health metric is reported under
+	Stack string
+	// Severity must be at or above the stack's finding_severity_threshold for the finding to be
+	// routed at all
+	Severity float64
+	// SLO bounds the time from injection to a succeeded IR execution
+	SLO time.Duration
+}
+
+// Result is the outcome of one canary run
+type Result struct {
+	FindingID string
+	Injected  time.Time
+	// Latency is the time until the IR execution succeeded, when it did
+	Latency time.Duration
+	Err     error
+}
+
+// Healthy reports whether the pipeline handled the canary within the SLO
+func (r Result) Healthy() bool { return r.Err == nil }
+
+// String implements fmt.Stringer
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s %s UNHEALTHY: %v", r.Injected.UTC().Format(time.RFC3339), r.FindingID, r.Err)
+	}
+	return fmt.Sprintf("%s %s healthy in %s", r.Injected.UTC().Format(time.RFC3339), r.FindingID, r.Latency.Round(time.Second))
+}
+
+// Finding returns the canary finding for a run. It names an access key rather than an instance, so
+// triage has nothing to isolate, and details.canary keeps triage from paging anyone.
+func Finding(runID string, severity float64) helpers.GuardDutyFinding {
+	return helpers.GuardDutyFinding{
+		ID:       FindingIDPrefix + runID,
+		Severity: severity,
+		Type:     "UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+		Resource: map[string]interface{}{"resourceType": "AccessKey"},
+		Details:  map[string]interface{}{"canary": true},
+	}
+}
+
+// RunOnce injects a canary finding and waits for the pipeline to store its evidence and run its IR
+// execution to success within the SLO
+func (c Canary) RunOnce() Result {
+	finding := Finding(clock.Default.Now().UTC().Format("20060102-150405"), c.Severity)
+	result := Result{FindingID: finding.ID, Injected: clock.Default.Now()}
+
+	if err := Inject(c.Session, finding); err != nil {
+		result.Err = err
+		return result
+	}
+
+	metadata, err := helpers.WaitForEvidenceMetadata(c.Session, c.EvidenceBucket, finding.ID, c.SLO)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if metadata["canary"] != "true" {
+		result.Err = fmt.Errorf("evidence for %s is not marked as canary, so it may have paged", finding.ID)
+		return result
+	}
+
+	remaining := c.SLO - clock.Default.Since(result.Injected)
+	if err := waitForSucceededExecution(c.Session, c.StateMachineArn, finding.ID, remaining); err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Latency = clock.Default.Since(result.Injected)
+	return result
+}
+
+// Inject publishes a canary finding on the default bus under EventSource
+func Inject(sess *session.Session, finding helpers.GuardDutyFinding) error {
+	event, err := helpers.GenerateEventBridgeEvent(finding)
+	if err != nil {
+		return err
+	}
+	detail, err := json.Marshal(event["detail"])
+	if err != nil {
+		return err
+	}
+
+	output, err := eventbridge.New(sess).PutEvents(&eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			Source:       aws.String(EventSource),
+			DetailType:   aws.String("GuardDuty Finding"),
+			Detail:       aws.String(string(detail)),
+			EventBusName: aws.String("default"),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inject canary: %w", err)
+	}
+	if aws.Int64Value(output.FailedEntryCount) > 0 {
+		return fmt.Errorf("canary %s was rejected by EventBridge: %s", finding.ID, aws.StringValue(output.Entries[0].ErrorMessage))
+	}
+	return nil
+}
+
+// Emit reports the result as the CanaryHealthy (1 or 0) and, when healthy, CanaryLatency metrics
+func (c Canary) Emit(result Result) error {
+	dimensions := []*cloudwatch.Dimension{{Name: aws.String("Stack"), Value: aws.String(c.Stack)}}
+
+	healthy := 0.0
+	if result.Healthy() {
+		healthy = 1
+	}
+	data := []*cloudwatch.MetricDatum{{
+		MetricName: aws.String("CanaryHealthy"),
+		Dimensions: dimensions,
+		Timestamp:  aws.Time(result.Injected),
+		Value:      aws.Float64(healthy),
+		Unit:       aws.String(cloudwatch.StandardUnitCount),
+	}}
+	if result.Healthy() {
+		data = append(data, &cloudwatch.MetricDatum{
+			MetricName: aws.String("CanaryLatency"),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(result.Injected),
+			Value:      aws.Float64(float64(result.Latency.Milliseconds())),
+			Unit:       aws.String(cloudwatch.StandardUnitMilliseconds),
+		})
+	}
+
+	if _, err := cloudwatch.New(c.Session).PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(MetricsNamespace),
+		MetricData: data,
+	}); err != nil {
+		return fmt.Errorf("failed to emit canary metrics: %w", err)
+	}
+	return nil
+}
+
+// waitForSucceededExecution polls for the triage execution of the finding until it succeeds,
+// failing fast when it ends any other way
+func waitForSucceededExecution(sess *session.Session, stateMachineArn, findingID string, timeout time.Duration) error {
+	prefix := helpers.TriageExecutionPrefix(findingID)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		executions, err := helpers.ListExecutions(sess, stateMachineArn, "", helpers.PageOptions{MaxPages: 2})
+		if err != nil {
+			return err
+		}
+		for _, execution := range executions {
+			if !strings.HasPrefix(aws.StringValue(execution.Name), prefix) {
+				continue
+			}
+			switch status := aws.StringValue(execution.Status); status {
+			case sfn.ExecutionStatusSucceeded:
+				return nil
+			case sfn.ExecutionStatusRunning:
+			default:
+				return fmt.Errorf("IR execution %s for %s ended %s", aws.StringValue(execution.Name), findingID, status)
+			}
+		}
+
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("no succeeded IR execution for %s within the SLO", findingID)
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+}
@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Channels a finding's notices reach responders through. Each is captured by a queue subscribed
+// the way the real endpoint would be: pages by a subscription to the urgent topic, chat messages by
+// one to the standard topic.
+const (
+	ChannelPage = "page"
+	ChannelChat = "chat"
+	// ChannelTicket is where tickets would be opened; the stack has no ticketing integration, so
+	// nothing captures it and it never receives a notice
+	ChannelTicket = "ticket"
+)
+
+// ChannelCapture is every notice each channel received, in the order received. Unlike
+// WaitForNotifications it keeps duplicates, so fan-out bugs show up as counts above one.
+type ChannelCapture map[string][]Notification
+
+// CaptureChannels receives from every channel's queue, keyed by channel, for the settle period
+func CaptureChannels(sess *session.Session, queueURLs map[string]string, settle time.Duration) (ChannelCapture, error) {
+	channels := make([]string, 0, len(queueURLs))
+	for channel := range queueURLs {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	capture := ChannelCapture{}
+	for settled := clock.Default.Now().Add(settle); clock.Default.Now().Before(settled); {
+		for _, channel := range channels {
+			notifications, err := receiveNotificationBatch(sess, queueURLs[channel])
+			capture[channel] = append(capture[channel], notifications...)
+			if err != nil {
+				return capture, fmt.Errorf("failed to capture %s: %w", channel, err)
+			}
+		}
+	}
+	return capture, nil
+}
+
+// Count returns how many notices about the finding the channel received. The notice the IR
+// workflow publishes when containment partially failed is a notice of its own and is counted by
+// CountFailures instead.
+func (c ChannelCapture) Count(channel, findingID string) int {
+	count := 0
+	for _, notification := range c[channel] {
+		if notification.FindingID == findingID && len(notification.Failures) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// CountFailures returns how many containment failure notices about the finding the channel received
+func (c ChannelCapture) CountFailures(channel, findingID string) int {
+	count := 0
+	for _, notification := range c[channel] {
+		if notification.FindingID == findingID && len(notification.Failures) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// AssertAtMostOnce checks that no channel received more than one notice, or more than one failure
+// notice, about any of the findings
+func (c ChannelCapture) AssertAtMostOnce(findingIDs ...string) error {
+	channels := make([]string, 0, len(c))
+	for channel := range c {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var duplicates []string
+	for _, id := range findingIDs {
+		for _, channel := range channels {
+			if count := c.Count(channel, id); count > 1 {
+				duplicates = append(duplicates, fmt.Sprintf("%s: %d %s notices", id, count, channel))
+			}
+			if count := c.CountFailures(channel, id); count > 1 {
+				duplicates = append(duplicates, fmt.Sprintf("%s: %d %s failure notices", id, count, channel))
+			}
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate notifications: %s", strings.Join(duplicates, "; "))
+	}
+	return nil
+}
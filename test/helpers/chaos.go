@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// ThrottleFunction sets the function's reserved concurrency to zero so every invocation is
+// throttled, and returns a func that restores the concurrency it had before
+func ThrottleFunction(sess *session.Session, functionName string) (func() error, error) {
+	lambdaClient := lambda.New(sess)
+
+	current, err := lambdaClient.GetFunctionConcurrency(&lambda.GetFunctionConcurrencyInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get concurrency of %s: %w", functionName, err)
+	}
+
+	if _, err := lambdaClient.PutFunctionConcurrency(&lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 aws.String(functionName),
+		ReservedConcurrentExecutions: aws.Int64(0),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to throttle %s: %w", functionName, err)
+	}
+
+	restore := func() error {
+		var err error
+		if current.ReservedConcurrentExecutions != nil {
+			_, err = lambdaClient.PutFunctionConcurrency(&lambda.PutFunctionConcurrencyInput{
+				FunctionName:                 aws.String(functionName),
+				ReservedConcurrentExecutions: current.ReservedConcurrentExecutions,
+			})
+		} else {
+			_, err = lambdaClient.DeleteFunctionConcurrency(&lambda.DeleteFunctionConcurrencyInput{
+				FunctionName: aws.String(functionName),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore concurrency of %s: %w", functionName, err)
+		}
+		return nil
+	}
+
+	return restore, nil
+}
+
+// ChaosDenyPolicyName is the inline policy DenyRoleActions attaches
+const ChaosDenyPolicyName = "ir-chaos-deny"
+
+// DenyRoleActions attaches an inline policy to the role denying the actions on every resource, and
+// returns a func that removes it again. IAM takes a few seconds to enforce the deny.
+func DenyRoleActions(sess *session.Session, roleName string, actions ...string) (func() error, error) {
+	iamClient := iam.New(sess)
+
+	document, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{"Effect": "Deny", "Action": actions, "Resource": "*"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := iamClient.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(ChaosDenyPolicyName),
+		PolicyDocument: aws.String(string(document)),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to deny %v to %s: %w", actions, roleName, err)
+	}
+
+	restore := func() error {
+		if _, err := iamClient.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+			RoleName:   aws.String(roleName),
+			PolicyName: aws.String(ChaosDenyPolicyName),
+		}); err != nil {
+			return fmt.Errorf("failed to remove deny policy from %s: %w", roleName, err)
+		}
+		return nil
+	}
+
+	return restore, nil
+}
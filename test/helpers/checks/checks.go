@@ -0,0 +1,281 @@
+// Package checks classifies a suite's assertions by how much their failure matters. A BLOCKER
+// check fails the suite as usual; a WARN or INFO check that fails is recorded in the suite report
+// and the test log without failing it. New strict checks can start as WARN, be watched across the
+// existing deployments and be promoted once they pass everywhere, one check at a time, through
+// CHECKS_FAIL_LEVEL and CHECKS_STRICT.
+package checks
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/testlog"
+)
+
+// Level is how much a failed check matters
+type Level int
+
+const (
+	// Info checks are informational; their failures are only reported
+	Info Level = iota
+	// Warn checks are on their way to being enforced; their failures are reported without failing the suite
+	Warn
+	// Blocker checks fail the suite
+	Blocker
+)
+
+// Environment variables that configure FromEnv
+const (
+	// FailLevelEnv sets the lowest level whose failures fail the suite, BLOCKER by default
+	FailLevelEnv = "CHECKS_FAIL_LEVEL"
+	// StrictEnv lists check names, comma-separated, that fail the suite whatever their level
+	StrictEnv = "CHECKS_STRICT"
+)
+
+// String returns the level's name as it appears in reports
+func (l Level) String() string {
+	switch l {
+	case Info:
+		return "INFO"
+	case Warn:
+		return "WARN"
+	case Blocker:
+		return "BLOCKER"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// ParseLevel parses a level name, case-insensitively
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "INFO":
+		return Info, nil
+	case "WARN", "WARNING":
+		return Warn, nil
+	case "BLOCKER":
+		return Blocker, nil
+	default:
+		return 0, fmt.Errorf("unknown check level %q, expected BLOCKER, WARN or INFO", name)
+	}
+}
+
+// T is the subset of *testing.T that check bodies may use. It satisfies the testify and terratest
+// TestingT interfaces so assertions and client constructors work unchanged.
+type T interface {
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fail()
+	FailNow()
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Helper()
+	Log(args ...interface{})
+	Logf(format string, args ...interface{})
+	Name() string
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Test   string
+	Level  Level
+	Passed bool
+	// Enforced is set when the check's failure fails the suite
+	Enforced bool
+	Messages []string
+}
+
+// Recorder runs a suite's checks at their levels and collects the results for the report
+type Recorder struct {
+	// FailLevel is the lowest level whose failures fail the suite
+	FailLevel Level
+	// Strict names checks, by test name or by the last element of it, that fail the suite whatever their level
+	Strict map[string]bool
+	// Log receives a warning for every soft failure, so it is kept in the test log report
+	Log *testlog.Logger
+
+	mu      sync.Mutex
+	results []Result
+}
+
+// New returns a recorder that only lets BLOCKER checks fail the suite
+func New(log *testlog.Logger) *Recorder {
+	return &Recorder{FailLevel: Blocker, Strict: map[string]bool{}, Log: log}
+}
+
+// FromEnv returns a recorder configured by FailLevelEnv and StrictEnv
+func FromEnv(log *testlog.Logger) (*Recorder, error) {
+	recorder := New(log)
+
+	if raw := os.Getenv(FailLevelEnv); raw != "" {
+		level, err := ParseLevel(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", FailLevelEnv, err)
+		}
+		recorder.FailLevel = level
+	}
+	for _, name := range strings.Split(os.Getenv(StrictEnv), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			recorder.Strict[name] = true
+		}
+	}
+
+	return recorder, nil
+}
+
+// enforced reports whether a failure of the named check at the level fails the suite
+func (r *Recorder) enforced(test string, level Level) bool {
+	if level >= r.FailLevel {
+		return true
+	}
+	return r.Strict[test] || r.Strict[test[strings.LastIndex(test, "/")+1:]]
+}
+
+// Run runs fn as a subtest at the given level. An enforced check runs against the subtest itself;
+// any other runs against a recorder, so its failures appear in the report without failing the suite.
+// It returns whether the check passed.
+func (r *Recorder) Run(t *testing.T, name string, level Level, fn func(t T)) bool {
+	passed := false
+	t.Run(name, func(st *testing.T) {
+		test := st.Name()
+
+		if r.enforced(test, level) {
+			defer func() {
+				passed = !st.Failed()
+				r.record(Result{Test: test, Level: level, Passed: passed, Enforced: true})
+			}()
+			fn(st)
+			return
+		}
+
+		soft := &softT{name: test, log: st.Logf}
+		soft.run(fn)
+		passed = !soft.failed
+		r.record(Result{Test: test, Level: level, Passed: passed, Messages: soft.messages})
+
+		if soft.failed {
+			st.Logf("%s check failed; not failing the suite", level)
+			if r.Log != nil {
+				r.Log.Warn("soft check failed", testlog.Fields{"check": test, "level": level.String(), "messages": soft.messages})
+			}
+		}
+	})
+	return passed
+}
+
+func (r *Recorder) record(result Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, result)
+}
+
+// Results returns the results of the checks run so far, in the order they finished
+func (r *Recorder) Results() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Result(nil), r.results...)
+}
+
+// SoftFailures returns the failed checks that did not fail the suite
+func (r *Recorder) SoftFailures() []Result {
+	var failures []Result
+	for _, result := range r.Results() {
+		if !result.Passed && !result.Enforced {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+// Report renders the checks section of the suite report: the pass counts per level, then every
+// soft failure, most severe first
+func (r *Recorder) Report() string {
+	results := r.Results()
+
+	var b strings.Builder
+	b.WriteString("Checks by level:\n")
+	for _, level := range []Level{Blocker, Warn, Info} {
+		total, passed := 0, 0
+		for _, result := range results {
+			if result.Level == level {
+				total++
+				if result.Passed {
+					passed++
+				}
+			}
+		}
+		if total > 0 {
+			fmt.Fprintf(&b, "  %-8s %d/%d passed\n", level, passed, total)
+		}
+	}
+
+	failures := r.SoftFailures()
+	sort.SliceStable(failures, func(i, j int) bool { return failures[i].Level > failures[j].Level })
+	if len(failures) == 0 {
+		b.WriteString("Soft failures: none\n")
+	} else {
+		b.WriteString("Soft failures (not failing the suite):\n")
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(&b, "  [%s] %s\n", failure.Level, failure.Test)
+		for _, message := range failure.Messages {
+			fmt.Fprintf(&b, "    %s\n", strings.ReplaceAll(strings.TrimSpace(message), "\n", "\n    "))
+		}
+	}
+
+	return b.String()
+}
+
+// softT records failures instead of failing the test; FailNow ends only the check's goroutine
+type softT struct {
+	name     string
+	log      func(format string, args ...interface{})
+	mu       sync.Mutex
+	failed   bool
+	messages []string
+}
+
+func (s *softT) run(fn func(t T)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(s)
+	}()
+	<-done
+}
+
+func (s *softT) fail(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = true
+	if message != "" {
+		s.messages = append(s.messages, message)
+	}
+}
+
+func (s *softT) Error(args ...interface{}) { s.fail(fmt.Sprint(args...)) }
+func (s *softT) Errorf(format string, args ...interface{}) {
+	s.fail(fmt.Sprintf(format, args...))
+}
+func (s *softT) Fail()    { s.fail("") }
+func (s *softT) FailNow() { s.fail(""); runtime.Goexit() }
+func (s *softT) Fatal(args ...interface{}) {
+	s.fail(fmt.Sprint(args...))
+	runtime.Goexit()
+}
+func (s *softT) Fatalf(format string, args ...interface{}) {
+	s.fail(fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+func (s *softT) Helper()                                 {}
+func (s *softT) Log(args ...interface{})                 { s.log("%s", fmt.Sprint(args...)) }
+func (s *softT) Logf(format string, args ...interface{}) { s.log(format, args...) }
+func (s *softT) Name() string                            { return s.name }
@@ -0,0 +1,166 @@
+// Package clock is the time source of the polling and waiting helpers. The helpers read the time
+// and sleep through Default, so a unit test can swap in a Fake and step a wait loop through its
+// timeout without waiting for it. The package also widens query windows by the skew the runner's
+// clock may have against AWS, so log, metric and finding queries bounded by a time the runner took
+// do not miss events AWS stamped a little earlier.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// Default is the clock the helpers use. Tests that replace it must not run in parallel with tests
+// that expect real time.
+var Default Clock = Real()
+
+// Real returns the system clock
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Fake is a clock that only moves when Advance is called. Sleep and After block until the clock has
+// been advanced past their deadline.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	blocked *sync.Cond
+}
+
+type waiter struct {
+	until time.Time
+	fire  chan time.Time
+}
+
+// NewFake returns a Fake set to start
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.blocked = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since implements Clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep implements Clock
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After implements Clock
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fire := make(chan time.Time, 1)
+	if d <= 0 {
+		fire <- f.now
+		return fire
+	}
+	f.waiters = append(f.waiters, waiter{until: f.now.Add(d), fire: fire})
+	f.blocked.Broadcast()
+	return fire
+}
+
+// Advance moves the clock forward and releases the sleepers whose deadline it passed, earliest first
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].until.Before(f.waiters[j].until) })
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.until.After(f.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.fire <- f.now
+	}
+	f.waiters = remaining
+}
+
+// BlockUntil waits until n goroutines are sleeping on the clock, so a test advances it only once
+// the code under test has reached its wait
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.blocked.Wait()
+	}
+}
+
+// Sleepers returns how many goroutines are sleeping on the clock
+func (f *Fake) Sleepers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// Instant is a clock whose sleeps return at once, moving its time forward by the duration slept. It
+// runs a wait loop through to its end without delay, e.g. against replayed responses.
+type Instant struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewInstant returns an Instant set to start
+func NewInstant(start time.Time) *Instant {
+	return &Instant{now: start}
+}
+
+// Now implements Clock
+func (i *Instant) Now() time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.now
+}
+
+// Since implements Clock
+func (i *Instant) Since(t time.Time) time.Duration {
+	return i.Now().Sub(t)
+}
+
+// Sleep implements Clock
+func (i *Instant) Sleep(d time.Duration) {
+	<-i.After(d)
+}
+
+// After implements Clock
+func (i *Instant) After(d time.Duration) <-chan time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if d > 0 {
+		i.now = i.now.Add(d)
+	}
+	fire := make(chan time.Time, 1)
+	fire <- i.now
+	return fire
+}
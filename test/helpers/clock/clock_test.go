@@ -0,0 +1,114 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// fired returns the time sent on the channel, or false when nothing was sent yet
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		after   time.Duration
+		advance []time.Duration
+		fires   bool
+		at      time.Time
+	}{
+		{name: "not yet due", after: time.Minute, advance: []time.Duration{59 * time.Second}, fires: false},
+		{name: "exactly due", after: time.Minute, advance: []time.Duration{time.Minute}, fires: true, at: start.Add(time.Minute)},
+		{name: "past due", after: time.Minute, advance: []time.Duration{90 * time.Second}, fires: true, at: start.Add(90 * time.Second)},
+		{name: "due over several steps", after: time.Minute, advance: []time.Duration{30 * time.Second, 30 * time.Second}, fires: true, at: start.Add(time.Minute)},
+		{name: "zero duration", after: 0, fires: true, at: start},
+		{name: "negative duration", after: -time.Second, fires: true, at: start},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFake(start)
+			ch := fake.After(test.after)
+			for _, d := range test.advance {
+				fake.Advance(d)
+			}
+
+			at, ok := fired(ch)
+			require.Equal(t, test.fires, ok)
+			if ok {
+				assert.Equal(t, test.at, at)
+				assert.Zero(t, fake.Sleepers())
+			}
+		})
+	}
+}
+
+func TestFakeAdvanceReleasesEarliestFirst(t *testing.T) {
+	fake := NewFake(start)
+	late := fake.After(2 * time.Minute)
+	early := fake.After(time.Minute)
+	require.Equal(t, 2, fake.Sleepers())
+
+	fake.Advance(time.Minute)
+	_, ok := fired(early)
+	assert.True(t, ok, "the earlier sleeper must be released")
+	_, ok = fired(late)
+	assert.False(t, ok, "the later sleeper must keep sleeping")
+	assert.Equal(t, 1, fake.Sleepers())
+
+	fake.Advance(time.Minute)
+	_, ok = fired(late)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(2*time.Minute), fake.Now())
+	assert.Equal(t, 2*time.Minute, fake.Since(start))
+}
+
+func TestFakeSleep(t *testing.T) {
+	fake := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		fake.Sleep(time.Hour)
+		close(done)
+	}()
+
+	fake.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("Sleep returned before the clock was advanced")
+	default:
+	}
+
+	fake.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return once the clock was advanced past it")
+	}
+}
+
+func TestInstant(t *testing.T) {
+	instant := NewInstant(start)
+
+	instant.Sleep(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), instant.Now())
+
+	at, ok := fired(instant.After(30 * time.Second))
+	require.True(t, ok)
+	assert.Equal(t, start.Add(90*time.Second), at)
+
+	// Negative durations fire without moving the clock
+	at, ok = fired(instant.After(-time.Second))
+	require.True(t, ok)
+	assert.Equal(t, start.Add(90*time.Second), at)
+	assert.Equal(t, 90*time.Second, instant.Since(start))
+}
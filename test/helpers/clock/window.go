@@ -0,0 +1,95 @@
+package clock
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSkew is how far the runner's clock is assumed to be off from AWS when nothing measured it.
+// CI runners sync with NTP, so a minute leaves room for AWS's own timestamps, which are taken when a
+// service records an event rather than when the request was sent.
+const DefaultSkew = time.Minute
+
+// skew is the tolerance query windows are widened by, in nanoseconds. Parallel tests may calibrate
+// it, so it is only read and written atomically.
+var skew = int64(DefaultSkew)
+
+// Skew returns the tolerance query windows are widened by
+func Skew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&skew))
+}
+
+// SetSkew raises the tolerance to a measured offset between the runner and AWS plus DefaultSkew. It
+// never lowers it, so tests calibrating in parallel keep the largest offset any of them saw.
+func SetSkew(offset time.Duration) {
+	if offset < 0 {
+		offset = -offset
+	}
+	tolerance := int64(offset + DefaultSkew)
+	for {
+		current := atomic.LoadInt64(&skew)
+		if tolerance <= current || atomic.CompareAndSwapInt64(&skew, current, tolerance) {
+			return
+		}
+	}
+}
+
+// Tolerant returns the start of a query window that begins at t, moved back by the skew tolerance
+func Tolerant(t time.Time) time.Time {
+	return t.Add(-Skew())
+}
+
+// Window is a span of time. A zero End leaves the window open until now.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Anchor opens a window at the current time. Tests take it before they act, and bound every later
+// log, metric or finding query by it.
+func Anchor() Window {
+	return Window{Start: Default.Now()}
+}
+
+// Since opens a window at start
+func Since(start time.Time) Window {
+	return Window{Start: start}
+}
+
+// Close returns the window ended at the current time
+func (w Window) Close() Window {
+	if w.End.IsZero() {
+		w.End = Default.Now()
+	}
+	return w
+}
+
+// Bounds returns the window widened by the skew tolerance on both ends, as AWS queries should use
+// it. An open window ends at the current time.
+func (w Window) Bounds() (time.Time, time.Time) {
+	end := w.End
+	if end.IsZero() {
+		end = Default.Now()
+	}
+	return Tolerant(w.Start), end.Add(Skew())
+}
+
+// Contains reports whether an AWS timestamp falls in the window, allowing for the skew tolerance
+func (w Window) Contains(t time.Time) bool {
+	start, end := w.Bounds()
+	return !t.Before(start) && !t.After(end)
+}
+
+// Duration returns how long the window spans; an open window spans until now
+func (w Window) Duration() time.Duration {
+	return w.Close().End.Sub(w.Start)
+}
+
+// String implements fmt.Stringer
+func (w Window) String() string {
+	if w.End.IsZero() {
+		return fmt.Sprintf("since %s", w.Start.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s to %s", w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,129 @@
+package clock
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useFake replaces Default with a Fake and resets the skew tolerance for the test
+func useFake(t *testing.T, now time.Time) *Fake {
+	fake := NewFake(now)
+	previous, previousSkew := Default, atomic.LoadInt64(&skew)
+	Default = fake
+	atomic.StoreInt64(&skew, int64(DefaultSkew))
+	t.Cleanup(func() {
+		Default = previous
+		atomic.StoreInt64(&skew, previousSkew)
+	})
+	return fake
+}
+
+func TestSetSkew(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []time.Duration
+		want    time.Duration
+	}{
+		{name: "uncalibrated", want: DefaultSkew},
+		{name: "runner ahead", offsets: []time.Duration{30 * time.Second}, want: 30*time.Second + DefaultSkew},
+		{name: "runner behind", offsets: []time.Duration{-30 * time.Second}, want: 30*time.Second + DefaultSkew},
+		{name: "never lowered", offsets: []time.Duration{2 * time.Minute, 10 * time.Second}, want: 2*time.Minute + DefaultSkew},
+		{name: "largest offset kept", offsets: []time.Duration{10 * time.Second, -3 * time.Minute}, want: 3*time.Minute + DefaultSkew},
+		{name: "no offset", offsets: []time.Duration{0}, want: DefaultSkew},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFake(t, start)
+			for _, offset := range test.offsets {
+				SetSkew(offset)
+			}
+			assert.Equal(t, test.want, Skew())
+			assert.Equal(t, start.Add(-test.want), Tolerant(start))
+		})
+	}
+}
+
+func TestWindowBounds(t *testing.T) {
+	now := start.Add(10 * time.Minute)
+	tests := []struct {
+		name      string
+		window    Window
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "open window ends now",
+			window:    Since(start),
+			wantStart: start.Add(-DefaultSkew),
+			wantEnd:   now.Add(DefaultSkew),
+		},
+		{
+			name:      "closed window",
+			window:    Window{Start: start, End: start.Add(5 * time.Minute)},
+			wantStart: start.Add(-DefaultSkew),
+			wantEnd:   start.Add(5*time.Minute + DefaultSkew),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFake(t, now)
+			gotStart, gotEnd := test.window.Bounds()
+			assert.Equal(t, test.wantStart, gotStart)
+			assert.Equal(t, test.wantEnd, gotEnd)
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	window := Window{Start: start, End: start.Add(5 * time.Minute)}
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{name: "inside", at: start.Add(time.Minute), want: true},
+		{name: "stamped before the start within the skew", at: start.Add(-DefaultSkew), want: true},
+		{name: "stamped before the skew", at: start.Add(-DefaultSkew - time.Second), want: false},
+		{name: "stamped after the end within the skew", at: start.Add(5*time.Minute + DefaultSkew), want: true},
+		{name: "stamped after the skew", at: start.Add(5*time.Minute + DefaultSkew + time.Second), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFake(t, start.Add(time.Hour))
+			assert.Equal(t, test.want, window.Contains(test.at))
+		})
+	}
+}
+
+func TestWindowCalibratedSkew(t *testing.T) {
+	useFake(t, start.Add(time.Hour))
+	SetSkew(2 * time.Minute)
+
+	window := Window{Start: start, End: start.Add(5 * time.Minute)}
+	assert.True(t, window.Contains(start.Add(-3*time.Minute)))
+	assert.False(t, window.Contains(start.Add(-3*time.Minute-time.Second)))
+}
+
+func TestWindowAnchorAndClose(t *testing.T) {
+	fake := useFake(t, start)
+
+	window := Anchor()
+	assert.Equal(t, start, window.Start)
+	assert.True(t, window.End.IsZero())
+	assert.Equal(t, "since 2024-05-01T12:00:00Z", window.String())
+
+	fake.Advance(3 * time.Minute)
+	assert.Equal(t, 3*time.Minute, window.Duration())
+
+	closed := window.Close()
+	assert.Equal(t, start.Add(3*time.Minute), closed.End)
+	assert.Equal(t, "2024-05-01T12:00:00Z to 2024-05-01T12:03:00Z", closed.String())
+
+	// Closing again keeps the original end
+	fake.Advance(time.Minute)
+	assert.Equal(t, closed.End, closed.Close().End)
+	assert.Equal(t, 3*time.Minute, closed.Duration())
+}
@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// TriageArtifact is where Terraform builds the triage package, relative to the root stack
+const TriageArtifact = "modules/lambda_triage/triage.zip"
+
+// ArtifactSHA256 returns the SHA-256 of a package, base64-encoded as Lambda reports CodeSha256
+func ArtifactSHA256(artifactPath string) (string, error) {
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", artifactPath, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", artifactPath, err)
+	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
+
+// AssertArtifactMatchesSource checks that the package holds exactly the given sources, keyed by
+// entry name, byte for byte as they are in the working tree
+func AssertArtifactMatchesSource(artifactPath string, sources map[string]string) error {
+	archive, err := zip.OpenReader(artifactPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", artifactPath, err)
+	}
+	defer archive.Close()
+
+	entries := map[string]*zip.File{}
+	for _, entry := range archive.File {
+		entries[entry.Name] = entry
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("%s has no entry %s", artifactPath, name)
+		}
+		delete(entries, name)
+
+		want, err := os.ReadFile(sources[name])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", sources[name], err)
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in %s: %w", name, artifactPath, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s in %s: %w", name, artifactPath, err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("%s in %s differs from %s", name, artifactPath, sources[name])
+		}
+	}
+
+	if len(entries) > 0 {
+		extra := make([]string, 0, len(entries))
+		for name := range entries {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		return fmt.Errorf("%s has unexpected entries %v", artifactPath, extra)
+	}
+	return nil
+}
+
+// AssertDeployedCodeMatches checks that the deployed function runs the package at artifactPath
+func AssertDeployedCodeMatches(sess *session.Session, functionName, artifactPath string) error {
+	want, err := ArtifactSHA256(artifactPath)
+	if err != nil {
+		return err
+	}
+
+	config, err := lambda.New(sess).GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+
+	if got := aws.StringValue(config.CodeSha256); got != want {
+		return fmt.Errorf("%s runs code with SHA-256 %s, but %s has %s", functionName, got, artifactPath, want)
+	}
+	return nil
+}
+
+// LambdaCodeSigningConfig returns the ARN of the function's code signing config, or "" when code
+// signing is not enabled for it
+func LambdaCodeSigningConfig(sess *session.Session, functionName string) (string, error) {
+	config, err := lambda.New(sess).GetFunctionCodeSigningConfig(&lambda.GetFunctionCodeSigningConfigInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get code signing config of %s: %w", functionName, err)
+	}
+	return aws.StringValue(config.CodeSigningConfigArn), nil
+}
+
+// AssertCodeSigningEnforced checks that the function has a code signing config that rejects
+// untrusted packages on deployment instead of only warning
+func AssertCodeSigningEnforced(sess *session.Session, functionName string) error {
+	configARN, err := LambdaCodeSigningConfig(sess, functionName)
+	if err != nil {
+		return err
+	}
+	if configARN == "" {
+		return fmt.Errorf("%s has no code signing config", functionName)
+	}
+
+	config, err := lambda.New(sess).GetCodeSigningConfig(&lambda.GetCodeSigningConfigInput{
+		CodeSigningConfigArn: aws.String(configARN),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get code signing config %s: %w", configARN, err)
+	}
+
+	policies := config.CodeSigningConfig.CodeSigningPolicies
+	if policies == nil || aws.StringValue(policies.UntrustedArtifactOnDeployment) != lambda.CodeSigningPolicyEnforce {
+		return fmt.Errorf("code signing config %s of %s does not enforce signatures on deployment", configARN, functionName)
+	}
+	if config.CodeSigningConfig.AllowedPublishers == nil || len(config.CodeSigningConfig.AllowedPublishers.SigningProfileVersionArns) == 0 {
+		return fmt.Errorf("code signing config %s of %s allows no signing profiles", configARN, functionName)
+	}
+	return nil
+}
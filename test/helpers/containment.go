@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// PartialFailureError is the error an IR execution fails with when evidence was stored but some of
+// the finding's resources could not be contained
+const PartialFailureError = "IR.PartialFailure"
+
+// RemediationFailure is an execution's state as the IR workflow routes it to the remediation DLQ:
+// the finding envelope, the containment results and the failure notice it published
+type RemediationFailure struct {
+	ExecutionOutput
+	Failure Notification `json:"failure"`
+}
+
+// WaitForFindingExecution waits until the IR execution started for the finding has finished and
+// returns it
+func WaitForFindingExecution(sess *session.Session, stateMachineArn, findingID string, timeout time.Duration) (*sfn.DescribeExecutionOutput, error) {
+	sfnClient := sfn.New(sess)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		executions, err := ListExecutions(sess, stateMachineArn, "", PageOptions{MaxPages: 5})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, execution := range executions {
+			described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+				ExecutionArn: execution.ExecutionArn,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe execution: %w", err)
+			}
+
+			input, err := ParseExecutionInput(aws.StringValue(described.Input))
+			if err != nil || input.Detail.ID != findingID {
+				continue
+			}
+			if aws.StringValue(described.Status) != sfn.ExecutionStatusRunning {
+				return described, nil
+			}
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return nil, fmt.Errorf("no finished IR execution for finding %s within %s", findingID, timeout)
+}
+
+// AssertPartialFailure asserts that the execution failed with PartialFailureError rather than
+// succeeding or failing for another reason
+func AssertPartialFailure(execution *sfn.DescribeExecutionOutput) error {
+	status, errorName := aws.StringValue(execution.Status), aws.StringValue(execution.Error)
+	if status != sfn.ExecutionStatusFailed || errorName != PartialFailureError {
+		return fmt.Errorf("execution %s ended %s (error %q), expected %s with %s",
+			aws.StringValue(execution.ExecutionArn), status, errorName, sfn.ExecutionStatusFailed, PartialFailureError)
+	}
+	return nil
+}
+
+// ReceiveRemediationFailure waits for the finding's entry in the remediation DLQ and deletes it.
+// Entries of other findings are left for their own tests.
+func ReceiveRemediationFailure(sess *session.Session, queueURL, findingID string, timeout time.Duration) (*RemediationFailure, error) {
+	sqsClient := sqs.New(sess)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		messages, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(10),
+			VisibilityTimeout:   aws.Int64(5),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive from %s: %w", queueURL, err)
+		}
+
+		for _, message := range messages.Messages {
+			var failure RemediationFailure
+			if err := json.Unmarshal([]byte(aws.StringValue(message.Body)), &failure); err != nil {
+				return nil, fmt.Errorf("unexpected remediation DLQ entry: %w", err)
+			}
+			if failure.Detail.ID != findingID {
+				continue
+			}
+
+			if _, err := sqsClient.DeleteMessage(&sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueURL),
+				ReceiptHandle: message.ReceiptHandle,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to delete message from %s: %w", queueURL, err)
+			}
+			return &failure, nil
+		}
+	}
+
+	return nil, fmt.Errorf("finding %s did not reach the remediation DLQ within %s", findingID, timeout)
+}
+
+// CompensationState is the state name that records what the workflow kept and undid after a later
+// step failed
+const CompensationState = "RecordCompensation"
+
+// CompensationRecord is what the workflow kept (Retained) and undid (RolledBack) after FailedState failed
+type CompensationRecord struct {
+	FailedState string   `json:"failed_state"`
+	Error       string   `json:"error"`
+	Cause       string   `json:"cause"`
+	Retained    []string `json:"retained"`
+	RolledBack  []string `json:"rolled_back"`
+}
+
+// CompensatedState returns the execution's state as it left CompensationState, with the effects of
+// the steps that ran before the failure, and the compensation record. It returns nil, nil, nil when
+// the execution never compensated.
+func CompensatedState(history *sfn.GetExecutionHistoryOutput) (*ExecutionOutput, *CompensationRecord, error) {
+	for _, event := range history.Events {
+		details := event.StateExitedEventDetails
+		if details == nil || aws.StringValue(details.Name) != CompensationState {
+			continue
+		}
+
+		var state struct {
+			ExecutionOutput
+			Compensation *CompensationRecord `json:"compensation"`
+		}
+		if err := json.Unmarshal([]byte(aws.StringValue(details.Output)), &state); err != nil {
+			return nil, nil, fmt.Errorf("unexpected %s output: %w", CompensationState, err)
+		}
+		if state.Compensation == nil {
+			return nil, nil, fmt.Errorf("%s output has no compensation record", CompensationState)
+		}
+		return &state.ExecutionOutput, state.Compensation, nil
+	}
+	return nil, nil, nil
+}
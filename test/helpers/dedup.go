@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// executionIDLength is how much of an execution name the finding ID may take
+const executionIDLength = 66
+
+// executionNameUnsafe matches the characters execution names do not allow
+var executionNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// TriageExecutionPrefix returns the name prefix of the executions the triage Lambda starts for a
+// finding. The finding ID is the correlation ID shared by every triage of the finding; each triage
+// appends its own timestamp. As in triage, characters execution names do not allow become '-', and
+// an ID too long to fit is cut and suffixed with a hash of the whole ID.
+func TriageExecutionPrefix(findingID string) string {
+	id := executionNameUnsafe.ReplaceAllString(findingID, "-")
+	if len(id) > executionIDLength {
+		sum := sha256.Sum256([]byte(findingID))
+		digest := hex.EncodeToString(sum[:])[:8]
+		id = id[:executionIDLength-len(digest)-1] + "-" + digest
+	}
+	return "IR-" + id + "-"
+}
+
+// CountTriageExecutions counts the executions the triage Lambda started for a finding. Executions
+// EventBridge starts directly are not named after the finding and are not counted.
+func CountTriageExecutions(sess *session.Session, stateMachineArn, findingID string) (int, error) {
+	executions, err := ListExecutions(sess, stateMachineArn, "", PageOptions{MaxPages: 10})
+	if err != nil {
+		return 0, err
+	}
+
+	prefix := TriageExecutionPrefix(findingID)
+	count := 0
+	for _, execution := range executions {
+		if strings.HasPrefix(aws.StringValue(execution.Name), prefix) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// AssertTriageExecutionCount waits for the finding's triage execution count to reach want and then
+// holds it for settle, so a suppressed update that would have added one more is caught too
+func AssertTriageExecutionCount(sess *session.Session, stateMachineArn, findingID string, want int, timeout, settle time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		count, err := CountTriageExecutions(sess, stateMachineArn, findingID)
+		if err != nil {
+			return err
+		}
+		if count >= want {
+			break
+		}
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("finding %s was triaged %d times within %s, expected %d", findingID, count, timeout, want)
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	clock.Default.Sleep(settle)
+	count, err := CountTriageExecutions(sess, stateMachineArn, findingID)
+	if err != nil {
+		return err
+	}
+	if count != want {
+		return fmt.Errorf("finding %s was triaged %d times, expected %d", findingID, count, want)
+	}
+
+	return nil
+}
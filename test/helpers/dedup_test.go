@@ -0,0 +1,34 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriageExecutionPrefix(t *testing.T) {
+	// The expected prefixes are what triage's execution_prefix returns for the same IDs
+	tests := []struct {
+		name      string
+		findingID string
+		want      string
+	}{
+		{name: "GuardDuty ID", findingID: "sample-finding-001", want: "IR-sample-finding-001-"},
+		{name: "unsafe characters", findingID: "a/b:c", want: "IR-a-b-c-"},
+		{
+			name:      "Security Hub ARN",
+			findingID: "arn:aws:securityhub:us-east-1:123456789012:subscription/aws-foundational-security-best-practices/v/1.0.0/EC2.19/finding/0f9a1b2c-3d4e-5f60-7182-93a4b5c6d7e8",
+			want:      "IR-arn-aws-securityhub-us-east-1-123456789012-subscription-a-a63fe86b-",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, TriageExecutionPrefix(test.findingID))
+		})
+	}
+
+	// Findings sharing a long ARN prefix must not share executions
+	assert.NotEqual(t,
+		TriageExecutionPrefix("arn:aws:securityhub:us-east-1:123456789012:subscription/aws-foundational-security-best-practices/finding/1"),
+		TriageExecutionPrefix("arn:aws:securityhub:us-east-1:123456789012:subscription/aws-foundational-security-best-practices/finding/2"))
+}
@@ -0,0 +1,210 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/arns"
+)
+
+// StackNames holds the names of stack resources that tests address directly
+type StackNames struct {
+	LambdaRoleName            string
+	StepFunctionsRoleName     string
+	LambdaLogGroupName        string
+	StepFunctionsLogGroupName string
+	FlowLogsLogGroupName      string
+	RuleName                  string
+	QuarantineSGID            string
+}
+
+// ResolveStackNames reads resource names from Terraform outputs, falling back to a lookup by the
+// stack's tags for outputs that are missing (e.g. when testing an older deployment)
+func ResolveStackNames(t testing.TestingT, terraformOptions *terraform.Options, sess *session.Session) (StackNames, error) {
+	output := func(key string) string {
+		value, err := terraform.OutputE(t, terraformOptions, key)
+		if err != nil {
+			return ""
+		}
+		return value
+	}
+
+	names := StackNames{
+		LambdaRoleName:            output("iam_lambda_role_name"),
+		StepFunctionsRoleName:     output("iam_stepfn_role_name"),
+		LambdaLogGroupName:        output("lambda_log_group_name"),
+		StepFunctionsLogGroupName: output("stepfn_log_group_name"),
+		FlowLogsLogGroupName:      output("quarantine_flow_logs_log_group_name"),
+		QuarantineSGID:            output("network_quarantine_sg_id"),
+	}
+
+	if rules, err := terraform.OutputListE(t, terraformOptions, "eventbridge_rule_names"); err == nil && len(rules) > 0 {
+		names.RuleName = rules[0]
+	}
+
+	tags := stackTags(terraformOptions)
+
+	var err error
+	if names.LambdaRoleName == "" {
+		if names.LambdaRoleName, err = FindRoleByTags(sess, tags, "lambda-triage"); err != nil {
+			return names, err
+		}
+	}
+	if names.StepFunctionsRoleName == "" {
+		if names.StepFunctionsRoleName, err = FindRoleByTags(sess, tags, "stepfn-ir"); err != nil {
+			return names, err
+		}
+	}
+	if names.LambdaLogGroupName == "" {
+		if names.LambdaLogGroupName, err = findTaggedResourceName(sess, "logs:log-group", tags, "/aws/lambda/"); err != nil {
+			return names, err
+		}
+	}
+	if names.StepFunctionsLogGroupName == "" {
+		if names.StepFunctionsLogGroupName, err = findTaggedResourceName(sess, "logs:log-group", tags, "/aws/states/"); err != nil {
+			return names, err
+		}
+	}
+	if names.FlowLogsLogGroupName == "" {
+		// Deployments that predate quarantine flow logs have no such log group
+		names.FlowLogsLogGroupName, _ = findTaggedResourceName(sess, "logs:log-group", tags, "quarantine-flow-logs")
+	}
+	if names.RuleName == "" {
+		if names.RuleName, err = findTaggedResourceName(sess, "events:rule", tags, "guardduty-finding"); err != nil {
+			return names, err
+		}
+	}
+
+	return names, nil
+}
+
+// stackTags returns the tags variable passed to the stack
+func stackTags(terraformOptions *terraform.Options) map[string]string {
+	tags := map[string]string{}
+
+	switch value := terraformOptions.Vars["tags"].(type) {
+	case map[string]string:
+		for key, tag := range value {
+			tags[key] = tag
+		}
+	case map[string]interface{}:
+		for key, tag := range value {
+			tags[key] = fmt.Sprint(tag)
+		}
+	}
+
+	return tags
+}
+
+// FindTaggedResourceARNs returns ARNs of resources of the given type (e.g. "logs:log-group") carrying all tags
+func FindTaggedResourceARNs(sess *session.Session, resourceType string, tags map[string]string) ([]string, error) {
+	taggingClient := resourcegroupstaggingapi.New(sess)
+
+	var filters []*resourcegroupstaggingapi.TagFilter
+	for key, value := range tags {
+		filters = append(filters, &resourcegroupstaggingapi.TagFilter{
+			Key:    aws.String(key),
+			Values: []*string{aws.String(value)},
+		})
+	}
+
+	var arns []string
+	err := taggingClient.GetResourcesPages(&resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []*string{aws.String(resourceType)},
+		TagFilters:          filters,
+	}, func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
+		for _, mapping := range page.ResourceTagMappingList {
+			arns = append(arns, aws.StringValue(mapping.ResourceARN))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s resources by tag: %w", resourceType, err)
+	}
+
+	return arns, nil
+}
+
+// findTaggedResourceName returns the name of the single tagged resource whose name contains the hint
+func findTaggedResourceName(sess *session.Session, resourceType string, tags map[string]string, hint string) (string, error) {
+	resourceARNs, err := FindTaggedResourceARNs(sess, resourceType, tags)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, resourceArn := range resourceARNs {
+		parsed, err := arns.Parse(resourceArn)
+		if err != nil {
+			continue
+		}
+
+		// Resource is "log-group:<name>" or "rule/<name>"
+		name := arns.Name(parsed)
+		if strings.Contains(name, hint) {
+			matches = append(matches, name)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", fmt.Errorf("expected one %s tagged %v matching %q, found %d", resourceType, tags, hint, len(matches))
+	}
+
+	return matches[0], nil
+}
+
+// FindRoleByTags returns the name of the single IAM role carrying all tags whose name contains the hint.
+// IAM roles are not indexed by the tagging API, so roles are listed and filtered by name first.
+func FindRoleByTags(sess *session.Session, tags map[string]string, hint string) (string, error) {
+	iamClient := iam.New(sess)
+
+	var candidates []string
+	err := iamClient.ListRolesPages(&iam.ListRolesInput{}, func(page *iam.ListRolesOutput, lastPage bool) bool {
+		for _, role := range page.Roles {
+			if strings.Contains(aws.StringValue(role.RoleName), hint) {
+				candidates = append(candidates, aws.StringValue(role.RoleName))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list IAM roles: %w", err)
+	}
+
+	var matches []string
+	for _, roleName := range candidates {
+		roleTags, err := iamClient.ListRoleTags(&iam.ListRoleTagsInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return "", fmt.Errorf("failed to list tags for role %s: %w", roleName, err)
+		}
+
+		actual := map[string]string{}
+		for _, tag := range roleTags.Tags {
+			actual[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+
+		matched := true
+		for key, value := range tags {
+			if actual[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, roleName)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", fmt.Errorf("expected one IAM role tagged %v matching %q, found %d", tags, hint, len(matches))
+	}
+
+	return matches[0], nil
+}
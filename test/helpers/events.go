@@ -3,6 +3,8 @@ package helpers
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
 )
 
 // GuardDutyFinding represents a GuardDuty finding event
@@ -12,6 +14,12 @@ type GuardDutyFinding struct {
 	Type     string                 `json:"type"`
 	Resource map[string]interface{} `json:"resource"`
 	Details  map[string]interface{} `json:"details,omitempty"`
+	// Service is GuardDuty's service block, e.g. the action with the remote IP it involved
+	Service map[string]interface{} `json:"service,omitempty"`
+	// ARN identifies the finding in Security Hub; findings without one are not resolved there
+	ARN string `json:"arn,omitempty"`
+	// AccountID is the account the finding is about, a member account's in org mode
+	AccountID string `json:"accountId,omitempty"`
 }
 
 // SampleGuardDutyEvents provides realistic GuardDuty finding samples
@@ -112,20 +120,25 @@ var SampleGuardDutyEvents = map[string]GuardDutyFinding{
 	},
 }
 
-// GetSampleEventBySeverity returns a sample event for the specified severity
-func GetSampleEventBySeverity(severity string) (GuardDutyFinding, error) {
-	switch severity {
-	case "HIGH":
-		return SampleGuardDutyEvents["high-severity-ssh-brute-force"], nil
-	case "CRITICAL":
-		return SampleGuardDutyEvents["critical-severity-port-scan"], nil
-	case "MEDIUM":
-		return SampleGuardDutyEvents["medium-severity-suspicious-login"], nil
-	case "LOW":
-		return SampleGuardDutyEvents["low-severity-info-finding"], nil
-	default:
-		return GuardDutyFinding{}, fmt.Errorf("unknown severity: %s", severity)
+// sampleEventsByLabel names the sample event of each severity label
+var sampleEventsByLabel = map[severity.Label]string{
+	severity.Critical: "critical-severity-port-scan",
+	severity.High:     "high-severity-ssh-brute-force",
+	severity.Medium:   "medium-severity-suspicious-login",
+	severity.Low:      "low-severity-info-finding",
+}
+
+// GetSampleEventBySeverity returns a sample event for the specified severity label
+func GetSampleEventBySeverity(label string) (GuardDutyFinding, error) {
+	parsed, err := severity.ParseLabel(label)
+	if err != nil {
+		return GuardDutyFinding{}, err
 	}
+	name, ok := sampleEventsByLabel[parsed]
+	if !ok {
+		return GuardDutyFinding{}, fmt.Errorf("no sample event with severity %s", parsed)
+	}
+	return SampleGuardDutyEvents[name], nil
 }
 
 // GenerateEventBridgeEvent creates a full EventBridge event from a GuardDuty finding
@@ -144,6 +157,15 @@ func GenerateEventBridgeEvent(finding GuardDutyFinding) (map[string]interface{},
 	if finding.Details != nil {
 		event["detail"].(map[string]interface{})["details"] = finding.Details
 	}
+	if finding.ARN != "" {
+		event["detail"].(map[string]interface{})["arn"] = finding.ARN
+	}
+	if finding.Service != nil {
+		event["detail"].(map[string]interface{})["service"] = finding.Service
+	}
+	if finding.AccountID != "" {
+		event["detail"].(map[string]interface{})["accountId"] = finding.AccountID
+	}
 
 	return event, nil
 }
@@ -163,12 +185,12 @@ func GenerateEventBridgeEventJSON(finding GuardDutyFinding) (string, error) {
 	return string(jsonBytes), nil
 }
 
-// GetEventsBySeverityRange returns events within a severity range
-func GetEventsBySeverityRange(minSeverity, maxSeverity float64) []GuardDutyFinding {
+// GetEventsBySeverityRange returns events within a severity range, inclusive
+func GetEventsBySeverityRange(minSeverity, maxSeverity severity.Score) []GuardDutyFinding {
 	var results []GuardDutyFinding
 
 	for _, finding := range SampleGuardDutyEvents {
-		if finding.Severity >= minSeverity && finding.Severity <= maxSeverity {
+		if severity.FromGuardDuty(finding.Severity).Between(minSeverity, maxSeverity) {
 			results = append(results, finding)
 		}
 	}
@@ -0,0 +1,311 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/testlog"
+)
+
+// EventuallyInterval is how long EventuallyAssert waits between attempts
+var EventuallyInterval = 10 * time.Second
+
+// Bounds of what a failure captures, so the report stays readable
+const (
+	failureLogEvents      = 50
+	failureHistoryEvents  = 30
+	failureDLQMessages    = 10
+	failureDLQBodyExcerpt = 500
+)
+
+// FailureContext says where EventuallyAssert looks for the pipeline's state once an assertion has
+// given up
+type FailureContext struct {
+	Session *session.Session
+	// Log receives the captured context, so it lands in the test's JSON report as well
+	Log             *testlog.Logger
+	LambdaLogGroup  string
+	StateMachineArn string
+	DLQURLs         []string
+	// Window bounds the Lambda logs; it is opened when the context is registered
+	Window clock.Window
+}
+
+// FailureContextFromOutputs builds the context from the stack's outputs as returned by
+// terraform.OutputAll. Outputs that are empty because a feature is off are skipped.
+func FailureContextFromOutputs(sess *session.Session, log *testlog.Logger, outputs map[string]interface{}) FailureContext {
+	value := func(key string) string {
+		s, _ := outputs[key].(string)
+		return s
+	}
+
+	ctx := FailureContext{
+		Session:         sess,
+		Log:             log,
+		LambdaLogGroup:  value("lambda_log_group_name"),
+		StateMachineArn: value("stepfn_ir_state_machine_arn"),
+	}
+	for _, key := range []string{"eventbridge_dlq_url", "lambda_triage_buffer_dlq_url", "stepfn_ir_remediation_dlq_url"} {
+		if url := value(key); url != "" {
+			ctx.DLQURLs = append(ctx.DLQURLs, url)
+		}
+	}
+	return ctx
+}
+
+var (
+	failureContextsMu sync.Mutex
+	failureContexts   = map[string]FailureContext{}
+)
+
+// RegisterFailureContext makes EventuallyAssert capture the context for the test and its subtests
+// until the test ends
+func RegisterFailureContext(t *testing.T, ctx FailureContext) {
+	if ctx.Window.Start.IsZero() {
+		ctx.Window = clock.Anchor()
+	}
+
+	name := t.Name()
+	failureContextsMu.Lock()
+	failureContexts[name] = ctx
+	failureContextsMu.Unlock()
+
+	t.Cleanup(func() {
+		failureContextsMu.Lock()
+		delete(failureContexts, name)
+		failureContextsMu.Unlock()
+	})
+}
+
+// lookupFailureContext returns the context registered for the test or the nearest parent test
+func lookupFailureContext(name string) (FailureContext, bool) {
+	failureContextsMu.Lock()
+	defer failureContextsMu.Unlock()
+
+	for {
+		if ctx, ok := failureContexts[name]; ok {
+			return ctx, true
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return FailureContext{}, false
+		}
+		name = name[:i]
+	}
+}
+
+// attempt collects the failures of one run of an assertion closure. It is passed to assert and
+// require functions in place of the test, so a failed attempt does not fail the test.
+type attempt struct {
+	errors []string
+}
+
+type attemptStopped struct{}
+
+// Errorf implements require.TestingT
+func (a *attempt) Errorf(format string, args ...interface{}) {
+	a.errors = append(a.errors, fmt.Sprintf(format, args...))
+}
+
+// FailNow implements require.TestingT by ending the attempt
+func (a *attempt) FailNow() {
+	panic(attemptStopped{})
+}
+
+func runAttempt(fn func(c require.TestingT)) (a *attempt) {
+	a = &attempt{}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(attemptStopped); !ok {
+				panic(r)
+			}
+			if len(a.errors) == 0 {
+				a.errors = append(a.errors, "attempt stopped with FailNow")
+			}
+		}
+	}()
+	fn(a)
+	return a
+}
+
+// EventuallyAssert runs the assertion closure until it passes or the timeout runs out. The closure
+// asserts against the collector it is given instead of the test, e.g. assert.Equal(c, ...), and
+// require functions end just the attempt. When the last attempt still fails, the test fails with
+// its messages and, if a FailureContext is registered, with the recent Lambda logs, the history of
+// the latest execution and the messages waiting in the dead-letter queues.
+func EventuallyAssert(t *testing.T, fn func(c require.TestingT), timeout time.Duration) bool {
+	t.Helper()
+
+	deadline := clock.Default.Now().Add(timeout)
+	attempts := 0
+	for {
+		attempts++
+		last := runAttempt(fn)
+		if len(last.errors) == 0 {
+			return true
+		}
+		if !clock.Default.Now().Add(EventuallyInterval).Before(deadline) {
+			report := fmt.Sprintf("assertion still failing after %d attempts over %s:\n%s", attempts, timeout, strings.Join(last.errors, "\n"))
+			if ctx, ok := lookupFailureContext(t.Name()); ok {
+				report += "\n\n" + CaptureFailureContext(ctx)
+			}
+			t.Error(report)
+			return false
+		}
+		clock.Default.Sleep(EventuallyInterval)
+	}
+}
+
+// CaptureFailureContext renders the pipeline's recent state for a failure report and logs each part
+// to the context's logger. Parts that cannot be read say why instead.
+func CaptureFailureContext(ctx FailureContext) string {
+	sections := []struct {
+		title   string
+		capture func(FailureContext) ([]string, error)
+	}{
+		{"Lambda logs", captureLambdaLogs},
+		{"Latest execution", captureLatestExecution},
+		{"Dead-letter queues", captureDLQs},
+	}
+
+	var b strings.Builder
+	b.WriteString("Pipeline context:")
+	for _, section := range sections {
+		lines, err := section.capture(ctx)
+		if err != nil {
+			lines = []string{"unavailable: " + err.Error()}
+		}
+		if len(lines) == 0 {
+			lines = []string{"nothing to show"}
+		}
+		fmt.Fprintf(&b, "\n-- %s --\n  %s", section.title, strings.Join(lines, "\n  "))
+
+		if ctx.Log != nil {
+			ctx.Log.Error("failure context", testlog.Fields{"section": section.title, "lines": lines})
+		}
+	}
+	return b.String()
+}
+
+// captureLambdaLogs returns the last triage log events in the context's window
+func captureLambdaLogs(ctx FailureContext) ([]string, error) {
+	if ctx.LambdaLogGroup == "" {
+		return nil, nil
+	}
+
+	start, end := ctx.Window.Bounds()
+	var lines []string
+	omitted := 0
+	err := cloudwatchlogs.New(ctx.Session).FilterLogEventsPages(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(ctx.LambdaLogGroup),
+		StartTime:    aws.Int64(start.UnixMilli()),
+		EndTime:      aws.Int64(end.UnixMilli()),
+	}, func(page *cloudwatchlogs.FilterLogEventsOutput, _ bool) bool {
+		for _, event := range page.Events {
+			timestamp := time.UnixMilli(aws.Int64Value(event.Timestamp)).UTC().Format(time.RFC3339)
+			lines = append(lines, timestamp+" "+strings.TrimSpace(aws.StringValue(event.Message)))
+			if len(lines) > failureLogEvents {
+				lines = lines[1:]
+				omitted++
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ctx.LambdaLogGroup, err)
+	}
+
+	if omitted > 0 {
+		lines = append([]string{fmt.Sprintf("(%d earlier events omitted)", omitted)}, lines...)
+	}
+	return lines, nil
+}
+
+// captureLatestExecution returns the newest execution's status and the tail of its history
+func captureLatestExecution(ctx FailureContext) ([]string, error) {
+	if ctx.StateMachineArn == "" {
+		return nil, nil
+	}
+
+	executions, err := ListExecutions(ctx.Session, ctx.StateMachineArn, "", PageOptions{MaxItems: 1})
+	if err != nil || len(executions) == 0 {
+		return nil, err
+	}
+	execution := executions[0]
+
+	history, err := GetStepFunctionExecutionHistory(ctx.Session, aws.StringValue(execution.ExecutionArn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the history of %s: %w", aws.StringValue(execution.Name), err)
+	}
+
+	lines := []string{fmt.Sprintf("%s %s, started %s", aws.StringValue(execution.Name), aws.StringValue(execution.Status),
+		aws.TimeValue(execution.StartDate).UTC().Format(time.RFC3339))}
+	events := history.Events
+	if len(events) > failureHistoryEvents {
+		lines = append(lines, fmt.Sprintf("(%d earlier events omitted)", len(events)-failureHistoryEvents))
+		events = events[len(events)-failureHistoryEvents:]
+	}
+	for _, event := range events {
+		lines = append(lines, describeHistoryEvent(event))
+	}
+	return lines, nil
+}
+
+// describeHistoryEvent renders an execution history event on one line, with the state it concerns
+// and the error of a failure
+func describeHistoryEvent(event *sfn.HistoryEvent) string {
+	line := fmt.Sprintf("#%d %s", aws.Int64Value(event.Id), aws.StringValue(event.Type))
+	switch {
+	case event.StateEnteredEventDetails != nil:
+		line += " " + aws.StringValue(event.StateEnteredEventDetails.Name)
+	case event.StateExitedEventDetails != nil:
+		line += " " + aws.StringValue(event.StateExitedEventDetails.Name)
+	case event.TaskFailedEventDetails != nil:
+		line += fmt.Sprintf(": %s %s", aws.StringValue(event.TaskFailedEventDetails.Error), aws.StringValue(event.TaskFailedEventDetails.Cause))
+	case event.LambdaFunctionFailedEventDetails != nil:
+		line += fmt.Sprintf(": %s %s", aws.StringValue(event.LambdaFunctionFailedEventDetails.Error), aws.StringValue(event.LambdaFunctionFailedEventDetails.Cause))
+	case event.ExecutionFailedEventDetails != nil:
+		line += fmt.Sprintf(": %s %s", aws.StringValue(event.ExecutionFailedEventDetails.Error), aws.StringValue(event.ExecutionFailedEventDetails.Cause))
+	}
+	return line
+}
+
+// captureDLQs peeks at the messages in each dead-letter queue. The messages are received with a zero
+// visibility timeout, so they stay in the queue for the test's own checks.
+func captureDLQs(ctx FailureContext) ([]string, error) {
+	sqsClient := sqs.New(ctx.Session)
+
+	var lines []string
+	for _, url := range ctx.DLQURLs {
+		received, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(url),
+			MaxNumberOfMessages: aws.Int64(failureDLQMessages),
+			VisibilityTimeout:   aws.Int64(0),
+		})
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: failed to receive: %v", url, err))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %d messages", url, len(received.Messages)))
+		for _, message := range received.Messages {
+			body := aws.StringValue(message.Body)
+			if len(body) > failureDLQBodyExcerpt {
+				body = body[:failureDLQBodyExcerpt] + "..."
+			}
+			lines = append(lines, "  "+body)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,241 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// ExecutionInput is the finding envelope the triage Lambda passes to the IR state machine
+type ExecutionInput struct {
+	Version    string           `json:"version,omitempty"`
+	ID         string           `json:"id,omitempty"`
+	DetailType string           `json:"detail-type"`
+	Source     string           `json:"source"`
+	Account    string           `json:"account,omitempty"`
+	Time       string           `json:"time,omitempty"`
+	Region     string           `json:"region,omitempty"`
+	Resources  []string         `json:"resources,omitempty"`
+	Detail     GuardDutyFinding `json:"detail"`
+	// Targets are the "kind:identifier" resources triage resolved, one containment branch each
+	Targets []string `json:"targets,omitempty"`
+	// SeverityLabel is the label triage routed the finding by
+	SeverityLabel string `json:"severity_label,omitempty"`
+	// FindingAccount is the account the finding is about, a member account's in org mode
+	FindingAccount string `json:"finding_account,omitempty"`
+	// Recurrence is set when triage escalated the finding as a recurrence
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+}
+
+// ExecutionOutput is the IR state machine output: the input envelope plus one result per IR step.
+// Evidence, Notification, SecurityHub and GuardDuty are the messages the steps record; what
+// containment did is in Containment.
+type ExecutionOutput struct {
+	ExecutionInput
+	Evidence string `json:"evidence"`
+	// Isolation is Containment.Summary, copied for responders reading the output
+	Isolation    string `json:"isolation"`
+	Notification string `json:"notification"`
+	// Resolution is set instead of SecurityHub and GuardDuty when the finding was left open because
+	// not every target was isolated
+	Resolution  string       `json:"resolution,omitempty"`
+	SecurityHub string       `json:"securityhub,omitempty"`
+	GuardDuty   string       `json:"guardduty,omitempty"`
+	Containment *Containment `json:"containment,omitempty"`
+}
+
+// Containment aggregates the results of the IsolateResource Map state, one per target. Failed,
+// Isolated, Recorded and NotifyOnly hold the results with that status. Summary is rendered for
+// people; check the results instead.
+type Containment struct {
+	Targets    []ContainmentResult `json:"targets"`
+	Failed     []ContainmentResult `json:"failed"`
+	Isolated   []ContainmentResult `json:"isolated"`
+	Recorded   []ContainmentResult `json:"recorded"`
+	NotifyOnly []ContainmentResult `json:"notify_only"`
+	Summary    string              `json:"summary"`
+}
+
+// Containment statuses of a target
+const (
+	ContainmentIsolated = "isolated"
+	ContainmentNotFound = "not-found"
+	ContainmentFailed   = "failed"
+	// ContainmentNotifyOnly is reported for EKS clusters, which are left to responders
+	ContainmentNotifyOnly = "notify-only"
+	// ContainmentRecorded is reported for targets of a kind no containment branch acts on, e.g.
+	// instances, whose interfaces are contained as eni: targets, or buckets
+	ContainmentRecorded = "recorded"
+)
+
+// containmentStatuses are the statuses a containment branch reports
+var containmentStatuses = map[string]bool{
+	ContainmentIsolated:   true,
+	ContainmentNotFound:   true,
+	ContainmentFailed:     true,
+	ContainmentNotifyOnly: true,
+	ContainmentRecorded:   true,
+}
+
+// ContainmentResult is the result of containing one target; Error and Cause are set when it failed
+type ContainmentResult struct {
+	Target  string `json:"target"`
+	Finding string `json:"finding"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Cause   string `json:"cause,omitempty"`
+	// Hosts are the container instances drained before an ECS task was stopped; none on Fargate
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// ContainedTargets returns the targets the execution contained, sorted
+func (o *ExecutionOutput) ContainedTargets() []string {
+	if o.Containment == nil {
+		return nil
+	}
+	targets := make([]string, 0, len(o.Containment.Targets))
+	for _, result := range o.Containment.Targets {
+		targets = append(targets, result.Target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// WithStatus returns the results of the targets with the status
+func (c *Containment) WithStatus(status string) []ContainmentResult {
+	var results []ContainmentResult
+	for _, result := range c.Targets {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Contained reports whether the finding counts as contained, so the workflow resolves and archives it:
+// a target was isolated and none was only recorded or left to responders
+func (c *Containment) Contained() bool {
+	return len(c.Isolated) > 0 && len(c.Recorded) == 0 && len(c.NotifyOnly) == 0
+}
+
+// Validate checks that every target reports a known status, that failed targets say why, and that
+// each status list holds exactly the targets with that status
+func (c *Containment) Validate() error {
+	for _, result := range c.Targets {
+		if result.Target == "" {
+			return fmt.Errorf("containment result for finding %q has no target", result.Finding)
+		}
+		if !containmentStatuses[result.Status] {
+			return fmt.Errorf("target %s has unknown containment status %q", result.Target, result.Status)
+		}
+		if result.Status == ContainmentFailed && result.Error == "" {
+			return fmt.Errorf("target %s failed containment without an error", result.Target)
+		}
+	}
+
+	for _, list := range []struct {
+		status  string
+		results []ContainmentResult
+	}{
+		{ContainmentFailed, c.Failed},
+		{ContainmentIsolated, c.Isolated},
+		{ContainmentRecorded, c.Recorded},
+		{ContainmentNotifyOnly, c.NotifyOnly},
+	} {
+		want := c.WithStatus(list.status)
+		if len(list.results) != len(want) {
+			return fmt.Errorf("containment lists %d %s targets, but %d of %d targets are %s", len(list.results), list.status, len(want), len(c.Targets), list.status)
+		}
+		for i := range want {
+			if list.results[i].Target != want[i].Target || list.results[i].Status != list.status {
+				return fmt.Errorf("containment lists %s (%s) as %s, expected %s", list.results[i].Target, list.results[i].Status, list.status, want[i].Target)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseExecutionInput unmarshals and validates a state machine input document
+func ParseExecutionInput(document string) (*ExecutionInput, error) {
+	var input ExecutionInput
+	if err := json.Unmarshal([]byte(document), &input); err != nil {
+		return nil, fmt.Errorf("execution input does not match schema: %w", err)
+	}
+
+	raw, err := requireFields([]byte(document), "source", "detail-type", "detail")
+	if err != nil {
+		return nil, fmt.Errorf("execution input: %w", err)
+	}
+	if _, err := requireFields(raw["detail"], "id", "severity", "type"); err != nil {
+		return nil, fmt.Errorf("execution input detail: %w", err)
+	}
+	if input.Detail.ID == "" {
+		return nil, fmt.Errorf("execution input detail has an empty finding id")
+	}
+
+	return &input, nil
+}
+
+// ParseExecutionOutput unmarshals and validates a state machine output document
+func ParseExecutionOutput(document string) (*ExecutionOutput, error) {
+	var output ExecutionOutput
+	if err := json.Unmarshal([]byte(document), &output); err != nil {
+		return nil, fmt.Errorf("execution output does not match schema: %w", err)
+	}
+
+	if _, err := requireFields([]byte(document), "evidence", "containment", "notification"); err != nil {
+		return nil, fmt.Errorf("execution output: %w", err)
+	}
+
+	for field, value := range map[string]string{
+		"evidence":     output.Evidence,
+		"notification": output.Notification,
+	} {
+		if value == "" {
+			return nil, fmt.Errorf("execution output has an empty %s block", field)
+		}
+	}
+	if err := output.Containment.Validate(); err != nil {
+		return nil, fmt.Errorf("execution output: %w", err)
+	}
+
+	// The output carries the original finding envelope forward
+	if _, err := ParseExecutionInput(document); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// AssertExecutionOutput asserts that a completed execution's output matches the IR output schema
+func AssertExecutionOutput(execution *sfn.DescribeExecutionOutput) error {
+	if execution == nil || execution.Output == nil {
+		return fmt.Errorf("execution has no output")
+	}
+
+	if _, err := ParseExecutionOutput(aws.StringValue(execution.Output)); err != nil {
+		return fmt.Errorf("execution %s: %w", aws.StringValue(execution.ExecutionArn), err)
+	}
+
+	return nil
+}
+
+// requireFields checks that a JSON object has non-null values for all fields and returns its raw members
+func requireFields(document []byte, fields ...string) (map[string]json.RawMessage, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(document, &raw); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+
+	for _, field := range fields {
+		value, ok := raw[field]
+		if !ok || string(value) == "null" {
+			return nil, fmt.Errorf("missing required field %q", field)
+		}
+	}
+
+	return raw, nil
+}
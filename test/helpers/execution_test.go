@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainmentValidate(t *testing.T) {
+	isolated := ContainmentResult{Target: "eni:eni-1", Finding: "f-1", Status: ContainmentIsolated}
+	recorded := ContainmentResult{Target: "bucket:evidence", Finding: "f-1", Status: ContainmentRecorded}
+	failed := ContainmentResult{Target: "eni:eni-2", Finding: "f-1", Status: ContainmentFailed, Error: "IR.NoQuarantineGroup"}
+	alsoFailed := ContainmentResult{Target: "eni:eni-3", Finding: "f-1", Status: ContainmentFailed, Error: "States.TaskFailed"}
+
+	tests := []struct {
+		name        string
+		containment Containment
+		wantErr     string
+	}{
+		{name: "no targets", containment: Containment{Targets: []ContainmentResult{}, Failed: []ContainmentResult{}}},
+		{
+			name:        "contained",
+			containment: Containment{Targets: []ContainmentResult{isolated, recorded}, Isolated: []ContainmentResult{isolated}, Recorded: []ContainmentResult{recorded}},
+		},
+		{
+			name:        "failures listed",
+			containment: Containment{Targets: []ContainmentResult{failed, isolated, alsoFailed}, Failed: []ContainmentResult{failed, alsoFailed}, Isolated: []ContainmentResult{isolated}},
+		},
+		{
+			name:        "failure not listed",
+			containment: Containment{Targets: []ContainmentResult{isolated, failed}, Isolated: []ContainmentResult{isolated}},
+			wantErr:     "containment lists 0 failed targets, but 1 of 2 targets are failed",
+		},
+		{
+			name:        "success listed as failed",
+			containment: Containment{Targets: []ContainmentResult{isolated}, Failed: []ContainmentResult{isolated}, Isolated: []ContainmentResult{isolated}},
+			wantErr:     "containment lists 1 failed targets, but 0 of 1 targets are failed",
+		},
+		{
+			name:        "isolation not listed",
+			containment: Containment{Targets: []ContainmentResult{isolated}},
+			wantErr:     "containment lists 0 isolated targets, but 1 of 1 targets are isolated",
+		},
+		{
+			name:        "recorded listed as notify-only",
+			containment: Containment{Targets: []ContainmentResult{recorded}, Recorded: []ContainmentResult{recorded}, NotifyOnly: []ContainmentResult{recorded}},
+			wantErr:     "containment lists 1 notify-only targets, but 0 of 1 targets are notify-only",
+		},
+		{
+			name:        "another target listed as failed",
+			containment: Containment{Targets: []ContainmentResult{failed, alsoFailed}, Failed: []ContainmentResult{alsoFailed, failed}},
+			wantErr:     "containment lists eni:eni-3 (failed) as failed, expected eni:eni-2",
+		},
+		{
+			name:        "unknown status",
+			containment: Containment{Targets: []ContainmentResult{{Target: "eni:eni-1", Status: "quarantined"}}},
+			wantErr:     `target eni:eni-1 has unknown containment status "quarantined"`,
+		},
+		{
+			name:        "failure without an error",
+			containment: Containment{Targets: []ContainmentResult{{Target: "eni:eni-1", Status: ContainmentFailed}}},
+			wantErr:     "target eni:eni-1 failed containment without an error",
+		},
+		{
+			name:        "no target",
+			containment: Containment{Targets: []ContainmentResult{{Finding: "f-1", Status: ContainmentIsolated}}},
+			wantErr:     `containment result for finding "f-1" has no target`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.containment.Validate()
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestContainmentContained(t *testing.T) {
+	isolated := []ContainmentResult{{Target: "eni:eni-1", Status: ContainmentIsolated}}
+	recorded := []ContainmentResult{{Target: "bucket:evidence", Status: ContainmentRecorded}}
+	notifyOnly := []ContainmentResult{{Target: "eks-cluster:prod", Status: ContainmentNotifyOnly}}
+
+	assert.False(t, (&Containment{}).Contained(), "nothing isolated")
+	assert.True(t, (&Containment{Isolated: isolated}).Contained())
+	assert.False(t, (&Containment{Isolated: isolated, Recorded: recorded}).Contained(), "a target only recorded")
+	assert.False(t, (&Containment{Isolated: isolated, NotifyOnly: notifyOnly}).Contained(), "a target left to responders")
+	assert.False(t, (&Containment{NotifyOnly: notifyOnly}).Contained(), "notify-only")
+}
+
+func TestParseExecutionOutput(t *testing.T) {
+	document := func(fields string) string {
+		return `{"source": "aws.guardduty", "detail-type": "GuardDuty Finding",
+		  "detail": {"id": "f-1", "severity": 8, "type": "UnauthorizedAccess:EC2/SSHBruteForce"}, ` + fields + `}`
+	}
+	const steps = `"evidence": "Evidence stored in S3", "notification": "Notification sent via SNS"`
+
+	output, err := ParseExecutionOutput(document(steps + `,
+	  "isolation": "1 of 2 resources isolated",
+	  "containment": {
+	    "targets": [
+	      {"target": "eni:eni-1", "finding": "f-1", "status": "isolated"},
+	      {"target": "bucket:evidence", "finding": "f-1", "status": "recorded"}
+	    ],
+	    "failed": [],
+	    "isolated": [{"target": "eni:eni-1", "finding": "f-1", "status": "isolated"}],
+	    "recorded": [{"target": "bucket:evidence", "finding": "f-1", "status": "recorded"}],
+	    "notify_only": [],
+	    "summary": "1 of 2 resources isolated"
+	  }`))
+	require.NoError(t, err)
+	require.NotNil(t, output.Containment)
+	assert.Equal(t, []string{"bucket:evidence", "eni:eni-1"}, output.ContainedTargets())
+	assert.Len(t, output.Containment.WithStatus(ContainmentIsolated), 1)
+	assert.False(t, output.Containment.Contained(), "a recorded target leaves the finding open")
+	assert.Empty(t, output.Containment.Failed)
+	assert.Equal(t, "f-1", output.Detail.ID)
+
+	tests := []struct {
+		name    string
+		fields  string
+		wantErr string
+	}{
+		{
+			name:    "no containment",
+			fields:  steps + `, "isolation": "0 of 0 resources isolated"`,
+			wantErr: `execution output: missing required field "containment"`,
+		},
+		{
+			name: "inconsistent containment",
+			fields: steps + `, "containment": {"targets": [
+			  {"target": "eni:eni-1", "finding": "f-1", "status": "failed", "error": "States.TaskFailed"}
+			], "failed": [], "summary": "0 of 1 resources isolated"}`,
+			wantErr: "execution output: containment lists 0 failed targets, but 1 of 1 targets are failed",
+		},
+		{
+			name:    "empty evidence",
+			fields:  `"evidence": "", "notification": "Notification sent via SNS", "containment": {"targets": []}`,
+			wantErr: "execution output has an empty evidence block",
+		},
+		{
+			name:    "containment not an object",
+			fields:  steps + `, "containment": "1 of 1 resources isolated"`,
+			wantErr: "execution output does not match schema",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseExecutionOutput(document(test.fields))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
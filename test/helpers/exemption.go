@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/sgmodel"
+)
+
+// ParseExemptionTag splits a key=value exemption tag into its key and value
+func ParseExemptionTag(tag string) (string, string, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("exemption tag %q is not of the form key=value", tag)
+	}
+	return key, value, nil
+}
+
+// WaitForEvidenceMetadata polls until triage has stored evidence for the finding and returns the
+// object's user metadata with lower-cased keys
+func WaitForEvidenceMetadata(sess *session.Session, bucketName, findingID string, timeout time.Duration) (map[string]string, error) {
+	object, err := WaitForEvidenceObject(sess, bucketName, EvidenceKey(findingID, ""), timeout)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(object.Metadata))
+	for name, value := range object.Metadata {
+		metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	return metadata, nil
+}
+
+// AssertNotQuarantined checks that triage neither tagged the instance for quarantine nor moved any
+// of its interfaces into the quarantine security group
+func AssertNotQuarantined(sess *session.Session, instanceID, quarantineSGID string) error {
+	tags, err := ec2.New(sess).DescribeTags(&ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: []*string{aws.String(instanceID)}},
+			{Name: aws.String("key"), Values: aws.StringSlice([]string{"GuardDutyFinding", "Quarantined"})},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe tags: %w", err)
+	}
+	if len(tags.Tags) > 0 {
+		tag := tags.Tags[0]
+		return fmt.Errorf("instance %s is tagged %s=%s", instanceID, aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+
+	interfaces, err := InstanceNetworkInterfaces(sess, instanceID)
+	if err != nil {
+		return err
+	}
+	for _, eni := range interfaces {
+		if sgmodel.GroupsOf(eni.Groups).Contains(quarantineSGID) {
+			return fmt.Errorf("interface %s of instance %s is in the quarantine group", aws.StringValue(eni.NetworkInterfaceId), instanceID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsathena "github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/athena"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Formats the finding export can deliver, as in the finding_export_format variable
+const (
+	ExportFormatJSON    = "JSON"
+	ExportFormatParquet = "PARQUET"
+)
+
+// exportKeyPattern is the Firehose prefix of the finding export: findings/year/month/day/hour/object
+var exportKeyPattern = regexp.MustCompile(`^findings/(\d{4})/(\d{2})/(\d{2})/(\d{2})/[^/]+$`)
+
+// parquetMagic opens and closes every Parquet file
+var parquetMagic = []byte("PAR1")
+
+// ExportedObject is an object Firehose delivered to the analytics bucket
+type ExportedObject struct {
+	Key string
+	// Partition is the delivery hour encoded in the key
+	Partition time.Time
+}
+
+// ExportedFinding is a finding as Athena returns it from the export table
+type ExportedFinding struct {
+	ID        string
+	Type      string
+	Severity  float64
+	Partition time.Time
+}
+
+// ExportPartition parses the delivery hour out of an exported object's key
+func ExportPartition(key string) (time.Time, error) {
+	match := exportKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("%s is not under findings/year/month/day/hour/", key)
+	}
+	return time.Parse("2006/01/02/15", strings.Join(match[1:], "/"))
+}
+
+// WaitForExportedFinding waits for Firehose to deliver objects written after since and checks that
+// each of them is in an hourly partition no earlier than since and in the expected format. JSON
+// objects must hold one event per line, and the wait ends at the object carrying the finding.
+// Parquet objects are only checked for the file format, so the object returned is the first one
+// delivered; use QueryExportedFinding to check the finding itself.
+func WaitForExportedFinding(sess *session.Session, bucketName, findingID, format string, since time.Time, timeout time.Duration) (*ExportedObject, error) {
+	checked := map[string]bool{}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		objects, err := ListObjects(sess, bucketName, "findings/", PageOptions{}, func(obj *s3.Object) bool {
+			return !checked[aws.StringValue(obj.Key)] && aws.TimeValue(obj.LastModified).After(clock.Tolerant(since))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objects {
+			key := aws.StringValue(obj.Key)
+			checked[key] = true
+
+			partition, err := ExportPartition(key)
+			if err != nil {
+				return nil, err
+			}
+			// Firehose partitions by the hour it receives the record, in UTC
+			if partition.Before(clock.Tolerant(since).UTC().Truncate(time.Hour)) {
+				return nil, fmt.Errorf("%s was written after %s but is partitioned at %s", key, since.UTC().Format(time.RFC3339), partition.Format(time.RFC3339))
+			}
+
+			found, err := checkExportedObject(sess, bucketName, key, findingID, format)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				return &ExportedObject{Key: key, Partition: partition}, nil
+			}
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return nil, fmt.Errorf("finding %s was not exported to %s within %s", findingID, bucketName, timeout)
+}
+
+// checkExportedObject checks an object's format and reports whether it carries the finding, which
+// can only be told for JSON
+func checkExportedObject(sess *session.Session, bucketName, key, findingID, format string) (bool, error) {
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	defer object.Body.Close()
+
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	switch format {
+	case ExportFormatParquet:
+		if !bytes.HasPrefix(body, parquetMagic) || !bytes.HasSuffix(body, parquetMagic) {
+			return false, fmt.Errorf("%s is not a Parquet file", key)
+		}
+		return true, nil
+
+	case ExportFormatJSON:
+		found := false
+		lines := bufio.NewScanner(bytes.NewReader(body))
+		lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; lines.Scan(); line++ {
+			if len(bytes.TrimSpace(lines.Bytes())) == 0 {
+				continue
+			}
+			var event struct {
+				Detail struct {
+					ID string `json:"id"`
+				} `json:"detail"`
+			}
+			if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+				return false, fmt.Errorf("line %d of %s is not a JSON event, so records are not newline delimited: %w", line, key, err)
+			}
+			found = found || event.Detail.ID == findingID
+		}
+		return found, lines.Err()
+	}
+
+	return false, fmt.Errorf("unknown export format %q", format)
+}
+
+// QueryExportedFinding queries the export table through Athena until it returns the finding. The
+// table uses partition projection, so a new hour is queryable as soon as Firehose writes to it.
+func QueryExportedFinding(sess *session.Session, workgroup, database, table, findingID string, timeout time.Duration) (*ExportedFinding, error) {
+	athenaClient := awsathena.New(sess)
+
+	query := fmt.Sprintf(`SELECT detail.id, detail.type, detail.severity, year, month, day, hour FROM "%s"."%s" WHERE detail.id = ?`, database, table)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		rows, err := athena.Run(athenaClient, workgroup, query, []string{athena.String(findingID)}, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 {
+			return parseExportedFinding(rows[0])
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return nil, fmt.Errorf("finding %s was not returned from %s.%s within %s", findingID, database, table, timeout)
+}
+
+// parseExportedFinding reads a row of the QueryExportedFinding query
+func parseExportedFinding(row []string) (*ExportedFinding, error) {
+	if len(row) != 7 {
+		return nil, fmt.Errorf("expected 7 columns, got %d", len(row))
+	}
+	severity, err := strconv.ParseFloat(row[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse severity %q: %w", row[2], err)
+	}
+	partition, err := time.Parse("2006/01/02/15", strings.Join(row[3:], "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse partition %v: %w", row[3:], err)
+	}
+	return &ExportedFinding{ID: row[0], Type: row[1], Severity: severity, Partition: partition}, nil
+}
@@ -0,0 +1,249 @@
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the bundle's own files, next to the artifacts
+const (
+	ManifestName  = "manifest.json"
+	ChecksumsName = "SHA256SUMS"
+)
+
+// Kinds of artifact a bundle holds
+const (
+	KindEvidence         = "evidence"
+	KindEvidenceMetadata = "evidence-metadata"
+	KindExecution        = "execution"
+	KindCloudTrail       = "cloudtrail"
+	KindLogs             = "logs"
+	KindSnapshots        = "snapshots"
+)
+
+// Manifest describes a bundle: where its artifacts came from, the time window they cover and a
+// checksum of every one of them
+type Manifest struct {
+	FindingID       string    `json:"finding_id"`
+	ExportedAt      time.Time `json:"exported_at"`
+	EvidenceBucket  string    `json:"evidence_bucket"`
+	StateMachineArn string    `json:"state_machine_arn"`
+	// WindowStart and WindowEnd bound the CloudTrail slice and the log excerpt
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	// Resources are the targets triage resolved the finding to, as "kind:id"
+	Resources  []string `json:"resources"`
+	Executions []string `json:"executions"`
+	// Snapshots are the IDs of the EBS snapshots taken of the finding's resources
+	Snapshots []string   `json:"snapshots"`
+	Artifacts []Artifact `json:"artifacts"`
+	// Gaps are the artifacts that could not be collected, so the recipient knows what is missing
+	// rather than assuming it never existed
+	Gaps []Gap `json:"gaps,omitempty"`
+}
+
+// Artifact is one file of the bundle
+type Artifact struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Gap is an artifact that could not be collected
+type Gap struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// Bundle is a finding's artifacts with their manifest
+type Bundle struct {
+	Manifest Manifest
+	files    map[string][]byte
+}
+
+func newBundle(manifest Manifest) *Bundle {
+	return &Bundle{Manifest: manifest, files: map[string][]byte{}}
+}
+
+// add puts an artifact in the bundle and on the manifest
+func (b *Bundle) add(name, kind string, content []byte) {
+	sum := sha256.Sum256(content)
+	b.files[name] = content
+	b.Manifest.Artifacts = append(b.Manifest.Artifacts, Artifact{
+		Name:   name,
+		Kind:   kind,
+		Size:   int64(len(content)),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+}
+
+// addJSON adds an artifact holding v as indented JSON
+func (b *Bundle) addJSON(name, kind string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.add(name, kind, append(content, '\n'))
+	return nil
+}
+
+// gap records an artifact that could not be collected
+func (b *Bundle) gap(kind string, err error) {
+	b.Manifest.Gaps = append(b.Manifest.Gaps, Gap{Kind: kind, Reason: err.Error()})
+}
+
+// File returns the content of an artifact
+func (b *Bundle) File(name string) ([]byte, bool) {
+	content, ok := b.files[name]
+	return content, ok
+}
+
+// Artifacts returns the artifacts of one kind
+func (b *Bundle) Artifacts(kind string) []Artifact {
+	var artifacts []Artifact
+	for _, artifact := range b.Manifest.Artifacts {
+		if artifact.Kind == kind {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
+
+// checksums renders the artifacts' checksums in sha256sum's format, so the recipient can check
+// the extracted bundle with `sha256sum -c SHA256SUMS` without trusting this package
+func (b *Bundle) checksums() []byte {
+	var sums bytes.Buffer
+	for _, artifact := range b.Manifest.Artifacts {
+		fmt.Fprintf(&sums, "%s  %s\n", artifact.SHA256, artifact.Name)
+	}
+	return sums.Bytes()
+}
+
+// Write writes the bundle as a tar.gz: the manifest, the checksums, then the artifacts in manifest
+// order. Every entry carries the export time, so the same bundle always writes the same bytes.
+func (b *Bundle) Write(w io.Writer) error {
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the manifest: %w", err)
+	}
+
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	write := func(name string, content []byte) error {
+		if err := archive.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o444,
+			Size:    int64(len(content)),
+			ModTime: b.Manifest.ExportedAt,
+		}); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if _, err := archive.Write(content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := write(ManifestName, append(manifest, '\n')); err != nil {
+		return err
+	}
+	if err := write(ChecksumsName, b.checksums()); err != nil {
+		return err
+	}
+	for _, artifact := range b.Manifest.Artifacts {
+		if err := write(artifact.Name, b.files[artifact.Name]); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// Read reads a bundle written by Write and verifies it: every artifact on the manifest must be
+// present with its size and checksum, the checksums file must agree with the manifest, and the
+// bundle must hold nothing the manifest does not list.
+func Read(r io.Reader) (*Bundle, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("bundle is not gzip compressed: %w", err)
+	}
+	defer compressed.Close()
+
+	files := map[string][]byte{}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bundle is not a valid tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("bundle entry %s is not a regular file", header.Name)
+		}
+		if _, ok := files[header.Name]; ok {
+			return nil, fmt.Errorf("bundle holds %s twice", header.Name)
+		}
+		if files[header.Name], err = io.ReadAll(archive); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+
+	manifest, ok := files[ManifestName]
+	if !ok {
+		return nil, fmt.Errorf("bundle has no %s", ManifestName)
+	}
+	bundle := &Bundle{files: map[string][]byte{}}
+	if err := json.Unmarshal(manifest, &bundle.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestName, err)
+	}
+
+	var problems []string
+	for _, artifact := range bundle.Manifest.Artifacts {
+		content, ok := files[artifact.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is missing", artifact.Name))
+			continue
+		}
+		sum := sha256.Sum256(content)
+		switch {
+		case int64(len(content)) != artifact.Size:
+			problems = append(problems, fmt.Sprintf("%s is %d bytes, the manifest says %d", artifact.Name, len(content), artifact.Size))
+		case hex.EncodeToString(sum[:]) != artifact.SHA256:
+			problems = append(problems, fmt.Sprintf("%s does not match its checksum", artifact.Name))
+		}
+		bundle.files[artifact.Name] = content
+	}
+	if !bytes.Equal(files[ChecksumsName], bundle.checksums()) {
+		problems = append(problems, fmt.Sprintf("%s does not agree with the manifest", ChecksumsName))
+	}
+	var unlisted []string
+	for name := range files {
+		if _, ok := bundle.files[name]; !ok && name != ManifestName && name != ChecksumsName {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		problems = append(problems, fmt.Sprintf("%s is not on the manifest", name))
+	}
+
+	if len(problems) > 0 {
+		return bundle, fmt.Errorf("bundle for %s failed verification: %s", bundle.Manifest.FindingID, strings.Join(problems, "; "))
+	}
+	return bundle, nil
+}
@@ -0,0 +1,327 @@
+// Package export bundles everything a deployment recorded about one finding into a tar.gz for
+// handoff to external forensics or legal: the evidence object and its metadata, the history of
+// every IR execution of the finding, the CloudTrail events naming its resources, the triage log
+// lines mentioning it and the IDs of the snapshots taken of it. A manifest lists each artifact with
+// its SHA-256 and whatever could not be collected, and Read verifies a bundle against it.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// Names of the artifacts in a bundle; executions are stored as stepfunctions/<execution name>.json
+const (
+	EvidenceFile         = "evidence/finding.json"
+	EvidenceMetadataFile = "evidence/metadata.json"
+	CloudTrailFile       = "cloudtrail/events.json"
+	LogsFile             = "logs/triage.log"
+	SnapshotsFile        = "snapshots.json"
+)
+
+// Target is the deployment a finding is exported from
+type Target struct {
+	Session         *session.Session
+	EvidenceBucket  string
+	StateMachineArn string
+	// TriageFunction is the triage Lambda's name; the log excerpt comes from its log group
+	TriageFunction string
+}
+
+// Options shape the time window of the CloudTrail slice and the log excerpt
+type Options struct {
+	// Lead is how long before triage the window opens, 1 hour when zero
+	Lead time.Duration
+	// Lag is how long after the last execution ended it closes, 15 minutes when zero, since
+	// CloudTrail delivers events late
+	Lag time.Duration
+}
+
+// EvidenceMetadata is what the evidence bucket holds about the evidence object besides its body
+type EvidenceMetadata struct {
+	Key          string            `json:"key"`
+	VersionID    string            `json:"version_id,omitempty"`
+	LastModified time.Time         `json:"last_modified"`
+	ETag         string            `json:"etag"`
+	KMSKeyID     string            `json:"kms_key_id,omitempty"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+// Execution is an IR execution of the finding with its full history
+type Execution struct {
+	Execution *sfn.DescribeExecutionOutput `json:"execution"`
+	History   []*sfn.HistoryEvent          `json:"history"`
+}
+
+// Snapshot is an EBS snapshot taken of one of the finding's resources
+type Snapshot struct {
+	SnapshotID  string    `json:"snapshot_id"`
+	VolumeID    string    `json:"volume_id"`
+	StartTime   time.Time `json:"start_time"`
+	Description string    `json:"description,omitempty"`
+}
+
+// Collect gathers the finding's artifacts. Only the evidence object is required; any other
+// artifact that cannot be collected is recorded as a gap on the manifest.
+func Collect(target Target, findingID string, opts Options) (*Bundle, error) {
+	if opts.Lead == 0 {
+		opts.Lead = time.Hour
+	}
+	if opts.Lag == 0 {
+		opts.Lag = 15 * time.Minute
+	}
+
+	bundle := newBundle(Manifest{
+		FindingID:       findingID,
+		ExportedAt:      time.Now().UTC().Truncate(time.Second),
+		EvidenceBucket:  target.EvidenceBucket,
+		StateMachineArn: target.StateMachineArn,
+		Resources:       []string{},
+		Executions:      []string{},
+		Snapshots:       []string{},
+	})
+
+	evidence, err := collectEvidence(target, findingID, bundle)
+	if err != nil {
+		return nil, err
+	}
+	if resources := evidence.Metadata["resources"]; resources != "" {
+		bundle.Manifest.Resources = strings.Split(resources, ",")
+	}
+	triagedAt := evidence.LastModified
+	if seconds, err := strconv.ParseInt(evidence.Metadata["triaged-at"], 10, 64); err == nil {
+		triagedAt = time.Unix(seconds, 0).UTC()
+	}
+
+	lastStop := triagedAt
+	if target.StateMachineArn == "" {
+		bundle.gap(KindExecution, fmt.Errorf("no state machine given"))
+	} else if stop, err := collectExecutions(target, findingID, bundle); err != nil {
+		bundle.gap(KindExecution, err)
+	} else if stop.After(lastStop) {
+		lastStop = stop
+	}
+
+	bundle.Manifest.WindowStart = triagedAt.Add(-opts.Lead)
+	bundle.Manifest.WindowEnd = lastStop.Add(opts.Lag)
+	if bundle.Manifest.WindowEnd.After(bundle.Manifest.ExportedAt) {
+		bundle.Manifest.WindowEnd = bundle.Manifest.ExportedAt
+	}
+
+	if err := collectCloudTrail(target, bundle); err != nil {
+		bundle.gap(KindCloudTrail, err)
+	}
+	if target.TriageFunction == "" {
+		bundle.gap(KindLogs, fmt.Errorf("no triage function given"))
+	} else if err := collectLogs(target, findingID, bundle); err != nil {
+		bundle.gap(KindLogs, err)
+	}
+	if err := collectSnapshots(target, findingID, bundle); err != nil {
+		bundle.gap(KindSnapshots, err)
+	}
+
+	return bundle, nil
+}
+
+func collectEvidence(target Target, findingID string, bundle *Bundle) (*EvidenceMetadata, error) {
+	key := "findings/" + findingID + ".json"
+	object, err := s3.New(target.Session).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(target.EvidenceBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence for %s: %w", findingID, err)
+	}
+	defer object.Body.Close()
+
+	// The object goes in byte for byte, so its checksum matches the bucket's copy
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence for %s: %w", findingID, err)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("evidence for %s is not JSON", findingID)
+	}
+	bundle.add(EvidenceFile, KindEvidence, body)
+
+	metadata := &EvidenceMetadata{
+		Key:          key,
+		VersionID:    aws.StringValue(object.VersionId),
+		LastModified: aws.TimeValue(object.LastModified).UTC(),
+		ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+		KMSKeyID:     aws.StringValue(object.SSEKMSKeyId),
+		Metadata:     map[string]string{},
+	}
+	// The SDK capitalizes user metadata keys; the bundle keeps them as triage wrote them
+	for name, value := range object.Metadata {
+		metadata.Metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	return metadata, bundle.addJSON(EvidenceMetadataFile, KindEvidenceMetadata, metadata)
+}
+
+// collectExecutions adds every IR execution of the finding and returns when the last one stopped
+func collectExecutions(target Target, findingID string, bundle *Bundle) (time.Time, error) {
+	sfnClient := sfn.New(target.Session)
+	var lastStop time.Time
+
+	executions, err := helpers.ListExecutions(target.Session, target.StateMachineArn, "", helpers.PageOptions{MaxPages: 20})
+	if err != nil {
+		return lastStop, err
+	}
+	prefix := helpers.TriageExecutionPrefix(findingID)
+	for _, execution := range executions {
+		if !strings.HasPrefix(aws.StringValue(execution.Name), prefix) {
+			continue
+		}
+		described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: execution.ExecutionArn})
+		if err != nil {
+			return lastStop, fmt.Errorf("failed to describe execution %s: %w", aws.StringValue(execution.Name), err)
+		}
+		if input, err := helpers.ParseExecutionInput(aws.StringValue(described.Input)); err != nil || input.Detail.ID != findingID {
+			continue
+		}
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, aws.StringValue(execution.ExecutionArn))
+		if err != nil {
+			return lastStop, fmt.Errorf("failed to read the history of %s: %w", aws.StringValue(execution.Name), err)
+		}
+
+		name := aws.StringValue(execution.Name)
+		if err := bundle.addJSON("stepfunctions/"+name+".json", KindExecution, Execution{Execution: described, History: history.Events}); err != nil {
+			return lastStop, err
+		}
+		bundle.Manifest.Executions = append(bundle.Manifest.Executions, aws.StringValue(execution.ExecutionArn))
+		if stop := aws.TimeValue(described.StopDate); stop.After(lastStop) {
+			lastStop = stop
+		} else if described.StopDate == nil {
+			lastStop = bundle.Manifest.ExportedAt
+		}
+	}
+	if len(bundle.Manifest.Executions) == 0 {
+		return lastStop, fmt.Errorf("no IR execution of %s in %s", findingID, target.StateMachineArn)
+	}
+	return lastStop, nil
+}
+
+// collectCloudTrail adds the management events naming the finding's resources within the window
+func collectCloudTrail(target Target, bundle *Bundle) error {
+	trail := cloudtrail.New(target.Session)
+	seen := map[string]bool{}
+	var events []*cloudtrail.Event
+
+	for _, resource := range bundle.Manifest.Resources {
+		// Targets are "kind:id"; CloudTrail knows the resource by the id
+		_, id, found := strings.Cut(resource, ":")
+		if !found {
+			id = resource
+		}
+		err := trail.LookupEventsPages(&cloudtrail.LookupEventsInput{
+			LookupAttributes: []*cloudtrail.LookupAttribute{
+				{AttributeKey: aws.String(cloudtrail.LookupAttributeKeyResourceName), AttributeValue: aws.String(id)},
+			},
+			StartTime: aws.Time(bundle.Manifest.WindowStart),
+			EndTime:   aws.Time(bundle.Manifest.WindowEnd),
+		}, func(page *cloudtrail.LookupEventsOutput, lastPage bool) bool {
+			for _, event := range page.Events {
+				if !seen[aws.StringValue(event.EventId)] {
+					seen[aws.StringValue(event.EventId)] = true
+					events = append(events, event)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("failed to look up CloudTrail events for %s: %w", id, err)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.TimeValue(events[i].EventTime).Before(aws.TimeValue(events[j].EventTime))
+	})
+
+	// The records themselves, as CloudTrail wrote them
+	records := make([]json.RawMessage, 0, len(events))
+	for _, event := range events {
+		records = append(records, json.RawMessage(aws.StringValue(event.CloudTrailEvent)))
+	}
+	return bundle.addJSON(CloudTrailFile, KindCloudTrail, records)
+}
+
+// collectLogs adds the triage log lines mentioning the finding within the window
+func collectLogs(target Target, findingID string, bundle *Bundle) error {
+	logGroup := "/aws/lambda/" + target.TriageFunction
+	var lines strings.Builder
+
+	err := cloudwatchlogs.New(target.Session).FilterLogEventsPages(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		FilterPattern: aws.String(strconv.Quote(findingID)),
+		StartTime:     aws.Int64(bundle.Manifest.WindowStart.UnixMilli()),
+		EndTime:       aws.Int64(bundle.Manifest.WindowEnd.UnixMilli()),
+	}, func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+		for _, event := range page.Events {
+			fmt.Fprintf(&lines, "%s %s %s\n",
+				time.UnixMilli(aws.Int64Value(event.Timestamp)).UTC().Format(time.RFC3339Nano),
+				aws.StringValue(event.LogStreamName),
+				strings.TrimRight(aws.StringValue(event.Message), "\n"))
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", logGroup, err)
+	}
+	bundle.add(LogsFile, KindLogs, []byte(lines.String()))
+	return nil
+}
+
+// collectSnapshots adds the EBS snapshots tagged with the finding, as triage tags what it creates
+// for one, or naming it in their description
+func collectSnapshots(target Target, findingID string, bundle *Bundle) error {
+	ec2Client := ec2.New(target.Session)
+	found := map[string]*ec2.Snapshot{}
+
+	for _, filter := range []*ec2.Filter{
+		{Name: aws.String("tag:GuardDutyFinding"), Values: []*string{aws.String(findingID)}},
+		{Name: aws.String("description"), Values: []*string{aws.String("*" + findingID + "*")}},
+	} {
+		err := ec2Client.DescribeSnapshotsPages(&ec2.DescribeSnapshotsInput{
+			OwnerIds: []*string{aws.String("self")},
+			Filters:  []*ec2.Filter{filter},
+		}, func(page *ec2.DescribeSnapshotsOutput, lastPage bool) bool {
+			for _, snapshot := range page.Snapshots {
+				found[aws.StringValue(snapshot.SnapshotId)] = snapshot
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots of %s: %w", findingID, err)
+		}
+	}
+
+	snapshots := make([]Snapshot, 0, len(found))
+	for id, snapshot := range found {
+		snapshots = append(snapshots, Snapshot{
+			SnapshotID:  id,
+			VolumeID:    aws.StringValue(snapshot.VolumeId),
+			StartTime:   aws.TimeValue(snapshot.StartTime).UTC(),
+			Description: aws.StringValue(snapshot.Description),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].SnapshotID < snapshots[j].SnapshotID })
+	for _, snapshot := range snapshots {
+		bundle.Manifest.Snapshots = append(bundle.Manifest.Snapshots, snapshot.SnapshotID)
+	}
+	return bundle.addJSON(SnapshotsFile, KindSnapshots, snapshots)
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/iamdoc"
+)
+
+// FIPSMode reports whether the suite runs in FIPS verification mode, set with FIPS_MODE=1. In this
+// mode sessions from NewRateLimitedSession use FIPS endpoints and TLS 1.2 or later, every request
+// is audited by DefaultEndpointAudit, and StackOptions deploys with use_fips_endpoints.
+func FIPSMode() bool {
+	return os.Getenv("FIPS_MODE") != ""
+}
+
+// NonFIPSServices are the services the harness calls that have no FIPS endpoint, matched against
+// the labels of an endpoint ID or host. The SDK would build a FIPS host name for them that does not
+// resolve, so they keep their standard endpoint and the audit does not report them.
+var NonFIPSServices = []string{"tagging", "timestream"}
+
+// FIPSRegion reports whether AWS offers FIPS endpoints in the region: US, Canada and GovCloud
+func FIPSRegion(region string) bool {
+	return strings.HasPrefix(region, "us-") || strings.HasPrefix(region, "ca-")
+}
+
+func nonFIPS(name string) bool {
+	for _, label := range strings.Split(name, ".") {
+		for _, service := range NonFIPSServices {
+			if label == service || strings.HasPrefix(label, service+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EnableFIPS returns a copy of the session that resolves FIPS endpoints for every service that has
+// them and refuses to negotiate TLS below 1.2
+func EnableFIPS(sess *session.Session) (*session.Session, error) {
+	region := aws.StringValue(sess.Config.Region)
+	if !FIPSRegion(region) {
+		return nil, fmt.Errorf("FIPS endpoints are not offered in %s, only in US, Canada and GovCloud regions", region)
+	}
+
+	resolver := endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if !nonFIPS(service) {
+			opts = append(opts, func(o *endpoints.Options) {
+				o.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+			})
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	return sess.Copy(&aws.Config{
+		EndpointResolver: resolver,
+		HTTPClient:       &http.Client{Transport: transport},
+	}), nil
+}
+
+// EndpointAudit records requests that went to a standard endpoint of a service with a FIPS
+// endpoint, or that negotiated TLS below 1.2
+type EndpointAudit struct {
+	mu         sync.Mutex
+	violations map[string]int
+}
+
+// DefaultEndpointAudit audits every session NewRateLimitedSession returns in FIPS mode
+var DefaultEndpointAudit = NewEndpointAudit()
+
+// NewEndpointAudit returns an empty audit
+func NewEndpointAudit() *EndpointAudit {
+	return &EndpointAudit{violations: map[string]int{}}
+}
+
+// Install audits every request the session completes
+func (a *EndpointAudit) Install(sess *session.Session) {
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "threat-detection-ir.EndpointAudit",
+		Fn:   a.handle,
+	})
+}
+
+func (a *EndpointAudit) handle(r *request.Request) {
+	if r.HTTPRequest == nil || r.HTTPResponse == nil {
+		return
+	}
+	call := r.ClientInfo.ServiceName + "." + r.Operation.Name
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if host := r.HTTPRequest.URL.Hostname(); !strings.Contains(host, "fips") && !nonFIPS(host) {
+		a.violations[fmt.Sprintf("%s: standard endpoint %s", call, host)]++
+	}
+	if state := r.HTTPResponse.TLS; state == nil {
+		a.violations[fmt.Sprintf("%s: sent without TLS", call)]++
+	} else if state.Version < tls.VersionTLS12 {
+		a.violations[fmt.Sprintf("%s: negotiated %s", call, tls.VersionName(state.Version))]++
+	}
+}
+
+// Violations returns the recorded violations as "service.Operation: problem xN", sorted
+func (a *EndpointAudit) Violations() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var violations []string
+	for violation, count := range a.violations {
+		violations = append(violations, fmt.Sprintf("%s x%d", violation, count))
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// AssertBucketRequiresTLS12 checks that the bucket policy denies every request made with a TLS
+// version below 1.2 through an s3:TlsVersion condition
+func AssertBucketRequiresTLS12(sess *session.Session, bucketName string) error {
+	output, err := s3.New(sess).GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		return fmt.Errorf("failed to get policy of %s: %w", bucketName, err)
+	}
+
+	policy, err := iamdoc.Parse(aws.StringValue(output.Policy))
+	if err != nil {
+		return fmt.Errorf("failed to parse policy of %s: %w", bucketName, err)
+	}
+
+	for _, statement := range policy.DeniesUnless("s3:TlsVersion") {
+		if !statement.CoversAction("s3:*") {
+			continue
+		}
+		versions, ok := statement.ConditionValues("NumericLessThan", "s3:TlsVersion")
+		if !ok || len(versions) == 0 {
+			continue
+		}
+		// A deny below a higher version also rules out everything below 1.2
+		if version, err := strconv.ParseFloat(versions[0], 64); err == nil && version >= 1.2 {
+			return nil
+		}
+		return fmt.Errorf("policy of %s only denies TLS below %s", bucketName, versions[0])
+	}
+	return fmt.Errorf("policy of %s does not deny requests below TLS 1.2 on s3:*", bucketName)
+}
@@ -0,0 +1,271 @@
+package flaky
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// T is the subset of *testing.T that subtest bodies under the tracker may use. It satisfies the
+// testify and terratest TestingT interfaces so assertions and client constructors work unchanged.
+type T interface {
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fail()
+	FailNow()
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Helper()
+	Log(args ...interface{})
+	Logf(format string, args ...interface{})
+	Name() string
+}
+
+// Score is the flip rate of the last window outcomes: the fraction of consecutive runs whose result
+// differs. A stable test scores 0 whether it always passes or always fails; a coin flip scores ~0.5.
+func Score(history []Outcome, window int) float64 {
+	if window > 0 && len(history) > window {
+		history = history[len(history)-window:]
+	}
+	if len(history) < 2 {
+		return 0
+	}
+
+	flips := 0
+	for i := 1; i < len(history); i++ {
+		if history[i].Passed != history[i-1].Passed {
+			flips++
+		}
+	}
+
+	return float64(flips) / float64(len(history)-1)
+}
+
+// SoftFailure is a failure of a quarantined subtest that did not fail the suite
+type SoftFailure struct {
+	Test     string
+	Score    float64
+	Messages []string
+}
+
+// Tracker records subtest outcomes and soft-fails subtests whose flakiness score reaches the threshold
+type Tracker struct {
+	Store     Store
+	RunID     string
+	Threshold float64
+	Window    int
+	// MinRuns is the history needed before a subtest can be quarantined
+	MinRuns int
+
+	mu           sync.Mutex
+	scores       map[string]float64
+	softFailures []SoftFailure
+	recordErrors []error
+}
+
+// NewTracker returns a tracker with the default policy: quarantine at a flip rate of 0.2 over the last 20 runs
+func NewTracker(store Store, runID string) *Tracker {
+	return &Tracker{
+		Store:     store,
+		RunID:     runID,
+		Threshold: 0.2,
+		Window:    20,
+		MinRuns:   5,
+		scores:    map[string]float64{},
+	}
+}
+
+// FromEnv builds a tracker from FLAKY_DYNAMODB_TABLE or FLAKY_S3_BUCKET (with optional FLAKY_S3_PREFIX),
+// falling back to an in-memory store that never quarantines anything. FLAKY_THRESHOLD overrides the threshold.
+func FromEnv(sess *session.Session, runID string) (*Tracker, error) {
+	var store Store
+	switch {
+	case os.Getenv("FLAKY_DYNAMODB_TABLE") != "":
+		store = NewDynamoDBStore(sess, os.Getenv("FLAKY_DYNAMODB_TABLE"))
+	case os.Getenv("FLAKY_S3_BUCKET") != "":
+		prefix := os.Getenv("FLAKY_S3_PREFIX")
+		if prefix == "" {
+			prefix = "flakiness"
+		}
+		store = NewS3Store(sess, os.Getenv("FLAKY_S3_BUCKET"), prefix)
+	default:
+		store = NewMemoryStore()
+	}
+
+	tracker := NewTracker(store, runID)
+
+	if raw := os.Getenv("FLAKY_THRESHOLD"); raw != "" {
+		threshold, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FLAKY_THRESHOLD %q: %w", raw, err)
+		}
+		tracker.Threshold = threshold
+	}
+
+	return tracker, nil
+}
+
+// Quarantined reports whether a subtest's history marks it as flaky, with its score
+func (tr *Tracker) Quarantined(test string) (bool, float64) {
+	tr.mu.Lock()
+	score, cached := tr.scores[test]
+	tr.mu.Unlock()
+
+	if !cached {
+		history, err := tr.Store.History(test)
+		if err != nil {
+			tr.recordError(err)
+			return false, 0
+		}
+
+		score = 0
+		if len(history) >= tr.MinRuns {
+			score = Score(history, tr.Window)
+		}
+
+		tr.mu.Lock()
+		tr.scores[test] = score
+		tr.mu.Unlock()
+	}
+
+	return tr.Threshold > 0 && score >= tr.Threshold, score
+}
+
+// Run runs fn as a subtest and records its outcome. A quarantined subtest runs against a recorder
+// instead, so its failures appear in the report section without failing the suite.
+func (tr *Tracker) Run(t *testing.T, name string, fn func(t T)) bool {
+	return t.Run(name, func(st *testing.T) {
+		test := st.Name()
+		quarantined, score := tr.Quarantined(test)
+
+		if !quarantined {
+			defer func() { tr.record(test, !st.Failed()) }()
+			fn(st)
+			return
+		}
+
+		soft := &softT{name: test, log: st.Logf}
+		soft.run(fn)
+		tr.record(test, !soft.failed)
+
+		if soft.failed {
+			tr.mu.Lock()
+			tr.softFailures = append(tr.softFailures, SoftFailure{Test: test, Score: score, Messages: soft.messages})
+			tr.mu.Unlock()
+			st.Logf("quarantined subtest failed (flakiness score %.2f); not failing the suite", score)
+		}
+	})
+}
+
+func (tr *Tracker) record(test string, passed bool) {
+	err := tr.Store.Record(Outcome{Test: test, RunID: tr.RunID, Passed: passed, Time: time.Now().UTC()})
+	if err != nil {
+		tr.recordError(err)
+	}
+}
+
+func (tr *Tracker) recordError(err error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.recordErrors = append(tr.recordErrors, err)
+}
+
+// SoftFailures returns the quarantined subtests that failed in this run
+func (tr *Tracker) SoftFailures() []SoftFailure {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return append([]SoftFailure(nil), tr.softFailures...)
+}
+
+// Report renders the flakiness section of the suite report
+func (tr *Tracker) Report() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("Flaky subtests (soft-fail):\n")
+
+	if len(tr.softFailures) == 0 {
+		b.WriteString("  none failed\n")
+	}
+	for _, failure := range tr.softFailures {
+		fmt.Fprintf(&b, "  %s (score %.2f)\n", failure.Test, failure.Score)
+		for _, message := range failure.Messages {
+			fmt.Fprintf(&b, "    %s\n", strings.ReplaceAll(strings.TrimSpace(message), "\n", "\n    "))
+		}
+	}
+
+	var quarantined []string
+	for test, score := range tr.scores {
+		if tr.Threshold > 0 && score >= tr.Threshold {
+			quarantined = append(quarantined, fmt.Sprintf("%s (%.2f)", test, score))
+		}
+	}
+	sort.Strings(quarantined)
+	if len(quarantined) > 0 {
+		fmt.Fprintf(&b, "Quarantined this run: %s\n", strings.Join(quarantined, ", "))
+	}
+
+	for _, err := range tr.recordErrors {
+		fmt.Fprintf(&b, "History store error: %v\n", err)
+	}
+
+	return b.String()
+}
+
+// softT records failures instead of failing the test; FailNow ends only the subtest goroutine
+type softT struct {
+	name     string
+	log      func(format string, args ...interface{})
+	mu       sync.Mutex
+	failed   bool
+	messages []string
+}
+
+func (s *softT) run(fn func(t T)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(s)
+	}()
+	<-done
+}
+
+func (s *softT) fail(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = true
+	if message != "" {
+		s.messages = append(s.messages, message)
+	}
+}
+
+func (s *softT) Error(args ...interface{}) { s.fail(fmt.Sprint(args...)) }
+func (s *softT) Errorf(format string, args ...interface{}) {
+	s.fail(fmt.Sprintf(format, args...))
+}
+func (s *softT) Fail()    { s.fail("") }
+func (s *softT) FailNow() { s.fail(""); runtime.Goexit() }
+func (s *softT) Fatal(args ...interface{}) {
+	s.fail(fmt.Sprint(args...))
+	runtime.Goexit()
+}
+func (s *softT) Fatalf(format string, args ...interface{}) {
+	s.fail(fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+func (s *softT) Helper()                                 {}
+func (s *softT) Log(args ...interface{})                 { s.log("%s", fmt.Sprint(args...)) }
+func (s *softT) Logf(format string, args ...interface{}) { s.log(format, args...) }
+func (s *softT) Name() string                            { return s.name }
@@ -0,0 +1,227 @@
+package flaky
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Outcome is the result of one subtest run
+type Outcome struct {
+	Test   string    `json:"test"`
+	RunID  string    `json:"run_id"`
+	Passed bool      `json:"passed"`
+	Time   time.Time `json:"time"`
+}
+
+// Store persists subtest outcomes across runs
+type Store interface {
+	// History returns the outcomes of a subtest, oldest first
+	History(test string) ([]Outcome, error)
+	// Record appends an outcome
+	Record(outcome Outcome) error
+}
+
+// MemoryStore keeps history in process; used when no backend is configured
+type MemoryStore struct {
+	mu       sync.Mutex
+	outcomes map[string][]Outcome
+}
+
+// NewMemoryStore returns an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{outcomes: map[string][]Outcome{}}
+}
+
+// History implements Store
+func (m *MemoryStore) History(test string) ([]Outcome, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Outcome(nil), m.outcomes[test]...), nil
+}
+
+// Record implements Store
+func (m *MemoryStore) Record(outcome Outcome) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outcomes[outcome.Test] = append(m.outcomes[outcome.Test], outcome)
+	return nil
+}
+
+// S3Store keeps one JSON history object per subtest under a prefix
+type S3Store struct {
+	Bucket string
+	Prefix string
+	// MaxHistory caps the stored outcomes per subtest; 0 keeps 100
+	MaxHistory int
+
+	client *s3.S3
+	mu     sync.Mutex
+}
+
+// NewS3Store returns a store backed by the bucket
+func NewS3Store(sess *session.Session, bucket, prefix string) *S3Store {
+	return &S3Store{Bucket: bucket, Prefix: prefix, client: s3.New(sess)}
+}
+
+func (s *S3Store) key(test string) string {
+	return strings.TrimSuffix(s.Prefix, "/") + "/" + strings.ReplaceAll(test, "/", "__") + ".json"
+}
+
+// History implements Store
+func (s *S3Store) History(test string) ([]Outcome, error) {
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(test)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read flakiness history for %s: %w", test, err)
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomes []Outcome
+	if err := json.Unmarshal(data, &outcomes); err != nil {
+		return nil, fmt.Errorf("failed to parse flakiness history for %s: %w", test, err)
+	}
+
+	return outcomes, nil
+}
+
+// Record implements Store. Concurrent suites may race on the same subtest; the last writer wins, which
+// only loses a single data point.
+func (s *S3Store) Record(outcome Outcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcomes, err := s.History(outcome.Test)
+	if err != nil {
+		return err
+	}
+
+	outcomes = append(outcomes, outcome)
+
+	maxHistory := s.MaxHistory
+	if maxHistory <= 0 {
+		maxHistory = 100
+	}
+	if len(outcomes) > maxHistory {
+		outcomes = outcomes[len(outcomes)-maxHistory:]
+	}
+
+	data, err := json.Marshal(outcomes)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(outcome.Test)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write flakiness history for %s: %w", outcome.Test, err)
+	}
+
+	return nil
+}
+
+// DynamoDBStore keeps outcomes in a table keyed by "test" (hash) and "time" (range, RFC3339Nano)
+type DynamoDBStore struct {
+	Table string
+
+	client *dynamodb.DynamoDB
+}
+
+// NewDynamoDBStore returns a store backed by the table
+func NewDynamoDBStore(sess *session.Session, table string) *DynamoDBStore {
+	return &DynamoDBStore{Table: table, client: dynamodb.New(sess)}
+}
+
+type dynamoOutcome struct {
+	Test   string `dynamodbav:"test"`
+	Time   string `dynamodbav:"time"`
+	RunID  string `dynamodbav:"run_id"`
+	Passed bool   `dynamodbav:"passed"`
+}
+
+// History implements Store
+func (d *DynamoDBStore) History(test string) ([]Outcome, error) {
+	var outcomes []Outcome
+	var decodeErr error
+
+	err := d.client.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(d.Table),
+		KeyConditionExpression: aws.String("#test = :test"),
+		ExpressionAttributeNames: map[string]*string{
+			"#test": aws.String("test"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":test": {S: aws.String(test)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var items []dynamoOutcome
+		if decodeErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); decodeErr != nil {
+			return false
+		}
+		for _, item := range items {
+			at, _ := time.Parse(time.RFC3339Nano, item.Time)
+			outcomes = append(outcomes, Outcome{Test: item.Test, RunID: item.RunID, Passed: item.Passed, Time: at})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flakiness history for %s: %w", test, err)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode flakiness history for %s: %w", test, decodeErr)
+	}
+
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Time.Before(outcomes[j].Time) })
+	return outcomes, nil
+}
+
+// Record implements Store
+func (d *DynamoDBStore) Record(outcome Outcome) error {
+	item, err := dynamodbattribute.MarshalMap(dynamoOutcome{
+		Test:   outcome.Test,
+		Time:   outcome.Time.UTC().Format(time.RFC3339Nano),
+		RunID:  outcome.RunID,
+		Passed: outcome.Passed,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(d.Table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record outcome for %s: %w", outcome.Test, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// FlowLogsForInstance returns, per network interface of the instance, the flow logs that capture its
+// traffic, whether attached to the interface itself, its subnet or its VPC
+func FlowLogsForInstance(sess *session.Session, instanceID string) (map[string][]*ec2.FlowLog, error) {
+	interfaces, err := InstanceNetworkInterfaces(sess, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceIDs []*string
+	for _, eni := range interfaces {
+		resourceIDs = append(resourceIDs, eni.NetworkInterfaceId, eni.SubnetId, eni.VpcId)
+	}
+
+	var flowLogs []*ec2.FlowLog
+	err = ec2.New(sess).DescribeFlowLogsPages(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: resourceIDs},
+		},
+	}, func(page *ec2.DescribeFlowLogsOutput, lastPage bool) bool {
+		flowLogs = append(flowLogs, page.FlowLogs...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe flow logs: %w", err)
+	}
+
+	coverage := map[string][]*ec2.FlowLog{}
+	for _, eni := range interfaces {
+		eniID := aws.StringValue(eni.NetworkInterfaceId)
+		coverage[eniID] = nil
+		for _, flowLog := range flowLogs {
+			switch aws.StringValue(flowLog.ResourceId) {
+			case eniID, aws.StringValue(eni.SubnetId), aws.StringValue(eni.VpcId):
+				coverage[eniID] = append(coverage[eniID], flowLog)
+			}
+		}
+	}
+
+	return coverage, nil
+}
+
+// AssertFlowLogsEnabled asserts that every network interface of the instance is covered by an active
+// flow log capturing all traffic into the log group
+func AssertFlowLogsEnabled(sess *session.Session, instanceID, logGroupName string) error {
+	coverage, err := FlowLogsForInstance(sess, instanceID)
+	if err != nil {
+		return err
+	}
+
+	var uncovered []string
+	for eniID, flowLogs := range coverage {
+		captured := false
+		for _, flowLog := range flowLogs {
+			if aws.StringValue(flowLog.LogGroupName) == logGroupName &&
+				aws.StringValue(flowLog.TrafficType) == ec2.TrafficTypeAll &&
+				aws.StringValue(flowLog.FlowLogStatus) == "ACTIVE" &&
+				aws.StringValue(flowLog.DeliverLogsStatus) != "FAILED" {
+				captured = true
+				break
+			}
+		}
+		if !captured {
+			uncovered = append(uncovered, eniID)
+		}
+	}
+
+	if len(uncovered) > 0 {
+		return fmt.Errorf("network interfaces of %s have no active flow log to %s: %s", instanceID, logGroupName, strings.Join(uncovered, ", "))
+	}
+
+	return nil
+}
+
+// WaitForFlowLogsEnabled polls AssertFlowLogsEnabled until it passes or the timeout expires
+func WaitForFlowLogsEnabled(sess *session.Session, instanceID, logGroupName string, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+
+	for {
+		err := AssertFlowLogsEnabled(sess, instanceID, logGroupName)
+		if err == nil || clock.Default.Now().After(deadline) {
+			return err
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+}
+
+// WaitForFlowLogDelivery waits until flow log records for each network interface reach the log group.
+// Flow Logs names streams after the interface ("eni-...-all"), so delivery shows up as an ingestion after since.
+func WaitForFlowLogDelivery(sess *session.Session, logGroupName string, eniIDs []string, since time.Time, timeout time.Duration) error {
+	logsClient := cloudwatchlogs.New(sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for {
+		var pending []string
+		for _, eniID := range eniIDs {
+			streams, err := logsClient.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+				LogGroupName:        aws.String(logGroupName),
+				LogStreamNamePrefix: aws.String(eniID),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to describe flow log streams: %w", err)
+			}
+
+			delivered := false
+			for _, stream := range streams.LogStreams {
+				if aws.Int64Value(stream.LastIngestionTime) >= clock.Tolerant(since).UnixMilli() {
+					delivered = true
+					break
+				}
+			}
+			if !delivered {
+				pending = append(pending, eniID)
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("no flow log records for %s in %s within %s", strings.Join(pending, ", "), logGroupName, timeout)
+		}
+		clock.Default.Sleep(30 * time.Second)
+	}
+}
+
+// FlowRecord is a flow log record in the default format
+type FlowRecord struct {
+	InterfaceID string
+	SrcAddr     string
+	DstAddr     string
+	Start       time.Time
+	// Action is ACCEPT or REJECT
+	Action string
+}
+
+// parseFlowRecord reads a record of the default format: version account-id interface-id srcaddr
+// dstaddr srcport dstport protocol packets bytes start end action log-status
+func parseFlowRecord(message string) (FlowRecord, bool) {
+	fields := strings.Fields(message)
+	if len(fields) != 14 {
+		return FlowRecord{}, false
+	}
+	start, err := strconv.ParseInt(fields[10], 10, 64)
+	if err != nil {
+		return FlowRecord{}, false
+	}
+	return FlowRecord{
+		InterfaceID: fields[2],
+		SrcAddr:     fields[3],
+		DstAddr:     fields[4],
+		Start:       time.Unix(start, 0),
+		Action:      fields[12],
+	}, true
+}
+
+// WaitForFlowRecords waits for flow log records of the interface to or from the address, e.g. an
+// IPv6 address of the instance, with the action (ACCEPT or REJECT) that started after since
+func WaitForFlowRecords(sess *session.Session, logGroupName, eniID, address, action string, since time.Time, timeout time.Duration) ([]FlowRecord, error) {
+	logsClient := cloudwatchlogs.New(sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for {
+		var records []FlowRecord
+		err := logsClient.FilterLogEventsPages(&cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:        aws.String(logGroupName),
+			LogStreamNamePrefix: aws.String(eniID),
+			StartTime:           aws.Int64(clock.Tolerant(since).UnixMilli()),
+			// Terms with colons, as in IPv6 addresses, must be quoted
+			FilterPattern: aws.String(`"` + address + `"`),
+		}, func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+			for _, event := range page.Events {
+				record, ok := parseFlowRecord(aws.StringValue(event.Message))
+				if ok && record.Action == action && !record.Start.Before(clock.Tolerant(since).Truncate(time.Second)) &&
+					(record.SrcAddr == address || record.DstAddr == address) {
+					records = append(records, record)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter flow log records: %w", err)
+		}
+
+		if len(records) > 0 {
+			return records, nil
+		}
+		if clock.Default.Now().After(deadline) {
+			return nil, fmt.Errorf("no %s flow log records for %s on %s in %s within %s", action, address, eniID, logGroupName, timeout)
+		}
+		clock.Default.Sleep(30 * time.Second)
+	}
+}
+
+// DeleteFlowLogsForFinding removes the flow logs the triage Lambda enabled for a finding
+func DeleteFlowLogsForFinding(sess *session.Session, findingID string) error {
+	ec2Client := ec2.New(sess)
+
+	var flowLogIDs []*string
+	err := ec2Client.DescribeFlowLogsPages(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("tag:GuardDutyFinding"), Values: []*string{aws.String(findingID)}},
+		},
+	}, func(page *ec2.DescribeFlowLogsOutput, lastPage bool) bool {
+		for _, flowLog := range page.FlowLogs {
+			flowLogIDs = append(flowLogIDs, flowLog.FlowLogId)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe flow logs: %w", err)
+	}
+	if len(flowLogIDs) == 0 {
+		return nil
+	}
+
+	if _, err := ec2Client.DeleteFlowLogs(&ec2.DeleteFlowLogsInput{FlowLogIds: flowLogIDs}); err != nil {
+		return fmt.Errorf("failed to delete flow logs for %s: %w", findingID, err)
+	}
+
+	return nil
+}
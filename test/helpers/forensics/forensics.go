@@ -0,0 +1,383 @@
+// Package forensics snapshots a deployment's state when a test fails, so the failure can be
+// debugged after the stack is gone: the EventBridge rules and their targets, the triage Lambda's
+// configuration, the latest IR executions with their histories, the listing of the stack's buckets
+// and the state of its alarms. Each failed test gets its own directory of JSON files with a manifest
+// of what was collected and what could not be.
+package forensics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// DirEnv names the directory bundles are written under; without it they go to the system temp
+// directory
+const DirEnv = "FORENSICS_DIR"
+
+// Bounds of a bundle, so a failure in a busy account does not stall the run
+const (
+	Executions    = 10
+	BucketObjects = 1000
+)
+
+// Names of the files in a bundle; executions are stored as executions/<execution name>.json
+const (
+	ManifestFile = "manifest.json"
+	RulesFile    = "rules.json"
+	LambdaFile   = "lambda.json"
+	BucketsFile  = "buckets.json"
+	AlarmsFile   = "alarms.json"
+)
+
+// Target is the deployment a bundle is collected from
+type Target struct {
+	Session         *session.Session
+	RuleNames       []string
+	FunctionName    string
+	StateMachineArn string
+	Buckets         []string
+	AlarmNames      []string
+}
+
+// TargetFromOutputs builds the target from the stack's outputs as returned by terraform.OutputAll.
+// Outputs that are empty because a feature is off are skipped.
+func TargetFromOutputs(sess *session.Session, outputs map[string]interface{}) Target {
+	values := func(keys ...string) []string {
+		var found []string
+		for _, key := range keys {
+			switch value := outputs[key].(type) {
+			case string:
+				if value != "" {
+					found = append(found, value)
+				}
+			case []interface{}:
+				for _, item := range value {
+					if s, ok := item.(string); ok && s != "" {
+						found = append(found, s)
+					}
+				}
+			}
+		}
+		return found
+	}
+	first := func(key string) string {
+		if found := values(key); len(found) > 0 {
+			return found[0]
+		}
+		return ""
+	}
+
+	return Target{
+		Session:         sess,
+		RuleNames:       values("eventbridge_rule_names", "finding_export_rule_name"),
+		FunctionName:    first("lambda_triage_function_name"),
+		StateMachineArn: first("stepfn_ir_state_machine_arn"),
+		Buckets:         values("s3_evidence_bucket_name", "s3_evidence_logs_bucket_name", "finding_export_bucket_name"),
+		AlarmNames:      values("cloudwatch_alarm_names"),
+	}
+}
+
+// Manifest describes a bundle
+type Manifest struct {
+	Test        string    `json:"test"`
+	CollectedAt time.Time `json:"collected_at"`
+	Files       []string  `json:"files"`
+	// Gaps are the parts that could not be collected, so the reader knows what is missing rather
+	// than assuming it never existed
+	Gaps []Gap `json:"gaps,omitempty"`
+}
+
+// Gap is a part of the bundle that could not be collected
+type Gap struct {
+	Part   string `json:"part"`
+	Reason string `json:"reason"`
+}
+
+// Collector writes a bundle for every watched test that fails
+type Collector struct {
+	Target Target
+	// Dir is where bundles are written, DirEnv or the system temp directory when empty
+	Dir string
+
+	mu      sync.Mutex
+	written map[string]bool
+}
+
+// New returns a collector for the target
+func New(target Target) *Collector {
+	dir := os.Getenv(DirEnv)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "ir-forensics")
+	}
+	return &Collector{Target: target, Dir: dir, written: map[string]bool{}}
+}
+
+// Watch collects a bundle when the subtest ends failed. Cleanups run after the test function's
+// deferred calls, so a top-level test that destroys its stack in a defer defers CollectIfFailed
+// instead.
+func (c *Collector) Watch(t *testing.T) {
+	t.Cleanup(func() {
+		c.CollectIfFailed(t)
+	})
+}
+
+// CollectIfFailed collects a bundle if the test has failed, unless the failure comes from a watched
+// subtest that already has one
+func (c *Collector) CollectIfFailed(t *testing.T) {
+	name := t.Name()
+	if !t.Failed() || c.coveredBySubtest(name) {
+		return
+	}
+
+	dir, err := c.Collect(name)
+	if err != nil {
+		t.Logf("failed to collect forensics: %v", err)
+		return
+	}
+	t.Logf("forensics bundle written to %s", dir)
+}
+
+// Run runs fn as a watched subtest of t
+func (c *Collector) Run(t *testing.T, name string, fn func(t *testing.T)) bool {
+	return t.Run(name, func(t *testing.T) {
+		c.Watch(t)
+		fn(t)
+	})
+}
+
+// coveredBySubtest reports whether a subtest of the test already has a bundle
+func (c *Collector) coveredBySubtest(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for written := range c.written {
+		if strings.HasPrefix(written, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect snapshots the target into a new directory named after the test and returns its path.
+// Parts that cannot be collected are recorded as gaps on the manifest; only failing to write the
+// bundle is an error.
+func (c *Collector) Collect(test string) (string, error) {
+	now := clock.Default.Now().UTC()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(test) + "-" + now.Format("20060102-150405")
+	dir := filepath.Join(c.Dir, name)
+	if err := os.MkdirAll(filepath.Join(dir, "executions"), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	manifest := Manifest{Test: test, CollectedAt: now.Truncate(time.Second), Files: []string{}}
+	write := func(file string, value interface{}) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", file, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	}
+	gap := func(part string, err error) {
+		manifest.Gaps = append(manifest.Gaps, Gap{Part: part, Reason: err.Error()})
+	}
+
+	parts := []struct {
+		file    string
+		collect func(Target) (interface{}, error)
+	}{
+		{RulesFile, collectRules},
+		{LambdaFile, collectLambda},
+		{BucketsFile, collectBuckets},
+		{AlarmsFile, collectAlarms},
+	}
+	for _, part := range parts {
+		value, err := part.collect(c.Target)
+		if err != nil {
+			gap(part.file, err)
+		}
+		if value == nil {
+			continue
+		}
+		if err := write(part.file, value); err != nil {
+			return "", err
+		}
+	}
+
+	executions, err := collectExecutions(c.Target)
+	if err != nil {
+		gap("executions", err)
+	}
+	for _, execution := range executions {
+		if err := write(filepath.Join("executions", aws.StringValue(execution.Execution.Name)+".json"), execution); err != nil {
+			return "", err
+		}
+	}
+
+	if err := write(ManifestFile, manifest); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.written[test] = true
+	c.mu.Unlock()
+	return dir, nil
+}
+
+// Rule is an EventBridge rule with its targets
+type Rule struct {
+	Rule    *eventbridge.DescribeRuleOutput `json:"rule"`
+	Targets []*eventbridge.Target           `json:"targets"`
+}
+
+func collectRules(target Target) (interface{}, error) {
+	if len(target.RuleNames) == 0 {
+		return nil, nil
+	}
+
+	client := eventbridge.New(target.Session)
+	var rules []Rule
+	var failed []string
+	for _, name := range target.RuleNames {
+		rule, err := client.DescribeRule(&eventbridge.DescribeRuleInput{Name: aws.String(name)})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		targets, err := client.ListTargetsByRule(&eventbridge.ListTargetsByRuleInput{Rule: aws.String(name)})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s targets: %v", name, err))
+			continue
+		}
+		rules = append(rules, Rule{Rule: rule, Targets: targets.Targets})
+	}
+	return rules, partial(failed)
+}
+
+func collectLambda(target Target) (interface{}, error) {
+	if target.FunctionName == "" {
+		return nil, nil
+	}
+
+	config, err := lambda.New(target.Session).GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(target.FunctionName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the configuration of %s: %w", target.FunctionName, err)
+	}
+	return config, nil
+}
+
+// BucketObject is one object of a bucket listing
+type BucketObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func collectBuckets(target Target) (interface{}, error) {
+	if len(target.Buckets) == 0 {
+		return nil, nil
+	}
+
+	listings := map[string][]BucketObject{}
+	var failed []string
+	for _, bucket := range target.Buckets {
+		objects, err := helpers.ListObjects(target.Session, bucket, "", helpers.PageOptions{MaxItems: BucketObjects}, nil)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", bucket, err))
+			continue
+		}
+		listing := []BucketObject{}
+		for _, obj := range objects {
+			listing = append(listing, BucketObject{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		listings[bucket] = listing
+	}
+	return listings, partial(failed)
+}
+
+func collectAlarms(target Target) (interface{}, error) {
+	if len(target.AlarmNames) == 0 {
+		return nil, nil
+	}
+
+	var alarms []*cloudwatch.MetricAlarm
+	err := cloudwatch.New(target.Session).DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{
+		AlarmNames: aws.StringSlice(target.AlarmNames),
+	}, func(page *cloudwatch.DescribeAlarmsOutput, _ bool) bool {
+		alarms = append(alarms, page.MetricAlarms...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe alarms: %w", err)
+	}
+	return alarms, nil
+}
+
+// Execution is one of the latest IR executions with its full history
+type Execution struct {
+	Execution *sfn.DescribeExecutionOutput `json:"execution"`
+	History   []*sfn.HistoryEvent          `json:"history"`
+}
+
+func collectExecutions(target Target) ([]Execution, error) {
+	if target.StateMachineArn == "" {
+		return nil, nil
+	}
+
+	listed, err := helpers.ListExecutions(target.Session, target.StateMachineArn, "", helpers.PageOptions{MaxItems: Executions})
+	if err != nil {
+		return nil, err
+	}
+
+	client := sfn.New(target.Session)
+	var executions []Execution
+	var failed []string
+	for _, item := range listed {
+		arn := aws.StringValue(item.ExecutionArn)
+		described, err := client.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: aws.String(arn)})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", aws.StringValue(item.Name), err))
+			continue
+		}
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, arn)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s history: %v", aws.StringValue(item.Name), err))
+			continue
+		}
+		executions = append(executions, Execution{Execution: described, History: history.Events})
+	}
+	return executions, partial(failed)
+}
+
+// partial turns the failures of some items of a part into one error, nil when none failed
+func partial(failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(failed, "; "))
+}
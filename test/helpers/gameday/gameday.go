@@ -0,0 +1,218 @@
+package gameday
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+)
+
+// Plan is a curated game-day exercise: scenarios from the scenario directory run in order, with a
+// briefing announced before each one and a pause after it
+type Plan struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step runs one scenario by name through one finding source
+type Step struct {
+	Scenario string        `yaml:"scenario"`
+	Source   string        `yaml:"source"`
+	Briefing string        `yaml:"briefing"`
+	Pause    time.Duration `yaml:"pause"`
+}
+
+// LoadPlan reads an exercise plan and resolves its scenarios from scenarioDir
+func LoadPlan(path, scenarioDir string) (*Plan, map[string]*scenario.Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var plan Plan
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&plan); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Name == "" {
+		plan.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(plan.Steps) == 0 {
+		return nil, nil, fmt.Errorf("plan %s has no steps", path)
+	}
+
+	scenarios := map[string]*scenario.Scenario{}
+	for i, step := range plan.Steps {
+		if step.Scenario == "" {
+			return nil, nil, fmt.Errorf("step %d has no scenario", i)
+		}
+		if step.Source == "" {
+			plan.Steps[i].Source = helpers.SourceEventBridge
+		}
+		if _, ok := scenarios[step.Scenario]; ok {
+			continue
+		}
+
+		sc, err := scenario.Load(filepath.Join(scenarioDir, step.Scenario+".yaml"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("step %d: %w", i, err)
+		}
+		scenarios[step.Scenario] = sc
+	}
+
+	return &plan, scenarios, nil
+}
+
+// Announcer broadcasts exercise progress to the participants
+type Announcer interface {
+	Announce(message string) error
+}
+
+// SlackAnnouncer posts announcements to a Slack incoming webhook
+type SlackAnnouncer struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Announce implements Announcer
+func (a SlackAnnouncer) Announce(message string) error {
+	body, err := json.Marshal(map[string]string{"text": message})
+	if err != nil {
+		return err
+	}
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Post(a.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// WriterAnnouncer prints announcements, for exercises without a Slack channel
+type WriterAnnouncer struct {
+	Out io.Writer
+}
+
+// Announce implements Announcer
+func (a WriterAnnouncer) Announce(message string) error {
+	_, err := fmt.Fprintf(a.Out, "[announce] %s\n", message)
+	return err
+}
+
+// missedAck is typed at the acknowledgment prompt when no responder picked up the alert
+const missedAck = "miss"
+
+// Exercise runs a plan against a deployed stack with a facilitator at the console. The facilitator
+// starts every step, then records when a responder acknowledged the alert.
+type Exercise struct {
+	Plan      *Plan
+	Scenarios map[string]*scenario.Scenario
+	Target    scenario.Target
+	Announcer Announcer
+	Console   io.Writer
+	Input     io.Reader
+	RunID     string
+}
+
+// Run walks through the plan and returns the after-action report. Announcement failures are
+// reported on the console but do not stop the exercise.
+func (e *Exercise) Run() (*Report, error) {
+	input := bufio.NewReader(e.Input)
+	report := &Report{Plan: e.Plan.Name, RunID: e.RunID, StartedAt: time.Now()}
+
+	for i, step := range e.Plan.Steps {
+		sc := e.Scenarios[step.Scenario]
+
+		source, err := helpers.NewFindingSource(e.Target.Session, step.Source)
+		if err != nil {
+			return report, err
+		}
+
+		e.announce(fmt.Sprintf("Game day %s, step %d/%d: %s. %s", e.Plan.Name, i+1, len(e.Plan.Steps), sc.Name, step.Briefing))
+		if _, err := e.prompt(input, "Press Enter to inject the findings"); err != nil {
+			return report, err
+		}
+
+		stepReport := StepReport{Scenario: sc.Name, Source: step.Source, InjectedAt: time.Now()}
+
+		type outcome struct {
+			result *scenario.Result
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			result, err := scenario.Run(e.Target, sc, source, fmt.Sprintf("%s-%d", e.RunID, i))
+			done <- outcome{result, err}
+		}()
+
+		note, err := e.prompt(input, fmt.Sprintf("Press Enter when a responder acknowledges the alert (optionally type a note first, or %q if nobody did)", missedAck))
+		if err != nil {
+			return report, err
+		}
+		if note != missedAck {
+			stepReport.AcknowledgedAt = time.Now()
+			stepReport.Note = note
+		}
+
+		finished := <-done
+		if finished.err != nil {
+			stepReport.Error = finished.err.Error()
+		} else {
+			stepReport.Failures = finished.result.Failures
+		}
+		report.Steps = append(report.Steps, stepReport)
+
+		e.announce(fmt.Sprintf("Step %d/%d (%s) finished: %s", i+1, len(e.Plan.Steps), sc.Name, stepReport.Outcome()))
+
+		if step.Pause > 0 && i < len(e.Plan.Steps)-1 {
+			e.announce(fmt.Sprintf("Pausing %s before the next step", step.Pause))
+			time.Sleep(step.Pause)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	e.announce(fmt.Sprintf("Game day %s complete: %d/%d steps passed", e.Plan.Name, report.Passed(), len(report.Steps)))
+
+	return report, nil
+}
+
+func (e *Exercise) announce(message string) {
+	if err := e.Announcer.Announce(message); err != nil {
+		fmt.Fprintf(e.Console, "failed to announce: %v\n", err)
+	}
+}
+
+// prompt asks the facilitator for input and returns the trimmed line
+func (e *Exercise) prompt(input *bufio.Reader, question string) (string, error) {
+	fmt.Fprintf(e.Console, "%s: ", question)
+
+	line, err := input.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read facilitator input: %w", err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
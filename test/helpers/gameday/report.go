@@ -0,0 +1,111 @@
+package gameday
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepReport is what happened during one step of the exercise
+type StepReport struct {
+	Scenario   string
+	Source     string
+	InjectedAt time.Time
+	// AcknowledgedAt is zero when no responder acknowledged the alert
+	AcknowledgedAt time.Time
+	Note           string
+	Failures       []string
+	Error          string
+}
+
+// Acknowledged reports whether a responder picked up the alert
+func (s StepReport) Acknowledged() bool {
+	return !s.AcknowledgedAt.IsZero()
+}
+
+// TimeToAcknowledge is the time from injection to the responder's acknowledgment
+func (s StepReport) TimeToAcknowledge() time.Duration {
+	if !s.Acknowledged() {
+		return 0
+	}
+	return s.AcknowledgedAt.Sub(s.InjectedAt)
+}
+
+// Passed reports whether the pipeline produced every expected effect
+func (s StepReport) Passed() bool {
+	return s.Error == "" && len(s.Failures) == 0
+}
+
+// Outcome summarizes the pipeline result in a few words
+func (s StepReport) Outcome() string {
+	switch {
+	case s.Error != "":
+		return "error: " + s.Error
+	case len(s.Failures) > 0:
+		return fmt.Sprintf("%d expectation(s) failed", len(s.Failures))
+	}
+	return "pipeline behaved as expected"
+}
+
+// Report is the after-action report of an exercise
+type Report struct {
+	Plan       string
+	RunID      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Steps      []StepReport
+}
+
+// Passed returns the number of steps where the pipeline behaved as expected
+func (r *Report) Passed() int {
+	passed := 0
+	for _, step := range r.Steps {
+		if step.Passed() {
+			passed++
+		}
+	}
+	return passed
+}
+
+// Markdown renders the report for the exercise write-up
+func (r *Report) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# After-action report: %s\n\n", r.Plan)
+	fmt.Fprintf(&b, "- Run: %s\n", r.RunID)
+	fmt.Fprintf(&b, "- Started: %s\n", r.StartedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Finished: %s\n", r.FinishedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Pipeline: %d/%d steps as expected\n\n", r.Passed(), len(r.Steps))
+
+	b.WriteString("| # | Scenario | Source | Injected | Time to acknowledge | Pipeline |\n")
+	b.WriteString("|---|----------|--------|----------|---------------------|----------|\n")
+	for i, step := range r.Steps {
+		ack := "not acknowledged"
+		if step.Acknowledged() {
+			ack = step.TimeToAcknowledge().Round(time.Second).String()
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s |\n",
+			i+1, step.Scenario, step.Source, step.InjectedAt.UTC().Format("15:04:05"), ack, step.Outcome())
+	}
+
+	var details []string
+	for i, step := range r.Steps {
+		if step.Note == "" && len(step.Failures) == 0 {
+			continue
+		}
+		var lines []string
+		if step.Note != "" {
+			lines = append(lines, "- Responder note: "+step.Note)
+		}
+		for _, failure := range step.Failures {
+			lines = append(lines, "- Failed: "+failure)
+		}
+		details = append(details, fmt.Sprintf("### Step %d: %s\n\n%s\n", i+1, step.Scenario, strings.Join(lines, "\n")))
+	}
+	if len(details) > 0 {
+		b.WriteString("\n## Findings\n\n")
+		b.WriteString(strings.Join(details, "\n"))
+	}
+
+	return b.String()
+}
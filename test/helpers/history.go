@@ -0,0 +1,435 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// RetryPolicy is a single Retry entry of an ASL state
+type RetryPolicy struct {
+	ErrorEquals     []string `json:"ErrorEquals"`
+	IntervalSeconds float64  `json:"IntervalSeconds"`
+	MaxAttempts     int      `json:"MaxAttempts"`
+	BackoffRate     float64  `json:"BackoffRate"`
+	MaxDelaySeconds float64  `json:"MaxDelaySeconds"`
+	JitterStrategy  string   `json:"JitterStrategy"`
+}
+
+// RetryAttempt is a task that failed and was scheduled again within the same state
+type RetryAttempt struct {
+	State         string
+	Attempt       int
+	Error         string
+	FailedAt      time.Time
+	RescheduledAt time.Time
+}
+
+// Delay is the time between the failure and the retry
+func (a RetryAttempt) Delay() time.Duration {
+	return a.RescheduledAt.Sub(a.FailedAt)
+}
+
+// RetryReport holds the retry attempts observed per state in one execution
+type RetryReport struct {
+	ExecutionArn string
+	Attempts     map[string][]RetryAttempt
+}
+
+// Counts returns the number of retries per state
+func (r RetryReport) Counts() map[string]int {
+	counts := map[string]int{}
+	for state, attempts := range r.Attempts {
+		counts[state] = len(attempts)
+	}
+	return counts
+}
+
+// String renders the retry counts and delays per state
+func (r RetryReport) String() string {
+	if len(r.Attempts) == 0 {
+		return fmt.Sprintf("%s: no retries", r.ExecutionArn)
+	}
+
+	states := make([]string, 0, len(r.Attempts))
+	for state := range r.Attempts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", r.ExecutionArn)
+	for _, state := range states {
+		fmt.Fprintf(&b, "  %s: %d retries\n", state, len(r.Attempts[state]))
+		for _, attempt := range r.Attempts[state] {
+			fmt.Fprintf(&b, "    #%d after %s (%s)\n", attempt.Attempt, attempt.Delay().Round(time.Millisecond), attempt.Error)
+		}
+	}
+
+	return b.String()
+}
+
+// ParseRetryPolicies returns the Retry policies of every state in an ASL definition, including nested branches
+func ParseRetryPolicies(definition string) (map[string][]RetryPolicy, error) {
+	var asl aslStates
+	if err := json.Unmarshal([]byte(definition), &asl); err != nil {
+		return nil, fmt.Errorf("failed to parse state machine definition: %w", err)
+	}
+
+	policies := map[string][]RetryPolicy{}
+	asl.collectRetries(policies)
+
+	return policies, nil
+}
+
+type aslStates struct {
+	States map[string]aslState `json:"States"`
+}
+
+type aslState struct {
+	Retry         []RetryPolicy `json:"Retry"`
+	Branches      []aslStates   `json:"Branches"`
+	Iterator      *aslStates    `json:"Iterator"`
+	ItemProcessor *aslStates    `json:"ItemProcessor"`
+}
+
+func (s aslStates) collectRetries(policies map[string][]RetryPolicy) {
+	for name, state := range s.States {
+		if len(state.Retry) > 0 {
+			policies[name] = state.Retry
+		}
+		for _, branch := range state.Branches {
+			branch.collectRetries(policies)
+		}
+		if state.Iterator != nil {
+			state.Iterator.collectRetries(policies)
+		}
+		if state.ItemProcessor != nil {
+			state.ItemProcessor.collectRetries(policies)
+		}
+	}
+}
+
+// UnmarshalJSON reads a retrier, filling in the ASL defaults for omitted fields. MaxAttempts 0
+// means the errors are never retried, so only an omitted MaxAttempts defaults to 3.
+func (p *RetryPolicy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ErrorEquals     []string `json:"ErrorEquals"`
+		IntervalSeconds float64  `json:"IntervalSeconds"`
+		MaxAttempts     *int     `json:"MaxAttempts"`
+		BackoffRate     float64  `json:"BackoffRate"`
+		MaxDelaySeconds float64  `json:"MaxDelaySeconds"`
+		JitterStrategy  string   `json:"JitterStrategy"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = RetryPolicy{
+		ErrorEquals:     raw.ErrorEquals,
+		IntervalSeconds: raw.IntervalSeconds,
+		MaxAttempts:     3,
+		BackoffRate:     raw.BackoffRate,
+		MaxDelaySeconds: raw.MaxDelaySeconds,
+		JitterStrategy:  raw.JitterStrategy,
+	}
+	if raw.MaxAttempts != nil {
+		p.MaxAttempts = *raw.MaxAttempts
+	}
+	if p.IntervalSeconds == 0 {
+		p.IntervalSeconds = 1
+	}
+	if p.BackoffRate == 0 {
+		p.BackoffRate = 2.0
+	}
+	return nil
+}
+
+// matches reports whether the retrier handles the error name
+func (p RetryPolicy) matches(errorName string) bool {
+	for _, candidate := range p.ErrorEquals {
+		switch {
+		case candidate == errorName, candidate == "States.ALL":
+			return true
+		case candidate == "States.TaskFailed" && errorName != "States.Timeout":
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectedDelay returns the backoff before the given retry attempt (1-based), capped by MaxDelaySeconds
+func (p RetryPolicy) ExpectedDelay(attempt int) time.Duration {
+	seconds := p.IntervalSeconds * math.Pow(p.BackoffRate, float64(attempt-1))
+	if p.MaxDelaySeconds > 0 && seconds > p.MaxDelaySeconds {
+		seconds = p.MaxDelaySeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// AnalyzeRetries detects retries per state from task failures followed by a new schedule of the same state
+func AnalyzeRetries(history *sfn.GetExecutionHistoryOutput) map[string][]RetryAttempt {
+	type failure struct {
+		at        time.Time
+		errorName string
+	}
+
+	attempts := map[string][]RetryAttempt{}
+	pending := map[string]failure{}
+	currentState := ""
+
+	for _, event := range history.Events {
+		if event.StateEnteredEventDetails != nil {
+			currentState = aws.StringValue(event.StateEnteredEventDetails.Name)
+			continue
+		}
+
+		if errorName, failed := taskFailure(event); failed {
+			pending[currentState] = failure{at: aws.TimeValue(event.Timestamp), errorName: errorName}
+			continue
+		}
+
+		switch aws.StringValue(event.Type) {
+		case sfn.HistoryEventTypeTaskScheduled, sfn.HistoryEventTypeLambdaFunctionScheduled, sfn.HistoryEventTypeActivityScheduled:
+			if last, ok := pending[currentState]; ok {
+				attempts[currentState] = append(attempts[currentState], RetryAttempt{
+					State:         currentState,
+					Attempt:       len(attempts[currentState]) + 1,
+					Error:         last.errorName,
+					FailedAt:      last.at,
+					RescheduledAt: aws.TimeValue(event.Timestamp),
+				})
+				delete(pending, currentState)
+			}
+		}
+	}
+
+	return attempts
+}
+
+// taskFailure returns the error name of a failed or timed out task event
+func taskFailure(event *sfn.HistoryEvent) (string, bool) {
+	switch {
+	case event.TaskFailedEventDetails != nil:
+		return aws.StringValue(event.TaskFailedEventDetails.Error), true
+	case event.LambdaFunctionFailedEventDetails != nil:
+		return aws.StringValue(event.LambdaFunctionFailedEventDetails.Error), true
+	case event.ActivityFailedEventDetails != nil:
+		return aws.StringValue(event.ActivityFailedEventDetails.Error), true
+	case event.TaskTimedOutEventDetails != nil, event.LambdaFunctionTimedOutEventDetails != nil, event.ActivityTimedOutEventDetails != nil:
+		return "States.Timeout", true
+	}
+	return "", false
+}
+
+// CheckRetryPolicy compares observed retries of one state against its Retry policies. Delays must be
+// within tolerance of the backoff, or anywhere up to it when the retrier uses FULL jitter.
+func CheckRetryPolicy(policies []RetryPolicy, attempts []RetryAttempt, tolerance time.Duration) error {
+	retrierAttempts := make([]int, len(policies))
+
+	for _, attempt := range attempts {
+		index := -1
+		for i, policy := range policies {
+			if policy.matches(attempt.Error) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("state %s retried %s, which no Retry policy handles", attempt.State, attempt.Error)
+		}
+
+		policy := policies[index]
+		retrierAttempts[index]++
+		n := retrierAttempts[index]
+
+		if n > policy.MaxAttempts {
+			return fmt.Errorf("state %s retried %s %d times, policy allows %d", attempt.State, attempt.Error, n, policy.MaxAttempts)
+		}
+
+		expected := policy.ExpectedDelay(n)
+		actual := attempt.Delay()
+
+		if strings.EqualFold(policy.JitterStrategy, "FULL") {
+			if actual > expected+tolerance {
+				return fmt.Errorf("state %s retry #%d waited %s, jittered backoff allows at most %s", attempt.State, n, actual, expected)
+			}
+			continue
+		}
+
+		if actual < expected-tolerance || actual > expected+tolerance {
+			return fmt.Errorf("state %s retry #%d waited %s, expected %s (±%s)", attempt.State, n, actual, expected, tolerance)
+		}
+	}
+
+	return nil
+}
+
+// AssertRetryPolicies asserts that every retry in an execution follows the Retry policies of the
+// state machine definition and returns the observed retries for reporting
+func AssertRetryPolicies(sess *session.Session, executionArn string, tolerance time.Duration) (RetryReport, error) {
+	report := RetryReport{ExecutionArn: executionArn}
+	sfnClient := sfn.New(sess)
+
+	execution, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+		ExecutionArn: aws.String(executionArn),
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to describe execution: %w", err)
+	}
+
+	stateMachine, err := sfnClient.DescribeStateMachine(&sfn.DescribeStateMachineInput{
+		StateMachineArn: execution.StateMachineArn,
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to describe state machine: %w", err)
+	}
+
+	policies, err := ParseRetryPolicies(aws.StringValue(stateMachine.Definition))
+	if err != nil {
+		return report, err
+	}
+
+	history, err := GetStepFunctionExecutionHistory(sess, executionArn)
+	if err != nil {
+		return report, fmt.Errorf("failed to get execution history: %w", err)
+	}
+
+	report.Attempts = AnalyzeRetries(history)
+
+	for state, attempts := range report.Attempts {
+		if err := CheckRetryPolicy(policies[state], attempts, tolerance); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// DefaultStateBudgets are the per-state duration budgets of the IR state machine. Together they stay
+// well inside the overall execution budget, so the state that blew it stands out.
+var DefaultStateBudgets = map[string]time.Duration{
+	"StoreEvidence":     30 * time.Second,
+	"IsolateResource":   60 * time.Second,
+	"Notify":            15 * time.Second,
+	"UpdateSecurityHub": 15 * time.Second,
+}
+
+// ParseStateBudgets parses budgets written as "StoreEvidence=30s,Notify=15s" on top of DefaultStateBudgets
+func ParseStateBudgets(raw string) (map[string]time.Duration, error) {
+	budgets := map[string]time.Duration{}
+	for state, budget := range DefaultStateBudgets {
+		budgets[state] = budget
+	}
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		state, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid state budget %q, expected State=duration", part)
+		}
+		budget, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget for state %s: %w", state, err)
+		}
+		budgets[strings.TrimSpace(state)] = budget
+	}
+
+	return budgets, nil
+}
+
+// AnalyzeStateDurations returns the time spent in each state, from StateEntered to StateExited. A
+// state entered several times accumulates, and a state that never exited runs until the last event.
+func AnalyzeStateDurations(history *sfn.GetExecutionHistoryOutput) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	entered := map[string]time.Time{}
+	var last time.Time
+
+	for _, event := range history.Events {
+		last = aws.TimeValue(event.Timestamp)
+
+		switch {
+		case event.StateEnteredEventDetails != nil:
+			entered[aws.StringValue(event.StateEnteredEventDetails.Name)] = last
+		case event.StateExitedEventDetails != nil:
+			name := aws.StringValue(event.StateExitedEventDetails.Name)
+			if start, ok := entered[name]; ok {
+				durations[name] += last.Sub(start)
+				delete(entered, name)
+			}
+		}
+	}
+
+	for name, start := range entered {
+		durations[name] += last.Sub(start)
+	}
+
+	return durations
+}
+
+// CheckStateBudgets compares state durations against their budgets and names every state over
+// budget. States without a budget are not checked.
+func CheckStateBudgets(durations, budgets map[string]time.Duration) error {
+	states := make([]string, 0, len(budgets))
+	for state := range budgets {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	var regressed []string
+	for _, state := range states {
+		if duration, ok := durations[state]; ok && duration > budgets[state] {
+			regressed = append(regressed, fmt.Sprintf("%s took %s (budget %s)", state, duration.Round(time.Millisecond), budgets[state]))
+		}
+	}
+
+	if len(regressed) > 0 {
+		return fmt.Errorf("states over budget: %s", strings.Join(regressed, "; "))
+	}
+
+	return nil
+}
+
+// AssertStateBudgets asserts that every state of an execution stayed within its budget and returns
+// the observed durations for reporting
+func AssertStateBudgets(sess *session.Session, executionArn string, budgets map[string]time.Duration) (map[string]time.Duration, error) {
+	history, err := GetStepFunctionExecutionHistory(sess, executionArn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get execution history: %w", err)
+	}
+
+	durations := AnalyzeStateDurations(history)
+	return durations, CheckStateBudgets(durations, budgets)
+}
+
+// MapIterations counts the iterations of a Map state that succeeded and those that failed or were aborted
+func MapIterations(history *sfn.GetExecutionHistoryOutput, state string) (succeeded, failed int) {
+	for _, event := range history.Events {
+		switch {
+		case event.MapIterationSucceededEventDetails != nil:
+			if aws.StringValue(event.MapIterationSucceededEventDetails.Name) == state {
+				succeeded++
+			}
+		case event.MapIterationFailedEventDetails != nil:
+			if aws.StringValue(event.MapIterationFailedEventDetails.Name) == state {
+				failed++
+			}
+		case event.MapIterationAbortedEventDetails != nil:
+			if aws.StringValue(event.MapIterationAbortedEventDetails.Name) == state {
+				failed++
+			}
+		}
+	}
+	return succeeded, failed
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryPolicies(t *testing.T) {
+	definition := `{
+	  "StartAt": "StoreEvidence",
+	  "States": {
+	    "StoreEvidence": {
+	      "Type": "Task",
+	      "Retry": [{"ErrorEquals": ["States.TaskFailed"]}]
+	    },
+	    "Notify": {
+	      "Type": "Task",
+	      "Retry": [{"ErrorEquals": ["States.ALL"], "MaxAttempts": 0}]
+	    },
+	    "IsolateResource": {
+	      "Type": "Map",
+	      "ItemProcessor": {
+	        "States": {
+	          "ModifyInterface": {
+	            "Type": "Task",
+	            "Retry": [{"ErrorEquals": ["States.TaskFailed"], "IntervalSeconds": 2, "MaxAttempts": 5, "BackoffRate": 1.5, "JitterStrategy": "FULL"}]
+	          }
+	        }
+	      }
+	    },
+	    "Done": {"Type": "Succeed"}
+	  }
+	}`
+
+	policies, err := ParseRetryPolicies(definition)
+	require.NoError(t, err)
+
+	tests := []struct {
+		state string
+		want  RetryPolicy
+	}{
+		{"StoreEvidence", RetryPolicy{ErrorEquals: []string{"States.TaskFailed"}, IntervalSeconds: 1, MaxAttempts: 3, BackoffRate: 2}},
+		{"Notify", RetryPolicy{ErrorEquals: []string{"States.ALL"}, IntervalSeconds: 1, MaxAttempts: 0, BackoffRate: 2}},
+		{"ModifyInterface", RetryPolicy{ErrorEquals: []string{"States.TaskFailed"}, IntervalSeconds: 2, MaxAttempts: 5, BackoffRate: 1.5, JitterStrategy: "FULL"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, []RetryPolicy{test.want}, policies[test.state], test.state)
+	}
+	assert.NotContains(t, policies, "Done")
+
+	_, err = ParseRetryPolicies(`{"States": {"Notify": {"Retry": [{"MaxAttempts": "3"}]}}}`)
+	assert.Error(t, err)
+}
+
+func TestCheckRetryPolicy(t *testing.T) {
+	failedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	retry := func(attempt int, errorName string, delay time.Duration) RetryAttempt {
+		return RetryAttempt{State: "Notify", Attempt: attempt, Error: errorName, FailedAt: failedAt, RescheduledAt: failedAt.Add(delay)}
+	}
+	backoff := RetryPolicy{ErrorEquals: []string{"States.TaskFailed"}, IntervalSeconds: 2, MaxAttempts: 2, BackoffRate: 2}
+	never := RetryPolicy{ErrorEquals: []string{"States.ALL"}, IntervalSeconds: 1, MaxAttempts: 0, BackoffRate: 2}
+	jittered := backoff
+	jittered.JitterStrategy = "FULL"
+
+	tests := []struct {
+		name     string
+		policies []RetryPolicy
+		attempts []RetryAttempt
+		wantErr  string
+	}{
+		{
+			name:     "backoff",
+			policies: []RetryPolicy{backoff},
+			attempts: []RetryAttempt{retry(1, "Lambda.ServiceException", 2*time.Second), retry(2, "Lambda.ServiceException", 4*time.Second)},
+		},
+		{
+			name:     "too many",
+			policies: []RetryPolicy{backoff},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", 2*time.Second), retry(2, "States.TaskFailed", 4*time.Second), retry(3, "States.TaskFailed", 8*time.Second)},
+			wantErr:  "state Notify retried States.TaskFailed 3 times, policy allows 2",
+		},
+		{
+			name:     "never retried",
+			policies: []RetryPolicy{never},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", time.Second)},
+			wantErr:  "state Notify retried States.TaskFailed 1 times, policy allows 0",
+		},
+		{
+			name:     "timeouts not task failures",
+			policies: []RetryPolicy{backoff},
+			attempts: []RetryAttempt{retry(1, "States.Timeout", 2*time.Second)},
+			wantErr:  "state Notify retried States.Timeout, which no Retry policy handles",
+		},
+		{
+			name:     "first matching retrier",
+			policies: []RetryPolicy{never, backoff},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", 2*time.Second)},
+			wantErr:  "policy allows 0",
+		},
+		{
+			name:     "too early",
+			policies: []RetryPolicy{backoff},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", time.Second)},
+			wantErr:  "state Notify retry #1 waited 1s, expected 2s",
+		},
+		{
+			name:     "jitter waits up to the backoff",
+			policies: []RetryPolicy{jittered},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", 100*time.Millisecond), retry(2, "States.TaskFailed", 4*time.Second)},
+		},
+		{
+			name:     "jitter beyond the backoff",
+			policies: []RetryPolicy{jittered},
+			attempts: []RetryAttempt{retry(1, "States.TaskFailed", 3*time.Second)},
+			wantErr:  "jittered backoff allows at most 2s",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckRetryPolicy(test.policies, test.attempts, 500*time.Millisecond)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
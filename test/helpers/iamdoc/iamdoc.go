@@ -0,0 +1,495 @@
+// Package iamdoc parses IAM, bucket, KMS key and SNS topic policy documents into typed statements
+// and answers questions about them, so suites check what a policy grants and denies instead of
+// searching its JSON for strings. It does not evaluate policies the way IAM does; questions that
+// depend on the request context, such as whether a role may call an action on a resource, belong
+// to the policy simulator (see helpers.SimulatePrincipalActions).
+package iamdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Effects of a statement
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// Policy is a parsed policy document
+type Policy struct {
+	Version    string
+	ID         string
+	Statements []Statement
+}
+
+// Statement is one statement of a policy. Action, Resource and their Not forms are lists even
+// when the document writes a single string.
+type Statement struct {
+	Sid          string
+	Effect       string
+	Principal    Principal
+	NotPrincipal Principal
+	Action       StringList
+	NotAction    StringList
+	Resource     StringList
+	NotResource  StringList
+	Condition    Conditions
+}
+
+// StringList is a policy element written either as a string or as a list of strings
+type StringList []string
+
+// Principal is a statement's principal: either everyone ("*") or principals by type, e.g. "AWS",
+// "Service" or "Federated"
+type Principal struct {
+	All    bool
+	ByType map[string]StringList
+}
+
+// Conditions are a statement's conditions, by operator and then by key. Values are kept as
+// strings; booleans and numbers are written the way IAM compares them.
+type Conditions map[string]map[string]StringList
+
+// Parse parses a policy document. Documents returned URL-encoded, as IAM's GetPolicyVersion and
+// GetRolePolicy return them, are decoded first.
+func Parse(document string) (*Policy, error) {
+	document = strings.TrimSpace(document)
+	if strings.HasPrefix(document, "%7B") || strings.HasPrefix(document, "%7b") {
+		decoded, err := url.QueryUnescape(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode policy document: %w", err)
+		}
+		document = decoded
+	}
+
+	var raw struct {
+		Version   string          `json:"Version"`
+		ID        string          `json:"Id"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+
+	policy := &Policy{Version: raw.Version, ID: raw.ID}
+	switch {
+	case len(raw.Statement) == 0:
+	case raw.Statement[0] == '[':
+		if err := json.Unmarshal(raw.Statement, &policy.Statements); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statements: %w", err)
+		}
+	default:
+		var statement Statement
+		if err := json.Unmarshal(raw.Statement, &statement); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statement: %w", err)
+		}
+		policy.Statements = []Statement{statement}
+	}
+
+	for i, statement := range policy.Statements {
+		if statement.Effect != Allow && statement.Effect != Deny {
+			return nil, fmt.Errorf("statement %d has effect %q, expected %s or %s", i, statement.Effect, Allow, Deny)
+		}
+	}
+	return policy, nil
+}
+
+// UnmarshalJSON reads a statement, keeping Principal and Condition in their typed forms
+func (s *Statement) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Sid          string                                `json:"Sid"`
+		Effect       string                                `json:"Effect"`
+		Principal    json.RawMessage                       `json:"Principal"`
+		NotPrincipal json.RawMessage                       `json:"NotPrincipal"`
+		Action       StringList                            `json:"Action"`
+		NotAction    StringList                            `json:"NotAction"`
+		Resource     StringList                            `json:"Resource"`
+		NotResource  StringList                            `json:"NotResource"`
+		Condition    map[string]map[string]json.RawMessage `json:"Condition"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*s = Statement{
+		Sid:         raw.Sid,
+		Effect:      raw.Effect,
+		Action:      raw.Action,
+		NotAction:   raw.NotAction,
+		Resource:    raw.Resource,
+		NotResource: raw.NotResource,
+	}
+	var err error
+	if s.Principal, err = parsePrincipal(raw.Principal); err != nil {
+		return fmt.Errorf("statement %q: %w", raw.Sid, err)
+	}
+	if s.NotPrincipal, err = parsePrincipal(raw.NotPrincipal); err != nil {
+		return fmt.Errorf("statement %q: %w", raw.Sid, err)
+	}
+
+	if len(raw.Condition) > 0 {
+		s.Condition = Conditions{}
+		for operator, keys := range raw.Condition {
+			s.Condition[operator] = map[string]StringList{}
+			for key, value := range keys {
+				values, err := scalarList(value)
+				if err != nil {
+					return fmt.Errorf("statement %q: condition %s %s: %w", raw.Sid, operator, key, err)
+				}
+				s.Condition[operator][key] = values
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads a string or a list of strings
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	values, err := scalarList(data)
+	if err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// scalarList reads a scalar or a list of scalars as strings
+func scalarList(data json.RawMessage) (StringList, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var items []interface{}
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		var item interface{}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		items = []interface{}{item}
+	}
+
+	values := make(StringList, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			values = append(values, v)
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("unexpected value %v", item)
+		}
+	}
+	return values, nil
+}
+
+func parsePrincipal(data json.RawMessage) (Principal, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return Principal{}, nil
+	}
+
+	var all string
+	if err := json.Unmarshal(data, &all); err == nil {
+		if all != "*" {
+			return Principal{}, fmt.Errorf("principal %q must be \"*\" or a mapping", all)
+		}
+		return Principal{All: true}, nil
+	}
+
+	var byType map[string]StringList
+	if err := json.Unmarshal(data, &byType); err != nil {
+		return Principal{}, fmt.Errorf("failed to parse principal: %w", err)
+	}
+	return Principal{ByType: byType}, nil
+}
+
+// Empty reports whether the statement names no principal, as in identity policies
+func (p Principal) Empty() bool {
+	return !p.All && len(p.ByType) == 0
+}
+
+// Matches reports whether the principal covers the ARN or service name: everyone, the ARN itself
+// or a pattern matching it, or the ARN's account written as an ID or as its root ARN
+func (p Principal) Matches(principal string) bool {
+	if p.All {
+		return true
+	}
+	account := accountOf(principal)
+	for _, values := range p.ByType {
+		for _, value := range values {
+			if value == "*" || Match(value, principal) {
+				return true
+			}
+			if account != "" && (value == account || accountRoot(value) == account) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accountOf returns the account ID of an ARN, or "" for anything else
+func accountOf(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// accountRoot returns the account of an account root ARN, e.g. arn:aws:iam::111122223333:root
+func accountRoot(arn string) string {
+	if strings.HasSuffix(arn, ":root") {
+		return accountOf(arn)
+	}
+	return ""
+}
+
+// Allows reports whether the statement is an Allow
+func (s Statement) Allows() bool { return s.Effect == Allow }
+
+// Denies reports whether the statement is a Deny
+func (s Statement) Denies() bool { return s.Effect == Deny }
+
+// CoversAction reports whether the statement applies to the action: one of its Action patterns
+// matches it, or it has NotAction and none of those patterns match
+func (s Statement) CoversAction(action string) bool {
+	if len(s.NotAction) > 0 {
+		return !matchesAny(s.NotAction, action)
+	}
+	return matchesAny(s.Action, action)
+}
+
+// CoversResource reports whether the statement applies to the resource ARN
+func (s Statement) CoversResource(resource string) bool {
+	if len(s.NotResource) > 0 {
+		return !matchesAny(s.NotResource, resource)
+	}
+	return matchesAny(s.Resource, resource)
+}
+
+// CoversPrincipal reports whether the statement applies to the principal. A statement without a
+// principal, as in identity policies, applies to whoever the policy is attached to.
+func (s Statement) CoversPrincipal(principal string) bool {
+	if !s.NotPrincipal.Empty() {
+		return !s.NotPrincipal.Matches(principal)
+	}
+	if s.Principal.Empty() {
+		return true
+	}
+	return s.Principal.Matches(principal)
+}
+
+// Conditional reports whether the statement has conditions
+func (s Statement) Conditional() bool { return len(s.Condition) > 0 }
+
+// ConditionValues returns the values the statement's condition compares the key with under the
+// operator, e.g. ("Bool", "aws:SecureTransport"). Operators and keys compare case-insensitively,
+// and an operator with the IfExists or ForAnyValue/ForAllValues qualifiers matches its base name.
+func (s Statement) ConditionValues(operator, key string) (StringList, bool) {
+	for op, keys := range s.Condition {
+		if !strings.EqualFold(baseOperator(op), baseOperator(operator)) {
+			continue
+		}
+		for k, values := range keys {
+			if strings.EqualFold(k, key) {
+				return values, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// TestsKey reports whether any of the statement's conditions tests the key
+func (s Statement) TestsKey(key string) bool {
+	for _, keys := range s.Condition {
+		for k := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// baseOperator strips the set and IfExists qualifiers of a condition operator
+func baseOperator(operator string) string {
+	if i := strings.Index(operator, ":"); i >= 0 {
+		operator = operator[i+1:]
+	}
+	return strings.TrimSuffix(operator, "IfExists")
+}
+
+// HasWildcardAction reports whether an Allow statement grants every action, or every action of a
+// service such as "s3:*", including through NotAction, which allows everything it does not list
+func (p *Policy) HasWildcardAction() bool {
+	for _, statement := range p.Statements {
+		if !statement.Allows() {
+			continue
+		}
+		if len(statement.NotAction) > 0 {
+			return true
+		}
+		for _, action := range statement.Action {
+			if action == "*" || strings.HasSuffix(action, ":*") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowsPrincipal reports whether an Allow statement applies to the principal and no Deny statement
+// without conditions takes every action it allows away again
+func (p *Policy) AllowsPrincipal(principal string) bool {
+	for _, statement := range p.Statements {
+		if !statement.Allows() || !statement.CoversPrincipal(principal) {
+			continue
+		}
+		if !p.unconditionallyDenied(principal, statement.Action) {
+			return true
+		}
+	}
+	return false
+}
+
+// unconditionallyDenied reports whether a Deny statement without conditions covers the principal
+// and every one of the actions
+func (p *Policy) unconditionallyDenied(principal string, actions StringList) bool {
+	for _, statement := range p.Statements {
+		if !statement.Denies() || statement.Conditional() || !statement.CoversPrincipal(principal) {
+			continue
+		}
+		denied := len(actions) > 0
+		for _, action := range actions {
+			if !statement.CoversAction(action) {
+				denied = false
+				break
+			}
+		}
+		if denied {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionRequires reports whether the policy makes the condition key a requirement: a Deny
+// statement tests it, so requests that do not satisfy the condition are refused, as a bucket policy
+// denying requests where aws:SecureTransport is false requires TLS
+func (p *Policy) ConditionRequires(key string) bool {
+	return len(p.DeniesUnless(key)) > 0
+}
+
+// DeniesUnless returns the Deny statements that test the condition key
+func (p *Policy) DeniesUnless(key string) []Statement {
+	var statements []Statement
+	for _, statement := range p.Statements {
+		if statement.Denies() && statement.TestsKey(key) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// AllowedActions returns the action patterns Allow statements grant, sorted and without duplicates
+func (p *Policy) AllowedActions() []string {
+	seen := map[string]bool{}
+	var actions []string
+	for _, statement := range p.Statements {
+		if !statement.Allows() {
+			continue
+		}
+		for _, action := range statement.Action {
+			if !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// AllowsAction reports whether an Allow statement covers the action, e.g. "s3:DeleteBucket", and no
+// Deny statement without conditions covers it too
+func (p *Policy) AllowsAction(action string) bool {
+	allowed := false
+	for _, statement := range p.Statements {
+		if !statement.CoversAction(action) {
+			continue
+		}
+		if statement.Denies() && !statement.Conditional() {
+			return false
+		}
+		if statement.Allows() {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// Statement returns the statement with the Sid
+func (p *Policy) Statement(sid string) (Statement, bool) {
+	for _, statement := range p.Statements {
+		if statement.Sid == sid {
+			return statement, true
+		}
+	}
+	return Statement{}, false
+}
+
+func matchesAny(patterns StringList, value string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the value matches a policy pattern, where * matches any run of characters
+// and ? any single one. Actions compare case-insensitively, as IAM compares them; patterns holding
+// an ARN compare exactly.
+func Match(pattern, value string) bool {
+	if !strings.HasPrefix(pattern, "arn:") {
+		pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	}
+	return glob(pattern, value)
+}
+
+// glob matches * and ? iteratively, backtracking to the last * on a mismatch
+func glob(pattern, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,265 @@
+package iamdoc
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStringOrArray(t *testing.T) {
+	tests := []struct {
+		name          string
+		document      string
+		wantAction    StringList
+		wantResource  StringList
+		wantPrincipal Principal
+	}{
+		{
+			name:         "strings",
+			document:     `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::evidence/*"}}`,
+			wantAction:   StringList{"s3:GetObject"},
+			wantResource: StringList{"arn:aws:s3:::evidence/*"},
+		},
+		{
+			name:         "arrays",
+			document:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::evidence","arn:aws:s3:::evidence/*"]}]}`,
+			wantAction:   StringList{"s3:GetObject", "s3:PutObject"},
+			wantResource: StringList{"arn:aws:s3:::evidence", "arn:aws:s3:::evidence/*"},
+		},
+		{
+			name:          "principal everyone",
+			document:      `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"*"}]}`,
+			wantAction:    StringList{"s3:*"},
+			wantResource:  StringList{"*"},
+			wantPrincipal: Principal{All: true},
+		},
+		{
+			name:          "principal string by type",
+			document:      `{"Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`,
+			wantAction:    StringList{"sts:AssumeRole"},
+			wantPrincipal: Principal{ByType: map[string]StringList{"Service": {"lambda.amazonaws.com"}}},
+		},
+		{
+			name:          "principal array by type",
+			document:      `{"Statement":[{"Effect":"Allow","Principal":{"AWS":["111122223333","arn:aws:iam::444455556666:root"]},"Action":["kms:Decrypt"]}]}`,
+			wantAction:    StringList{"kms:Decrypt"},
+			wantPrincipal: Principal{ByType: map[string]StringList{"AWS": {"111122223333", "arn:aws:iam::444455556666:root"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := Parse(test.document)
+			require.NoError(t, err)
+			require.Len(t, policy.Statements, 1)
+
+			statement := policy.Statements[0]
+			assert.Equal(t, test.wantAction, statement.Action)
+			assert.Equal(t, test.wantResource, statement.Resource)
+			assert.Equal(t, test.wantPrincipal, statement.Principal)
+		})
+	}
+}
+
+func TestParseURLEncoded(t *testing.T) {
+	document := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"logs:PutLogEvents","Resource":"*"}]}`
+	policy, err := Parse(url.QueryEscape(document))
+	require.NoError(t, err)
+	assert.Equal(t, "2012-10-17", policy.Version)
+	assert.True(t, policy.AllowsAction("logs:PutLogEvents"))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{name: "not JSON", document: `Statement`},
+		{name: "unknown effect", document: `{"Statement":[{"Effect":"Maybe","Action":"s3:*"}]}`},
+		{name: "principal string other than everyone", document: `{"Statement":[{"Effect":"Allow","Principal":"lambda.amazonaws.com","Action":"sts:AssumeRole"}]}`},
+		{name: "object action", document: `{"Statement":[{"Effect":"Allow","Action":{"s3":"*"}}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.document)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConditionValues(t *testing.T) {
+	policy, err := Parse(`{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"*",
+		"Condition":{"Bool":{"aws:SecureTransport":false},"NumericLessThanIfExists":{"s3:TlsVersion":1.2},"ForAnyValue:StringEquals":{"aws:PrincipalTag/team":["ir","soc"]}}}]}`)
+	require.NoError(t, err)
+	statement := policy.Statements[0]
+
+	tests := []struct {
+		operator, key string
+		want          StringList
+		found         bool
+	}{
+		{"Bool", "aws:SecureTransport", StringList{"false"}, true},
+		{"bool", "AWS:SECURETRANSPORT", StringList{"false"}, true},
+		{"NumericLessThan", "s3:TlsVersion", StringList{"1.2"}, true},
+		{"StringEquals", "aws:PrincipalTag/team", StringList{"ir", "soc"}, true},
+		{"StringEquals", "aws:SecureTransport", nil, false},
+	}
+	for _, test := range tests {
+		values, found := statement.ConditionValues(test.operator, test.key)
+		assert.Equal(t, test.found, found, "%s %s", test.operator, test.key)
+		assert.Equal(t, test.want, values, "%s %s", test.operator, test.key)
+	}
+	assert.True(t, policy.ConditionRequires("aws:SecureTransport"))
+	assert.False(t, policy.ConditionRequires("aws:SourceVpce"))
+}
+
+func TestCoversAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement Statement
+		action    string
+		want      bool
+	}{
+		{name: "exact", statement: Statement{Action: StringList{"s3:GetObject"}}, action: "s3:GetObject", want: true},
+		{name: "case-insensitive", statement: Statement{Action: StringList{"S3:getobject"}}, action: "s3:GetObject", want: true},
+		{name: "service wildcard", statement: Statement{Action: StringList{"s3:*"}}, action: "s3:DeleteBucket", want: true},
+		{name: "prefix wildcard", statement: Statement{Action: StringList{"s3:Get*"}}, action: "s3:PutObject", want: false},
+		{name: "single character", statement: Statement{Action: StringList{"ec2:?escribeInstances"}}, action: "ec2:DescribeInstances", want: true},
+		{name: "not action excludes", statement: Statement{NotAction: StringList{"iam:*"}}, action: "iam:CreateUser", want: false},
+		{name: "not action covers the rest", statement: Statement{NotAction: StringList{"iam:*"}}, action: "s3:GetObject", want: true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.statement.CoversAction(test.action), test.name)
+	}
+}
+
+func TestPrincipalMatches(t *testing.T) {
+	const role = "arn:aws:iam::111122223333:role/ir-triage"
+	tests := []struct {
+		name      string
+		principal Principal
+		want      bool
+	}{
+		{name: "everyone", principal: Principal{All: true}, want: true},
+		{name: "exact ARN", principal: Principal{ByType: map[string]StringList{"AWS": {role}}}, want: true},
+		{name: "ARN pattern", principal: Principal{ByType: map[string]StringList{"AWS": {"arn:aws:iam::111122223333:role/ir-*"}}}, want: true},
+		{name: "account ID", principal: Principal{ByType: map[string]StringList{"AWS": {"111122223333"}}}, want: true},
+		{name: "account root", principal: Principal{ByType: map[string]StringList{"AWS": {"arn:aws:iam::111122223333:root"}}}, want: true},
+		{name: "other account", principal: Principal{ByType: map[string]StringList{"AWS": {"444455556666"}}}, want: false},
+		{name: "none", principal: Principal{}, want: false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.principal.Matches(role), test.name)
+	}
+}
+
+func TestCoversPrincipal(t *testing.T) {
+	const role = "arn:aws:iam::111122223333:role/ir-triage"
+	identity := Statement{Effect: Allow}
+	assert.True(t, identity.CoversPrincipal(role), "a statement without a principal applies to whoever holds the policy")
+
+	notPrincipal := Statement{Effect: Deny, NotPrincipal: Principal{ByType: map[string]StringList{"AWS": {role}}}}
+	assert.False(t, notPrincipal.CoversPrincipal(role))
+	assert.True(t, notPrincipal.CoversPrincipal("arn:aws:iam::111122223333:role/other"))
+}
+
+func TestPolicyQuestions(t *testing.T) {
+	policy, err := Parse(`{"Statement":[
+		{"Sid":"Read","Effect":"Allow","Action":["s3:GetObject","s3:ListBucket"],"Resource":"*"},
+		{"Sid":"Write","Effect":"Allow","Action":"s3:PutObject","Resource":"*"},
+		{"Sid":"NoDelete","Effect":"Deny","Action":"s3:Delete*","Resource":"*"},
+		{"Sid":"NoPlainText","Effect":"Deny","Action":"s3:PutObject","Resource":"*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`)
+	require.NoError(t, err)
+
+	assert.True(t, policy.AllowsAction("s3:GetObject"))
+	assert.True(t, policy.AllowsAction("s3:PutObject"), "a conditional deny does not take the action away")
+	assert.False(t, policy.AllowsAction("s3:DeleteObject"))
+	assert.False(t, policy.AllowsAction("iam:PassRole"))
+	assert.False(t, policy.HasWildcardAction())
+	assert.Equal(t, []string{"s3:GetObject", "s3:ListBucket", "s3:PutObject"}, policy.AllowedActions())
+
+	statement, ok := policy.Statement("NoDelete")
+	require.True(t, ok)
+	assert.True(t, statement.Denies())
+	_, ok = policy.Statement("Missing")
+	assert.False(t, ok)
+}
+
+func TestHasWildcardAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     bool
+	}{
+		{name: "everything", document: `{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`, want: true},
+		{name: "whole service", document: `{"Statement":[{"Effect":"Allow","Action":["s3:GetObject","kms:*"],"Resource":"*"}]}`, want: true},
+		{name: "not action", document: `{"Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`, want: true},
+		{name: "denied wildcard", document: `{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`, want: false},
+		{name: "prefix only", document: `{"Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`, want: false},
+	}
+	for _, test := range tests {
+		policy, err := Parse(test.document)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, policy.HasWildcardAction(), test.name)
+	}
+}
+
+func TestAllowsPrincipal(t *testing.T) {
+	const role = "arn:aws:iam::111122223333:role/ir-triage"
+	tests := []struct {
+		name     string
+		document string
+		want     bool
+	}{
+		{
+			name:     "allowed",
+			document: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"111122223333"},"Action":"kms:Decrypt","Resource":"*"}]}`,
+			want:     true,
+		},
+		{
+			name: "denied again",
+			document: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"111122223333"},"Action":"kms:Decrypt","Resource":"*"},
+				{"Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*"}]}`,
+			want: false,
+		},
+		{
+			name: "conditionally denied",
+			document: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"111122223333"},"Action":"kms:Decrypt","Resource":"*"},
+				{"Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`,
+			want: true,
+		},
+		{
+			name:     "other account",
+			document: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"444455556666"},"Action":"kms:Decrypt","Resource":"*"}]}`,
+			want:     false,
+		},
+	}
+	for _, test := range tests {
+		policy, err := Parse(test.document)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, policy.AllowsPrincipal(role), test.name)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "anything", true},
+		{"s3:*Object", "s3:GetObject", true},
+		{"s3:*Object", "s3:GetObjectAcl", false},
+		{"s3:*Object*", "s3:GetObjectAcl", true},
+		{"S3:GETOBJECT", "s3:GetObject", true},
+		// ARN patterns compare exactly
+		{"arn:aws:s3:::Evidence/*", "arn:aws:s3:::evidence/key", false},
+		{"arn:aws:s3:::evidence/*", "arn:aws:s3:::evidence/findings/abc.json", true},
+		{"arn:aws:s3:::evidence", "arn:aws:s3:::evidence-logs", false},
+		{"", "", true},
+		{"?", "", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, Match(test.pattern, test.value), "%q matches %q", test.pattern, test.value)
+	}
+}
@@ -0,0 +1,233 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Incident index GSIs and the statuses triage records, as in the lambda_triage module
+const (
+	IncidentsByResource = "by-resource"
+	IncidentsByStatus   = "by-status"
+
+	IncidentOpen     = "open"
+	IncidentExempt   = "exempt"
+	IncidentDeferred = "deferred"
+	// IncidentEscalated is recorded for findings escalated as the recurrence of an earlier one
+	IncidentEscalated = "escalated"
+	// IncidentSandbox is recorded for findings from sandbox accounts, which are not contained
+	IncidentSandbox = "sandbox"
+)
+
+// incidentIndexKeys are the hash and range keys each GSI must have
+var incidentIndexKeys = map[string][2]string{
+	IncidentsByResource: {"resource_id", "updated_at"},
+	IncidentsByStatus:   {"status", "updated_at"},
+}
+
+// Incident is a finding's item in the incident index
+type Incident struct {
+	FindingID   string `dynamodbav:"finding_id"`
+	FindingType string `dynamodbav:"finding_type"`
+	ResourceID  string `dynamodbav:"resource_id"`
+	// Resources are all the finding's containment targets, comma separated
+	Resources   string  `dynamodbav:"resources"`
+	Status      string  `dynamodbav:"status"`
+	Severity    float64 `dynamodbav:"severity"`
+	CreatedAt   int64   `dynamodbav:"created_at"`
+	UpdatedAt   int64   `dynamodbav:"updated_at"`
+	ExpiresAt   int64   `dynamodbav:"expires_at"`
+	TriageCount int     `dynamodbav:"triage_count"`
+	// RecurrenceOf is the earlier finding an escalated finding recurs
+	RecurrenceOf string `dynamodbav:"recurrence_of"`
+}
+
+// Recurrence links a finding escalated as a recurrence to the earlier finding of the same type on
+// its resource, in the evidence, the execution input and the notification
+type Recurrence struct {
+	PreviousFindingID string `json:"previous_finding_id"`
+	PreviousTriagedAt int64  `json:"previous_triaged_at"`
+	// PreviousEvidence is the evidence key of the earlier finding
+	PreviousEvidence string `json:"previous_evidence"`
+}
+
+// AssertIncidentTable checks that the incident index has its GSIs by resource and by status, expires
+// items on expires_at and has point-in-time recovery enabled
+func AssertIncidentTable(sess *session.Session, table string) error {
+	dynamoClient := dynamodb.New(sess)
+
+	described, err := dynamoClient.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("failed to describe %s: %w", table, err)
+	}
+
+	var problems []string
+
+	indexes := map[string]*dynamodb.GlobalSecondaryIndexDescription{}
+	for _, index := range described.Table.GlobalSecondaryIndexes {
+		indexes[aws.StringValue(index.IndexName)] = index
+	}
+	for name, keys := range incidentIndexKeys {
+		index, ok := indexes[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("GSI %s is missing", name))
+			continue
+		}
+		schema := map[string]string{}
+		for _, key := range index.KeySchema {
+			schema[aws.StringValue(key.KeyType)] = aws.StringValue(key.AttributeName)
+		}
+		if schema[dynamodb.KeyTypeHash] != keys[0] || schema[dynamodb.KeyTypeRange] != keys[1] {
+			problems = append(problems, fmt.Sprintf("GSI %s is keyed on %s/%s, expected %s/%s",
+				name, schema[dynamodb.KeyTypeHash], schema[dynamodb.KeyTypeRange], keys[0], keys[1]))
+		}
+		if aws.StringValue(index.Projection.ProjectionType) != dynamodb.ProjectionTypeAll {
+			problems = append(problems, fmt.Sprintf("GSI %s does not project all attributes", name))
+		}
+		if status := aws.StringValue(index.IndexStatus); status != dynamodb.IndexStatusActive {
+			problems = append(problems, fmt.Sprintf("GSI %s is %s", name, status))
+		}
+	}
+
+	ttl, err := dynamoClient.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("failed to describe TTL of %s: %w", table, err)
+	}
+	if description := ttl.TimeToLiveDescription; aws.StringValue(description.TimeToLiveStatus) != dynamodb.TimeToLiveStatusEnabled ||
+		aws.StringValue(description.AttributeName) != "expires_at" {
+		problems = append(problems, fmt.Sprintf("TTL is %s on %q, expected ENABLED on expires_at",
+			aws.StringValue(description.TimeToLiveStatus), aws.StringValue(description.AttributeName)))
+	}
+
+	backups, err := dynamoClient.DescribeContinuousBackups(&dynamodb.DescribeContinuousBackupsInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("failed to describe backups of %s: %w", table, err)
+	}
+	if recovery := backups.ContinuousBackupsDescription.PointInTimeRecoveryDescription; recovery == nil ||
+		aws.StringValue(recovery.PointInTimeRecoveryStatus) != dynamodb.PointInTimeRecoveryStatusEnabled {
+		problems = append(problems, "point-in-time recovery is not enabled")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("incident table %s is misconfigured:\n  %s", table, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// WaitForIncident waits until the finding's item has been written at least triageCount times, so an
+// update can be told from the item it replaces
+func WaitForIncident(sess *session.Session, table, findingID string, triageCount int, timeout time.Duration) (*Incident, error) {
+	dynamoClient := dynamodb.New(sess)
+
+	var last *Incident
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		item, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+			TableName:      aws.String(table),
+			Key:            map[string]*dynamodb.AttributeValue{"finding_id": {S: aws.String(findingID)}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get incident %s: %w", findingID, err)
+		}
+		if item.Item != nil {
+			last = &Incident{}
+			if err := dynamodbattribute.UnmarshalMap(item.Item, last); err != nil {
+				return nil, fmt.Errorf("failed to decode incident %s: %w", findingID, err)
+			}
+			if last.TriageCount >= triageCount {
+				return last, nil
+			}
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	if last != nil {
+		return nil, fmt.Errorf("incident %s was triaged %d times within %s, expected %d", findingID, last.TriageCount, timeout, triageCount)
+	}
+	return nil, fmt.Errorf("no incident for finding %s within %s", findingID, timeout)
+}
+
+// AssertSingleIncident checks that each GSI returns exactly one item for the finding, under its
+// resource and its status, and that the item expires ttl after its last triage. The GSIs are
+// eventually consistent, so they are queried until timeout before a count is taken as final.
+func AssertSingleIncident(sess *session.Session, table string, incident Incident, ttl, timeout time.Duration) error {
+	var problems []string
+
+	if expected := incident.UpdatedAt + int64(ttl.Seconds()); incident.ExpiresAt != expected {
+		problems = append(problems, fmt.Sprintf("expires_at is %d, expected %d (updated_at + %s)", incident.ExpiresAt, expected, ttl))
+	}
+	if incident.CreatedAt > incident.UpdatedAt {
+		problems = append(problems, fmt.Sprintf("created_at %d is after updated_at %d", incident.CreatedAt, incident.UpdatedAt))
+	}
+
+	lookups := []struct {
+		index, key, value string
+	}{
+		{IncidentsByResource, "resource_id", incident.ResourceID},
+		{IncidentsByStatus, "status", incident.Status},
+	}
+	for _, lookup := range lookups {
+		count, err := waitForIndexedIncident(sess, table, lookup.index, lookup.key, lookup.value, incident, timeout)
+		if err != nil {
+			return err
+		}
+		if count != 1 {
+			problems = append(problems, fmt.Sprintf("GSI %s returns %d items for %s = %s, expected 1", lookup.index, count, lookup.key, lookup.value))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("incident %s:\n  %s", incident.FindingID, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// waitForIndexedIncident queries a GSI until it reflects the incident's latest update and returns
+// how many items it holds for the finding
+func waitForIndexedIncident(sess *session.Session, table, index, key, value string, incident Incident, timeout time.Duration) (int, error) {
+	dynamoClient := dynamodb.New(sess)
+
+	var count int
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		count = 0
+		current := false
+		err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+			TableName:              aws.String(table),
+			IndexName:              aws.String(index),
+			KeyConditionExpression: aws.String("#key = :value"),
+			ExpressionAttributeNames: map[string]*string{
+				"#key": aws.String(key),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":value": {S: aws.String(value)},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				if aws.StringValue(item["finding_id"].S) != incident.FindingID {
+					continue
+				}
+				count++
+				current = current || aws.StringValue(item["updated_at"].N) == fmt.Sprint(incident.UpdatedAt)
+			}
+			return true
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to query %s on %s: %w", index, table, err)
+		}
+		if current || clock.Default.Now().After(deadline) {
+			return count, nil
+		}
+		clock.Default.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,255 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// AmazonLinuxAMIParameter is the public SSM parameter holding the latest Amazon Linux 2023 AMI
+const AmazonLinuxAMIParameter = "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"
+
+// TestInstanceOptions describes a throwaway instance for isolation tests
+type TestInstanceOptions struct {
+	// SubnetID defaults to a default subnet of the default VPC
+	SubnetID string
+	// AMI defaults to the latest Amazon Linux 2023 image
+	AMI string
+	// InstanceType defaults to t3.micro
+	InstanceType string
+	// InstanceProfile is the optional instance profile name, e.g. for SSM access
+	InstanceProfile string
+	Tags            map[string]string
+	// ShutdownAfter makes the instance shut itself down, and so terminate, after this long even if
+	// the test never cleans it up (zero leaves it running)
+	ShutdownAfter time.Duration
+	// IPv6AddressCount assigns IPv6 addresses from a dual-stack subnet
+	IPv6AddressCount int64
+	// Script is run as root at boot, e.g. to generate traffic for flow logs
+	Script string
+}
+
+// LatestAmazonLinuxAMI resolves the current Amazon Linux 2023 AMI for the session's region
+func LatestAmazonLinuxAMI(sess *session.Session) (string, error) {
+	parameter, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(AmazonLinuxAMIParameter),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve Amazon Linux AMI: %w", err)
+	}
+
+	return aws.StringValue(parameter.Parameter.Value), nil
+}
+
+// DefaultSubnet returns a default subnet of the region's default VPC
+func DefaultSubnet(sess *session.Session) (string, error) {
+	subnets, err := ec2.New(sess).DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("default-for-az"), Values: []*string{aws.String("true")}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe subnets: %w", err)
+	}
+	if len(subnets.Subnets) == 0 {
+		return "", fmt.Errorf("no default subnet in this region")
+	}
+
+	return aws.StringValue(subnets.Subnets[0].SubnetId), nil
+}
+
+// UserData returns the base64-encoded boot script for ShutdownAfter and Script, or "" if neither
+// is set. An instance shutting itself down only terminates with the terminate shutdown behavior.
+func (opts TestInstanceOptions) UserData() string {
+	script := ""
+	if opts.ShutdownAfter > 0 {
+		minutes := int(opts.ShutdownAfter.Minutes())
+		if minutes < 1 {
+			minutes = 1
+		}
+		script += fmt.Sprintf("shutdown -h +%d\n", minutes)
+	}
+	if opts.Script != "" {
+		script += opts.Script + "\n"
+	}
+	if script == "" {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\n" + script))
+}
+
+// LaunchTestInstance starts an instance and waits until it is running
+func LaunchTestInstance(sess *session.Session, opts TestInstanceOptions) (string, error) {
+	var err error
+	if opts.SubnetID == "" {
+		if opts.SubnetID, err = DefaultSubnet(sess); err != nil {
+			return "", err
+		}
+	}
+	if opts.AMI == "" {
+		if opts.AMI, err = LatestAmazonLinuxAMI(sess); err != nil {
+			return "", err
+		}
+	}
+	if opts.InstanceType == "" {
+		opts.InstanceType = ec2.InstanceTypeT3Micro
+	}
+
+	var tags []*ec2.Tag
+	for key, value := range opts.Tags {
+		tags = append(tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String(opts.AMI),
+		InstanceType: aws.String(opts.InstanceType),
+		SubnetId:     aws.String(opts.SubnetID),
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		MetadataOptions: &ec2.InstanceMetadataOptionsRequest{
+			HttpTokens: aws.String(ec2.HttpTokensStateRequired),
+		},
+	}
+	if len(tags) > 0 {
+		input.TagSpecifications = []*ec2.TagSpecification{
+			{ResourceType: aws.String(ec2.ResourceTypeInstance), Tags: tags},
+		}
+	}
+	if opts.IPv6AddressCount > 0 {
+		input.Ipv6AddressCount = aws.Int64(opts.IPv6AddressCount)
+	}
+	if opts.ShutdownAfter > 0 {
+		input.InstanceInitiatedShutdownBehavior = aws.String(ec2.ShutdownBehaviorTerminate)
+	}
+	if userData := opts.UserData(); userData != "" {
+		input.UserData = aws.String(userData)
+	}
+	if opts.InstanceProfile != "" {
+		input.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{Name: aws.String(opts.InstanceProfile)}
+	}
+
+	ec2Client := ec2.New(sess)
+
+	reservation, err := ec2Client.RunInstances(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to launch test instance: %w", err)
+	}
+	instanceID := aws.StringValue(reservation.Instances[0].InstanceId)
+
+	if err := ec2Client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}); err != nil {
+		return instanceID, fmt.Errorf("test instance %s did not reach running: %w", instanceID, err)
+	}
+
+	return instanceID, nil
+}
+
+// TerminateTestInstance terminates an instance and waits for it to go away
+func TerminateTestInstance(sess *session.Session, instanceID string) error {
+	ec2Client := ec2.New(sess)
+
+	if _, err := ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}); err != nil {
+		return fmt.Errorf("failed to terminate test instance %s: %w", instanceID, err)
+	}
+
+	return ec2Client.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+}
+
+// InstanceNetworkInterfaces returns the network interfaces attached to an instance
+func InstanceNetworkInterfaces(sess *session.Session, instanceID string) ([]*ec2.InstanceNetworkInterface, error) {
+	instances, err := ec2.New(sess).DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+
+	var interfaces []*ec2.InstanceNetworkInterface
+	for _, reservation := range instances.Reservations {
+		for _, instance := range reservation.Instances {
+			interfaces = append(interfaces, instance.NetworkInterfaces...)
+		}
+	}
+	if len(interfaces) == 0 {
+		return nil, fmt.Errorf("instance %s has no network interfaces", instanceID)
+	}
+
+	return interfaces, nil
+}
+
+// WaitForInstanceTag polls until an instance carries the tag, e.g. once triage has picked it up
+func WaitForInstanceTag(sess *session.Session, instanceID, key string, timeout time.Duration) (string, error) {
+	ec2Client := ec2.New(sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for clock.Default.Now().Before(deadline) {
+		tags, err := ec2Client.DescribeTags(&ec2.DescribeTagsInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("resource-id"), Values: []*string{aws.String(instanceID)}},
+				{Name: aws.String("key"), Values: []*string{aws.String(key)}},
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe tags: %w", err)
+		}
+		if len(tags.Tags) > 0 {
+			return aws.StringValue(tags.Tags[0].Value), nil
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return "", fmt.Errorf("instance %s was not tagged %s within %s", instanceID, key, timeout)
+}
+
+// IsolateInstance replaces the security groups on every network interface of the instance with the
+// quarantine group, as the IsolateResource step is meant to
+func IsolateInstance(sess *session.Session, instanceID, quarantineSGID string) error {
+	interfaces, err := InstanceNetworkInterfaces(sess, instanceID)
+	if err != nil {
+		return err
+	}
+
+	ec2Client := ec2.New(sess)
+	for _, eni := range interfaces {
+		if _, err := ec2Client.ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: eni.NetworkInterfaceId,
+			Groups:             []*string{aws.String(quarantineSGID)},
+		}); err != nil {
+			return fmt.Errorf("failed to quarantine %s: %w", aws.StringValue(eni.NetworkInterfaceId), err)
+		}
+	}
+
+	return nil
+}
+
+// RebootTestInstance reboots an instance and waits for it to pass status checks again. Security group
+// changes do not cut connections that are already tracked, so a reboot makes the new rules apply to everything.
+func RebootTestInstance(sess *session.Session, instanceID string) error {
+	ec2Client := ec2.New(sess)
+
+	if _, err := ec2Client.RebootInstances(&ec2.RebootInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}); err != nil {
+		return fmt.Errorf("failed to reboot %s: %w", instanceID, err)
+	}
+
+	// The reboot is asynchronous; give it time to take the instance down before waiting on status checks
+	clock.Default.Sleep(30 * time.Second)
+
+	return ec2Client.WaitUntilInstanceStatusOk(&ec2.DescribeInstanceStatusInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+}
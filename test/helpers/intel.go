@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
+)
+
+// Enrichment is what triage adds to the evidence and notification of a finding with remote IPs
+type Enrichment struct {
+	// Status is "enriched", or "degraded" when a threat intel lookup failed
+	Status string `json:"status"`
+	// Reputation is the most severe reputation of the IPs
+	Reputation string            `json:"reputation,omitempty"`
+	IPs        []EnrichedIP      `json:"ips"`
+	Errors     []EnrichmentError `json:"errors,omitempty"`
+}
+
+// EnrichedIP is a remote IP with GuardDuty's GeoIP and ASN details and the threat intel verdict
+type EnrichedIP struct {
+	IP         string `json:"ip"`
+	Country    string `json:"country,omitempty"`
+	City       string `json:"city,omitempty"`
+	ASN        string `json:"asn,omitempty"`
+	ASNOrg     string `json:"asn_org,omitempty"`
+	ISP        string `json:"isp,omitempty"`
+	Reputation string `json:"reputation,omitempty"`
+	Score      int    `json:"score,omitempty"`
+}
+
+// EnrichmentError is a threat intel lookup that failed
+type EnrichmentError struct {
+	IP    string `json:"ip"`
+	Error string `json:"error"`
+}
+
+// IP returns the enrichment of one IP, or nil
+func (e *Enrichment) IP(ip string) *EnrichedIP {
+	for i := range e.IPs {
+		if e.IPs[i].IP == ip {
+			return &e.IPs[i]
+		}
+	}
+	return nil
+}
+
+// RemoteIPService returns a GuardDuty service block for a network connection with a remote IP,
+// with GuardDuty's GeoIP and ASN details
+func RemoteIPService(ip, country, asn, asnOrg string) map[string]interface{} {
+	return map[string]interface{}{
+		"serviceName": "guardduty",
+		"action": map[string]interface{}{
+			"actionType": "NETWORK_CONNECTION",
+			"networkConnectionAction": map[string]interface{}{
+				"connectionDirection": "OUTBOUND",
+				"remoteIpDetails": map[string]interface{}{
+					"ipAddressV4":  ip,
+					"country":      map[string]interface{}{"countryName": country},
+					"organization": map[string]interface{}{"asn": asn, "asnOrg": asnOrg},
+				},
+			},
+		},
+	}
+}
+
+// PortProbeService returns a GuardDuty service block for a port probe from several remote IPs,
+// in order, with GuardDuty's GeoIP and ASN details
+func PortProbeService(country, asn, asnOrg string, ips ...string) map[string]interface{} {
+	probes := make([]interface{}, len(ips))
+	for i, ip := range ips {
+		probes[i] = map[string]interface{}{
+			"localPortDetails": map[string]interface{}{"port": 22, "portName": "SSH"},
+			"remoteIpDetails": map[string]interface{}{
+				"ipAddressV4":  ip,
+				"country":      map[string]interface{}{"countryName": country},
+				"organization": map[string]interface{}{"asn": asn, "asnOrg": asnOrg},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"serviceName": "guardduty",
+		"action": map[string]interface{}{
+			"actionType": "PORT_PROBE",
+			"portProbeAction": map[string]interface{}{
+				"blocked":          false,
+				"portProbeDetails": probes,
+			},
+		},
+	}
+}
+
+// ReadEvidenceEnrichment returns the enrichment stored with a finding's evidence
+func ReadEvidenceEnrichment(sess *session.Session, bucketName, findingID string) (enrichment *Enrichment, err error) {
+	defer tracing.Step(sess, "assert-evidence")(&err)
+
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String("findings/" + findingID + ".json"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence for %s: %w", findingID, err)
+	}
+	defer object.Body.Close()
+
+	var evidence struct {
+		Enrichment *Enrichment `json:"enrichment"`
+	}
+	if err := json.NewDecoder(object.Body).Decode(&evidence); err != nil {
+		return nil, fmt.Errorf("failed to parse evidence for %s: %w", findingID, err)
+	}
+	if evidence.Enrichment == nil {
+		return nil, fmt.Errorf("evidence for %s is not enriched", findingID)
+	}
+	return evidence.Enrichment, nil
+}
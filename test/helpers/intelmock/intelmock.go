@@ -0,0 +1,326 @@
+// Package intelmock deploys a threat intel endpoint with canned verdicts that speaks the generic
+// /ip/<address> API as well as VirusTotal's and AlienVault OTX's, so scenarios can point the
+// triage Lambda at it and control what each lookup answers: a verdict, nothing, an error, a
+// timeout or a rate limit.
+package intelmock
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/lambda"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Verdict is what the mock answers for one IP, in whichever API it is asked through
+type Verdict struct {
+	// Reputation is malicious, suspicious, clean or unknown
+	Reputation string `json:"reputation,omitempty"`
+	// Score is the generic API's score, VirusTotal's count of engines flagging the IP and OTX's
+	// pulse count; VirusTotal and OTX derive one from the reputation when it is zero
+	Score   int    `json:"score,omitempty"`
+	Country string `json:"country,omitempty"`
+	ASN     string `json:"asn,omitempty"`
+	ASNOrg  string `json:"asn_org,omitempty"`
+	// Status makes the endpoint fail with this HTTP status instead, e.g. 500
+	Status int `json:"status,omitempty"`
+	// DelaySeconds holds the answer back, e.g. past the pipeline's lookup timeout
+	DelaySeconds int `json:"delay,omitempty"`
+	// RateLimited answers the first this many requests for the IP with 429 Too Many Requests
+	RateLimited int `json:"rate_limited,omitempty"`
+	// RetryAfter is the Retry-After of those answers, 1 second when zero
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// source routes requests to the API they are in and answers from VERDICTS. Every request is
+// counted per IP in REQUESTS_TABLE, since concurrent invocations share no memory. IPs without a
+// verdict are not found, except by OTX, which knows every address but has no pulses for them.
+const source = `import json, os, time
+import boto3
+
+VERDICTS = json.loads(os.environ['VERDICTS'])
+API_KEY = os.environ.get('API_KEY', '')
+KEY_HEADERS = {'virustotal': 'x-apikey', 'otx': 'x-otx-api-key'}
+REQUESTS = boto3.resource('dynamodb').Table(os.environ['REQUESTS_TABLE'])
+
+def route(path):
+    parts = path.strip('/').split('/')
+    if len(parts) == 2 and parts[0] == 'ip':
+        return 'generic', parts[1]
+    if len(parts) == 4 and parts[:3] == ['api', 'v3', 'ip_addresses']:
+        return 'virustotal', parts[3]
+    if len(parts) == 6 and parts[:3] == ['api', 'v1', 'indicators'] and parts[5] == 'general':
+        return 'otx', parts[4]
+    return None, None
+
+def generic(ip, verdict):
+    return {key: verdict.get(key) for key in ('reputation', 'score', 'country', 'asn', 'asn_org')}
+
+def virustotal(ip, verdict):
+    stats = {'harmless': 0, 'malicious': 0, 'suspicious': 0, 'undetected': 70}
+    reputation = verdict.get('reputation')
+    if reputation in ('malicious', 'suspicious'):
+        stats[reputation] = verdict.get('score') or 1
+    elif reputation == 'clean':
+        stats['harmless'] = verdict.get('score') or 60
+    asn = verdict.get('asn')
+    return {'data': {'type': 'ip_address', 'id': ip, 'attributes': {
+        'last_analysis_stats': stats,
+        'country': verdict.get('country'),
+        'asn': int(asn) if asn else None,
+        'as_owner': verdict.get('asn_org'),
+    }}}
+
+def otx(ip, verdict):
+    pulses = verdict.get('score') or {'malicious': 3, 'suspicious': 1}.get(verdict.get('reputation'), 0)
+    asn = verdict.get('asn')
+    return {
+        'indicator': ip,
+        'pulse_info': {'count': pulses, 'pulses': []},
+        'country_name': verdict.get('country'),
+        'asn': f"AS{asn} {verdict.get('asn_org', '')}".strip() if asn else None,
+    }
+
+ANSWERS = {'generic': generic, 'virustotal': virustotal, 'otx': otx}
+
+def respond(status, body, headers=None):
+    return {
+        'statusCode': status,
+        'headers': dict({'Content-Type': 'application/json'}, **(headers or {})),
+        'body': json.dumps(body),
+    }
+
+def handler(event, context):
+    api, ip = route(event.get('rawPath', ''))
+    if api is None:
+        return respond(400, {'error': 'unknown route'})
+    keyed = api in KEY_HEADERS and (event.get('headers') or {}).get(KEY_HEADERS[api]) == API_KEY
+    seen = REQUESTS.update_item(
+        Key={'ip': ip},
+        UpdateExpression='ADD requests :one, keyed :keyed',
+        ExpressionAttributeValues={':one': 1, ':keyed': 1 if keyed else 0},
+        ReturnValues='UPDATED_NEW',
+    )['Attributes']['requests']
+    if api in KEY_HEADERS and API_KEY and not keyed:
+        return respond(401, {'error': 'wrong API key'})
+
+    verdict = VERDICTS.get(ip)
+    if verdict is None:
+        if api != 'otx':
+            return respond(404, {'error': 'not found'})
+        verdict = {}
+    if seen <= verdict.get('rate_limited', 0):
+        return respond(429, {'error': 'quota exceeded'}, {'Retry-After': str(verdict.get('retry_after') or 1)})
+    time.sleep(verdict.get('delay', 0))
+    if verdict.get('status'):
+        return respond(verdict['status'], {'error': 'injected failure'})
+    return respond(200, ANSWERS[api](ip, verdict))
+`
+
+// Mock is a threat intel endpoint served from a Lambda function URL so the deployed triage function
+// can reach it
+type Mock struct {
+	Name string
+	// URL is the endpoint to give the stack as threat_intel_endpoint
+	URL string
+}
+
+// Requests is how often the mock was asked about one IP
+type Requests struct {
+	Total int
+	// Keyed counts the VirusTotal and OTX requests that carried the mock's API key
+	Keyed int
+}
+
+// Deploy creates the mock's function, execution role and request table, all called name. With an
+// apiKey, VirusTotal and OTX requests without it are refused with 401.
+func Deploy(sess *session.Session, name, apiKey string, verdicts map[string]Verdict) (*Mock, error) {
+	iamClient := iam.New(sess)
+	lambdaClient := lambda.New(sess)
+	dynamoClient := dynamodb.New(sess)
+	mock := &Mock{Name: name}
+
+	table, err := dynamoClient.CreateTable(&dynamodb.CreateTableInput{
+		TableName:   aws.String(name),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("ip"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("ip"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+	})
+	if err != nil {
+		return mock, fmt.Errorf("failed to create intel mock request table: %w", err)
+	}
+	if err := dynamoClient.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(name)}); err != nil {
+		return mock, fmt.Errorf("intel mock request table did not become active: %w", err)
+	}
+
+	role, err := iamClient.CreateRole(&iam.CreateRoleInput{
+		RoleName: aws.String(name),
+		AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow",` +
+			`"Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`),
+	})
+	if err != nil {
+		return mock, fmt.Errorf("failed to create intel mock role: %w", err)
+	}
+	if _, err := iamClient.AttachRolePolicy(&iam.AttachRolePolicyInput{
+		RoleName:  aws.String(name),
+		PolicyArn: aws.String(policyARN(sess)),
+	}); err != nil {
+		return mock, fmt.Errorf("failed to attach intel mock policy: %w", err)
+	}
+	if _, err := iamClient.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:   aws.String(name),
+		PolicyName: aws.String("requests"),
+		PolicyDocument: aws.String(fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow",`+
+			`"Action":"dynamodb:UpdateItem","Resource":"%s"}]}`, aws.StringValue(table.TableDescription.TableArn))),
+	}); err != nil {
+		return mock, fmt.Errorf("failed to grant intel mock its request table: %w", err)
+	}
+
+	var code bytes.Buffer
+	archive := zip.NewWriter(&code)
+	file, err := archive.Create("mock.py")
+	if err != nil {
+		return mock, err
+	}
+	if _, err := file.Write([]byte(source)); err != nil {
+		return mock, err
+	}
+	if err := archive.Close(); err != nil {
+		return mock, err
+	}
+	verdictsJSON, err := json.Marshal(verdicts)
+	if err != nil {
+		return mock, err
+	}
+
+	// A new role cannot be assumed by Lambda until it has propagated
+	deadline := clock.Default.Now().Add(2 * time.Minute)
+	for {
+		_, err = lambdaClient.CreateFunction(&lambda.CreateFunctionInput{
+			FunctionName: aws.String(name),
+			Runtime:      aws.String(lambda.RuntimePython312),
+			Handler:      aws.String("mock.handler"),
+			Role:         role.Role.Arn,
+			Code:         &lambda.FunctionCode{ZipFile: code.Bytes()},
+			Timeout:      aws.Int64(30),
+			Environment: &lambda.Environment{
+				Variables: map[string]*string{
+					"VERDICTS":       aws.String(string(verdictsJSON)),
+					"API_KEY":        aws.String(apiKey),
+					"REQUESTS_TABLE": aws.String(name),
+				},
+			},
+		})
+		awsErr, ok := err.(awserr.Error)
+		if err == nil || !ok || awsErr.Code() != lambda.ErrCodeInvalidParameterValueException || clock.Default.Now().After(deadline) {
+			break
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		return mock, fmt.Errorf("failed to create intel mock function: %w", err)
+	}
+	if err := lambdaClient.WaitUntilFunctionActiveV2(&lambda.GetFunctionInput{FunctionName: aws.String(name)}); err != nil {
+		return mock, fmt.Errorf("intel mock function did not become active: %w", err)
+	}
+
+	functionURL, err := lambdaClient.CreateFunctionUrlConfig(&lambda.CreateFunctionUrlConfigInput{
+		FunctionName: aws.String(name),
+		AuthType:     aws.String(lambda.FunctionUrlAuthTypeNone),
+	})
+	if err != nil {
+		return mock, fmt.Errorf("failed to create intel mock URL: %w", err)
+	}
+	if _, err := lambdaClient.AddPermission(&lambda.AddPermissionInput{
+		FunctionName:        aws.String(name),
+		StatementId:         aws.String("public-url"),
+		Action:              aws.String("lambda:InvokeFunctionUrl"),
+		Principal:           aws.String("*"),
+		FunctionUrlAuthType: aws.String(lambda.FunctionUrlAuthTypeNone),
+	}); err != nil {
+		return mock, fmt.Errorf("failed to open intel mock URL: %w", err)
+	}
+	mock.URL = strings.TrimSuffix(aws.StringValue(functionURL.FunctionUrl), "/")
+
+	return mock, nil
+}
+
+// Requests returns how often the mock was asked about ip
+func (m *Mock) Requests(sess *session.Session, ip string) (Requests, error) {
+	item, err := dynamodb.New(sess).GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(m.Name),
+		Key:            map[string]*dynamodb.AttributeValue{"ip": {S: aws.String(ip)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Requests{}, fmt.Errorf("failed to read intel mock requests for %s: %w", ip, err)
+	}
+
+	var requests Requests
+	for attribute, count := range map[string]*int{"requests": &requests.Total, "keyed": &requests.Keyed} {
+		value, ok := item.Item[attribute]
+		if !ok {
+			continue
+		}
+		if *count, err = strconv.Atoi(aws.StringValue(value.N)); err != nil {
+			return Requests{}, fmt.Errorf("intel mock %s count for %s is not a number: %w", attribute, ip, err)
+		}
+	}
+	return requests, nil
+}
+
+// Delete removes the mock's function, role and request table, skipping parts that were never created
+func (m *Mock) Delete(sess *session.Session) error {
+	if _, err := lambda.New(sess).DeleteFunction(&lambda.DeleteFunctionInput{FunctionName: aws.String(m.Name)}); err != nil {
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != lambda.ErrCodeResourceNotFoundException {
+			return fmt.Errorf("failed to delete intel mock function %s: %w", m.Name, err)
+		}
+	}
+
+	iamClient := iam.New(sess)
+	if _, err := iamClient.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(m.Name),
+		PolicyName: aws.String("requests"),
+	}); err != nil && !isNotFound(err, iam.ErrCodeNoSuchEntityException) {
+		return fmt.Errorf("failed to delete intel mock request policy: %w", err)
+	}
+	if _, err := iamClient.DetachRolePolicy(&iam.DetachRolePolicyInput{
+		RoleName:  aws.String(m.Name),
+		PolicyArn: aws.String(policyARN(sess)),
+	}); err != nil && !isNotFound(err, iam.ErrCodeNoSuchEntityException) {
+		return fmt.Errorf("failed to detach intel mock policy: %w", err)
+	}
+	if _, err := iamClient.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(m.Name)}); err != nil && !isNotFound(err, iam.ErrCodeNoSuchEntityException) {
+		return fmt.Errorf("failed to delete intel mock role %s: %w", m.Name, err)
+	}
+
+	if _, err := dynamodb.New(sess).DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(m.Name)}); err != nil && !isNotFound(err, dynamodb.ErrCodeResourceNotFoundException) {
+		return fmt.Errorf("failed to delete intel mock request table %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+func policyARN(sess *session.Session) string {
+	return helpers.SessionPartition(sess).ARN("iam", "", "aws", "policy/service-role/AWSLambdaBasicExecutionRole")
+}
+
+func isNotFound(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+// Inventory is the number of resources of each type, keyed as ResourceType names them, e.g.
+// {"lambda:function": 1, "iam:role": 4}
+type Inventory map[string]int
+
+// LoadInventory reads an expected-inventory manifest, e.g. expected-inventory.json next to this file
+func LoadInventory(path string) (Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory manifest: %w", err)
+	}
+
+	var manifest struct {
+		Types Inventory `json:"types"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(manifest.Types) == 0 {
+		return nil, fmt.Errorf("%s lists no resource types", path)
+	}
+	return manifest.Types, nil
+}
+
+// SnapshotInventory counts the resources tagged with the run's TestID. The Resource Groups Tagging
+// API does not cover IAM, so roles are counted separately among those named with rolePrefix.
+func SnapshotInventory(sess *session.Session, testID, rolePrefix string) (Inventory, error) {
+	inventory := Inventory{}
+
+	err := resourcegroupstaggingapi.New(sess).GetResourcesPages(&resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{
+			{Key: aws.String(TestResourceTag), Values: []*string{aws.String(testID)}},
+		},
+	}, func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
+		for _, resource := range page.ResourceTagMappingList {
+			inventory[ResourceType(aws.StringValue(resource.ResourceARN))]++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources tagged %s=%s: %w", TestResourceTag, testID, err)
+	}
+
+	iamClient := iam.New(sess)
+	var roles []string
+	err = iamClient.ListRolesPages(&iam.ListRolesInput{}, func(page *iam.ListRolesOutput, lastPage bool) bool {
+		for _, role := range page.Roles {
+			if name := aws.StringValue(role.RoleName); strings.HasPrefix(name, rolePrefix) {
+				roles = append(roles, name)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	for _, role := range roles {
+		tags, err := iamClient.ListRoleTags(&iam.ListRoleTagsInput{RoleName: aws.String(role)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of role %s: %w", role, err)
+		}
+		for _, tag := range tags.Tags {
+			if aws.StringValue(tag.Key) == TestResourceTag && aws.StringValue(tag.Value) == testID {
+				inventory["iam:role"]++
+			}
+		}
+	}
+
+	return inventory, nil
+}
+
+// Diff lists every resource type whose count differs from the expected inventory, ordered by type
+func (i Inventory) Diff(expected Inventory) []string {
+	types := map[string]bool{}
+	for resourceType := range i {
+		types[resourceType] = true
+	}
+	for resourceType := range expected {
+		types[resourceType] = true
+	}
+
+	var differences []string
+	for resourceType := range types {
+		if found, want := i[resourceType], expected[resourceType]; found != want {
+			differences = append(differences, fmt.Sprintf("%s: %d deployed, %d expected (%+d)", resourceType, found, want, found-want))
+		}
+	}
+	sort.Strings(differences)
+	return differences
+}
+
+// String renders the inventory as a manifest, so a deliberate change can be committed from the failure
+func (i Inventory) String() string {
+	data, _ := json.MarshalIndent(struct {
+		Types Inventory `json:"types"`
+	}{i}, "", "  ")
+	return string(data)
+}
+
+// AssertInventory snapshots the run's resources and diffs them against the manifest, so a module
+// change that adds a resource, e.g. a NAT gateway or an extra role, must also update the manifest
+func AssertInventory(sess *session.Session, testID, rolePrefix, manifestPath string) error {
+	expected, err := LoadInventory(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	inventory, err := SnapshotInventory(sess, testID, rolePrefix)
+	if err != nil {
+		return err
+	}
+
+	if differences := inventory.Diff(expected); len(differences) > 0 {
+		return fmt.Errorf("deployed inventory differs from %s:\n  %s\ndeployed inventory:\n%s",
+			manifestPath, strings.Join(differences, "\n  "), inventory)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/sgmodel"
+)
+
+// IsolationPolicy names the traffic a quarantine security group is allowed to carry
+type IsolationPolicy string
+
+// Isolation policies; each one fixes the exact rule set of the quarantine group
+const (
+	// FullIsolation allows no traffic in either direction
+	FullIsolation IsolationPolicy = "full-isolation"
+	// SSMOnly allows only HTTPS out to the SSM interface endpoints so Session Manager keeps working
+	SSMOnly IsolationPolicy = "ssm-only"
+	// ForensicsEndpointOnly allows only HTTPS out to the forensics collection endpoint
+	ForensicsEndpointOnly IsolationPolicy = "forensics-endpoint-only"
+)
+
+// PolicyTargets are the peers a policy's rules refer to
+type PolicyTargets struct {
+	// SSMEndpointSGID is the security group of the SSM endpoints (ssm-only)
+	SSMEndpointSGID string
+	// ForensicsEndpoint is the CIDR, prefix list or security group of the collector (forensics-endpoint-only)
+	ForensicsEndpoint string
+	// ForensicsPort defaults to 443
+	ForensicsPort int64
+}
+
+// ExpectedRules returns the exact rule set a quarantine group must have under the policy
+func ExpectedRules(policy IsolationPolicy, targets PolicyTargets) ([]sgmodel.Rule, error) {
+	switch policy {
+	case FullIsolation:
+		return nil, nil
+	case SSMOnly:
+		if targets.SSMEndpointSGID == "" {
+			return nil, fmt.Errorf("policy %s needs the SSM endpoint security group", policy)
+		}
+		return []sgmodel.Rule{sgmodel.TCP(true, 443, 443, targets.SSMEndpointSGID)}, nil
+	case ForensicsEndpointOnly:
+		if targets.ForensicsEndpoint == "" {
+			return nil, fmt.Errorf("policy %s needs the forensics endpoint", policy)
+		}
+		port := targets.ForensicsPort
+		if port == 0 {
+			port = 443
+		}
+		return []sgmodel.Rule{sgmodel.TCP(true, port, port, targets.ForensicsEndpoint)}, nil
+	default:
+		return nil, fmt.Errorf("unknown isolation policy %q", policy)
+	}
+}
+
+// SecurityGroupRules returns the normalized rules of a security group
+func SecurityGroupRules(sess *session.Session, sgID string) ([]sgmodel.Rule, error) {
+	return sgmodel.Describe(sess, sgID)
+}
+
+// AssertQuarantinePolicy asserts that the security group has exactly the rules of the isolation
+// policy: a wider rule (e.g. all protocols, or TCP 0-65535) counts as both missing and unexpected
+func AssertQuarantinePolicy(sess *session.Session, sgID string, policy IsolationPolicy, targets PolicyTargets) error {
+	expected, err := ExpectedRules(policy, targets)
+	if err != nil {
+		return err
+	}
+
+	actual, err := SecurityGroupRules(sess, sgID)
+	if err != nil {
+		return err
+	}
+
+	if diff := sgmodel.DiffRules(expected, actual); !diff.Empty() {
+		return fmt.Errorf("%s does not match isolation policy %s (%s)", sgID, policy, diff)
+	}
+	return nil
+}
+
+// AssertDualStackIsolated asserts that every network interface of the instance has an IPv6 address
+// and only the quarantine group, and that the group has no rule for an IPv6 range: in a dual-stack
+// VPC a rule for ::/0 keeps IPv6 paths open while every IPv4 check passes
+func AssertDualStackIsolated(sess *session.Session, instanceID, quarantineSGID string) error {
+	interfaces, err := InstanceNetworkInterfaces(sess, instanceID)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, eni := range interfaces {
+		eniID := aws.StringValue(eni.NetworkInterfaceId)
+		if len(eni.Ipv6Addresses) == 0 {
+			problems = append(problems, fmt.Sprintf("%s has no IPv6 address, so IPv6 isolation cannot be checked", eniID))
+		}
+		if err := sgmodel.ExpectGroups(sgmodel.NewGroupSet(quarantineSGID), sgmodel.GroupsOf(eni.Groups)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s has %v", eniID, err))
+		}
+	}
+
+	rules, err := SecurityGroupRules(sess, quarantineSGID)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.IPv6() {
+			problems = append(problems, fmt.Sprintf("%s allows IPv6 traffic: %s", quarantineSGID, rule))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s is not isolated over IPv6:\n  %s", instanceID, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// AssertQuarantineGroupPerVPC asserts that each of the VPCs has a quarantine group in
+// groupsByVPC, as read from the network_quarantine_sg_ids_by_vpc output, and that every group
+// exists in the VPC it is listed under
+func AssertQuarantineGroupPerVPC(sess *session.Session, groupsByVPC map[string]string, vpcIDs []string) error {
+	var problems []string
+	for _, vpcID := range vpcIDs {
+		if groupsByVPC[vpcID] == "" {
+			problems = append(problems, fmt.Sprintf("%s has no quarantine group", vpcID))
+		}
+	}
+
+	var groupIDs []*string
+	for _, groupID := range groupsByVPC {
+		groupIDs = append(groupIDs, aws.String(groupID))
+	}
+	output, err := ec2.New(sess).DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+	if err != nil {
+		return fmt.Errorf("failed to describe quarantine groups: %w", err)
+	}
+	actual := map[string]string{}
+	for _, group := range output.SecurityGroups {
+		actual[aws.StringValue(group.GroupId)] = aws.StringValue(group.VpcId)
+	}
+	for vpcID, groupID := range groupsByVPC {
+		if actual[groupID] != vpcID {
+			problems = append(problems, fmt.Sprintf("%s is listed for %s but is in %q", groupID, vpcID, actual[groupID]))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("quarantine groups do not cover every VPC:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// AssertIsolatedInOwnVPC asserts that every network interface of the instance has only the
+// quarantine group of its own VPC
+func AssertIsolatedInOwnVPC(sess *session.Session, instanceID string, groupsByVPC map[string]string) error {
+	interfaces, err := InstanceNetworkInterfaces(sess, instanceID)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, eni := range interfaces {
+		eniID, vpcID := aws.StringValue(eni.NetworkInterfaceId), aws.StringValue(eni.VpcId)
+		expected, ok := groupsByVPC[vpcID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is in %s, which has no quarantine group", eniID, vpcID))
+			continue
+		}
+		if err := sgmodel.ExpectGroups(sgmodel.NewGroupSet(expected), sgmodel.GroupsOf(eni.Groups)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s in %s has %v", eniID, vpcID, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is not isolated in its VPC:\n  %s", instanceID, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
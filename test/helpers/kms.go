@@ -0,0 +1,154 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/aws/aws-sdk-go/service/kms"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// KMSEvent is a KMS API call recorded by CloudTrail
+type KMSEvent struct {
+	EventName         string
+	EventTime         time.Time
+	InvokedBy         string
+	EncryptionContext map[string]string
+}
+
+// LookupKMSEvents returns the CloudTrail management events for a key since a time, optionally
+// restricted to event names such as GenerateDataKey
+func LookupKMSEvents(sess *session.Session, keyARN string, since time.Time, eventNames ...string) ([]KMSEvent, error) {
+	wanted := map[string]bool{}
+	for _, name := range eventNames {
+		wanted[name] = true
+	}
+
+	var events []KMSEvent
+	var parseErr error
+	err := cloudtrail.New(sess).LookupEventsPages(&cloudtrail.LookupEventsInput{
+		LookupAttributes: []*cloudtrail.LookupAttribute{
+			{AttributeKey: aws.String(cloudtrail.LookupAttributeKeyResourceName), AttributeValue: aws.String(keyARN)},
+		},
+		StartTime: aws.Time(clock.Tolerant(since)),
+	}, func(page *cloudtrail.LookupEventsOutput, lastPage bool) bool {
+		for _, event := range page.Events {
+			if len(wanted) > 0 && !wanted[aws.StringValue(event.EventName)] {
+				continue
+			}
+
+			var record struct {
+				UserIdentity struct {
+					InvokedBy string `json:"invokedBy"`
+				} `json:"userIdentity"`
+				RequestParameters struct {
+					EncryptionContext map[string]string `json:"encryptionContext"`
+				} `json:"requestParameters"`
+			}
+			if err := json.Unmarshal([]byte(aws.StringValue(event.CloudTrailEvent)), &record); err != nil {
+				parseErr = fmt.Errorf("failed to parse CloudTrail event %s: %w", aws.StringValue(event.EventId), err)
+				return false
+			}
+
+			events = append(events, KMSEvent{
+				EventName:         aws.StringValue(event.EventName),
+				EventTime:         aws.TimeValue(event.EventTime),
+				InvokedBy:         record.UserIdentity.InvokedBy,
+				EncryptionContext: record.RequestParameters.EncryptionContext,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up KMS events: %w", err)
+	}
+
+	return events, parseErr
+}
+
+// AssertEvidenceEncryptionContext waits for the CloudTrail record of the data key S3 generated for
+// a finding's evidence object and checks that it carried the finding ID and account as encryption
+// context. CloudTrail delivers management events with a delay of several minutes.
+func AssertEvidenceEncryptionContext(sess *session.Session, keyARN, bucketName, findingID, account string, since time.Time, timeout time.Duration) error {
+	objectARN := SessionPartition(sess).ARN("s3", "", "", fmt.Sprintf("%s/findings/%s.json", bucketName, findingID))
+	deadline := clock.Default.Now().Add(timeout)
+
+	for {
+		events, err := LookupKMSEvents(sess, keyARN, since, "GenerateDataKey")
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			context := event.EncryptionContext
+			if context["aws:s3:arn"] != objectARN {
+				continue
+			}
+			if context["finding_id"] != findingID || context["account"] != account {
+				return fmt.Errorf("evidence %s was encrypted with context %v, expected finding_id=%s account=%s", objectARN, context, findingID, account)
+			}
+			return nil
+		}
+
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("no GenerateDataKey for %s in CloudTrail within %s", objectARN, timeout)
+		}
+		clock.Default.Sleep(30 * time.Second)
+	}
+}
+
+// ListKMSGrants returns the grants on a key
+func ListKMSGrants(sess *session.Session, keyARN string) ([]*kms.GrantListEntry, error) {
+	var grants []*kms.GrantListEntry
+
+	err := kms.New(sess).ListGrantsPages(&kms.ListGrantsInput{
+		KeyId: aws.String(keyARN),
+	}, func(page *kms.ListGrantsResponse, lastPage bool) bool {
+		grants = append(grants, page.Grants...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grants on %s: %w", keyARN, err)
+	}
+
+	return grants, nil
+}
+
+// AssertKMSGrantsManaged asserts that every grant on the key was created by Terraform, i.e. matches an
+// aws_kms_grant in the state resources for that key
+func AssertKMSGrantsManaged(sess *session.Session, keyARN string, resources []StateResource) error {
+	managed := map[string]bool{}
+	for _, grant := range StateResourcesOfType(resources, "aws_kms_grant") {
+		keyID := grant.StringValue("key_id")
+		if keyID == keyARN || strings.HasSuffix(keyARN, "/"+keyID) {
+			managed[grant.StringValue("grant_id")] = true
+		}
+	}
+
+	grants, err := ListKMSGrants(sess, keyARN)
+	if err != nil {
+		return err
+	}
+
+	var unmanaged []string
+	for _, grant := range grants {
+		if !managed[aws.StringValue(grant.GrantId)] {
+			unmanaged = append(unmanaged, fmt.Sprintf("%s (grantee %s, operations %s)",
+				aws.StringValue(grant.GrantId), aws.StringValue(grant.GranteePrincipal), strings.Join(aws.StringValueSlice(grant.Operations), ",")))
+		}
+	}
+
+	if len(unmanaged) > 0 {
+		sort.Strings(unmanaged)
+		return fmt.Errorf("key %s has grants not created by Terraform: %s", keyARN, strings.Join(unmanaged, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package kpi records MTTR-style incident response KPIs for every scenario run - how long the
+// pipeline took from injection to evidence, to containment and to notification - in a durable store,
+// and reports how they trend across runs.
+package kpi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+)
+
+// KPIs measured from the injection of a scenario's findings
+const (
+	TimeToEvidence = "time_to_evidence"
+	TimeToContain  = "time_to_contain"
+	TimeToNotify   = "time_to_notify"
+)
+
+// Metrics are the KPIs in report order
+var Metrics = []string{TimeToEvidence, TimeToContain, TimeToNotify}
+
+// exitStates are the IR workflow states whose exit ends each execution KPI
+var exitStates = map[string]string{
+	TimeToContain: "IsolateResource",
+	TimeToNotify:  "Notify",
+}
+
+// Sample is the KPIs of one scenario run through one source. A KPI the run did not reach, e.g.
+// containment of a finding that is only notified, is left out rather than recorded as zero.
+type Sample struct {
+	Scenario string                   `json:"scenario"`
+	Source   string                   `json:"source"`
+	RunID    string                   `json:"run_id"`
+	Time     time.Time                `json:"time"`
+	Metrics  map[string]time.Duration `json:"metrics"`
+}
+
+// Series is the scenario and source a sample is compared within
+func (s Sample) Series() string {
+	return s.Scenario + "/" + s.Source
+}
+
+// FromResult measures the KPIs of a finished scenario run. Each KPI is the slowest of the run's
+// findings, since an incident is only as far along as its last finding.
+func FromResult(target scenario.Target, result *scenario.Result, source, runID string) (Sample, error) {
+	sample := Sample{
+		Scenario: result.Scenario,
+		Source:   source,
+		RunID:    runID,
+		Time:     result.Injected,
+		Metrics:  map[string]time.Duration{},
+	}
+	observe := func(metric string, at time.Time) {
+		if elapsed := at.Sub(result.Injected); elapsed > sample.Metrics[metric] {
+			sample.Metrics[metric] = elapsed
+		}
+	}
+
+	s3Client := s3.New(target.Session)
+	for id, effects := range result.Observed {
+		if !effects["evidence"] {
+			continue
+		}
+		object, err := s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(target.EvidenceBucket),
+			Key:    aws.String("findings/" + id + ".json"),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+				continue
+			}
+			return Sample{}, fmt.Errorf("failed to head evidence of %s: %w", id, err)
+		}
+		observe(TimeToEvidence, aws.TimeValue(object.LastModified))
+	}
+
+	for id, executionARN := range result.ExecutionARNs() {
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, executionARN)
+		if err != nil {
+			return Sample{}, fmt.Errorf("failed to get execution history of %s: %w", id, err)
+		}
+		for _, event := range history.Events {
+			if event.StateExitedEventDetails == nil {
+				continue
+			}
+			for metric, state := range exitStates {
+				if aws.StringValue(event.StateExitedEventDetails.Name) == state {
+					observe(metric, aws.TimeValue(event.Timestamp))
+				}
+			}
+		}
+	}
+
+	return sample, nil
+}
+
+// Record measures a passed scenario run and records it in the store. Failed runs are not recorded,
+// since a run that timed out would drag the trend towards its timeout.
+func Record(store Store, target scenario.Target, result *scenario.Result, source, runID string) error {
+	if !result.Passed() {
+		return nil
+	}
+
+	sample, err := FromResult(target, result, source, runID)
+	if err != nil {
+		return err
+	}
+	if len(sample.Metrics) == 0 {
+		return nil
+	}
+
+	return store.Record(sample)
+}
@@ -0,0 +1,134 @@
+package kpi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Trend compares the latest run of a scenario and source against the runs before it
+type Trend struct {
+	Series string
+	Metric string
+	Runs   int
+	Latest time.Duration
+	// Baseline is the median of up to window runs before the latest; zero when there are none
+	Baseline time.Duration
+	// P90 is over every run in the report, the latest included
+	P90 time.Duration
+}
+
+// Change is the latest run's change from the baseline in percent; positive is slower
+func (t Trend) Change() float64 {
+	if t.Baseline == 0 {
+		return 0
+	}
+	return float64(t.Latest-t.Baseline) / float64(t.Baseline) * 100
+}
+
+// Report is the trend of every KPI per scenario and source, ordered by series then metric
+type Report struct {
+	Since  time.Time
+	Trends []Trend
+}
+
+// BuildReport groups the samples by scenario and source and compares each KPI's latest value with
+// the median of the window runs before it. The median keeps one slow run from moving the baseline.
+func BuildReport(samples []Sample, since time.Time, window int) Report {
+	values := map[string]map[string][]time.Duration{}
+	for _, sample := range oldestFirst(samples, since) {
+		series := sample.Series()
+		if values[series] == nil {
+			values[series] = map[string][]time.Duration{}
+		}
+		for metric, value := range sample.Metrics {
+			values[series][metric] = append(values[series][metric], value)
+		}
+	}
+
+	report := Report{Since: since}
+	for series, metrics := range values {
+		for metric, runs := range metrics {
+			latest := runs[len(runs)-1]
+			previous := runs[:len(runs)-1]
+			if window > 0 && len(previous) > window {
+				previous = previous[len(previous)-window:]
+			}
+			report.Trends = append(report.Trends, Trend{
+				Series:   series,
+				Metric:   metric,
+				Runs:     len(runs),
+				Latest:   latest,
+				Baseline: percentile(previous, 50),
+				P90:      percentile(runs, 90),
+			})
+		}
+	}
+
+	rank := map[string]int{}
+	for i, metric := range Metrics {
+		rank[metric] = i
+	}
+	sort.Slice(report.Trends, func(i, j int) bool {
+		a, b := report.Trends[i], report.Trends[j]
+		if a.Series != b.Series {
+			return a.Series < b.Series
+		}
+		return rank[a.Metric] < rank[b.Metric]
+	})
+
+	return report
+}
+
+// Regressions returns the trends whose latest run is more than maxPercent slower than the baseline
+func (r Report) Regressions(maxPercent float64) []Trend {
+	var regressions []Trend
+	for _, trend := range r.Trends {
+		if trend.Change() > maxPercent {
+			regressions = append(regressions, trend)
+		}
+	}
+	return regressions
+}
+
+// String renders the report as a table, one row per scenario, source and KPI
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "incident KPIs since %s:\n", r.Since.UTC().Format(time.RFC3339))
+
+	table := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SCENARIO/SOURCE\tKPI\tRUNS\tLATEST\tBASELINE\tP90\tCHANGE")
+	for _, trend := range r.Trends {
+		change := "-"
+		if trend.Baseline > 0 {
+			change = fmt.Sprintf("%+.1f%%", trend.Change())
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", trend.Series, trend.Metric, trend.Runs,
+			trend.Latest.Round(time.Second), trend.Baseline.Round(time.Second), trend.P90.Round(time.Second), change)
+	}
+	table.Flush()
+
+	return b.String()
+}
+
+// percentile returns the nearest-rank percentile of the values, or zero when there are none. The
+// 50th percentile of an even count is the mean of the middle two, as in perfbaseline.
+func percentile(values []time.Duration, p int) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	if p == 50 && len(sorted)%2 == 0 {
+		middle := len(sorted) / 2
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
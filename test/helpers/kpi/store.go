@@ -0,0 +1,317 @@
+package kpi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/timestreamquery"
+	"github.com/aws/aws-sdk-go/service/timestreamwrite"
+)
+
+// Store persists KPI samples across runs
+type Store interface {
+	// Record appends a sample
+	Record(sample Sample) error
+	// Samples returns the samples taken at or after since, oldest first
+	Samples(since time.Time) ([]Sample, error)
+}
+
+// FromEnv returns the store named by KPI_TIMESTREAM_DATABASE and KPI_TIMESTREAM_TABLE, or by
+// KPI_S3_BUCKET (with optional KPI_S3_PREFIX), falling back to an in-memory store that keeps
+// nothing past the process
+func FromEnv(sess *session.Session) Store {
+	switch {
+	case os.Getenv("KPI_TIMESTREAM_DATABASE") != "" && os.Getenv("KPI_TIMESTREAM_TABLE") != "":
+		return NewTimestreamStore(sess, os.Getenv("KPI_TIMESTREAM_DATABASE"), os.Getenv("KPI_TIMESTREAM_TABLE"))
+	case os.Getenv("KPI_S3_BUCKET") != "":
+		prefix := os.Getenv("KPI_S3_PREFIX")
+		if prefix == "" {
+			prefix = "kpi"
+		}
+		return NewS3Store(sess, os.Getenv("KPI_S3_BUCKET"), prefix)
+	default:
+		return NewMemoryStore()
+	}
+}
+
+// MemoryStore keeps samples in process; used when no backend is configured
+type MemoryStore struct {
+	mu      sync.Mutex
+	samples []Sample
+}
+
+// NewMemoryStore returns an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Record implements Store
+func (m *MemoryStore) Record(sample Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.samples = append(m.samples, sample)
+	return nil
+}
+
+// Samples implements Store
+func (m *MemoryStore) Samples(since time.Time) ([]Sample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return oldestFirst(m.samples, since), nil
+}
+
+// S3Store keeps one JSON history object per scenario and source under a prefix
+type S3Store struct {
+	Bucket string
+	Prefix string
+	// MaxHistory caps the stored samples per scenario and source; 0 keeps 500
+	MaxHistory int
+
+	client *s3.S3
+	mu     sync.Mutex
+}
+
+// NewS3Store returns a store backed by the bucket
+func NewS3Store(sess *session.Session, bucket, prefix string) *S3Store {
+	return &S3Store{Bucket: bucket, Prefix: prefix, client: s3.New(sess)}
+}
+
+func (s *S3Store) key(series string) string {
+	return strings.TrimSuffix(s.Prefix, "/") + "/" + strings.ReplaceAll(series, "/", "__") + ".json"
+}
+
+// history reads one history object; a missing object is an empty history
+func (s *S3Store) history(key string) ([]Sample, error) {
+	object, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read KPI history %s: %w", key, err)
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("failed to parse KPI history %s: %w", key, err)
+	}
+	return samples, nil
+}
+
+// Record implements Store. Concurrent runs of the same scenario and source may race; the last writer
+// wins, which only loses a single sample.
+func (s *S3Store) Record(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.key(sample.Series())
+	samples, err := s.history(key)
+	if err != nil {
+		return err
+	}
+
+	samples = append(samples, sample)
+
+	maxHistory := s.MaxHistory
+	if maxHistory <= 0 {
+		maxHistory = 500
+	}
+	if len(samples) > maxHistory {
+		samples = samples[len(samples)-maxHistory:]
+	}
+
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write KPI history for %s: %w", sample.Series(), err)
+	}
+
+	return nil
+}
+
+// Samples implements Store
+func (s *S3Store) Samples(since time.Time) ([]Sample, error) {
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(strings.TrimSuffix(s.Prefix, "/") + "/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if strings.HasSuffix(aws.StringValue(object.Key), ".json") {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list KPI histories: %w", err)
+	}
+
+	var samples []Sample
+	for _, key := range keys {
+		history, err := s.history(key)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, history...)
+	}
+
+	return oldestFirst(samples, since), nil
+}
+
+// TimestreamStore writes each KPI as a record with the scenario, source and run ID as dimensions and
+// the value in milliseconds, so dashboards can query the table directly
+type TimestreamStore struct {
+	Database string
+	Table    string
+
+	writeClient *timestreamwrite.TimestreamWrite
+	queryClient *timestreamquery.TimestreamQuery
+}
+
+// NewTimestreamStore returns a store backed by the table
+func NewTimestreamStore(sess *session.Session, database, table string) *TimestreamStore {
+	return &TimestreamStore{
+		Database:    database,
+		Table:       table,
+		writeClient: timestreamwrite.New(sess),
+		queryClient: timestreamquery.New(sess),
+	}
+}
+
+// Record implements Store
+func (t *TimestreamStore) Record(sample Sample) error {
+	var records []*timestreamwrite.Record
+	for _, metric := range Metrics {
+		value, ok := sample.Metrics[metric]
+		if !ok {
+			continue
+		}
+		records = append(records, &timestreamwrite.Record{
+			MeasureName:      aws.String(metric),
+			MeasureValue:     aws.String(strconv.FormatInt(value.Milliseconds(), 10)),
+			MeasureValueType: aws.String(timestreamwrite.MeasureValueTypeBigint),
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	_, err := t.writeClient.WriteRecords(&timestreamwrite.WriteRecordsInput{
+		DatabaseName: aws.String(t.Database),
+		TableName:    aws.String(t.Table),
+		CommonAttributes: &timestreamwrite.Record{
+			Dimensions: []*timestreamwrite.Dimension{
+				{Name: aws.String("scenario"), Value: aws.String(sample.Scenario)},
+				{Name: aws.String("source"), Value: aws.String(sample.Source)},
+				{Name: aws.String("run_id"), Value: aws.String(sample.RunID)},
+			},
+			Time:     aws.String(strconv.FormatInt(sample.Time.UnixMilli(), 10)),
+			TimeUnit: aws.String(timestreamwrite.TimeUnitMilliseconds),
+		},
+		Records: records,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write KPIs of %s: %w", sample.Series(), err)
+	}
+
+	return nil
+}
+
+// Samples implements Store
+func (t *TimestreamStore) Samples(since time.Time) ([]Sample, error) {
+	query := fmt.Sprintf(`SELECT scenario, source, run_id, time, measure_name, measure_value::bigint FROM "%s"."%s"
+WHERE time >= from_milliseconds(%d) ORDER BY time`, t.Database, t.Table, since.UnixMilli())
+
+	samples := map[string]*Sample{}
+	var order []string
+	var parseErr error
+	err := t.queryClient.QueryPages(&timestreamquery.QueryInput{QueryString: aws.String(query)},
+		func(page *timestreamquery.QueryOutput, lastPage bool) bool {
+			for _, row := range page.Rows {
+				values := make([]string, len(row.Data))
+				for i, datum := range row.Data {
+					values[i] = aws.StringValue(datum.ScalarValue)
+				}
+				if len(values) != 6 {
+					parseErr = fmt.Errorf("expected 6 columns, got %d", len(values))
+					return false
+				}
+
+				key := values[0] + "/" + values[1] + "/" + values[2]
+				sample, ok := samples[key]
+				if !ok {
+					at, err := time.Parse("2006-01-02 15:04:05.999999999", values[3])
+					if err != nil {
+						parseErr = fmt.Errorf("failed to parse time %q of %s: %w", values[3], key, err)
+						return false
+					}
+					sample = &Sample{Scenario: values[0], Source: values[1], RunID: values[2], Time: at, Metrics: map[string]time.Duration{}}
+					samples[key] = sample
+					order = append(order, key)
+				}
+				milliseconds, err := strconv.ParseInt(values[5], 10, 64)
+				if err != nil {
+					parseErr = fmt.Errorf("failed to parse %s %q of %s: %w", values[4], values[5], key, err)
+					return false
+				}
+				sample.Metrics[values[4]] = time.Duration(milliseconds) * time.Millisecond
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query KPIs from %s.%s: %w", t.Database, t.Table, err)
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	result := make([]Sample, 0, len(order))
+	for _, key := range order {
+		result = append(result, *samples[key])
+	}
+	return oldestFirst(result, since), nil
+}
+
+// oldestFirst returns the samples taken at or after since, sorted by time
+func oldestFirst(samples []Sample, since time.Time) []Sample {
+	var kept []Sample
+	for _, sample := range samples {
+		if !sample.Time.Before(since) {
+			kept = append(kept, sample)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Time.Before(kept[j].Time) })
+	return kept
+}
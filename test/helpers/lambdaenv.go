@@ -0,0 +1,97 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// EnvVarRule is the format a Lambda environment variable must have
+type EnvVarRule struct {
+	Pattern *regexp.Regexp
+	// AllowEmpty accepts an empty value for features that are switched off
+	AllowEmpty bool
+}
+
+// EnvContract is the complete set of environment variables a function expects, keyed by name
+type EnvContract map[string]EnvVarRule
+
+// TriageEnvContract is the environment modules/lambda_triage sets on the triage function
+var TriageEnvContract = EnvContract{
+	"EVIDENCE_BUCKET":              {Pattern: regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)},
+	"EVIDENCE_KMS_KEY":             {Pattern: regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:\d{12}:key/[0-9a-f-]{36}$`)},
+	"SNS_TOPIC_ARN":                {Pattern: regexp.MustCompile(`^arn:aws[a-z-]*:sns:[a-z0-9-]+:\d{12}:[\w-]+$`)},
+	"URGENT_SNS_TOPIC_ARN":         {Pattern: regexp.MustCompile(`^arn:aws[a-z-]*:sns:[a-z0-9-]+:\d{12}:[\w-]+$`), AllowEmpty: true},
+	"STATE_MACHINE_ARN":            {Pattern: regexp.MustCompile(`^arn:aws[a-z-]*:states:[a-z0-9-]+:\d{12}:stateMachine:[\w-]+$`)},
+	"QUARANTINE_SG_ID":             {Pattern: regexp.MustCompile(`^sg-[0-9a-f]{8,17}$`)},
+	"DEDUP_WINDOW_MINUTES":         {Pattern: regexp.MustCompile(`^\d+$`)},
+	"EXEMPTION_TAG":                {Pattern: regexp.MustCompile(`^[^=]+=[^=]*$`), AllowEmpty: true},
+	"CONTAINMENT_PAUSE_PARAMETER":  {Pattern: regexp.MustCompile(`^/ir/[\w.-]*containment-paused$`)},
+	"DEFERRED_QUEUE_URL":           {Pattern: regexp.MustCompile(`^https://sqs\.[a-z0-9-]+\.amazonaws\.com/\d{12}/[\w-]+$`)},
+	"INTEGRATION_SECRET_ARNS":      {Pattern: regexp.MustCompile(`^\{("[\w-]+":"arn:aws[a-z-]*:secretsmanager:[^"]+",?)*\}$`)},
+	"ENABLE_FLOW_LOGS":             {Pattern: regexp.MustCompile(`^(true|false)$`)},
+	"FLOW_LOGS_LOG_GROUP":          {Pattern: regexp.MustCompile(`^[\w./#-]{1,512}$`), AllowEmpty: true},
+	"FLOW_LOGS_ROLE_ARN":           {Pattern: regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/[\w+=,.@/-]+$`), AllowEmpty: true},
+	"INCIDENT_TABLE":               {Pattern: regexp.MustCompile(`^[\w.-]{3,255}$`), AllowEmpty: true},
+	"INCIDENT_TTL_DAYS":            {Pattern: regexp.MustCompile(`^\d+$`)},
+	"RECURRENCE_WINDOW_MINUTES":    {Pattern: regexp.MustCompile(`^\d+$`)},
+	"ACCOUNT_CLASSIFICATION":       {Pattern: regexp.MustCompile(`^\{("\d{12}":"(production|sandbox)",?)*\}$`)},
+	"THREAT_INTEL_ENDPOINT":        {Pattern: regexp.MustCompile(`^https://\S+$`), AllowEmpty: true},
+	"THREAT_INTEL_PROVIDER":        {Pattern: regexp.MustCompile(`^(generic|virustotal|otx)$`)},
+	"THREAT_INTEL_TIMEOUT_SECONDS": {Pattern: regexp.MustCompile(`^([1-9]|10)$`)},
+	"THREAT_INTEL_MAX_LOOKUPS":     {Pattern: regexp.MustCompile(`^\d+$`)},
+	"DATA_CLASSIFICATIONS":         {Pattern: regexp.MustCompile(`^\[("[^"]+",?)*\]$`)},
+	"DATA_CLASSIFICATION_TAG":      {Pattern: regexp.MustCompile(`^[\w .:/=+@-]{1,128}$`)},
+	"PII_SCRUB_FIELDS":             {Pattern: regexp.MustCompile(`^\[("[^"]+",?)*\]$`)},
+	"AWS_USE_FIPS_ENDPOINT":        {Pattern: regexp.MustCompile(`^(true|false)$`)},
+}
+
+// AssertEnvironmentContract checks that the function's environment has exactly the variables in the
+// contract, each in its format, and that no value looks like a credential. Failures name variables,
+// never the values of suspected credentials.
+func AssertEnvironmentContract(sess *session.Session, functionName string, contract EnvContract) error {
+	config, err := lambda.New(sess).GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+
+	environment := map[string]string{}
+	if config.Environment != nil {
+		for name, value := range config.Environment.Variables {
+			environment[name] = aws.StringValue(value)
+		}
+	}
+
+	var problems []string
+	for name, rule := range contract {
+		value, ok := environment[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not set", name))
+		case value == "" && rule.AllowEmpty:
+		case !rule.Pattern.MatchString(value):
+			problems = append(problems, fmt.Sprintf("%s=%q does not match %s", name, value, rule.Pattern))
+		}
+	}
+	for name, value := range environment {
+		if _, ok := contract[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is not part of the contract", name))
+		}
+		if matched := scanLogMessage(value, DefaultLogScanRules, nil); len(matched) > 0 {
+			problems = append(problems, fmt.Sprintf("%s looks like a plaintext secret (%s)", name, strings.Join(matched, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("environment of %s breaks its contract:\n  %s", functionName, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
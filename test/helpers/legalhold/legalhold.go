@@ -0,0 +1,254 @@
+// Package legalhold places and releases S3 Object Lock legal holds on every version of a finding's
+// evidence. Each change is recorded in the evidence bucket under legal-holds/<finding ID>/, and the
+// records are held themselves, so the trail of who held what, when and for which matter cannot be
+// deleted while the evidence it covers can be released.
+package legalhold
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Actions a record can note
+const (
+	ActionPlace   = "place"
+	ActionRelease = "release"
+)
+
+// RecordPrefix is where the records of a finding's holds are kept, followed by the finding ID
+const RecordPrefix = "legal-holds/"
+
+// Version is one version of an evidence object
+type Version struct {
+	Key       string `json:"key"`
+	VersionID string `json:"version_id"`
+}
+
+// Record is the audit record of one hold change
+type Record struct {
+	FindingID string    `json:"finding_id"`
+	Action    string    `json:"action"`
+	Matter    string    `json:"matter"`
+	Actor     string    `json:"actor"`
+	Time      time.Time `json:"time"`
+	Versions  []Version `json:"versions"`
+	// Key is where the record is stored; not part of the record itself
+	Key string `json:"-"`
+}
+
+// Hold is the legal hold status of one evidence version
+type Hold struct {
+	Version
+	On bool
+}
+
+// Place puts every version of the finding's evidence under legal hold for the matter, e.g. a case
+// or ticket reference
+func Place(sess *session.Session, bucket, findingID, matter string) (*Record, error) {
+	return change(sess, bucket, findingID, matter, ActionPlace)
+}
+
+// Release lifts the legal hold from every version of the finding's evidence
+func Release(sess *session.Session, bucket, findingID, matter string) (*Record, error) {
+	return change(sess, bucket, findingID, matter, ActionRelease)
+}
+
+func change(sess *session.Session, bucket, findingID, matter, action string) (*Record, error) {
+	if matter == "" {
+		return nil, fmt.Errorf("a legal hold needs the matter it is for")
+	}
+	s3Client := s3.New(sess)
+
+	if err := requireObjectLock(s3Client, bucket); err != nil {
+		return nil, err
+	}
+	versions, err := evidenceVersions(s3Client, bucket, findingID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s holds no evidence for %s", bucket, findingID)
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify who is changing the hold: %w", err)
+	}
+
+	status := s3.ObjectLockLegalHoldStatusOn
+	if action == ActionRelease {
+		status = s3.ObjectLockLegalHoldStatusOff
+	}
+	for _, version := range versions {
+		if err := setHold(s3Client, bucket, version, status); err != nil {
+			return nil, err
+		}
+	}
+
+	record := &Record{
+		FindingID: findingID,
+		Action:    action,
+		Matter:    matter,
+		Actor:     aws.StringValue(identity.Arn),
+		Time:      time.Now().UTC(),
+		Versions:  versions,
+	}
+	if err := putRecord(s3Client, bucket, record); err != nil {
+		return record, fmt.Errorf("legal hold %sd on %s but not recorded: %w", action, findingID, err)
+	}
+	return record, nil
+}
+
+// Status returns the hold status of every version of the finding's evidence
+func Status(sess *session.Session, bucket, findingID string) ([]Hold, error) {
+	s3Client := s3.New(sess)
+
+	versions, err := evidenceVersions(s3Client, bucket, findingID)
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make([]Hold, 0, len(versions))
+	for _, version := range versions {
+		hold, err := s3Client.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(version.Key),
+			VersionId: aws.String(version.VersionID),
+		})
+		// A version that was never held has no hold to report
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NoSuchObjectLockConfiguration" {
+			holds = append(holds, Hold{Version: version})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the legal hold of %s@%s: %w", version.Key, version.VersionID, err)
+		}
+		holds = append(holds, Hold{Version: version, On: aws.StringValue(hold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn})
+	}
+	return holds, nil
+}
+
+// Records returns the audit records of the finding's holds, oldest first
+func Records(sess *session.Session, bucket, findingID string) ([]Record, error) {
+	s3Client := s3.New(sess)
+	var records []Record
+
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(RecordPrefix + findingID + "/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			records = append(records, Record{Key: aws.StringValue(object.Key)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list legal hold records of %s: %w", findingID, err)
+	}
+
+	for i := range records {
+		object, err := s3Client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(records[i].Key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", records[i].Key, err)
+		}
+		err = json.NewDecoder(object.Body).Decode(&records[i])
+		object.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", records[i].Key, err)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// requireObjectLock fails unless the bucket was created with Object Lock, without which S3 refuses
+// legal holds
+func requireObjectLock(s3Client *s3.S3, bucket string) error {
+	config, err := s3Client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ObjectLockConfigurationNotFoundError" {
+		return fmt.Errorf("%s does not have Object Lock enabled (evidence_object_lock_enabled)", bucket)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the Object Lock configuration of %s: %w", bucket, err)
+	}
+	if aws.StringValue(config.ObjectLockConfiguration.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+		return fmt.Errorf("%s does not have Object Lock enabled (evidence_object_lock_enabled)", bucket)
+	}
+	return nil
+}
+
+// evidenceVersions lists every version of the finding's evidence object, current and noncurrent
+func evidenceVersions(s3Client *s3.S3, bucket, findingID string) ([]Version, error) {
+	key := "findings/" + findingID + ".json"
+	var versions []Version
+
+	err := s3Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, version := range page.Versions {
+			// The prefix also matches longer keys that start with this one
+			if aws.StringValue(version.Key) == key {
+				versions = append(versions, Version{Key: key, VersionID: aws.StringValue(version.VersionId)})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list evidence versions of %s: %w", findingID, err)
+	}
+	return versions, nil
+}
+
+func setHold(s3Client *s3.S3, bucket string, version Version, status string) error {
+	if _, err := s3Client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(version.Key),
+		VersionId: aws.String(version.VersionID),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(status)},
+	}); err != nil {
+		return fmt.Errorf("failed to set the legal hold of %s@%s %s: %w", version.Key, version.VersionID, strings.ToLower(status), err)
+	}
+	return nil
+}
+
+// putRecord stores the record under the bucket's own key, as the bucket policy demands, and holds it
+func putRecord(s3Client *s3.S3, bucket string, record *Record) error {
+	encryption, err := s3Client.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return fmt.Errorf("failed to read the encryption of %s: %w", bucket, err)
+	}
+	var kmsKeyID *string
+	for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault != nil {
+			kmsKeyID = rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID
+		}
+	}
+
+	body, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	record.Key = RecordPrefix + record.FindingID + "/" + record.Time.Format("20060102T150405.000000000Z") + "-" + record.Action + ".json"
+	put, err := s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(record.Key),
+		Body:                 bytes.NewReader(body),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          kmsKeyID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", record.Key, err)
+	}
+	return setHold(s3Client, bucket, Version{Key: record.Key, VersionID: aws.StringValue(put.VersionId)}, s3.ObjectLockLegalHoldStatusOn)
+}
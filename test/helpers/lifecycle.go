@@ -0,0 +1,133 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LifecyclePrediction is where an object stands under a bucket's lifecycle rules at a point in time
+type LifecyclePrediction struct {
+	StorageClass string
+	Expired      bool
+}
+
+// lifecycleDay returns when an action N days after creation takes effect. S3 counts from the
+// midnight UTC following creation, so an object written at 10:00 on day 0 transitions at 00:00 on day N+1.
+func lifecycleDay(created time.Time, days int64) time.Time {
+	midnight := created.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return midnight.AddDate(0, 0, int(days))
+}
+
+// ruleApplies reports whether an enabled rule's filter matches the key. Rules filtering on tags or
+// object size are skipped, since the evaluator only knows the key.
+func ruleApplies(rule *s3.LifecycleRule, key string) bool {
+	if aws.StringValue(rule.Status) != s3.ExpirationStatusEnabled {
+		return false
+	}
+
+	prefix := aws.StringValue(rule.Prefix)
+	if filter := rule.Filter; filter != nil {
+		switch {
+		case filter.Tag != nil, filter.ObjectSizeGreaterThan != nil, filter.ObjectSizeLessThan != nil:
+			return false
+		case filter.And != nil:
+			if len(filter.And.Tags) > 0 || filter.And.ObjectSizeGreaterThan != nil || filter.And.ObjectSizeLessThan != nil {
+				return false
+			}
+			prefix = aws.StringValue(filter.And.Prefix)
+		default:
+			prefix = aws.StringValue(filter.Prefix)
+		}
+	}
+
+	return strings.HasPrefix(key, prefix)
+}
+
+// PredictStorageClass evaluates lifecycle rules for the current version of an object created at a
+// given time and returns its storage class and whether it has expired by the time at
+func PredictStorageClass(rules []*s3.LifecycleRule, key string, created, at time.Time) LifecyclePrediction {
+	prediction := LifecyclePrediction{StorageClass: s3.StorageClassStandard}
+	var transitioned time.Time
+
+	for _, rule := range rules {
+		if !ruleApplies(rule, key) {
+			continue
+		}
+
+		for _, transition := range rule.Transitions {
+			var effective time.Time
+			switch {
+			case transition.Days != nil:
+				effective = lifecycleDay(created, aws.Int64Value(transition.Days))
+			case transition.Date != nil:
+				effective = aws.TimeValue(transition.Date)
+			default:
+				continue
+			}
+
+			// The latest transition that has taken effect wins
+			if !at.Before(effective) && !effective.Before(transitioned) {
+				transitioned = effective
+				prediction.StorageClass = aws.StringValue(transition.StorageClass)
+			}
+		}
+
+		if expiration := rule.Expiration; expiration != nil {
+			switch {
+			case expiration.Days != nil:
+				prediction.Expired = prediction.Expired || !at.Before(lifecycleDay(created, aws.Int64Value(expiration.Days)))
+			case expiration.Date != nil:
+				prediction.Expired = prediction.Expired || !at.Before(aws.TimeValue(expiration.Date))
+			}
+		}
+	}
+
+	return prediction
+}
+
+// AssertLifecycleRetention asserts that an evidence object written today moves to Glacier and Deep
+// Archive and then expires on exactly the configured days
+func AssertLifecycleRetention(sess *session.Session, bucket string, glacierDays, deepArchiveDays, retentionDays int64) error {
+	config, err := s3.New(sess).GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get lifecycle configuration of %s: %w", bucket, err)
+	}
+
+	created := time.Now()
+	key := "findings/lifecycle-check.json"
+
+	// Check the day before and the day of each change
+	checks := []struct {
+		day  int64
+		want LifecyclePrediction
+	}{
+		{glacierDays - 1, LifecyclePrediction{StorageClass: s3.StorageClassStandard}},
+		{glacierDays, LifecyclePrediction{StorageClass: s3.TransitionStorageClassGlacier}},
+		{deepArchiveDays - 1, LifecyclePrediction{StorageClass: s3.TransitionStorageClassGlacier}},
+		{deepArchiveDays, LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive}},
+		{retentionDays - 1, LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive}},
+		{retentionDays, LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive, Expired: true}},
+	}
+
+	var problems []string
+	for _, check := range checks {
+		got := PredictStorageClass(config.Rules, key, created, lifecycleDay(created, check.day))
+		if got != check.want {
+			problems = append(problems, fmt.Sprintf("day %d: %s (expired %t), expected %s (expired %t)",
+				check.day, got.StorageClass, got.Expired, check.want.StorageClass, check.want.Expired))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("lifecycle rules of %s do not match the retention settings: %s", bucket, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
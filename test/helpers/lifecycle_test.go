@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// evidenceRule is a rule shaped like the evidence bucket's tiers: Glacier at 90 days, Deep Archive
+// at 180 and expiry at 365
+func evidenceRule(prefix string) *s3.LifecycleRule {
+	return &s3.LifecycleRule{
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+		Transitions: []*s3.Transition{
+			{Days: aws.Int64(90), StorageClass: aws.String(s3.TransitionStorageClassGlacier)},
+			{Days: aws.Int64(180), StorageClass: aws.String(s3.TransitionStorageClassDeepArchive)},
+		},
+		Expiration: &s3.LifecycleExpiration{Days: aws.Int64(365)},
+	}
+}
+
+func TestLifecycleDay(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		created time.Time
+		days    int64
+		want    time.Time
+	}{
+		{name: "mid-day", created: day.Add(10 * time.Hour), days: 0, want: day.AddDate(0, 0, 1)},
+		{name: "at midnight", created: day, days: 0, want: day.AddDate(0, 0, 1)},
+		{name: "just before midnight", created: day.Add(24*time.Hour - time.Nanosecond), days: 0, want: day.AddDate(0, 0, 1)},
+		{name: "days counted from the next midnight", created: day.Add(10 * time.Hour), days: 30, want: day.AddDate(0, 0, 31)},
+		{name: "across a month end", created: time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC), days: 29, want: day},
+		{name: "converted to UTC", created: time.Date(2024, 3, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), days: 0, want: day},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, lifecycleDay(test.created, test.days), test.name)
+	}
+}
+
+func TestPredictStorageClassTiers(t *testing.T) {
+	rules := []*s3.LifecycleRule{evidenceRule("findings/")}
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want LifecyclePrediction
+	}{
+		{"created", created, LifecyclePrediction{StorageClass: s3.StorageClassStandard}},
+		{"just before glacier", lifecycleDay(created, 90).Add(-time.Nanosecond), LifecyclePrediction{StorageClass: s3.StorageClassStandard}},
+		{"glacier", lifecycleDay(created, 90), LifecyclePrediction{StorageClass: s3.TransitionStorageClassGlacier}},
+		{"just before deep archive", lifecycleDay(created, 180).Add(-time.Nanosecond), LifecyclePrediction{StorageClass: s3.TransitionStorageClassGlacier}},
+		{"deep archive", lifecycleDay(created, 180), LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive}},
+		{"just before expiry", lifecycleDay(created, 365).Add(-time.Nanosecond), LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive}},
+		{"expired", lifecycleDay(created, 365), LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive, Expired: true}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, PredictStorageClass(rules, "findings/f-1.json", created, test.at), test.name)
+	}
+}
+
+func TestPredictStorageClassRules(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := lifecycleDay(created, 200)
+	deepArchive := LifecyclePrediction{StorageClass: s3.TransitionStorageClassDeepArchive}
+	standard := LifecyclePrediction{StorageClass: s3.StorageClassStandard}
+
+	disabled := evidenceRule("findings/")
+	disabled.Status = aws.String(s3.ExpirationStatusDisabled)
+
+	legacyPrefix := evidenceRule("")
+	legacyPrefix.Filter = nil
+	legacyPrefix.Prefix = aws.String("findings/")
+
+	andPrefix := evidenceRule("")
+	andPrefix.Filter = &s3.LifecycleRuleFilter{And: &s3.LifecycleRuleAndOperator{Prefix: aws.String("findings/")}}
+
+	andTags := evidenceRule("")
+	andTags.Filter = &s3.LifecycleRuleFilter{And: &s3.LifecycleRuleAndOperator{
+		Prefix: aws.String("findings/"),
+		Tags:   []*s3.Tag{{Key: aws.String("tier"), Value: aws.String("hot")}},
+	}}
+
+	tagged := evidenceRule("")
+	tagged.Filter = &s3.LifecycleRuleFilter{Tag: &s3.Tag{Key: aws.String("tier"), Value: aws.String("hot")}}
+
+	sized := evidenceRule("")
+	sized.Filter = &s3.LifecycleRuleFilter{ObjectSizeGreaterThan: aws.Int64(1024)}
+
+	dated := &s3.LifecycleRule{
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Transitions: []*s3.Transition{
+			{Date: aws.Time(at), StorageClass: aws.String(s3.TransitionStorageClassStandardIa)},
+		},
+		Expiration: &s3.LifecycleExpiration{Date: aws.Time(at)},
+	}
+
+	glacierSameDay := &s3.LifecycleRule{
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Transitions: []*s3.Transition{
+			{Days: aws.Int64(180), StorageClass: aws.String(s3.TransitionStorageClassGlacier)},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		rules []*s3.LifecycleRule
+		key   string
+		want  LifecyclePrediction
+	}{
+		{name: "no rules", key: "findings/f-1.json", want: standard},
+		{name: "prefix filter", rules: []*s3.LifecycleRule{evidenceRule("findings/")}, key: "findings/f-1.json", want: deepArchive},
+		{name: "other prefix", rules: []*s3.LifecycleRule{evidenceRule("findings/")}, key: "reports/r-1.json", want: standard},
+		{name: "empty prefix matches every key", rules: []*s3.LifecycleRule{evidenceRule("")}, key: "reports/r-1.json", want: deepArchive},
+		{name: "disabled", rules: []*s3.LifecycleRule{disabled}, key: "findings/f-1.json", want: standard},
+		{name: "rule prefix", rules: []*s3.LifecycleRule{legacyPrefix}, key: "findings/f-1.json", want: deepArchive},
+		{name: "and prefix", rules: []*s3.LifecycleRule{andPrefix}, key: "findings/f-1.json", want: deepArchive},
+		{name: "and tags skipped", rules: []*s3.LifecycleRule{andTags}, key: "findings/f-1.json", want: standard},
+		{name: "tag skipped", rules: []*s3.LifecycleRule{tagged}, key: "findings/f-1.json", want: standard},
+		{name: "size skipped", rules: []*s3.LifecycleRule{sized}, key: "findings/f-1.json", want: standard},
+		{
+			name:  "dates take effect at the instant",
+			rules: []*s3.LifecycleRule{dated},
+			key:   "findings/f-1.json",
+			want:  LifecyclePrediction{StorageClass: s3.TransitionStorageClassStandardIa, Expired: true},
+		},
+		{
+			name:  "latest transition across rules wins",
+			rules: []*s3.LifecycleRule{dated, evidenceRule("findings/")},
+			key:   "findings/f-1.json",
+			want:  LifecyclePrediction{StorageClass: s3.TransitionStorageClassStandardIa, Expired: true},
+		},
+		{
+			name:  "transitions on the same day go to the later rule",
+			rules: []*s3.LifecycleRule{evidenceRule("findings/"), glacierSameDay},
+			key:   "findings/f-1.json",
+			want:  LifecyclePrediction{StorageClass: s3.TransitionStorageClassGlacier},
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, PredictStorageClass(test.rules, test.key, created, at), test.name)
+	}
+}
@@ -0,0 +1,164 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// LogScanRule flags log messages matching Pattern as sensitive
+type LogScanRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultLogScanRules catch credentials and full finding dumps logged at DEBUG level. A finding dump
+// carries everything GuardDuty knows about the resource, so it only belongs in the evidence bucket.
+var DefaultLogScanRules = []LogScanRule{
+	{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b(AKIA|ASIA)[A-Z0-9]{16}\b`)},
+	{Name: "aws-secret-access-key", Pattern: regexp.MustCompile(`(?i)(aws_secret_access_key|secretaccesskey)["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{Name: "aws-session-token", Pattern: regexp.MustCompile(`(?i)(aws_session_token|sessiontoken)["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{100,}`)},
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{Name: "bearer-token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`)},
+	{Name: "debug-finding-dump", Pattern: regexp.MustCompile(`(?i)\bDEBUG\b.*"detail-type"\s*:\s*"GuardDuty Finding"`)},
+}
+
+// LogScanOptions selects what ScanLogs sweeps and what it looks for
+type LogScanOptions struct {
+	LogGroups []string
+	// Since bounds the scan to the test run; the scan starts earlier by the clock skew tolerance
+	Since time.Time
+	// Rules defaults to DefaultLogScanRules
+	Rules []LogScanRule
+	// InternalPublicIPs are public addresses of the run's internal hosts, e.g. test instances, which
+	// must not be logged
+	InternalPublicIPs []string
+	// Secrets is secret material keyed by integration, as returned by SecretMaterial
+	Secrets map[string][]string
+}
+
+// LogLeak is a log event holding sensitive material. Excerpt has the material redacted.
+type LogLeak struct {
+	LogGroup  string
+	LogStream string
+	Timestamp time.Time
+	Rule      string
+	Excerpt   string
+}
+
+// String implements fmt.Stringer
+func (l LogLeak) String() string {
+	return fmt.Sprintf("%s %s/%s [%s]: %s", l.Timestamp.UTC().Format(time.RFC3339), l.LogGroup, l.LogStream, l.Rule, l.Excerpt)
+}
+
+// ScanLogs sweeps the log groups' events since opts.Since and returns every event that matches a
+// rule, names an internal host's public IP or contains secret material
+func ScanLogs(sess *session.Session, opts LogScanOptions) ([]LogLeak, error) {
+	rules := opts.Rules
+	if rules == nil {
+		rules = DefaultLogScanRules
+	}
+
+	literals := map[string][]string{}
+	for _, ip := range opts.InternalPublicIPs {
+		if ip != "" {
+			literals["internal-public-ip"] = append(literals["internal-public-ip"], ip)
+		}
+	}
+	for name, values := range opts.Secrets {
+		literals["secret:"+name] = append(literals["secret:"+name], values...)
+	}
+
+	logsClient := cloudwatchlogs.New(sess)
+
+	var leaks []LogLeak
+	for _, logGroup := range opts.LogGroups {
+		err := logsClient.FilterLogEventsPages(&cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(logGroup),
+			StartTime:    aws.Int64(clock.Tolerant(opts.Since).UnixMilli()),
+		}, func(page *cloudwatchlogs.FilterLogEventsOutput, _ bool) bool {
+			for _, event := range page.Events {
+				message := aws.StringValue(event.Message)
+				for _, rule := range scanLogMessage(message, rules, literals) {
+					leaks = append(leaks, LogLeak{
+						LogGroup:  logGroup,
+						LogStream: aws.StringValue(event.LogStreamName),
+						Timestamp: time.UnixMilli(aws.Int64Value(event.Timestamp)),
+						Rule:      rule,
+						Excerpt:   redactLogMessage(message, rules, literals),
+					})
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", logGroup, err)
+		}
+	}
+
+	return leaks, nil
+}
+
+// AssertNoSensitiveLogs fails when ScanLogs finds anything. The failure lists redacted excerpts only.
+func AssertNoSensitiveLogs(sess *session.Session, opts LogScanOptions) error {
+	leaks, err := ScanLogs(sess, opts)
+	if err != nil {
+		return err
+	}
+	if len(leaks) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(leaks))
+	for i, leak := range leaks {
+		lines[i] = leak.String()
+	}
+	return fmt.Errorf("%d log events hold sensitive material:\n  %s", len(leaks), strings.Join(lines, "\n  "))
+}
+
+// scanLogMessage returns the names of the rules and literal sets the message matches
+func scanLogMessage(message string, rules []LogScanRule, literals map[string][]string) []string {
+	var matched []string
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(message) {
+			matched = append(matched, rule.Name)
+		}
+	}
+	for name, values := range literals {
+		for _, value := range values {
+			if value != "" && strings.Contains(message, value) {
+				matched = append(matched, name)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// redactLogMessage replaces everything the scan matched and truncates the result for reports
+func redactLogMessage(message string, rules []LogScanRule, literals map[string][]string) string {
+	for _, rule := range rules {
+		message = rule.Pattern.ReplaceAllString(message, "[REDACTED:"+rule.Name+"]")
+	}
+	for name, values := range literals {
+		for _, value := range values {
+			if value != "" {
+				message = strings.ReplaceAll(message, value, "[REDACTED:"+name+"]")
+			}
+		}
+	}
+
+	message = strings.TrimSpace(message)
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	return message
+}
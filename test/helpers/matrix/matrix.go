@@ -0,0 +1,299 @@
+// Package matrix expands a Helm-style values matrix of stack variables into the combinations a
+// suite validates. A matrix file holds base values, axes of alternative values for single
+// variables, overlays that add values when a combination matches, and exclusions. Every
+// combination is planned, and a pairwise-covering sample of them is applied, so configurations
+// that only break together are caught without deploying the full product.
+package matrix
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matrix is a values matrix loaded from YAML
+type Matrix struct {
+	// Values are the base values every combination starts from
+	Values map[string]interface{} `yaml:"values"`
+	// Axes are expanded into their cartesian product, in order
+	Axes []Axis `yaml:"axes"`
+	// Overlays add values to the combinations they match
+	Overlays []Overlay `yaml:"overlays"`
+	// Exclude drops the combinations it matches altogether
+	Exclude []Selector `yaml:"exclude"`
+	// Apply selects which combinations are applied as well as planned
+	Apply ApplyPolicy `yaml:"apply"`
+
+	// Path is the file the matrix was loaded from
+	Path string `yaml:"-"`
+}
+
+// Axis is one stack variable and the alternative values it takes. Values are written either as a
+// list of scalars, named by their value, or as a mapping from names to values of any shape.
+type Axis struct {
+	Variable string
+	Values   []Value
+}
+
+// Value is one named alternative of an axis
+type Value struct {
+	Name  string
+	Value interface{}
+}
+
+// Overlay merges Values into every combination When matches, e.g. to set the variables org mode needs
+type Overlay struct {
+	When   Selector               `yaml:"when"`
+	Values map[string]interface{} `yaml:"values"`
+}
+
+// Selector matches combinations by value name per axis variable; a combination matches when every
+// listed variable took the named value
+type Selector map[string]string
+
+// ApplyPolicy bounds the full applies: at most Samples combinations, none that Exclude matches,
+// e.g. org mode in an account that is not an organization's delegated administrator
+type ApplyPolicy struct {
+	Samples int        `yaml:"samples"`
+	Exclude []Selector `yaml:"exclude"`
+}
+
+// Combination is one choice of value per axis, with the merged variables it is validated with
+type Combination struct {
+	// Choices names the value taken on each axis, by variable
+	Choices map[string]string
+	// Vars are the base values with the chosen values and matching overlays merged in
+	Vars map[string]interface{}
+
+	axes []string
+}
+
+// Name identifies the combination in test names, e.g. "org_mode=false,isolation_strategy=NACL-based"
+func (c Combination) Name() string {
+	parts := make([]string, 0, len(c.axes))
+	for _, variable := range c.axes {
+		parts = append(parts, variable+"="+c.Choices[variable])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches reports whether the combination took every value the selector names
+func (s Selector) Matches(c Combination) bool {
+	for variable, name := range s {
+		if c.Choices[variable] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalYAML reads an axis whose values are a list of scalars or a mapping of named values,
+// keeping the order they are written in
+func (a *Axis) UnmarshalYAML(node *yaml.Node) error {
+	var raw struct {
+		Variable string    `yaml:"variable"`
+		Values   yaml.Node `yaml:"values"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	a.Variable = raw.Variable
+
+	switch raw.Values.Kind {
+	case yaml.SequenceNode:
+		for _, item := range raw.Values.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: listed values of %s must be scalars; name other values in a mapping", item.Line, a.Variable)
+			}
+			var value interface{}
+			if err := item.Decode(&value); err != nil {
+				return err
+			}
+			a.Values = append(a.Values, Value{Name: item.Value, Value: value})
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(raw.Values.Content); i += 2 {
+			var value interface{}
+			if err := raw.Values.Content[i+1].Decode(&value); err != nil {
+				return err
+			}
+			a.Values = append(a.Values, Value{Name: raw.Values.Content[i].Value, Value: value})
+		}
+
+	default:
+		return fmt.Errorf("line %d: values of %s must be a list or a mapping", node.Line, a.Variable)
+	}
+	return nil
+}
+
+// Load reads and validates a matrix file
+func Load(path string) (*Matrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values matrix: %w", err)
+	}
+
+	var m Matrix
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse values matrix %s: %w", path, err)
+	}
+	m.Path = path
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("values matrix %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that every axis has values with unique names and that selectors only name
+// values the axes have
+func (m *Matrix) Validate() error {
+	if len(m.Axes) == 0 {
+		return fmt.Errorf("no axes")
+	}
+
+	names := map[string]map[string]bool{}
+	for _, axis := range m.Axes {
+		if axis.Variable == "" {
+			return fmt.Errorf("an axis has no variable")
+		}
+		if names[axis.Variable] != nil {
+			return fmt.Errorf("variable %s has more than one axis", axis.Variable)
+		}
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("axis %s has no values", axis.Variable)
+		}
+		names[axis.Variable] = map[string]bool{}
+		for _, value := range axis.Values {
+			if names[axis.Variable][value.Name] {
+				return fmt.Errorf("axis %s has value %s twice", axis.Variable, value.Name)
+			}
+			names[axis.Variable][value.Name] = true
+		}
+	}
+
+	selectors := append(append([]Selector(nil), m.Exclude...), m.Apply.Exclude...)
+	for _, overlay := range m.Overlays {
+		selectors = append(selectors, overlay.When)
+	}
+	for _, selector := range selectors {
+		for variable, name := range selector {
+			if names[variable] == nil {
+				return fmt.Errorf("selector names %s, which has no axis", variable)
+			}
+			if !names[variable][name] {
+				return fmt.Errorf("selector names %s=%s, which is not a value of its axis", variable, name)
+			}
+		}
+	}
+
+	if m.Apply.Samples < 0 {
+		return fmt.Errorf("apply samples must not be negative")
+	}
+	return nil
+}
+
+// Expand returns every combination the exclusions leave, in axis order: the last axis varies fastest
+func (m *Matrix) Expand() []Combination {
+	axes := make([]string, 0, len(m.Axes))
+	for _, axis := range m.Axes {
+		axes = append(axes, axis.Variable)
+	}
+
+	var combinations []Combination
+	indices := make([]int, len(m.Axes))
+	for {
+		combination := Combination{Choices: map[string]string{}, axes: axes}
+		for i, axis := range m.Axes {
+			combination.Choices[axis.Variable] = axis.Values[indices[i]].Name
+		}
+		if !matchesAny(m.Exclude, combination) {
+			combination.Vars = m.vars(indices, combination)
+			combinations = append(combinations, combination)
+		}
+
+		// Advance the indices like an odometer
+		i := len(indices) - 1
+		for ; i >= 0; i-- {
+			indices[i]++
+			if indices[i] < len(m.Axes[i].Values) {
+				break
+			}
+			indices[i] = 0
+		}
+		if i < 0 {
+			return combinations
+		}
+	}
+}
+
+// Applicable returns the combinations the apply exclusions leave
+func (m *Matrix) Applicable(combinations []Combination) []Combination {
+	var applicable []Combination
+	for _, combination := range combinations {
+		if !matchesAny(m.Apply.Exclude, combination) {
+			applicable = append(applicable, combination)
+		}
+	}
+	return applicable
+}
+
+// vars merges the base values, the chosen axis values and the matching overlays, in that order
+func (m *Matrix) vars(indices []int, combination Combination) map[string]interface{} {
+	vars := merge(nil, m.Values)
+	for i, axis := range m.Axes {
+		vars = merge(vars, map[string]interface{}{axis.Variable: axis.Values[indices[i]].Value})
+	}
+	for _, overlay := range m.Overlays {
+		if overlay.When.Matches(combination) {
+			vars = merge(vars, overlay.Values)
+		}
+	}
+	return vars
+}
+
+func matchesAny(selectors []Selector, combination Combination) bool {
+	for _, selector := range selectors {
+		if selector.Matches(combination) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns dst with src merged in as Helm merges values files: maps merge key by key,
+// anything else in src replaces what dst has. Neither argument is modified.
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for key, value := range dst {
+		merged[key] = value
+	}
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := merged[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			merged[key] = merge(dstMap, srcMap)
+		} else if srcIsMap {
+			merged[key] = merge(nil, srcMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// sortedKeys returns the variables of a combination's choices in order, so sampling is deterministic
+func sortedKeys(choices map[string]string) []string {
+	keys := make([]string, 0, len(choices))
+	for key := range choices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package matrix
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Environment variables that override a matrix's apply sampling
+const (
+	// SeedEnv fixes the sampling seed, to reproduce the applies of an earlier run
+	SeedEnv = "MATRIX_SEED"
+	// SamplesEnv overrides the number of applies; 0 makes the run plan-only
+	SamplesEnv = "MATRIX_APPLIES"
+)
+
+// SeedFromEnv returns the seed SeedEnv sets, or else one derived from the UTC date, so each day's
+// run applies a different sample while reruns on the same day apply the same one
+func SeedFromEnv() (int64, error) {
+	if value := os.Getenv(SeedEnv); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s=%s is not an integer", SeedEnv, value)
+		}
+		return seed, nil
+	}
+
+	year, month, day := clock.Default.Now().UTC().Date()
+	return int64(year*10000 + int(month)*100 + day), nil
+}
+
+// SamplesFromEnv returns the number of applies SamplesEnv sets, or the matrix's own
+func (m *Matrix) SamplesFromEnv() (int, error) {
+	value := os.Getenv(SamplesEnv)
+	if value == "" {
+		return m.Apply.Samples, nil
+	}
+	samples, err := strconv.Atoi(value)
+	if err != nil || samples < 0 {
+		return 0, fmt.Errorf("%s=%s is not a count", SamplesEnv, value)
+	}
+	return samples, nil
+}
+
+// pair is two axis values taken together, or with b empty a single value
+type pair struct {
+	a, b string
+}
+
+// pairs returns every value the combination takes and every pair of them it takes together
+func pairs(c Combination) []pair {
+	keys := sortedKeys(c.Choices)
+	var taken []pair
+	for i := range keys {
+		taken = append(taken, pair{a: keys[i] + "=" + c.Choices[keys[i]]})
+		for j := i + 1; j < len(keys); j++ {
+			taken = append(taken, pair{
+				a: keys[i] + "=" + c.Choices[keys[i]],
+				b: keys[j] + "=" + c.Choices[keys[j]],
+			})
+		}
+	}
+	return taken
+}
+
+// Sample picks at most n of the combinations, greedily covering as many value pairs as it can: each
+// pick is the combination taking the most values and pairs no earlier pick took. The seed shuffles
+// the candidates, so ties go differently from seed to seed while a seed always picks the same
+// sample. Sampling stops early once everything is covered.
+func Sample(combinations []Combination, n int, seed int64) []Combination {
+	candidates := append([]Combination(nil), combinations...)
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	covered := map[pair]bool{}
+	var sample []Combination
+	for len(sample) < n && len(candidates) > 0 {
+		best, bestCount := -1, -1
+		for i, candidate := range candidates {
+			count := 0
+			for _, p := range pairs(candidate) {
+				if !covered[p] {
+					count++
+				}
+			}
+			if count > bestCount {
+				best, bestCount = i, count
+			}
+		}
+		if bestCount == 0 {
+			break
+		}
+
+		for _, p := range pairs(candidates[best]) {
+			covered[p] = true
+		}
+		sample = append(sample, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return sample
+}
@@ -0,0 +1,183 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// MemberStatusEnabled is the member status GuardDuty and Security Hub report for a fully enrolled account
+const MemberStatusEnabled = "Enabled"
+
+// OrgAccount is an account of the organization
+type OrgAccount struct {
+	ID   string
+	Name string
+}
+
+// EnrollmentReport lists the active organization accounts that a service does not fully cover
+type EnrollmentReport struct {
+	Service string
+	// Unenrolled accounts are not members at all
+	Unenrolled []OrgAccount
+	// NotEnabled maps member accounts to their status when it is not Enabled
+	NotEnabled map[string]string
+}
+
+// Complete reports whether every account is an Enabled member
+func (r EnrollmentReport) Complete() bool {
+	return len(r.Unenrolled) == 0 && len(r.NotEnabled) == 0
+}
+
+// String renders the gaps, one account per line
+func (r EnrollmentReport) String() string {
+	if r.Complete() {
+		return fmt.Sprintf("%s: all accounts enrolled\n", r.Service)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d unenrolled, %d not enabled\n", r.Service, len(r.Unenrolled), len(r.NotEnabled))
+	for _, account := range r.Unenrolled {
+		fmt.Fprintf(&b, "  %s (%s): not a member\n", account.ID, account.Name)
+	}
+
+	ids := make([]string, 0, len(r.NotEnabled))
+	for id := range r.NotEnabled {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(&b, "  %s: %s\n", id, r.NotEnabled[id])
+	}
+
+	return b.String()
+}
+
+// ActiveOrgAccounts returns the organization's active accounts. It must run in the management or a
+// delegated administrator account.
+func ActiveOrgAccounts(sess *session.Session) ([]OrgAccount, error) {
+	var accounts []OrgAccount
+
+	err := organizations.New(sess).ListAccountsPages(&organizations.ListAccountsInput{},
+		func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+			for _, account := range page.Accounts {
+				if aws.StringValue(account.Status) == organizations.AccountStatusActive {
+					accounts = append(accounts, OrgAccount{ID: aws.StringValue(account.Id), Name: aws.StringValue(account.Name)})
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization accounts: %w", err)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// GuardDutyMemberStatuses returns the relationship status of every member of the region's detector
+func GuardDutyMemberStatuses(sess *session.Session) (map[string]string, error) {
+	gdClient := guardduty.New(sess)
+
+	detectors, err := gdClient.ListDetectors(&guardduty.ListDetectorsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return nil, fmt.Errorf("no GuardDuty detector in this region")
+	}
+
+	statuses := map[string]string{}
+	err = gdClient.ListMembersPages(&guardduty.ListMembersInput{
+		DetectorId:     detectors.DetectorIds[0],
+		OnlyAssociated: aws.String("false"),
+	}, func(page *guardduty.ListMembersOutput, lastPage bool) bool {
+		for _, member := range page.Members {
+			statuses[aws.StringValue(member.AccountId)] = aws.StringValue(member.RelationshipStatus)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GuardDuty members: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// SecurityHubMemberStatuses returns the member status of every Security Hub member account
+func SecurityHubMemberStatuses(sess *session.Session) (map[string]string, error) {
+	statuses := map[string]string{}
+
+	err := securityhub.New(sess).ListMembersPages(&securityhub.ListMembersInput{
+		OnlyAssociated: aws.Bool(false),
+	}, func(page *securityhub.ListMembersOutput, lastPage bool) bool {
+		for _, member := range page.Members {
+			statuses[aws.StringValue(member.AccountId)] = aws.StringValue(member.MemberStatus)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Security Hub members: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// BuildEnrollmentReport compares member statuses with the organization's accounts. The administrator
+// account is not its own member and is skipped.
+func BuildEnrollmentReport(service, adminAccountID string, accounts []OrgAccount, statuses map[string]string) EnrollmentReport {
+	report := EnrollmentReport{Service: service, NotEnabled: map[string]string{}}
+
+	for _, account := range accounts {
+		if account.ID == adminAccountID {
+			continue
+		}
+
+		status, ok := statuses[account.ID]
+		switch {
+		case !ok:
+			report.Unenrolled = append(report.Unenrolled, account)
+		case status != MemberStatusEnabled:
+			report.NotEnabled[account.ID] = status
+		}
+	}
+
+	return report
+}
+
+// CheckMemberEnrollment reports GuardDuty and Security Hub enrollment gaps across the organization,
+// as seen from the delegated administrator account the session belongs to
+func CheckMemberEnrollment(sess *session.Session) ([]EnrollmentReport, error) {
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	adminAccountID := aws.StringValue(identity.Account)
+
+	accounts, err := ActiveOrgAccounts(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	guardDutyStatuses, err := GuardDutyMemberStatuses(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	securityHubStatuses, err := SecurityHubMemberStatuses(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	return []EnrollmentReport{
+		BuildEnrollmentReport("GuardDuty", adminAccountID, accounts, guardDutyStatuses),
+		BuildEnrollmentReport("Security Hub", adminAccountID, accounts, securityHubStatuses),
+	}, nil
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// GetMetricSum returns the Sum statistic of a CloudWatch metric over a time window
+func GetMetricSum(sess *session.Session, namespace, metricName string, dimensions map[string]string, start, end time.Time) (float64, error) {
+	cloudwatchClient := cloudwatch.New(sess)
+
+	var dims []*cloudwatch.Dimension
+	for name, value := range dimensions {
+		dims = append(dims, &cloudwatch.Dimension{
+			Name:  aws.String(name),
+			Value: aws.String(value),
+		})
+	}
+
+	stats, err := cloudwatchClient.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String(namespace),
+		MetricName: aws.String(metricName),
+		Dimensions: dims,
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s/%s statistics: %w", namespace, metricName, err)
+	}
+
+	sum := 0.0
+	for _, datapoint := range stats.Datapoints {
+		if datapoint.Sum != nil {
+			sum += *datapoint.Sum
+		}
+	}
+
+	return sum, nil
+}
+
+// GetLambdaMetricSum returns the Sum of an AWS/Lambda metric (Invocations, Errors, Throttles) for a function
+func GetLambdaMetricSum(sess *session.Session, functionName, metricName string, start, end time.Time) (float64, error) {
+	return GetMetricSum(sess, "AWS/Lambda", metricName, map[string]string{"FunctionName": functionName}, start, end)
+}
+
+// GetEventBridgeRuleMetricSum returns the Sum of an AWS/Events metric (RetryInvocationAttempts, FailedInvocations, InvocationsSentToDlq) for a rule
+func GetEventBridgeRuleMetricSum(sess *session.Session, ruleName, metricName string, start, end time.Time) (float64, error) {
+	return GetMetricSum(sess, "AWS/Events", metricName, map[string]string{"RuleName": ruleName}, start, end)
+}
+
+// WaitForMetricSum polls a metric until its Sum over the window reaches the expected minimum.
+// CloudWatch metrics arrive with a delay of a few minutes, so callers should allow a generous timeout.
+func WaitForMetricSum(sess *session.Session, namespace, metricName string, dimensions map[string]string, start time.Time, minimum float64, timeout time.Duration) (float64, error) {
+	deadline := clock.Default.Now().Add(timeout)
+
+	sum := 0.0
+	for clock.Default.Now().Before(deadline) {
+		var err error
+		sum, err = GetMetricSum(sess, namespace, metricName, dimensions, clock.Tolerant(start), clock.Default.Now().Add(clock.Skew()))
+		if err != nil {
+			return 0, err
+		}
+
+		if sum >= minimum {
+			return sum, nil
+		}
+
+		clock.Default.Sleep(30 * time.Second)
+	}
+
+	return sum, fmt.Errorf("metric %s/%s reached %.0f, expected at least %.0f within timeout", namespace, metricName, sum, minimum)
+}
@@ -0,0 +1,270 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// RequiredMetric is a metric the stack must chart on its dashboard and, when Critical, alarm on
+type RequiredMetric struct {
+	Namespace  string
+	MetricName string
+	Critical   bool
+}
+
+// String implements fmt.Stringer
+func (m RequiredMetric) String() string {
+	return m.Namespace + " " + m.MetricName
+}
+
+// RequiredStackMetrics are the metrics that show the pipeline failing to respond to findings, plus
+// triage volume for context
+var RequiredStackMetrics = []RequiredMetric{
+	{Namespace: "AWS/Lambda", MetricName: "Errors", Critical: true},
+	{Namespace: "AWS/Lambda", MetricName: "Throttles", Critical: true},
+	{Namespace: "AWS/States", MetricName: "ExecutionsFailed", Critical: true},
+	{Namespace: "AWS/SQS", MetricName: "ApproximateNumberOfMessagesVisible", Critical: true},
+	{Namespace: "ThreatDetectionIR", MetricName: "EvidenceWriteErrors", Critical: true},
+	{Namespace: "ThreatDetectionIR", MetricName: "UnresolvedResources", Critical: true},
+	{Namespace: "AWS/Lambda", MetricName: "Invocations"},
+}
+
+// StackAlarms returns the metric alarms whose names start with prefix
+func StackAlarms(sess *session.Session, prefix string) ([]*cloudwatch.MetricAlarm, error) {
+	var alarms []*cloudwatch.MetricAlarm
+	err := cloudwatch.New(sess).DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{
+		AlarmNamePrefix: aws.String(prefix),
+		AlarmTypes:      []*string{aws.String(cloudwatch.AlarmTypeMetricAlarm)},
+	}, func(page *cloudwatch.DescribeAlarmsOutput, _ bool) bool {
+		alarms = append(alarms, page.MetricAlarms...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe alarms with prefix %s: %w", prefix, err)
+	}
+	return alarms, nil
+}
+
+// alarmedMetrics returns the metrics an alarm watches, including those inside metric math
+func alarmedMetrics(alarm *cloudwatch.MetricAlarm) []string {
+	var metrics []string
+	if alarm.MetricName != nil {
+		metrics = append(metrics, aws.StringValue(alarm.Namespace)+" "+aws.StringValue(alarm.MetricName))
+	}
+	for _, query := range alarm.Metrics {
+		if query.MetricStat != nil && query.MetricStat.Metric != nil {
+			metric := query.MetricStat.Metric
+			metrics = append(metrics, aws.StringValue(metric.Namespace)+" "+aws.StringValue(metric.MetricName))
+		}
+	}
+	return metrics
+}
+
+// DashboardMetrics returns the metrics charted on the dashboard's metric widgets, keyed as
+// RequiredMetric.String
+func DashboardMetrics(sess *session.Session, dashboardName string) (map[string]bool, error) {
+	dashboard, err := cloudwatch.New(sess).GetDashboard(&cloudwatch.GetDashboardInput{
+		DashboardName: aws.String(dashboardName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dashboard %s: %w", dashboardName, err)
+	}
+
+	var body struct {
+		Widgets []struct {
+			Type       string `json:"type"`
+			Properties struct {
+				Metrics [][]interface{} `json:"metrics"`
+			} `json:"properties"`
+		} `json:"widgets"`
+	}
+	if err := json.Unmarshal([]byte(aws.StringValue(dashboard.DashboardBody)), &body); err != nil {
+		return nil, fmt.Errorf("unexpected body of dashboard %s: %w", dashboardName, err)
+	}
+
+	charted := map[string]bool{}
+	for _, widget := range body.Widgets {
+		if widget.Type != "metric" {
+			continue
+		}
+		// "." repeats the value in the same position of the previous row
+		var previous []interface{}
+		for _, row := range widget.Properties.Metrics {
+			resolved := make([]interface{}, len(row))
+			for i, value := range row {
+				if value == "." && i < len(previous) {
+					value = previous[i]
+				}
+				resolved[i] = value
+			}
+			previous = resolved
+
+			if len(resolved) < 2 {
+				continue
+			}
+			namespace, namespaceOK := resolved[0].(string)
+			metricName, metricOK := resolved[1].(string)
+			if namespaceOK && metricOK {
+				charted[namespace+" "+metricName] = true
+			}
+		}
+	}
+
+	return charted, nil
+}
+
+// AssertMetricCoverage checks that every required metric is charted on the dashboard and that every
+// critical one has an alarm among those named with alarmPrefix
+func AssertMetricCoverage(sess *session.Session, alarmPrefix, dashboardName string, required []RequiredMetric) error {
+	alarms, err := StackAlarms(sess, alarmPrefix)
+	if err != nil {
+		return err
+	}
+	alarmed := map[string][]string{}
+	for _, alarm := range alarms {
+		for _, metric := range alarmedMetrics(alarm) {
+			alarmed[metric] = append(alarmed[metric], aws.StringValue(alarm.AlarmName))
+		}
+	}
+
+	charted, err := DashboardMetrics(sess, dashboardName)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, metric := range required {
+		if metric.Critical && len(alarmed[metric.String()]) == 0 {
+			problems = append(problems, fmt.Sprintf("critical metric %s has no alarm", metric))
+		}
+		if !charted[metric.String()] {
+			problems = append(problems, fmt.Sprintf("%s is not on dashboard %s", metric, dashboardName))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("monitoring does not cover the pipeline:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// AssertAlarmActions checks that every alarm named with alarmPrefix has actions enabled and notifies
+// exactly the ops topic, and that the topic exists, so a stale ARN from an old deployment is caught
+func AssertAlarmActions(sess *session.Session, alarmPrefix, opsTopicARN string) error {
+	alarms, err := StackAlarms(sess, alarmPrefix)
+	if err != nil {
+		return err
+	}
+	if len(alarms) == 0 {
+		return fmt.Errorf("no alarms named with prefix %s", alarmPrefix)
+	}
+
+	if _, err := sns.New(sess).GetTopicAttributes(&sns.GetTopicAttributesInput{
+		TopicArn: aws.String(opsTopicARN),
+	}); err != nil {
+		return fmt.Errorf("ops topic %s is not reachable: %w", opsTopicARN, err)
+	}
+
+	var problems []string
+	for _, alarm := range alarms {
+		name := aws.StringValue(alarm.AlarmName)
+		if !aws.BoolValue(alarm.ActionsEnabled) {
+			problems = append(problems, fmt.Sprintf("%s has actions disabled", name))
+		}
+		actions := aws.StringValueSlice(alarm.AlarmActions)
+		if len(actions) != 1 || actions[0] != opsTopicARN {
+			problems = append(problems, fmt.Sprintf("%s notifies %v, expected only %s", name, actions, opsTopicARN))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("alarm actions are not wired to the ops topic:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// AssertConfirmedSubscription checks that the topic has at least one confirmed subscription, so
+// alarms reach someone
+func AssertConfirmedSubscription(sess *session.Session, topicARN string) error {
+	confirmed := false
+	err := sns.New(sess).ListSubscriptionsByTopicPages(&sns.ListSubscriptionsByTopicInput{
+		TopicArn: aws.String(topicARN),
+	}, func(page *sns.ListSubscriptionsByTopicOutput, _ bool) bool {
+		for _, subscription := range page.Subscriptions {
+			// Unconfirmed subscriptions are listed with a placeholder instead of an ARN
+			if strings.HasPrefix(aws.StringValue(subscription.SubscriptionArn), "arn:") {
+				confirmed = true
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list subscriptions of %s: %w", topicARN, err)
+	}
+
+	if !confirmed {
+		return fmt.Errorf("%s has no confirmed subscription", topicARN)
+	}
+	return nil
+}
+
+// TriggerAlarm forces an alarm into ALARM so its actions run. CloudWatch sets it back on the next
+// evaluation of its metric.
+func TriggerAlarm(sess *session.Session, alarmName string) error {
+	if _, err := cloudwatch.New(sess).SetAlarmState(&cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws.String(alarmName),
+		StateValue:  aws.String(cloudwatch.StateValueAlarm),
+		StateReason: aws.String("Alarm action wiring test"),
+	}); err != nil {
+		return fmt.Errorf("failed to set %s to ALARM: %w", alarmName, err)
+	}
+	return nil
+}
+
+// WaitForAlarmNotification receives from a queue subscribed to the ops topic until the alarm's
+// ALARM notification arrives
+func WaitForAlarmNotification(sess *session.Session, queueURL, alarmName string, timeout time.Duration) error {
+	sqsClient := sqs.New(sess)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		messages, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(10),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to receive from %s: %w", queueURL, err)
+		}
+
+		for _, message := range messages.Messages {
+			body := aws.StringValue(message.Body)
+			var envelope snsEnvelope
+			if json.Unmarshal([]byte(body), &envelope) == nil && envelope.Type == "Notification" {
+				body = envelope.Message
+			}
+
+			var notification struct {
+				AlarmName     string `json:"AlarmName"`
+				NewStateValue string `json:"NewStateValue"`
+			}
+			if json.Unmarshal([]byte(body), &notification) == nil &&
+				notification.AlarmName == alarmName && notification.NewStateValue == cloudwatch.StateValueAlarm {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no ALARM notification for %s within %s", alarmName, timeout)
+}
@@ -0,0 +1,108 @@
+package namespace
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Namespace derives every resource name of a test deployment from a single run prefix
+type Namespace struct {
+	Suite  string
+	RunID  string
+	Prefix string
+}
+
+var (
+	prefixPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+	claimedMu sync.Mutex
+	claimed   = map[string]string{}
+)
+
+// New returns the namespace for a suite run, e.g. suite "e2e" and run ID "AbC123" give prefix "ir-e2e-abc123"
+func New(suite, runID string) (Namespace, error) {
+	ns := Namespace{
+		Suite:  suite,
+		RunID:  runID,
+		Prefix: strings.ToLower(fmt.Sprintf("ir-%s-%s", suite, runID)),
+	}
+
+	if err := ns.Validate(); err != nil {
+		return Namespace{}, err
+	}
+
+	return ns, nil
+}
+
+// Claim registers the namespace for the owning test, failing if another suite in this process already holds it
+func (n Namespace) Claim(owner string) error {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+
+	if existing, ok := claimed[n.Prefix]; ok && existing != owner {
+		return fmt.Errorf("namespace %q is already claimed by %s", n.Prefix, existing)
+	}
+
+	claimed[n.Prefix] = owner
+	return nil
+}
+
+// Release frees the namespace for reuse
+func (n Namespace) Release() {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+
+	delete(claimed, n.Prefix)
+}
+
+// NamePrefix is the stack's name_prefix variable, prepended to fixed module resource names
+func (n Namespace) NamePrefix() string {
+	return n.Prefix + "-"
+}
+
+// EvidenceBucketName is the evidence bucket; the stack also creates "<name>-logs"
+func (n Namespace) EvidenceBucketName() string {
+	return n.Prefix + "-evidence"
+}
+
+// KMSAlias is the evidence key alias
+func (n Namespace) KMSAlias() string {
+	return "alias/" + n.Prefix + "-evidence"
+}
+
+// QuarantineSGName is the quarantine security group name
+func (n Namespace) QuarantineSGName() string {
+	return n.Prefix + "-quarantine"
+}
+
+// Name returns a stack resource name with the namespace prefix, matching the modules' "${var.name_prefix}<base>" convention
+func (n Namespace) Name(base string) string {
+	return n.NamePrefix() + base
+}
+
+// LambdaRoleName is the Lambda triage execution role
+func (n Namespace) LambdaRoleName() string { return n.Name("lambda-triage-role") }
+
+// StepFunctionsRoleName is the IR state machine execution role
+func (n Namespace) StepFunctionsRoleName() string { return n.Name("stepfn-ir-role") }
+
+// LambdaFunctionName is the triage function
+func (n Namespace) LambdaFunctionName() string { return n.Name("guardduty-triage") }
+
+// StateMachineName is the IR state machine
+func (n Namespace) StateMachineName() string { return n.Name("guardduty-ir") }
+
+// RuleName is the GuardDuty finding EventBridge rule
+func (n Namespace) RuleName() string { return n.Name("guardduty-finding-rule") }
+
+// TerraformVars returns the stack variables that carry the namespace
+func (n Namespace) TerraformVars() map[string]interface{} {
+	return map[string]interface{}{
+		"name_prefix":          n.NamePrefix(),
+		"evidence_bucket_name": n.EvidenceBucketName(),
+		"kms_alias":            n.KMSAlias(),
+		"quarantine_sg_name":   n.QuarantineSGName(),
+	}
+}
@@ -0,0 +1,148 @@
+package namespace
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// constraint is a per-service naming rule
+type constraint struct {
+	service string
+	minLen  int
+	maxLen  int
+	pattern *regexp.Regexp
+}
+
+var (
+	s3BucketConstraint      = constraint{"s3 bucket", 3, 63, regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)}
+	iamRoleConstraint       = constraint{"iam role", 1, 64, regexp.MustCompile(`^[\w+=,.@-]+$`)}
+	iamPolicyConstraint     = constraint{"iam policy", 1, 128, regexp.MustCompile(`^[\w+=,.@-]+$`)}
+	kmsAliasConstraint      = constraint{"kms alias", 7, 256, regexp.MustCompile(`^alias/[a-zA-Z0-9/_-]+$`)}
+	securityGroupConstraint = constraint{"security group", 1, 255, regexp.MustCompile(`^[a-zA-Z0-9 ._\-:/()#,@\[\]+=&;{}!$*]+$`)}
+	lambdaConstraint        = constraint{"lambda function", 1, 64, regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)}
+	stateMachineConstraint  = constraint{"state machine", 1, 80, regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)}
+	snsTopicConstraint      = constraint{"sns topic", 1, 256, regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)}
+	eventRuleConstraint     = constraint{"eventbridge rule", 1, 64, regexp.MustCompile(`^[.\-_A-Za-z0-9]+$`)}
+	sqsQueueConstraint      = constraint{"sqs queue", 1, 80, regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)}
+	logGroupConstraint      = constraint{"log group", 1, 512, regexp.MustCompile(`^[.\-_/#A-Za-z0-9]+$`)}
+	dashboardConstraint     = constraint{"cloudwatch dashboard", 1, 255, regexp.MustCompile(`^[A-Za-z0-9_-]+$`)}
+)
+
+func (c constraint) check(name string) error {
+	if len(name) < c.minLen || len(name) > c.maxLen {
+		return fmt.Errorf("%s name %q is %d characters, must be %d-%d", c.service, name, len(name), c.minLen, c.maxLen)
+	}
+
+	if !c.pattern.MatchString(name) {
+		return fmt.Errorf("%s name %q contains characters not allowed by the service", c.service, name)
+	}
+
+	return nil
+}
+
+// Validate checks every derived name against its service constraints, so bad prefixes fail before apply
+func (n Namespace) Validate() error {
+	if !prefixPattern.MatchString(n.Prefix) {
+		return fmt.Errorf("namespace prefix %q must be lowercase alphanumeric with hyphens", n.Prefix)
+	}
+
+	checks := []struct {
+		constraint constraint
+		name       string
+	}{
+		{s3BucketConstraint, n.EvidenceBucketName()},
+		{s3BucketConstraint, n.EvidenceBucketName() + "-logs"},
+		{kmsAliasConstraint, n.KMSAlias()},
+		{securityGroupConstraint, n.QuarantineSGName()},
+		{iamRoleConstraint, n.LambdaRoleName()},
+		{iamRoleConstraint, n.StepFunctionsRoleName()},
+		{iamRoleConstraint, n.Name("eventbridge-stepfn-role")},
+		{iamRoleConstraint, n.Name("ir-evidence-replication-role")},
+		{iamPolicyConstraint, n.Name("lambda-triage-policy")},
+		{iamPolicyConstraint, n.Name("stepfn-ir-policy")},
+		{iamPolicyConstraint, n.Name("eventbridge-stepfn-policy")},
+		{lambdaConstraint, n.LambdaFunctionName()},
+		{stateMachineConstraint, n.StateMachineName()},
+		{snsTopicConstraint, n.Name("ir-alerts-topic")},
+		{eventRuleConstraint, n.RuleName()},
+		{sqsQueueConstraint, n.Name("guardduty-finding-dlq")},
+		{logGroupConstraint, "/aws/lambda/" + n.LambdaFunctionName()},
+		{logGroupConstraint, "/aws/states/" + n.Name("stepfn-ir")},
+		{dashboardConstraint, n.Name("ir-operations")},
+	}
+
+	var problems []string
+	for _, check := range checks {
+		if err := check.constraint.check(check.name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if strings.HasPrefix(n.QuarantineSGName(), "sg-") {
+		problems = append(problems, fmt.Sprintf("security group name %q must not start with sg-", n.QuarantineSGName()))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("namespace %q produces invalid resource names:\n  %s", n.Prefix, strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// CheckCollisions returns an error listing any namespaced resource that already exists in the account
+func (n Namespace) CheckCollisions(sess *session.Session) error {
+	var collisions []string
+
+	s3Client := s3.New(sess)
+	for _, bucket := range []string{n.EvidenceBucketName(), n.EvidenceBucketName() + "-logs"} {
+		_, err := s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if !isNotFound(err) {
+			collisions = append(collisions, "s3 bucket "+bucket)
+		}
+	}
+
+	iamClient := iam.New(sess)
+	for _, role := range []string{n.LambdaRoleName(), n.StepFunctionsRoleName(), n.Name("eventbridge-stepfn-role")} {
+		_, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(role)})
+		if !isNotFound(err) {
+			collisions = append(collisions, "iam role "+role)
+		}
+	}
+
+	kmsClient := kms.New(sess)
+	_, err := kmsClient.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(n.KMSAlias())})
+	if !isNotFound(err) {
+		collisions = append(collisions, "kms alias "+n.KMSAlias())
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("namespace %q collides with existing resources: %s", n.Prefix, strings.Join(collisions, ", "))
+	}
+
+	return nil
+}
+
+// isNotFound treats any service "not found" error as absence; other errors (including 403 on a
+// bucket owned by another account) count as a collision
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "NotFound", s3.ErrCodeNoSuchBucket, iam.ErrCodeNoSuchEntityException, kms.ErrCodeNotFoundException:
+			return true
+		}
+	}
+
+	return false
+}
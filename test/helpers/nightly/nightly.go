@@ -0,0 +1,213 @@
+// Package nightly runs the suite against one long-lived deployment as named stages (deploy,
+// validate, scenarios, chaos, destroy). Progress and the stack's outputs are checkpointed to disk,
+// so a failed stage can be re-run against the existing deployment without re-applying Terraform.
+package nightly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stage is one step of the nightly run
+type Stage string
+
+// Stages in the order they run
+const (
+	Deploy    Stage = "deploy"
+	Validate  Stage = "validate"
+	Scenarios Stage = "scenarios"
+	Chaos     Stage = "chaos"
+	Destroy   Stage = "destroy"
+)
+
+// AllStages lists every stage in run order
+var AllStages = []Stage{Deploy, Validate, Scenarios, Chaos, Destroy}
+
+// StagesEnv selects stages when no -stages flag is given
+const StagesEnv = "IR_STAGES"
+
+// ParseStages parses a comma-separated stage list, or "all", into run order
+func ParseStages(spec string) ([]Stage, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "all" {
+		return AllStages, nil
+	}
+
+	selected := map[Stage]bool{}
+	for _, name := range strings.Split(spec, ",") {
+		stage := Stage(strings.TrimSpace(name))
+		known := false
+		for _, s := range AllStages {
+			known = known || s == stage
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown stage %q, expected one of %v or all", name, AllStages)
+		}
+		selected[stage] = true
+	}
+
+	var stages []Stage
+	for _, stage := range AllStages {
+		if selected[stage] {
+			stages = append(stages, stage)
+		}
+	}
+	return stages, nil
+}
+
+// StageRecord is the last outcome of a stage
+type StageRecord struct {
+	Passed   bool      `json:"passed"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Checkpoint is the state of a nightly run kept between invocations
+type Checkpoint struct {
+	RunID string `json:"run_id"`
+	// Outputs are the Terraform outputs of the deployment, as their JSON values
+	Outputs map[string]json.RawMessage `json:"outputs,omitempty"`
+	Stages  map[Stage]StageRecord      `json:"stages"`
+	// Scenarios records the scenario runs that passed, so a re-run only repeats the failed ones
+	Scenarios map[string]bool `json:"scenarios,omitempty"`
+}
+
+// LoadCheckpoint reads the checkpoint at path, starting a new one for runID when there is none
+func LoadCheckpoint(path, runID string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Checkpoint{RunID: runID, Stages: map[Stage]StageRecord{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Stages == nil {
+		checkpoint.Stages = map[Stage]StageRecord{}
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint to path, replacing it atomically so an interrupted run cannot leave
+// it half written
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// Deployed reports whether the checkpoint holds a deployment that has not been destroyed
+func (c *Checkpoint) Deployed() bool {
+	return c.Stages[Deploy].Passed && !c.Stages[Destroy].Passed
+}
+
+// Output returns a string output of the deployment
+func (c *Checkpoint) Output(name string) (string, error) {
+	raw, ok := c.Outputs[name]
+	if !ok {
+		return "", fmt.Errorf("checkpoint has no output %s", name)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("output %s is not a string: %w", name, err)
+	}
+	return value, nil
+}
+
+// OutputList returns a list output of the deployment
+func (c *Checkpoint) OutputList(name string) ([]string, error) {
+	raw, ok := c.Outputs[name]
+	if !ok {
+		return nil, fmt.Errorf("checkpoint has no output %s", name)
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("output %s is not a list of strings: %w", name, err)
+	}
+	return values, nil
+}
+
+// StageFunc runs one stage against the deployment in the checkpoint
+type StageFunc func(checkpoint *Checkpoint) error
+
+// Runner runs the selected stages and checkpoints after each one
+type Runner struct {
+	Checkpoint *Checkpoint
+	// Path is where the checkpoint is saved
+	Path   string
+	Stages map[Stage]StageFunc
+	// Redeploy applies Terraform even when the checkpoint already holds a deployment
+	Redeploy bool
+	Log      io.Writer
+}
+
+// Run runs the stages in order and stops at the first failure, leaving the deployment up so the
+// failed stage can be re-run. A passed destroy removes the checkpoint.
+func (r *Runner) Run(stages []Stage) error {
+	for _, stage := range stages {
+		if stage == Deploy && r.Checkpoint.Deployed() && !r.Redeploy {
+			fmt.Fprintf(r.Log, "==> %s: reusing the deployment of run %s\n", stage, r.Checkpoint.RunID)
+			continue
+		}
+		if stage != Deploy && !r.Checkpoint.Deployed() {
+			return fmt.Errorf("stage %s needs a deployment, but checkpoint %s has none; run the deploy stage first", stage, r.Path)
+		}
+
+		run, ok := r.Stages[stage]
+		if !ok {
+			return fmt.Errorf("stage %s is not implemented", stage)
+		}
+
+		fmt.Fprintf(r.Log, "==> %s\n", stage)
+		started := time.Now()
+		err := run(r.Checkpoint)
+
+		record := StageRecord{Passed: err == nil, Finished: time.Now()}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if stage == Deploy && err == nil {
+			// A fresh deployment invalidates everything checked against the previous one
+			r.Checkpoint.Stages = map[Stage]StageRecord{}
+			r.Checkpoint.Scenarios = nil
+		}
+		r.Checkpoint.Stages[stage] = record
+
+		if stage == Destroy && err == nil {
+			if removeErr := os.Remove(r.Path); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove checkpoint %s: %w", r.Path, removeErr)
+			}
+		} else if saveErr := r.Checkpoint.Save(r.Path); saveErr != nil {
+			return saveErr
+		}
+
+		if err != nil {
+			return fmt.Errorf("stage %s failed after %s: %w", stage, time.Since(started).Round(time.Second), err)
+		}
+		fmt.Fprintf(r.Log, "==> %s passed in %s\n", stage, time.Since(started).Round(time.Second))
+	}
+	return nil
+}
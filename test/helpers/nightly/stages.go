@@ -0,0 +1,231 @@
+package nightly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/canary"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/kpi"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/scenario"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// DeployStage applies the stack and checkpoints its outputs
+func DeployStage(tf Terraform) StageFunc {
+	return func(checkpoint *Checkpoint) error {
+		outputs, err := tf.Apply()
+		if err != nil {
+			return err
+		}
+		checkpoint.Outputs = outputs
+		return nil
+	}
+}
+
+// DestroyStage destroys the stack and checks that nothing was left behind. retainLogGroups must
+// match the stack's retain_log_groups variable.
+func DestroyStage(tf Terraform, sess *session.Session, retainLogGroups bool) StageFunc {
+	return func(checkpoint *Checkpoint) error {
+		outputs := map[string]interface{}{}
+		for name, raw := range checkpoint.Outputs {
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("failed to decode output %s: %w", name, err)
+			}
+			outputs[name] = value
+		}
+
+		// Residue is reported even when destroy fails, since that is when there is most of it
+		destroyErr := tf.Destroy()
+		residueErr := helpers.AssertTeardownComplete(sess, helpers.TeardownTargetsFromOutputs(outputs, retainLogGroups))
+		if destroyErr != nil && residueErr != nil {
+			return fmt.Errorf("%v\n%v", destroyErr, residueErr)
+		}
+		if destroyErr != nil {
+			return destroyErr
+		}
+		return residueErr
+	}
+}
+
+// ValidateStage checks the deployed configuration of the triage function and the stack's monitoring
+func ValidateStage(sess *session.Session) StageFunc {
+	return func(checkpoint *Checkpoint) error {
+		functionName, err := checkpoint.Output("lambda_triage_function_name")
+		if err != nil {
+			return err
+		}
+		dashboardName, err := checkpoint.Output("cloudwatch_dashboard_name")
+		if err != nil {
+			return err
+		}
+		opsTopicARN, err := checkpoint.Output("sns_ops_topic_arn")
+		if err != nil {
+			return err
+		}
+		// Alarms and the dashboard share the "<prefix>ir-" naming
+		alarmPrefix := strings.TrimSuffix(dashboardName, "operations")
+
+		var problems []string
+		for _, check := range []error{
+			helpers.AssertSupportedRuntime(sess, functionName),
+			helpers.AssertEnvironmentContract(sess, functionName, helpers.TriageEnvContract),
+			helpers.AssertMetricCoverage(sess, alarmPrefix, dashboardName, helpers.RequiredStackMetrics),
+			helpers.AssertAlarmActions(sess, alarmPrefix, opsTopicARN),
+		} {
+			if check != nil {
+				problems = append(problems, check.Error())
+			}
+		}
+
+		if len(problems) > 0 {
+			return fmt.Errorf("deployment failed validation:\n  %s", strings.Join(problems, "\n  "))
+		}
+		return nil
+	}
+}
+
+// ScenariosStage runs every scenario in dir through each of its sources. Runs that passed are
+// recorded in the checkpoint and skipped on a re-run, and their KPIs are recorded in kpis.
+func ScenariosStage(sess *session.Session, dir string, kpis kpi.Store, log io.Writer) StageFunc {
+	return func(checkpoint *Checkpoint) error {
+		scenarios, err := scenario.LoadDir(dir)
+		if err != nil {
+			return err
+		}
+		if len(scenarios) == 0 {
+			return fmt.Errorf("no scenarios found in %s", dir)
+		}
+
+		target, err := scenarioTarget(sess, checkpoint)
+		if err != nil {
+			return err
+		}
+		// Scenarios expecting isolation name victims
+		target.Victims = victims.New(sess, checkpoint.RunID)
+		defer func() {
+			if err := target.Victims.Cleanup(); err != nil {
+				fmt.Fprintf(log, "    victim cleanup: %v\n", err)
+			}
+		}()
+		if checkpoint.Scenarios == nil {
+			checkpoint.Scenarios = map[string]bool{}
+		}
+
+		var failed []string
+		for _, sc := range scenarios {
+			for i, sourceName := range sc.Sources {
+				key := sc.Name + "/" + sourceName
+				if checkpoint.Scenarios[key] {
+					fmt.Fprintf(log, "    %s: passed in an earlier attempt\n", key)
+					continue
+				}
+
+				if err := runScenario(target, sc, sourceName, fmt.Sprintf("%s-%d", checkpoint.RunID, i), kpis, log); err != nil {
+					failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+					continue
+				}
+				checkpoint.Scenarios[key] = true
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("%d scenario runs failed:\n  %s", len(failed), strings.Join(failed, "\n  "))
+		}
+		return nil
+	}
+}
+
+func runScenario(target scenario.Target, sc *scenario.Scenario, sourceName, runID string, kpis kpi.Store, log io.Writer) error {
+	source, err := helpers.NewFindingSource(target.Session, sourceName)
+	if err != nil {
+		return err
+	}
+	// Detonated Stratus techniques stay up for containment until the scenario is done
+	if stratus, ok := source.(*helpers.StratusSource); ok {
+		defer func() {
+			if err := stratus.Cleanup(); err != nil {
+				fmt.Fprintf(log, "    stratus cleanup: %v\n", err)
+			}
+		}()
+	}
+
+	result, err := scenario.Run(target, sc, source, runID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(log, result.String())
+	if !result.Passed() {
+		return fmt.Errorf("%s", strings.Join(result.Failures, "; "))
+	}
+	// Losing a KPI sample must not fail a run that passed
+	if err := kpi.Record(kpis, target, result, sourceName, runID); err != nil {
+		fmt.Fprintf(log, "    kpi: %v\n", err)
+	}
+	return nil
+}
+
+// ChaosStage throttles the triage function for the outage, injects a canary finding while it is
+// down and checks that the pipeline still triages the finding within the SLO once it recovers
+func ChaosStage(sess *session.Session, outage, slo time.Duration) StageFunc {
+	return func(checkpoint *Checkpoint) error {
+		functionName, err := checkpoint.Output("lambda_triage_function_name")
+		if err != nil {
+			return err
+		}
+		target, err := scenarioTarget(sess, checkpoint)
+		if err != nil {
+			return err
+		}
+
+		restore, err := helpers.ThrottleFunction(sess, functionName)
+		if err != nil {
+			return err
+		}
+
+		finding := canary.Finding("chaos-"+checkpoint.RunID, 7.0)
+		_, injectErr := helpers.NewEventBridgeSource(sess).Inject([]helpers.GuardDutyFinding{finding})
+		if injectErr == nil {
+			time.Sleep(outage)
+		}
+		if err := restore(); err != nil {
+			return err
+		}
+		if injectErr != nil {
+			return fmt.Errorf("failed to inject finding during the outage: %w", injectErr)
+		}
+
+		// Lambda keeps retrying throttled asynchronous invocations, so nothing should be lost
+		if _, err := helpers.WaitForEvidenceMetadata(sess, target.EvidenceBucket, finding.ID, slo); err != nil {
+			return fmt.Errorf("finding injected during a %s triage outage was not recovered: %w", outage, err)
+		}
+		return nil
+	}
+}
+
+func scenarioTarget(sess *session.Session, checkpoint *Checkpoint) (scenario.Target, error) {
+	stateMachineARN, err := checkpoint.Output("stepfn_ir_state_machine_arn")
+	if err != nil {
+		return scenario.Target{}, err
+	}
+	evidenceBucket, err := checkpoint.Output("s3_evidence_bucket_name")
+	if err != nil {
+		return scenario.Target{}, err
+	}
+	stateMachineRole, err := checkpoint.Output("iam_stepfn_role_name")
+	if err != nil {
+		return scenario.Target{}, err
+	}
+	return scenario.Target{
+		Session:          sess,
+		StateMachineArn:  stateMachineARN,
+		EvidenceBucket:   evidenceBucket,
+		StateMachineRole: stateMachineRole,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package nightly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Terraform runs the root module the nightly stack is deployed from
+type Terraform struct {
+	Dir string
+	// VarFile is passed to apply and destroy when set
+	VarFile string
+}
+
+// Apply initialises and applies the root module and returns its outputs
+func (tf Terraform) Apply() (map[string]json.RawMessage, error) {
+	if _, err := tf.run("init", "-input=false", "-no-color"); err != nil {
+		return nil, err
+	}
+	if _, err := tf.run(tf.withVarFile("apply", "-auto-approve", "-input=false", "-no-color")...); err != nil {
+		return nil, err
+	}
+	return tf.Outputs()
+}
+
+// Outputs returns the outputs of the applied root module as their JSON values
+func (tf Terraform) Outputs() (map[string]json.RawMessage, error) {
+	stdout, err := tf.run("output", "-json", "-no-color")
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(stdout, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse terraform outputs: %w", err)
+	}
+
+	values := make(map[string]json.RawMessage, len(outputs))
+	for name, output := range outputs {
+		values[name] = output.Value
+	}
+	return values, nil
+}
+
+// Destroy destroys the deployment
+func (tf Terraform) Destroy() error {
+	_, err := tf.run(tf.withVarFile("destroy", "-auto-approve", "-input=false", "-no-color")...)
+	return err
+}
+
+func (tf Terraform) withVarFile(args ...string) []string {
+	if tf.VarFile != "" {
+		args = append(args, "-var-file="+tf.VarFile)
+	}
+	return args
+}
+
+// run streams Terraform's progress to stderr, since applies take long enough that silence looks hung
+func (tf Terraform) run(args ...string) ([]byte, error) {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = tf.Dir
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if args[0] != "output" {
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("terraform %s failed: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
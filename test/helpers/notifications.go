@@ -0,0 +1,419 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// Notification is a triage notification as published to SNS
+type Notification struct {
+	FindingID    string  `json:"finding_id"`
+	Severity     float64 `json:"severity"`
+	ResourceType string  `json:"resource_type"`
+	Action       string  `json:"action"`
+	// Resource is the finding's resource block, with PII redacted when the stack scrubs it
+	Resource map[string]interface{} `json:"resource,omitempty"`
+	// Kubernetes is the cluster, namespace, workload and node of EKS findings
+	Kubernetes map[string]string `json:"kubernetes,omitempty"`
+	// Enrichment is set for findings with remote IPs
+	Enrichment *Enrichment `json:"enrichment,omitempty"`
+	// AccountID is set on notices about findings from sandbox accounts
+	AccountID string `json:"account_id,omitempty"`
+	// Recurrence is set when the finding was escalated as the recurrence of an earlier one
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	// Failures are set on the notice the IR workflow publishes when containment partially failed
+	Failures []ContainmentResult `json:"failures,omitempty"`
+	// Attributes are the SNS message attributes
+	Attributes map[string]string `json:"-"`
+	// DeliveredAt is when SNS delivered the notification to the test queue
+	DeliveredAt time.Time `json:"-"`
+}
+
+// NotificationAttributes are the message attributes every triage notification must carry, for
+// subscription filter policies to match on
+var NotificationAttributes = []string{"severity", "resource_type", "account_id"}
+
+// ValidateNotificationAttributes checks that a notification carries every attribute in
+// NotificationAttributes and that they agree with the message
+func ValidateNotificationAttributes(notification Notification, accountID string) error {
+	for _, name := range NotificationAttributes {
+		if notification.Attributes[name] == "" {
+			return fmt.Errorf("notification for %s has no %s attribute", notification.FindingID, name)
+		}
+	}
+
+	// Recurrences are routed as CRITICAL whatever their own severity
+	label := severity.FromGuardDuty(notification.Severity).Label()
+	if notification.Recurrence != nil {
+		label = severity.Critical
+	}
+	if notification.Attributes["severity"] != label.String() {
+		return fmt.Errorf("notification for %s has severity attribute %s, expected %s for %.1f",
+			notification.FindingID, notification.Attributes["severity"], label, notification.Severity)
+	}
+	if notification.ResourceType != "" && notification.Attributes["resource_type"] != notification.ResourceType {
+		return fmt.Errorf("notification for %s has resource_type attribute %s, expected %s",
+			notification.FindingID, notification.Attributes["resource_type"], notification.ResourceType)
+	}
+	if notification.Attributes["account_id"] != accountID {
+		return fmt.Errorf("notification for %s has account_id attribute %s, expected %s",
+			notification.FindingID, notification.Attributes["account_id"], accountID)
+	}
+
+	return nil
+}
+
+// snsEnvelope is the JSON SNS wraps messages in for subscriptions without raw message delivery
+type snsEnvelope struct {
+	Type              string `json:"Type"`
+	Message           string `json:"Message"`
+	MessageAttributes map[string]struct {
+		Value string `json:"Value"`
+	} `json:"MessageAttributes"`
+}
+
+// TestSubscription is an SQS queue subscribed to a topic with raw message delivery, so the queue
+// sees the published message and its attributes unchanged
+type TestSubscription struct {
+	QueueURL        string
+	QueueARN        string
+	SubscriptionARN string
+}
+
+// SubscribeTestQueue creates a queue and subscribes it to the topic. filterPolicy is an optional
+// SNS filter policy document.
+func SubscribeTestQueue(sess *session.Session, topicARN, queueName, filterPolicy string) (*TestSubscription, error) {
+	subscription, err := CreateTestQueue(sess, topicARN, queueName)
+	if err != nil {
+		return subscription, err
+	}
+
+	subscribeAttributes := map[string]*string{"RawMessageDelivery": aws.String("true")}
+	if filterPolicy != "" {
+		subscribeAttributes["FilterPolicy"] = aws.String(filterPolicy)
+	}
+	subscribed, err := sns.New(sess).Subscribe(&sns.SubscribeInput{
+		TopicArn:              aws.String(topicARN),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(subscription.QueueARN),
+		Attributes:            subscribeAttributes,
+		ReturnSubscriptionArn: aws.Bool(true),
+	})
+	if err != nil {
+		return subscription, fmt.Errorf("failed to subscribe %s to %s: %w", queueName, topicARN, err)
+	}
+	subscription.SubscriptionARN = aws.StringValue(subscribed.SubscriptionArn)
+
+	return subscription, nil
+}
+
+// CreateTestQueue creates a queue the topic may deliver to, for a subscription made elsewhere, e.g.
+// by Terraform through sns_subscriptions
+func CreateTestQueue(sess *session.Session, topicARN, queueName string) (*TestSubscription, error) {
+	sqsClient := sqs.New(sess)
+
+	queue, err := sqsClient.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String(queueName),
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNameSqsManagedSseEnabled: aws.String("true"),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue %s: %w", queueName, err)
+	}
+	subscription := &TestSubscription{QueueURL: aws.StringValue(queue.QueueUrl)}
+
+	attributes, err := sqsClient.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+	})
+	if err != nil {
+		return subscription, fmt.Errorf("failed to get attributes of %s: %w", queueName, err)
+	}
+	subscription.QueueARN = aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameQueueArn])
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+				"Action":    "sqs:SendMessage",
+				"Resource":  subscription.QueueARN,
+				"Condition": map[string]interface{}{
+					"ArnEquals": map[string]string{"aws:SourceArn": topicARN},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return subscription, err
+	}
+	if _, err := sqsClient.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl:   queue.QueueUrl,
+		Attributes: map[string]*string{sqs.QueueAttributeNamePolicy: aws.String(string(policy))},
+	}); err != nil {
+		return subscription, fmt.Errorf("failed to set policy of %s: %w", queueName, err)
+	}
+
+	return subscription, nil
+}
+
+// Delete removes the subscription and its queue
+func (s *TestSubscription) Delete(sess *session.Session) error {
+	if s.SubscriptionARN != "" {
+		if _, err := sns.New(sess).Unsubscribe(&sns.UnsubscribeInput{
+			SubscriptionArn: aws.String(s.SubscriptionARN),
+		}); err != nil {
+			return fmt.Errorf("failed to unsubscribe %s: %w", s.SubscriptionARN, err)
+		}
+	}
+
+	if _, err := sqs.New(sess).DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(s.QueueURL)}); err != nil {
+		return fmt.Errorf("failed to delete queue %s: %w", s.QueueURL, err)
+	}
+	return nil
+}
+
+// WaitForNotifications receives from the queue until notifications for all the findings have
+// arrived, then keeps receiving for settle so notifications that should not arrive get the chance
+// to. It returns everything received, keyed by finding ID, and an error if a finding is missing.
+func WaitForNotifications(sess *session.Session, queueURL string, findingIDs []string, timeout, settle time.Duration) (map[string]Notification, error) {
+	received := map[string]Notification{}
+	missing := func() []string {
+		var ids []string
+		for _, id := range findingIDs {
+			if _, ok := received[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for len(missing()) > 0 && clock.Default.Now().Before(deadline) {
+		if err := receiveNotifications(sess, queueURL, received); err != nil {
+			return received, err
+		}
+	}
+	if ids := missing(); len(ids) > 0 {
+		return received, fmt.Errorf("no notification for %v within %s", ids, timeout)
+	}
+
+	for settled := clock.Default.Now().Add(settle); clock.Default.Now().Before(settled); {
+		if err := receiveNotifications(sess, queueURL, received); err != nil {
+			return received, err
+		}
+	}
+
+	return received, nil
+}
+
+func receiveNotifications(sess *session.Session, queueURL string, received map[string]Notification) error {
+	notifications, err := receiveNotificationBatch(sess, queueURL)
+	for _, notification := range notifications {
+		received[notification.FindingID] = notification
+	}
+	return err
+}
+
+// WaitForFailureNotification waits for the notice the IR workflow publishes when it could not
+// contain every resource of the finding. Other notifications about the finding are consumed.
+func WaitForFailureNotification(sess *session.Session, queueURL, findingID string, timeout time.Duration) (Notification, error) {
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		notifications, err := receiveNotificationBatch(sess, queueURL)
+		if err != nil {
+			return Notification{}, err
+		}
+		for _, notification := range notifications {
+			if notification.FindingID == findingID && len(notification.Failures) > 0 {
+				return notification, nil
+			}
+		}
+	}
+	return Notification{}, fmt.Errorf("no containment failure notification for %s within %s", findingID, timeout)
+}
+
+// receiveNotificationBatch receives and deletes up to ten notifications
+func receiveNotificationBatch(sess *session.Session, queueURL string) ([]Notification, error) {
+	sqsClient := sqs.New(sess)
+
+	messages, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(queueURL),
+		MaxNumberOfMessages:   aws.Int64(10),
+		WaitTimeSeconds:       aws.Int64(10),
+		MessageAttributeNames: []*string{aws.String("All")},
+		AttributeNames:        []*string{aws.String(sqs.MessageSystemAttributeNameSentTimestamp)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from %s: %w", queueURL, err)
+	}
+
+	var notifications []Notification
+	for _, message := range messages.Messages {
+		body := aws.StringValue(message.Body)
+		attributes := map[string]string{}
+		for name, value := range message.MessageAttributes {
+			attributes[name] = aws.StringValue(value.StringValue)
+		}
+
+		// Without raw message delivery the message and its attributes arrive in an SNS envelope
+		var envelope snsEnvelope
+		if json.Unmarshal([]byte(body), &envelope) == nil && envelope.Type == "Notification" {
+			body = envelope.Message
+			for name, value := range envelope.MessageAttributes {
+				attributes[name] = value.Value
+			}
+		}
+
+		var notification Notification
+		if err := json.Unmarshal([]byte(body), &notification); err != nil {
+			return notifications, fmt.Errorf("unexpected notification body: %w", err)
+		}
+		notification.Attributes = attributes
+		if sent, err := strconv.ParseInt(aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64); err == nil {
+			notification.DeliveredAt = time.UnixMilli(sent).UTC()
+		}
+		notifications = append(notifications, notification)
+
+		if _, err := sqsClient.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		}); err != nil {
+			return notifications, fmt.Errorf("failed to delete message from %s: %w", queueURL, err)
+		}
+	}
+
+	return notifications, nil
+}
+
+// SubscriptionFilterPolicy returns the filter policy of the topic's subscription to endpoint, or ""
+// when the subscription has none
+func SubscriptionFilterPolicy(sess *session.Session, topicARN, endpoint string) (string, error) {
+	snsClient := sns.New(sess)
+
+	var subscriptionARN string
+	err := snsClient.ListSubscriptionsByTopicPages(&sns.ListSubscriptionsByTopicInput{
+		TopicArn: aws.String(topicARN),
+	}, func(page *sns.ListSubscriptionsByTopicOutput, _ bool) bool {
+		for _, subscription := range page.Subscriptions {
+			if aws.StringValue(subscription.Endpoint) == endpoint {
+				subscriptionARN = aws.StringValue(subscription.SubscriptionArn)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list subscriptions of %s: %w", topicARN, err)
+	}
+	if subscriptionARN == "" {
+		return "", fmt.Errorf("%s has no subscription for %s", topicARN, endpoint)
+	}
+
+	attributes, err := snsClient.GetSubscriptionAttributes(&sns.GetSubscriptionAttributesInput{
+		SubscriptionArn: aws.String(subscriptionARN),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get attributes of %s: %w", subscriptionARN, err)
+	}
+
+	return aws.StringValue(attributes.Attributes["FilterPolicy"]), nil
+}
+
+// AttributePermutations returns every combination of the attribute values, in a stable order so
+// probe results can be matched back to their permutation
+func AttributePermutations(values map[string][]string) []map[string]string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	permutations := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, permutation := range permutations {
+			for _, value := range values[name] {
+				extended := make(map[string]string, len(permutation)+1)
+				for k, v := range permutation {
+					extended[k] = v
+				}
+				extended[name] = value
+				next = append(next, extended)
+			}
+		}
+		permutations = next
+	}
+
+	return permutations
+}
+
+// ProbeFilterPolicy reports, per permutation, whether a message with those attributes gets through
+// the filter policy. The pipeline topics only accept publishes from the pipeline roles, so the
+// probe runs against a throwaway topic named after name.
+func ProbeFilterPolicy(sess *session.Session, name, filterPolicy string, permutations []map[string]string) ([]bool, error) {
+	snsClient := sns.New(sess)
+
+	topic, err := snsClient.CreateTopic(&sns.CreateTopicInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe topic %s: %w", name, err)
+	}
+	defer snsClient.DeleteTopic(&sns.DeleteTopicInput{TopicArn: topic.TopicArn})
+
+	subscription, err := SubscribeTestQueue(sess, aws.StringValue(topic.TopicArn), name, filterPolicy)
+	if subscription != nil {
+		defer subscription.Delete(sess)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter policies take up to a minute to apply to a new subscription
+	clock.Default.Sleep(time.Minute)
+
+	for i, permutation := range permutations {
+		message, err := json.Marshal(Notification{FindingID: fmt.Sprintf("probe-%d", i), Action: "probe"})
+		if err != nil {
+			return nil, err
+		}
+		attributes := make(map[string]*sns.MessageAttributeValue, len(permutation))
+		for attribute, value := range permutation {
+			attributes[attribute] = &sns.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+		if _, err := snsClient.Publish(&sns.PublishInput{
+			TopicArn:          topic.TopicArn,
+			Message:           aws.String(string(message)),
+			MessageAttributes: attributes,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to publish probe %d: %w", i, err)
+		}
+	}
+
+	// Nothing is required to arrive, so every probe gets the whole settle period
+	received, err := WaitForNotifications(sess, subscription.QueueURL, nil, 0, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	delivered := make([]bool, len(permutations))
+	for i := range permutations {
+		_, delivered[i] = received[fmt.Sprintf("probe-%d", i)]
+	}
+	return delivered, nil
+}
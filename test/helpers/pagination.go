@@ -0,0 +1,175 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// DefaultMaxPages bounds pagination when no explicit cap is given, so a runaway listing cannot hang a test
+const DefaultMaxPages = 100
+
+// PageOptions caps a paginated listing. Zero values mean DefaultMaxPages and no item limit.
+type PageOptions struct {
+	MaxPages int
+	MaxItems int
+}
+
+// PageFetcher fetches the page for a continuation token (nil for the first page) and returns the next token
+type PageFetcher[P any] func(token *string) (page P, next *string, err error)
+
+// ForEachPage calls fn for every page until the token runs out, fn returns false, or MaxPages is reached
+func ForEachPage[P any](fetch PageFetcher[P], opts PageOptions, fn func(page P) bool) error {
+	maxPages := opts.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	var token *string
+	for pages := 0; pages < maxPages; pages++ {
+		page, next, err := fetch(token)
+		if err != nil {
+			return err
+		}
+
+		if !fn(page) || aws.StringValue(next) == "" {
+			return nil
+		}
+		token = next
+	}
+
+	return nil
+}
+
+// CollectPages gathers the items of every page that pass the filter (nil keeps all), stopping at MaxItems
+func CollectPages[P, T any](fetch PageFetcher[P], opts PageOptions, items func(page P) []T, filter func(item T) bool) ([]T, error) {
+	var collected []T
+
+	err := ForEachPage(fetch, opts, func(page P) bool {
+		for _, item := range items(page) {
+			if filter != nil && !filter(item) {
+				continue
+			}
+			collected = append(collected, item)
+			if opts.MaxItems > 0 && len(collected) >= opts.MaxItems {
+				return false
+			}
+		}
+		return true
+	})
+
+	return collected, err
+}
+
+// ListExecutions returns executions of a state machine, newest first, optionally filtered by status
+func ListExecutions(sess *session.Session, stateMachineArn, statusFilter string, opts PageOptions) ([]*sfn.ExecutionListItem, error) {
+	sfnClient := sfn.New(sess)
+
+	input := &sfn.ListExecutionsInput{StateMachineArn: aws.String(stateMachineArn)}
+	if statusFilter != "" {
+		input.StatusFilter = aws.String(statusFilter)
+	}
+
+	executions, err := CollectPages(func(token *string) (*sfn.ListExecutionsOutput, *string, error) {
+		input.NextToken = token
+		page, err := sfnClient.ListExecutions(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, page.NextToken, nil
+	}, opts, func(page *sfn.ListExecutionsOutput) []*sfn.ExecutionListItem {
+		return page.Executions
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list executions of %s: %w", stateMachineArn, err)
+	}
+
+	return executions, nil
+}
+
+// ListObjects returns the objects under a prefix that pass the filter (nil keeps all)
+func ListObjects(sess *session.Session, bucketName, prefix string, opts PageOptions, filter func(obj *s3.Object) bool) ([]*s3.Object, error) {
+	s3Client := s3.New(sess)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	objects, err := CollectPages(func(token *string) (*s3.ListObjectsV2Output, *string, error) {
+		input.ContinuationToken = token
+		page, err := s3Client.ListObjectsV2(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, page.NextContinuationToken, nil
+	}, opts, func(page *s3.ListObjectsV2Output) []*s3.Object {
+		return page.Contents
+	}, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects in s3://%s/%s: %w", bucketName, prefix, err)
+	}
+
+	return objects, nil
+}
+
+// ListLogStreams returns the streams of a log group, most recently written first
+func ListLogStreams(sess *session.Session, logGroupName string, opts PageOptions) ([]*cloudwatchlogs.LogStream, error) {
+	logsClient := cloudwatchlogs.New(sess)
+
+	input := &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName: aws.String(logGroupName),
+		OrderBy:      aws.String(cloudwatchlogs.OrderByLastEventTime),
+		Descending:   aws.Bool(true),
+	}
+
+	streams, err := CollectPages(func(token *string) (*cloudwatchlogs.DescribeLogStreamsOutput, *string, error) {
+		input.NextToken = token
+		page, err := logsClient.DescribeLogStreams(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, page.NextToken, nil
+	}, opts, func(page *cloudwatchlogs.DescribeLogStreamsOutput) []*cloudwatchlogs.LogStream {
+		return page.LogStreams
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log streams of %s: %w", logGroupName, err)
+	}
+
+	return streams, nil
+}
+
+// ListRules returns the rules on an event bus ("" for default) whose names start with the prefix
+func ListRules(sess *session.Session, eventBusName, namePrefix string, opts PageOptions) ([]*eventbridge.Rule, error) {
+	eventbridgeClient := eventbridge.New(sess)
+
+	input := &eventbridge.ListRulesInput{}
+	if eventBusName != "" {
+		input.EventBusName = aws.String(eventBusName)
+	}
+	if namePrefix != "" {
+		input.NamePrefix = aws.String(namePrefix)
+	}
+
+	rules, err := CollectPages(func(token *string) (*eventbridge.ListRulesOutput, *string, error) {
+		input.NextToken = token
+		page, err := eventbridgeClient.ListRules(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return page, page.NextToken, nil
+	}, opts, func(page *eventbridge.ListRulesOutput) []*eventbridge.Rule {
+		return page.Rules
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules with prefix %q: %w", namePrefix, err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/arns"
+)
+
+// DefaultTestRegion is the region tests deploy to when AWS_REGION is not set
+const DefaultTestRegion = "us-east-1"
+
+// TestRegion returns the region tests deploy to: AWS_REGION, or DefaultTestRegion
+func TestRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return DefaultTestRegion
+}
+
+// Partition is an AWS partition the stack can be deployed to. ARNs, endpoint domains and the
+// services on offer differ between partitions, so helpers build them from the partition of the
+// region they run in instead of assuming the standard one.
+type Partition struct {
+	// ID is the partition of ARNs, e.g. "aws-us-gov"
+	ID string
+	// DNSSuffix is the domain of the partition's service endpoints, e.g. "amazonaws.com.cn"
+	DNSSuffix string
+	// RegionPrefix matches the partition's region names, e.g. "cn-"; empty for the standard partition
+	RegionPrefix string
+	// DefaultRegion is the region partition checks run against
+	DefaultRegion string
+}
+
+// Partitions lists the partitions the stack supports, the standard partition last because its
+// regions have no common prefix
+var Partitions = []Partition{
+	{ID: "aws-us-gov", DNSSuffix: "amazonaws.com", RegionPrefix: "us-gov-", DefaultRegion: "us-gov-west-1"},
+	{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn", RegionPrefix: "cn-", DefaultRegion: "cn-north-1"},
+	{ID: "aws", DNSSuffix: "amazonaws.com", DefaultRegion: "us-east-1"},
+}
+
+// PartitionFor returns the partition a region belongs to
+func PartitionFor(region string) Partition {
+	for _, partition := range Partitions {
+		if strings.HasPrefix(region, partition.RegionPrefix) {
+			return partition
+		}
+	}
+	return Partitions[len(Partitions)-1]
+}
+
+// SessionPartition returns the partition of the session's region
+func SessionPartition(sess *session.Session) Partition {
+	return PartitionFor(aws.StringValue(sess.Config.Region))
+}
+
+// ARN builds an ARN in the partition. Region and account are empty for global resources, e.g.
+// p.ARN("s3", "", "", bucket).
+func (p Partition) ARN(service, region, account, resource string) string {
+	return arn.ARN{Partition: p.ID, Service: service, Region: region, AccountID: account, Resource: resource}.String()
+}
+
+// Scope returns the scope of a region and account in the partition, to build the ARNs of IR
+// resources, e.g. p.Scope(region, account).StateMachine(name)
+func (p Partition) Scope(region, account string) arns.Scope {
+	return arns.Scope{Partition: p.ID, Region: region, Account: account}
+}
+
+// Endpoint returns the regional endpoint host of a service in the partition, e.g.
+// securityhub.cn-north-1.amazonaws.com.cn
+func (p Partition) Endpoint(service, region string) string {
+	return fmt.Sprintf("%s.%s.%s", service, region, p.DNSSuffix)
+}
+
+// ServiceAvailable reports whether the SDK's endpoint metadata lists the service, named by its
+// endpoint prefix such as "securityhub", in the region. Tests skip the parts of the pipeline whose
+// service a partition does not offer rather than failing on a missing endpoint.
+func ServiceAvailable(service, region string) bool {
+	partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return false
+	}
+	svc, ok := partition.Services()[service]
+	if !ok {
+		return false
+	}
+	_, ok = svc.Regions()[region]
+	return ok
+}
+
+// StackServices are the endpoint prefixes of the services the default stack deploys to or calls
+var StackServices = []string{
+	"ec2", "events", "guardduty", "kms", "lambda", "logs", "s3", "securityhub", "sns", "sqs", "ssm", "states",
+}
+
+// AssertPartitionSupport checks the partition of a region against the SDK's endpoint metadata:
+// the SDK must place the region in the same partition, and every stack service must resolve to an
+// endpoint under the partition's DNS suffix. Services the region does not offer are returned
+// rather than reported as errors, since optional features such as Security Hub can be turned off.
+func AssertPartitionSupport(region string) (unavailable []string, err error) {
+	partition := PartitionFor(region)
+
+	sdkPartition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return nil, fmt.Errorf("the SDK does not know region %s", region)
+	}
+	if sdkPartition.ID() != partition.ID {
+		return nil, fmt.Errorf("region %s is in partition %s, the harness assumes %s", region, sdkPartition.ID(), partition.ID)
+	}
+
+	var problems []string
+	for _, service := range StackServices {
+		if !ServiceAvailable(service, region) {
+			unavailable = append(unavailable, service)
+			continue
+		}
+		resolved, err := endpoints.DefaultResolver().EndpointFor(service, region)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", service, err))
+			continue
+		}
+		if !strings.HasSuffix(strings.TrimSuffix(resolved.URL, "/"), "."+partition.DNSSuffix) {
+			problems = append(problems, fmt.Sprintf("%s: endpoint %s is not under %s", service, resolved.URL, partition.DNSSuffix))
+		}
+	}
+
+	if len(problems) > 0 {
+		return unavailable, fmt.Errorf("partition %s does not match the SDK in %s:\n  %s", partition.ID, region, strings.Join(problems, "\n  "))
+	}
+	return unavailable, nil
+}
@@ -0,0 +1,26 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// SetContainmentPaused flips the stack's containment pause parameter (terraform output
+// containment_pause_parameter_name). While paused, triage records findings and queues them until
+// the scheduled drain runs after the pause is lifted.
+func SetContainmentPaused(sess *session.Session, parameterName string, paused bool) error {
+	if _, err := ssm.New(sess).PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(parameterName),
+		Value:     aws.String(strconv.FormatBool(paused)),
+		Type:      aws.String(ssm.ParameterTypeString),
+		Overwrite: aws.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("failed to set %s: %w", parameterName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package perfbaseline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Run is the set of performance metrics recorded for one commit. Metric values are lower-is-better,
+// e.g. durations in milliseconds.
+type Run struct {
+	SHA       string             `json:"sha"`
+	Suite     string             `json:"suite"`
+	Timestamp time.Time          `json:"timestamp"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// Regression is a metric that got slower than the baseline by more than the allowed percentage
+type Regression struct {
+	Metric   string
+	Baseline float64
+	Current  float64
+}
+
+// Percent is the increase over the baseline
+func (r Regression) Percent() float64 {
+	if r.Baseline == 0 {
+		return 0
+	}
+	return (r.Current - r.Baseline) / r.Baseline * 100
+}
+
+// String renders the regression as "metric: 120.0 -> 180.0 (+50.0%)"
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %.1f -> %.1f (+%.1f%%)", r.Metric, r.Baseline, r.Current, r.Percent())
+}
+
+// Store persists runs as one JSON object per suite and SHA under a bucket prefix
+type Store struct {
+	Session *session.Session
+	Bucket  string
+	Prefix  string
+}
+
+func (s Store) key(suite, sha string) string {
+	return path.Join(s.Prefix, suite, sha+".json")
+}
+
+// Save writes the run, replacing an earlier run of the same SHA
+func (s Store) Save(run Run) error {
+	body, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+
+	_, err = s3.New(s.Session).PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(run.Suite, run.SHA)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save run %s: %w", run.SHA, err)
+	}
+
+	return nil
+}
+
+// Recent returns up to limit runs of a suite, newest first
+func (s Store) Recent(suite string, limit int) ([]Run, error) {
+	s3Client := s3.New(s.Session)
+
+	var objects []*s3.Object
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(path.Join(s.Prefix, suite) + "/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		objects = append(objects, page.Contents...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.TimeValue(objects[i].LastModified).After(aws.TimeValue(objects[j].LastModified))
+	})
+	if len(objects) > limit {
+		objects = objects[:limit]
+	}
+
+	runs := make([]Run, 0, len(objects))
+	for _, object := range objects {
+		output, err := s3Client.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: object.Key})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get run %s: %w", aws.StringValue(object.Key), err)
+		}
+
+		var run Run
+		err = json.NewDecoder(output.Body).Decode(&run)
+		output.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse run %s: %w", aws.StringValue(object.Key), err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// Baseline is the median of every metric over the runs. The median keeps one noisy run from moving
+// the baseline.
+func Baseline(runs []Run) map[string]float64 {
+	values := map[string][]float64{}
+	for _, run := range runs {
+		for metric, value := range run.Metrics {
+			values[metric] = append(values[metric], value)
+		}
+	}
+
+	baseline := map[string]float64{}
+	for metric, samples := range values {
+		sort.Float64s(samples)
+		middle := len(samples) / 2
+		if len(samples)%2 == 0 {
+			baseline[metric] = (samples[middle-1] + samples[middle]) / 2
+		} else {
+			baseline[metric] = samples[middle]
+		}
+	}
+
+	return baseline
+}
+
+// Compare returns the metrics of the current run that exceed the baseline by more than maxPercent,
+// ordered by metric name. Metrics without a baseline are new and never regress.
+func Compare(baseline, current map[string]float64, maxPercent float64) []Regression {
+	var regressions []Regression
+	for metric, value := range current {
+		base, ok := baseline[metric]
+		if !ok {
+			continue
+		}
+
+		regression := Regression{Metric: metric, Baseline: base, Current: value}
+		if value > base && regression.Percent() > maxPercent {
+			regressions = append(regressions, regression)
+		}
+	}
+
+	sort.Slice(regressions, func(i, j int) bool { return regressions[i].Metric < regressions[j].Metric })
+	return regressions
+}
+
+// Check compares the run against the rolling baseline of the last window runs of other SHAs, then
+// saves it. The run is saved even when it regresses, so a real slowdown becomes the new baseline
+// once it has been accepted on enough commits.
+func (s Store) Check(run Run, window int, maxPercent float64) ([]Regression, error) {
+	previous, err := s.Recent(run.Suite, window+1)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []Run
+	for _, candidate := range previous {
+		if candidate.SHA != run.SHA && len(others) < window {
+			others = append(others, candidate)
+		}
+	}
+
+	regressions := Compare(Baseline(others), run.Metrics, maxPercent)
+
+	if err := s.Save(run); err != nil {
+		return nil, err
+	}
+
+	return regressions, nil
+}
+
+// AssertNoRegression is Check that fails when any metric regressed
+func (s Store) AssertNoRegression(run Run, window int, maxPercent float64) error {
+	regressions, err := s.Check(run, window, maxPercent)
+	if err != nil {
+		return err
+	}
+
+	if len(regressions) > 0 {
+		lines := make([]string, len(regressions))
+		for i, regression := range regressions {
+			lines[i] = regression.String()
+		}
+		return fmt.Errorf("%s regressed more than %.0f%% from the baseline: %s", run.Suite, maxPercent, strings.Join(lines, "; "))
+	}
+
+	return nil
+}
+
+// CurrentSHA returns the commit under test from GIT_SHA or GITHUB_SHA, falling back to git itself
+func CurrentSHA() (string, error) {
+	for _, name := range []string{"GIT_SHA", "GITHUB_SHA"} {
+		if sha := os.Getenv(name); sha != "" {
+			return sha, nil
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the current commit: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,226 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/arns"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tfplan"
+)
+
+// PlannedCall is an API call the deployment or the running pipeline will make
+type PlannedCall struct {
+	// Component is the Terraform address for deploy calls, or the pipeline role for runtime calls
+	Component string
+	Action    string
+	// Runtime calls are made by the pipeline's roles rather than the deploying principal, so only
+	// SCPs, which bind every principal in the account, are meaningful when simulating them
+	Runtime bool
+}
+
+// resourceCalls are the API calls Terraform makes to create or update, and to delete, each resource type of the stack
+var resourceCalls = map[string]struct{ Apply, Delete []string }{
+	"aws_cloudwatch_event_rule":                          {[]string{"events:PutRule", "events:TagResource"}, []string{"events:DeleteRule"}},
+	"aws_cloudwatch_event_target":                        {[]string{"events:PutTargets"}, []string{"events:RemoveTargets"}},
+	"aws_cloudwatch_log_group":                           {[]string{"logs:CreateLogGroup", "logs:PutRetentionPolicy", "logs:TagResource"}, []string{"logs:DeleteLogGroup"}},
+	"aws_guardduty_detector":                             {[]string{"guardduty:CreateDetector", "guardduty:UpdateDetector"}, []string{"guardduty:DeleteDetector"}},
+	"aws_guardduty_organization_admin_account":           {[]string{"guardduty:EnableOrganizationAdminAccount", "organizations:EnableAWSServiceAccess", "organizations:RegisterDelegatedAdministrator"}, []string{"guardduty:DisableOrganizationAdminAccount"}},
+	"aws_guardduty_organization_configuration":           {[]string{"guardduty:UpdateOrganizationConfiguration"}, nil},
+	"aws_iam_policy":                                     {[]string{"iam:CreatePolicy", "iam:CreatePolicyVersion"}, []string{"iam:DeletePolicy", "iam:DeletePolicyVersion"}},
+	"aws_iam_role":                                       {[]string{"iam:CreateRole", "iam:UpdateAssumeRolePolicy", "iam:TagRole"}, []string{"iam:DeleteRole"}},
+	"aws_iam_role_policy":                                {[]string{"iam:PutRolePolicy"}, []string{"iam:DeleteRolePolicy"}},
+	"aws_iam_role_policy_attachment":                     {[]string{"iam:AttachRolePolicy"}, []string{"iam:DetachRolePolicy"}},
+	"aws_kms_alias":                                      {[]string{"kms:CreateAlias", "kms:UpdateAlias"}, []string{"kms:DeleteAlias"}},
+	"aws_kms_key":                                        {[]string{"kms:CreateKey", "kms:PutKeyPolicy", "kms:EnableKeyRotation", "kms:TagResource"}, []string{"kms:ScheduleKeyDeletion"}},
+	"aws_lambda_function":                                {[]string{"lambda:CreateFunction", "lambda:UpdateFunctionCode", "lambda:UpdateFunctionConfiguration", "iam:PassRole"}, []string{"lambda:DeleteFunction"}},
+	"aws_lambda_permission":                              {[]string{"lambda:AddPermission"}, []string{"lambda:RemovePermission"}},
+	"aws_s3_bucket":                                      {[]string{"s3:CreateBucket", "s3:PutBucketTagging"}, []string{"s3:DeleteBucket"}},
+	"aws_s3_bucket_lifecycle_configuration":              {[]string{"s3:PutLifecycleConfiguration"}, []string{"s3:PutLifecycleConfiguration"}},
+	"aws_s3_bucket_logging":                              {[]string{"s3:PutBucketLogging"}, []string{"s3:PutBucketLogging"}},
+	"aws_s3_bucket_ownership_controls":                   {[]string{"s3:PutBucketOwnershipControls"}, []string{"s3:PutBucketOwnershipControls"}},
+	"aws_s3_bucket_policy":                               {[]string{"s3:PutBucketPolicy"}, []string{"s3:DeleteBucketPolicy"}},
+	"aws_s3_bucket_public_access_block":                  {[]string{"s3:PutBucketPublicAccessBlock"}, []string{"s3:PutBucketPublicAccessBlock"}},
+	"aws_s3_bucket_server_side_encryption_configuration": {[]string{"s3:PutEncryptionConfiguration"}, []string{"s3:PutEncryptionConfiguration"}},
+	"aws_s3_bucket_versioning":                           {[]string{"s3:PutBucketVersioning"}, []string{"s3:PutBucketVersioning"}},
+	"aws_security_group":                                 {[]string{"ec2:CreateSecurityGroup", "ec2:RevokeSecurityGroupEgress", "ec2:CreateTags"}, []string{"ec2:DeleteSecurityGroup"}},
+	"aws_securityhub_account":                            {[]string{"securityhub:EnableSecurityHub"}, []string{"securityhub:DisableSecurityHub"}},
+	"aws_securityhub_standards_subscription":             {[]string{"securityhub:BatchEnableStandards"}, []string{"securityhub:BatchDisableStandards"}},
+	"aws_sfn_state_machine":                              {[]string{"states:CreateStateMachine", "states:UpdateStateMachine", "iam:PassRole"}, []string{"states:DeleteStateMachine"}},
+	"aws_sns_topic":                                      {[]string{"sns:CreateTopic", "sns:SetTopicAttributes"}, []string{"sns:DeleteTopic"}},
+	"aws_sns_topic_policy":                               {[]string{"sns:SetTopicAttributes"}, []string{"sns:SetTopicAttributes"}},
+	"aws_sns_topic_subscription":                         {[]string{"sns:Subscribe"}, []string{"sns:Unsubscribe"}},
+	"aws_sqs_queue":                                      {[]string{"sqs:CreateQueue", "sqs:SetQueueAttributes"}, []string{"sqs:DeleteQueue"}},
+	"aws_vpc_endpoint":                                   {[]string{"ec2:CreateVpcEndpoint", "ec2:ModifyVpcEndpoint"}, []string{"ec2:DeleteVpcEndpoints"}},
+	"aws_vpc_security_group_egress_rule":                 {[]string{"ec2:AuthorizeSecurityGroupEgress"}, []string{"ec2:RevokeSecurityGroupEgress"}},
+	"aws_vpc_security_group_ingress_rule":                {[]string{"ec2:AuthorizeSecurityGroupIngress"}, []string{"ec2:RevokeSecurityGroupIngress"}},
+}
+
+// PipelineRuntimeCalls are the calls the deployed pipeline makes while responding to a finding.
+// SCPs apply to every principal in the account, so they are checked before the roles exist.
+var PipelineRuntimeCalls = []PlannedCall{
+	{Component: "lambda-triage", Action: "states:StartExecution", Runtime: true},
+	{Component: "lambda-triage", Action: "s3:PutObject", Runtime: true},
+	{Component: "lambda-triage", Action: "kms:GenerateDataKey", Runtime: true},
+	{Component: "lambda-triage", Action: "ec2:ModifyNetworkInterfaceAttribute", Runtime: true},
+	{Component: "lambda-triage", Action: "ec2:CreateTags", Runtime: true},
+	{Component: "lambda-triage", Action: "ec2:CreateFlowLogs", Runtime: true},
+	{Component: "lambda-triage", Action: "iam:PassRole", Runtime: true},
+	{Component: "lambda-triage", Action: "securityhub:BatchUpdateFindings", Runtime: true},
+	{Component: "lambda-triage", Action: "sns:Publish", Runtime: true},
+	{Component: "stepfn-ir", Action: "lambda:InvokeFunction", Runtime: true},
+	{Component: "stepfn-ir", Action: "sns:Publish", Runtime: true},
+}
+
+// PlannedCalls maps the changes of a plan to the API calls Terraform will make. Resource types
+// without a mapping are returned separately so the caller can report them as unchecked.
+func PlannedCalls(plan *tfplan.Plan) (calls []PlannedCall, unmapped []string) {
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != "managed" || rc.IsNoOp() {
+			continue
+		}
+
+		mapping, ok := resourceCalls[rc.Type]
+		if !ok {
+			unmapped = append(unmapped, rc.Address)
+			continue
+		}
+
+		for _, action := range rc.Change.Actions {
+			actions := mapping.Apply
+			if action == "delete" {
+				actions = mapping.Delete
+			}
+			for _, name := range actions {
+				calls = append(calls, PlannedCall{Component: rc.Address, Action: name})
+			}
+		}
+	}
+
+	sort.Strings(unmapped)
+	return calls, unmapped
+}
+
+// PreflightBlock is a planned call the simulator says would be denied
+type PreflightBlock struct {
+	Call      PlannedCall
+	BlockedBy string
+}
+
+// PreflightReport is the outcome of simulating the planned calls
+type PreflightReport struct {
+	Principal string
+	Checked   int
+	Blocked   []PreflightBlock
+	Unmapped  []string
+}
+
+// BlockedByGuardrails reports whether an SCP or permissions boundary blocks any call, which no
+// change to the stack's own policies can fix
+func (r PreflightReport) BlockedByGuardrails() bool {
+	for _, block := range r.Blocked {
+		if block.BlockedBy != BlockedByIdentityPolicy {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the report grouped by blocking layer
+func (r PreflightReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Preflight as %s: %d calls checked, %d blocked\n", r.Principal, r.Checked, len(r.Blocked))
+
+	for _, layer := range []string{BlockedBySCP, BlockedByPermissionsBoundary, BlockedByIdentityPolicy} {
+		var lines []string
+		for _, block := range r.Blocked {
+			if block.BlockedBy == layer {
+				phase := "deploy"
+				if block.Call.Runtime {
+					phase = "runtime"
+				}
+				lines = append(lines, fmt.Sprintf("  %s (%s, %s)", block.Call.Action, phase, block.Call.Component))
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\nBlocked by %s:\n%s\n", layer, strings.Join(lines, "\n"))
+		}
+	}
+
+	if len(r.Unmapped) > 0 {
+		fmt.Fprintf(&b, "\nNot checked (no call mapping):\n  %s\n", strings.Join(r.Unmapped, "\n  "))
+	}
+
+	return b.String()
+}
+
+// RunPreflight simulates the calls as the principal against every resource. Calls are deduplicated
+// by action, and a blocked action is reported once for each call that needs it.
+func RunPreflight(sess *session.Session, principalARN string, calls []PlannedCall, unmapped []string) (PreflightReport, error) {
+	report := PreflightReport{Principal: principalARN, Unmapped: unmapped}
+
+	byAction := map[string][]PlannedCall{}
+	var actions []string
+	for _, call := range calls {
+		if _, seen := byAction[call.Action]; !seen {
+			actions = append(actions, call.Action)
+		}
+		byAction[call.Action] = append(byAction[call.Action], call)
+	}
+	sort.Strings(actions)
+	report.Checked = len(actions)
+
+	// The simulator takes a bounded number of actions per request
+	const batchSize = 50
+	for start := 0; start < len(actions); start += batchSize {
+		end := start + batchSize
+		if end > len(actions) {
+			end = len(actions)
+		}
+
+		results, err := SimulatePrincipalActions(sess, principalARN, actions[start:end], []string{"*"})
+		if err != nil {
+			return report, err
+		}
+
+		for _, result := range results {
+			if result.BlockedBy == "" {
+				continue
+			}
+			for _, call := range byAction[result.Action] {
+				if call.Runtime && result.BlockedBy != BlockedBySCP {
+					continue
+				}
+				report.Blocked = append(report.Blocked, PreflightBlock{Call: call, BlockedBy: result.BlockedBy})
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// CallerPrincipalARN returns the IAM ARN to simulate for the session's credentials. Assumed-role
+// sessions map to their role; roles with a path need the ARN passed explicitly instead.
+func CallerPrincipalARN(sess *session.Session) (string, error) {
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	callerARN := aws.StringValue(identity.Arn)
+	parsed, err := arns.Parse(callerARN)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse caller ARN: %w", err)
+	}
+
+	if parsed.Service == "sts" && strings.HasPrefix(parsed.Resource, "assumed-role/") {
+		parts := strings.Split(parsed.Resource, "/")
+		return arns.ScopeOf(parsed).Role(parts[1]), nil
+	}
+
+	return callerARN, nil
+}
@@ -0,0 +1,126 @@
+package probes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// Probe is a single API call an unauthorized principal must be refused
+type Probe struct {
+	Name string
+	Call func(sess *session.Session) error
+	// Refusals are error codes besides the generic access-denied ones that also count as a denial,
+	// e.g. AccessControlListNotSupported for ACL writes on a bucket with ACLs disabled
+	Refusals []string
+}
+
+// Result is the outcome of one probe
+type Result struct {
+	Probe  string
+	Denied bool
+	Err    error
+}
+
+// String renders the result as "GetObject: denied (AccessDenied)"
+func (r Result) String() string {
+	switch {
+	case r.Err == nil:
+		return fmt.Sprintf("%s: allowed", r.Probe)
+	case r.Denied:
+		return fmt.Sprintf("%s: denied (%s)", r.Probe, errorCode(r.Err))
+	default:
+		return fmt.Sprintf("%s: failed (%v)", r.Probe, r.Err)
+	}
+}
+
+// Harness runs probes as a low-privilege scratch role it creates and owns
+type Harness struct {
+	RoleName string
+	RoleARN  string
+	// Session acts as the scratch role
+	Session *session.Session
+
+	admin *session.Session
+}
+
+// NewHarness creates the scratch role with an optional inline policy and assumes it. The returned
+// harness must be closed even on error, since the role may already exist.
+func NewHarness(sess *session.Session, roleName, policy string) (*Harness, error) {
+	h := &Harness{RoleName: roleName, admin: sess}
+
+	roleARN, err := helpers.CreateScratchRole(sess, roleName, policy)
+	if err != nil {
+		return h, err
+	}
+	h.RoleARN = roleARN
+
+	if h.Session, err = helpers.AssumeRoleSession(sess, roleARN, 2*time.Minute); err != nil {
+		return h, err
+	}
+
+	return h, nil
+}
+
+// Close deletes the scratch role
+func (h *Harness) Close() error {
+	return helpers.DeleteScratchRole(h.admin, h.RoleName)
+}
+
+// Run executes the probes as the scratch role
+func (h *Harness) Run(probes ...Probe) []Result {
+	results := make([]Result, 0, len(probes))
+	for _, probe := range probes {
+		err := probe.Call(h.Session)
+		results = append(results, Result{
+			Probe:  probe.Name,
+			Denied: err != nil && isRefusal(err, probe.Refusals),
+			Err:    err,
+		})
+	}
+
+	return results
+}
+
+// AssertDenied returns an error naming every probe that was allowed or failed for a reason other
+// than authorization
+func AssertDenied(results []Result) error {
+	var problems []string
+	for _, result := range results {
+		if !result.Denied {
+			problems = append(problems, result.String())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d probes were not denied: %s", len(problems), len(results), strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func isRefusal(err error, refusals []string) bool {
+	if helpers.IsAccessDenied(err) {
+		return true
+	}
+
+	code := errorCode(err)
+	for _, refusal := range refusals {
+		if code == refusal {
+			return true
+		}
+	}
+	return false
+}
+
+func errorCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package probes
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// EvidenceBucketProbes returns the reads, writes, deletes and ACL changes an unauthorized principal
+// must be refused on the evidence bucket. key should name an existing object so that reads and
+// deletes are refused for authorization rather than because the object is missing.
+func EvidenceBucketProbes(bucket, key string) []Probe {
+	aclRefusals := []string{"AccessControlListNotSupported"}
+
+	return []Probe{
+		{Name: "ListObjectsV2", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+			return err
+		}},
+		{Name: "GetObject", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			return err
+		}},
+		{Name: "PutObjectUnencrypted", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).PutObject(&s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String("probes/unencrypted.json"),
+				Body:   strings.NewReader(`{"probe":true}`),
+			})
+			return err
+		}},
+		{Name: "PutObjectEncrypted", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).PutObject(&s3.PutObjectInput{
+				Bucket:               aws.String(bucket),
+				Key:                  aws.String("probes/encrypted.json"),
+				Body:                 strings.NewReader(`{"probe":true}`),
+				ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+			})
+			return err
+		}},
+		{Name: "DeleteObject", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			return err
+		}},
+		{Name: "PutObjectAcl", Refusals: aclRefusals, Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).PutObjectAcl(&s3.PutObjectAclInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+				ACL:    aws.String(s3.ObjectCannedACLPublicRead),
+			})
+			return err
+		}},
+		{Name: "PutBucketAcl", Refusals: aclRefusals, Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).PutBucketAcl(&s3.PutBucketAclInput{
+				Bucket: aws.String(bucket),
+				ACL:    aws.String(s3.BucketCannedACLPublicRead),
+			})
+			return err
+		}},
+		{Name: "DeleteBucketPolicy", Call: func(sess *session.Session) error {
+			_, err := s3.New(sess).DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)})
+			return err
+		}},
+	}
+}
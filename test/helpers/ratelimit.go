@@ -0,0 +1,263 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	terratestaws "github.com/gruntwork-io/terratest/modules/aws"
+)
+
+// RateLimit is the sustained request rate and burst allowed for one service
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// DefaultRateLimits are keyed by SDK service name; "*" applies to unlisted services.
+// They sit below the documented API quotas so parallel suites share an account without throttling.
+var DefaultRateLimits = map[string]RateLimit{
+	"*":                        {RequestsPerSecond: 10, Burst: 20},
+	cloudwatchlogs.ServiceName: {RequestsPerSecond: 5, Burst: 5},
+	sfn.ServiceName:            {RequestsPerSecond: 10, Burst: 20},
+	eventbridge.ServiceName:    {RequestsPerSecond: 20, Burst: 40},
+	lambda.ServiceName:         {RequestsPerSecond: 10, Burst: 15},
+	iam.ServiceName:            {RequestsPerSecond: 5, Burst: 10},
+	cloudwatch.ServiceName:     {RequestsPerSecond: 10, Burst: 20},
+}
+
+// DefaultRateLimiter is shared by every session from NewRateLimitedSession, since quotas are per account
+var DefaultRateLimiter = NewRateLimiter(DefaultRateLimits)
+
+// RateLimiter applies a token bucket per service that halves its rate on throttling and recovers on success
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]RateLimit
+	buckets   map[string]*tokenBucket
+	calls     map[string]int64
+	throttles map[string]int64
+}
+
+// NewRateLimiter returns a limiter for the given per-service limits
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limits:    limits,
+		buckets:   map[string]*tokenBucket{},
+		calls:     map[string]int64{},
+		throttles: map[string]int64{},
+	}
+}
+
+// NewRateLimitedSession returns an authenticated session whose calls go through DefaultRateLimiter.
+// In FIPSMode the session uses FIPS endpoints and DefaultEndpointAudit audits it.
+func NewRateLimitedSession(region string) (*session.Session, error) {
+	sess, err := terratestaws.NewAuthenticatedSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	if FIPSMode() {
+		if sess, err = EnableFIPS(sess); err != nil {
+			return nil, err
+		}
+		DefaultEndpointAudit.Install(sess)
+	}
+
+	return DefaultRateLimiter.Wrap(sess), nil
+}
+
+// Wrap returns a copy of the session with rate limiting and a throttle-tolerant retryer
+func (l *RateLimiter) Wrap(sess *session.Session) *session.Session {
+	cfg := request.WithRetryer(aws.NewConfig(), client.DefaultRetryer{
+		NumMaxRetries:    8,
+		MinRetryDelay:    200 * time.Millisecond,
+		MaxRetryDelay:    10 * time.Second,
+		MinThrottleDelay: 500 * time.Millisecond,
+		MaxThrottleDelay: 30 * time.Second,
+	})
+
+	wrapped := sess.Copy(cfg)
+
+	// Send runs once per attempt, so retries also wait for a token
+	wrapped.Handlers.Send.PushFront(func(r *request.Request) {
+		service := r.ClientInfo.ServiceName
+		l.record(service, l.calls)
+		if err := l.bucket(service).wait(r.Context()); err != nil {
+			r.Error = err
+		}
+	})
+
+	wrapped.Handlers.Retry.PushFront(func(r *request.Request) {
+		if request.IsErrorThrottle(r.Error) {
+			service := r.ClientInfo.ServiceName
+			l.record(service, l.throttles)
+			l.bucket(service).throttled()
+		}
+	})
+
+	wrapped.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			l.bucket(r.ClientInfo.ServiceName).succeeded()
+		}
+	})
+
+	return wrapped
+}
+
+// ThrottleCounts returns the number of throttled attempts per service
+func (l *RateLimiter) ThrottleCounts() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int64, len(l.throttles))
+	for service, count := range l.throttles {
+		counts[service] = count
+	}
+	return counts
+}
+
+// String renders calls, throttles and the current adaptive rate per service
+func (l *RateLimiter) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	services := make([]string, 0, len(l.calls))
+	for service := range l.calls {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-14s %8s %10s %8s\n", "SERVICE", "CALLS", "THROTTLES", "RATE/S")
+	for _, service := range services {
+		fmt.Fprintf(&b, "%-14s %8d %10d %8.1f\n", service, l.calls[service], l.throttles[service], l.buckets[service].currentRate())
+	}
+
+	return b.String()
+}
+
+func (l *RateLimiter) record(service string, counter map[string]int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counter[service]++
+}
+
+func (l *RateLimiter) bucket(service string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bucket, ok := l.buckets[service]; ok {
+		return bucket
+	}
+
+	limit, ok := l.limits[service]
+	if !ok {
+		limit = l.limits["*"]
+	}
+	if limit.RequestsPerSecond <= 0 {
+		limit = DefaultRateLimits["*"]
+	}
+
+	bucket := newTokenBucket(limit)
+	l.buckets[service] = bucket
+	return bucket
+}
+
+// tokenBucket refills at an adaptive rate between a tenth of the configured limit and the limit itself
+type tokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	maxRate float64
+	minRate float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:    limit.RequestsPerSecond,
+		maxRate: limit.RequestsPerSecond,
+		minRate: limit.RequestsPerSecond / 10,
+		burst:   burst,
+		tokens:  burst,
+		last:    time.Now(),
+	}
+}
+
+// wait blocks until a token is available or the request context is done
+func (b *tokenBucket) wait(ctx aws.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (b *tokenBucket) throttled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate /= 2
+	if b.rate < b.minRate {
+		b.rate = b.minRate
+	}
+}
+
+func (b *tokenBucket) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate += b.maxRate / 20
+	if b.rate > b.maxRate {
+		b.rate = b.maxRate
+	}
+}
+
+func (b *tokenBucket) currentRate() float64 {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.rate
+}
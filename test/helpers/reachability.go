@@ -0,0 +1,204 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// ReachabilityResult is the outcome of a Reachability Analyzer run between two resources
+type ReachabilityResult struct {
+	Source      string
+	Destination string
+	Protocol    string
+	Port        int64
+	Reachable   bool
+	// Explanations say why the path is blocked, e.g. "ENI_SG_RULES_MISMATCH (ingress) sg-0abc"
+	Explanations []string
+	// BlockingComponents are the IDs of the components named in the explanations
+	BlockingComponents []string
+}
+
+// String renders the result for test logs
+func (r ReachabilityResult) String() string {
+	verdict := "NotReachable"
+	if r.Reachable {
+		verdict = "Reachable"
+	}
+	port := "any"
+	if r.Port > 0 {
+		port = fmt.Sprint(r.Port)
+	}
+	result := fmt.Sprintf("%s -> %s %s/%s: %s", r.Source, r.Destination, r.Protocol, port, verdict)
+	if len(r.Explanations) > 0 {
+		result += " [" + strings.Join(r.Explanations, "; ") + "]"
+	}
+	return result
+}
+
+// AnalyzeReachability runs VPC Reachability Analyzer from source to destination (instance or network
+// interface IDs) for a protocol and destination port (0 for any), then removes the path it created
+func AnalyzeReachability(sess *session.Session, source, destination, protocol string, port int64, timeout time.Duration) (*ReachabilityResult, error) {
+	ec2Client := ec2.New(sess)
+
+	pathInput := &ec2.CreateNetworkInsightsPathInput{
+		Source:      aws.String(source),
+		Destination: aws.String(destination),
+		Protocol:    aws.String(protocol),
+	}
+	if port > 0 {
+		pathInput.DestinationPort = aws.Int64(port)
+	}
+
+	path, err := ec2Client.CreateNetworkInsightsPath(pathInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network insights path: %w", err)
+	}
+	pathID := path.NetworkInsightsPath.NetworkInsightsPathId
+	defer deleteNetworkInsightsPath(ec2Client, pathID)
+
+	started, err := ec2Client.StartNetworkInsightsAnalysis(&ec2.StartNetworkInsightsAnalysisInput{
+		NetworkInsightsPathId: pathID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start reachability analysis: %w", err)
+	}
+	analysisID := started.NetworkInsightsAnalysis.NetworkInsightsAnalysisId
+
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		analyses, err := ec2Client.DescribeNetworkInsightsAnalyses(&ec2.DescribeNetworkInsightsAnalysesInput{
+			NetworkInsightsAnalysisIds: []*string{analysisID},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe reachability analysis: %w", err)
+		}
+		if len(analyses.NetworkInsightsAnalyses) == 0 {
+			return nil, fmt.Errorf("reachability analysis %s not found", aws.StringValue(analysisID))
+		}
+
+		analysis := analyses.NetworkInsightsAnalyses[0]
+		switch aws.StringValue(analysis.Status) {
+		case ec2.AnalysisStatusSucceeded:
+			return reachabilityResult(source, destination, protocol, port, analysis), nil
+		case ec2.AnalysisStatusFailed:
+			return nil, fmt.Errorf("reachability analysis %s failed: %s", aws.StringValue(analysisID), aws.StringValue(analysis.StatusMessage))
+		}
+
+		if clock.Default.Now().After(deadline) {
+			return nil, fmt.Errorf("reachability analysis %s did not finish within %s", aws.StringValue(analysisID), timeout)
+		}
+		clock.Default.Sleep(5 * time.Second)
+	}
+}
+
+func reachabilityResult(source, destination, protocol string, port int64, analysis *ec2.NetworkInsightsAnalysis) *ReachabilityResult {
+	result := &ReachabilityResult{
+		Source:      source,
+		Destination: destination,
+		Protocol:    protocol,
+		Port:        port,
+		Reachable:   aws.BoolValue(analysis.NetworkPathFound),
+	}
+
+	for _, explanation := range analysis.Explanations {
+		text := aws.StringValue(explanation.ExplanationCode)
+		if explanation.Direction != nil {
+			text += fmt.Sprintf(" (%s)", aws.StringValue(explanation.Direction))
+		}
+		for _, component := range []*ec2.AnalysisComponent{explanation.SecurityGroup, explanation.Acl, explanation.Component} {
+			if component != nil && component.Id != nil {
+				text += " " + aws.StringValue(component.Id)
+				result.BlockingComponents = append(result.BlockingComponents, aws.StringValue(component.Id))
+			}
+		}
+		result.Explanations = append(result.Explanations, text)
+	}
+
+	return result
+}
+
+// deleteNetworkInsightsPath removes a path and its analyses; failures only leave free metadata behind
+func deleteNetworkInsightsPath(ec2Client *ec2.EC2, pathID *string) {
+	analyses, err := ec2Client.DescribeNetworkInsightsAnalyses(&ec2.DescribeNetworkInsightsAnalysesInput{
+		NetworkInsightsPathId: pathID,
+	})
+	if err == nil {
+		for _, analysis := range analyses.NetworkInsightsAnalyses {
+			ec2Client.DeleteNetworkInsightsAnalysis(&ec2.DeleteNetworkInsightsAnalysisInput{
+				NetworkInsightsAnalysisId: analysis.NetworkInsightsAnalysisId,
+			})
+		}
+	}
+
+	ec2Client.DeleteNetworkInsightsPath(&ec2.DeleteNetworkInsightsPathInput{
+		NetworkInsightsPathId: pathID,
+	})
+}
+
+// AssertNotReachable asserts that Reachability Analyzer finds no path from source to destination and,
+// when blockedBy is set, that the path is blocked by that component (e.g. the quarantine security group)
+func AssertNotReachable(sess *session.Session, source, destination, protocol string, port int64, blockedBy string) (*ReachabilityResult, error) {
+	result, err := AnalyzeReachability(sess, source, destination, protocol, port, 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Reachable {
+		return result, fmt.Errorf("path found: %s", result)
+	}
+
+	if blockedBy != "" {
+		for _, component := range result.BlockingComponents {
+			if component == blockedBy {
+				return result, nil
+			}
+		}
+		return result, fmt.Errorf("path is blocked, but not by %s: %s", blockedBy, result)
+	}
+
+	return result, nil
+}
+
+// CreateProberInterface creates a standalone network interface to act as the source of reachability
+// analyses; with no security groups it gets the VPC default group, which allows all egress
+func CreateProberInterface(sess *session.Session, subnetID string, securityGroupIDs []string, tags map[string]string) (string, error) {
+	input := &ec2.CreateNetworkInterfaceInput{
+		SubnetId:    aws.String(subnetID),
+		Description: aws.String("threat-detection-ir reachability prober"),
+		Groups:      aws.StringSlice(securityGroupIDs),
+	}
+	if len(tags) > 0 {
+		var ec2Tags []*ec2.Tag
+		for key, value := range tags {
+			ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		input.TagSpecifications = []*ec2.TagSpecification{
+			{ResourceType: aws.String(ec2.ResourceTypeNetworkInterface), Tags: ec2Tags},
+		}
+	}
+
+	eni, err := ec2.New(sess).CreateNetworkInterface(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create prober network interface: %w", err)
+	}
+
+	return aws.StringValue(eni.NetworkInterface.NetworkInterfaceId), nil
+}
+
+// DeleteNetworkInterface deletes a standalone network interface
+func DeleteNetworkInterface(sess *session.Session, eniID string) error {
+	if _, err := ec2.New(sess).DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: aws.String(eniID),
+	}); err != nil {
+		return fmt.Errorf("failed to delete network interface %s: %w", eniID, err)
+	}
+
+	return nil
+}
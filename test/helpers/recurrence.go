@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// WaitForTriageExecution waits until an execution the triage Lambda started for the finding has
+// finished and returns it. Unlike WaitForFindingExecution it skips the executions EventBridge starts
+// directly, which carry neither targets nor what triage decided about the finding.
+func WaitForTriageExecution(sess *session.Session, stateMachineArn, findingID string, timeout time.Duration) (*sfn.DescribeExecutionOutput, error) {
+	sfnClient := sfn.New(sess)
+	prefix := TriageExecutionPrefix(findingID)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		executions, err := ListExecutions(sess, stateMachineArn, "", PageOptions{MaxPages: 5})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, execution := range executions {
+			if !strings.HasPrefix(aws.StringValue(execution.Name), prefix) ||
+				aws.StringValue(execution.Status) == sfn.ExecutionStatusRunning {
+				continue
+			}
+			described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+				ExecutionArn: execution.ExecutionArn,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe execution: %w", err)
+			}
+			return described, nil
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return nil, fmt.Errorf("no finished triage execution for finding %s within %s", findingID, timeout)
+}
+
+// GetEvidenceRecurrence reads the recurrence block triage adds to the evidence of an escalated
+// finding; it is nil for a finding that was not escalated
+func GetEvidenceRecurrence(sess *session.Session, bucketName, key string) (*Recurrence, error) {
+	object, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence %s: %w", key, err)
+	}
+	defer object.Body.Close()
+
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence %s: %w", key, err)
+	}
+	var evidence struct {
+		Recurrence *Recurrence `json:"recurrence"`
+	}
+	if err := json.Unmarshal(body, &evidence); err != nil {
+		return nil, fmt.Errorf("evidence %s is not JSON: %w", key, err)
+	}
+	return evidence.Recurrence, nil
+}
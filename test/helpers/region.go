@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ErrCodeRegionUnavailable is the error code of requests refused by a RegionFence
+const ErrCodeRegionUnavailable = "RegionUnavailable"
+
+// RegionFence simulates the loss of a region by failing every request a session sends to that
+// region's endpoints, and records them so a test can tell which calls still depended on it.
+// Global endpoints such as iam.amazonaws.com are not fenced.
+type RegionFence struct {
+	Region string
+
+	mu      sync.Mutex
+	blocked map[string]int
+}
+
+// FenceRegion installs a fence for the region on the session
+func FenceRegion(sess *session.Session, region string) *RegionFence {
+	fence := &RegionFence{Region: region, blocked: map[string]int{}}
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "threat-detection-ir.RegionFence",
+		Fn:   fence.handle,
+	})
+	return fence
+}
+
+func (f *RegionFence) handle(r *request.Request) {
+	if r.HTTPRequest == nil || !f.covers(r.HTTPRequest.URL) {
+		return
+	}
+
+	f.mu.Lock()
+	f.blocked[r.ClientInfo.ServiceName+"."+r.Operation.Name]++
+	f.mu.Unlock()
+
+	// Failing validation stops the request before it is signed or sent, and it is not retried
+	r.Error = awserr.New(ErrCodeRegionUnavailable, fmt.Sprintf("region %s is fenced off", f.Region), nil)
+}
+
+// covers reports whether the endpoint host belongs to the fenced region, e.g. states.us-east-1.amazonaws.com
+func (f *RegionFence) covers(endpoint *url.URL) bool {
+	for _, label := range strings.Split(endpoint.Hostname(), ".") {
+		if label == f.Region {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocked returns the fenced calls as "service.Operation xN", sorted
+func (f *RegionFence) Blocked() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []string
+	for call, count := range f.blocked {
+		calls = append(calls, fmt.Sprintf("%s x%d", call, count))
+	}
+	sort.Strings(calls)
+	return calls
+}
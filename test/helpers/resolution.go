@@ -0,0 +1,75 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ResolutionCase is a finding resource block and the "kind:identifier" strings triage must resolve
+// it to, or, when Unresolved, a resource type triage must flag instead of skipping
+type ResolutionCase struct {
+	Name       string                 `json:"name"`
+	Resource   map[string]interface{} `json:"resource"`
+	Expected   []string               `json:"expected"`
+	Unresolved bool                   `json:"unresolved"`
+}
+
+// LoadResolutionCases reads the table of resource blocks, e.g. resource-blocks.json next to this file
+func LoadResolutionCases(path string) ([]ResolutionCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resolution cases: %w", err)
+	}
+
+	var table struct {
+		Cases []ResolutionCase `json:"cases"`
+	}
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, c := range table.Cases {
+		if len(c.Expected) == 0 && !c.Unresolved {
+			return nil, fmt.Errorf("case %s expects neither resources nor an unresolved type", c.Name)
+		}
+	}
+	return table.Cases, nil
+}
+
+// AssertResourceResolution waits for the evidence of a finding injected with the case's resource
+// block and checks what triage resolved, as recorded in the evidence metadata
+func AssertResourceResolution(sess *session.Session, bucketName, findingID string, c ResolutionCase, timeout time.Duration) error {
+	metadata, err := WaitForEvidenceMetadata(sess, bucketName, findingID, timeout)
+	if err != nil {
+		return err
+	}
+
+	unresolvedType, unresolved := metadata["unresolved-resource-type"]
+	if c.Unresolved {
+		if !unresolved {
+			return fmt.Errorf("%s: expected resource type %v to be flagged as unresolved, but triage resolved %q",
+				c.Name, c.Resource["resourceType"], metadata["resources"])
+		}
+		return nil
+	}
+	if unresolved {
+		return fmt.Errorf("%s: triage could not resolve resource type %s", c.Name, unresolvedType)
+	}
+
+	var resolved []string
+	if value := metadata["resources"]; value != "" {
+		resolved = strings.Split(value, ",")
+	}
+	expected := append([]string(nil), c.Expected...)
+	sort.Strings(resolved)
+	sort.Strings(expected)
+	if strings.Join(resolved, ",") != strings.Join(expected, ",") {
+		return fmt.Errorf("%s: triage resolved %v, expected %v", c.Name, resolved, expected)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// EvidenceKey is where triage stores a finding's evidence: under classified/<class>/ for a data
+// classification in the stack's evidence_retention_matrix, and under findings/ otherwise
+func EvidenceKey(findingID, classification string) string {
+	if classification != "" {
+		return fmt.Sprintf("classified/%s/%s.json", classification, findingID)
+	}
+	return fmt.Sprintf("findings/%s.json", findingID)
+}
+
+// WaitForEvidenceObject polls until an evidence object exists at the key and returns its head
+func WaitForEvidenceObject(sess *session.Session, bucketName, key string, timeout time.Duration) (*s3.HeadObjectOutput, error) {
+	s3Client := s3.New(sess)
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		object, err := s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		})
+		if err == nil {
+			return object, nil
+		}
+		if failure, ok := err.(awserr.RequestFailure); !ok || failure.StatusCode() != 404 {
+			return nil, fmt.Errorf("failed to head evidence %s: %w", key, err)
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+
+	return nil, fmt.Errorf("no evidence stored at %s within %s", key, timeout)
+}
+
+// ObjectExpiration is when S3 lifecycle expires an object, and by which rule
+type ObjectExpiration struct {
+	Date   time.Time
+	RuleID string
+}
+
+var expirationPattern = regexp.MustCompile(`expiry-date="([^"]+)", rule-id="([^"]*)"`)
+
+// ParseObjectExpiration parses the x-amz-expiration header S3 returns for objects a lifecycle rule
+// expires, e.g. expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="evidence-retention". It
+// returns nil for objects no rule expires.
+func ParseObjectExpiration(header *string) (*ObjectExpiration, error) {
+	if aws.StringValue(header) == "" {
+		return nil, nil
+	}
+	match := expirationPattern.FindStringSubmatch(aws.StringValue(header))
+	if match == nil {
+		return nil, fmt.Errorf("unrecognized expiration %q", aws.StringValue(header))
+	}
+	date, err := time.Parse(time.RFC1123, match[1])
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized expiry date in %q: %w", aws.StringValue(header), err)
+	}
+	return &ObjectExpiration{Date: date, RuleID: match[2]}, nil
+}
+
+// GetLifecycleRule returns the bucket's lifecycle rule with the ID
+func GetLifecycleRule(sess *session.Session, bucketName, ruleID string) (*s3.LifecycleRule, error) {
+	config, err := s3.New(sess).GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle configuration of %s: %w", bucketName, err)
+	}
+	for _, rule := range config.Rules {
+		if aws.StringValue(rule.ID) == ruleID {
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no lifecycle rule %s", bucketName, ruleID)
+}
@@ -0,0 +1,168 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/iamdoc"
+)
+
+// scratchPolicyName is the inline policy CreateScratchRole attaches
+const scratchPolicyName = "scratch"
+
+// CreateScratchRole creates a role the test runner's account can assume, with an optional inline
+// policy, and returns its ARN
+func CreateScratchRole(sess *session.Session, name, policy string) (string, error) {
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	iamClient := iam.New(sess)
+
+	role, err := iamClient.CreateRole(&iam.CreateRoleInput{
+		RoleName: aws.String(name),
+		AssumeRolePolicyDocument: aws.String(fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow",`+
+			`"Principal":{"AWS":"%s"},"Action":"sts:AssumeRole"}]}`, SessionPartition(sess).ARN("iam", "", aws.StringValue(identity.Account), "root"))),
+		MaxSessionDuration: aws.Int64(3600),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create scratch role %s: %w", name, err)
+	}
+	roleARN := aws.StringValue(role.Role.Arn)
+
+	if policy != "" {
+		if _, err := iamClient.PutRolePolicy(&iam.PutRolePolicyInput{
+			RoleName:       aws.String(name),
+			PolicyName:     aws.String(scratchPolicyName),
+			PolicyDocument: aws.String(policy),
+		}); err != nil {
+			return roleARN, fmt.Errorf("failed to attach policy to scratch role %s: %w", name, err)
+		}
+	}
+
+	return roleARN, nil
+}
+
+// DeleteScratchRole removes what CreateScratchRole created, skipping parts already gone
+func DeleteScratchRole(sess *session.Session, name string) error {
+	iamClient := iam.New(sess)
+
+	if _, err := iamClient.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(name),
+		PolicyName: aws.String(scratchPolicyName),
+	}); err != nil && !isIAMNotFound(err) {
+		return fmt.Errorf("failed to delete scratch role policy %s: %w", name, err)
+	}
+
+	if _, err := iamClient.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(name)}); err != nil && !isIAMNotFound(err) {
+		return fmt.Errorf("failed to delete scratch role %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// AssumeRoleSession returns a session acting as the role. A freshly created role cannot be assumed
+// until IAM has propagated it, so assumption is retried until the timeout.
+func AssumeRoleSession(sess *session.Session, roleARN string, timeout time.Duration) (*session.Session, error) {
+	assumed, err := session.NewSession(sess.Config.Copy().WithCredentials(stscreds.NewCredentials(sess, roleARN)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session for %s: %w", roleARN, err)
+	}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		_, err := sts.New(assumed).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err == nil {
+			return assumed, nil
+		}
+		if clock.Default.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to assume %s within %s: %w", roleARN, timeout, err)
+		}
+
+		clock.Default.Sleep(5 * time.Second)
+	}
+}
+
+// IsAccessDenied reports whether an AWS error is an authorization failure. Services disagree on the
+// code: SNS uses AuthorizationError, S3 AccessDenied and most JSON APIs AccessDeniedException.
+func IsAccessDenied(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "AccessDenied", "AccessDeniedException", "AuthorizationError", "UnauthorizedOperation":
+		return true
+	}
+	return false
+}
+
+// RolePolicyDocuments returns the parsed permission policies of a role, by policy name: the default
+// version of every attached managed policy and every inline policy
+func RolePolicyDocuments(sess *session.Session, roleName string) (map[string]*iamdoc.Policy, error) {
+	iamClient := iam.New(sess)
+	documents := map[string]*iamdoc.Policy{}
+
+	var attached []string
+	err := iamClient.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				attached = append(attached, aws.StringValue(policy.PolicyArn))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies attached to %s: %w", roleName, err)
+	}
+	for _, policyArn := range attached {
+		policy, err := iamClient.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(policyArn)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy %s: %w", policyArn, err)
+		}
+		version, err := iamClient.GetPolicyVersion(&iam.GetPolicyVersionInput{
+			PolicyArn: aws.String(policyArn),
+			VersionId: policy.Policy.DefaultVersionId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the default version of %s: %w", policyArn, err)
+		}
+		document, err := iamdoc.Parse(aws.StringValue(version.PolicyVersion.Document))
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", policyArn, err)
+		}
+		documents[aws.StringValue(policy.Policy.PolicyName)] = document
+	}
+
+	var inline []string
+	err = iamClient.ListRolePoliciesPages(&iam.ListRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListRolePoliciesOutput, lastPage bool) bool {
+			inline = append(inline, aws.StringValueSlice(page.PolicyNames)...)
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inline policies of %s: %w", roleName, err)
+	}
+	for _, name := range inline {
+		policy, err := iamClient.GetRolePolicy(&iam.GetRolePolicyInput{RoleName: aws.String(roleName), PolicyName: aws.String(name)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inline policy %s of %s: %w", name, roleName, err)
+		}
+		document, err := iamdoc.Parse(aws.StringValue(policy.PolicyDocument))
+		if err != nil {
+			return nil, fmt.Errorf("inline policy %s of %s: %w", name, roleName, err)
+		}
+		documents[name] = document
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// SupportedLambdaRuntimes maps the runtimes the response functions may use to the date Lambda
+// deprecates them. Keep it in step with the Lambda runtime deprecation schedule; a runtime missing
+// here or past its date fails AssertSupportedRuntime.
+var SupportedLambdaRuntimes = map[string]time.Time{
+	"python3.10": time.Date(2026, time.October, 31, 0, 0, 0, 0, time.UTC),
+	"python3.11": time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+	"python3.12": time.Date(2028, time.October, 31, 0, 0, 0, 0, time.UTC),
+	"python3.13": time.Date(2029, time.June, 30, 0, 0, 0, 0, time.UTC),
+}
+
+// AssertSupportedRuntime checks that the function's runtime is in SupportedLambdaRuntimes and not
+// yet deprecated
+func AssertSupportedRuntime(sess *session.Session, functionName string) error {
+	config, err := lambda.New(sess).GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+
+	runtime := aws.StringValue(config.Runtime)
+	deprecation, ok := SupportedLambdaRuntimes[runtime]
+	if !ok {
+		supported := make([]string, 0, len(SupportedLambdaRuntimes))
+		for name := range SupportedLambdaRuntimes {
+			supported = append(supported, name)
+		}
+		sort.Strings(supported)
+		return fmt.Errorf("%s uses runtime %q, which is not one of %s", functionName, runtime, strings.Join(supported, ", "))
+	}
+	if !time.Now().Before(deprecation) {
+		return fmt.Errorf("%s uses runtime %s, deprecated since %s", functionName, runtime, deprecation.Format("2006-01-02"))
+	}
+
+	return nil
+}
+
+// AssertLayersPinned checks that the function uses exactly the pinned layers, keyed by layer
+// version ARN, and that each layer's content has the pinned base64 SHA-256 from the build
+func AssertLayersPinned(sess *session.Session, functionName string, pinned map[string]string) error {
+	lambdaClient := lambda.New(sess)
+
+	config, err := lambdaClient.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+
+	var problems []string
+	attached := map[string]bool{}
+	for _, layer := range config.Layers {
+		arn := aws.StringValue(layer.Arn)
+		attached[arn] = true
+
+		want, ok := pinned[arn]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("layer %s is not pinned", arn))
+			continue
+		}
+		version, err := lambdaClient.GetLayerVersionByArn(&lambda.GetLayerVersionByArnInput{Arn: aws.String(arn)})
+		if err != nil {
+			return fmt.Errorf("failed to get layer %s: %w", arn, err)
+		}
+		if got := aws.StringValue(version.Content.CodeSha256); got != want {
+			problems = append(problems, fmt.Sprintf("layer %s has SHA-256 %s, pinned %s", arn, got, want))
+		}
+	}
+	for arn := range pinned {
+		if !attached[arn] {
+			problems = append(problems, fmt.Sprintf("pinned layer %s is not attached", arn))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("layers of %s do not match the build:\n  %s", functionName, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
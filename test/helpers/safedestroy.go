@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// TestResourceTag marks resources created by the test suite (StackOptions sets it to the run ID).
+// EmptyTestBucket refuses to touch a bucket without it.
+const TestResourceTag = "TestID"
+
+// EmptyTestBucket deletes every object version and delete marker in a test bucket so terraform
+// destroy can remove it. Legal holds are released and governance-mode retention is bypassed;
+// versions under compliance-mode retention cannot be deleted by anyone and are reported instead.
+func EmptyTestBucket(sess *session.Session, bucket string) error {
+	s3Client := s3.New(sess)
+
+	tagging, err := s3Client.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if err != nil && !isGone(err, "NoSuchTagSet") {
+		return fmt.Errorf("failed to get tags of %s: %w", bucket, err)
+	}
+	tagged := false
+	if tagging != nil {
+		for _, tag := range tagging.TagSet {
+			tagged = tagged || (aws.StringValue(tag.Key) == TestResourceTag && aws.StringValue(tag.Value) != "")
+		}
+	}
+	if !tagged {
+		return fmt.Errorf("refusing to empty %s: it is not tagged %s, so it may hold real evidence", bucket, TestResourceTag)
+	}
+
+	locked, err := objectLockEnabled(s3Client, bucket)
+	if err != nil {
+		return err
+	}
+
+	var undeletable []string
+	var pageErr error
+	err = s3Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		var objects []*s3.ObjectIdentifier
+		for _, version := range page.Versions {
+			if locked {
+				reason, lockErr := releaseObjectLock(s3Client, bucket, version)
+				if lockErr != nil {
+					pageErr = lockErr
+					return false
+				}
+				if reason != "" {
+					undeletable = append(undeletable, reason)
+					continue
+				}
+			}
+			objects = append(objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			return true
+		}
+
+		// A listing page holds at most 1000 versions and markers together, the DeleteObjects limit
+		output, deleteErr := s3Client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket:                    aws.String(bucket),
+			BypassGovernanceRetention: aws.Bool(locked),
+			Delete:                    &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if deleteErr != nil {
+			pageErr = deleteErr
+			return false
+		}
+		for _, failed := range output.Errors {
+			undeletable = append(undeletable, fmt.Sprintf("%s@%s: %s", aws.StringValue(failed.Key), aws.StringValue(failed.VersionId), aws.StringValue(failed.Message)))
+		}
+		return true
+	})
+	if err == nil {
+		err = pageErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to empty %s: %w", bucket, err)
+	}
+
+	if len(undeletable) > 0 {
+		return fmt.Errorf("%s still holds %d object versions:\n  %s", bucket, len(undeletable), strings.Join(undeletable, "\n  "))
+	}
+	return nil
+}
+
+func objectLockEnabled(s3Client *s3.S3, bucket string) (bool, error) {
+	config, err := s3Client.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		if isGone(err, "ObjectLockConfigurationNotFoundError") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get object lock configuration of %s: %w", bucket, err)
+	}
+	return config.ObjectLockConfiguration != nil &&
+		aws.StringValue(config.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled, nil
+}
+
+// releaseObjectLock turns off the legal hold on a version and returns why the version cannot be
+// deleted, which is only when compliance-mode retention has not yet expired
+func releaseObjectLock(s3Client *s3.S3, bucket string, version *s3.ObjectVersion) (string, error) {
+	hold, err := s3Client.GetObjectLegalHold(&s3.GetObjectLegalHoldInput{
+		Bucket:    aws.String(bucket),
+		Key:       version.Key,
+		VersionId: version.VersionId,
+	})
+	if err != nil && !isGone(err, "NoSuchObjectLockConfiguration") {
+		return "", fmt.Errorf("failed to get legal hold of %s: %w", aws.StringValue(version.Key), err)
+	}
+	if err == nil && aws.StringValue(hold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn {
+		if _, err := s3Client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+			Bucket:    aws.String(bucket),
+			Key:       version.Key,
+			VersionId: version.VersionId,
+			LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOff)},
+		}); err != nil {
+			return "", fmt.Errorf("failed to release legal hold of %s: %w", aws.StringValue(version.Key), err)
+		}
+	}
+
+	retention, err := s3Client.GetObjectRetention(&s3.GetObjectRetentionInput{
+		Bucket:    aws.String(bucket),
+		Key:       version.Key,
+		VersionId: version.VersionId,
+	})
+	if err != nil {
+		if isGone(err, "NoSuchObjectLockConfiguration") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get retention of %s: %w", aws.StringValue(version.Key), err)
+	}
+	until := aws.TimeValue(retention.Retention.RetainUntilDate)
+	if aws.StringValue(retention.Retention.Mode) == s3.ObjectLockRetentionModeCompliance && until.After(time.Now()) {
+		return fmt.Sprintf("%s@%s: compliance retention until %s", aws.StringValue(version.Key), aws.StringValue(version.VersionId), until.UTC().Format(time.RFC3339)), nil
+	}
+	return "", nil
+}
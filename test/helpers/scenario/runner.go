@@ -0,0 +1,440 @@
+package scenario
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/victims"
+)
+
+// Target is the deployed stack a scenario runs against
+type Target struct {
+	Session         *session.Session
+	StateMachineArn string
+	EvidenceBucket  string
+	// StateMachineRole is the state machine's IAM role name, needed only by scenarios that deny it actions
+	StateMachineRole string
+	// Victims provisions the victims findings name, needed only by scenarios that expect isolation
+	Victims *victims.Set
+}
+
+// DenyPropagation is how long a scenario waits for IAM to enforce its deny before injecting
+var DenyPropagation = 30 * time.Second
+
+// PollInterval is the delay between checks of the pipeline effects
+var PollInterval = 15 * time.Second
+
+var allEffects = Effects{Evidence: true, Execution: true, Isolation: true, Notification: true, SecurityHub: true}
+
+// Result holds the effects observed for each injected finding
+type Result struct {
+	Scenario string
+	Observed map[string]map[string]bool
+	Failures []string
+	// Injected is when the findings were injected, the start of every KPI
+	Injected time.Time
+
+	// executions holds the finished execution of each finding, for the containment and compensation checks
+	executions map[string]finishedExecution
+}
+
+// finishedExecution is an IR execution that is no longer running, with its parsed output if it succeeded
+type finishedExecution struct {
+	arn    string
+	status string
+	output *helpers.ExecutionOutput
+}
+
+// Passed reports whether every expectation held
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// String renders the result as a per-finding effect table
+func (r *Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "scenario %s:\n", r.Scenario)
+	for id, effects := range r.Observed {
+		fmt.Fprintf(&b, "  %s:", id)
+		for _, effect := range allEffects.List() {
+			fmt.Fprintf(&b, " %s=%t", effect, effects[effect])
+		}
+		b.WriteString("\n")
+	}
+	for _, failure := range r.Failures {
+		fmt.Fprintf(&b, "  FAIL %s\n", failure)
+	}
+	return b.String()
+}
+
+// Run injects the scenario's findings through the source and waits for the expected effects. Forbidden
+// effects are checked for the whole timeout, so scenarios that only carry negative expectations always take that long.
+func Run(target Target, sc *Scenario, source helpers.FindingSource, runID string) (*Result, error) {
+	result := &Result{Scenario: sc.Name, Observed: map[string]map[string]bool{}, executions: map[string]finishedExecution{}}
+
+	// Victims are provisioned before the deny and the injection, so neither waits on instances launching
+	findings := sc.BuildFindings(runID)
+	if err := provisionVictims(target, sc, findings); err != nil {
+		return nil, err
+	}
+
+	if len(sc.Deny) > 0 {
+		if target.StateMachineRole == "" {
+			return nil, fmt.Errorf("scenario %s denies %v to the state machine role, but the target does not name it", sc.Name, sc.Deny)
+		}
+		restore, err := helpers.DenyRoleActions(target.Session, target.StateMachineRole, sc.Deny...)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := restore(); err != nil {
+				result.Failures = append(result.Failures, err.Error())
+			}
+		}()
+		clock.Default.Sleep(DenyPropagation)
+	}
+
+	start := clock.Default.Now()
+	result.Injected = start
+	endInject := tracing.Step(target.Session, "inject")
+	findingIDs, err := source.Inject(findings)
+	endInject(&err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inject findings through %s: %w", source.Name(), err)
+	}
+
+	expected := sc.Expect.List()
+	deadline := start.Add(sc.Timeout)
+
+	endWait := tracing.Step(target.Session, "wait-for-effects")
+	for {
+		observed, executions, err := observe(target, findingIDs, clock.Tolerant(start))
+		if err != nil {
+			endWait(&err)
+			return nil, err
+		}
+		result.Observed = observed
+		result.executions = executions
+
+		finished := sc.Compensation == nil || len(executions) == len(findingIDs)
+		if clock.Default.Now().After(deadline) || (len(sc.ExpectNot.List()) == 0 && allObserved(observed, expected) && finished) {
+			break
+		}
+		clock.Default.Sleep(PollInterval)
+	}
+	endWait(nil)
+
+	for _, id := range findingIDs {
+		for _, effect := range expected {
+			if !result.Observed[id][effect] {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: expected %s within %s", id, effect, sc.Timeout))
+			}
+		}
+		for _, effect := range sc.ExpectNot.List() {
+			if result.Observed[id][effect] {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: unexpected %s", id, effect))
+			}
+		}
+	}
+
+	if len(sc.Containment) > 0 {
+		failures, err := checkContainment(target, result.executions, sc.Containment)
+		if err != nil {
+			return nil, err
+		}
+		result.Failures = append(result.Failures, failures...)
+	}
+
+	if sc.Compensation != nil {
+		failures, err := checkCompensation(target, result, findingIDs, *sc.Compensation)
+		if err != nil {
+			return nil, err
+		}
+		result.Failures = append(result.Failures, failures...)
+	}
+
+	return result, nil
+}
+
+// provisionVictims replaces the resource of each finding that names a victim with the victim's
+func provisionVictims(target Target, sc *Scenario, findings []helpers.GuardDutyFinding) error {
+	for i, spec := range sc.Findings {
+		if spec.Victim == "" {
+			continue
+		}
+		if target.Victims == nil {
+			return fmt.Errorf("scenario %s names victims, but the target cannot provision them", sc.Name)
+		}
+
+		switch spec.Victim {
+		case VictimInterface:
+			instance, err := target.Victims.Instance()
+			if err != nil {
+				return fmt.Errorf("failed to provision the victim of finding %d: %w", i, err)
+			}
+			resource := instance.Resource()
+			delete(resource["instanceDetails"].(map[string]interface{}), "instanceId")
+			findings[i].Resource = resource
+		}
+	}
+	return nil
+}
+
+// checkCompensation checks that each finding's execution failed in the expected state, recorded
+// exactly the expected compensation, and that what it claims to have retained or rolled back holds
+func checkCompensation(target Target, result *Result, findingIDs []string, expected Compensation) ([]string, error) {
+	var failures []string
+	for _, id := range findingIDs {
+		run, ok := result.executions[id]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: no finished execution to compensate", id))
+			continue
+		}
+		if run.status != sfn.ExecutionStatusFailed {
+			failures = append(failures, fmt.Sprintf("%s: expected %s to fail and be compensated, but the execution ended %s",
+				id, expected.FailedState, run.status))
+			continue
+		}
+
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, run.arn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get execution history: %w", err)
+		}
+		state, record, err := helpers.CompensatedState(history)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			failures = append(failures, fmt.Sprintf("%s: execution failed without a compensation record", id))
+			continue
+		}
+
+		if record.FailedState != expected.FailedState {
+			failures = append(failures, fmt.Sprintf("%s: compensated for %s, expected %s", id, record.FailedState, expected.FailedState))
+		}
+		if !sameEffects(record.Retained, expected.Retained) {
+			failures = append(failures, fmt.Sprintf("%s: retained %v, expected %v", id, record.Retained, expected.Retained))
+		}
+		if !sameEffects(record.RolledBack, expected.RolledBack) {
+			failures = append(failures, fmt.Sprintf("%s: rolled back %v, expected %v", id, record.RolledBack, expected.RolledBack))
+		}
+
+		// The record is only a claim; check it against the effects still in place
+		effects := outputEffects(state)
+		effects["evidence"] = result.Observed[id]["evidence"]
+		for _, effect := range record.Retained {
+			if !effects[effect] {
+				failures = append(failures, fmt.Sprintf("%s: %s is recorded as retained but is gone", id, effect))
+			}
+		}
+		for _, effect := range record.RolledBack {
+			if effects[effect] {
+				failures = append(failures, fmt.Sprintf("%s: %s is recorded as rolled back but is still in place", id, effect))
+			}
+		}
+	}
+	return failures, nil
+}
+
+func sameEffects(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// outputEffects returns the effects of the workflow steps recorded in an execution's state; isolation
+// means a containment branch isolated a target, not just that containment ran
+func outputEffects(output *helpers.ExecutionOutput) map[string]bool {
+	return map[string]bool{
+		"isolation":    output.Containment != nil && len(output.Containment.Isolated) > 0,
+		"notification": output.Notification != "",
+		"securityhub":  output.SecurityHub != "",
+	}
+}
+
+// checkContainment checks that each finding's execution fanned out one IsolateResource iteration per
+// expected target and aggregated exactly those targets in its output
+func checkContainment(target Target, executions map[string]finishedExecution, expected []string) ([]string, error) {
+	want := append([]string(nil), expected...)
+	sort.Strings(want)
+
+	var failures []string
+	for id, run := range executions {
+		if run.output == nil {
+			continue
+		}
+		if got := run.output.ContainedTargets(); strings.Join(got, ",") != strings.Join(want, ",") {
+			failures = append(failures, fmt.Sprintf("%s: contained %v, expected %v", id, got, want))
+		}
+
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, run.arn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get execution history: %w", err)
+		}
+		succeeded, failed := helpers.MapIterations(history, "IsolateResource")
+		if succeeded != len(want) || failed > 0 {
+			failures = append(failures, fmt.Sprintf("%s: IsolateResource ran %d iterations (%d failed), expected %d",
+				id, succeeded+failed, failed, len(want)))
+		}
+	}
+	return failures, nil
+}
+
+func allObserved(observed map[string]map[string]bool, effects []string) bool {
+	for _, findingEffects := range observed {
+		for _, effect := range effects {
+			if !findingEffects[effect] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// observe collects the current effects of each finding from the evidence bucket and the
+// executions started since the injection, along with each finding's finished execution
+func observe(target Target, findingIDs []string, since time.Time) (map[string]map[string]bool, map[string]finishedExecution, error) {
+	observed := map[string]map[string]bool{}
+	finished := map[string]finishedExecution{}
+	for _, id := range findingIDs {
+		observed[id] = map[string]bool{}
+	}
+
+	evidence, err := helpers.ListEvidenceFindingIDs(target.Session, target.EvidenceBucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	for id := range observed {
+		observed[id]["evidence"] = evidence[id]
+	}
+
+	executions, err := recentExecutions(target, since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sfnClient := sfn.New(target.Session)
+	for _, execution := range executions {
+		described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+			ExecutionArn: execution.ExecutionArn,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to describe execution: %w", err)
+		}
+
+		input, err := helpers.ParseExecutionInput(aws.StringValue(described.Input))
+		if err != nil {
+			continue
+		}
+		effects, ok := observed[input.Detail.ID]
+		if !ok {
+			continue
+		}
+		// Only the execution triage started counts; EventBridge also starts one directly for each finding
+		if !strings.HasPrefix(aws.StringValue(described.Name), helpers.TriageExecutionPrefix(input.Detail.ID)) {
+			continue
+		}
+		effects["execution"] = true
+
+		status := aws.StringValue(described.Status)
+		if status == sfn.ExecutionStatusRunning {
+			continue
+		}
+		run := finishedExecution{arn: aws.StringValue(described.ExecutionArn), status: status}
+		finished[input.Detail.ID] = run
+		if status != sfn.ExecutionStatusSucceeded {
+			continue
+		}
+		output, err := helpers.ParseExecutionOutput(aws.StringValue(described.Output))
+		if err != nil {
+			continue
+		}
+		for effect, present := range outputEffects(output) {
+			effects[effect] = present
+		}
+		run.output = output
+		finished[input.Detail.ID] = run
+	}
+
+	return observed, finished, nil
+}
+
+// recentExecutions lists executions started after since; the listing is newest first, so it stops at the first older one
+func recentExecutions(target Target, since time.Time) ([]*sfn.ExecutionListItem, error) {
+	executions, err := helpers.ListExecutions(target.Session, target.StateMachineArn, "", helpers.PageOptions{MaxPages: 10})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, execution := range executions {
+		if aws.TimeValue(execution.StartDate).Before(since) {
+			return executions[:i], nil
+		}
+	}
+
+	return executions, nil
+}
+
+// ExecutionARNs returns the finished IR execution of each finding that has one
+func (r *Result) ExecutionARNs() map[string]string {
+	arns := map[string]string{}
+	for id, run := range r.executions {
+		arns[id] = run.arn
+	}
+	return arns
+}
+
+// Effects returns, per effect, whether every injected finding showed it
+func (r *Result) Effects() map[string]bool {
+	effects := map[string]bool{}
+	for _, effect := range allEffects.List() {
+		effects[effect] = len(r.Observed) > 0
+		for _, observed := range r.Observed {
+			if !observed[effect] {
+				effects[effect] = false
+				break
+			}
+		}
+	}
+	return effects
+}
+
+// CompareSources checks that the same scenario produced the same effects through every ingestion path
+func CompareSources(results map[string]*Result) error {
+	var baseline string
+	for source := range results {
+		if baseline == "" || source < baseline {
+			baseline = source
+		}
+	}
+
+	var differences []string
+	for source, result := range results {
+		if source == baseline {
+			continue
+		}
+		expected := results[baseline].Effects()
+		for effect, observed := range result.Effects() {
+			if observed != expected[effect] {
+				differences = append(differences, fmt.Sprintf("%s: %s=%t but %s=%t", effect, source, observed, baseline, expected[effect]))
+			}
+		}
+	}
+
+	if len(differences) > 0 {
+		sort.Strings(differences)
+		return fmt.Errorf("ingestion paths were not handled equivalently: %s", strings.Join(differences, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// Scenario is one IR case loaded from YAML: the findings to inject, the ingestion paths to inject
+// them through (sources, see helpers.NewFindingSource) and the pipeline effects that must (expect)
+// or must not (expect_not) follow within the timeout. Containment lists the "kind:identifier" targets
+// the workflow must contain for each finding, one IsolateResource Map iteration per target. Deny lists
+// IAM actions denied to the state machine role while the scenario runs, to fail a later step, and
+// Compensation what the workflow must then keep and undo. The workflow resolves a finding in Security
+// Hub only once it isolated something, so a scenario expecting isolation or the Security Hub update
+// must name a victim for every finding; fictitious resources are never contained.
+type Scenario struct {
+	Name         string        `yaml:"name"`
+	Description  string        `yaml:"description"`
+	Timeout      time.Duration `yaml:"timeout"`
+	Sources      []string      `yaml:"sources"`
+	Findings     []FindingSpec `yaml:"findings"`
+	Expect       Effects       `yaml:"expect"`
+	ExpectNot    Effects       `yaml:"expect_not"`
+	Containment  []string      `yaml:"containment"`
+	Deny         []string      `yaml:"deny"`
+	Compensation *Compensation `yaml:"compensation"`
+
+	// Path is the file the scenario was loaded from
+	Path string `yaml:"-"`
+}
+
+// Compensation is the expected outcome of a step failing after earlier steps took effect: the step
+// that failed, and which effects the workflow keeps on purpose and which it undoes. The workflow's
+// compensation record must list exactly these effects.
+type Compensation struct {
+	FailedState string   `yaml:"failed_state"`
+	Retained    []string `yaml:"retained"`
+	RolledBack  []string `yaml:"rolled_back"`
+}
+
+// FindingSpec is a finding to inject, either a named sample from helpers.SampleGuardDutyEvents
+// with optional overrides or a fully specified finding. Victim replaces the resource with a real one
+// the run provisions, see Victims.
+type FindingSpec struct {
+	Sample   string                 `yaml:"sample"`
+	ID       string                 `yaml:"id"`
+	Type     string                 `yaml:"type"`
+	Severity float64                `yaml:"severity"`
+	Resource map[string]interface{} `yaml:"resource"`
+	Details  map[string]interface{} `yaml:"details"`
+	ARN      string                 `yaml:"arn"`
+	Victim   string                 `yaml:"victim"`
+}
+
+// VictimInterface is the network interface of a victim instance, named without its instance so the
+// interface is the finding's only target and isolating it contains the finding
+const VictimInterface = "interface"
+
+// Victims are the victim kinds a finding can name
+var Victims = map[string]bool{
+	VictimInterface: true,
+}
+
+// Effects are the observable results of the IR pipeline for a finding
+type Effects struct {
+	Evidence     bool `yaml:"evidence"`
+	Execution    bool `yaml:"execution"`
+	Isolation    bool `yaml:"isolation"`
+	Notification bool `yaml:"notification"`
+	SecurityHub  bool `yaml:"securityhub"`
+}
+
+// List returns the names of the selected effects in pipeline order
+func (e Effects) List() []string {
+	var effects []string
+	for _, effect := range []struct {
+		name     string
+		selected bool
+	}{
+		{"evidence", e.Evidence},
+		{"execution", e.Execution},
+		{"isolation", e.Isolation},
+		{"notification", e.Notification},
+		{"securityhub", e.SecurityHub},
+	} {
+		if effect.selected {
+			effects = append(effects, effect.name)
+		}
+	}
+	return effects
+}
+
+// DefaultTimeout applies to scenarios that do not set one
+const DefaultTimeout = 5 * time.Minute
+
+// Load reads and validates a scenario file
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	var sc Scenario
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", path, err)
+	}
+	sc.Path = path
+
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if sc.Timeout == 0 {
+		sc.Timeout = DefaultTimeout
+	}
+	if len(sc.Sources) == 0 {
+		sc.Sources = []string{helpers.SourceEventBridge}
+	}
+
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+
+	return &sc, nil
+}
+
+// LoadDir loads every *.yaml and *.yml scenario in a directory, sorted by file name
+func LoadDir(dir string) ([]*Scenario, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	var scenarios []*Scenario
+	for _, path := range paths {
+		sc, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, sc)
+	}
+
+	return scenarios, nil
+}
+
+// Validate checks that the scenario injects something and does not both expect and forbid an effect
+func (s *Scenario) Validate() error {
+	if len(s.Findings) == 0 && !s.sourcesIgnoreFindings() {
+		return fmt.Errorf("no findings to inject")
+	}
+
+	for i, spec := range s.Findings {
+		if spec.Sample == "" && (spec.ID == "" || spec.Type == "") {
+			return fmt.Errorf("finding %d needs either a sample or an id and type", i)
+		}
+		if spec.Sample != "" {
+			if _, ok := helpers.SampleGuardDutyEvents[spec.Sample]; !ok {
+				return fmt.Errorf("finding %d: unknown sample %q", i, spec.Sample)
+			}
+		}
+		if spec.Victim != "" && !Victims[spec.Victim] {
+			return fmt.Errorf("finding %d: unknown victim %q", i, spec.Victim)
+		}
+		if spec.Victim == "" && (s.Expect.Isolation || s.Expect.SecurityHub) && !s.sourcesIgnoreFindings() {
+			return fmt.Errorf("finding %d names no victim, so nothing can be isolated and the finding is never resolved", i)
+		}
+	}
+
+	if s.Expect.SecurityHub && !s.Expect.Isolation {
+		return fmt.Errorf("the Security Hub update is only expected along with isolation: findings that were not isolated are left open")
+	}
+	if len(s.Containment) > 0 && !s.Expect.Execution {
+		return fmt.Errorf("containment targets are only checked when an execution is expected")
+	}
+	if s.Compensation != nil {
+		if s.Compensation.FailedState == "" {
+			return fmt.Errorf("compensation needs the failed_state it follows")
+		}
+		known := map[string]bool{}
+		for _, effect := range allEffects.List() {
+			known[effect] = true
+		}
+		for _, effect := range append(append([]string(nil), s.Compensation.Retained...), s.Compensation.RolledBack...) {
+			if !known[effect] {
+				return fmt.Errorf("compensation names unknown effect %q", effect)
+			}
+		}
+	}
+
+	forbidden := map[string]bool{}
+	for _, effect := range s.ExpectNot.List() {
+		forbidden[effect] = true
+	}
+	for _, effect := range s.Expect.List() {
+		if forbidden[effect] {
+			return fmt.Errorf("effect %q is both expected and forbidden", effect)
+		}
+	}
+
+	return nil
+}
+
+// sourcesIgnoreFindings reports whether every source brings its own findings, e.g. replay or stratus
+func (s *Scenario) sourcesIgnoreFindings() bool {
+	for _, source := range s.Sources {
+		if !helpers.SourceIgnoresFindings(source) {
+			return false
+		}
+	}
+	return true
+}
+
+// BuildFindings resolves the finding specs into findings whose IDs are unique to the run
+func (s *Scenario) BuildFindings(runID string) []helpers.GuardDutyFinding {
+	findings := make([]helpers.GuardDutyFinding, 0, len(s.Findings))
+
+	for i, spec := range s.Findings {
+		var finding helpers.GuardDutyFinding
+		if spec.Sample != "" {
+			finding = helpers.SampleGuardDutyEvents[spec.Sample]
+		}
+
+		if spec.ID != "" {
+			finding.ID = spec.ID
+		}
+		if spec.Type != "" {
+			finding.Type = spec.Type
+		}
+		if spec.Severity != 0 {
+			finding.Severity = spec.Severity
+		}
+		if spec.Resource != nil {
+			finding.Resource = spec.Resource
+		}
+		if spec.Details != nil {
+			finding.Details = spec.Details
+		}
+		if spec.ARN != "" {
+			finding.ARN = spec.ARN
+		}
+
+		finding.ID = fmt.Sprintf("%s-%s-%d-%s", s.Name, finding.ID, i, runID)
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
@@ -0,0 +1,183 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// minSecretMaterialLength keeps short JSON field values such as "true" or a region name from being
+// treated as secret material
+const minSecretMaterialLength = 8
+
+// AssertIntegrationSecrets checks that every integration secret exists, is encrypted with the IR KMS
+// key and has rotation configured. secretARNs is keyed by integration, as in integration_secret_arns.
+func AssertIntegrationSecrets(sess *session.Session, secretARNs map[string]string, kmsKeyARN string) error {
+	smClient := secretsmanager.New(sess)
+
+	wantKey, err := resolveKeyARN(sess, kmsKeyARN)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, name := range sortedSecretNames(secretARNs) {
+		secret, err := smClient.DescribeSecret(&secretsmanager.DescribeSecretInput{
+			SecretId: aws.String(secretARNs[name]),
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if secret.DeletedDate != nil {
+			problems = append(problems, fmt.Sprintf("%s: secret is scheduled for deletion", name))
+		}
+
+		// Secrets without a key are encrypted with the AWS managed aws/secretsmanager key
+		if secret.KmsKeyId == nil {
+			problems = append(problems, fmt.Sprintf("%s: encrypted with the AWS managed key, not the IR key", name))
+		} else if gotKey, err := resolveKeyARN(sess, aws.StringValue(secret.KmsKeyId)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		} else if gotKey != wantKey {
+			problems = append(problems, fmt.Sprintf("%s: encrypted with %s, not the IR key %s", name, gotKey, wantKey))
+		}
+
+		if !aws.BoolValue(secret.RotationEnabled) || secret.RotationRules == nil {
+			problems = append(problems, fmt.Sprintf("%s: rotation is not configured", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("integration secrets are not compliant:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// SecretMaterial fetches the integration secrets and returns, per integration, the strings that must
+// never appear outside Secrets Manager: the secret string and, for JSON secrets, every string field
+func SecretMaterial(sess *session.Session, secretARNs map[string]string) (map[string][]string, error) {
+	smClient := secretsmanager.New(sess)
+
+	material := make(map[string][]string, len(secretARNs))
+	for name, arn := range secretARNs {
+		value, err := smClient.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(arn)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read integration secret %s: %w", name, err)
+		}
+
+		secretString := aws.StringValue(value.SecretString)
+		material[name] = append(material[name], secretString)
+
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(secretString), &fields) == nil {
+			for _, field := range fields {
+				if s, ok := field.(string); ok && len(s) >= minSecretMaterialLength {
+					material[name] = append(material[name], s)
+				}
+			}
+		}
+	}
+
+	return material, nil
+}
+
+// AssertSecretsNotInLambdaEnvironment checks that no secret material is set in the function's
+// environment variables. Failures name the variable and integration, never the material.
+func AssertSecretsNotInLambdaEnvironment(sess *session.Session, functionName string, material map[string][]string) error {
+	config, err := lambda.New(sess).GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of %s: %w", functionName, err)
+	}
+	if config.Environment == nil {
+		return nil
+	}
+
+	for variable, value := range config.Environment.Variables {
+		if name, leaked := containsSecret(aws.StringValue(value), material); leaked {
+			return fmt.Errorf("environment variable %s of %s contains the %s secret", variable, functionName, name)
+		}
+	}
+
+	return nil
+}
+
+// CreateTestSecret creates a secret encrypted with the key and, when rotationLambdaARN is set,
+// schedules monthly rotation through that function without rotating right away
+func CreateTestSecret(sess *session.Session, name, value, kmsKeyARN, rotationLambdaARN string) (string, error) {
+	smClient := secretsmanager.New(sess)
+
+	secret, err := smClient.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+		KmsKeyId:     aws.String(kmsKeyARN),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret %s: %w", name, err)
+	}
+	arn := aws.StringValue(secret.ARN)
+
+	if rotationLambdaARN == "" {
+		return arn, nil
+	}
+	if _, err := smClient.RotateSecret(&secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(arn),
+		RotationLambdaARN: aws.String(rotationLambdaARN),
+		RotationRules:     &secretsmanager.RotationRulesType{AutomaticallyAfterDays: aws.Int64(30)},
+		RotateImmediately: aws.Bool(false),
+	}); err != nil {
+		return arn, fmt.Errorf("failed to configure rotation of %s: %w", name, err)
+	}
+
+	return arn, nil
+}
+
+// DeleteTestSecret deletes a secret without the recovery window
+func DeleteTestSecret(sess *session.Session, arn string) error {
+	if _, err := secretsmanager.New(sess).DeleteSecret(&secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(arn),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", arn, err)
+	}
+	return nil
+}
+
+// containsSecret reports which integration's material, if any, appears in s
+func containsSecret(s string, material map[string][]string) (string, bool) {
+	for name, values := range material {
+		for _, value := range values {
+			if value != "" && strings.Contains(s, value) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolveKeyARN turns a key ID, alias or ARN into the key's ARN so they can be compared
+func resolveKeyARN(sess *session.Session, keyID string) (string, error) {
+	key, err := kms.New(sess).DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe KMS key %s: %w", keyID, err)
+	}
+	return aws.StringValue(key.KeyMetadata.Arn), nil
+}
+
+func sortedSecretNames(secretARNs map[string]string) []string {
+	names := make([]string, 0, len(secretARNs))
+	for name := range secretARNs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/asff"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/severity"
+)
+
+// ToASFF converts a GuardDuty-style finding into the ASFF finding a custom detector would import,
+// using the account's default Security Hub product
+func ToASFF(account, region string, finding GuardDutyFinding) asff.Finding {
+	partition := PartitionFor(region)
+	now := time.Now().UTC().Format(time.RFC3339)
+	normalized := severity.FromGuardDuty(finding.Severity).Normalized()
+
+	resource := asff.Resource{Type: "Other", Id: finding.ID}
+	if details, ok := finding.Resource["instanceDetails"].(map[string]interface{}); ok {
+		if instanceID, ok := details["instanceId"].(string); ok {
+			resource = asff.Resource{
+				Type:   "AwsEc2Instance",
+				Id:     partition.ARN("ec2", region, account, "instance/"+instanceID),
+				Region: region,
+			}
+		}
+	}
+
+	return asff.Finding{
+		SchemaVersion: asff.SchemaVersion,
+		Id:            finding.ID,
+		ProductArn:    partition.Scope(region, account).DefaultProduct(),
+		GeneratorId:   "threat-detection-ir-test",
+		AwsAccountId:  account,
+		Types:         []string{"TTPs/" + finding.Type},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Severity:      asff.Severity{Label: asff.LabelForNormalized(normalized), Normalized: normalized},
+		Title:         finding.Type,
+		Description:   fmt.Sprintf("Test finding %s injected by the IR test suite", finding.ID),
+		Resources:     []asff.Resource{resource},
+	}
+}
+
+// FromASFF maps an ASFF finding onto the GuardDuty shape the same way the triage Lambda does
+func FromASFF(finding asff.Finding) GuardDutyFinding {
+	findingType := "Unknown"
+	if len(finding.Types) > 0 {
+		findingType = strings.TrimPrefix(finding.Types[0], "TTPs/")
+	}
+
+	resource := map[string]interface{}{}
+	if len(finding.Resources) > 0 {
+		first := finding.Resources[0]
+		if first.Type == "AwsEc2Instance" || strings.HasPrefix(first.Id, "i-") {
+			parts := strings.Split(first.Id, "/")
+			resource = map[string]interface{}{
+				"resourceType":    "Instance",
+				"instanceDetails": map[string]interface{}{"instanceId": parts[len(parts)-1]},
+			}
+		} else {
+			resource = map[string]interface{}{"resourceType": first.Type, "resourceId": first.Id}
+		}
+	}
+
+	return GuardDutyFinding{
+		ID:        finding.Id,
+		Severity:  severity.FromNormalized(finding.Severity.Normalized).Float(),
+		Type:      findingType,
+		Resource:  resource,
+		AccountID: finding.AwsAccountId,
+	}
+}
+
+// NewCustomFinding builds the validated Security Hub API finding for a GuardDuty-style finding
+func NewCustomFinding(account, region string, finding GuardDutyFinding) (*securityhub.AwsSecurityFinding, error) {
+	custom := ToASFF(account, region, finding)
+	if err := custom.Validate(); err != nil {
+		return nil, err
+	}
+
+	return custom.ToSDK()
+}
+
+// ImportCustomFindings imports ASFF findings through BatchImportFindings, batching to the API limit,
+// and returns their IDs
+func ImportCustomFindings(sess *session.Session, findings []*securityhub.AwsSecurityFinding) ([]string, error) {
+	securityhubClient := securityhub.New(sess)
+
+	var ids []string
+	for start := 0; start < len(findings); start += 100 {
+		end := start + 100
+		if end > len(findings) {
+			end = len(findings)
+		}
+
+		output, err := securityhubClient.BatchImportFindings(&securityhub.BatchImportFindingsInput{
+			Findings: findings[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to import findings: %w", err)
+		}
+		if aws.Int64Value(output.FailedCount) > 0 {
+			reason := ""
+			if len(output.FailedFindings) > 0 {
+				reason = ": " + aws.StringValue(output.FailedFindings[0].ErrorMessage)
+			}
+			return nil, fmt.Errorf("%d of %d findings were rejected by Security Hub%s", aws.Int64Value(output.FailedCount), end-start, reason)
+		}
+
+		for _, finding := range findings[start:end] {
+			ids = append(ids, aws.StringValue(finding.Id))
+		}
+	}
+
+	return ids, nil
+}
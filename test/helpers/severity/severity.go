@@ -0,0 +1,150 @@
+// Package severity puts the three ways the pipeline expresses severity on one scale: GuardDuty's
+// 0-10 scores, Security Hub's 0-100 normalized scores, and the LOW/MEDIUM/HIGH/CRITICAL labels the
+// EventBridge threshold, triage routing and notification filters use. The bounds are the ones the
+// eventbridge module and the triage Lambda apply, so tests and tools compare severities the way the
+// pipeline does instead of with their own float comparisons.
+package severity
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Label is a severity label. Labels are ordered, so they compare with < and >=.
+type Label int
+
+// Labels in ascending order. Only Security Hub uses Informational, for a normalized score of 0.
+const (
+	Informational Label = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var labelNames = []string{"INFORMATIONAL", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// thresholds are the lowest GuardDuty scores of each label, as in the eventbridge module
+var thresholds = []Score{0, 1, 4, 7, 9}
+
+// Labels returns the labels a finding severity threshold can be set to, in ascending order
+func Labels() []Label {
+	return []Label{Low, Medium, High, Critical}
+}
+
+// String returns the label as the pipeline spells it, e.g. "HIGH"
+func (l Label) String() string {
+	if l < Informational || l > Critical {
+		return fmt.Sprintf("Label(%d)", int(l))
+	}
+	return labelNames[l]
+}
+
+// Threshold returns the lowest score with the label
+func (l Label) Threshold() Score {
+	if l < Informational {
+		return thresholds[Informational]
+	}
+	if l > Critical {
+		return thresholds[Critical]
+	}
+	return thresholds[l]
+}
+
+// ParseLabel parses a label in any case
+func ParseLabel(name string) (Label, error) {
+	for i, known := range labelNames {
+		if strings.EqualFold(name, known) {
+			return Label(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity label %q, expected one of %s", name, strings.Join(labelNames, ", "))
+}
+
+// Score is a severity on GuardDuty's 0-10 scale
+type Score float64
+
+// FromGuardDuty returns the score of a GuardDuty severity
+func FromGuardDuty(severity float64) Score {
+	return Score(severity)
+}
+
+// FromNormalized returns the score of a Security Hub 0-100 normalized severity, the way triage
+// normalizes custom findings
+func FromNormalized(normalized int64) Score {
+	return Score(float64(normalized) / 10)
+}
+
+// Parse reads a severity given either as a GuardDuty score, e.g. "7.5", or as a label, which stands
+// for the label's threshold, e.g. "HIGH" for 7
+func Parse(value string) (Score, error) {
+	if score, err := strconv.ParseFloat(value, 64); err == nil {
+		if score < 0 || score > 10 {
+			return 0, fmt.Errorf("severity %s is outside GuardDuty's 0-10 scale", value)
+		}
+		return Score(score), nil
+	}
+	label, err := ParseLabel(value)
+	if err != nil {
+		return 0, fmt.Errorf("severity %q is neither a 0-10 score nor a label", value)
+	}
+	return label.Threshold(), nil
+}
+
+// Float returns the score as GuardDuty reports it
+func (s Score) Float() float64 {
+	return float64(s)
+}
+
+// Normalized returns the score on Security Hub's 0-100 scale
+func (s Score) Normalized() int64 {
+	return int64(math.Round(float64(s) * 10))
+}
+
+// Label returns the label triage routes the score by. GuardDuty scores below LOW's threshold are
+// still LOW; GuardDuty has no informational findings.
+func (s Score) Label() Label {
+	for label := Critical; label > Low; label-- {
+		if s >= label.Threshold() {
+			return label
+		}
+	}
+	return Low
+}
+
+// SecurityHubLabel returns the label Security Hub gives the score's normalized severity, which is
+// Informational for 0
+func (s Score) SecurityHubLabel() Label {
+	if s.Normalized() == 0 {
+		return Informational
+	}
+	return s.Label()
+}
+
+// AtLeast reports whether the score passes a finding severity threshold set to the label
+func (s Score) AtLeast(threshold Label) bool {
+	return s >= threshold.Threshold()
+}
+
+// Between reports whether the score lies within min and max, inclusive
+func (s Score) Between(min, max Score) bool {
+	return s >= min && s <= max
+}
+
+// Compare returns -1, 0 or 1 as a is less severe than, as severe as, or more severe than b
+func Compare(a, b Score) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// String formats the score with one decimal, as GuardDuty shows it
+func (s Score) String() string {
+	return strconv.FormatFloat(float64(s), 'f', 1, 64)
+}
@@ -0,0 +1,177 @@
+package severity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreLabel(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  Label
+	}{
+		{0, Low},
+		{0.9, Low},
+		{1, Low},
+		{3.9, Low},
+		{4, Medium},
+		{6.9, Medium},
+		{7, High},
+		{8.9, High},
+		{9, Critical},
+		{10, Critical},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, FromGuardDuty(test.score).Label(), "score %v", test.score)
+	}
+}
+
+func TestNormalizedLabel(t *testing.T) {
+	tests := []struct {
+		normalized  int64
+		want        Label
+		securityHub Label
+	}{
+		{0, Low, Informational},
+		{1, Low, Low},
+		{39, Low, Low},
+		{40, Medium, Medium},
+		{69, Medium, Medium},
+		{70, High, High},
+		{89, High, High},
+		{90, Critical, Critical},
+		{100, Critical, Critical},
+	}
+	for _, test := range tests {
+		score := FromNormalized(test.normalized)
+		assert.Equal(t, test.want, score.Label(), "normalized %d", test.normalized)
+		assert.Equal(t, test.securityHub, score.SecurityHubLabel(), "normalized %d", test.normalized)
+		assert.Equal(t, test.normalized, score.Normalized(), "normalized %d round trip", test.normalized)
+	}
+}
+
+func TestLabelThreshold(t *testing.T) {
+	tests := []struct {
+		label Label
+		want  Score
+	}{
+		{Informational, 0},
+		{Low, 1},
+		{Medium, 4},
+		{High, 7},
+		{Critical, 9},
+		// Out of range labels clamp to the nearest threshold
+		{Label(-1), 0},
+		{Label(9), 9},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.label.Threshold(), "label %s", test.label)
+	}
+}
+
+func TestParseLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Label
+		wantErr bool
+	}{
+		{name: "HIGH", want: High},
+		{name: "critical", want: Critical},
+		{name: "Informational", want: Informational},
+		{name: "SEVERE", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, test := range tests {
+		label, err := ParseLabel(test.name)
+		if test.wantErr {
+			assert.Error(t, err, "label %q", test.name)
+			continue
+		}
+		require.NoError(t, err, "label %q", test.name)
+		assert.Equal(t, test.want, label, "label %q", test.name)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Score
+		wantErr bool
+	}{
+		{value: "7.5", want: 7.5},
+		{value: "0", want: 0},
+		{value: "10", want: 10},
+		{value: "HIGH", want: 7},
+		{value: "medium", want: 4},
+		{value: "10.1", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "urgent", wantErr: true},
+	}
+	for _, test := range tests {
+		score, err := Parse(test.value)
+		if test.wantErr {
+			assert.Error(t, err, "value %q", test.value)
+			continue
+		}
+		require.NoError(t, err, "value %q", test.value)
+		assert.Equal(t, test.want, score, "value %q", test.value)
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		score     Score
+		threshold Label
+		want      bool
+	}{
+		{6.9, High, false},
+		{7, High, true},
+		{8.9, Critical, false},
+		{9, Critical, true},
+		{3.9, Medium, false},
+		{4, Medium, true},
+		{1, Low, true},
+		{0.5, Low, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.score.AtLeast(test.threshold), "%s at least %s", test.score, test.threshold)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		score, min, max Score
+		want            bool
+	}{
+		{7, 7, 8.9, true},
+		{8.9, 7, 8.9, true},
+		{6.9, 7, 8.9, false},
+		{9, 7, 8.9, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.score.Between(test.min, test.max), "%s between %s and %s", test.score, test.min, test.max)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b Score
+		want int
+	}{
+		{7, 9, -1},
+		{9, 7, 1},
+		{7, 7, 0},
+		{FromNormalized(70), FromGuardDuty(7), 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, Compare(test.a, test.b), "compare %s and %s", test.a, test.b)
+	}
+}
+
+func TestLabelString(t *testing.T) {
+	assert.Equal(t, "CRITICAL", Critical.String())
+	assert.Equal(t, "Label(7)", Label(7).String())
+	assert.Equal(t, "7.5", Score(7.5).String())
+}
@@ -0,0 +1,365 @@
+// Package sgmodel models security group rules and memberships in a normalized, comparable form.
+// EC2 reports the same rule in several shapes (protocol "-1" or "6", ports -1 for all traffic,
+// one permission with several targets), so assertions compare normalized rules and group sets and
+// report the difference, instead of inspecting the API's slices by hand.
+package sgmodel
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Protocols as rules name them after normalization
+const (
+	ProtocolAll    = "all"
+	ProtocolTCP    = "tcp"
+	ProtocolUDP    = "udp"
+	ProtocolICMP   = "icmp"
+	ProtocolICMPv6 = "icmpv6"
+)
+
+// MaxPort is the last port of a TCP or UDP range
+const MaxPort = 65535
+
+// protocolNames maps the protocol numbers EC2 may report to their names
+var protocolNames = map[string]string{"-1": ProtocolAll, "6": ProtocolTCP, "17": ProtocolUDP, "1": ProtocolICMP, "58": ProtocolICMPv6}
+
+// Kinds of rule target
+const (
+	TargetIPv4       = "ipv4"
+	TargetIPv6       = "ipv6"
+	TargetPrefixList = "prefix-list"
+	TargetGroup      = "group"
+)
+
+// Rule is one security group rule for one target. Rules are compared after Normalize.
+type Rule struct {
+	Egress   bool
+	Protocol string
+	// FromPort and ToPort are the port range for TCP and UDP, the ICMP type and code for ICMP, and
+	// 0-65535 for all protocols
+	FromPort int64
+	ToPort   int64
+	// Target is the CIDR, prefix list ID or referenced security group ID
+	Target string
+}
+
+// TCP returns an ingress or egress TCP rule for a port range
+func TCP(egress bool, fromPort, toPort int64, target string) Rule {
+	return Rule{Egress: egress, Protocol: ProtocolTCP, FromPort: fromPort, ToPort: toPort, Target: target}.Normalize()
+}
+
+// AllTraffic returns an ingress or egress rule for every protocol and port
+func AllTraffic(egress bool, target string) Rule {
+	return Rule{Egress: egress, Protocol: ProtocolAll, Target: target}.Normalize()
+}
+
+// Normalize returns the rule in its comparable form: protocol numbers become names, all-traffic
+// rules span every port, and CIDRs are written in canonical form with their host bits cleared
+func (r Rule) Normalize() Rule {
+	protocol := strings.ToLower(r.Protocol)
+	if name, ok := protocolNames[protocol]; ok {
+		protocol = name
+	}
+	r.Protocol = protocol
+
+	switch r.Protocol {
+	case ProtocolAll:
+		r.FromPort, r.ToPort = 0, MaxPort
+	case ProtocolTCP, ProtocolUDP:
+		if r.FromPort == -1 && r.ToPort == -1 {
+			r.FromPort, r.ToPort = 0, MaxPort
+		}
+	}
+
+	if _, network, err := net.ParseCIDR(r.Target); err == nil {
+		r.Target = network.String()
+	}
+	return r
+}
+
+// TargetKind returns what the rule's target is
+func (r Rule) TargetKind() string {
+	switch {
+	case strings.HasPrefix(r.Target, "sg-"):
+		return TargetGroup
+	case strings.HasPrefix(r.Target, "pl-"):
+		return TargetPrefixList
+	case strings.Contains(r.Target, ":"):
+		return TargetIPv6
+	default:
+		return TargetIPv4
+	}
+}
+
+// IPv6 reports whether the rule's target is an IPv6 CIDR, e.g. ::/0
+func (r Rule) IPv6() bool {
+	return r.TargetKind() == TargetIPv6
+}
+
+// Covers reports whether the rule allows at least everything the other rule allows: the same
+// direction and target, and all protocols or the same protocol with a range holding the other's
+func (r Rule) Covers(other Rule) bool {
+	r, other = r.Normalize(), other.Normalize()
+	if r.Egress != other.Egress || r.Target != other.Target {
+		return false
+	}
+	if r.Protocol == ProtocolAll {
+		return true
+	}
+	if r.Protocol != other.Protocol {
+		return false
+	}
+	if (r.Protocol == ProtocolICMP || r.Protocol == ProtocolICMPv6) && r.FromPort == -1 {
+		return true
+	}
+	return r.FromPort <= other.FromPort && other.ToPort <= r.ToPort
+}
+
+// String renders the rule as "egress tcp 443 sg-0abc", "ingress tcp 1024-65535 10.0.0.0/8" or
+// "egress all 0.0.0.0/0"
+func (r Rule) String() string {
+	direction := "ingress"
+	if r.Egress {
+		direction = "egress"
+	}
+	switch {
+	case r.Protocol == ProtocolAll:
+		return fmt.Sprintf("%s %s %s", direction, r.Protocol, r.Target)
+	case r.FromPort == r.ToPort:
+		return fmt.Sprintf("%s %s %d %s", direction, r.Protocol, r.FromPort, r.Target)
+	default:
+		return fmt.Sprintf("%s %s %d-%d %s", direction, r.Protocol, r.FromPort, r.ToPort, r.Target)
+	}
+}
+
+// FromEC2 converts a rule as DescribeSecurityGroupRules returns it
+func FromEC2(rule *ec2.SecurityGroupRule) Rule {
+	target := aws.StringValue(rule.CidrIpv4)
+	switch {
+	case rule.CidrIpv6 != nil:
+		target = aws.StringValue(rule.CidrIpv6)
+	case rule.PrefixListId != nil:
+		target = aws.StringValue(rule.PrefixListId)
+	case rule.ReferencedGroupInfo != nil:
+		target = aws.StringValue(rule.ReferencedGroupInfo.GroupId)
+	}
+
+	return Rule{
+		Egress:   aws.BoolValue(rule.IsEgress),
+		Protocol: aws.StringValue(rule.IpProtocol),
+		FromPort: aws.Int64Value(rule.FromPort),
+		ToPort:   aws.Int64Value(rule.ToPort),
+		Target:   target,
+	}.Normalize()
+}
+
+// FromPermissions converts the permissions of a security group as DescribeSecurityGroups returns
+// them, one rule per target
+func FromPermissions(egress bool, permissions []*ec2.IpPermission) []Rule {
+	var rules []Rule
+	for _, permission := range permissions {
+		var targets []string
+		for _, block := range permission.IpRanges {
+			targets = append(targets, aws.StringValue(block.CidrIp))
+		}
+		for _, block := range permission.Ipv6Ranges {
+			targets = append(targets, aws.StringValue(block.CidrIpv6))
+		}
+		for _, list := range permission.PrefixListIds {
+			targets = append(targets, aws.StringValue(list.PrefixListId))
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			targets = append(targets, aws.StringValue(pair.GroupId))
+		}
+
+		for _, target := range targets {
+			rules = append(rules, Rule{
+				Egress:   egress,
+				Protocol: aws.StringValue(permission.IpProtocol),
+				FromPort: aws.Int64Value(permission.FromPort),
+				ToPort:   aws.Int64Value(permission.ToPort),
+				Target:   target,
+			}.Normalize())
+		}
+	}
+	return rules
+}
+
+// Describe returns the normalized rules of a security group
+func Describe(sess *session.Session, sgID string) ([]Rule, error) {
+	var rules []Rule
+
+	err := ec2.New(sess).DescribeSecurityGroupRulesPages(&ec2.DescribeSecurityGroupRulesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("group-id"), Values: []*string{aws.String(sgID)}},
+		},
+	}, func(page *ec2.DescribeSecurityGroupRulesOutput, lastPage bool) bool {
+		for _, rule := range page.SecurityGroupRules {
+			rules = append(rules, FromEC2(rule))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe rules of %s: %w", sgID, err)
+	}
+
+	return rules, nil
+}
+
+// Diff is the difference between an expected and an actual rule set
+type Diff struct {
+	// Missing are expected rules the group lacks
+	Missing []Rule
+	// Unexpected are rules the group has beyond the expected ones
+	Unexpected []Rule
+}
+
+// DiffRules compares rule sets as multisets of normalized rules. A wider rule than expected, e.g.
+// all protocols or TCP 0-65535 instead of TCP 443, counts as both missing and unexpected.
+func DiffRules(expected, actual []Rule) Diff {
+	remaining := map[Rule]int{}
+	for _, rule := range actual {
+		remaining[rule.Normalize()]++
+	}
+
+	var diff Diff
+	for _, rule := range expected {
+		rule = rule.Normalize()
+		if remaining[rule] > 0 {
+			remaining[rule]--
+		} else {
+			diff.Missing = append(diff.Missing, rule)
+		}
+	}
+	for rule, count := range remaining {
+		for i := 0; i < count; i++ {
+			diff.Unexpected = append(diff.Unexpected, rule)
+		}
+	}
+
+	Sort(diff.Missing)
+	Sort(diff.Unexpected)
+	return diff
+}
+
+// Empty reports whether the rule sets were equal
+func (d Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0
+}
+
+// String renders the difference as "unexpected: egress all 0.0.0.0/0; missing: egress tcp 443 sg-0abc"
+func (d Diff) String() string {
+	var problems []string
+	if len(d.Unexpected) > 0 {
+		problems = append(problems, "unexpected: "+Join(d.Unexpected))
+	}
+	if len(d.Missing) > 0 {
+		problems = append(problems, "missing: "+Join(d.Missing))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// ExpectExactly returns an error naming the difference unless the actual rules are exactly the
+// expected ones
+func ExpectExactly(expected, actual []Rule) error {
+	if diff := DiffRules(expected, actual); !diff.Empty() {
+		return fmt.Errorf("rules differ (%s)", diff)
+	}
+	return nil
+}
+
+// Sort sorts rules by their rendering
+func Sort(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].String() < rules[j].String() })
+}
+
+// Join renders rules separated by commas
+func Join(rules []Rule) string {
+	rendered := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		rendered = append(rendered, rule.String())
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// GroupSet is the security groups of a network interface: sorted and without duplicates
+type GroupSet []string
+
+// NewGroupSet returns the set of the group IDs
+func NewGroupSet(ids ...string) GroupSet {
+	set := append(GroupSet(nil), ids...)
+	sort.Strings(set)
+	deduped := set[:0]
+	for i, id := range set {
+		if i == 0 || id != set[i-1] {
+			deduped = append(deduped, id)
+		}
+	}
+	return deduped
+}
+
+// GroupsOf returns the set of groups of an interface, as EC2 lists them on interfaces and instances
+func GroupsOf(groups []*ec2.GroupIdentifier) GroupSet {
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, aws.StringValue(group.GroupId))
+	}
+	return NewGroupSet(ids...)
+}
+
+// Contains reports whether the set has the group
+func (s GroupSet) Contains(id string) bool {
+	i := sort.SearchStrings(s, id)
+	return i < len(s) && s[i] == id
+}
+
+// With returns the set with the groups added
+func (s GroupSet) With(ids ...string) GroupSet {
+	return NewGroupSet(append(append([]string(nil), s...), ids...)...)
+}
+
+// Equal reports whether the sets have the same groups
+func (s GroupSet) Equal(other GroupSet) bool {
+	return s.String() == other.String()
+}
+
+// String renders the set as "[sg-a, sg-b]"
+func (s GroupSet) String() string {
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+// ExpectGroups returns an error naming the difference unless the actual groups are exactly the
+// expected ones
+func ExpectGroups(expected, actual GroupSet) error {
+	if expected.Equal(actual) {
+		return nil
+	}
+
+	var missing, unexpected []string
+	for _, id := range expected {
+		if !actual.Contains(id) {
+			missing = append(missing, id)
+		}
+	}
+	for _, id := range actual {
+		if !expected.Contains(id) {
+			unexpected = append(unexpected, id)
+		}
+	}
+
+	var problems []string
+	if len(unexpected) > 0 {
+		problems = append(problems, "unexpected: "+strings.Join(unexpected, ", "))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, "missing: "+strings.Join(missing, ", "))
+	}
+	return fmt.Errorf("security groups %s, expected %s (%s)", actual, expected, strings.Join(problems, "; "))
+}
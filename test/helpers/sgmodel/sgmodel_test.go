@@ -0,0 +1,266 @@
+package sgmodel
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want Rule
+	}{
+		{
+			name: "all protocols by number",
+			rule: Rule{Protocol: "-1", FromPort: -1, ToPort: -1, Target: "0.0.0.0/0"},
+			want: Rule{Protocol: ProtocolAll, FromPort: 0, ToPort: MaxPort, Target: "0.0.0.0/0"},
+		},
+		{
+			name: "all protocols without ports",
+			rule: Rule{Egress: true, Protocol: "all", Target: "::/0"},
+			want: Rule{Egress: true, Protocol: ProtocolAll, FromPort: 0, ToPort: MaxPort, Target: "::/0"},
+		},
+		{
+			name: "tcp by number",
+			rule: Rule{Protocol: "6", FromPort: 443, ToPort: 443, Target: "10.0.0.0/8"},
+			want: Rule{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, Target: "10.0.0.0/8"},
+		},
+		{
+			name: "udp with every port as -1",
+			rule: Rule{Protocol: "17", FromPort: -1, ToPort: -1, Target: "10.0.0.0/8"},
+			want: Rule{Protocol: ProtocolUDP, FromPort: 0, ToPort: MaxPort, Target: "10.0.0.0/8"},
+		},
+		{
+			name: "upper-case name",
+			rule: Rule{Protocol: "TCP", FromPort: 22, ToPort: 22, Target: "sg-0abc"},
+			want: Rule{Protocol: ProtocolTCP, FromPort: 22, ToPort: 22, Target: "sg-0abc"},
+		},
+		{
+			name: "icmp keeps -1 type and code",
+			rule: Rule{Protocol: "1", FromPort: -1, ToPort: -1, Target: "0.0.0.0/0"},
+			want: Rule{Protocol: ProtocolICMP, FromPort: -1, ToPort: -1, Target: "0.0.0.0/0"},
+		},
+		{
+			name: "icmpv6 by number",
+			rule: Rule{Protocol: "58", FromPort: 128, ToPort: 0, Target: "::/0"},
+			want: Rule{Protocol: ProtocolICMPv6, FromPort: 128, ToPort: 0, Target: "::/0"},
+		},
+		{
+			name: "host bits cleared",
+			rule: Rule{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, Target: "10.1.2.3/16"},
+			want: Rule{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, Target: "10.1.0.0/16"},
+		},
+		{
+			name: "ipv6 canonical form",
+			rule: Rule{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, Target: "2001:DB8:0:0::1/64"},
+			want: Rule{Protocol: ProtocolTCP, FromPort: 443, ToPort: 443, Target: "2001:db8::/64"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, test.rule.Normalize())
+			assert.Equal(t, test.want, test.want.Normalize(), "normalizing must be idempotent")
+		})
+	}
+}
+
+func TestTargetKind(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"10.0.0.0/8", TargetIPv4},
+		{"::/0", TargetIPv6},
+		{"pl-0abc", TargetPrefixList},
+		{"sg-0abc", TargetGroup},
+	}
+	for _, test := range tests {
+		rule := Rule{Target: test.target}
+		assert.Equal(t, test.want, rule.TargetKind(), test.target)
+		assert.Equal(t, test.want == TargetIPv6, rule.IPv6(), test.target)
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		name        string
+		rule, other Rule
+		want        bool
+	}{
+		{name: "all traffic covers tcp", rule: AllTraffic(true, "0.0.0.0/0"), other: TCP(true, 443, 443, "0.0.0.0/0"), want: true},
+		{name: "all traffic by number covers udp", rule: Rule{Egress: true, Protocol: "-1", FromPort: -1, ToPort: -1, Target: "0.0.0.0/0"}, other: Rule{Egress: true, Protocol: "udp", FromPort: 53, ToPort: 53, Target: "0.0.0.0/0"}, want: true},
+		{name: "wider range", rule: TCP(false, 1024, 65535, "10.0.0.0/8"), other: TCP(false, 8080, 8080, "10.0.0.0/8"), want: true},
+		{name: "range edge", rule: TCP(false, 1024, 65535, "10.0.0.0/8"), other: TCP(false, 1023, 1024, "10.0.0.0/8"), want: false},
+		{name: "-1 ports cover any tcp port", rule: Rule{Protocol: "6", FromPort: -1, ToPort: -1, Target: "10.0.0.0/8"}, other: TCP(false, 22, 22, "10.0.0.0/8"), want: true},
+		{name: "other protocol", rule: TCP(true, 0, 65535, "0.0.0.0/0"), other: Rule{Egress: true, Protocol: "udp", FromPort: 53, ToPort: 53, Target: "0.0.0.0/0"}, want: false},
+		{name: "other direction", rule: AllTraffic(true, "0.0.0.0/0"), other: TCP(false, 443, 443, "0.0.0.0/0"), want: false},
+		{name: "other target", rule: AllTraffic(true, "10.0.0.0/8"), other: TCP(true, 443, 443, "0.0.0.0/0"), want: false},
+		{name: "any icmp type", rule: Rule{Protocol: "1", FromPort: -1, ToPort: -1, Target: "0.0.0.0/0"}, other: Rule{Protocol: "icmp", FromPort: 8, ToPort: 0, Target: "0.0.0.0/0"}, want: true},
+		{name: "tcp does not cover all traffic", rule: TCP(true, 0, 65535, "0.0.0.0/0"), other: AllTraffic(true, "0.0.0.0/0"), want: false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.rule.Covers(test.other), test.name)
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	assert.Equal(t, "egress tcp 443 sg-0abc", TCP(true, 443, 443, "sg-0abc").String())
+	assert.Equal(t, "ingress tcp 1024-65535 10.0.0.0/8", TCP(false, 1024, 65535, "10.0.0.0/8").String())
+	assert.Equal(t, "egress all 0.0.0.0/0", AllTraffic(true, "0.0.0.0/0").String())
+}
+
+func TestFromEC2(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *ec2.SecurityGroupRule
+		want Rule
+	}{
+		{
+			name: "ipv4 all traffic",
+			rule: &ec2.SecurityGroupRule{IsEgress: aws.Bool(true), IpProtocol: aws.String("-1"), FromPort: aws.Int64(-1), ToPort: aws.Int64(-1), CidrIpv4: aws.String("0.0.0.0/0")},
+			want: AllTraffic(true, "0.0.0.0/0"),
+		},
+		{
+			name: "ipv6",
+			rule: &ec2.SecurityGroupRule{IsEgress: aws.Bool(true), IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), CidrIpv6: aws.String("::/0")},
+			want: TCP(true, 443, 443, "::/0"),
+		},
+		{
+			name: "prefix list",
+			rule: &ec2.SecurityGroupRule{IsEgress: aws.Bool(true), IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), PrefixListId: aws.String("pl-0abc")},
+			want: TCP(true, 443, 443, "pl-0abc"),
+		},
+		{
+			name: "referenced group",
+			rule: &ec2.SecurityGroupRule{IsEgress: aws.Bool(false), IpProtocol: aws.String("6"), FromPort: aws.Int64(22), ToPort: aws.Int64(22), ReferencedGroupInfo: &ec2.ReferencedSecurityGroup{GroupId: aws.String("sg-0abc")}},
+			want: TCP(false, 22, 22, "sg-0abc"),
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, FromEC2(test.rule), test.name)
+	}
+}
+
+func TestFromPermissions(t *testing.T) {
+	permissions := []*ec2.IpPermission{
+		{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(443),
+			ToPort:           aws.Int64(443),
+			IpRanges:         []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+			Ipv6Ranges:       []*ec2.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+			PrefixListIds:    []*ec2.PrefixListId{{PrefixListId: aws.String("pl-0abc")}},
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-0abc")}},
+		},
+		{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+	}
+
+	assert.Equal(t, []Rule{
+		TCP(true, 443, 443, "10.0.0.0/8"),
+		TCP(true, 443, 443, "::/0"),
+		TCP(true, 443, 443, "pl-0abc"),
+		TCP(true, 443, 443, "sg-0abc"),
+		AllTraffic(true, "0.0.0.0/0"),
+	}, FromPermissions(true, permissions))
+}
+
+func TestDiffRules(t *testing.T) {
+	https := TCP(true, 443, 443, "sg-0endpoint")
+	tests := []struct {
+		name           string
+		expected       []Rule
+		actual         []Rule
+		wantMissing    []Rule
+		wantUnexpected []Rule
+	}{
+		{
+			name:     "same rules in other shapes",
+			expected: []Rule{https, AllTraffic(false, "10.0.0.0/8")},
+			actual:   []Rule{{Egress: false, Protocol: "-1", FromPort: -1, ToPort: -1, Target: "10.0.0.0/8"}, {Egress: true, Protocol: "6", FromPort: 443, ToPort: 443, Target: "sg-0endpoint"}},
+		},
+		{
+			name:           "wider than expected",
+			expected:       []Rule{https},
+			actual:         []Rule{AllTraffic(true, "sg-0endpoint")},
+			wantMissing:    []Rule{https},
+			wantUnexpected: []Rule{AllTraffic(true, "sg-0endpoint")},
+		},
+		{
+			name:           "duplicate counted",
+			expected:       []Rule{https},
+			actual:         []Rule{https, https},
+			wantUnexpected: []Rule{https},
+		},
+		{
+			name:        "none",
+			expected:    []Rule{https},
+			wantMissing: []Rule{https},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffRules(test.expected, test.actual)
+			assert.Equal(t, test.wantMissing, diff.Missing)
+			assert.Equal(t, test.wantUnexpected, diff.Unexpected)
+			assert.Equal(t, len(test.wantMissing) == 0 && len(test.wantUnexpected) == 0, diff.Empty())
+			if diff.Empty() {
+				assert.NoError(t, ExpectExactly(test.expected, test.actual))
+			} else {
+				assert.Error(t, ExpectExactly(test.expected, test.actual))
+			}
+		})
+	}
+
+	diff := DiffRules([]Rule{https}, []Rule{AllTraffic(true, "0.0.0.0/0")})
+	assert.Equal(t, "unexpected: egress all 0.0.0.0/0; missing: egress tcp 443 sg-0endpoint", diff.String())
+}
+
+func TestGroupSet(t *testing.T) {
+	set := NewGroupSet("sg-b", "sg-a", "sg-b")
+	assert.Equal(t, GroupSet{"sg-a", "sg-b"}, set)
+	assert.Equal(t, "[sg-a, sg-b]", set.String())
+	assert.True(t, set.Contains("sg-a"))
+	assert.False(t, set.Contains("sg-c"))
+	assert.Equal(t, GroupSet{"sg-a", "sg-b", "sg-c"}, set.With("sg-c", "sg-a"))
+	assert.Equal(t, GroupSet{"sg-a", "sg-b"}, set, "With must not change the set")
+
+	groups := GroupsOf([]*ec2.GroupIdentifier{{GroupId: aws.String("sg-b")}, {GroupId: aws.String("sg-a")}})
+	assert.True(t, set.Equal(groups))
+	assert.Empty(t, NewGroupSet())
+}
+
+func TestExpectGroups(t *testing.T) {
+	tests := []struct {
+		name             string
+		expected, actual GroupSet
+		wantErr          string
+	}{
+		{name: "equal", expected: NewGroupSet("sg-q"), actual: NewGroupSet("sg-q")},
+		{
+			name:     "not swapped",
+			expected: NewGroupSet("sg-q"),
+			actual:   NewGroupSet("sg-app", "sg-q"),
+			wantErr:  "security groups [sg-app, sg-q], expected [sg-q] (unexpected: sg-app)",
+		},
+		{
+			name:     "missing",
+			expected: NewGroupSet("sg-q"),
+			actual:   NewGroupSet("sg-app"),
+			wantErr:  "security groups [sg-app], expected [sg-q] (unexpected: sg-app; missing: sg-q)",
+		},
+	}
+	for _, test := range tests {
+		err := ExpectGroups(test.expected, test.actual)
+		if test.wantErr == "" {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		require.Error(t, err, test.name)
+		assert.Equal(t, test.wantErr, err.Error(), test.name)
+	}
+}
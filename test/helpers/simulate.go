@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// DestructiveActions are the calls the IR roles must never be able to make, in any account
+var DestructiveActions = []string{
+	"ec2:TerminateInstances",
+	"s3:DeleteBucket",
+	"kms:ScheduleKeyDeletion",
+}
+
+// Policy layers that can block a simulated call
+const (
+	BlockedBySCP                 = "scp"
+	BlockedByPermissionsBoundary = "permissions-boundary"
+	BlockedByIdentityPolicy      = "identity-policy"
+)
+
+// SimulationResult is the policy simulator's decision for one action on one resource
+type SimulationResult struct {
+	Action   string
+	Resource string
+	Decision string
+	// BlockedBy names the policy layer that denies the call, empty when it is allowed
+	BlockedBy string
+}
+
+// String renders the result as "ec2:TerminateInstances on arn:... : explicitDeny"
+func (r SimulationResult) String() string {
+	if r.BlockedBy != "" {
+		return fmt.Sprintf("%s on %s: %s (%s)", r.Action, r.Resource, r.Decision, r.BlockedBy)
+	}
+	return fmt.Sprintf("%s on %s: %s", r.Action, r.Resource, r.Decision)
+}
+
+// blockedBy attributes a decision to a policy layer, checking the outermost layer first
+func blockedBy(decision string, organizations *iam.OrganizationsDecisionDetail, boundary *iam.PermissionsBoundaryDecisionDetail) string {
+	switch {
+	case organizations != nil && !aws.BoolValue(organizations.AllowedByOrganizations):
+		return BlockedBySCP
+	case boundary != nil && !aws.BoolValue(boundary.AllowedByPermissionsBoundary):
+		return BlockedByPermissionsBoundary
+	case decision != iam.PolicyEvaluationDecisionTypeAllowed:
+		return BlockedByIdentityPolicy
+	}
+	return ""
+}
+
+// MemberAccountResources returns ARNs covering the instances, buckets and keys of a member account
+// in a region, as targets for destructive actions
+func MemberAccountResources(region, accountID string) []string {
+	partition := PartitionFor(region)
+	return []string{
+		partition.ARN("ec2", region, accountID, "instance/*"),
+		partition.ARN("s3", "", "", "*"),
+		partition.ARN("kms", region, accountID, "key/*"),
+	}
+}
+
+// SimulatePrincipalActions runs the IAM policy simulator for a principal. Besides the identity
+// policies the simulator applies the permissions boundary and, in an organization, the SCPs.
+func SimulatePrincipalActions(sess *session.Session, principalARN string, actions, resources []string) ([]SimulationResult, error) {
+	var results []SimulationResult
+
+	err := iam.New(sess).SimulatePrincipalPolicyPages(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalARN),
+		ActionNames:     aws.StringSlice(actions),
+		ResourceArns:    aws.StringSlice(resources),
+	}, func(page *iam.SimulatePolicyResponse, lastPage bool) bool {
+		for _, evaluation := range page.EvaluationResults {
+			// With several resources the simulator reports a decision per resource
+			if len(evaluation.ResourceSpecificResults) == 0 {
+				decision := aws.StringValue(evaluation.EvalDecision)
+				results = append(results, SimulationResult{
+					Action:    aws.StringValue(evaluation.EvalActionName),
+					Resource:  aws.StringValue(evaluation.EvalResourceName),
+					Decision:  decision,
+					BlockedBy: blockedBy(decision, evaluation.OrganizationsDecisionDetail, evaluation.PermissionsBoundaryDecisionDetail),
+				})
+				continue
+			}
+			for _, resource := range evaluation.ResourceSpecificResults {
+				decision := aws.StringValue(resource.EvalResourceDecision)
+				results = append(results, SimulationResult{
+					Action:    aws.StringValue(evaluation.EvalActionName),
+					Resource:  aws.StringValue(resource.EvalResourceName),
+					Decision:  decision,
+					BlockedBy: blockedBy(decision, evaluation.OrganizationsDecisionDetail, resource.PermissionsBoundaryDecisionDetail),
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to simulate policies of %s: %w", principalARN, err)
+	}
+
+	return results, nil
+}
+
+// AssertActionsExplicitlyDenied asserts that every simulated action on every resource is explicitly
+// denied. An implicit deny is not enough: it would turn into an allow as soon as a broader statement
+// is attached to the role.
+func AssertActionsExplicitlyDenied(sess *session.Session, principalARN string, actions, resources []string) error {
+	results, err := SimulatePrincipalActions(sess, principalARN, actions, resources)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, result := range results {
+		if result.Decision != iam.PolicyEvaluationDecisionTypeExplicitDeny {
+			problems = append(problems, result.String())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is not explicitly denied: %s", principalARN, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
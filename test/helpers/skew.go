@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// MeasureClockSkew returns how far the runner's clock is ahead of AWS's, from the Date header of an
+// STS response. The header has a resolution of a second, so the result is rounded to one.
+func MeasureClockSkew(sess *session.Session) (time.Duration, error) {
+	req, _ := sts.New(sess).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	sent := clock.Default.Now()
+	if err := req.Send(); err != nil {
+		return 0, fmt.Errorf("failed to call STS: %w", err)
+	}
+	received := clock.Default.Now()
+
+	date, err := http.ParseTime(req.HTTPResponse.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("STS response has no usable Date header: %w", err)
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return local.Sub(date).Round(time.Second), nil
+}
+
+// CalibrateClockSkew measures the skew against AWS and widens the query windows of every helper by
+// it. Tests call it once before taking their start anchor.
+func CalibrateClockSkew(sess *session.Session) (time.Duration, error) {
+	skew, err := MeasureClockSkew(sess)
+	if err != nil {
+		return 0, err
+	}
+	clock.SetSkew(skew)
+	return skew, nil
+}
@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// probeMessage marks messages published by probes so subscribers can discard them
+const probeMessage = `{"probe":true,"source":"threat-detection-ir-tests"}`
+
+// PublishProbe publishes a probe message to the topic with the session's credentials
+func PublishProbe(sess *session.Session, topicARN string) error {
+	_, err := sns.New(sess).Publish(&sns.PublishInput{
+		TopicArn: aws.String(topicARN),
+		Subject:  aws.String("IR publish probe"),
+		Message:  aws.String(probeMessage),
+	})
+	return err
+}
+
+// AssertPublishDenied asserts that the session's principal is refused sns:Publish on the topic
+func AssertPublishDenied(sess *session.Session, topicARN string) error {
+	err := PublishProbe(sess, topicARN)
+	if err == nil {
+		return fmt.Errorf("publish to %s succeeded, expected access to be denied", topicARN)
+	}
+	if !IsAccessDenied(err) {
+		return fmt.Errorf("publish to %s failed for a reason other than authorization: %w", topicARN, err)
+	}
+
+	return nil
+}
+
+// PublishAsStateMachineRole publishes a probe message to the topic as the Step Functions role by
+// running a throwaway single-task state machine under that role. The role trusts only the Step
+// Functions service, so this is the only way to exercise its publish path for real.
+func PublishAsStateMachineRole(sess *session.Session, roleARN, topicARN, name string, timeout time.Duration) error {
+	definition, err := json.Marshal(map[string]interface{}{
+		"StartAt": "Publish",
+		"States": map[string]interface{}{
+			"Publish": map[string]interface{}{
+				"Type":     "Task",
+				"Resource": SessionPartition(sess).ARN("states", "", "", "sns:publish"),
+				"Parameters": map[string]interface{}{
+					"TopicArn": topicARN,
+					"Subject":  "IR publish probe",
+					"Message":  probeMessage,
+				},
+				"End": true,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build probe state machine: %w", err)
+	}
+
+	sfnClient := sfn.New(sess)
+
+	// A role created in the same apply may not be usable by Step Functions yet
+	var created *sfn.CreateStateMachineOutput
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		created, err = sfnClient.CreateStateMachine(&sfn.CreateStateMachineInput{
+			Name:       aws.String(name),
+			Definition: aws.String(string(definition)),
+			RoleArn:    aws.String(roleARN),
+		})
+		if err == nil {
+			break
+		}
+		if clock.Default.Now().After(deadline) {
+			return fmt.Errorf("failed to create probe state machine: %w", err)
+		}
+		clock.Default.Sleep(10 * time.Second)
+	}
+	defer sfnClient.DeleteStateMachine(&sfn.DeleteStateMachineInput{StateMachineArn: created.StateMachineArn})
+
+	started, err := sfnClient.StartExecution(&sfn.StartExecutionInput{
+		StateMachineArn: created.StateMachineArn,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start probe execution: %w", err)
+	}
+
+	for clock.Default.Now().Before(deadline) {
+		execution, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{
+			ExecutionArn: started.ExecutionArn,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe probe execution: %w", err)
+		}
+
+		switch aws.StringValue(execution.Status) {
+		case sfn.ExecutionStatusRunning:
+			clock.Default.Sleep(2 * time.Second)
+		case sfn.ExecutionStatusSucceeded:
+			return nil
+		default:
+			return fmt.Errorf("probe publish as %s ended %s: %s: %s", roleARN, aws.StringValue(execution.Status),
+				aws.StringValue(execution.Error), aws.StringValue(execution.Cause))
+		}
+	}
+
+	return fmt.Errorf("probe execution did not finish within %s", timeout)
+}
@@ -0,0 +1,313 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// FindingSource injects findings through one ingestion path and returns the finding IDs the
+// pipeline will see, which may differ from the input when the service assigns its own
+type FindingSource interface {
+	Name() string
+	Inject(findings []GuardDutyFinding) ([]string, error)
+}
+
+// Finding source names accepted by NewFindingSource; replay takes a path as "replay:<file or dir>"
+// and stratus a technique as "stratus:<technique id>"
+const (
+	SourceEventBridge     = "eventbridge"
+	SourceGuardDutySample = "guardduty-sample"
+	SourceSecurityHub     = "securityhub"
+	SourceReplay          = "replay"
+	SourceStratus         = "stratus"
+)
+
+// NewFindingSource returns the finding source for a name
+func NewFindingSource(sess *session.Session, name string) (FindingSource, error) {
+	kind, arg, _ := strings.Cut(name, ":")
+
+	switch kind {
+	case SourceEventBridge, "":
+		return NewEventBridgeSource(sess), nil
+	case SourceGuardDutySample:
+		return NewGuardDutySampleSource(sess), nil
+	case SourceSecurityHub:
+		return NewSecurityHubSource(sess), nil
+	case SourceReplay:
+		if arg == "" {
+			return nil, fmt.Errorf("replay source needs a path, e.g. replay:testdata/events")
+		}
+		return NewReplaySource(sess, arg), nil
+	case SourceStratus:
+		return NewStratusSource(sess, arg)
+	default:
+		return nil, fmt.Errorf("unknown finding source %q", name)
+	}
+}
+
+// SourceIgnoresFindings reports whether a source produces its own findings instead of injecting the
+// scenario's
+func SourceIgnoresFindings(name string) bool {
+	kind, _, _ := strings.Cut(name, ":")
+	return kind == SourceReplay || kind == SourceStratus
+}
+
+// EventBridgeSource puts findings on the default bus as GuardDuty Finding events
+type EventBridgeSource struct {
+	sess *session.Session
+}
+
+// NewEventBridgeSource returns a source that calls PutEvents
+func NewEventBridgeSource(sess *session.Session) *EventBridgeSource {
+	return &EventBridgeSource{sess: sess}
+}
+
+// Name implements FindingSource
+func (s *EventBridgeSource) Name() string { return SourceEventBridge }
+
+// Inject implements FindingSource
+func (s *EventBridgeSource) Inject(findings []GuardDutyFinding) ([]string, error) {
+	var entries []*eventbridge.PutEventsRequestEntry
+	var ids []string
+
+	for _, finding := range findings {
+		event, err := GenerateEventBridgeEvent(finding)
+		if err != nil {
+			return nil, err
+		}
+
+		detail, err := json.Marshal(event["detail"])
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &eventbridge.PutEventsRequestEntry{
+			Source:       aws.String("aws.guardduty"),
+			DetailType:   aws.String("GuardDuty Finding"),
+			Detail:       aws.String(string(detail)),
+			EventBusName: aws.String("default"),
+		})
+		ids = append(ids, finding.ID)
+	}
+
+	if err := putEvents(s.sess, entries); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// putEvents sends entries in batches of the PutEvents limit
+func putEvents(sess *session.Session, entries []*eventbridge.PutEventsRequestEntry) error {
+	eventbridgeClient := eventbridge.New(sess)
+
+	for start := 0; start < len(entries); start += 10 {
+		end := start + 10
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		output, err := eventbridgeClient.PutEvents(&eventbridge.PutEventsInput{
+			Entries: entries[start:end],
+		})
+		if err != nil {
+			return err
+		}
+
+		if output.FailedEntryCount != nil && *output.FailedEntryCount > 0 {
+			return fmt.Errorf("%d of %d events were rejected by EventBridge", *output.FailedEntryCount, end-start)
+		}
+	}
+
+	return nil
+}
+
+// GuardDutySampleSource asks GuardDuty to generate sample findings of the requested types. GuardDuty
+// assigns the IDs and resources, so only each finding's Type is used.
+type GuardDutySampleSource struct {
+	sess *session.Session
+	// Wait bounds how long to look for the generated findings
+	Wait time.Duration
+}
+
+// NewGuardDutySampleSource returns a source that calls CreateSampleFindings on the region's detector
+func NewGuardDutySampleSource(sess *session.Session) *GuardDutySampleSource {
+	return &GuardDutySampleSource{sess: sess, Wait: 2 * time.Minute}
+}
+
+// Name implements FindingSource
+func (s *GuardDutySampleSource) Name() string { return SourceGuardDutySample }
+
+// Inject implements FindingSource
+func (s *GuardDutySampleSource) Inject(findings []GuardDutyFinding) ([]string, error) {
+	guarddutyClient := guardduty.New(s.sess)
+
+	id, err := GuardDutyDetectorID(s.sess)
+	if err != nil {
+		return nil, err
+	}
+	detectorID := aws.String(id)
+
+	typeSet := map[string]bool{}
+	for _, finding := range findings {
+		typeSet[finding.Type] = true
+	}
+	var types []*string
+	for findingType := range typeSet {
+		types = append(types, aws.String(findingType))
+	}
+
+	// GuardDuty timestamps are millisecond epochs; allow for clock skew
+	since := clock.Tolerant(clock.Default.Now())
+
+	if _, err := guarddutyClient.CreateSampleFindings(&guardduty.CreateSampleFindingsInput{
+		DetectorId:   detectorID,
+		FindingTypes: types,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create sample findings: %w", err)
+	}
+
+	deadline := clock.Default.Now().Add(s.Wait)
+	for {
+		var ids []string
+		err := guarddutyClient.ListFindingsPages(&guardduty.ListFindingsInput{
+			DetectorId: detectorID,
+			FindingCriteria: &guardduty.FindingCriteria{
+				Criterion: map[string]*guardduty.Condition{
+					"service.additionalInfo.sample": {Eq: []*string{aws.String("true")}},
+					"type":                          {Eq: types},
+					"updatedAt":                     {GreaterThanOrEqual: aws.Int64(since.UnixMilli())},
+				},
+			},
+		}, func(page *guardduty.ListFindingsOutput, lastPage bool) bool {
+			ids = append(ids, aws.StringValueSlice(page.FindingIds)...)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sample findings: %w", err)
+		}
+
+		if len(ids) >= len(types) || clock.Default.Now().After(deadline) {
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("GuardDuty did not generate sample findings within %s", s.Wait)
+			}
+			return ids, nil
+		}
+
+		clock.Default.Sleep(10 * time.Second)
+	}
+}
+
+// SecurityHubSource imports findings into Security Hub as ASFF through BatchImportFindings
+type SecurityHubSource struct {
+	sess *session.Session
+}
+
+// NewSecurityHubSource returns a source that calls BatchImportFindings with the account's default product
+func NewSecurityHubSource(sess *session.Session) *SecurityHubSource {
+	return &SecurityHubSource{sess: sess}
+}
+
+// Name implements FindingSource
+func (s *SecurityHubSource) Name() string { return SourceSecurityHub }
+
+// Inject implements FindingSource
+func (s *SecurityHubSource) Inject(findings []GuardDutyFinding) ([]string, error) {
+	identity, err := sts.New(s.sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve account: %w", err)
+	}
+
+	var custom []*securityhub.AwsSecurityFinding
+	for _, finding := range findings {
+		converted, err := NewCustomFinding(aws.StringValue(identity.Account), aws.StringValue(s.sess.Config.Region), finding)
+		if err != nil {
+			return nil, err
+		}
+		custom = append(custom, converted)
+	}
+
+	return ImportCustomFindings(s.sess, custom)
+}
+
+// ReplaySource replays recorded EventBridge events from a JSON file or a directory of them. It ignores
+// the findings passed to Inject and returns the detail IDs of the replayed events.
+type ReplaySource struct {
+	sess *session.Session
+	path string
+}
+
+// NewReplaySource returns a source that replays events from path
+func NewReplaySource(sess *session.Session, path string) *ReplaySource {
+	return &ReplaySource{sess: sess, path: path}
+}
+
+// Name implements FindingSource
+func (s *ReplaySource) Name() string { return SourceReplay + ":" + s.path }
+
+// Inject implements FindingSource
+func (s *ReplaySource) Inject(_ []GuardDutyFinding) ([]string, error) {
+	files := []string{s.path}
+	if info, err := os.Stat(s.path); err != nil {
+		return nil, fmt.Errorf("failed to read replay source: %w", err)
+	} else if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(s.path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	var entries []*eventbridge.PutEventsRequestEntry
+	var ids []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read replay event: %w", err)
+		}
+
+		var event struct {
+			Source     string          `json:"source"`
+			DetailType string          `json:"detail-type"`
+			Detail     json.RawMessage `json:"detail"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse replay event %s: %w", file, err)
+		}
+
+		var detail struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(event.Detail, &detail); err != nil {
+			return nil, fmt.Errorf("replay event %s has no detail object: %w", file, err)
+		}
+
+		entries = append(entries, &eventbridge.PutEventsRequestEntry{
+			Source:       aws.String(event.Source),
+			DetailType:   aws.String(event.DetailType),
+			Detail:       aws.String(string(event.Detail)),
+			EventBusName: aws.String("default"),
+		})
+		ids = append(ids, detail.ID)
+	}
+
+	if err := putEvents(s.sess, entries); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,218 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// SSMManagedInstancePolicy is the name of the managed policy an instance needs to register with
+// Systems Manager; its ARN depends on the partition
+const SSMManagedInstancePolicy = "AmazonSSMManagedInstanceCore"
+
+func ssmManagedInstancePolicyARN(sess *session.Session) string {
+	return SessionPartition(sess).ARN("iam", "", "aws", "policy/"+SSMManagedInstancePolicy)
+}
+
+// CreateSSMInstanceProfile creates a role and instance profile of the same name that let an instance
+// register with Systems Manager
+func CreateSSMInstanceProfile(sess *session.Session, name string) error {
+	return CreateInstanceProfile(sess, name, ssmManagedInstancePolicyARN(sess))
+}
+
+// DeleteSSMInstanceProfile removes what CreateSSMInstanceProfile created, skipping parts already gone
+func DeleteSSMInstanceProfile(sess *session.Session, name string) error {
+	return DeleteInstanceProfile(sess, name, ssmManagedInstancePolicyARN(sess))
+}
+
+// CreateInstanceProfile creates a role EC2 can assume with the managed policies attached, and an
+// instance profile of the same name holding it
+func CreateInstanceProfile(sess *session.Session, name string, policyARNs ...string) error {
+	iamClient := iam.New(sess)
+
+	if _, err := iamClient.CreateRole(&iam.CreateRoleInput{
+		RoleName: aws.String(name),
+		AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow",` +
+			`"Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`),
+	}); err != nil {
+		return fmt.Errorf("failed to create instance role %s: %w", name, err)
+	}
+
+	for _, policyARN := range policyARNs {
+		if _, err := iamClient.AttachRolePolicy(&iam.AttachRolePolicyInput{
+			RoleName:  aws.String(name),
+			PolicyArn: aws.String(policyARN),
+		}); err != nil {
+			return fmt.Errorf("failed to attach %s to %s: %w", policyARN, name, err)
+		}
+	}
+
+	if _, err := iamClient.CreateInstanceProfile(&iam.CreateInstanceProfileInput{
+		InstanceProfileName: aws.String(name),
+	}); err != nil {
+		return fmt.Errorf("failed to create instance profile: %w", err)
+	}
+
+	if _, err := iamClient.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String(name),
+		RoleName:            aws.String(name),
+	}); err != nil {
+		return fmt.Errorf("failed to add role to instance profile: %w", err)
+	}
+
+	if err := iamClient.WaitUntilInstanceProfileExists(&iam.GetInstanceProfileInput{
+		InstanceProfileName: aws.String(name),
+	}); err != nil {
+		return err
+	}
+
+	// RunInstances rejects profiles that have not propagated to EC2 yet
+	clock.Default.Sleep(15 * time.Second)
+
+	return nil
+}
+
+// DeleteInstanceProfile removes what CreateInstanceProfile created, skipping parts already gone
+func DeleteInstanceProfile(sess *session.Session, name string, policyARNs ...string) error {
+	iamClient := iam.New(sess)
+
+	steps := []func() error{
+		func() error {
+			_, err := iamClient.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
+				InstanceProfileName: aws.String(name),
+				RoleName:            aws.String(name),
+			})
+			return err
+		},
+		func() error {
+			_, err := iamClient.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{InstanceProfileName: aws.String(name)})
+			return err
+		},
+	}
+	for _, policyARN := range policyARNs {
+		policyARN := policyARN
+		steps = append(steps, func() error {
+			_, err := iamClient.DetachRolePolicy(&iam.DetachRolePolicyInput{
+				RoleName:  aws.String(name),
+				PolicyArn: aws.String(policyARN),
+			})
+			return err
+		})
+	}
+	steps = append(steps, func() error {
+		_, err := iamClient.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(name)})
+		return err
+	})
+
+	for _, step := range steps {
+		if err := step(); err != nil && !isIAMNotFound(err) {
+			return fmt.Errorf("failed to delete instance profile %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func isIAMNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == iam.ErrCodeNoSuchEntityException
+}
+
+// WaitForSSMManaged waits until the instance's SSM agent reports Online
+func WaitForSSMManaged(sess *session.Session, instanceID string, timeout time.Duration) error {
+	ssmClient := ssm.New(sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for clock.Default.Now().Before(deadline) {
+		info, err := ssmClient.DescribeInstanceInformation(&ssm.DescribeInstanceInformationInput{
+			Filters: []*ssm.InstanceInformationStringFilter{
+				{Key: aws.String("InstanceIds"), Values: []*string{aws.String(instanceID)}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe SSM instance information: %w", err)
+		}
+		if len(info.InstanceInformationList) > 0 && aws.StringValue(info.InstanceInformationList[0].PingStatus) == ssm.PingStatusOnline {
+			return nil
+		}
+
+		clock.Default.Sleep(15 * time.Second)
+	}
+
+	return fmt.Errorf("instance %s did not come online in SSM within %s", instanceID, timeout)
+}
+
+// RunSSMCommand runs a shell command on the instance through Systems Manager and returns the final
+// invocation status, or the last seen status if the command has not finished within the timeout
+func RunSSMCommand(sess *session.Session, instanceID, command string, timeout time.Duration) (string, error) {
+	ssmClient := ssm.New(sess)
+
+	sent, err := ssmClient.SendCommand(&ssm.SendCommandInput{
+		DocumentName:   aws.String("AWS-RunShellScript"),
+		InstanceIds:    []*string{aws.String(instanceID)},
+		Parameters:     map[string][]*string{"commands": {aws.String(command)}},
+		TimeoutSeconds: aws.Int64(int64(timeout.Seconds())),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send SSM command: %w", err)
+	}
+	commandID := sent.Command.CommandId
+
+	status := ssm.CommandInvocationStatusPending
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		clock.Default.Sleep(5 * time.Second)
+
+		invocation, err := ssmClient.GetCommandInvocation(&ssm.GetCommandInvocationInput{
+			CommandId:  commandID,
+			InstanceId: aws.String(instanceID),
+		})
+		if err != nil {
+			// The invocation is not visible until the command has been dispatched
+			continue
+		}
+
+		status = aws.StringValue(invocation.Status)
+		switch status {
+		case ssm.CommandInvocationStatusPending, ssm.CommandInvocationStatusInProgress, ssm.CommandInvocationStatusDelayed:
+			continue
+		}
+		return status, nil
+	}
+
+	ssmClient.CancelCommand(&ssm.CancelCommandInput{CommandId: commandID})
+	return status, nil
+}
+
+// AssertSSMReachable asserts that a command sent through Systems Manager completes on the instance
+func AssertSSMReachable(sess *session.Session, instanceID string, timeout time.Duration) error {
+	status, err := RunSSMCommand(sess, instanceID, "true", timeout)
+	if err != nil {
+		return err
+	}
+	if status != ssm.CommandInvocationStatusSuccess {
+		return fmt.Errorf("SSM command on %s ended %s, expected Success", instanceID, status)
+	}
+
+	return nil
+}
+
+// AssertSSMUnreachable asserts that a command sent through Systems Manager does not complete on the instance
+func AssertSSMUnreachable(sess *session.Session, instanceID string, timeout time.Duration) error {
+	status, err := RunSSMCommand(sess, instanceID, "true", timeout)
+	if err != nil {
+		return err
+	}
+	if status == ssm.CommandInvocationStatusSuccess {
+		return fmt.Errorf("SSM command on %s succeeded, expected the instance to be unreachable", instanceID)
+	}
+
+	return nil
+}
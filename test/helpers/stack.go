@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/namespace"
+)
+
+// StackTags returns the tags StackOptions deploys the stack with: the mandatory tags and the run's TestID
+func StackTags(ns namespace.Namespace) map[string]string {
+	return map[string]string{
+		"Environment":        fmt.Sprintf("%s-test", ns.Suite),
+		"TestID":             ns.RunID,
+		"Project":            "threat-detection-ir",
+		"Owner":              "security-engineering",
+		"DataClassification": "confidential",
+	}
+}
+
+// StackOptions returns Terraform options for deploying the root stack with every resource name
+// derived from the namespace. Extra vars override the suite defaults, e.g. to tune lambda_memory_size.
+func StackOptions(ns namespace.Namespace, awsRegion string, extraVars map[string]interface{}) *terraform.Options {
+	vars := map[string]interface{}{
+		"region":                     awsRegion,
+		"org_mode":                   false,
+		"finding_severity_threshold": "HIGH",
+		"regions":                    []string{awsRegion},
+		"sns_subscriptions": []map[string]interface{}{
+			{
+				"protocol": "email",
+				"endpoint": fmt.Sprintf("test-%s@example.com", ns.Prefix),
+			},
+		},
+		"enable_standards": map[string]bool{
+			"aws-foundational-security-best-practices": true,
+			"cis-aws-foundations-benchmark":            true,
+			"nist-800-53-rev-5":                        false,
+			"pci-dss":                                  false,
+		},
+		"tags": StackTags(ns),
+	}
+	if FIPSMode() {
+		vars["use_fips_endpoints"] = true
+	}
+
+	for key, value := range ns.TerraformVars() {
+		vars[key] = value
+	}
+
+	for key, value := range extraVars {
+		vars[key] = value
+	}
+
+	return &terraform.Options{
+		TerraformDir: "../../",
+		Vars:         vars,
+
+		MaxRetries:         3,
+		TimeBetweenRetries: 5 * time.Second,
+	}
+}
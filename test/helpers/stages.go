@@ -0,0 +1,156 @@
+package helpers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/namespace"
+)
+
+// Stages of a staged suite. Setting SKIP_<stage>, e.g. SKIP_destroy=1, skips the stage, as
+// terratest's test_structure does: run once with SKIP_destroy to keep the stack, then iterate with
+// SKIP_deploy and SKIP_destroy set, and finally with SKIP_deploy and SKIP_validate to tear it down.
+const (
+	StageDeploy   = "deploy"
+	StageValidate = "validate"
+	StageDestroy  = "destroy"
+)
+
+// StageDataRoot is where staged suites keep the data of their stacks, relative to the test package
+const StageDataRoot = ".stages"
+
+// Names of the saved stack data in a suite's stage directory
+const (
+	stageNamespaceFile = "Namespace.json"
+	stageOutputsFile   = "Outputs.json"
+)
+
+// StagedStack is a suite's stack deployed and destroyed in test_structure stages. Its namespace,
+// Terraform options and outputs are saved on disk when deployed, so a run that skips the deploy
+// stage validates the existing stack without running Terraform.
+type StagedStack struct {
+	Dir       string
+	Namespace namespace.Namespace
+	Options   *terraform.Options
+	outputs   map[string]interface{}
+}
+
+// StageDir returns the directory a test's stack data is saved in
+func StageDir(t *testing.T) string {
+	return filepath.Join(StageDataRoot, strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()))
+}
+
+// DeployStagedStack runs the deploy stage: it claims a new namespace for the suite, applies the
+// stack with StackOptions and saves the namespace, the options and the outputs. When the stage is
+// skipped it loads them from the run that deployed the stack and claims its namespace instead.
+func DeployStagedStack(t *testing.T, sess *session.Session, suite, awsRegion string, extraVars map[string]interface{}) *StagedStack {
+	t.Helper()
+
+	stack := &StagedStack{Dir: StageDir(t)}
+
+	test_structure.RunTestStage(t, StageDeploy, func() {
+		ns, err := namespace.New(suite, random.UniqueId())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ns.Claim(t.Name()); err != nil {
+			t.Fatal(err)
+		}
+		if err := ns.CheckCollisions(sess); err != nil {
+			ns.Release()
+			t.Fatal(err)
+		}
+
+		options := StackOptions(ns, awsRegion, extraVars)
+		test_structure.SaveString(t, stack.Dir, stageNamespaceFile, ns.RunID)
+		test_structure.SaveTerraformOptions(t, stack.Dir, options)
+
+		// A failed apply still leaves resources behind, so the saved options are enough to destroy them
+		terraform.InitAndApply(t, options)
+		test_structure.SaveTestData(t, test_structure.FormatTestDataPath(stack.Dir, stageOutputsFile), terraform.OutputAll(t, options))
+	})
+
+	if !test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(stack.Dir, "TerraformOptions.json")) {
+		t.Fatalf("no saved stack in %s; run without SKIP_%s first", stack.Dir, StageDeploy)
+	}
+	stack.Options = test_structure.LoadTerraformOptions(t, stack.Dir)
+
+	ns, err := namespace.New(suite, test_structure.LoadString(t, stack.Dir, stageNamespaceFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Claim(t.Name()); err != nil {
+		t.Fatal(err)
+	}
+	stack.Namespace = ns
+
+	stack.outputs = map[string]interface{}{}
+	if test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(stack.Dir, stageOutputsFile)) {
+		test_structure.LoadTestData(t, test_structure.FormatTestDataPath(stack.Dir, stageOutputsFile), &stack.outputs)
+	}
+	return stack
+}
+
+// Validate runs fn as the validate stage
+func (s *StagedStack) Validate(t *testing.T, fn func()) {
+	t.Helper()
+	test_structure.RunTestStage(t, StageValidate, fn)
+}
+
+// Destroy runs the destroy stage, removing the stack and its saved data; defer it right after
+// DeployStagedStack. When the stage is skipped the stack and its data are kept for the next run.
+func (s *StagedStack) Destroy(t *testing.T) {
+	t.Helper()
+	defer s.Namespace.Release()
+
+	test_structure.RunTestStage(t, StageDestroy, func() {
+		terraform.Destroy(t, s.Options)
+		test_structure.CleanupTestDataFolder(t, s.Dir)
+	})
+}
+
+// Outputs returns the stack's outputs as saved by the deploy stage, in the shape of
+// terraform.OutputAll
+func (s *StagedStack) Outputs() map[string]interface{} {
+	return s.outputs
+}
+
+// Output returns a string output saved by the deploy stage, failing the test when it is missing
+func (s *StagedStack) Output(t *testing.T, key string) string {
+	t.Helper()
+
+	value, ok := s.outputs[key]
+	if !ok {
+		t.Fatalf("the stack has no output %s", key)
+	}
+	if value == nil {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprint(value)
+}
+
+// OutputList returns a list output saved by the deploy stage, failing the test when it is missing
+func (s *StagedStack) OutputList(t *testing.T, key string) []string {
+	t.Helper()
+
+	value, ok := s.outputs[key]
+	if !ok {
+		t.Fatalf("the stack has no output %s", key)
+	}
+	items, _ := value.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
@@ -0,0 +1,133 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/sgmodel"
+)
+
+// IsolationStrategy is a value of the stack's isolation_strategy variable
+type IsolationStrategy string
+
+// Isolation strategies; each one fixes what containing a network interface changes
+const (
+	// ReplaceAllSGs leaves the quarantine group as the interface's only group
+	ReplaceAllSGs IsolationStrategy = "replace-all-SGs"
+	// AttachQuarantineAdditionally adds the quarantine group next to the interface's own groups,
+	// which marks the interface but leaves whatever its groups allow
+	AttachQuarantineAdditionally IsolationStrategy = "attach-quarantine-additionally"
+	// NACLBased moves the interface's subnet to the deny-all quarantine network ACL and leaves its groups
+	NACLBased IsolationStrategy = "NACL-based"
+)
+
+// IsolationStrategies lists every strategy the stack supports
+var IsolationStrategies = []IsolationStrategy{ReplaceAllSGs, AttachQuarantineAdditionally, NACLBased}
+
+// InterfaceState is what isolation can change about a network interface: its security groups and
+// the network ACL of its subnet
+type InterfaceState struct {
+	Groups       sgmodel.GroupSet
+	SubnetID     string
+	NetworkACLID string
+}
+
+// String renders the state as "groups [sg-a, sg-b], subnet subnet-0abc with acl-0abc"
+func (s InterfaceState) String() string {
+	return fmt.Sprintf("groups %s, subnet %s with %s", s.Groups, s.SubnetID, s.NetworkACLID)
+}
+
+// CaptureInterfaceState reads the current state of a network interface
+func CaptureInterfaceState(sess *session.Session, eniID string) (InterfaceState, error) {
+	ec2Client := ec2.New(sess)
+
+	interfaces, err := ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(eniID)},
+	})
+	if err != nil {
+		return InterfaceState{}, fmt.Errorf("failed to describe %s: %w", eniID, err)
+	}
+	if len(interfaces.NetworkInterfaces) == 0 {
+		return InterfaceState{}, fmt.Errorf("network interface %s not found", eniID)
+	}
+	eni := interfaces.NetworkInterfaces[0]
+
+	state := InterfaceState{SubnetID: aws.StringValue(eni.SubnetId), Groups: sgmodel.GroupsOf(eni.Groups)}
+
+	state.NetworkACLID, _, err = subnetNetworkACL(ec2Client, state.SubnetID)
+	return state, err
+}
+
+// subnetNetworkACL returns the network ACL a subnet is associated with and the association's ID
+func subnetNetworkACL(ec2Client *ec2.EC2, subnetID string) (aclID, associationID string, err error) {
+	acls, err := ec2Client.DescribeNetworkAcls(&ec2.DescribeNetworkAclsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("association.subnet-id"), Values: []*string{aws.String(subnetID)}}},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to describe the network ACL of %s: %w", subnetID, err)
+	}
+	for _, acl := range acls.NetworkAcls {
+		for _, association := range acl.Associations {
+			if aws.StringValue(association.SubnetId) == subnetID {
+				return aws.StringValue(acl.NetworkAclId), aws.StringValue(association.NetworkAclAssociationId), nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("subnet %s has no network ACL association", subnetID)
+}
+
+// ExpectedInterfaceState returns the exact state an interface captured before isolation must be in
+// after it was isolated under the strategy
+func ExpectedInterfaceState(strategy IsolationStrategy, before InterfaceState, quarantineSGID, quarantineACLID string) (InterfaceState, error) {
+	after := InterfaceState{SubnetID: before.SubnetID, NetworkACLID: before.NetworkACLID}
+
+	switch strategy {
+	case ReplaceAllSGs:
+		after.Groups = sgmodel.NewGroupSet(quarantineSGID)
+	case AttachQuarantineAdditionally:
+		// An interface that already had the quarantine group keeps it once
+		after.Groups = before.Groups.With(quarantineSGID)
+	case NACLBased:
+		if quarantineACLID == "" {
+			return InterfaceState{}, fmt.Errorf("strategy %s needs the quarantine network ACL", strategy)
+		}
+		after.Groups = before.Groups
+		after.NetworkACLID = quarantineACLID
+	default:
+		return InterfaceState{}, fmt.Errorf("unknown isolation strategy %q", strategy)
+	}
+	return after, nil
+}
+
+// AssertInterfaceState asserts that the interface is in exactly the expected state
+func AssertInterfaceState(sess *session.Session, eniID string, expected InterfaceState) error {
+	actual, err := CaptureInterfaceState(sess, eniID)
+	if err != nil {
+		return err
+	}
+	if actual.String() != expected.String() {
+		return fmt.Errorf("%s is in state\n  %s\nexpected\n  %s", eniID, actual, expected)
+	}
+	return nil
+}
+
+// RestoreSubnetACL moves a subnet back to the network ACL it had before NACL-based isolation, so the
+// quarantine network ACL can be destroyed with the stack
+func RestoreSubnetACL(sess *session.Session, subnetID, aclID string) error {
+	ec2Client := ec2.New(sess)
+
+	current, associationID, err := subnetNetworkACL(ec2Client, subnetID)
+	if err != nil || current == aclID {
+		return err
+	}
+	if _, err := ec2Client.ReplaceNetworkAclAssociation(&ec2.ReplaceNetworkAclAssociationInput{
+		AssociationId: aws.String(associationID),
+		NetworkAclId:  aws.String(aclID),
+	}); err != nil {
+		return fmt.Errorf("failed to move %s back to %s: %w", subnetID, aclID, err)
+	}
+	return nil
+}
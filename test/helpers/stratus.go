@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// StratusTechnique maps a Stratus Red Team technique to the GuardDuty finding types its detonation
+// must produce
+type StratusTechnique struct {
+	ID           string
+	FindingTypes []string
+}
+
+// StratusTechniques are the techniques the scenario engine can detonate through the stratus source
+var StratusTechniques = map[string]StratusTechnique{
+	// CloudTrail findings are low severity, so the pipeline must leave them alone
+	"aws.defense-evasion.cloudtrail-stop": {
+		ID:           "aws.defense-evasion.cloudtrail-stop",
+		FindingTypes: []string{"Stealth:IAMUser/CloudTrailLoggingDisabled"},
+	},
+	"aws.defense-evasion.cloudtrail-delete": {
+		ID:           "aws.defense-evasion.cloudtrail-delete",
+		FindingTypes: []string{"Stealth:IAMUser/CloudTrailLoggingDisabled"},
+	},
+	// The stolen credentials are used from wherever stratus runs, inside or outside AWS
+	"aws.credential-access.ec2-steal-instance-credentials": {
+		ID: "aws.credential-access.ec2-steal-instance-credentials",
+		FindingTypes: []string{
+			"UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+			"UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.InsideAWS",
+		},
+	},
+}
+
+// StratusDetectionTimeout bounds the wait for GuardDuty to report a detonation
+var StratusDetectionTimeout = 45 * time.Minute
+
+// StratusSource detonates a Stratus Red Team technique with the stratus CLI (STRATUS_BIN, default
+// stratus on the PATH) and waits for GuardDuty to report it. It ignores the findings passed to
+// Inject and returns the IDs of the findings GuardDuty raised. Detonated infrastructure stays up
+// until Cleanup, so containment can still act on it.
+type StratusSource struct {
+	sess      *session.Session
+	technique StratusTechnique
+}
+
+// NewStratusSource returns a source for a technique listed in StratusTechniques
+func NewStratusSource(sess *session.Session, techniqueID string) (*StratusSource, error) {
+	technique, ok := StratusTechniques[techniqueID]
+	if !ok {
+		return nil, fmt.Errorf("no expected findings mapped for Stratus technique %q", techniqueID)
+	}
+	return &StratusSource{sess: sess, technique: technique}, nil
+}
+
+// Name implements FindingSource
+func (s *StratusSource) Name() string { return SourceStratus + ":" + s.technique.ID }
+
+// Inject implements FindingSource
+func (s *StratusSource) Inject(_ []GuardDutyFinding) ([]string, error) {
+	started := clock.Default.Now()
+	if err := s.run("detonate", s.technique.ID); err != nil {
+		return nil, err
+	}
+
+	return WaitForGuardDutyFindingTypes(s.sess, s.technique.FindingTypes, started, StratusDetectionTimeout)
+}
+
+// Cleanup tears down what the detonation created
+func (s *StratusSource) Cleanup() error {
+	return s.run("cleanup", s.technique.ID)
+}
+
+func (s *StratusSource) run(args ...string) error {
+	bin := os.Getenv("STRATUS_BIN")
+	if bin == "" {
+		bin = "stratus"
+	}
+
+	cmd := exec.Command(bin, args...)
+	cmd.Env = append(os.Environ(), "AWS_REGION="+aws.StringValue(s.sess.Config.Region))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("stratus %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// WaitForGuardDutyFindingTypes polls the region's detector until it reports findings of any of the
+// types updated since the given time, and returns their IDs
+func WaitForGuardDutyFindingTypes(sess *session.Session, findingTypes []string, since time.Time, timeout time.Duration) ([]string, error) {
+	gdClient := guardduty.New(sess)
+
+	detectors, err := gdClient.ListDetectors(&guardduty.ListDetectorsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return nil, fmt.Errorf("no GuardDuty detector in this region")
+	}
+
+	criteria := &guardduty.FindingCriteria{
+		Criterion: map[string]*guardduty.Condition{
+			"type":      {Equals: aws.StringSlice(findingTypes)},
+			"updatedAt": {GreaterThanOrEqual: aws.Int64(clock.Tolerant(since).UnixMilli())},
+		},
+	}
+
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		findings, err := gdClient.ListFindings(&guardduty.ListFindingsInput{
+			DetectorId:      detectors.DetectorIds[0],
+			FindingCriteria: criteria,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list GuardDuty findings: %w", err)
+		}
+		if len(findings.FindingIds) > 0 {
+			return aws.StringValueSlice(findings.FindingIds), nil
+		}
+
+		clock.Default.Sleep(time.Minute)
+	}
+
+	return nil, fmt.Errorf("GuardDuty reported none of %s within %s", strings.Join(findingTypes, ", "), timeout)
+}
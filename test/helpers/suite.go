@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/namespace"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/testlog"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/tracing"
+)
+
+// Harness is the session a test makes its AWS calls through. Every call is logged into the test
+// report and, with OTEL_EXPORTER_OTLP_ENDPOINT set, exported as a trace.
+type Harness struct {
+	Region  string
+	Session *session.Session
+	Log     *testlog.Logger
+	Trace   *tracing.Run
+}
+
+// NewHarness returns a rate-limited, instrumented session in the region. The report is attached
+// and the trace ended when the test and its deferred calls have finished.
+func NewHarness(t *testing.T, awsRegion string) *Harness {
+	t.Helper()
+
+	sess, err := NewRateLimitedSession(awsRegion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runLog := testlog.Default.ForTest(t.Name())
+	runLog.Instrument(sess)
+	t.Cleanup(func() { runLog.Attach(t) })
+
+	trace := tracing.Instrument(sess, t.Name())
+	t.Cleanup(func() { trace.End(t) })
+
+	return &Harness{Region: awsRegion, Session: sess, Log: runLog, Trace: trace}
+}
+
+// Suite is a Harness with a namespace claimed for the stack the test deploys
+type Suite struct {
+	*Harness
+	Namespace namespace.Namespace
+}
+
+// NewSuite returns the harness of a test deploying the stack, with a new namespace for the suite
+// claimed and checked for collisions with resources already in the account. The namespace is
+// released when the test has finished.
+func NewSuite(t *testing.T, awsRegion, suite string) *Suite {
+	t.Helper()
+
+	harness := NewHarness(t, awsRegion)
+
+	ns, err := namespace.New(suite, random.UniqueId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Claim(t.Name()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ns.Release)
+	if err := ns.CheckCollisions(harness.Session); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Suite{Harness: harness, Namespace: ns}
+}
+
+// StackOptions returns the Terraform options of the suite's stack, see StackOptions
+func (s *Suite) StackOptions(extraVars map[string]interface{}) *terraform.Options {
+	return StackOptions(s.Namespace, s.Region, extraVars)
+}
+
+// AssertAccountBaseline checks that the account can take the suite's stack, see AssertAccountBaseline
+func (s *Suite) AssertAccountBaseline() error {
+	bucket := s.Namespace.EvidenceBucketName()
+	return AssertAccountBaseline(s.Session, bucket, bucket+"-logs")
+}
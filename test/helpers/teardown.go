@@ -0,0 +1,213 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// TeardownTargets are the stack resources that must be gone once terraform destroy has run. They are
+// captured from the outputs before the destroy, since the outputs go with the state.
+type TeardownTargets struct {
+	Buckets          []string
+	KMSKeyARNs       []string
+	LogGroups        []string
+	Roles            []string
+	Functions        []string
+	StateMachineARNs []string
+	Rules            []string
+	TopicARNs        []string
+	QueueURLs        []string
+	SecurityGroupIDs []string
+	// RetainLogGroups expects the log groups to survive, as the retain_log_groups variable asks
+	RetainLogGroups bool
+}
+
+// TeardownTargetsFromOutputs builds the targets from the stack's outputs as returned by
+// terraform.OutputAll. Outputs that are empty because a feature is off are skipped.
+func TeardownTargetsFromOutputs(outputs map[string]interface{}, retainLogGroups bool) TeardownTargets {
+	values := func(keys ...string) []string {
+		var found []string
+		for _, key := range keys {
+			switch value := outputs[key].(type) {
+			case string:
+				if value != "" {
+					found = append(found, value)
+				}
+			case []interface{}:
+				for _, item := range value {
+					if s, ok := item.(string); ok && s != "" {
+						found = append(found, s)
+					}
+				}
+			}
+		}
+		return found
+	}
+
+	return TeardownTargets{
+		Buckets:          values("s3_evidence_bucket_name", "s3_evidence_logs_bucket_name", "finding_export_bucket_name"),
+		KMSKeyARNs:       values("s3_evidence_kms_key_arn"),
+		LogGroups:        values("lambda_log_group_name", "stepfn_log_group_name", "quarantine_flow_logs_log_group_name"),
+		Roles:            values("iam_lambda_role_name", "iam_stepfn_role_name", "finding_export_role_names"),
+		Functions:        values("lambda_triage_function_name"),
+		StateMachineARNs: values("stepfn_ir_state_machine_arn"),
+		Rules:            values("eventbridge_rule_names", "finding_export_rule_name"),
+		TopicARNs:        values("sns_topic_arn", "sns_urgent_topic_arn", "sns_ops_topic_arn"),
+		QueueURLs:        values("eventbridge_dlq_url", "stepfn_ir_remediation_dlq_url", "lambda_triage_buffer_queue_url", "lambda_triage_buffer_dlq_url"),
+		SecurityGroupIDs: values("network_quarantine_sg_id", "network_quarantine_additional_sg_ids", "quarantine_ssm_endpoints_sg_id"),
+		RetainLogGroups:  retainLogGroups,
+	}
+}
+
+// isGone reports whether err is one of the service's "does not exist" errors
+func isGone(err error, codes ...string) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if awsErr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertTeardownComplete checks that every target is gone: buckets deleted, KMS keys pending
+// deletion and log groups removed, or kept when RetainLogGroups is set. The error lists all residue,
+// since terraform destroy can stop at a non-empty bucket and leave everything after it in place.
+func AssertTeardownComplete(sess *session.Session, targets TeardownTargets) error {
+	var residue []string
+	check := func(kind, name string, err error, goneCodes ...string) {
+		switch {
+		case err == nil:
+			residue = append(residue, fmt.Sprintf("%s %s still exists", kind, name))
+		case !isGone(err, goneCodes...):
+			residue = append(residue, fmt.Sprintf("%s %s could not be checked: %v", kind, name, err))
+		}
+	}
+
+	s3Client := s3.New(sess)
+	for _, bucket := range targets.Buckets {
+		_, err := s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			check("s3 bucket", bucket, err, "NotFound", s3.ErrCodeNoSuchBucket)
+			continue
+		}
+		versions, err := s3Client.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			residue = append(residue, fmt.Sprintf("s3 bucket %s still exists", bucket))
+			continue
+		}
+		count := len(versions.Versions) + len(versions.DeleteMarkers)
+		more := ""
+		if aws.BoolValue(versions.IsTruncated) {
+			more = "+"
+		}
+		residue = append(residue, fmt.Sprintf("s3 bucket %s still exists with %d%s object versions", bucket, count, more))
+	}
+
+	kmsClient := kms.New(sess)
+	for _, keyARN := range targets.KMSKeyARNs {
+		key, err := kmsClient.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(keyARN)})
+		if err != nil {
+			if !isGone(err, kms.ErrCodeNotFoundException) {
+				residue = append(residue, fmt.Sprintf("kms key %s could not be checked: %v", keyARN, err))
+			}
+			continue
+		}
+		switch state := aws.StringValue(key.KeyMetadata.KeyState); state {
+		case kms.KeyStatePendingDeletion, kms.KeyStatePendingReplicaDeletion:
+		default:
+			residue = append(residue, fmt.Sprintf("kms key %s is %s, expected %s", keyARN, state, kms.KeyStatePendingDeletion))
+		}
+	}
+
+	logsClient := cloudwatchlogs.New(sess)
+	for _, logGroup := range targets.LogGroups {
+		groups, err := logsClient.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(logGroup),
+		})
+		if err != nil {
+			residue = append(residue, fmt.Sprintf("log group %s could not be checked: %v", logGroup, err))
+			continue
+		}
+		exists := false
+		for _, group := range groups.LogGroups {
+			exists = exists || aws.StringValue(group.LogGroupName) == logGroup
+		}
+		switch {
+		case exists && !targets.RetainLogGroups:
+			residue = append(residue, fmt.Sprintf("log group %s still exists", logGroup))
+		case !exists && targets.RetainLogGroups:
+			residue = append(residue, fmt.Sprintf("log group %s was removed although retain_log_groups is set", logGroup))
+		}
+	}
+
+	iamClient := iam.New(sess)
+	for _, role := range targets.Roles {
+		_, err := iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(role)})
+		check("iam role", role, err, iam.ErrCodeNoSuchEntityException)
+	}
+
+	lambdaClient := lambda.New(sess)
+	for _, function := range targets.Functions {
+		_, err := lambdaClient.GetFunction(&lambda.GetFunctionInput{FunctionName: aws.String(function)})
+		check("lambda function", function, err, lambda.ErrCodeResourceNotFoundException)
+	}
+
+	sfnClient := sfn.New(sess)
+	for _, stateMachineARN := range targets.StateMachineARNs {
+		stateMachine, err := sfnClient.DescribeStateMachine(&sfn.DescribeStateMachineInput{
+			StateMachineArn: aws.String(stateMachineARN),
+		})
+		// Deletion is asynchronous; a state machine being deleted is as good as gone
+		if err == nil && aws.StringValue(stateMachine.Status) == sfn.StateMachineStatusDeleting {
+			continue
+		}
+		check("state machine", stateMachineARN, err, sfn.ErrCodeStateMachineDoesNotExist)
+	}
+
+	eventsClient := eventbridge.New(sess)
+	for _, rule := range targets.Rules {
+		_, err := eventsClient.DescribeRule(&eventbridge.DescribeRuleInput{Name: aws.String(rule)})
+		check("eventbridge rule", rule, err, eventbridge.ErrCodeResourceNotFoundException)
+	}
+
+	snsClient := sns.New(sess)
+	for _, topicARN := range targets.TopicARNs {
+		_, err := snsClient.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String(topicARN)})
+		check("sns topic", topicARN, err, sns.ErrCodeNotFoundException)
+	}
+
+	sqsClient := sqs.New(sess)
+	for _, queueURL := range targets.QueueURLs {
+		_, err := sqsClient.GetQueueAttributes(&sqs.GetQueueAttributesInput{QueueUrl: aws.String(queueURL)})
+		check("sqs queue", queueURL, err, sqs.ErrCodeQueueDoesNotExist)
+	}
+
+	ec2Client := ec2.New(sess)
+	for _, groupID := range targets.SecurityGroupIDs {
+		_, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: []*string{aws.String(groupID)}})
+		check("security group", groupID, err, "InvalidGroup.NotFound")
+	}
+
+	if len(residue) > 0 {
+		return fmt.Errorf("destroy left residue:\n  %s", strings.Join(residue, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package testlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level orders log entries by importance
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the lowercase level name used in JSON output
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// MarshalJSON encodes the level by name
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// ParseLevel parses a level name, defaulting to info
+func ParseLevel(name string) Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// Fields are structured key/value pairs attached to an entry
+type Fields map[string]interface{}
+
+// Entry is one JSON log line
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   Level     `json:"level"`
+	Test    string    `json:"test,omitempty"`
+	Message string    `json:"msg"`
+	Fields  Fields    `json:"fields,omitempty"`
+}
+
+// Logger writes leveled JSON lines and keeps every entry and AWS call for the end-of-run report
+type Logger struct {
+	mu      *sync.Mutex
+	out     io.Writer
+	level   Level
+	test    string
+	entries *[]Entry
+	calls   *[]APICall
+}
+
+// Default writes to stderr at the level from TESTLOG_LEVEL
+var Default = New(os.Stderr, ParseLevel(os.Getenv("TESTLOG_LEVEL")))
+
+// New returns a logger writing entries at or above level to out (nil discards output but keeps entries)
+func New(out io.Writer, level Level) *Logger {
+	if out == nil {
+		out = io.Discard
+	}
+
+	return &Logger{
+		mu:      &sync.Mutex{},
+		out:     out,
+		level:   level,
+		entries: &[]Entry{},
+		calls:   &[]APICall{},
+	}
+}
+
+// ForTest returns a logger that tags entries with the test name and shares this logger's output and history
+func (l *Logger) ForTest(name string) *Logger {
+	return &Logger{
+		mu:      l.mu,
+		out:     l.out,
+		level:   l.level,
+		test:    name,
+		entries: l.entries,
+		calls:   l.calls,
+	}
+}
+
+// Log records an entry and writes it if it meets the logger's level
+func (l *Logger) Log(level Level, msg string, fields Fields) {
+	entry := Entry{
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Test:    l.test,
+		Message: msg,
+		Fields:  fields,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	*l.entries = append(*l.entries, entry)
+
+	if level < l.level {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"level":"error","msg":"unencodable log entry: %s"}`, err))
+	}
+	l.out.Write(append(line, '\n'))
+}
+
+// Debug logs at debug level
+func (l *Logger) Debug(msg string, fields Fields) { l.Log(LevelDebug, msg, fields) }
+
+// Info logs at info level
+func (l *Logger) Info(msg string, fields Fields) { l.Log(LevelInfo, msg, fields) }
+
+// Warn logs at warn level
+func (l *Logger) Warn(msg string, fields Fields) { l.Log(LevelWarn, msg, fields) }
+
+// Error logs at error level
+func (l *Logger) Error(msg string, fields Fields) { l.Log(LevelError, msg, fields) }
+
+// Entries returns a copy of every entry logged so far, regardless of level
+func (l *Logger) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Entry(nil), *l.entries...)
+}
@@ -0,0 +1,179 @@
+package testlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// APICall is one completed AWS SDK request, including its retries
+type APICall struct {
+	Time      time.Time     `json:"time"`
+	Test      string        `json:"test,omitempty"`
+	Service   string        `json:"service"`
+	Action    string        `json:"action"`
+	Duration  time.Duration `json:"duration_ns"`
+	Retries   int           `json:"retries"`
+	RequestID string        `json:"request_id,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Instrument adds SDK middleware to the session that records every API call it makes
+func (l *Logger) Instrument(sess *session.Session) {
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		call := APICall{
+			Time:      r.Time.UTC(),
+			Test:      l.test,
+			Service:   r.ClientInfo.ServiceName,
+			Action:    r.Operation.Name,
+			Duration:  time.Since(r.Time),
+			Retries:   r.RetryCount,
+			RequestID: r.RequestID,
+		}
+		if r.Error != nil {
+			if aerr, ok := r.Error.(awserr.Error); ok {
+				call.Error = aerr.Code()
+			} else {
+				call.Error = r.Error.Error()
+			}
+		}
+
+		l.mu.Lock()
+		*l.calls = append(*l.calls, call)
+		l.mu.Unlock()
+
+		fields := Fields{
+			"service":     call.Service,
+			"action":      call.Action,
+			"duration_ms": call.Duration.Milliseconds(),
+			"retries":     call.Retries,
+			"request_id":  call.RequestID,
+		}
+		if call.Error != "" {
+			fields["error"] = call.Error
+			l.Warn("aws call failed", fields)
+			return
+		}
+		l.Debug("aws call", fields)
+	})
+}
+
+// Calls returns a copy of every recorded API call
+func (l *Logger) Calls() []APICall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]APICall(nil), *l.calls...)
+}
+
+// Summary renders call counts, errors and total time per service action
+func (l *Logger) Summary() string {
+	type stat struct {
+		calls, errors, retries int
+		total                  time.Duration
+	}
+
+	stats := map[string]*stat{}
+	for _, call := range l.Calls() {
+		if l.test != "" && call.Test != l.test {
+			continue
+		}
+		key := call.Service + ":" + call.Action
+		if stats[key] == nil {
+			stats[key] = &stat{}
+		}
+		stats[key].calls++
+		stats[key].retries += call.Retries
+		stats[key].total += call.Duration
+		if call.Error != "" {
+			stats[key].errors++
+		}
+	}
+
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-45s %6s %7s %6s %10s\n", "ACTION", "CALLS", "RETRIES", "ERRORS", "TOTAL")
+	for _, key := range keys {
+		s := stats[key]
+		fmt.Fprintf(&b, "%-45s %6d %7d %6d %10s\n", key, s.calls, s.retries, s.errors, s.total.Round(time.Millisecond))
+	}
+
+	return b.String()
+}
+
+// Report is the JSON document written at the end of a test
+type Report struct {
+	Test    string    `json:"test,omitempty"`
+	Entries []Entry   `json:"entries"`
+	Calls   []APICall `json:"aws_calls"`
+}
+
+// WriteReport writes this logger's entries and calls as JSON into dir, named after the test
+func (l *Logger) WriteReport(dir string) (string, error) {
+	report := Report{Test: l.test}
+	for _, entry := range l.Entries() {
+		if l.test == "" || entry.Test == l.test {
+			report.Entries = append(report.Entries, entry)
+		}
+	}
+	for _, call := range l.Calls() {
+		if l.test == "" || call.Test == l.test {
+			report.Calls = append(report.Calls, call)
+		}
+	}
+
+	name := "testlog"
+	if l.test != "" {
+		name = strings.NewReplacer("/", "_", " ", "_").Replace(l.test)
+	}
+	path := filepath.Join(dir, name+".json")
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write test log report: %w", err)
+	}
+
+	return path, nil
+}
+
+// Reporter is the part of *testing.T used to attach the summary to test output
+type Reporter interface {
+	Logf(format string, args ...interface{})
+}
+
+// Attach logs the AWS call summary to the test and, when TESTLOG_DIR is set, writes the full JSON report there
+func (l *Logger) Attach(t Reporter) {
+	t.Logf("AWS calls:\n%s", l.Summary())
+
+	dir := os.Getenv("TESTLOG_DIR")
+	if dir == "" {
+		return
+	}
+
+	path, err := l.WriteReport(dir)
+	if err != nil {
+		t.Logf("failed to write test log report: %v", err)
+		return
+	}
+	t.Logf("test log report written to %s", path)
+}
@@ -0,0 +1,152 @@
+package tfplan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Category classifies how much a drifted resource matters to the IR pipeline
+type Category string
+
+const (
+	// CategorySecurity covers changes that weaken or alter security controls
+	CategorySecurity Category = "security"
+	// CategoryFunctional covers changes that alter pipeline behavior without touching controls
+	CategoryFunctional Category = "functional"
+	// CategoryCosmetic covers tag and description changes
+	CategoryCosmetic Category = "cosmetic"
+)
+
+// securityResourceTypes are resources whose every change is security-impacting
+var securityResourceTypes = map[string]bool{
+	"aws_iam_role":                      true,
+	"aws_iam_policy":                    true,
+	"aws_iam_role_policy":               true,
+	"aws_iam_role_policy_attachment":    true,
+	"aws_kms_key":                       true,
+	"aws_kms_alias":                     true,
+	"aws_s3_bucket_policy":              true,
+	"aws_s3_bucket_public_access_block": true,
+	"aws_s3_bucket_server_side_encryption_configuration": true,
+	"aws_s3_bucket_versioning":                           true,
+	"aws_s3_bucket_logging":                              true,
+	"aws_s3_bucket_ownership_controls":                   true,
+	"aws_security_group":                                 true,
+	"aws_security_group_rule":                            true,
+	"aws_sns_topic_policy":                               true,
+	"aws_lambda_permission":                              true,
+	"aws_guardduty_detector":                             true,
+	"aws_securityhub_account":                            true,
+	"aws_securityhub_standards_subscription":             true,
+	"aws_cloudwatch_event_rule":                          true,
+	"aws_cloudwatch_event_target":                        true,
+	"aws_sfn_state_machine":                              true,
+}
+
+// securityAttributes are attributes that are security-impacting on any resource type
+var securityAttributes = map[string]bool{
+	"policy":                         true,
+	"role":                           true,
+	"role_arn":                       true,
+	"kms_key_id":                     true,
+	"kms_master_key_id":              true,
+	"environment":                    true,
+	"event_pattern":                  true,
+	"state":                          true,
+	"is_enabled":                     true,
+	"reserved_concurrent_executions": true,
+}
+
+// cosmeticAttributes never affect behavior
+var cosmeticAttributes = map[string]bool{
+	"tags":        true,
+	"tags_all":    true,
+	"description": true,
+}
+
+// Classify returns the drift category for a planned change
+func Classify(rc ResourceChange) Category {
+	if securityResourceTypes[rc.Type] {
+		return CategorySecurity
+	}
+
+	// Creates and deletes are never cosmetic
+	for _, action := range rc.Change.Actions {
+		if action == "create" || action == "delete" {
+			return CategoryFunctional
+		}
+	}
+
+	cosmetic := true
+	for _, attribute := range rc.ChangedAttributes() {
+		if securityAttributes[attribute] {
+			return CategorySecurity
+		}
+		if !cosmeticAttributes[attribute] {
+			cosmetic = false
+		}
+	}
+
+	if cosmetic {
+		return CategoryCosmetic
+	}
+	return CategoryFunctional
+}
+
+// DriftReport groups planned changes by category
+type DriftReport struct {
+	Security   []ResourceChange
+	Functional []ResourceChange
+	Cosmetic   []ResourceChange
+}
+
+// BuildReport categorizes every non-trivial resource change in the plan
+func BuildReport(plan *Plan) DriftReport {
+	var report DriftReport
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode == "data" || rc.IsNoOp() {
+			continue
+		}
+
+		switch Classify(rc) {
+		case CategorySecurity:
+			report.Security = append(report.Security, rc)
+		case CategoryCosmetic:
+			report.Cosmetic = append(report.Cosmetic, rc)
+		default:
+			report.Functional = append(report.Functional, rc)
+		}
+	}
+
+	return report
+}
+
+// HasDrift reports whether any resource drifted
+func (r DriftReport) HasDrift() bool {
+	return len(r.Security)+len(r.Functional)+len(r.Cosmetic) > 0
+}
+
+// String renders the report one section per category
+func (r DriftReport) String() string {
+	if !r.HasDrift() {
+		return "No drift detected\n"
+	}
+
+	var b strings.Builder
+	writeSection(&b, "SECURITY-IMPACTING", r.Security)
+	writeSection(&b, "FUNCTIONAL", r.Functional)
+	writeSection(&b, "COSMETIC", r.Cosmetic)
+	return b.String()
+}
+
+func writeSection(b *strings.Builder, title string, changes []ResourceChange) {
+	fmt.Fprintf(b, "%s (%d)\n", title, len(changes))
+	for _, rc := range changes {
+		fmt.Fprintf(b, "  %-8s %s", strings.Join(rc.Change.Actions, ","), rc.Address)
+		if attributes := rc.ChangedAttributes(); len(attributes) > 0 {
+			fmt.Fprintf(b, " [%s]", strings.Join(attributes, ", "))
+		}
+		b.WriteString("\n")
+	}
+}
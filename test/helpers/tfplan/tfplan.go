@@ -0,0 +1,121 @@
+package tfplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// Plan is the subset of `terraform show -json <planfile>` output used for drift analysis
+type Plan struct {
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// ResourceChange is a single planned change to a managed resource
+type ResourceChange struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Change  Change `json:"change"`
+}
+
+// Change holds the planned actions and the before/after attribute values
+type Change struct {
+	Actions []string               `json:"actions"`
+	Before  map[string]interface{} `json:"before"`
+	After   map[string]interface{} `json:"after"`
+}
+
+// Parse decodes plan JSON produced by `terraform show -json`
+func Parse(planJSON []byte) (*Plan, error) {
+	var plan Plan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+
+	return &plan, nil
+}
+
+// Run plans the workspace with -detailed-exitcode and returns the parsed plan.
+// The returned bool reports whether Terraform detected any changes.
+func Run(terraformDir string, extraArgs ...string) (*Plan, bool, error) {
+	tmpDir, err := os.MkdirTemp("", "ir-drift-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	planFile := filepath.Join(tmpDir, "drift.tfplan")
+
+	args := append([]string{"plan", "-detailed-exitcode", "-input=false", "-no-color", "-lock=false", "-out=" + planFile}, extraArgs...)
+	_, stderr, err := terraform(terraformDir, args...)
+
+	changed := false
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		changed = true
+	} else if err != nil {
+		return nil, false, fmt.Errorf("terraform plan failed: %w\n%s", err, stderr)
+	}
+
+	stdout, stderr, err := terraform(terraformDir, "show", "-json", "-no-color", planFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("terraform show failed: %w\n%s", err, stderr)
+	}
+
+	plan, err := Parse(stdout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return plan, changed, nil
+}
+
+func terraform(dir string, args ...string) ([]byte, string, error) {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.String(), err
+}
+
+// IsNoOp reports whether the change leaves the resource untouched
+func (rc ResourceChange) IsNoOp() bool {
+	for _, action := range rc.Change.Actions {
+		if action != "no-op" && action != "read" {
+			return false
+		}
+	}
+	return true
+}
+
+// ChangedAttributes returns the top-level attributes whose values differ between before and after
+func (rc ResourceChange) ChangedAttributes() []string {
+	keys := map[string]bool{}
+	for key := range rc.Change.Before {
+		keys[key] = true
+	}
+	for key := range rc.Change.After {
+		keys[key] = true
+	}
+
+	var changed []string
+	for key := range keys {
+		before, _ := json.Marshal(rc.Change.Before[key])
+		after, _ := json.Marshal(rc.Change.After[key])
+		if !bytes.Equal(before, after) {
+			changed = append(changed, key)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
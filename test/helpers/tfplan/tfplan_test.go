@@ -0,0 +1,205 @@
+package tfplan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const planJSON = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "module.lambda_triage.aws_lambda_function.triage",
+      "mode": "managed",
+      "type": "aws_lambda_function",
+      "name": "triage",
+      "change": {
+        "actions": ["update"],
+        "before": {"timeout": 30, "tags": {"Owner": "ir"}},
+        "after": {"timeout": 60, "tags": {"Owner": "ir"}}
+      }
+    },
+    {
+      "address": "data.aws_caller_identity.current",
+      "mode": "data",
+      "type": "aws_caller_identity",
+      "name": "current",
+      "change": {"actions": ["read"], "before": null, "after": {}}
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	plan, err := Parse([]byte(planJSON))
+	require.NoError(t, err)
+	require.Len(t, plan.ResourceChanges, 2)
+
+	triage := plan.ResourceChanges[0]
+	assert.Equal(t, "module.lambda_triage.aws_lambda_function.triage", triage.Address)
+	assert.Equal(t, "aws_lambda_function", triage.Type)
+	assert.Equal(t, []string{"update"}, triage.Change.Actions)
+	assert.Equal(t, []string{"timeout"}, triage.ChangedAttributes())
+	assert.Nil(t, plan.ResourceChanges[1].Change.Before)
+
+	_, err = Parse([]byte(`{"resource_changes": {}}`))
+	assert.Error(t, err)
+}
+
+func TestIsNoOp(t *testing.T) {
+	tests := []struct {
+		actions []string
+		want    bool
+	}{
+		{[]string{"no-op"}, true},
+		{[]string{"read"}, true},
+		{nil, true},
+		{[]string{"update"}, false},
+		{[]string{"delete", "create"}, false},
+		{[]string{"create", "delete"}, false},
+	}
+	for _, test := range tests {
+		rc := ResourceChange{Change: Change{Actions: test.actions}}
+		assert.Equal(t, test.want, rc.IsNoOp(), "%v", test.actions)
+	}
+}
+
+func TestChangedAttributes(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after map[string]interface{}
+		want          []string
+	}{
+		{
+			name:   "unchanged",
+			before: map[string]interface{}{"timeout": 30.0},
+			after:  map[string]interface{}{"timeout": 30.0},
+		},
+		{
+			name:   "sorted",
+			before: map[string]interface{}{"timeout": 30.0, "memory_size": 128.0},
+			after:  map[string]interface{}{"timeout": 60.0, "memory_size": 256.0},
+			want:   []string{"memory_size", "timeout"},
+		},
+		{
+			name:   "added and removed",
+			before: map[string]interface{}{"description": "old"},
+			after:  map[string]interface{}{"tags": map[string]interface{}{"Owner": "ir"}},
+			want:   []string{"description", "tags"},
+		},
+		{
+			name:   "nested values compared whole",
+			before: map[string]interface{}{"tags": map[string]interface{}{"Owner": "ir", "Env": "test"}},
+			after:  map[string]interface{}{"tags": map[string]interface{}{"Env": "test", "Owner": "ir"}},
+		},
+		{
+			name:   "create",
+			before: nil,
+			after:  map[string]interface{}{"name": "ir"},
+			want:   []string{"name"},
+		},
+		{
+			name:   "null and absent are the same",
+			before: map[string]interface{}{"kms_key_id": nil},
+			after:  map[string]interface{}{},
+		},
+	}
+	for _, test := range tests {
+		rc := ResourceChange{Change: Change{Before: test.before, After: test.after}}
+		assert.Equal(t, test.want, rc.ChangedAttributes(), test.name)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	update := func(resourceType string, before, after map[string]interface{}) ResourceChange {
+		return ResourceChange{Type: resourceType, Change: Change{Actions: []string{"update"}, Before: before, After: after}}
+	}
+
+	tests := []struct {
+		name string
+		rc   ResourceChange
+		want Category
+	}{
+		{
+			name: "security resource tag change",
+			rc:   update("aws_iam_role", map[string]interface{}{"tags": nil}, map[string]interface{}{"tags": map[string]interface{}{"Owner": "ir"}}),
+			want: CategorySecurity,
+		},
+		{
+			name: "security attribute",
+			rc:   update("aws_lambda_function", map[string]interface{}{"role": "a"}, map[string]interface{}{"role": "b"}),
+			want: CategorySecurity,
+		},
+		{
+			name: "security attribute among cosmetic ones",
+			rc: update("aws_sqs_queue",
+				map[string]interface{}{"tags": nil, "kms_master_key_id": "alias/a"},
+				map[string]interface{}{"tags": map[string]interface{}{}, "kms_master_key_id": "alias/b"}),
+			want: CategorySecurity,
+		},
+		{
+			name: "functional attribute",
+			rc:   update("aws_lambda_function", map[string]interface{}{"timeout": 30.0}, map[string]interface{}{"timeout": 60.0}),
+			want: CategoryFunctional,
+		},
+		{
+			name: "functional and cosmetic attributes",
+			rc: update("aws_lambda_function",
+				map[string]interface{}{"timeout": 30.0, "description": "a"},
+				map[string]interface{}{"timeout": 60.0, "description": "b"}),
+			want: CategoryFunctional,
+		},
+		{
+			name: "tags and description only",
+			rc: update("aws_sns_topic",
+				map[string]interface{}{"tags": nil, "tags_all": nil, "description": "a"},
+				map[string]interface{}{"tags": map[string]interface{}{"Owner": "ir"}, "tags_all": map[string]interface{}{"Owner": "ir"}, "description": "b"}),
+			want: CategoryCosmetic,
+		},
+		{
+			name: "create with only tags",
+			rc:   ResourceChange{Type: "aws_sns_topic", Change: Change{Actions: []string{"create"}, After: map[string]interface{}{"tags": map[string]interface{}{}}}},
+			want: CategoryFunctional,
+		},
+		{
+			name: "replace",
+			rc:   ResourceChange{Type: "aws_sqs_queue", Change: Change{Actions: []string{"delete", "create"}}},
+			want: CategoryFunctional,
+		},
+		{
+			name: "security resource delete",
+			rc:   ResourceChange{Type: "aws_kms_key", Change: Change{Actions: []string{"delete"}}},
+			want: CategorySecurity,
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, Classify(test.rc), test.name)
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	plan := &Plan{ResourceChanges: []ResourceChange{
+		{Address: "aws_iam_role.ir", Type: "aws_iam_role", Change: Change{Actions: []string{"update"},
+			Before: map[string]interface{}{"name": "a"}, After: map[string]interface{}{"name": "b"}}},
+		{Address: "aws_lambda_function.triage", Type: "aws_lambda_function", Change: Change{Actions: []string{"update"},
+			Before: map[string]interface{}{"timeout": 30.0}, After: map[string]interface{}{"timeout": 60.0}}},
+		{Address: "aws_sns_topic.alerts", Type: "aws_sns_topic", Change: Change{Actions: []string{"update"},
+			Before: map[string]interface{}{"tags": nil}, After: map[string]interface{}{"tags": map[string]interface{}{"Owner": "ir"}}}},
+		{Address: "aws_sqs_queue.dlq", Type: "aws_sqs_queue", Change: Change{Actions: []string{"no-op"}}},
+		{Address: "data.aws_iam_policy_document.ir", Mode: "data", Type: "aws_iam_policy_document", Change: Change{Actions: []string{"update"}}},
+	}}
+
+	report := BuildReport(plan)
+	require.True(t, report.HasDrift())
+	assert.Equal(t, "SECURITY-IMPACTING (1)\n"+
+		"  update   aws_iam_role.ir [name]\n"+
+		"FUNCTIONAL (1)\n"+
+		"  update   aws_lambda_function.triage [timeout]\n"+
+		"COSMETIC (1)\n"+
+		"  update   aws_sns_topic.alerts [tags]\n", report.String())
+
+	empty := BuildReport(&Plan{ResourceChanges: plan.ResourceChanges[3:]})
+	assert.False(t, empty.HasDrift())
+	assert.Equal(t, "No drift detected\n", empty.String())
+}
@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StateResource is a managed resource from `terraform show -json` output
+type StateResource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Name    string                 `json:"name"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type stateModule struct {
+	Resources    []StateResource `json:"resources"`
+	ChildModules []stateModule   `json:"child_modules"`
+}
+
+// ParseStateResources flattens all managed resources from `terraform show -json` output
+func ParseStateResources(stateJSON string) ([]StateResource, error) {
+	var state struct {
+		Values struct {
+			RootModule stateModule `json:"root_module"`
+		} `json:"values"`
+	}
+
+	if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+		return nil, fmt.Errorf("failed to parse terraform state JSON: %w", err)
+	}
+
+	var resources []StateResource
+	var walk func(module stateModule)
+	walk = func(module stateModule) {
+		for _, resource := range module.Resources {
+			if resource.Mode == "managed" {
+				resources = append(resources, resource)
+			}
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(state.Values.RootModule)
+
+	return resources, nil
+}
+
+// StateResourcesOfType returns the state resources with the given Terraform type
+func StateResourcesOfType(resources []StateResource, resourceType string) []StateResource {
+	var results []StateResource
+
+	for _, resource := range resources {
+		if resource.Type == resourceType {
+			results = append(results, resource)
+		}
+	}
+
+	return results
+}
+
+// StringValue returns a string attribute of the resource, or "" if missing
+func (r StateResource) StringValue(key string) string {
+	if value, ok := r.Values[key].(string); ok {
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,249 @@
+package timeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sfn"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// Target is the deployment a finding's timeline is read from. Sources left empty are skipped and
+// recorded as gaps.
+type Target struct {
+	Session         *session.Session
+	EvidenceBucket  string
+	StateMachineArn string
+	// TriageFunction is the triage Lambda's name; its log lines come from its log group
+	TriageFunction string
+}
+
+// TargetFromOutputs builds the target from the stack's outputs as returned by terraform.OutputAll
+func TargetFromOutputs(sess *session.Session, outputs map[string]interface{}) Target {
+	value := func(key string) string {
+		s, _ := outputs[key].(string)
+		return s
+	}
+	return Target{
+		Session:         sess,
+		EvidenceBucket:  value("s3_evidence_bucket_name"),
+		StateMachineArn: value("stepfn_ir_state_machine_arn"),
+		TriageFunction:  value("lambda_triage_function_name"),
+	}
+}
+
+// Options shape the window the triage log lines are read from
+type Options struct {
+	// Lead is how long before the first event the window opens, 15 minutes when zero
+	Lead time.Duration
+	// Lag is how long after the last event it closes, 15 minutes when zero
+	Lag time.Duration
+	// Lookback bounds the window when no other source has events, 24 hours when zero
+	Lookback time.Duration
+}
+
+// Build reads the finding's events from every source of the target and merges them. A source that
+// cannot be read is recorded as a gap; Build only fails when no source has any event.
+func Build(target Target, findingID string, opts Options) (*Timeline, error) {
+	if opts.Lead == 0 {
+		opts.Lead = 15 * time.Minute
+	}
+	if opts.Lag == 0 {
+		opts.Lag = 15 * time.Minute
+	}
+	if opts.Lookback == 0 {
+		opts.Lookback = 24 * time.Hour
+	}
+
+	timeline := New(findingID)
+
+	if target.StateMachineArn == "" {
+		timeline.gap(SourceStepFunctions, fmt.Errorf("no state machine given"))
+	} else if events, err := executionEvents(target, findingID); err != nil {
+		timeline.gap(SourceStepFunctions, err)
+	} else {
+		timeline.Add(events...)
+	}
+
+	if target.EvidenceBucket == "" {
+		timeline.gap(SourceS3, fmt.Errorf("no evidence bucket given"))
+	} else if events, err := evidenceEvents(target, findingID); err != nil {
+		timeline.gap(SourceS3, err)
+	} else {
+		timeline.Add(events...)
+	}
+
+	// The log window is anchored on what the other sources found
+	now := clock.Default.Now().UTC()
+	start, end := now.Add(-opts.Lookback), now
+	if len(timeline.Events) > 0 {
+		start = timeline.Events[0].Time.Add(-opts.Lead)
+		if last := timeline.Events[len(timeline.Events)-1].Time.Add(opts.Lag); last.Before(now) {
+			end = last
+		}
+	}
+	if target.TriageFunction == "" {
+		timeline.gap(SourceLambda, fmt.Errorf("no triage function given"))
+	} else if events, err := logEvents(target, findingID, start, end); err != nil {
+		timeline.gap(SourceLambda, err)
+	} else {
+		timeline.Add(events...)
+	}
+
+	if len(timeline.Events) == 0 {
+		return timeline, fmt.Errorf("no events for finding %s%s", findingID, timeline.gapNote())
+	}
+	return timeline, nil
+}
+
+// AddNotification adds the delivery of a notification received through a test subscription
+func (t *Timeline) AddNotification(notification helpers.Notification) {
+	if notification.DeliveredAt.IsZero() {
+		return
+	}
+	detail := "notification delivered"
+	if notification.Attributes["severity"] != "" {
+		detail = fmt.Sprintf("%s notification delivered", notification.Attributes["severity"])
+	}
+	t.Add(Event{Time: notification.DeliveredAt, Source: SourceSNS, Milestone: NotificationDelivered, Detail: detail})
+}
+
+// executionEvents returns the events of every IR execution triage started for the finding: the
+// EventBridge event they were started for, then each state entered, task failed and SNS publish
+func executionEvents(target Target, findingID string) ([]Event, error) {
+	listed, err := helpers.ListExecutions(target.Session, target.StateMachineArn, "", helpers.PageOptions{MaxPages: 20})
+	if err != nil {
+		return nil, err
+	}
+
+	sfnClient := sfn.New(target.Session)
+	prefix := helpers.TriageExecutionPrefix(findingID)
+	var events []Event
+	for _, execution := range listed {
+		name := aws.StringValue(execution.Name)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		described, err := sfnClient.DescribeExecution(&sfn.DescribeExecutionInput{ExecutionArn: execution.ExecutionArn})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe execution %s: %w", name, err)
+		}
+		input, err := helpers.ParseExecutionInput(aws.StringValue(described.Input))
+		if err != nil || input.Detail.ID != findingID {
+			// A truncated prefix can match another finding's executions
+			continue
+		}
+		if received, err := time.Parse(time.RFC3339, input.Time); err == nil {
+			events = append(events, Event{Time: received, Source: SourceEventBridge, Milestone: EventReceived,
+				Detail: fmt.Sprintf("%s event %s", input.DetailType, input.ID)})
+		}
+
+		history, err := helpers.GetStepFunctionExecutionHistory(target.Session, aws.StringValue(execution.ExecutionArn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the history of %s: %w", name, err)
+		}
+		events = append(events, historyEvents(name, history.Events)...)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no IR execution of %s in %s", findingID, target.StateMachineArn)
+	}
+	return events, nil
+}
+
+// historyEvents picks the events of an execution's history a responder follows: its start and end,
+// the states it entered, the tasks that failed and what it published to SNS
+func historyEvents(execution string, history []*sfn.HistoryEvent) []Event {
+	var events []Event
+	for _, event := range history {
+		at := aws.TimeValue(event.Timestamp)
+		kind := aws.StringValue(event.Type)
+
+		switch {
+		case kind == sfn.HistoryEventTypeExecutionStarted:
+			events = append(events, Event{Time: at, Source: SourceStepFunctions, Milestone: ExecutionStarted,
+				Detail: fmt.Sprintf("execution %s started", execution)})
+		case kind == sfn.HistoryEventTypeExecutionSucceeded, kind == sfn.HistoryEventTypeExecutionFailed,
+			kind == sfn.HistoryEventTypeExecutionAborted, kind == sfn.HistoryEventTypeExecutionTimedOut:
+			status := strings.ToLower(strings.TrimPrefix(kind, "Execution"))
+			events = append(events, Event{Time: at, Source: SourceStepFunctions, Milestone: ExecutionFinished,
+				Detail: fmt.Sprintf("execution %s %s", execution, status)})
+		case strings.HasSuffix(kind, "StateEntered") && event.StateEnteredEventDetails != nil:
+			events = append(events, Event{Time: at, Source: SourceStepFunctions,
+				Detail: "entered " + aws.StringValue(event.StateEnteredEventDetails.Name)})
+		case kind == sfn.HistoryEventTypeTaskFailed && event.TaskFailedEventDetails != nil:
+			events = append(events, Event{Time: at, Source: SourceStepFunctions,
+				Detail: fmt.Sprintf("%s task failed: %s", aws.StringValue(event.TaskFailedEventDetails.ResourceType),
+					aws.StringValue(event.TaskFailedEventDetails.Error))})
+		case kind == sfn.HistoryEventTypeTaskSucceeded && event.TaskSucceededEventDetails != nil &&
+			aws.StringValue(event.TaskSucceededEventDetails.ResourceType) == "sns":
+			events = append(events, Event{Time: at, Source: SourceSNS,
+				Detail: fmt.Sprintf("execution %s published to SNS", execution)})
+		}
+	}
+	return events
+}
+
+// evidenceEvents returns when the finding's evidence was stored, and when triage says it triaged
+// the finding if the object's metadata records it
+func evidenceEvents(target Target, findingID string) ([]Event, error) {
+	key := helpers.EvidenceKey(findingID, "")
+	object, err := s3.New(target.Session).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(target.EvidenceBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to head evidence %s: %w", key, err)
+	}
+
+	events := []Event{{Time: aws.TimeValue(object.LastModified), Source: SourceS3, Milestone: EvidenceStored,
+		Detail: fmt.Sprintf("evidence stored at s3://%s/%s", target.EvidenceBucket, key)}}
+	for name, value := range object.Metadata {
+		if strings.ToLower(name) != "triaged-at" {
+			continue
+		}
+		// Metadata timestamps are whole seconds; they place triage, not order it against the logs
+		if seconds, err := strconv.ParseInt(aws.StringValue(value), 10, 64); err == nil {
+			events = append(events, Event{Time: time.Unix(seconds, 0), Source: SourceS3, Detail: "triaged-at recorded on the evidence"})
+		}
+	}
+	return events, nil
+}
+
+// logEvents returns the triage log lines naming the finding within the window. The lines about
+// starting triage and publishing the notification are milestones.
+func logEvents(target Target, findingID string, start, end time.Time) ([]Event, error) {
+	logGroup := "/aws/lambda/" + target.TriageFunction
+	var events []Event
+
+	err := cloudwatchlogs.New(target.Session).FilterLogEventsPages(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		FilterPattern: aws.String(strconv.Quote(findingID)),
+		StartTime:     aws.Int64(start.UnixMilli()),
+		EndTime:       aws.Int64(end.UnixMilli()),
+	}, func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+		for _, line := range page.Events {
+			message := strings.TrimSpace(aws.StringValue(line.Message))
+			event := Event{Time: time.UnixMilli(aws.Int64Value(line.Timestamp)), Source: SourceLambda, Detail: message}
+			switch {
+			case strings.HasPrefix(message, "Processing finding"):
+				event.Milestone = TriageStarted
+			case strings.HasPrefix(message, "Published ") && strings.Contains(message, " notification "):
+				event.Source, event.Milestone = SourceSNS, NotificationPublished
+			}
+			events = append(events, event)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", logGroup, err)
+	}
+	return events, nil
+}
@@ -0,0 +1,167 @@
+// Package timeline reconstructs what happened to one finding as a single ordered timeline: when
+// EventBridge received it, what the triage Lambda logged about it, every step of its IR
+// executions, when its evidence was stored and when its notification was published and delivered.
+// Tests assert SLOs on the time between milestones; the ir-evidence timeline command prints it for
+// responders.
+package timeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Sources of timeline events
+const (
+	SourceEventBridge   = "eventbridge"
+	SourceLambda        = "lambda"
+	SourceStepFunctions = "stepfunctions"
+	SourceS3            = "s3"
+	SourceSNS           = "sns"
+)
+
+// Milestones are the events SLOs are measured between. A finding triaged more than once reaches
+// each milestone once per triage; the timeline measures from the first.
+const (
+	// EventReceived is the time on the finding's EventBridge event, when the bus accepted it
+	EventReceived = "event-received"
+	// TriageStarted is the triage Lambda's first log line about the finding
+	TriageStarted = "triage-started"
+	// EvidenceStored is when the evidence object was last written
+	EvidenceStored = "evidence-stored"
+	// ExecutionStarted is the start of an IR execution of the finding
+	ExecutionStarted = "execution-started"
+	// ExecutionFinished is the end of an IR execution, whatever its status
+	ExecutionFinished = "execution-finished"
+	// NotificationPublished is when triage published the finding's notification to SNS
+	NotificationPublished = "notification-published"
+	// NotificationDelivered is when SNS delivered the notification to a test subscription
+	NotificationDelivered = "notification-delivered"
+)
+
+// Event is one thing that happened to the finding
+type Event struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// Milestone is set on the events SLOs are measured between
+	Milestone string `json:"milestone,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// Gap is a source that could not be read, so the reader knows the timeline is missing its events
+// rather than assuming they never happened
+type Gap struct {
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// Timeline is the events of one finding, oldest first
+type Timeline struct {
+	FindingID string  `json:"finding_id"`
+	Events    []Event `json:"events"`
+	Gaps      []Gap   `json:"gaps,omitempty"`
+}
+
+// New returns an empty timeline for the finding
+func New(findingID string) *Timeline {
+	return &Timeline{FindingID: findingID, Events: []Event{}}
+}
+
+// Add merges events into the timeline. Events at the same time keep the order they were added in.
+func (t *Timeline) Add(events ...Event) {
+	for _, event := range events {
+		event.Time = event.Time.UTC()
+		t.Events = append(t.Events, event)
+	}
+	sort.SliceStable(t.Events, func(i, j int) bool { return t.Events[i].Time.Before(t.Events[j].Time) })
+}
+
+// gap records a source that could not be read
+func (t *Timeline) gap(source string, err error) {
+	t.Gaps = append(t.Gaps, Gap{Source: source, Reason: err.Error()})
+}
+
+// Milestone returns the first event that reached the milestone
+func (t *Timeline) Milestone(name string) (Event, bool) {
+	for _, event := range t.Events {
+		if event.Milestone == name {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
+// Elapsed returns the time from the first event reaching one milestone to the first reaching the other
+func (t *Timeline) Elapsed(from, to string) (time.Duration, error) {
+	start, ok := t.Milestone(from)
+	if !ok {
+		return 0, fmt.Errorf("finding %s never reached %s%s", t.FindingID, from, t.gapNote())
+	}
+	end, ok := t.Milestone(to)
+	if !ok {
+		return 0, fmt.Errorf("finding %s never reached %s%s", t.FindingID, to, t.gapNote())
+	}
+	return end.Time.Sub(start.Time), nil
+}
+
+// AssertWithin checks that the finding went from one milestone to the other within the budget
+func (t *Timeline) AssertWithin(from, to string, budget time.Duration) error {
+	elapsed, err := t.Elapsed(from, to)
+	if err != nil {
+		return err
+	}
+	if elapsed > budget {
+		return fmt.Errorf("finding %s took %s from %s to %s, budget %s", t.FindingID, elapsed, from, to, budget)
+	}
+	return nil
+}
+
+// AssertOrder checks that the finding reached the milestones in the given order
+func (t *Timeline) AssertOrder(milestones ...string) error {
+	var previous Event
+	for i, name := range milestones {
+		event, ok := t.Milestone(name)
+		if !ok {
+			return fmt.Errorf("finding %s never reached %s%s", t.FindingID, name, t.gapNote())
+		}
+		if i > 0 && event.Time.Before(previous.Time) {
+			return fmt.Errorf("finding %s reached %s at %s, before %s at %s", t.FindingID,
+				name, event.Time.Format(time.RFC3339Nano), milestones[i-1], previous.Time.Format(time.RFC3339Nano))
+		}
+		previous = event
+	}
+	return nil
+}
+
+// gapNote names the sources that could not be read, for errors about missing milestones
+func (t *Timeline) gapNote() string {
+	if len(t.Gaps) == 0 {
+		return ""
+	}
+	sources := make([]string, 0, len(t.Gaps))
+	for _, gap := range t.Gaps {
+		sources = append(sources, gap.Source)
+	}
+	return fmt.Sprintf(" (not read: %s)", strings.Join(sources, ", "))
+}
+
+// String renders the timeline as a table, each event with its offset from the first, then the gaps
+func (t *Timeline) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Timeline of %s:\n", t.FindingID)
+
+	table := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  TIME\tOFFSET\tSOURCE\tMILESTONE\tDETAIL")
+	for _, event := range t.Events {
+		fmt.Fprintf(table, "  %s\t+%s\t%s\t%s\t%s\n", event.Time.Format("2006-01-02T15:04:05.000Z"),
+			event.Time.Sub(t.Events[0].Time).Round(time.Millisecond), event.Source, event.Milestone, event.Detail)
+	}
+	table.Flush()
+
+	for _, gap := range t.Gaps {
+		fmt.Fprintf(&b, "  not read: %s: %s\n", gap.Source, gap.Reason)
+	}
+	return b.String()
+}
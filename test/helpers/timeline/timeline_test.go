@@ -0,0 +1,195 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func at(offset time.Duration) time.Time {
+	return start.Add(offset)
+}
+
+func details(events []Event) []string {
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Detail)
+	}
+	return names
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][]Event
+		want    []string
+	}{
+		{
+			name: "sorted by time",
+			batches: [][]Event{{
+				{Time: at(2 * time.Second), Detail: "c"},
+				{Time: at(0), Detail: "a"},
+				{Time: at(time.Second), Detail: "b"},
+			}},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "ties keep the order added within a batch",
+			batches: [][]Event{{
+				{Time: at(time.Second), Detail: "first"},
+				{Time: at(time.Second), Detail: "second"},
+				{Time: at(0), Detail: "earlier"},
+				{Time: at(time.Second), Detail: "third"},
+			}},
+			want: []string{"earlier", "first", "second", "third"},
+		},
+		{
+			name: "ties keep the order added across batches",
+			batches: [][]Event{
+				{{Time: at(time.Second), Detail: "lambda"}},
+				{{Time: at(time.Second), Detail: "stepfunctions"}, {Time: at(0), Detail: "eventbridge"}},
+				{{Time: at(time.Second), Detail: "s3"}},
+			},
+			want: []string{"eventbridge", "lambda", "stepfunctions", "s3"},
+		},
+		{
+			name: "same instant in another zone is a tie",
+			batches: [][]Event{
+				{{Time: at(time.Second), Detail: "utc"}},
+				{{Time: at(time.Second).In(time.FixedZone("CET", 3600)), Detail: "cet"}},
+			},
+			want: []string{"utc", "cet"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeline := New("f-1")
+			for _, batch := range test.batches {
+				timeline.Add(batch...)
+			}
+			assert.Equal(t, test.want, details(timeline.Events))
+			for _, event := range timeline.Events {
+				assert.Equal(t, time.UTC, event.Time.Location(), event.Detail)
+			}
+		})
+	}
+}
+
+func TestMilestone(t *testing.T) {
+	timeline := New("f-1")
+	timeline.Add(
+		Event{Time: at(5 * time.Second), Milestone: ExecutionStarted, Detail: "retriage"},
+		Event{Time: at(time.Second), Milestone: ExecutionStarted, Detail: "triage"},
+		Event{Time: at(time.Second), Milestone: ExecutionStarted, Detail: "triage again"},
+	)
+
+	event, ok := timeline.Milestone(ExecutionStarted)
+	require.True(t, ok)
+	assert.Equal(t, "triage", event.Detail, "the first event reaching the milestone, the first added on a tie")
+
+	_, ok = timeline.Milestone(NotificationDelivered)
+	assert.False(t, ok)
+}
+
+func TestElapsed(t *testing.T) {
+	timeline := New("f-1")
+	timeline.Add(
+		Event{Time: at(0), Milestone: EventReceived},
+		Event{Time: at(3 * time.Second), Milestone: TriageStarted},
+		Event{Time: at(3 * time.Second), Milestone: EvidenceStored},
+		Event{Time: at(40 * time.Second), Milestone: ExecutionFinished},
+	)
+
+	tests := []struct {
+		from, to string
+		want     time.Duration
+		wantErr  string
+	}{
+		{from: EventReceived, to: TriageStarted, want: 3 * time.Second},
+		{from: TriageStarted, to: EvidenceStored, want: 0},
+		{from: ExecutionFinished, to: EventReceived, want: -40 * time.Second},
+		{from: EventReceived, to: NotificationDelivered, wantErr: "finding f-1 never reached notification-delivered"},
+		{from: ExecutionStarted, to: ExecutionFinished, wantErr: "finding f-1 never reached execution-started"},
+	}
+	for _, test := range tests {
+		elapsed, err := timeline.Elapsed(test.from, test.to)
+		if test.wantErr != "" {
+			assert.EqualError(t, err, test.wantErr, "%s to %s", test.from, test.to)
+			continue
+		}
+		require.NoError(t, err, "%s to %s", test.from, test.to)
+		assert.Equal(t, test.want, elapsed, "%s to %s", test.from, test.to)
+	}
+}
+
+func TestAssertWithin(t *testing.T) {
+	timeline := New("f-1")
+	timeline.Add(
+		Event{Time: at(0), Milestone: EventReceived},
+		Event{Time: at(30 * time.Second), Milestone: NotificationDelivered},
+	)
+
+	assert.NoError(t, timeline.AssertWithin(EventReceived, NotificationDelivered, 30*time.Second), "the budget is inclusive")
+	assert.EqualError(t, timeline.AssertWithin(EventReceived, NotificationDelivered, 29*time.Second),
+		"finding f-1 took 30s from event-received to notification-delivered, budget 29s")
+}
+
+func TestAssertOrder(t *testing.T) {
+	timeline := New("f-1")
+	timeline.Add(
+		Event{Time: at(0), Milestone: EventReceived},
+		Event{Time: at(2 * time.Second), Milestone: TriageStarted},
+		Event{Time: at(2 * time.Second), Milestone: EvidenceStored},
+		Event{Time: at(time.Second), Milestone: NotificationPublished},
+	)
+
+	tests := []struct {
+		name       string
+		milestones []string
+		wantErr    string
+	}{
+		{name: "in order", milestones: []string{EventReceived, TriageStarted, EvidenceStored}},
+		{name: "ties satisfy either order", milestones: []string{EvidenceStored, TriageStarted}},
+		{name: "out of order", milestones: []string{TriageStarted, NotificationPublished},
+			wantErr: "finding f-1 reached notification-published at 2024-03-01T12:00:01Z, before triage-started at 2024-03-01T12:00:02Z"},
+		{name: "never reached", milestones: []string{EventReceived, ExecutionStarted},
+			wantErr: "finding f-1 never reached execution-started"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := timeline.AssertOrder(test.milestones...)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestGaps(t *testing.T) {
+	timeline := New("f-1")
+	timeline.gap(SourceLambda, assert.AnError)
+	timeline.gap(SourceSNS, assert.AnError)
+
+	_, err := timeline.Elapsed(TriageStarted, NotificationDelivered)
+	assert.EqualError(t, err, "finding f-1 never reached triage-started (not read: lambda, sns)")
+	assert.Contains(t, timeline.String(), "not read: sns: "+assert.AnError.Error())
+}
+
+func TestString(t *testing.T) {
+	timeline := New("f-1")
+	timeline.Add(
+		Event{Time: at(0), Source: SourceEventBridge, Milestone: EventReceived, Detail: "GuardDuty Finding"},
+		Event{Time: at(1500 * time.Millisecond), Source: SourceLambda, Detail: "triaging"},
+	)
+
+	assert.Equal(t, "Timeline of f-1:\n"+
+		"  TIME                      OFFSET  SOURCE       MILESTONE       DETAIL\n"+
+		"  2024-03-01T12:00:00.000Z  +0s     eventbridge  event-received  GuardDuty Finding\n"+
+		"  2024-03-01T12:00:01.500Z  +1.5s   lambda                       triaging\n", timeline.String())
+}
@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// serviceName identifies the harness in the tracing backend
+const serviceName = "threat-detection-ir-tests"
+
+var (
+	setupOnce sync.Once
+	provider  *sdktrace.TracerProvider
+	tracer    trace.Tracer = noop.NewTracerProvider().Tracer(serviceName)
+)
+
+// setup exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or the traces-specific
+// variant) is set. The exporter reads the rest of its configuration from the standard OTEL_*
+// variables. Without an endpoint every span is a no-op.
+func setup() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		// Tracing is a debugging aid and must never fail a test run
+		return
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	tracer = provider.Tracer(serviceName)
+}
+
+// sessionTrace is the span stack of one instrumented session. Steps push onto it so AWS calls made
+// during a step become its children; parallel subtests sharing a session may attach calls to a
+// sibling's step.
+type sessionTrace struct {
+	mu    sync.Mutex
+	stack []context.Context
+}
+
+func (s *sessionTrace) current() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stack[len(s.stack)-1]
+}
+
+func (s *sessionTrace) push(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stack = append(s.stack, ctx)
+}
+
+func (s *sessionTrace) pop(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.stack) - 1; i > 0; i-- {
+		if s.stack[i] == ctx {
+			s.stack = append(s.stack[:i], s.stack[i+1:]...)
+			return
+		}
+	}
+}
+
+var sessions sync.Map // *session.Session -> *sessionTrace
+
+// Run is the root span of one test
+type Run struct {
+	span trace.Span
+	sess *session.Session
+}
+
+// Instrument starts the root span of a test and adds SDK middleware to the session that records
+// every AWS call as a span under the current step
+func Instrument(sess *session.Session, testName string) *Run {
+	setupOnce.Do(setup)
+
+	ctx, span := tracer.Start(context.Background(), testName, trace.WithAttributes(attribute.String("test.name", testName)))
+	state := &sessionTrace{stack: []context.Context{ctx}}
+	sessions.Store(sess, state)
+
+	sess.Handlers.Validate.PushFront(func(r *request.Request) {
+		_, span := tracer.Start(state.current(), r.ClientInfo.ServiceName+"."+r.Operation.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "aws-api"),
+				attribute.String("rpc.service", r.ClientInfo.ServiceName),
+				attribute.String("rpc.method", r.Operation.Name),
+			))
+		// Keep the caller's context, and its cancellation, for the request itself
+		r.SetContext(trace.ContextWithSpan(r.Context(), span))
+	})
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(
+			attribute.String("aws.request_id", r.RequestID),
+			attribute.Int("aws.retries", r.RetryCount),
+		)
+		if r.Error != nil {
+			code := r.Error.Error()
+			if aerr, ok := r.Error.(awserr.Error); ok {
+				code = aerr.Code()
+			}
+			span.SetStatus(codes.Error, code)
+		}
+		span.End()
+	})
+
+	return &Run{span: span, sess: sess}
+}
+
+// Failer is the part of *testing.T used to mark the root span failed
+type Failer interface {
+	Failed() bool
+}
+
+// End closes the root span, marking it failed with the test, and flushes pending spans
+func (r *Run) End(t Failer) {
+	if t.Failed() {
+		r.span.SetStatus(codes.Error, "test failed")
+	}
+	r.span.End()
+	sessions.Delete(r.sess)
+
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = provider.ForceFlush(ctx)
+	}
+}
+
+// Step starts a span for a harness step such as inject or wait-for-execution on an instrumented
+// session and returns the function that ends it, recording the step's error:
+//
+//	defer tracing.Step(sess, "wait-for-execution")(&err)
+//
+// On a session without Instrument it does nothing.
+func Step(sess *session.Session, name string) func(*error) {
+	value, ok := sessions.Load(sess)
+	if !ok {
+		return func(*error) {}
+	}
+	state := value.(*sessionTrace)
+
+	ctx, span := tracer.Start(state.current(), name)
+	state.push(ctx)
+
+	return func(errp *error) {
+		if errp != nil && *errp != nil {
+			span.RecordError(*errp)
+			span.SetStatus(codes.Error, (*errp).Error())
+		}
+		state.pop(ctx)
+		span.End()
+	}
+}
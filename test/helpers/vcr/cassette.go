@@ -0,0 +1,132 @@
+package vcr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CassetteVersion is the format version written to cassettes; Load rejects other versions
+const CassetteVersion = 1
+
+// Interaction is one recorded AWS API call: the request that identifies it and the response that
+// is played back for it
+type Interaction struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	Method    string `json:"method"`
+	// Path is the sanitized path and query of the request URL; the host, which names the region and
+	// for S3 the bucket, is left out
+	Path     string   `json:"path"`
+	Body     string   `json:"body,omitempty"`
+	Response Response `json:"response"`
+}
+
+// Response is the sanitized HTTP response of an interaction
+type Response struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+}
+
+// Cassette is the recording of a run: every interaction in the order it happened
+type Cassette struct {
+	Version      int           `json:"version"`
+	Name         string        `json:"name"`
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewCassette returns an empty cassette to record into
+func NewCassette(name string) *Cassette {
+	return &Cassette{Version: CassetteVersion, Name: name, Interactions: []Interaction{}}
+}
+
+// Load reads a cassette written by Save
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("cassette %s is not valid JSON: %w", path, err)
+	}
+	if cassette.Version != CassetteVersion {
+		return nil, fmt.Errorf("cassette %s has version %d, expected %d; record it again", path, cassette.Version, CassetteVersion)
+	}
+	cassette.used = make([]bool, len(cassette.Interactions))
+	return cassette, nil
+}
+
+// Save writes the cassette as indented JSON, creating its directory
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassette) add(interaction Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+// next returns the first unplayed interaction of the operation whose body matches, or with strict
+// unset the first unplayed interaction of the operation at all. Requests of a wait loop differ in
+// nothing but their timestamps, so in order is the best match when the body has changed.
+func (c *Cassette) next(service, operation, body string, strict bool) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fallback := -1
+	for i, interaction := range c.Interactions {
+		if c.used[i] || interaction.Service != service || interaction.Operation != operation {
+			continue
+		}
+		if interaction.Body == body {
+			c.used[i] = true
+			return interaction, true
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+
+	if strict || fallback < 0 {
+		return Interaction{}, false
+	}
+	c.used[fallback] = true
+	return c.Interactions[fallback], true
+}
+
+// Unplayed returns how many interactions have not been played back, so a replay test can check that
+// the code under test made every call the recording did
+func (c *Cassette) Unplayed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unplayed := 0
+	for _, used := range c.used {
+		if !used {
+			unplayed++
+		}
+	}
+	return unplayed
+}
@@ -0,0 +1,167 @@
+package victims
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// AutoScalingGroup is a victim Auto Scaling group of one instance in the default VPC. Findings name
+// Instance, the instance the group launched first.
+type AutoScalingGroup struct {
+	Name             string
+	LaunchTemplateID string
+	Instance         *Instance
+}
+
+// AutoScalingGroup creates a group that keeps one t3.micro victim in service and waits for it.
+// Instances the group launches shut themselves down when their TTL runs out, like other victims.
+func (s *Set) AutoScalingGroup() (*AutoScalingGroup, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	if len(s.instances) >= s.Limits.MaxInstances {
+		return nil, fmt.Errorf("victim set already has the maximum of %d instances", s.Limits.MaxInstances)
+	}
+
+	ami, err := helpers.LatestAmazonLinuxAMI(s.sess)
+	if err != nil {
+		return nil, err
+	}
+	subnetID, err := helpers.DefaultSubnet(s.sess)
+	if err != nil {
+		return nil, err
+	}
+
+	var ec2Tags []*ec2.Tag
+	var groupTags []*autoscaling.Tag
+	for key, value := range s.tags() {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+		groupTags = append(groupTags, &autoscaling.Tag{Key: aws.String(key), Value: aws.String(value), PropagateAtLaunch: aws.Bool(false)})
+	}
+
+	name := s.name("asg", len(s.groups)+1)
+	template, err := ec2.New(s.sess).CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String(name),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{
+			ImageId:                           aws.String(ami),
+			InstanceType:                      aws.String(ec2.InstanceTypeT3Micro),
+			InstanceInitiatedShutdownBehavior: aws.String(ec2.ShutdownBehaviorTerminate),
+			UserData:                          aws.String(helpers.TestInstanceOptions{ShutdownAfter: s.Limits.TTL}.UserData()),
+			MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+				HttpTokens: aws.String(ec2.LaunchTemplateHttpTokensStateRequired),
+			},
+			// Tagged at launch so Reap finds replacements too
+			TagSpecifications: []*ec2.LaunchTemplateTagSpecificationRequest{
+				{ResourceType: aws.String(ec2.ResourceTypeInstance), Tags: ec2Tags},
+			},
+		},
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String(ec2.ResourceTypeLaunchTemplate), Tags: ec2Tags},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create launch template %s: %w", name, err)
+	}
+	group := &AutoScalingGroup{Name: name, LaunchTemplateID: aws.StringValue(template.LaunchTemplate.LaunchTemplateId)}
+	// Track the group before creating it, so Cleanup removes the template if the rest fails
+	s.groups = append(s.groups, group)
+
+	if _, err := autoscaling.New(s.sess).CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateId: template.LaunchTemplate.LaunchTemplateId,
+			Version:          aws.String("$Latest"),
+		},
+		MinSize:           aws.Int64(1),
+		MaxSize:           aws.Int64(1),
+		DesiredCapacity:   aws.Int64(1),
+		VPCZoneIdentifier: aws.String(subnetID),
+		HealthCheckType:   aws.String("EC2"),
+		Tags:              groupTags,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create victim Auto Scaling group %s: %w", name, err)
+	}
+
+	instanceID, err := s.InServiceInstance(group, "", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	group.Instance = &Instance{ID: instanceID, InstanceType: ec2.InstanceTypeT3Micro}
+	// Tracked so Cleanup terminates it once it has been detached from the group
+	s.instances = append(s.instances, group.Instance)
+	return group, s.describe(group.Instance)
+}
+
+// InServiceInstance waits until the group has an instance in service other than exclude, e.g. the
+// replacement of an instance that was detached, and returns its ID
+func (s *Set) InServiceInstance(group *AutoScalingGroup, exclude string, timeout time.Duration) (string, error) {
+	autoscalingClient := autoscaling.New(s.sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for clock.Default.Now().Before(deadline) {
+		groups, err := autoscalingClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(group.Name)},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe %s: %w", group.Name, err)
+		}
+		for _, described := range groups.AutoScalingGroups {
+			for _, instance := range described.Instances {
+				instanceID := aws.StringValue(instance.InstanceId)
+				if instanceID != exclude && aws.StringValue(instance.LifecycleState) == autoscaling.LifecycleStateInService {
+					return instanceID, nil
+				}
+			}
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+
+	return "", fmt.Errorf("%s had no instance in service besides %q within %s", group.Name, exclude, timeout)
+}
+
+// GroupOf returns the Auto Scaling group an instance belongs to, or "" if it is in none
+func GroupOf(sess *session.Session, instanceID string) (string, error) {
+	instances, err := autoscaling.New(sess).DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe Auto Scaling membership of %s: %w", instanceID, err)
+	}
+	if len(instances.AutoScalingInstances) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(instances.AutoScalingInstances[0].AutoScalingGroupName), nil
+}
+
+// deleteAutoScalingGroup force-deletes a victim group, terminating the instances still in it, and its
+// launch template. A group that was never created is skipped.
+func deleteAutoScalingGroup(sess *session.Session, name, launchTemplateID string) error {
+	if _, err := autoscaling.New(sess).DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		ForceDelete:          aws.Bool(true),
+	}); err != nil {
+		// A group that does not exist is reported as a validation error
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != "ValidationError" {
+			return fmt.Errorf("failed to delete victim Auto Scaling group %s: %w", name, err)
+		}
+	}
+
+	if launchTemplateID == "" {
+		return nil
+	}
+	if _, err := ec2.New(sess).DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{
+		LaunchTemplateId: aws.String(launchTemplateID),
+	}); err != nil {
+		return fmt.Errorf("failed to delete launch template of %s: %w", name, err)
+	}
+	return nil
+}
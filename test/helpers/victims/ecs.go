@@ -0,0 +1,347 @@
+package victims
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// ECSOptimizedAMIParameter resolves the current ECS-optimized Amazon Linux 2023 AMI
+const ECSOptimizedAMIParameter = "/aws/service/ecs/optimized-ami/amazon-linux-2023/recommended/image_id"
+
+// ecsInstancePolicy is the managed policy container instances need to register with their cluster
+const ecsInstancePolicy = "service-role/AmazonEC2ContainerServiceforEC2Role"
+
+// ECSService is a victim ECS cluster running a service of one task on EC2 container instances, so
+// the task has a host the scheduler could relaunch it on. The cluster, service, task definition
+// family and the hosts' instance profile all share one name.
+type ECSService struct {
+	Name              string
+	ClusterARN        string
+	TaskDefinitionARN string
+	// Hosts are the cluster's container instances
+	Hosts []*Instance
+	// Task is the service's task when it first came up
+	Task *ECSTask
+}
+
+// ECSTask is a running task of a victim service
+type ECSTask struct {
+	ARN                  string
+	ClusterARN           string
+	DefinitionARN        string
+	ContainerInstanceARN string
+	// HostID is the EC2 instance the task runs on
+	HostID     string
+	Containers []*ecs.Container
+}
+
+// Resource implements Victim, in the shape of a GuardDuty Runtime Monitoring finding on a task
+func (t *ECSTask) Resource() map[string]interface{} {
+	containers := []map[string]interface{}{}
+	for _, container := range t.Containers {
+		containers = append(containers, map[string]interface{}{
+			"name":             aws.StringValue(container.Name),
+			"image":            aws.StringValue(container.Image),
+			"id":               aws.StringValue(container.RuntimeId),
+			"containerRuntime": "docker",
+		})
+	}
+	return map[string]interface{}{
+		"resourceType": "ECSCluster",
+		"ecsClusterDetails": map[string]interface{}{
+			"name":   t.ClusterARN[strings.LastIndex(t.ClusterARN, "/")+1:],
+			"arn":    t.ClusterARN,
+			"status": "ACTIVE",
+			"taskDetails": map[string]interface{}{
+				"arn":           t.ARN,
+				"definitionArn": t.DefinitionARN,
+				"containers":    containers,
+			},
+		},
+	}
+}
+
+// ECSService creates a cluster of hosts container instances and a service keeping one task running
+// on them, and waits for the task. Hosts count against MaxInstances and shut themselves down when
+// their TTL runs out, like other victims.
+func (s *Set) ECSService(hosts int) (*ECSService, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	if len(s.instances)+hosts > s.Limits.MaxInstances {
+		return nil, fmt.Errorf("victim set cannot launch %d more instances within the maximum of %d", hosts, s.Limits.MaxInstances)
+	}
+
+	ecsClient := ecs.New(s.sess)
+	name := s.name("ecs", len(s.services)+1)
+	var tags []*ecs.Tag
+	for key, value := range s.tags() {
+		tags = append(tags, &ecs.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	// Tracked before anything is created, so Cleanup removes whatever part of it exists
+	service := &ECSService{Name: name}
+	s.services = append(s.services, service)
+
+	cluster, err := ecsClient.CreateCluster(&ecs.CreateClusterInput{ClusterName: aws.String(name), Tags: tags})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create victim cluster %s: %w", name, err)
+	}
+	service.ClusterARN = aws.StringValue(cluster.Cluster.ClusterArn)
+
+	if err := helpers.CreateInstanceProfile(s.sess, name, ecsInstancePolicyARN(s.sess)); err != nil {
+		return nil, err
+	}
+	var roleTags []*iam.Tag
+	for key, value := range s.tags() {
+		roleTags = append(roleTags, &iam.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := iam.New(s.sess).TagRole(&iam.TagRoleInput{RoleName: aws.String(name), Tags: roleTags}); err != nil {
+		return nil, fmt.Errorf("failed to tag victim role %s: %w", name, err)
+	}
+
+	ami, err := ssm.New(s.sess).GetParameter(&ssm.GetParameterInput{Name: aws.String(ECSOptimizedAMIParameter)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve ECS-optimized AMI: %w", err)
+	}
+	for i := 0; i < hosts; i++ {
+		host, err := s.launch(helpers.TestInstanceOptions{
+			AMI:             aws.StringValue(ami.Parameter.Value),
+			InstanceProfile: name,
+			Script:          fmt.Sprintf("echo ECS_CLUSTER=%s >> /etc/ecs/ecs.config", name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		service.Hosts = append(service.Hosts, host)
+	}
+	if err := waitForContainerInstances(ecsClient, name, hosts, 10*time.Minute); err != nil {
+		return nil, err
+	}
+
+	definition, err := ecsClient.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:                  aws.String(name),
+		RequiresCompatibilities: []*string{aws.String(ecs.CompatibilityEc2)},
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:      aws.String("victim"),
+			Image:     aws.String("public.ecr.aws/docker/library/busybox:stable"),
+			Command:   aws.StringSlice([]string{"sleep", fmt.Sprint(int(s.Limits.TTL.Seconds()))}),
+			Memory:    aws.Int64(64),
+			Essential: aws.Bool(true),
+		}},
+		Tags: tags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register task definition %s: %w", name, err)
+	}
+	service.TaskDefinitionARN = aws.StringValue(definition.TaskDefinition.TaskDefinitionArn)
+
+	if _, err := ecsClient.CreateService(&ecs.CreateServiceInput{
+		Cluster:        aws.String(name),
+		ServiceName:    aws.String(name),
+		TaskDefinition: definition.TaskDefinition.TaskDefinitionArn,
+		DesiredCount:   aws.Int64(1),
+		LaunchType:     aws.String(ecs.LaunchTypeEc2),
+		Tags:           tags,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create victim service %s: %w", name, err)
+	}
+
+	service.Task, err = s.RunningTask(service, "", 10*time.Minute)
+	return service, err
+}
+
+func ecsInstancePolicyARN(sess *session.Session) string {
+	return helpers.SessionPartition(sess).ARN("iam", "", "aws", "policy/"+ecsInstancePolicy)
+}
+
+// waitForContainerInstances waits until count container instances are registered and active
+func waitForContainerInstances(ecsClient *ecs.ECS, cluster string, count int, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+	for clock.Default.Now().Before(deadline) {
+		instances, err := ecsClient.ListContainerInstances(&ecs.ListContainerInstancesInput{
+			Cluster: aws.String(cluster),
+			Status:  aws.String(ecs.ContainerInstanceStatusActive),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list container instances of %s: %w", cluster, err)
+		}
+		if len(instances.ContainerInstanceArns) >= count {
+			return nil
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+	return fmt.Errorf("%d container instances did not register with %s within %s", count, cluster, timeout)
+}
+
+// RunningTask waits until the service has a running task other than exclude, e.g. the one the
+// scheduler launched to replace a stopped task, and returns it with the host it runs on
+func (s *Set) RunningTask(service *ECSService, exclude string, timeout time.Duration) (*ECSTask, error) {
+	ecsClient := ecs.New(s.sess)
+	deadline := clock.Default.Now().Add(timeout)
+
+	for clock.Default.Now().Before(deadline) {
+		listed, err := ecsClient.ListTasks(&ecs.ListTasksInput{
+			Cluster:       aws.String(service.Name),
+			ServiceName:   aws.String(service.Name),
+			DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks of %s: %w", service.Name, err)
+		}
+		if len(listed.TaskArns) > 0 {
+			described, err := ecsClient.DescribeTasks(&ecs.DescribeTasksInput{
+				Cluster: aws.String(service.Name),
+				Tasks:   listed.TaskArns,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe tasks of %s: %w", service.Name, err)
+			}
+			for _, task := range described.Tasks {
+				if aws.StringValue(task.TaskArn) == exclude || aws.StringValue(task.LastStatus) != ecs.DesiredStatusRunning {
+					continue
+				}
+				return describedTask(ecsClient, task)
+			}
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+
+	return nil, fmt.Errorf("%s had no running task besides %q within %s", service.Name, exclude, timeout)
+}
+
+// describedTask resolves the EC2 instance behind a task's container instance
+func describedTask(ecsClient *ecs.ECS, task *ecs.Task) (*ECSTask, error) {
+	result := &ECSTask{
+		ARN:                  aws.StringValue(task.TaskArn),
+		ClusterARN:           aws.StringValue(task.ClusterArn),
+		DefinitionARN:        aws.StringValue(task.TaskDefinitionArn),
+		ContainerInstanceARN: aws.StringValue(task.ContainerInstanceArn),
+		Containers:           task.Containers,
+	}
+	if result.ContainerInstanceARN == "" {
+		return result, nil
+	}
+	instances, err := ecsClient.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
+		Cluster:            task.ClusterArn,
+		ContainerInstances: []*string{task.ContainerInstanceArn},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the host of %s: %w", result.ARN, err)
+	}
+	if len(instances.ContainerInstances) > 0 {
+		result.HostID = aws.StringValue(instances.ContainerInstances[0].Ec2InstanceId)
+	}
+	return result, nil
+}
+
+// ContainerInstanceStatus returns the status of a container instance, e.g. ACTIVE or DRAINING
+func ContainerInstanceStatus(sess *session.Session, clusterARN, containerInstanceARN string) (string, error) {
+	instances, err := ecs.New(sess).DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(clusterARN),
+		ContainerInstances: []*string{aws.String(containerInstanceARN)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe %s: %w", containerInstanceARN, err)
+	}
+	if len(instances.ContainerInstances) == 0 {
+		return "", fmt.Errorf("container instance %s not found", containerInstanceARN)
+	}
+	return aws.StringValue(instances.ContainerInstances[0].Status), nil
+}
+
+// TaskStopReason returns the desired status of a task and the reason it was stopped, if it was
+func TaskStopReason(sess *session.Session, clusterARN, taskARN string) (string, string, error) {
+	tasks, err := ecs.New(sess).DescribeTasks(&ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterARN),
+		Tasks:   []*string{aws.String(taskARN)},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to describe %s: %w", taskARN, err)
+	}
+	if len(tasks.Tasks) == 0 {
+		return "", "", fmt.Errorf("task %s not found", taskARN)
+	}
+	return aws.StringValue(tasks.Tasks[0].DesiredStatus), aws.StringValue(tasks.Tasks[0].StoppedReason), nil
+}
+
+// deleteCluster deletes an emptied cluster, waiting out the deleted service and stopping tasks that
+// still hold it
+func deleteCluster(ecsClient *ecs.ECS, name string, timeout time.Duration) error {
+	deadline := clock.Default.Now().Add(timeout)
+	for {
+		_, err := ecsClient.DeleteCluster(&ecs.DeleteClusterInput{Cluster: aws.String(name)})
+		awsErr, ok := err.(awserr.Error)
+		if err == nil || ok && awsErr.Code() == ecs.ErrCodeClusterNotFoundException {
+			return nil
+		}
+		busy := ok && (awsErr.Code() == ecs.ErrCodeClusterContainsServicesException || awsErr.Code() == ecs.ErrCodeClusterContainsTasksException)
+		if !busy || clock.Default.Now().After(deadline) {
+			return fmt.Errorf("failed to delete victim cluster %s: %w", name, err)
+		}
+		clock.Default.Sleep(15 * time.Second)
+	}
+}
+
+// deleteECSService removes a victim service with its cluster, task definitions and instance
+// profile, skipping parts that were never created. Container instances are deregistered by force;
+// the hosts themselves are terminated with the other instances.
+func deleteECSService(sess *session.Session, name string) error {
+	ecsClient := ecs.New(sess)
+	clusterGone := func(err error) bool {
+		awsErr, ok := err.(awserr.Error)
+		return ok && awsErr.Code() == ecs.ErrCodeClusterNotFoundException
+	}
+
+	if _, err := ecsClient.DeleteService(&ecs.DeleteServiceInput{
+		Cluster: aws.String(name),
+		Service: aws.String(name),
+		Force:   aws.Bool(true),
+	}); err != nil && !clusterGone(err) {
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ecs.ErrCodeServiceNotFoundException {
+			return fmt.Errorf("failed to delete victim service %s: %w", name, err)
+		}
+	}
+
+	definitions, err := ecsClient.ListTaskDefinitions(&ecs.ListTaskDefinitionsInput{FamilyPrefix: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("failed to list task definitions of %s: %w", name, err)
+	}
+	for _, definition := range definitions.TaskDefinitionArns {
+		if _, err := ecsClient.DeregisterTaskDefinition(&ecs.DeregisterTaskDefinitionInput{TaskDefinition: definition}); err != nil {
+			return fmt.Errorf("failed to deregister %s: %w", aws.StringValue(definition), err)
+		}
+	}
+
+	instances, err := ecsClient.ListContainerInstances(&ecs.ListContainerInstancesInput{Cluster: aws.String(name)})
+	if err != nil && !clusterGone(err) {
+		return fmt.Errorf("failed to list container instances of %s: %w", name, err)
+	}
+	if err == nil {
+		for _, instance := range instances.ContainerInstanceArns {
+			if _, err := ecsClient.DeregisterContainerInstance(&ecs.DeregisterContainerInstanceInput{
+				Cluster:           aws.String(name),
+				ContainerInstance: instance,
+				Force:             aws.Bool(true),
+			}); err != nil {
+				return fmt.Errorf("failed to deregister %s: %w", aws.StringValue(instance), err)
+			}
+		}
+		if err := deleteCluster(ecsClient, name, 2*time.Minute); err != nil {
+			return err
+		}
+	}
+
+	return helpers.DeleteInstanceProfile(sess, name, ecsInstancePolicyARN(sess))
+}
@@ -0,0 +1,328 @@
+package victims
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// KillSwitchParameter is the account-wide SSM parameter that, while "true", stops all victim
+// provisioning and makes Reap remove every victim regardless of its TTL
+const KillSwitchParameter = "/ir/victims-kill-switch"
+
+// ExpiresTag holds the RFC 3339 time after which Reap removes a victim
+const ExpiresTag = "ir-victim-expires"
+
+// Limits bound what a Set may provision
+type Limits struct {
+	// InstanceTypes are the only types Set.InstanceOfType accepts
+	InstanceTypes []string
+	// Regions are the only regions victims may be created in
+	Regions []string
+	// MaxInstances caps the instances of one set
+	MaxInstances int
+	// TTL is how long a victim may live; instances shut themselves down after it
+	TTL time.Duration
+}
+
+// DefaultLimits keep victims small, short-lived and in the regions the stack is deployed to by default
+var DefaultLimits = Limits{
+	InstanceTypes: []string{ec2.InstanceTypeT3Nano, ec2.InstanceTypeT3Micro, ec2.InstanceTypeT3Small},
+	Regions:       []string{"us-east-1", "us-west-2", "eu-west-1"},
+	MaxInstances:  3,
+	TTL:           2 * time.Hour,
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// admit refuses provisioning when the kill switch is engaged or the set's region is not allowed
+func (s *Set) admit() error {
+	if region := aws.StringValue(s.sess.Config.Region); !contains(s.Limits.Regions, region) {
+		return fmt.Errorf("victims are not allowed in %s (allowed: %s)", region, strings.Join(s.Limits.Regions, ", "))
+	}
+
+	engaged, err := KillSwitchEngaged(s.sess)
+	if err != nil {
+		return err
+	}
+	if engaged {
+		return fmt.Errorf("victim provisioning is disabled by %s", KillSwitchParameter)
+	}
+	return nil
+}
+
+// KillSwitchEngaged reports whether the kill switch parameter is set to true. A missing parameter
+// means it was never engaged.
+func KillSwitchEngaged(sess *session.Session) (bool, error) {
+	parameter, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{Name: aws.String(KillSwitchParameter)})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeParameterNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", KillSwitchParameter, err)
+	}
+
+	engaged, _ := strconv.ParseBool(aws.StringValue(parameter.Parameter.Value))
+	return engaged, nil
+}
+
+// SetKillSwitch engages or releases the kill switch
+func SetKillSwitch(sess *session.Session, engaged bool) error {
+	if _, err := ssm.New(sess).PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(KillSwitchParameter),
+		Value:     aws.String(strconv.FormatBool(engaged)),
+		Type:      aws.String(ssm.ParameterTypeString),
+		Overwrite: aws.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("failed to set %s: %w", KillSwitchParameter, err)
+	}
+	return nil
+}
+
+// expired reports whether a victim's expiry tag has passed. Victims without a readable tag count
+// as expired, since nothing else would ever remove them.
+func expired(expires string, now time.Time) bool {
+	at, err := time.Parse(time.RFC3339, expires)
+	return err != nil || now.After(at)
+}
+
+// Reap removes victims in the session's region whose TTL has passed, or every victim when all is
+// set or the kill switch is engaged, and returns what it removed. Failures are reported together
+// after everything else has been tried.
+func Reap(sess *session.Session, all bool) ([]string, error) {
+	engaged, err := KillSwitchEngaged(sess)
+	if err != nil {
+		return nil, err
+	}
+	all = all || engaged
+	now := time.Now()
+
+	var removed, problems []string
+
+	// Groups and clusters go first, so they stop replacing the instances reaped below
+	err = autoscaling.New(sess).DescribeAutoScalingGroupsPages(&autoscaling.DescribeAutoScalingGroupsInput{
+		Filters: []*autoscaling.Filter{{Name: aws.String("tag-key"), Values: []*string{aws.String(VictimTag)}}},
+	}, func(page *autoscaling.DescribeAutoScalingGroupsOutput, _ bool) bool {
+		for _, group := range page.AutoScalingGroups {
+			expires := ""
+			for _, tag := range group.Tags {
+				if aws.StringValue(tag.Key) == ExpiresTag {
+					expires = aws.StringValue(tag.Value)
+				}
+			}
+			if !all && !expired(expires, now) {
+				continue
+			}
+			name, templateID := aws.StringValue(group.AutoScalingGroupName), ""
+			if group.LaunchTemplate != nil {
+				templateID = aws.StringValue(group.LaunchTemplate.LaunchTemplateId)
+			}
+			if err := deleteAutoScalingGroup(sess, name, templateID); err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			removed = append(removed, "autoscaling group "+name)
+		}
+		return true
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list victim Auto Scaling groups: %v", err))
+	}
+
+	ecsClient := ecs.New(sess)
+	err = ecsClient.ListClustersPages(&ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, _ bool) bool {
+		var victimClusters []*string
+		for _, clusterARN := range page.ClusterArns {
+			if strings.Contains(aws.StringValue(clusterARN), "/"+VictimTag+"-") {
+				victimClusters = append(victimClusters, clusterARN)
+			}
+		}
+		if len(victimClusters) == 0 {
+			return true
+		}
+		clusters, err := ecsClient.DescribeClusters(&ecs.DescribeClustersInput{
+			Clusters: victimClusters,
+			Include:  []*string{aws.String(ecs.ClusterFieldTags)},
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to describe victim clusters: %v", err))
+			return true
+		}
+		for _, cluster := range clusters.Clusters {
+			expires := ""
+			for _, tag := range cluster.Tags {
+				if aws.StringValue(tag.Key) == ExpiresTag {
+					expires = aws.StringValue(tag.Value)
+				}
+			}
+			if !all && !expired(expires, now) {
+				continue
+			}
+			name := aws.StringValue(cluster.ClusterName)
+			if err := deleteECSService(sess, name); err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			removed = append(removed, "ecs cluster "+name)
+		}
+		return true
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list victim clusters: %v", err))
+	}
+
+	ec2Client := ec2.New(sess)
+	var instanceIDs []*string
+	err = ec2Client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag-key"), Values: []*string{aws.String(VictimTag)}},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				expires := ""
+				for _, tag := range instance.Tags {
+					if aws.StringValue(tag.Key) == ExpiresTag {
+						expires = aws.StringValue(tag.Value)
+					}
+				}
+				if all || expired(expires, now) {
+					instanceIDs = append(instanceIDs, instance.InstanceId)
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list victim instances: %v", err))
+	}
+	if len(instanceIDs) > 0 {
+		if _, err := ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: instanceIDs}); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to terminate victim instances: %v", err))
+		} else {
+			for _, id := range instanceIDs {
+				removed = append(removed, "instance "+aws.StringValue(id))
+			}
+		}
+	}
+
+	s3Client := s3.New(sess)
+	buckets, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list buckets: %v", err))
+	} else {
+		for _, bucket := range buckets.Buckets {
+			name := aws.StringValue(bucket.Name)
+			if !strings.HasPrefix(name, VictimTag+"-") {
+				continue
+			}
+			tagging, err := s3Client.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: bucket.Name})
+			if err != nil {
+				// Buckets of other regions answer with a redirect; they are reaped from their own region
+				continue
+			}
+			expires := ""
+			for _, tag := range tagging.TagSet {
+				if aws.StringValue(tag.Key) == ExpiresTag {
+					expires = aws.StringValue(tag.Value)
+				}
+			}
+			if !all && !expired(expires, now) {
+				continue
+			}
+			if err := deleteBucket(sess, name); err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			removed = append(removed, "bucket "+name)
+		}
+	}
+
+	iamClient := iam.New(sess)
+	var users []string
+	err = iamClient.ListUsersPages(&iam.ListUsersInput{}, func(page *iam.ListUsersOutput, _ bool) bool {
+		for _, user := range page.Users {
+			if strings.HasPrefix(aws.StringValue(user.UserName), VictimTag+"-") {
+				users = append(users, aws.StringValue(user.UserName))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list users: %v", err))
+	}
+	for _, userName := range users {
+		tags, err := iamClient.ListUserTags(&iam.ListUserTagsInput{UserName: aws.String(userName)})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to get tags of %s: %v", userName, err))
+			continue
+		}
+		expires := ""
+		for _, tag := range tags.Tags {
+			if aws.StringValue(tag.Key) == ExpiresTag {
+				expires = aws.StringValue(tag.Value)
+			}
+		}
+		if !all && !expired(expires, now) {
+			continue
+		}
+		if err := deleteUser(sess, userName); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		removed = append(removed, "user "+userName)
+	}
+
+	// A network whose instances were only just terminated is not empty yet; the next run removes it
+	var vpcIDs []string
+	err = ec2Client.DescribeVpcsPages(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("tag-key"), Values: []*string{aws.String(VictimTag)}}},
+	}, func(page *ec2.DescribeVpcsOutput, _ bool) bool {
+		for _, vpc := range page.Vpcs {
+			expires := ""
+			for _, tag := range vpc.Tags {
+				if aws.StringValue(tag.Key) == ExpiresTag {
+					expires = aws.StringValue(tag.Value)
+				}
+			}
+			if all || expired(expires, now) {
+				vpcIDs = append(vpcIDs, aws.StringValue(vpc.VpcId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list victim VPCs: %v", err))
+	}
+	for _, vpcID := range vpcIDs {
+		if err := deleteNetwork(sess, vpcID); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		removed = append(removed, "vpc "+vpcID)
+	}
+
+	if len(problems) > 0 {
+		return removed, fmt.Errorf("reaping victims failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return removed, nil
+}
@@ -0,0 +1,213 @@
+package victims
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers/clock"
+)
+
+// IPv6TrafficTarget is the public IPv6 address dual-stack victims ping, so their flow logs have
+// IPv6 records to capture whether the traffic is allowed or rejected
+const IPv6TrafficTarget = "2001:4860:4860::8888"
+
+// Network is a victim VPC with one subnet. Dual-stack networks also have an IPv6 block, and their
+// IPv6 traffic leaves through an egress-only internet gateway. Deploy the stack with
+// quarantine_vpc_id or quarantine_additional_vpc_ids naming VPCID so a quarantine group can be
+// attached to victims in it.
+type Network struct {
+	VPCID    string
+	SubnetID string
+	// EgressGatewayID and IPv6CidrBlock are set for dual-stack networks; the subnet has the first
+	// /64 of the VPC's /56
+	EgressGatewayID string
+	IPv6CidrBlock   string
+}
+
+// Network creates an IPv4-only VPC with one subnet and no route out
+func (s *Set) Network() (*Network, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	return s.network(false)
+}
+
+// DualStackNetwork creates a VPC with an Amazon-provided IPv6 block and a dual-stack subnet
+func (s *Set) DualStackNetwork() (*Network, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	return s.network(true)
+}
+
+func (s *Set) network(dualStack bool) (*Network, error) {
+	ec2Client := ec2.New(s.sess)
+
+	var tags []*ec2.Tag
+	for key, value := range s.tags() {
+		tags = append(tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	tagged := func(resourceType string) []*ec2.TagSpecification {
+		return []*ec2.TagSpecification{{ResourceType: aws.String(resourceType), Tags: tags}}
+	}
+
+	vpc, err := ec2Client.CreateVpc(&ec2.CreateVpcInput{
+		CidrBlock:                   aws.String("10.64.0.0/16"),
+		AmazonProvidedIpv6CidrBlock: aws.Bool(dualStack),
+		TagSpecifications:           tagged(ec2.ResourceTypeVpc),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create victim VPC: %w", err)
+	}
+	network := &Network{VPCID: aws.StringValue(vpc.Vpc.VpcId)}
+	// Track the VPC before anything else can fail, so Cleanup removes what was created
+	s.networks = append(s.networks, network)
+
+	input := &ec2.DescribeVpcsInput{VpcIds: []*string{vpc.Vpc.VpcId}}
+	if err := ec2Client.WaitUntilVpcAvailable(input); err != nil {
+		return nil, fmt.Errorf("victim VPC %s did not become available: %w", network.VPCID, err)
+	}
+
+	if !dualStack {
+		subnet, err := ec2Client.CreateSubnet(&ec2.CreateSubnetInput{
+			VpcId:             vpc.Vpc.VpcId,
+			CidrBlock:         aws.String("10.64.1.0/24"),
+			TagSpecifications: tagged(ec2.ResourceTypeSubnet),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create subnet in %s: %w", network.VPCID, err)
+		}
+		network.SubnetID = aws.StringValue(subnet.Subnet.SubnetId)
+		return network, nil
+	}
+
+	// The IPv6 block is associated asynchronously
+	for deadline := clock.Default.Now().Add(2 * time.Minute); network.IPv6CidrBlock == ""; clock.Default.Sleep(5 * time.Second) {
+		described, err := ec2Client.DescribeVpcs(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe victim VPC %s: %w", network.VPCID, err)
+		}
+		for _, association := range described.Vpcs[0].Ipv6CidrBlockAssociationSet {
+			if aws.StringValue(association.Ipv6CidrBlockState.State) == ec2.VpcCidrBlockStateCodeAssociated {
+				network.IPv6CidrBlock = aws.StringValue(association.Ipv6CidrBlock)
+			}
+		}
+		if network.IPv6CidrBlock == "" && clock.Default.Now().After(deadline) {
+			return nil, fmt.Errorf("no IPv6 block was associated with victim VPC %s", network.VPCID)
+		}
+	}
+
+	_, block, err := net.ParseCIDR(network.IPv6CidrBlock)
+	if err != nil {
+		return nil, fmt.Errorf("victim VPC %s has an unparsable IPv6 block: %w", network.VPCID, err)
+	}
+	block.Mask = net.CIDRMask(64, 128)
+	subnet, err := ec2Client.CreateSubnet(&ec2.CreateSubnetInput{
+		VpcId:             vpc.Vpc.VpcId,
+		CidrBlock:         aws.String("10.64.1.0/24"),
+		Ipv6CidrBlock:     aws.String(block.String()),
+		TagSpecifications: tagged(ec2.ResourceTypeSubnet),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dual-stack subnet in %s: %w", network.VPCID, err)
+	}
+	network.SubnetID = aws.StringValue(subnet.Subnet.SubnetId)
+
+	gateway, err := ec2Client.CreateEgressOnlyInternetGateway(&ec2.CreateEgressOnlyInternetGatewayInput{
+		VpcId:             vpc.Vpc.VpcId,
+		TagSpecifications: tagged(ec2.ResourceTypeEgressOnlyInternetGateway),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create egress-only gateway in %s: %w", network.VPCID, err)
+	}
+	network.EgressGatewayID = aws.StringValue(gateway.EgressOnlyInternetGateway.EgressOnlyInternetGatewayId)
+
+	routeTables, err := ec2Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{vpc.Vpc.VpcId}},
+			{Name: aws.String("association.main"), Values: []*string{aws.String("true")}},
+		},
+	})
+	if err != nil || len(routeTables.RouteTables) == 0 {
+		return nil, fmt.Errorf("failed to find the main route table of %s: %v", network.VPCID, err)
+	}
+	if _, err := ec2Client.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:                routeTables.RouteTables[0].RouteTableId,
+		DestinationIpv6CidrBlock:    aws.String("::/0"),
+		EgressOnlyInternetGatewayId: aws.String(network.EgressGatewayID),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to route IPv6 traffic of %s: %w", network.VPCID, err)
+	}
+
+	return network, nil
+}
+
+// InstanceIn launches a victim in the network's subnet
+func (s *Set) InstanceIn(network *Network) (*Instance, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	return s.launch(helpers.TestInstanceOptions{
+		SubnetID:     network.SubnetID,
+		InstanceType: ec2.InstanceTypeT3Micro,
+	})
+}
+
+// DualStackInstance launches a victim with an IPv4 and an IPv6 address in the network. It pings
+// IPv6TrafficTarget every few seconds until its TTL runs out.
+func (s *Set) DualStackInstance(network *Network) (*Instance, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	return s.launch(helpers.TestInstanceOptions{
+		SubnetID:         network.SubnetID,
+		InstanceType:     ec2.InstanceTypeT3Micro,
+		IPv6AddressCount: 1,
+		Script:           fmt.Sprintf("(while true; do ping -6 -c 3 -W 2 %s; sleep 5; done) >/dev/null 2>&1 &", IPv6TrafficTarget),
+	})
+}
+
+// deleteNetwork removes a victim VPC and what Network or DualStackNetwork created in it. It fails while
+// anything else, e.g. a quarantine group deployed into the VPC, is still there.
+func deleteNetwork(sess *session.Session, vpcID string) error {
+	ec2Client := ec2.New(sess)
+	vpcFilter := []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}}}
+
+	gateways, err := ec2Client.DescribeEgressOnlyInternetGateways(&ec2.DescribeEgressOnlyInternetGatewaysInput{})
+	if err != nil {
+		return fmt.Errorf("failed to list egress-only gateways: %w", err)
+	}
+	for _, gateway := range gateways.EgressOnlyInternetGateways {
+		for _, attachment := range gateway.Attachments {
+			if aws.StringValue(attachment.VpcId) != vpcID {
+				continue
+			}
+			if _, err := ec2Client.DeleteEgressOnlyInternetGateway(&ec2.DeleteEgressOnlyInternetGatewayInput{
+				EgressOnlyInternetGatewayId: gateway.EgressOnlyInternetGatewayId,
+			}); err != nil {
+				return fmt.Errorf("failed to delete egress-only gateway of %s: %w", vpcID, err)
+			}
+		}
+	}
+
+	subnets, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: vpcFilter})
+	if err != nil {
+		return fmt.Errorf("failed to list subnets of %s: %w", vpcID, err)
+	}
+	for _, subnet := range subnets.Subnets {
+		if _, err := ec2Client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: subnet.SubnetId}); err != nil {
+			return fmt.Errorf("failed to delete subnet %s: %w", aws.StringValue(subnet.SubnetId), err)
+		}
+	}
+
+	if _, err := ec2Client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)}); err != nil {
+		return fmt.Errorf("failed to delete victim VPC %s: %w", vpcID, err)
+	}
+	return nil
+}
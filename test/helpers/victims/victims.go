@@ -0,0 +1,441 @@
+// Package victims provisions minimal real resources for injected findings to name, so isolation and
+// remediation act on something instead of no-oping on fictitious IDs. Every victim is tagged with
+// the run and an expiry and removed by Set.Cleanup; Reap removes those a crashed run left behind.
+package victims
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/shubham-shewale/threat-detection-ir/test/helpers"
+)
+
+// VictimTag marks every victim resource, alongside helpers.TestResourceTag
+const VictimTag = "ir-victim"
+
+// SampleObjects are put in victim buckets so exfiltration findings refer to real data
+var SampleObjects = map[string]string{
+	"reports/q3-summary.csv":   "region,revenue\nus-east-1,100\n",
+	"exports/customers.json":   `[{"id":1,"name":"Sample Customer"}]`,
+	"backups/db-dump.sql.gz.1": "not a real dump",
+}
+
+// Victim is a resource an injected finding can name
+type Victim interface {
+	// Resource is the finding's resource block, in GuardDuty's shape for the resource type
+	Resource() map[string]interface{}
+}
+
+// Finding returns a finding of the given type and severity against the victim
+func Finding(victim Victim, id, findingType string, severity float64) helpers.GuardDutyFinding {
+	return helpers.GuardDutyFinding{
+		ID:       id,
+		Severity: severity,
+		Type:     findingType,
+		Resource: victim.Resource(),
+	}
+}
+
+// Tagged returns the victim with its resource block reporting the tags, the way GuardDuty reports
+// a resource's tags in each of its details blocks. The real resource is not tagged.
+func Tagged(victim Victim, tags map[string]string) Victim {
+	return &tagged{Victim: victim, tags: tags}
+}
+
+type tagged struct {
+	Victim
+	tags map[string]string
+}
+
+// Resource implements Victim
+func (t *tagged) Resource() map[string]interface{} {
+	keys := make([]string, 0, len(t.tags))
+	for key := range t.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, map[string]interface{}{"key": key, "value": t.tags[key]})
+	}
+
+	resource := t.Victim.Resource()
+	for _, value := range resource {
+		switch details := value.(type) {
+		case map[string]interface{}:
+			details["tags"] = tags
+		case []map[string]interface{}:
+			for _, entry := range details {
+				entry["tags"] = tags
+			}
+		}
+	}
+	return resource
+}
+
+// Instance is a running victim instance
+type Instance struct {
+	ID               string
+	InstanceType     string
+	NetworkInterface string
+	PrivateIP        string
+	VPCID            string
+	// IPv6Address is set for dual-stack victims
+	IPv6Address string
+}
+
+// Resource implements Victim
+func (i *Instance) Resource() map[string]interface{} {
+	ipv6Addresses := []string{}
+	if i.IPv6Address != "" {
+		ipv6Addresses = append(ipv6Addresses, i.IPv6Address)
+	}
+	return map[string]interface{}{
+		"resourceType": "Instance",
+		"instanceDetails": map[string]interface{}{
+			"instanceId":   i.ID,
+			"instanceType": i.InstanceType,
+			"networkInterfaces": []map[string]interface{}{
+				{"networkInterfaceId": i.NetworkInterface, "privateIpAddress": i.PrivateIP, "vpcId": i.VPCID, "ipv6Addresses": ipv6Addresses},
+			},
+		},
+	}
+}
+
+// Bucket is a victim bucket holding SampleObjects
+type Bucket struct {
+	Name string
+	ARN  string
+}
+
+// Resource implements Victim
+func (b *Bucket) Resource() map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": "S3Bucket",
+		"s3BucketDetails": []map[string]interface{}{
+			{"name": b.Name, "arn": b.ARN, "type": "Destination"},
+		},
+	}
+}
+
+// AccessKey is an active access key of a victim IAM user. The user has no policies, so the key
+// cannot do anything if it leaks.
+type AccessKey struct {
+	UserName    string
+	AccessKeyID string
+	PrincipalID string
+}
+
+// Resource implements Victim
+func (k *AccessKey) Resource() map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": "AccessKey",
+		"accessKeyDetails": map[string]interface{}{
+			"accessKeyId": k.AccessKeyID,
+			"principalId": k.PrincipalID,
+			"userName":    k.UserName,
+			"userType":    "IAMUser",
+		},
+	}
+}
+
+// Set provisions victims for one run and tracks them for cleanup
+type Set struct {
+	// Limits default to DefaultLimits
+	Limits Limits
+
+	sess  *session.Session
+	runID string
+
+	instances []*Instance
+	buckets   []*Bucket
+	keys      []*AccessKey
+	networks  []*Network
+	groups    []*AutoScalingGroup
+	services  []*ECSService
+}
+
+// New returns an empty set for the run
+func New(sess *session.Session, runID string) *Set {
+	return &Set{Limits: DefaultLimits, sess: sess, runID: runID}
+}
+
+func (s *Set) tags() map[string]string {
+	return map[string]string{
+		helpers.TestResourceTag: s.runID,
+		VictimTag:               "true",
+		ExpiresTag:              time.Now().Add(s.Limits.TTL).UTC().Format(time.RFC3339),
+	}
+}
+
+// name returns a resource name unique to the run and kind, e.g. ir-victim-abc123-bucket-1
+func (s *Set) name(kind string, n int) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s-%d", VictimTag, s.runID, kind, n))
+}
+
+// Instance launches a t3.micro victim in the default VPC
+func (s *Set) Instance() (*Instance, error) {
+	return s.InstanceOfType(ec2.InstanceTypeT3Micro)
+}
+
+// InstanceOfType launches a victim of an instance type allowed by the limits. It terminates itself
+// when its TTL runs out.
+func (s *Set) InstanceOfType(instanceType string) (*Instance, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	if !contains(s.Limits.InstanceTypes, instanceType) {
+		return nil, fmt.Errorf("victim instance type %s is not allowed (allowed: %s)", instanceType, strings.Join(s.Limits.InstanceTypes, ", "))
+	}
+	return s.launch(helpers.TestInstanceOptions{InstanceType: instanceType})
+}
+
+// launch starts a victim instance with the set's tags and TTL
+func (s *Set) launch(opts helpers.TestInstanceOptions) (*Instance, error) {
+	if len(s.instances) >= s.Limits.MaxInstances {
+		return nil, fmt.Errorf("victim set already has the maximum of %d instances", s.Limits.MaxInstances)
+	}
+
+	opts.Tags = s.tags()
+	opts.ShutdownAfter = s.Limits.TTL
+	instanceID, err := helpers.LaunchTestInstance(s.sess, opts)
+	if instanceID != "" {
+		// Track the instance before checking err, so a launch that failed to reach running is cleaned up
+		s.instances = append(s.instances, &Instance{ID: instanceID, InstanceType: opts.InstanceType})
+	}
+	if err != nil {
+		return nil, err
+	}
+	instance := s.instances[len(s.instances)-1]
+	return instance, s.describe(instance)
+}
+
+// describe fills in the network details of a tracked instance
+func (s *Set) describe(instance *Instance) error {
+	interfaces, err := helpers.InstanceNetworkInterfaces(s.sess, instance.ID)
+	if err != nil {
+		return err
+	}
+	if len(interfaces) > 0 {
+		instance.NetworkInterface = aws.StringValue(interfaces[0].NetworkInterfaceId)
+		instance.PrivateIP = aws.StringValue(interfaces[0].PrivateIpAddress)
+		instance.VPCID = aws.StringValue(interfaces[0].VpcId)
+		if len(interfaces[0].Ipv6Addresses) > 0 {
+			instance.IPv6Address = aws.StringValue(interfaces[0].Ipv6Addresses[0].Ipv6Address)
+		}
+	}
+	return nil
+}
+
+// Bucket creates a victim bucket holding SampleObjects
+func (s *Set) Bucket() (*Bucket, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	s3Client := s3.New(s.sess)
+	name := s.name("bucket", len(s.buckets)+1)
+	bucket := &Bucket{Name: name, ARN: helpers.SessionPartition(s.sess).ARN("s3", "", "", name)}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket.Name)}
+	// us-east-1 rejects an explicit location constraint, every other region requires one
+	if region := aws.StringValue(s.sess.Config.Region); region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+	if _, err := s3Client.CreateBucket(input); err != nil {
+		return nil, fmt.Errorf("failed to create victim bucket %s: %w", bucket.Name, err)
+	}
+	s.buckets = append(s.buckets, bucket)
+
+	var tagSet []*s3.Tag
+	for key, value := range s.tags() {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := s3Client.PutBucketTagging(&s3.PutBucketTaggingInput{
+		Bucket:  aws.String(bucket.Name),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to tag victim bucket %s: %w", bucket.Name, err)
+	}
+
+	for key, body := range SampleObjects {
+		if _, err := s3Client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket.Name),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(body),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to seed victim bucket %s: %w", bucket.Name, err)
+		}
+	}
+	return bucket, nil
+}
+
+// TestBucket creates a victim bucket in a set of its own for the test, which is removed when the
+// test has finished. Triage records a bucket as a target without isolating it, so findings against
+// it run the whole pipeline without launching instances, and are left open for responders.
+func TestBucket(t *testing.T, sess *session.Session, runID string) *Bucket {
+	t.Helper()
+
+	set := New(sess, runID)
+	t.Cleanup(func() {
+		if err := set.Cleanup(); err != nil {
+			t.Error(err)
+		}
+	})
+	bucket, err := set.Bucket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bucket
+}
+
+// AccessKey creates a victim IAM user without permissions and an access key for it
+func (s *Set) AccessKey() (*AccessKey, error) {
+	if err := s.admit(); err != nil {
+		return nil, err
+	}
+	iamClient := iam.New(s.sess)
+	userName := s.name("user", len(s.keys)+1)
+
+	var tags []*iam.Tag
+	for key, value := range s.tags() {
+		tags = append(tags, &iam.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	user, err := iamClient.CreateUser(&iam.CreateUserInput{UserName: aws.String(userName), Tags: tags})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create victim user %s: %w", userName, err)
+	}
+	key := &AccessKey{UserName: userName, PrincipalID: aws.StringValue(user.User.UserId)}
+	s.keys = append(s.keys, key)
+
+	created, err := iamClient.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String(userName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access key for %s: %w", userName, err)
+	}
+	// The secret is discarded; findings only ever name the key ID
+	key.AccessKeyID = aws.StringValue(created.AccessKey.AccessKeyId)
+	return key, nil
+}
+
+// Cleanup removes every victim in the set, continuing past failures and reporting them together
+func (s *Set) Cleanup() error {
+	var problems []string
+
+	// Groups and services go first, so they stop replacing the instances and tasks removed below
+	for _, service := range s.services {
+		if err := deleteECSService(s.sess, service.Name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, group := range s.groups {
+		if err := deleteAutoScalingGroup(s.sess, group.Name, group.LaunchTemplateID); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, instance := range s.instances {
+		if err := helpers.TerminateTestInstance(s.sess, instance.ID); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, bucket := range s.buckets {
+		if err := deleteBucket(s.sess, bucket.Name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, key := range s.keys {
+		if err := deleteUser(s.sess, key.UserName); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// Networks go last, once the instances in them are terminated
+	for _, network := range s.networks {
+		if err := deleteNetwork(s.sess, network.VPCID); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("victim cleanup left resources behind:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// deleteBucket empties and deletes a victim bucket
+func deleteBucket(sess *session.Session, bucket string) error {
+	if err := helpers.EmptyTestBucket(sess, bucket); err != nil {
+		return err
+	}
+	if _, err := s3.New(sess).DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		return fmt.Errorf("failed to delete victim bucket %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// deleteUser deletes a victim user's access keys and then the user
+func deleteUser(sess *session.Session, userName string) error {
+	iamClient := iam.New(sess)
+
+	keys, err := iamClient.ListAccessKeys(&iam.ListAccessKeysInput{UserName: aws.String(userName)})
+	if err != nil {
+		return fmt.Errorf("failed to list access keys of %s: %w", userName, err)
+	}
+	for _, key := range keys.AccessKeyMetadata {
+		if _, err := iamClient.DeleteAccessKey(&iam.DeleteAccessKeyInput{
+			UserName:    aws.String(userName),
+			AccessKeyId: key.AccessKeyId,
+		}); err != nil {
+			return fmt.Errorf("failed to delete access key of %s: %w", userName, err)
+		}
+	}
+
+	if _, err := iamClient.DeleteUser(&iam.DeleteUserInput{UserName: aws.String(userName)}); err != nil {
+		return fmt.Errorf("failed to delete victim user %s: %w", userName, err)
+	}
+	return nil
+}
+
+// KubernetesWorkload is a pod-level EKS victim. No cluster is created: the finding names ClusterARN
+// and, for runtime findings, Node as the worker node the workload runs on.
+type KubernetesWorkload struct {
+	ClusterARN string
+	Namespace  string
+	Name       string
+	// Type is the workload's kind as GuardDuty reports it, e.g. "pods" or "deployments"
+	Type string
+	Node *Instance
+}
+
+// Resource implements Victim
+func (w *KubernetesWorkload) Resource() map[string]interface{} {
+	resource := map[string]interface{}{
+		"resourceType": "EKSCluster",
+		"eksClusterDetails": map[string]interface{}{
+			"name":   w.ClusterARN[strings.LastIndex(w.ClusterARN, "/")+1:],
+			"arn":    w.ClusterARN,
+			"status": "ACTIVE",
+		},
+		"kubernetesDetails": map[string]interface{}{
+			"kubernetesWorkloadDetails": map[string]interface{}{
+				"name":      w.Name,
+				"type":      w.Type,
+				"namespace": w.Namespace,
+			},
+		},
+	}
+	if w.Node != nil {
+		resource["instanceDetails"] = w.Node.Resource()["instanceDetails"]
+	}
+	return resource
+}
@@ -2,6 +2,11 @@
 # Validates log groups with retention, metrics, alarms, and monitoring configuration
 
 variables {
+  lambda_function_name = "guardduty-triage"
+  state_machine_arn    = "arn:aws:states:us-east-1:123456789012:stateMachine:guardduty-ir"
+  dlq_name             = "guardduty-finding-dlq"
+  deferred_dlq_name    = "ir-deferred-findings-dlq"
+  remediation_dlq_name = "ir-remediation-dlq"
   tags = {
     Environment = "test"
     Project     = "threat-detection-ir"
@@ -271,4 +276,90 @@ run "invalid_alarm_threshold" {
     condition = aws_cloudwatch_metric_alarm.lambda_errors.threshold >= 0
     error_message = "Alarm threshold must be non-negative"
   }
-}
\ No newline at end of file
+}
+
+run "pipeline_alarms_configured" {
+  command = plan
+
+  assert {
+    condition = alltrue([
+      for name in ["lambda-errors", "lambda-throttles", "stepfn-failures", "dlq-depth", "deferred-dlq-depth", "remediation-dlq-depth", "evidence-write-errors", "unresolved-resources"] :
+      contains(keys(aws_cloudwatch_metric_alarm.pipeline), name)
+    ])
+    error_message = "Every critical pipeline metric must have an alarm"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_metric_alarm.pipeline["dlq-depth"].dimensions.QueueName == "guardduty-finding-dlq"
+    error_message = "DLQ depth alarm must watch the EventBridge dead-letter queue"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_metric_alarm.pipeline["remediation-dlq-depth"].dimensions.QueueName == "ir-remediation-dlq"
+    error_message = "Remediation DLQ depth alarm must watch the remediation queue"
+  }
+
+  assert {
+    condition     = !contains(keys(aws_cloudwatch_metric_alarm.pipeline), "buffer-dlq-depth")
+    error_message = "Buffer DLQ depth alarm must not be created without the buffer"
+  }
+
+  assert {
+    condition     = alltrue([for alarm in aws_cloudwatch_metric_alarm.pipeline : alarm.treat_missing_data == "notBreaching"])
+    error_message = "Alarms must not fire on an idle pipeline"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_dashboard.operations.dashboard_name == "ir-operations"
+    error_message = "Operations dashboard must be named after the stack"
+  }
+}
+
+run "buffer_dlq_alarm_configured" {
+  command = plan
+
+  variables {
+    buffer_dlq_name = "ir-finding-buffer-dlq"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_metric_alarm.pipeline["buffer-dlq-depth"].dimensions.QueueName == "ir-finding-buffer-dlq"
+    error_message = "Buffer DLQ depth alarm must watch the buffer's dead-letter queue"
+  }
+}
+
+run "alarm_actions_wired" {
+  command = plan
+
+  variables {
+    alarm_actions = ["arn:aws:sns:us-east-1:123456789012:ir-ops-topic"]
+  }
+
+  assert {
+    condition     = alltrue([for alarm in aws_cloudwatch_metric_alarm.pipeline : alarm.alarm_actions == toset(["arn:aws:sns:us-east-1:123456789012:ir-ops-topic"])])
+    error_message = "Every pipeline alarm must notify the given actions"
+  }
+}
+
+run "log_groups_match_function_and_retention" {
+  command = plan
+
+  variables {
+    name_prefix       = "ir-test-"
+    retain_log_groups = true
+  }
+
+  assert {
+    condition     = aws_cloudwatch_log_group.lambda_triage.name == "/aws/lambda/ir-test-guardduty-triage"
+    error_message = "Triage log group must be the one Lambda writes to, or Lambda creates an unmanaged one"
+  }
+
+  assert {
+    condition = alltrue([
+      aws_cloudwatch_log_group.lambda_triage.skip_destroy,
+      aws_cloudwatch_log_group.stepfn_ir.skip_destroy,
+      aws_cloudwatch_log_group.quarantine_flow_logs.skip_destroy,
+    ])
+    error_message = "retain_log_groups must keep every log group on destroy"
+  }
+}
@@ -204,6 +204,26 @@ run "severity_threshold_filtering" {
   }
 }
 
+run "sqs_buffer_target" {
+  command = plan
+
+  variables {
+    enable_sqs_buffer = true
+    buffer_queue_arn  = "arn:aws:sqs:us-east-1:123456789012:ir-finding-buffer"
+    buffer_queue_url  = "https://sqs.us-east-1.amazonaws.com/123456789012/ir-finding-buffer"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_event_target.lambda_triage.arn == var.buffer_queue_arn
+    error_message = "Findings must be sent to the SQS buffer instead of the function when it is enabled"
+  }
+
+  assert {
+    condition     = strcontains(aws_sqs_queue_policy.buffer[0].policy, "events.amazonaws.com")
+    error_message = "EventBridge must be allowed to send findings to the SQS buffer"
+  }
+}
+
 # Negative test: Invalid severity threshold
 run "invalid_severity_threshold" {
   command = plan
@@ -241,4 +261,49 @@ run "empty_state_machine_arn" {
   expect_failures = [
     aws_cloudwatch_event_target.stepfn_target
   ]
-}
\ No newline at end of file
+}
+
+run "closed_securityhub_findings_not_matched" {
+  command = plan
+
+  variables {
+    enable_securityhub_custom_findings = true
+  }
+
+  assert {
+    condition     = jsondecode(aws_cloudwatch_event_rule.securityhub_custom_findings[0].event_pattern).detail.findings.Workflow.Status == ["NEW", "NOTIFIED"]
+    error_message = "Custom findings resolved or suppressed in Security Hub must not be responded to again"
+  }
+}
+
+run "canary_findings_disabled_by_default" {
+  command = plan
+
+  assert {
+    condition     = length(aws_cloudwatch_event_rule.canary_findings) == 0
+    error_message = "Canary findings must not be routed unless enabled"
+  }
+}
+
+run "canary_findings_routed_to_triage" {
+  command = plan
+
+  variables {
+    enable_canary_findings = true
+  }
+
+  assert {
+    condition     = jsondecode(aws_cloudwatch_event_rule.canary_findings[0].event_pattern).source == ["ir.canary"]
+    error_message = "Canary findings must be matched on the ir.canary source, since PutEvents refuses aws.guardduty"
+  }
+
+  assert {
+    condition     = jsondecode(aws_cloudwatch_event_rule.canary_findings[0].event_pattern).detail.details.canary == [true]
+    error_message = "Only findings marked as canary may be matched on the canary source"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_event_target.canary_lambda_triage[0].arn == var.lambda_function_arn
+    error_message = "Canary findings must be sent to the triage function"
+  }
+}
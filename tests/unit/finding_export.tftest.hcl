@@ -0,0 +1,102 @@
+# Unit tests for Finding Export module
+# Validates Firehose delivery into hourly partitions, newline-delimited JSON or Parquet conversion, a Glue table with partition projection over the same path, and an encrypted, private analytics bucket
+
+variables {
+  bucket_name = "test-ir-evidence-bucket-analytics"
+  tags = {
+    Environment = "test"
+    Project     = "threat-detection-ir"
+  }
+}
+
+run "delivery_partitioned_by_hour" {
+  command = plan
+
+  assert {
+    condition     = aws_kinesis_firehose_delivery_stream.findings.extended_s3_configuration[0].prefix == "findings/!{timestamp:yyyy}/!{timestamp:MM}/!{timestamp:dd}/!{timestamp:HH}/"
+    error_message = "Findings must be delivered under findings/year/month/day/hour/"
+  }
+
+  assert {
+    condition     = strcontains(aws_glue_catalog_table.findings.parameters["storage.location.template"], "/findings/$${year}/$${month}/$${day}/$${hour}/")
+    error_message = "The Glue table must project partitions onto the Firehose prefix"
+  }
+
+  assert {
+    condition     = aws_glue_catalog_table.findings.parameters["projection.enabled"] == "true"
+    error_message = "New hours must be queryable without adding partitions"
+  }
+}
+
+run "json_records_delimited" {
+  command = plan
+
+  assert {
+    condition     = aws_kinesis_firehose_delivery_stream.findings.extended_s3_configuration[0].processing_configuration[0].enabled == true
+    error_message = "JSON records must be newline delimited for the JSON SerDe"
+  }
+
+  assert {
+    condition     = length(aws_kinesis_firehose_delivery_stream.findings.extended_s3_configuration[0].data_format_conversion_configuration) == 0
+    error_message = "JSON export must not convert records"
+  }
+
+  assert {
+    condition     = aws_glue_catalog_table.findings.storage_descriptor[0].ser_de_info[0].serialization_library == "org.openx.data.jsonserde.JsonSerDe"
+    error_message = "The Glue table must read JSON records"
+  }
+}
+
+run "parquet_conversion" {
+  command = plan
+
+  variables {
+    format = "PARQUET"
+  }
+
+  assert {
+    condition     = length(aws_kinesis_firehose_delivery_stream.findings.extended_s3_configuration[0].data_format_conversion_configuration) == 1
+    error_message = "Parquet export must convert records with the Glue table schema"
+  }
+
+  assert {
+    condition     = aws_glue_catalog_table.findings.storage_descriptor[0].ser_de_info[0].serialization_library == "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe"
+    error_message = "The Glue table must read Parquet records"
+  }
+}
+
+run "export_rule_matches_all_severities" {
+  command = plan
+
+  assert {
+    condition     = !strcontains(aws_cloudwatch_event_rule.export.event_pattern, "severity")
+    error_message = "Every GuardDuty finding must be exported, not only those above the triage threshold"
+  }
+}
+
+run "analytics_bucket_private" {
+  command = plan
+
+  assert {
+    condition     = aws_s3_bucket_public_access_block.analytics.block_public_acls == true && aws_s3_bucket_public_access_block.analytics.restrict_public_buckets == true
+    error_message = "Analytics bucket must block public access"
+  }
+
+  assert {
+    condition     = aws_kinesis_firehose_delivery_stream.findings.server_side_encryption[0].enabled == true
+    error_message = "Delivery stream must be encrypted"
+  }
+}
+
+# Negative test: Unsupported export format
+run "invalid_format" {
+  command = plan
+
+  variables {
+    format = "CSV"
+  }
+
+  expect_failures = [
+    var.format
+  ]
+}
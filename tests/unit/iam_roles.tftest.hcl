@@ -2,6 +2,7 @@
 # Validates no wildcard actions/resources unless annotated as justified; require condition keys (e.g., aws:ResourceTag) where scoping is possible
 
 variables {
+  evidence_bucket_arn = "arn:aws:s3:::ir-evidence-bucket"
   tags = {
     Environment = "test"
     Project     = "threat-detection-ir"
@@ -62,6 +63,23 @@ run "lambda_policy_no_wildcard_resources" {
   }
 }
 
+run "lambda_policy_uses_deployed_evidence_bucket" {
+  command = plan
+
+  variables {
+    evidence_bucket_arn = "arn:aws-us-gov:s3:::ir-a1b2c3-evidence"
+  }
+
+  # Namespaced stacks name their bucket <prefix>-evidence; a hard-coded name denies triage its own bucket
+  assert {
+    condition = anytrue([
+      for statement in jsondecode(aws_iam_policy.lambda_triage.policy).Statement :
+      contains(flatten([statement.Action]), "s3:ListBucket") && statement.Resource == ["arn:aws-us-gov:s3:::ir-a1b2c3-evidence/*", "arn:aws-us-gov:s3:::ir-a1b2c3-evidence"]
+    ])
+    error_message = "Lambda policy must grant object access and ListBucket on the deployed evidence bucket"
+  }
+}
+
 run "stepfn_policy_no_wildcard_resources" {
   command = plan
 
@@ -139,11 +157,28 @@ run "lambda_policy_least_privilege_s3" {
   }
 
   assert {
-    condition = !strcontains(aws_iam_policy.lambda_triage.policy, "s3:DeleteBucket")
+    # DeleteBucket may only appear in the DenyDestructiveActions statement
+    condition = !anytrue([for statement in jsondecode(aws_iam_policy.lambda_triage.policy).Statement : statement.Effect == "Allow" && contains(flatten([statement.Action]), "s3:DeleteBucket")])
     error_message = "Lambda policy should not allow DeleteBucket (not needed for triage)"
   }
 }
 
+run "stepfn_policy_uses_deployed_evidence_bucket" {
+  command = plan
+
+  variables {
+    evidence_bucket_arn = "arn:aws-cn:s3:::ir-a1b2c3-evidence"
+  }
+
+  assert {
+    condition = anytrue([
+      for statement in jsondecode(aws_iam_policy.stepfn_ir.policy).Statement :
+      contains(flatten([statement.Action]), "s3:PutObject") && statement.Resource == ["arn:aws-cn:s3:::ir-a1b2c3-evidence/*", "arn:aws-cn:s3:::ir-a1b2c3-evidence"]
+    ])
+    error_message = "Step Functions policy must grant evidence access on the deployed bucket, in its partition"
+  }
+}
+
 run "stepfn_policy_least_privilege_s3" {
   command = plan
 
@@ -170,7 +205,8 @@ run "stepfn_policy_least_privilege_s3" {
   }
 
   assert {
-    condition = !strcontains(aws_iam_policy.stepfn_ir.policy, "s3:DeleteBucket")
+    # DeleteBucket may only appear in the DenyDestructiveActions statement
+    condition = !anytrue([for statement in jsondecode(aws_iam_policy.stepfn_ir.policy).Statement : statement.Effect == "Allow" && contains(flatten([statement.Action]), "s3:DeleteBucket")])
     error_message = "Step Functions policy should not allow DeleteBucket (not needed for remediation)"
   }
 }
@@ -208,6 +244,16 @@ run "lambda_policy_ec2_least_privilege" {
     condition = strcontains(aws_iam_policy.lambda_triage.policy, "ec2:ModifyNetworkInterface")
     error_message = "Lambda policy must allow ModifyNetworkInterface for quarantine operations"
   }
+
+  assert {
+    condition     = strcontains(aws_iam_policy.lambda_triage.policy, "autoscaling:DetachInstances")
+    error_message = "Lambda policy must allow DetachInstances so Auto Scaling replaces quarantined instances instead of terminating them"
+  }
+
+  assert {
+    condition     = strcontains(aws_iam_policy.lambda_triage.policy, "ecs:DescribeTaskDefinition")
+    error_message = "Lambda policy must allow DescribeTaskDefinition to snapshot ECS task definitions into evidence"
+  }
 }
 
 run "stepfn_policy_ec2_least_privilege" {
@@ -243,6 +289,26 @@ run "stepfn_policy_ec2_least_privilege" {
     condition = strcontains(aws_iam_policy.stepfn_ir.policy, "ec2:ModifyNetworkInterface")
     error_message = "Step Functions policy must allow ModifyNetworkInterface for quarantine operations"
   }
+
+  assert {
+    condition = strcontains(aws_iam_policy.stepfn_ir.policy, "ec2:ModifyNetworkInterfaceAttribute")
+    error_message = "Step Functions policy must allow ModifyNetworkInterfaceAttribute to move interfaces into quarantine"
+  }
+
+  assert {
+    condition = strcontains(aws_iam_policy.stepfn_ir.policy, "ec2:ReplaceNetworkAclAssociation")
+    error_message = "Step Functions policy must allow ReplaceNetworkAclAssociation for NACL-based isolation"
+  }
+
+  assert {
+    condition     = strcontains(aws_iam_policy.stepfn_ir.policy, "ecs:UpdateContainerInstancesState") && strcontains(aws_iam_policy.stepfn_ir.policy, "ecs:StopTask")
+    error_message = "Step Functions policy must allow draining an ECS task's host and stopping the task"
+  }
+
+  assert {
+    condition = strcontains(aws_iam_policy.stepfn_ir.policy, "ir-remediation-dlq")
+    error_message = "Step Functions policy must allow routing containment failures to the remediation DLQ"
+  }
 }
 
 run "lambda_policy_stepfn_least_privilege" {
@@ -401,6 +467,20 @@ run "stepfn_policy_securityhub_least_privilege" {
   }
 }
 
+run "stepfn_policy_guardduty_archive_only" {
+  command = plan
+
+  assert {
+    condition     = strcontains(aws_iam_policy.stepfn_ir.policy, "guardduty:ArchiveFindings")
+    error_message = "Step Functions policy must allow archiving contained findings"
+  }
+
+  assert {
+    condition     = !strcontains(aws_iam_policy.stepfn_ir.policy, "guardduty:UnarchiveFindings")
+    error_message = "Step Functions policy should not allow unarchiving findings"
+  }
+}
+
 run "lambda_policy_cloudwatch_least_privilege" {
   command = plan
 
@@ -528,4 +608,58 @@ run "no_wildcard_resources_allowed" {
     condition = !strcontains(aws_iam_policy.stepfn_ir.policy, "\"Resource\": \"*\"")
     error_message = "Step Functions policy must not contain wildcard resources"
   }
-}
\ No newline at end of file
+}
+
+run "ir_roles_deny_destructive_actions" {
+  command = plan
+
+  assert {
+    condition     = strcontains(aws_iam_policy.lambda_triage.policy, "DenyDestructiveActions") && strcontains(aws_iam_policy.stepfn_ir.policy, "DenyDestructiveActions")
+    error_message = "IR role policies must explicitly deny destructive actions"
+  }
+
+  assert {
+    condition     = alltrue([for action in ["ec2:TerminateInstances", "s3:DeleteBucket", "kms:ScheduleKeyDeletion"] : strcontains(aws_iam_policy.lambda_triage.policy, action)])
+    error_message = "Lambda triage policy must deny TerminateInstances, DeleteBucket and ScheduleKeyDeletion"
+  }
+}
+
+run "integration_secrets_policy_scoped" {
+  command = plan
+
+  variables {
+    integration_secret_arns = ["arn:aws:secretsmanager:us-east-1:123456789012:secret:ir-slack-AbCdEf"]
+  }
+
+  assert {
+    condition     = jsondecode(aws_iam_role_policy.lambda_integration_secrets[0].policy).Statement[0].Resource == ["arn:aws:secretsmanager:us-east-1:123456789012:secret:ir-slack-AbCdEf"]
+    error_message = "Lambda must only read the integration secrets it is given"
+  }
+}
+
+run "integration_secrets_policy_absent_by_default" {
+  command = plan
+
+  assert {
+    condition     = length(aws_iam_role_policy.lambda_integration_secrets) == 0
+    error_message = "Lambda must not read any secrets when no integration secrets are configured"
+  }
+}
+
+run "lambda_policy_incident_query_by_resource_only" {
+  command = plan
+
+  assert {
+    condition     = strcontains(aws_iam_policy.lambda_triage.policy, "dynamodb:Query")
+    error_message = "Lambda policy must allow looking up earlier findings on a resource"
+  }
+
+  assert {
+    condition = alltrue([
+      for statement in jsondecode(aws_iam_policy.lambda_triage.policy).Statement :
+      endswith(statement.Resource, "/index/by-resource")
+      if contains(flatten([statement.Action]), "dynamodb:Query")
+    ])
+    error_message = "Lambda policy should only allow queries of the incident index by resource"
+  }
+}
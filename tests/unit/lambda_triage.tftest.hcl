@@ -3,6 +3,7 @@
 
 variables {
   evidence_bucket_name     = "test-ir-evidence-bucket"
+  evidence_kms_key_arn     = "arn:aws:kms:us-east-1:123456789012:key/00000000-0000-0000-0000-000000000000"
   sns_topic_arn            = "arn:aws:sns:us-east-1:123456789012:ir-alerts-topic"
   state_machine_arn        = "arn:aws:states:us-east-1:123456789012:stateMachine:guardduty-ir"
   quarantine_sg_id         = "sg-12345678"
@@ -23,8 +24,9 @@ run "lambda_function_configured" {
   }
 
   assert {
-    condition     = aws_lambda_function.triage.runtime == "python3.9"
-    error_message = "Lambda function must use Python 3.9 runtime"
+    # Keep in step with SupportedLambdaRuntimes in test/helpers/runtime.go
+    condition     = contains(["python3.11", "python3.12", "python3.13"], aws_lambda_function.triage.runtime)
+    error_message = "Lambda function must use a supported Python runtime"
   }
 
   assert {
@@ -51,6 +53,11 @@ run "lambda_environment_variables" {
     error_message = "Lambda must have SNS_TOPIC_ARN environment variable set"
   }
 
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["URGENT_SNS_TOPIC_ARN"] == var.urgent_sns_topic_arn
+    error_message = "Lambda must have URGENT_SNS_TOPIC_ARN environment variable set"
+  }
+
   assert {
     condition     = aws_lambda_function.triage.environment[0].variables["STATE_MACHINE_ARN"] == var.state_machine_arn
     error_message = "Lambda must have STATE_MACHINE_ARN environment variable set"
@@ -60,6 +67,21 @@ run "lambda_environment_variables" {
     condition     = aws_lambda_function.triage.environment[0].variables["QUARANTINE_SG_ID"] == var.quarantine_sg_id
     error_message = "Lambda must have QUARANTINE_SG_ID environment variable set"
   }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["DEDUP_WINDOW_MINUTES"] == "60"
+    error_message = "Lambda must suppress duplicate findings for 60 minutes by default"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["EXEMPTION_TAG"] == "ir:exempt=true"
+    error_message = "Lambda must exempt instances tagged ir:exempt=true by default"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["INTEGRATION_SECRET_ARNS"] == "{}"
+    error_message = "Lambda environment must carry integration secret ARNs only, none by default"
+  }
 }
 
 run "lambda_package_configuration" {
@@ -129,6 +151,28 @@ run "reserved_concurrency_optional" {
   }
 }
 
+run "code_signing_optional" {
+  command = plan
+
+  assert {
+    condition     = aws_lambda_function.triage.code_signing_config_arn == null
+    error_message = "Code signing must be disabled unless a code signing config is given"
+  }
+}
+
+run "code_signing_configured" {
+  command = plan
+
+  variables {
+    code_signing_config_arn = "arn:aws:lambda:us-east-1:123456789012:code-signing-config:csc-0123456789abcdef0"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.code_signing_config_arn == "arn:aws:lambda:us-east-1:123456789012:code-signing-config:csc-0123456789abcdef0"
+    error_message = "Lambda function must use the given code signing config"
+  }
+}
+
 run "lambda_timeout_configured" {
   command = plan
 
@@ -138,9 +182,22 @@ run "lambda_timeout_configured" {
   }
 }
 
+run "lambda_memory_default" {
+  command = plan
+
+  assert {
+    condition     = aws_lambda_function.triage.memory_size == 128
+    error_message = "Lambda function must default to the Lambda default of 128MB"
+  }
+}
+
 run "lambda_memory_configured" {
   command = plan
 
+  variables {
+    memory_size = 256
+  }
+
   assert {
     condition     = aws_lambda_function.triage.memory_size == 256
     error_message = "Lambda function must have 256MB memory allocated"
@@ -236,6 +293,207 @@ run "lambda_environment_variables_secure" {
   }
 }
 
+run "containment_pause_configured" {
+  command = plan
+
+  assert {
+    condition     = aws_ssm_parameter.containment_paused.value == "false"
+    error_message = "Containment must not be paused when the stack is created"
+  }
+
+  assert {
+    condition     = aws_cloudwatch_event_rule.drain_deferred.schedule_expression == "rate(5 minutes)"
+    error_message = "Deferred findings must be drained every 5 minutes by default"
+  }
+
+  assert {
+    condition     = aws_sqs_queue.deferred.sqs_managed_sse_enabled == true
+    error_message = "Deferred findings queue must be encrypted"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sqs_queue.deferred.redrive_policy).maxReceiveCount == 5
+    error_message = "Deferred findings that keep failing triage must move to the dead-letter queue"
+  }
+
+  assert {
+    condition     = aws_sqs_queue.deferred_dlq.sqs_managed_sse_enabled == true
+    error_message = "Deferred findings dead-letter queue must be encrypted"
+  }
+}
+
+run "sqs_buffer_optional" {
+  command = plan
+
+  assert {
+    condition     = length(aws_lambda_event_source_mapping.buffer) == 0
+    error_message = "Triage must be invoked directly unless the SQS buffer is enabled"
+  }
+}
+
+run "sqs_buffer_configured" {
+  command = plan
+
+  variables {
+    enable_sqs_buffer              = true
+    buffer_batch_size              = 25
+    buffer_batching_window_seconds = 5
+  }
+
+  assert {
+    condition     = aws_lambda_event_source_mapping.buffer[0].batch_size == 25
+    error_message = "Buffer must be polled with the configured batch size"
+  }
+
+  assert {
+    condition     = contains(aws_lambda_event_source_mapping.buffer[0].function_response_types, "ReportBatchItemFailures")
+    error_message = "Buffer must only redeliver the failed findings of a batch"
+  }
+
+  assert {
+    # Keep in step with BufferVisibilityMultiple in test/helpers/buffer.go
+    condition     = aws_sqs_queue.buffer[0].visibility_timeout_seconds >= 6 * aws_lambda_function.triage.timeout
+    error_message = "Buffer visibility timeout must cover six function timeouts"
+  }
+
+  assert {
+    condition     = aws_sqs_queue.buffer[0].sqs_managed_sse_enabled == true && aws_sqs_queue.buffer_dlq[0].sqs_managed_sse_enabled == true
+    error_message = "Buffer queues must be encrypted"
+  }
+}
+
+run "incident_index_optional" {
+  command = plan
+
+  assert {
+    condition     = length(aws_dynamodb_table.incidents) == 0 && aws_lambda_function.triage.environment[0].variables["INCIDENT_TABLE"] == ""
+    error_message = "Findings must not be indexed unless the incident index is enabled"
+  }
+}
+
+run "incident_index_configured" {
+  command = plan
+
+  variables {
+    enable_incident_index = true
+  }
+
+  assert {
+    condition     = toset([for index in aws_dynamodb_table.incidents[0].global_secondary_index : index.name]) == toset(["by-resource", "by-status"])
+    error_message = "Incident index must be queryable by resource and by status"
+  }
+
+  assert {
+    condition     = aws_dynamodb_table.incidents[0].ttl[0].attribute_name == "expires_at" && aws_dynamodb_table.incidents[0].ttl[0].enabled == true
+    error_message = "Incident items must expire on expires_at"
+  }
+
+  assert {
+    condition     = aws_dynamodb_table.incidents[0].point_in_time_recovery[0].enabled == true
+    error_message = "Incident index must have point-in-time recovery enabled"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["INCIDENT_TTL_DAYS"] == "365"
+    error_message = "Triage must set expires_at from incident_ttl_days"
+  }
+}
+
+run "recurrence_escalation_disabled_by_default" {
+  command = plan
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["RECURRENCE_WINDOW_MINUTES"] == "0"
+    error_message = "Recurrences must not be escalated unless a window is set"
+  }
+}
+
+run "recurrence_window_configured" {
+  command = plan
+
+  variables {
+    enable_incident_index     = true
+    recurrence_window_minutes = 60
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["RECURRENCE_WINDOW_MINUTES"] == "60"
+    error_message = "Triage function must be told the recurrence window"
+  }
+}
+
+# Negative test: Recurrences are looked up in the incident index
+run "recurrence_window_without_incident_index" {
+  command = plan
+
+  variables {
+    recurrence_window_minutes = 60
+  }
+
+  expect_failures = [
+    aws_lambda_function.triage
+  ]
+}
+
+# Negative test: Negative recurrence window
+run "invalid_recurrence_window" {
+  command = plan
+
+  variables {
+    recurrence_window_minutes = -1
+  }
+
+  expect_failures = [
+    var.recurrence_window_minutes
+  ]
+}
+
+run "account_classification_configured" {
+  command = plan
+
+  variables {
+    account_classification = {
+      "111122223333" = "sandbox"
+      "444455556666" = "production"
+    }
+  }
+
+  assert {
+    condition     = jsondecode(aws_lambda_function.triage.environment[0].variables["ACCOUNT_CLASSIFICATION"]) == { "111122223333" = "sandbox", "444455556666" = "production" }
+    error_message = "Triage function must be told which accounts are sandboxes"
+  }
+}
+
+# Negative test: Unknown account class
+run "invalid_account_class" {
+  command = plan
+
+  variables {
+    account_classification = {
+      "111122223333" = "staging"
+    }
+  }
+
+  expect_failures = [
+    var.account_classification
+  ]
+}
+
+# Negative test: Account classification keyed on something other than an account ID
+run "invalid_account_classification_id" {
+  command = plan
+
+  variables {
+    account_classification = {
+      "sandbox-account" = "sandbox"
+    }
+  }
+
+  expect_failures = [
+    var.account_classification
+  ]
+}
+
 # Negative test: Missing required environment variables
 run "missing_environment_variables" {
   command = plan
@@ -249,6 +507,45 @@ run "missing_environment_variables" {
   ]
 }
 
+# Negative test: Negative dedup window
+run "invalid_dedup_window" {
+  command = plan
+
+  variables {
+    dedup_window_minutes = -1
+  }
+
+  expect_failures = [
+    var.dedup_window_minutes
+  ]
+}
+
+# Negative test: Exemption tag without a value separator
+run "invalid_exemption_tag" {
+  command = plan
+
+  variables {
+    exemption_tag = "ir:exempt"
+  }
+
+  expect_failures = [
+    var.exemption_tag
+  ]
+}
+
+# Negative test: Drain interval below the schedule minimum
+run "invalid_drain_interval" {
+  command = plan
+
+  variables {
+    drain_interval_minutes = 0
+  }
+
+  expect_failures = [
+    var.drain_interval_minutes
+  ]
+}
+
 # Negative test: Invalid IAM role ARN
 run "invalid_iam_role_arn" {
   command = plan
@@ -273,6 +570,143 @@ run "invalid_timeout" {
   }
 }
 
+run "fips_endpoints" {
+  command = plan
+
+  variables {
+    use_fips_endpoints = true
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["AWS_USE_FIPS_ENDPOINT"] == "true"
+    error_message = "Triage function must use FIPS endpoints when use_fips_endpoints is set"
+  }
+}
+
+# Threat intel lookups are opt-in; GeoIP and ASN enrichment comes from the finding itself
+run "threat_intel_optional" {
+  command = plan
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_ENDPOINT"] == ""
+    error_message = "Threat intel lookups must be disabled by default"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_PROVIDER"] == "generic"
+    error_message = "Threat intel lookups must default to the generic API"
+  }
+}
+
+run "threat_intel_configured" {
+  command = plan
+
+  variables {
+    threat_intel_endpoint        = "https://intel.example.com/v1"
+    threat_intel_timeout_seconds = 2
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_ENDPOINT"] == "https://intel.example.com/v1"
+    error_message = "Triage function must be given the threat intel endpoint"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_TIMEOUT_SECONDS"] == "2"
+    error_message = "Triage function must be given the threat intel lookup timeout"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.timeout >= 2 * tonumber(aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_MAX_LOOKUPS"])
+    error_message = "The function's timeout must cover every threat intel lookup timing out"
+  }
+}
+
+run "threat_intel_virustotal" {
+  command = plan
+
+  variables {
+    threat_intel_endpoint   = "https://www.virustotal.com"
+    threat_intel_provider   = "virustotal"
+    integration_secret_arns = { virustotal = "arn:aws:secretsmanager:us-east-1:123456789012:secret:virustotal-AbCdEf" }
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["THREAT_INTEL_PROVIDER"] == "virustotal"
+    error_message = "Triage function must be told which threat intel API to speak"
+  }
+
+  assert {
+    condition     = jsondecode(aws_lambda_function.triage.environment[0].variables["INTEGRATION_SECRET_ARNS"])["virustotal"] == "arn:aws:secretsmanager:us-east-1:123456789012:secret:virustotal-AbCdEf"
+    error_message = "Triage function must find the provider's API key among the integration secrets"
+  }
+}
+
+run "invalid_threat_intel_provider" {
+  command = plan
+
+  variables {
+    threat_intel_provider = "shodan"
+  }
+
+  expect_failures = [
+    var.threat_intel_provider,
+  ]
+}
+
+run "data_classifications_configured" {
+  command = plan
+
+  variables {
+    data_classifications    = ["restricted", "internal"]
+    data_classification_tag = "Sensitivity"
+  }
+
+  assert {
+    condition     = jsondecode(aws_lambda_function.triage.environment[0].variables["DATA_CLASSIFICATIONS"]) == ["restricted", "internal"]
+    error_message = "Triage function must know which data classifications have a retention class of their own"
+  }
+
+  assert {
+    condition     = aws_lambda_function.triage.environment[0].variables["DATA_CLASSIFICATION_TAG"] == "Sensitivity"
+    error_message = "Triage function must read the classification from the configured tag"
+  }
+}
+
+run "pii_scrubbing_disabled_by_default" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_lambda_function.triage.environment[0].variables["PII_SCRUB_FIELDS"]) == []
+    error_message = "PII scrubbing must be opt-in"
+  }
+}
+
+run "pii_scrub_fields_configured" {
+  command = plan
+
+  variables {
+    pii_scrub_fields = ["privateIpAddress", "userName", "accessKeyId"]
+  }
+
+  assert {
+    condition     = jsondecode(aws_lambda_function.triage.environment[0].variables["PII_SCRUB_FIELDS"]) == ["privateIpAddress", "userName", "accessKeyId"]
+    error_message = "Triage function must be told which fields to scrub"
+  }
+}
+
+run "invalid_threat_intel_endpoint" {
+  command = plan
+
+  variables {
+    threat_intel_endpoint = "http://intel.example.com/v1"
+  }
+
+  expect_failures = [
+    var.threat_intel_endpoint,
+  ]
+}
+
 # Negative test: Invalid memory size
 run "invalid_memory_size" {
   command = plan
@@ -281,4 +715,17 @@ run "invalid_memory_size" {
     condition = aws_lambda_function.triage.memory_size >= 128 && aws_lambda_function.triage.memory_size <= 3008
     error_message = "Lambda memory size must be between 128MB and 3008MB"
   }
-}
\ No newline at end of file
+}
+
+# Negative test: Batch size above the SQS event source limit
+run "invalid_buffer_batch_size" {
+  command = plan
+
+  variables {
+    buffer_batch_size = 20000
+  }
+
+  expect_failures = [
+    var.buffer_batch_size
+  ]
+}
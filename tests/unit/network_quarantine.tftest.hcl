@@ -137,4 +137,82 @@ run "missing_required_tags" {
   expect_failures = [
     aws_security_group.quarantine
   ]
-}
\ No newline at end of file
+}
+# Full isolation by default: no SSM endpoints and no egress exception
+run "full_isolation_by_default" {
+  command = plan
+
+  assert {
+    condition     = length(aws_vpc_endpoint.ssm) == 0 && length(aws_vpc_security_group_egress_rule.quarantine_to_ssm_endpoints) == 0
+    error_message = "Quarantine must not allow SSM access unless allow_ssm_endpoints is set"
+  }
+}
+
+# SSM access: HTTPS egress to the endpoint group only
+run "ssm_endpoints_allowed" {
+  command = plan
+
+  variables {
+    allow_ssm_endpoints = true
+  }
+
+  assert {
+    condition     = toset(keys(aws_vpc_endpoint.ssm)) == toset(["ssm", "ssmmessages", "ec2messages"])
+    error_message = "Session Manager needs the ssm, ssmmessages and ec2messages endpoints"
+  }
+
+  assert {
+    condition = alltrue([
+      for rule in aws_vpc_security_group_egress_rule.quarantine_to_ssm_endpoints :
+      rule.ip_protocol == "tcp" && rule.from_port == 443 && rule.to_port == 443
+    ])
+    error_message = "Quarantine egress must be limited to HTTPS to the SSM endpoints"
+  }
+}
+
+# One fully isolated group per additional VPC, under the same name
+run "group_per_additional_vpc" {
+  command = plan
+
+  variables {
+    vpc_id             = "vpc-0aaaaaaaaaaaaaaaa"
+    additional_vpc_ids = ["vpc-0bbbbbbbbbbbbbbbb", "vpc-0cccccccccccccccc"]
+  }
+
+  assert {
+    condition     = toset(keys(aws_security_group.quarantine_additional)) == toset(var.additional_vpc_ids)
+    error_message = "Every additional VPC must get a quarantine group of its own"
+  }
+
+  assert {
+    condition = alltrue([
+      for vpc_id, group in aws_security_group.quarantine_additional :
+      group.vpc_id == vpc_id && group.name == var.sg_name && length(group.ingress) == 0
+    ])
+    error_message = "Additional quarantine groups must live in their VPC, share the name and allow no ingress"
+  }
+}
+
+# NACL-based isolation: one rule-less, deny-all network ACL per VPC
+run "quarantine_nacl_per_vpc" {
+  command = plan
+
+  variables {
+    vpc_id                  = "vpc-0aaaaaaaaaaaaaaaa"
+    additional_vpc_ids      = ["vpc-0bbbbbbbbbbbbbbbb"]
+    create_quarantine_nacls = true
+  }
+
+  assert {
+    condition     = length(aws_network_acl.quarantine) == 1 && toset(keys(aws_network_acl.quarantine_additional)) == toset(var.additional_vpc_ids)
+    error_message = "Every VPC must get a quarantine network ACL"
+  }
+
+  assert {
+    condition = alltrue([
+      for acl in concat(aws_network_acl.quarantine, values(aws_network_acl.quarantine_additional)) :
+      length(acl.ingress) == 0 && length(acl.egress) == 0
+    ])
+    error_message = "Quarantine network ACLs must have no allow rules"
+  }
+}
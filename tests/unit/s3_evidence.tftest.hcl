@@ -1,5 +1,5 @@
 # Unit tests for S3 Evidence module
-# Validates bucket versioning, SSE-KMS default, block public access, bucket-owner-enforced, aws:SecureTransport condition, access logging configured, optional Object Lock toggle behavior
+# Validates bucket versioning, SSE-KMS default, block public access, bucket-owner-enforced, aws:SecureTransport condition, access logging configured, optional Object Lock toggle behavior, per-classification retention matrix, restricted prefix readers, cross-region replication
 
 variables {
   bucket_name = "test-ir-evidence-bucket"
@@ -99,6 +99,230 @@ run "access_logging_configured" {
   }
 }
 
+run "access_log_delivery_allowed" {
+  command = plan
+
+  assert {
+    condition     = strcontains(aws_s3_bucket_policy.logs.policy, "logging.s3.amazonaws.com")
+    error_message = "Logs bucket policy must let the S3 logging service deliver access logs"
+  }
+
+  assert {
+    condition     = strcontains(aws_s3_bucket_policy.logs.policy, "aws:SourceArn")
+    error_message = "Access log delivery must be scoped to the evidence bucket"
+  }
+}
+
+run "object_lock_disabled_by_default" {
+  command = plan
+
+  assert {
+    condition     = aws_s3_bucket.evidence.object_lock_enabled == false
+    error_message = "Object Lock must be opt-in, since enabling it replaces the bucket"
+  }
+}
+
+run "object_lock_enabled" {
+  command = plan
+
+  variables {
+    object_lock_enabled = true
+  }
+
+  assert {
+    condition     = aws_s3_bucket.evidence.object_lock_enabled == true
+    error_message = "Evidence bucket must have Object Lock enabled when legal holds are wanted"
+  }
+}
+
+run "lifecycle_matches_retention" {
+  command = plan
+
+  variables {
+    glacier_transition_days      = 30
+    deep_archive_transition_days = 120
+    retention_days               = 2555
+  }
+
+  assert {
+    condition     = aws_s3_bucket_lifecycle_configuration.evidence.rule[0].expiration[0].days == 2555
+    error_message = "Evidence must expire after retention_days"
+  }
+
+  assert {
+    condition = toset([for t in aws_s3_bucket_lifecycle_configuration.evidence.rule[0].transition : "${t.storage_class}:${t.days}"]) == toset(["GLACIER:30", "DEEP_ARCHIVE:120"])
+    error_message = "Evidence must transition to Glacier and Deep Archive at the configured ages"
+  }
+}
+
+run "retention_shorter_than_archive_rejected" {
+  command = plan
+
+  variables {
+    retention_days = 200
+  }
+
+  expect_failures = [
+    aws_s3_bucket_lifecycle_configuration.evidence
+  ]
+}
+
+run "retention_matrix_rules" {
+  command = plan
+
+  variables {
+    retention_matrix = {
+      restricted = { retention_days = 2555, glacier_transition_days = 30, deep_archive_transition_days = 180 }
+      internal   = { retention_days = 400 }
+    }
+  }
+
+  assert {
+    condition     = aws_s3_bucket_lifecycle_configuration.evidence.rule[0].filter[0].prefix == "findings/"
+    error_message = "With a retention matrix the default rule must cover findings/ only, so it does not overlap the classified rules"
+  }
+
+  assert {
+    condition = {
+      for r in aws_s3_bucket_lifecycle_configuration.evidence.rule : r.id => "${r.filter[0].prefix}:${r.expiration[0].days}"
+    } == {
+      "evidence-retention"                = "findings/:365"
+      "evidence-retention-internal"       = "classified/internal/:400"
+      "evidence-retention-restricted"     = "classified/restricted/:2555"
+      "raw-evidence-retention"            = "restricted/findings/:365"
+      "raw-evidence-retention-internal"   = "restricted/classified/internal/:400"
+      "raw-evidence-retention-restricted" = "restricted/classified/restricted/:2555"
+    }
+    error_message = "Each data classification must get its own prefix and expiration"
+  }
+
+  assert {
+    condition = alltrue([
+      for r in aws_s3_bucket_lifecycle_configuration.evidence.rule : length(r.transition) == 0 if r.id == "evidence-retention-internal"
+    ])
+    error_message = "A class without transitions must stay in S3 Standard"
+  }
+}
+
+run "default_rule_covers_bucket_without_matrix" {
+  command = plan
+
+  assert {
+    condition     = length(aws_s3_bucket_lifecycle_configuration.evidence.rule) == 1
+    error_message = "Without a retention matrix there must be a single lifecycle rule"
+  }
+
+  assert {
+    condition     = aws_s3_bucket_lifecycle_configuration.evidence.rule[0].filter[0].prefix == ""
+    error_message = "Without a retention matrix the lifecycle rule must cover the whole bucket"
+  }
+}
+
+run "invalid_retention_matrix_class" {
+  command = plan
+
+  variables {
+    retention_matrix = {
+      "Top Secret" = { retention_days = 400 }
+    }
+  }
+
+  expect_failures = [
+    var.retention_matrix,
+  ]
+}
+
+run "retention_matrix_expiring_before_transition_rejected" {
+  command = plan
+
+  variables {
+    retention_matrix = {
+      restricted = { retention_days = 90, glacier_transition_days = 90 }
+    }
+  }
+
+  expect_failures = [
+    var.retention_matrix,
+  ]
+}
+
+run "restricted_reads_open_by_default" {
+  command = plan
+
+  assert {
+    condition     = length(jsondecode(aws_s3_bucket_policy.evidence.policy).Statement) == 3
+    error_message = "Without restricted readers the bucket policy must not limit reads of restricted/"
+  }
+}
+
+run "restricted_reads_limited_to_readers" {
+  command = plan
+
+  variables {
+    restricted_reader_arns = ["arn:aws:iam::123456789012:role/privacy-officer"]
+  }
+
+  assert {
+    condition     = jsondecode(aws_s3_bucket_policy.evidence.policy).Statement[3].Sid == "DenyRestrictedReads"
+    error_message = "Bucket policy must limit reads of restricted/ when readers are set"
+  }
+
+  assert {
+    condition     = endswith(jsondecode(aws_s3_bucket_policy.evidence.policy).Statement[3].Resource, "/restricted/*")
+    error_message = "Only the restricted/ prefix may be limited to its readers"
+  }
+
+  assert {
+    condition     = jsondecode(aws_s3_bucket_policy.evidence.policy).Statement[3].Condition.ArnNotLike["aws:PrincipalArn"] == ["arn:aws:iam::123456789012:role/privacy-officer"]
+    error_message = "Everyone but the restricted readers must be denied"
+  }
+}
+
+run "replication_disabled_by_default" {
+  command = plan
+
+  assert {
+    condition     = length(aws_s3_bucket_replication_configuration.evidence) == 0
+    error_message = "Evidence must not be replicated without a replica bucket"
+  }
+}
+
+run "replication_to_replica_bucket" {
+  command = plan
+
+  variables {
+    replica_bucket_arn  = "arn:aws:s3:::test-ir-evidence-bucket-replica"
+    replica_kms_key_arn = "arn:aws:kms:us-west-2:123456789012:key/replica"
+  }
+
+  assert {
+    condition     = aws_s3_bucket_replication_configuration.evidence[0].rule[0].destination[0].bucket == "arn:aws:s3:::test-ir-evidence-bucket-replica"
+    error_message = "Evidence must be replicated to the replica bucket"
+  }
+
+  assert {
+    condition     = aws_s3_bucket_replication_configuration.evidence[0].rule[0].source_selection_criteria[0].sse_kms_encrypted_objects[0].status == "Enabled"
+    error_message = "KMS-encrypted evidence must be replicated"
+  }
+
+  assert {
+    condition     = aws_s3_bucket_replication_configuration.evidence[0].rule[0].destination[0].encryption_configuration[0].replica_kms_key_id == "arn:aws:kms:us-west-2:123456789012:key/replica"
+    error_message = "Replicas must be encrypted with the replica key"
+  }
+}
+
+run "replication_without_replica_key_rejected" {
+  command = plan
+
+  variables {
+    replica_bucket_arn = "arn:aws:s3:::test-ir-evidence-bucket-replica"
+  }
+
+  expect_failures = [
+    aws_s3_bucket_replication_configuration.evidence,
+  ]
+}
+
 run "kms_key_rotation_enabled" {
   command = plan
 
@@ -141,6 +365,20 @@ run "deny_unencrypted_puts" {
   }
 }
 
+run "deny_outdated_tls" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_s3_bucket_policy.evidence.policy).Statement[2].Condition.NumericLessThan["s3:TlsVersion"] == "1.2"
+    error_message = "Evidence bucket policy must deny requests below TLS 1.2"
+  }
+
+  assert {
+    condition     = jsondecode(aws_s3_bucket_policy.logs.policy).Statement[2].Condition.NumericLessThan["s3:TlsVersion"] == "1.2"
+    error_message = "Logs bucket policy must deny requests below TLS 1.2"
+  }
+}
+
 run "logs_bucket_public_access_block" {
   command = plan
 
@@ -197,4 +197,54 @@ run "invalid_standard_arn" {
     condition     = aws_securityhub_account.this[0].enable_default_standards == false
     error_message = "Security Hub configuration must be valid"
   }
-}
\ No newline at end of file
+}
+# Standards ARNs follow the partition: GovCloud and China do not use "arn:aws:"
+run "govcloud_partition_arns" {
+  command = plan
+
+  override_data {
+    target = data.aws_partition.current
+    values = {
+      partition  = "aws-us-gov"
+      dns_suffix = "amazonaws.com"
+    }
+  }
+
+  override_data {
+    target = data.aws_region.current
+    values = {
+      name   = "us-gov-west-1"
+      region = "us-gov-west-1"
+    }
+  }
+
+  assert {
+    condition     = aws_securityhub_standards_subscription.aws_foundational[0].standards_arn == "arn:aws-us-gov:securityhub:us-gov-west-1::standards/aws-foundational-security-best-practices/v/1.0.0"
+    error_message = "Standards ARNs must use the GovCloud partition in GovCloud regions"
+  }
+}
+
+run "china_partition_arns" {
+  command = plan
+
+  override_data {
+    target = data.aws_partition.current
+    values = {
+      partition  = "aws-cn"
+      dns_suffix = "amazonaws.com.cn"
+    }
+  }
+
+  override_data {
+    target = data.aws_region.current
+    values = {
+      name   = "cn-north-1"
+      region = "cn-north-1"
+    }
+  }
+
+  assert {
+    condition     = aws_securityhub_standards_subscription.aws_foundational[0].standards_arn == "arn:aws-cn:securityhub:cn-north-1::standards/aws-foundational-security-best-practices/v/1.0.0"
+    error_message = "Standards ARNs must use the China partition in China regions"
+  }
+}
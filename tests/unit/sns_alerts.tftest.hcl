@@ -12,6 +12,10 @@ variables {
       endpoint = "https://webhook.company.com/alerts"
     }
   ]
+  publisher_role_arns = [
+    "arn:aws:iam::123456789012:role/lambda-triage-role",
+    "arn:aws:iam::123456789012:role/stepfn-ir-role"
+  ]
   tags = {
     Environment = "test"
     Project     = "threat-detection-ir"
@@ -60,6 +64,38 @@ run "topic_policy_restricts_publishers" {
   }
 }
 
+run "topic_policy_denies_other_principals" {
+  command = plan
+
+  assert {
+    condition     = strcontains(aws_sns_topic_policy.alerts.policy, "DenyOtherPrincipals")
+    error_message = "Topic policy must deny publishing from principals outside publisher_role_arns"
+  }
+
+  assert {
+    condition     = strcontains(aws_sns_topic_policy.alerts.policy, "aws:PrincipalIsAWSService")
+    error_message = "Topic policy deny must exempt AWS service principals"
+  }
+
+  assert {
+    condition     = strcontains(aws_kms_key.alerts.policy, "stepfn-ir-role")
+    error_message = "Topic key policy must let publishers encrypt messages"
+  }
+}
+
+run "no_publishers_no_principal_deny" {
+  command = plan
+
+  variables {
+    publisher_role_arns = []
+  }
+
+  assert {
+    condition     = !strcontains(aws_sns_topic_policy.alerts.policy, "DenyOtherPrincipals")
+    error_message = "Topic policy must not deny every principal when no publishers are configured"
+  }
+}
+
 run "encryption_required_policy" {
   command = plan
 
@@ -207,4 +243,84 @@ run "invalid_endpoint" {
   expect_failures = [
     aws_sns_topic_subscription.email
   ]
-}
\ No newline at end of file
+}
+
+run "urgent_topic_configured" {
+  command = plan
+
+  variables {
+    urgent_subscriptions = [
+      {
+        protocol = "https"
+        endpoint = "https://events.pagerduty.com/integration/abc/enqueue"
+      }
+    ]
+  }
+
+  assert {
+    condition     = aws_sns_topic.urgent.kms_master_key_id == aws_sns_topic.alerts.kms_master_key_id
+    error_message = "Urgent topic must be encrypted with the alerts KMS key"
+  }
+
+  assert {
+    condition     = strcontains(aws_sns_topic_policy.urgent.policy, "DenyOtherPrincipals")
+    error_message = "Urgent topic must restrict publishing like the standard topic"
+  }
+
+  assert {
+    condition     = length(aws_sns_topic_subscription.urgent) == 1 && length(aws_sns_topic_subscription.alerts) == 2
+    error_message = "Urgent subscriptions must only subscribe to the urgent topic"
+  }
+}
+
+run "subscription_filter_policy_configured" {
+  command = plan
+
+  variables {
+    subscriptions = [
+      {
+        protocol      = "https"
+        endpoint      = "https://webhook.company.com/alerts"
+        filter_policy = "{\"severity\":[\"HIGH\",\"CRITICAL\"]}"
+      },
+      {
+        protocol = "email"
+        endpoint = "security@company.com"
+      }
+    ]
+  }
+
+  assert {
+    condition     = jsondecode(aws_sns_topic_subscription.alerts["0"].filter_policy).severity == ["HIGH", "CRITICAL"]
+    error_message = "Subscription must carry its filter policy"
+  }
+
+  assert {
+    condition     = aws_sns_topic_subscription.alerts["1"].filter_policy == null
+    error_message = "Subscriptions without a filter policy must receive every notification"
+  }
+}
+
+run "ops_topic_accepts_cloudwatch_alarms" {
+  command = plan
+
+  assert {
+    condition     = aws_sns_topic.ops.kms_master_key_id == aws_sns_topic.alerts.kms_master_key_id
+    error_message = "Ops topic must be encrypted with the alerts KMS key"
+  }
+
+  assert {
+    condition     = strcontains(aws_sns_topic_policy.ops.policy, "AllowCloudWatchAlarms")
+    error_message = "Ops topic must let CloudWatch alarms publish"
+  }
+
+  assert {
+    condition     = !strcontains(aws_sns_topic_policy.alerts.policy, "AllowCloudWatchAlarms")
+    error_message = "Only the ops topic may take alarm notifications"
+  }
+
+  assert {
+    condition     = strcontains(aws_kms_key.alerts.policy, "cloudwatch.amazonaws.com")
+    error_message = "Topic key policy must let CloudWatch encrypt alarm notifications"
+  }
+}
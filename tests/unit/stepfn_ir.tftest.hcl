@@ -55,8 +55,99 @@ run "state_machine_start_state" {
   command = plan
 
   assert {
-    condition = strcontains(aws_sfn_state_machine.ir.definition, "\"StartAt\": \"StoreEvidence\"")
-    error_message = "State machine must start with StoreEvidence state"
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).StartAt == "CheckArchived"
+    error_message = "State machine must first check whether the finding is archived"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckArchived.Default == "StoreEvidence"
+    error_message = "Findings that are not archived must go on to StoreEvidence"
+  }
+}
+
+run "archived_findings_not_responded_to" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckArchived.Choices[0].Next == "FindingArchived"
+    error_message = "Archived findings must skip the response"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.FindingArchived.Type == "Succeed"
+    error_message = "Skipping an archived finding must not fail the execution"
+  }
+}
+
+run "securityhub_update_awaits_import" {
+  command = plan
+
+  variables {
+    securityhub_update_attempts = 5
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.ResolveSecurityHubFinding.Next == "CheckSecurityHubResolved"
+    error_message = "Unprocessed Security Hub updates must be checked for"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckSecurityHubResolved.Choices[0].And[1].NumericGreaterThanEquals == 5
+    error_message = "Unprocessed Security Hub updates must be retried securityhub_update_attempts times"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.SecurityHubNotImported.Next == "RecordCompensation"
+    error_message = "A finding Security Hub never imported must be recorded for manual follow-up"
+  }
+}
+
+run "resolved_findings_archived_in_guardduty" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.Notify.Next == "CheckContained"
+    error_message = "Findings must be checked for containment before they are resolved"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckContained.Choices[0].Next == "UpdateSecurityHub"
+    error_message = "Only contained findings may be resolved in Security Hub"
+  }
+
+  assert {
+    condition     = length(jsondecode(aws_sfn_state_machine.ir.definition).States.CheckContained.Choices[0].And) == 3
+    error_message = "A finding counts as contained only if a target was isolated and none was recorded or notify-only"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckContained.Default == "FindingLeftOpen"
+    error_message = "Findings that were not contained must be left open"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.SecurityHubResolved.Next == "UpdateGuardDuty"
+    error_message = "Findings must be archived in GuardDuty once resolved in Security Hub"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.NoSecurityHubFinding.Next == "UpdateGuardDuty"
+    error_message = "Findings not in Security Hub must still be archived in GuardDuty"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.ArchiveGuardDutyFinding.Resource == "arn:aws:states:::aws-sdk:guardduty:archiveFindings"
+    error_message = "Contained findings must be archived through GuardDuty ArchiveFindings"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.ArchiveGuardDutyFinding.Catch[0].Next == "RecordArchiveCompensation"
+    error_message = "A failed archive must be recorded for manual follow-up"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.GuardDutyArchiveFailed.Error == "IR.GuardDutyArchiveFailed"
+    error_message = "A failed archive must fail the execution with IR.GuardDutyArchiveFailed"
   }
 }
 
@@ -173,6 +264,64 @@ run "output_path_includes_status" {
   }
 }
 
+run "isolation_fans_out_per_target" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.Type == "Map"
+    error_message = "IsolateResource must be a Map state with one containment branch per target"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemsPath == "$.targets"
+    error_message = "IsolateResource must iterate over the targets resolved by triage"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ResultPath == "$.containment"
+    error_message = "Per-target containment results must be aggregated into $.containment"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckTargets.Default == "NoTargets"
+    error_message = "Executions started without targets must be routed to NoTargets"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.NoTargets.Type == "Succeed"
+    error_message = "Executions without targets must end without resolving or archiving the finding"
+  }
+}
+
+run "partial_containment_failure_routed" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.CheckContainment.Choices[0].Next == "DescribeContainmentFailure"
+    error_message = "Findings with uncontained resources must take the failure path"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.NotifyContainmentFailure.Resource == "arn:aws:states:::sns:publish"
+    error_message = "Containment failures must be notified"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.QueueForRemediation.Resource == "arn:aws:states:::sqs:sendMessage"
+    error_message = "Containment failures must be routed to the remediation DLQ"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.ContainmentPartiallyFailed.Error == "IR.PartialFailure"
+    error_message = "A partially contained finding must fail the execution with IR.PartialFailure"
+  }
+
+  assert {
+    condition     = aws_sqs_queue.remediation_dlq.sqs_managed_sse_enabled == true
+    error_message = "Remediation DLQ must be encrypted"
+  }
+}
+
 run "state_machine_iam_role" {
   command = plan
 
@@ -281,4 +430,151 @@ run "invalid_log_group_arn" {
   expect_failures = [
     aws_sfn_state_machine.ir
   ]
-}
\ No newline at end of file
+}
+# Interfaces are moved into the quarantine group of their own VPC, or reported failed if it has none
+run "quarantine_group_matches_interface_vpc" {
+  command = plan
+
+  variables {
+    additional_quarantine_sg_ids = ["sg-87654321"]
+  }
+
+  assert {
+    condition = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.FindQuarantineGroup.Parameters.Filters[1].Values == [
+      "sg-12345678", "sg-87654321"
+    ]
+    error_message = "The quarantine group lookup must consider the groups of every VPC"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.FindQuarantineGroup.Parameters.Filters[0]["Values.$"] == "States.Array($.interface.vpc)"
+    error_message = "The quarantine group lookup must be limited to the interface's VPC"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.CheckQuarantineGroup.Default == "NoQuarantineGroup"
+    error_message = "An interface in a VPC without a quarantine group must be reported as failed"
+  }
+}
+
+# Each isolation strategy pins what containing an interface changes
+run "strategy_replace_all_sgs" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.IsolateInterface.Parameters["Groups.$"] == "States.Array($.quarantine.groups[0])"
+    error_message = "replace-all-SGs must leave the quarantine group as the interface's only group"
+  }
+}
+
+run "strategy_attach_quarantine_additionally" {
+  command = plan
+
+  variables {
+    isolation_strategy = "attach-quarantine-additionally"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.CheckQuarantineGroup.Choices[0].Next == "AddQuarantineGroup"
+    error_message = "attach-quarantine-additionally must merge the quarantine group into the interface's groups"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.IsolateInterface.Parameters["Groups.$"] == "$.groups"
+    error_message = "attach-quarantine-additionally must keep the interface's own groups"
+  }
+}
+
+run "strategy_nacl_based" {
+  command = plan
+
+  variables {
+    isolation_strategy  = "NACL-based"
+    quarantine_nacl_ids = ["acl-12345678"]
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.LocateInterface.Next == "FindQuarantineAcl"
+    error_message = "NACL-based isolation must look up the quarantine network ACL of the interface's VPC"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.IsolateSubnet.Resource == "arn:aws:states:::aws-sdk:ec2:replaceNetworkAclAssociation"
+    error_message = "NACL-based isolation must move the interface's subnet to the quarantine network ACL"
+  }
+
+  assert {
+    condition     = !can(jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.IsolateInterface)
+    error_message = "NACL-based isolation must not change the interface's security groups"
+  }
+}
+
+run "invalid_isolation_strategy" {
+  command = plan
+
+  variables {
+    isolation_strategy = "detach-all"
+  }
+
+  expect_failures = [
+    var.isolation_strategy
+  ]
+}
+
+# EKS findings are left to responders; the workflow has no access to the cluster's API
+run "eks_clusters_notify_only" {
+  command = plan
+
+  assert {
+    condition = contains([
+      for choice in jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.ClassifyTarget.Choices :
+      choice.Next if try(choice.StringMatches, "") == "eks-cluster:*"
+    ], "NotifyOnly")
+    error_message = "EKS cluster targets must be routed to NotifyOnly"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.NotifyOnly.Parameters.status == "notify-only"
+    error_message = "EKS cluster targets must be reported as notify-only"
+  }
+}
+
+# An ECS task's host is drained before the task is stopped, so the service does not relaunch it there
+run "ecs_tasks_drain_host_then_stop" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.DrainHost.Parameters.Status == "DRAINING"
+    error_message = "The host of an ECS task must be drained"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.DrainHost.Next == "StopTask"
+    error_message = "An ECS task must be stopped only once its host is drained"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.ContainTask.Parameters["hosts.$"] == "$.task.hosts"
+    error_message = "The drained hosts must be recorded with the containment result"
+  }
+}
+
+# Targets no containment branch acts on are recorded, and only isolated targets count as contained
+run "unhandled_targets_recorded" {
+  command = plan
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.ClassifyTarget.Default == "RecordTarget"
+    error_message = "Targets without a containment branch must be routed to RecordTarget"
+  }
+
+  assert {
+    condition     = jsondecode(aws_sfn_state_machine.ir.definition).States.IsolateResource.ItemProcessor.States.RecordTarget.Parameters.status == "recorded"
+    error_message = "Targets without a containment branch must be reported as recorded"
+  }
+
+  assert {
+    condition     = strcontains(jsondecode(aws_sfn_state_machine.ir.definition).States.SummarizeContainment.Parameters["summary.$"], "States.ArrayLength($.containment.isolated)")
+    error_message = "The containment summary must count only isolated targets"
+  }
+}
@@ -16,6 +16,12 @@ variable "delegated_admin_account_id" {
   default     = ""
 }
 
+variable "account_classification" {
+  description = "Class of each account, production or sandbox, e.g. { \"111122223333\" = \"sandbox\" }. In org mode, findings from sandbox member accounts are recorded and notified at low priority without isolation or paging; unlisted accounts get the full response"
+  type        = map(string)
+  default     = {}
+}
+
 variable "enable_standards" {
   description = "Map of Security Hub standards to enable"
   type        = map(bool)
@@ -39,14 +45,143 @@ variable "kms_alias" {
   default     = "alias/ir-evidence-key"
 }
 
+variable "evidence_retention_days" {
+  description = "Days evidence is kept before it expires"
+  type        = number
+  default     = 365
+}
+
+variable "evidence_glacier_transition_days" {
+  description = "Days after which evidence moves to S3 Glacier Flexible Retrieval"
+  type        = number
+  default     = 90
+}
+
+variable "evidence_deep_archive_transition_days" {
+  description = "Days after which evidence moves to S3 Glacier Deep Archive"
+  type        = number
+  default     = 180
+}
+
+variable "evidence_object_lock_enabled" {
+  description = "Enable S3 Object Lock on the evidence bucket so evidence can be put under legal hold; changing it replaces the bucket"
+  type        = bool
+  default     = false
+}
+
+variable "evidence_replica_bucket_arn" {
+  description = "ARN of a versioned bucket in another region, e.g. the evidence bucket of the stack in the recovery region, that evidence is replicated to; empty disables replication"
+  type        = string
+  default     = ""
+}
+
+variable "evidence_replica_kms_key_arn" {
+  description = "ARN of the KMS key evidence replicas are encrypted with; required with evidence_replica_bucket_arn"
+  type        = string
+  default     = ""
+}
+
+variable "evidence_retention_matrix" {
+  description = "Retention per data classification: evidence of resources whose data_classification_tag names a class here is stored under classified/<class>/ with the class's lifecycle instead of the evidence_* defaults"
+  type = map(object({
+    retention_days               = number
+    glacier_transition_days      = optional(number)
+    deep_archive_transition_days = optional(number)
+  }))
+  default = {}
+}
+
+variable "data_classification_tag" {
+  description = "Resource tag holding the data classification matched against evidence_retention_matrix"
+  type        = string
+  default     = "DataClassification"
+}
+
+variable "pii_scrubbing_enabled" {
+  description = "Redact pii_scrub_fields from stored evidence, notifications, the IR execution input and the incident index, keeping the raw finding encrypted under restricted/ in the evidence bucket"
+  type        = bool
+  default     = false
+}
+
+variable "pii_scrub_fields" {
+  description = "Finding fields redacted wherever they appear when pii_scrubbing_enabled is set"
+  type        = list(string)
+  default     = ["privateIpAddress", "privateDnsName", "userName", "accessKeyId", "principalId"]
+}
+
+variable "pii_raw_reader_arns" {
+  description = "IAM principals allowed to read the raw findings kept by PII scrubbing (empty leaves them to IAM)"
+  type        = list(string)
+  default     = []
+}
+
 variable "quarantine_sg_name" {
   description = "Name for the quarantine security group"
   type        = string
   default     = "quarantine-sg"
 }
 
+variable "quarantine_vpc_id" {
+  description = "VPC for the quarantine security group (null uses the default VPC)"
+  type        = string
+  default     = null
+}
+
+variable "quarantine_additional_vpc_ids" {
+  description = "Other VPCs whose resources may be isolated; each gets a quarantine security group of its own"
+  type        = list(string)
+  default     = []
+}
+
+variable "isolation_strategy" {
+  description = "How network interfaces are isolated: replace-all-SGs swaps every group for the quarantine group, attach-quarantine-additionally adds it next to the existing groups, NACL-based moves the subnet to a deny-all network ACL"
+  type        = string
+  default     = "replace-all-SGs"
+
+  validation {
+    condition     = contains(["replace-all-SGs", "attach-quarantine-additionally", "NACL-based"], var.isolation_strategy)
+    error_message = "isolation_strategy must be replace-all-SGs, attach-quarantine-additionally or NACL-based"
+  }
+}
+
+variable "quarantine_allow_ssm_endpoints" {
+  description = "Keep Session Manager access to quarantined instances through SSM VPC endpoints instead of full isolation"
+  type        = bool
+  default     = false
+}
+
 variable "sns_subscriptions" {
   description = "List of SNS subscriptions"
+  type = list(object({
+    protocol      = string
+    endpoint      = string
+    filter_policy = optional(string)
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for sub in var.sns_subscriptions : sub.filter_policy == null || can(jsondecode(sub.filter_policy))])
+    error_message = "sns_subscriptions filter_policy must be a JSON document"
+  }
+}
+
+variable "sns_urgent_subscriptions" {
+  description = "Subscriptions to the urgent topic, which receives CRITICAL findings instead of the standard topic"
+  type = list(object({
+    protocol      = string
+    endpoint      = string
+    filter_policy = optional(string)
+  }))
+  default = []
+
+  validation {
+    condition     = alltrue([for sub in var.sns_urgent_subscriptions : sub.filter_policy == null || can(jsondecode(sub.filter_policy))])
+    error_message = "sns_urgent_subscriptions filter_policy must be a JSON document"
+  }
+}
+
+variable "sns_ops_subscriptions" {
+  description = "Subscriptions to the ops topic, which receives CloudWatch alarms on the pipeline; production deployments need at least one confirmed subscription"
   type = list(object({
     protocol = string
     endpoint = string
@@ -60,12 +195,149 @@ variable "finding_severity_threshold" {
   default     = "HIGH"
 }
 
+variable "enable_securityhub_custom_findings" {
+  description = "Route custom (non-GuardDuty) Security Hub findings above the threshold into the IR pipeline"
+  type        = bool
+  default     = true
+}
+
+variable "enable_canary_findings" {
+  description = "Route synthetic findings published by ir-canary into triage; anyone allowed to put events on the default bus can then inject findings marked as canary"
+  type        = bool
+  default     = false
+}
+
+variable "enable_quarantine_flow_logs" {
+  description = "Enable VPC flow logs on quarantined instances for forensic traffic capture"
+  type        = bool
+  default     = true
+}
+
+variable "lambda_memory_size" {
+  description = "Memory size in MB for the Lambda triage function (128 is the Lambda default)"
+  type        = number
+  default     = 128
+}
+
+variable "lambda_reserved_concurrency" {
+  description = "Reserved concurrent executions for the Lambda triage function (null leaves it unreserved)"
+  type        = number
+  default     = null
+}
+
+variable "lambda_code_signing_config_arn" {
+  description = "Lambda code signing config for the triage function; with an enforcing config the package must be signed by an allowed profile before apply (null disables code signing)"
+  type        = string
+  default     = null
+}
+
+variable "finding_dedup_window_minutes" {
+  description = "Minutes during which updates of an already triaged finding at the same or lower severity are not triaged again (0 disables deduplication)"
+  type        = number
+  default     = 60
+}
+
+variable "isolation_exemption_tag" {
+  description = "Instance tag (key=value) marking instances, e.g. honeypots, whose findings are recorded as evidence but never isolated or paged (empty disables exemptions)"
+  type        = string
+  default     = "ir:exempt=true"
+}
+
+variable "deferred_drain_interval_minutes" {
+  description = "Minutes between checks for findings deferred by a containment pause that can now be triaged"
+  type        = number
+  default     = 5
+}
+
+variable "integration_secret_arns" {
+  description = "Secrets Manager ARNs of third-party integration credentials (e.g. slack, jira); they must be encrypted with the evidence KMS key and have rotation configured"
+  type        = map(string)
+  default     = {}
+
+  validation {
+    condition     = alltrue([for arn in values(var.integration_secret_arns) : can(regex("^arn:aws[a-z-]*:secretsmanager:", arn))])
+    error_message = "integration_secret_arns values must be Secrets Manager secret ARNs"
+  }
+}
+
+variable "retain_log_groups" {
+  description = "Keep the pipeline's CloudWatch log groups when the stack is destroyed"
+  type        = bool
+  default     = false
+}
+
+variable "enable_sqs_buffer" {
+  description = "Buffer findings in an SQS queue between EventBridge and the triage function, so bursts queue up instead of throttling it"
+  type        = bool
+  default     = false
+}
+
+variable "sqs_buffer_batch_size" {
+  description = "Maximum number of buffered findings triaged per invocation (with enable_sqs_buffer)"
+  type        = number
+  default     = 10
+}
+
+variable "threat_intel_endpoint" {
+  description = "HTTPS threat intel endpoint the triage Lambda asks for the reputation of remote IPs in findings (empty disables the lookups)"
+  type        = string
+  default     = ""
+}
+
+variable "threat_intel_provider" {
+  description = "API the threat intel endpoint speaks: generic, virustotal or otx, with its API key in integration_secret_arns under the same name"
+  type        = string
+  default     = "generic"
+}
+
+variable "threat_intel_timeout_seconds" {
+  description = "Seconds a threat intel lookup may take before the finding is triaged without that IP's reputation"
+  type        = number
+  default     = 3
+}
+
+variable "use_fips_endpoints" {
+  description = "Use FIPS endpoints for Terraform and the triage Lambda's AWS calls (US, Canada and GovCloud regions only)"
+  type        = bool
+  default     = false
+}
+
+variable "enable_incident_index" {
+  description = "Record each triaged finding in a DynamoDB incident table indexed by resource and status"
+  type        = bool
+  default     = false
+}
+
+variable "recurrence_escalation_window_minutes" {
+  description = "Minutes after a finding is triaged during which a new finding of the same type on the same resource is escalated: paged as CRITICAL, contained even during a containment pause, and linked to the earlier finding. Needs enable_incident_index (0 disables escalation)"
+  type        = number
+  default     = 0
+}
+
+variable "enable_finding_export" {
+  description = "Export every GuardDuty finding through Firehose to an analytics bucket queryable with Athena"
+  type        = bool
+  default     = false
+}
+
+variable "finding_export_format" {
+  description = "Format of exported findings: JSON, or PARQUET converted by Firehose (with enable_finding_export)"
+  type        = string
+  default     = "JSON"
+}
+
 variable "regions" {
   description = "List of AWS regions to enable GuardDuty"
   type        = list(string)
   default     = ["us-east-1", "us-west-2", "eu-west-1"]
 }
 
+variable "name_prefix" {
+  description = "Prefix applied to resource names so multiple stacks can share an account"
+  type        = string
+  default     = ""
+}
+
 variable "tags" {
   description = "Common tags for all resources"
   type        = map(string)